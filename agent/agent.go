@@ -34,6 +34,7 @@ const (
 	registerFlag            = "register"
 	fingerprintFlag         = "fingerprint"
 	similarityThresholdFlag = "similarityThreshold"
+	machineStateFlag        = "machinestate"
 )
 
 var (
@@ -41,6 +42,7 @@ var (
 	activationCode, activationID, region string
 	register, clear, force, fpFlag       bool
 	similarityThreshold                  int
+	machineStateCommandID                string
 	registrationFile                     = filepath.Join(appconfig.DefaultDataStorePath, "registration")
 )
 
@@ -49,6 +51,13 @@ func start(log logger.T, instanceIDPtr *string, regionPtr *string) (cpm *coreman
 	log.Infof("OS: %s, Arch: %s", runtime.GOOS, runtime.GOARCH)
 	log.Flush()
 
+	// the agent does not start on a volume it cannot write to
+	config, _ := appconfig.Config(false)
+	if err = appconfig.ValidateStorage(config.Storage); err != nil {
+		log.Errorf("error occured when validating the storage: %v", err)
+		return
+	}
+
 	if cpm, err = coremanager.NewCoreManager(instanceIDPtr, regionPtr, log); err != nil {
 		log.Errorf("error occured when starting core manager: %v", err)
 		return
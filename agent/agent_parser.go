@@ -27,6 +27,7 @@ import (
 	"github.com/aws/amazon-ssm-agent/agent/fingerprint"
 	logger "github.com/aws/amazon-ssm-agent/agent/log"
 	"github.com/aws/amazon-ssm-agent/agent/managedInstances/registration"
+	"github.com/aws/amazon-ssm-agent/agent/snapshot"
 	"github.com/aws/amazon-ssm-agent/agent/ssm/anonauth"
 )
 
@@ -52,6 +53,9 @@ func parseFlags(log logger.T) {
 	flag.BoolVar(&fpFlag, fingerprintFlag, false, "")
 	flag.IntVar(&similarityThreshold, similarityThresholdFlag, 40, "")
 
+	// machine states captured before the steps of a command
+	flag.StringVar(&machineStateCommandID, machineStateFlag, "", "")
+
 	// force flag
 	flag.BoolVar(&force, "y", false, "")
 
@@ -63,6 +67,8 @@ func parseFlags(log logger.T) {
 			exitCode = processRegistration(log)
 		} else if fpFlag {
 			exitCode = processFingerprint(log)
+		} else if machineStateCommandID != "" {
+			exitCode = processMachineState(log)
 		} else {
 			flagUsage()
 		}
@@ -80,6 +86,8 @@ func flagUsage() {
 	fmt.Fprintln(os.Stderr, "\t\t-code\tSSM activation code\t(REQUIRED)")
 	fmt.Fprintln(os.Stderr, "\t\t-region\tSSM region       \t(REQUIRED)")
 	fmt.Fprintln(os.Stderr, "\n\t\t-clear\tClears the previously saved SSM registration")
+	fmt.Fprintln(os.Stderr, "\n\t-machinestate\tprint the machine state captured before the steps of a command")
+	fmt.Fprintln(os.Stderr, "\t\t<command id>\tID of the command    \t(REQUIRED)")
 	fmt.Fprintln(os.Stderr, "\n\t-y\tAnswer yes for all questions")
 }
 
@@ -128,6 +136,22 @@ func processFingerprint(log logger.T) (exitCode int) {
 	return 0
 }
 
+// processMachineState prints the machine states captured before the steps of a command, for rollback documents
+func processMachineState(log logger.T) (exitCode int) {
+	states, err := snapshot.FindMachineStates(machineStateCommandID)
+	if err != nil {
+		log.Errorf("Unable to read the machine states. %v", err)
+		return 1
+	}
+	content, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		log.Errorf("Unable to format the machine states. %v", err)
+		return 1
+	}
+	fmt.Println(string(content))
+	return 0
+}
+
 // registerManagedInstance checks for activation credentials and performs managed instance registration when present
 func registerManagedInstance() (managedInstanceID string, err error) {
 	// try to activate the instance with the activation credentials
@@ -0,0 +1,215 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package agenterror defines the stable codes of the failures of the agent, so that fleet operators can aggregate
+// failures by cause instead of by message. Every code belongs to a category and tells whether retrying may succeed.
+// The codes are reported in the logs, in the replies and in the counters of the health check; once released,
+// a code keeps its meaning.
+package agenterror
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+)
+
+// Category groups the codes by the party that can fix the failure.
+type Category string
+
+const (
+	// CategoryDocument is for documents and parameters the agent cannot run.
+	CategoryDocument Category = "Document"
+
+	// CategoryExecution is for commands which ran and failed.
+	CategoryExecution Category = "Execution"
+
+	// CategoryPlatform is for instances missing a prerequisite, a permission or a resource.
+	CategoryPlatform Category = "Platform"
+
+	// CategoryService is for failed calls to the AWS services.
+	CategoryService Category = "Service"
+
+	// CategoryInternal is for failures of the agent itself.
+	CategoryInternal Category = "Internal"
+)
+
+// Code is the stable identifier of a cause of failure, such as SSM-2001.
+type Code string
+
+// Definition describes a registered code.
+type Definition struct {
+	Code        Code
+	Category    Category
+	Retryable   bool
+	Description string
+}
+
+var (
+	registry      = make(map[Code]Definition)
+	counts        = make(map[Code]int)
+	registryMutex sync.RWMutex
+)
+
+// The codes of the agent. The first digit after the prefix is the category.
+var (
+	Unknown = Register("SSM-0000", CategoryInternal, false, "unclassified failure")
+
+	InvalidDocument      = Register("SSM-1001", CategoryDocument, false, "the document or its parameters are invalid")
+	PluginNotFound       = Register("SSM-1002", CategoryDocument, false, "the document uses a plugin the agent does not support")
+	InvalidCancelRequest = Register("SSM-1003", CategoryDocument, false, "the cancel request is invalid")
+
+	CommandFailed   = Register("SSM-2001", CategoryExecution, false, "the command exited with a non zero code")
+	CommandTimedOut = Register("SSM-2002", CategoryExecution, true, "the command did not complete before its timeout")
+
+	BlockedByAntimalware = Register("SSM-3001", CategoryPlatform, false, "the antimalware provider blocked the script")
+
+	ServiceCallFailed = Register("SSM-4001", CategoryService, true, "a call to an AWS service failed")
+
+	PluginCrashed = Register("SSM-5001", CategoryInternal, false, "the plugin crashed")
+)
+
+// Register adds a code to the registry and returns it.
+// It panics when the code is already registered, codes are registered once when the program starts.
+func Register(code Code, category Category, retryable bool, description string) Code {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if _, exists := registry[code]; exists {
+		panic(fmt.Sprintf("error code %v is registered twice", code))
+	}
+	registry[code] = Definition{Code: code, Category: category, Retryable: retryable, Description: description}
+	return code
+}
+
+// Lookup returns the definition of a code.
+func Lookup(code Code) (definition Definition, found bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	definition, found = registry[code]
+	return
+}
+
+// Definitions returns the registered codes, sorted by code.
+func Definitions() []Definition {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	definitions := make(definitionsByCode, 0, len(registry))
+	for _, definition := range registry {
+		definitions = append(definitions, definition)
+	}
+	sort.Sort(definitions)
+	return definitions
+}
+
+// AgentError is an error with a stable code.
+type AgentError struct {
+	Code      Code
+	Category  Category
+	Retryable bool
+	Message   string
+	Cause     error
+}
+
+// Error returns the message prefixed with the code, followed by the cause.
+func (e *AgentError) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("[%v] %v: %v", e.Code, e.Message, e.Cause)
+	}
+	return fmt.Sprintf("[%v] %v", e.Code, e.Message)
+}
+
+// New returns an error with the given code and message.
+func New(code Code, format string, args ...interface{}) *AgentError {
+	return Wrap(code, nil, format, args...)
+}
+
+// Wrap returns an error with the given code and message, caused by err.
+func Wrap(code Code, err error, format string, args ...interface{}) *AgentError {
+	definition, found := Lookup(code)
+	if !found {
+		definition, _ = Lookup(Unknown)
+		definition.Code = code
+	}
+	return &AgentError{
+		Code:      code,
+		Category:  definition.Category,
+		Retryable: definition.Retryable,
+		Message:   fmt.Sprintf(format, args...),
+		Cause:     err,
+	}
+}
+
+// CodeOf returns the code of an error, Unknown for the errors without a code and an empty code for nil.
+func CodeOf(err error) Code {
+	if err == nil {
+		return ""
+	}
+	if agentError, ok := err.(*AgentError); ok {
+		return agentError.Code
+	}
+	return Unknown
+}
+
+// IsRetryable returns true if the error has a code for which retrying may succeed.
+func IsRetryable(err error) bool {
+	agentError, ok := err.(*AgentError)
+	return ok && agentError.Retryable
+}
+
+// CodeOfResult returns the code of the result of a plugin: the code of its error, or the code of its status.
+// Successful results, and results still in progress, have no code.
+func CodeOfResult(status contracts.ResultStatus, err error) Code {
+	if err != nil {
+		if agentError, ok := err.(*AgentError); ok {
+			return agentError.Code
+		}
+	}
+	switch status {
+	case contracts.ResultStatusFailed:
+		return CommandFailed
+	case contracts.ResultStatusTimedOut:
+		return CommandTimedOut
+	case contracts.ResultStatusBlockedByAntimalware:
+		return BlockedByAntimalware
+	}
+	return CodeOf(err)
+}
+
+// Record counts an occurrence of a code, the counts are reported with the health of the agent.
+func Record(code Code) {
+	if code == "" {
+		return
+	}
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	counts[code]++
+}
+
+// Counts returns the number of occurrences of each code since the agent started.
+func Counts() map[Code]int {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	snapshot := make(map[Code]int, len(counts))
+	for code, count := range counts {
+		snapshot[code] = count
+	}
+	return snapshot
+}
+
+// definitionsByCode sorts definitions by code.
+type definitionsByCode []Definition
+
+func (d definitionsByCode) Len() int           { return len(d) }
+func (d definitionsByCode) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d definitionsByCode) Less(i, j int) bool { return d[i].Code < d[j].Code }
@@ -0,0 +1,69 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package agenterror
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAgentError(t *testing.T) {
+	err := Wrap(ServiceCallFailed, fmt.Errorf("connection reset"), "failed to send the reply of %v", "aws.ssm.c1.i-1")
+	assert.Equal(t, "[SSM-4001] failed to send the reply of aws.ssm.c1.i-1: connection reset", err.Error())
+	assert.Equal(t, CategoryService, err.Category)
+	assert.True(t, IsRetryable(err))
+	assert.Equal(t, ServiceCallFailed, CodeOf(err))
+
+	err = New(PluginNotFound, "no plugin %v", "aws:foo")
+	assert.Equal(t, "[SSM-1002] no plugin aws:foo", err.Error())
+	assert.False(t, IsRetryable(err))
+
+	assert.Equal(t, Unknown, CodeOf(fmt.Errorf("free form")))
+	assert.False(t, IsRetryable(fmt.Errorf("free form")))
+	assert.Equal(t, Code(""), CodeOf(nil))
+}
+
+func TestCodeOfResult(t *testing.T) {
+	assert.Equal(t, Code(""), CodeOfResult(contracts.ResultStatusSuccess, nil))
+	assert.Equal(t, Code(""), CodeOfResult(contracts.ResultStatusInProgress, nil))
+	assert.Equal(t, CommandFailed, CodeOfResult(contracts.ResultStatusFailed, fmt.Errorf("exit status 1")))
+	assert.Equal(t, CommandTimedOut, CodeOfResult(contracts.ResultStatusTimedOut, nil))
+	assert.Equal(t, BlockedByAntimalware, CodeOfResult(contracts.ResultStatusBlockedByAntimalware, nil))
+	assert.Equal(t, PluginCrashed, CodeOfResult(contracts.ResultStatusFailed, New(PluginCrashed, "panic")))
+}
+
+func TestRegistry(t *testing.T) {
+	definition, found := Lookup(CommandTimedOut)
+	assert.True(t, found)
+	assert.Equal(t, Definition{Code: CommandTimedOut, Category: CategoryExecution, Retryable: true, Description: "the command did not complete before its timeout"}, definition)
+
+	definitions := Definitions()
+	for i := 1; i < len(definitions); i++ {
+		assert.True(t, definitions[i-1].Code < definitions[i].Code)
+	}
+	assert.Panics(t, func() { Register(CommandFailed, CategoryExecution, false, "duplicate") })
+}
+
+func TestCounts(t *testing.T) {
+	before := Counts()[CommandFailed]
+	Record(CommandFailed)
+	Record(CommandFailed)
+	Record("")
+	assert.Equal(t, before+2, Counts()[CommandFailed])
+	_, counted := Counts()[""]
+	assert.False(t, counted)
+}
@@ -0,0 +1,44 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package antimalware submits script content to the antimalware provider of the platform before it runs.
+package antimalware
+
+import (
+	"fmt"
+)
+
+// appName identifies the agent to the antimalware provider.
+const appName = "amazon-ssm-agent"
+
+// BlockedError is returned when the antimalware provider flags the content.
+type BlockedError struct {
+	ContentName string
+	Result      uint32
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("%v was blocked by the antimalware provider (result %v)", e.ContentName, e.Result)
+}
+
+// IsBlocked returns true if the error reports content flagged by the antimalware provider.
+func IsBlocked(err error) bool {
+	_, ok := err.(*BlockedError)
+	return ok
+}
+
+// ScanScript submits the script to the antimalware provider. It returns a BlockedError when
+// the provider flags the content, and other errors when the content could not be scanned.
+func ScanScript(contentName string, content string) error {
+	return scanScript(contentName, content)
+}
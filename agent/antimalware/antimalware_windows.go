@@ -0,0 +1,92 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build windows
+
+// Package antimalware submits script content to the antimalware provider of the platform before it runs.
+package antimalware
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// amsiResultBlockedByAdminStart is the first AMSI_RESULT value meaning the content must not run,
+// results from 0x4000 to 0x4fff are blocked by the administrator and 0x8000 and above are detections.
+// https://msdn.microsoft.com/en-us/library/windows/desktop/dn889584(v=vs.85).aspx
+const amsiResultBlockedByAdminStart = 0x4000
+
+var (
+	amsiDll              = windows.NewLazyDLL(filepath.Join(os.Getenv("SystemRoot"), "System32", "amsi.dll"))
+	procAmsiInitialize   = amsiDll.NewProc("AmsiInitialize")
+	procAmsiUninitialize = amsiDll.NewProc("AmsiUninitialize")
+	procAmsiOpenSession  = amsiDll.NewProc("AmsiOpenSession")
+	procAmsiCloseSession = amsiDll.NewProc("AmsiCloseSession")
+	procAmsiScanBuffer   = amsiDll.NewProc("AmsiScanBuffer")
+)
+
+// scanScript submits the script to AMSI, the interface Windows Defender and other providers register with.
+// AMSI is available from Windows 10 and Windows Server 2016.
+func scanScript(contentName string, content string) (err error) {
+	if err = amsiDll.Load(); err != nil {
+		return fmt.Errorf("AMSI is not available: %v", err)
+	}
+
+	app, err := syscall.UTF16PtrFromString(appName)
+	if err != nil {
+		return
+	}
+	name, err := syscall.UTF16PtrFromString(contentName)
+	if err != nil {
+		return
+	}
+
+	var amsiContext uintptr
+	if hr, _, _ := procAmsiInitialize.Call(uintptr(unsafe.Pointer(app)), uintptr(unsafe.Pointer(&amsiContext))); hr != 0 {
+		return fmt.Errorf("AmsiInitialize failed with 0x%x", hr)
+	}
+	defer procAmsiUninitialize.Call(amsiContext)
+
+	var session uintptr
+	if hr, _, _ := procAmsiOpenSession.Call(amsiContext, uintptr(unsafe.Pointer(&session))); hr != 0 {
+		return fmt.Errorf("AmsiOpenSession failed with 0x%x", hr)
+	}
+	defer procAmsiCloseSession.Call(amsiContext, session)
+
+	// scripts are scanned as utf-16, like PowerShell submits them
+	buffer := utf16.Encode([]rune(content))
+	if len(buffer) == 0 {
+		return nil
+	}
+	var result uint32
+	if hr, _, _ := procAmsiScanBuffer.Call(
+		amsiContext,
+		uintptr(unsafe.Pointer(&buffer[0])),
+		uintptr(len(buffer)*2),
+		uintptr(unsafe.Pointer(name)),
+		session,
+		uintptr(unsafe.Pointer(&result))); hr != 0 {
+		return fmt.Errorf("AmsiScanBuffer failed with 0x%x", hr)
+	}
+
+	if result >= amsiResultBlockedByAdminStart {
+		return &BlockedError{ContentName: contentName, Result: result}
+	}
+	return nil
+}
@@ -108,6 +108,9 @@ func DefaultConfig() SsmagentConfig {
 		CommandWorkersLimit: 5,
 		StopTimeoutMillis:   20000,
 		CommandRetryLimit:   15,
+
+		MessageMaxAgeMinutes:      DefaultMessageMaxAgeMinutes,
+		ClockSkewToleranceMinutes: DefaultClockSkewToleranceMinutes,
 	}
 	var ssm = SsmCfg{
 		HealthFrequencyMinutes: 5,
@@ -115,6 +118,24 @@ func DefaultConfig() SsmagentConfig {
 	var agent = AgentInfo{
 		Name: "amazon-ssm-agent-default",
 	}
+	var dlp = DlpCfg{
+		TimeoutSeconds: DefaultDlpTimeoutSeconds,
+	}
+	var externalPlugins = ExternalPluginsCfg{
+		Directory:                DefaultExternalPluginsDir,
+		ManifestDirectory:        DefaultExternalPluginManifestsDir,
+		CancelGracePeriodSeconds: DefaultExternalPluginCancelGracePeriodSeconds,
+	}
+	var metrics = MetricsCfg{
+		Port: DefaultMetricsPort,
+	}
+	var logRotation = LogRotationCfg{
+		Enabled:         true,
+		MaxFileSizeMB:   DefaultLogRotationMaxFileSizeMB,
+		MaxFileAgeHours: DefaultLogRotationMaxFileAgeHours,
+		Compress:        true,
+		MaxTotalSizeMB:  DefaultLogRotationMaxTotalSizeMB,
+	}
 	var os = OsInfo{
 		Lang:    "en-US",
 		Version: "1",
@@ -127,6 +148,11 @@ func DefaultConfig() SsmagentConfig {
 		Agent:   agent,
 		Os:      os,
 		S3:      s3,
+		Dlp:     dlp,
+		Metrics: metrics,
+
+		ExternalPlugins: externalPlugins,
+		LogRotation:     logRotation,
 	}
 
 	return ssmagentCfg
@@ -45,6 +45,16 @@ func parser(config *SsmagentConfig) {
 		DefaultStopTimeoutMillisMax,
 		DefaultStopTimeoutMillis)
 	config.Mds.Endpoint = getStringValue(config.Mds.Endpoint, "")
+	config.Mds.MessageMaxAgeMinutes = getNumericValue(
+		config.Mds.MessageMaxAgeMinutes,
+		DefaultMessageMaxAgeMinutesMin,
+		DefaultMessageMaxAgeMinutesMax,
+		DefaultMessageMaxAgeMinutes)
+	config.Mds.ClockSkewToleranceMinutes = getNumericValue(
+		config.Mds.ClockSkewToleranceMinutes,
+		DefaultClockSkewToleranceMinutesMin,
+		DefaultClockSkewToleranceMinutesMax,
+		DefaultClockSkewToleranceMinutes)
 
 	// SSM config
 	config.Ssm.Endpoint = getStringValue(config.Ssm.Endpoint, "")
@@ -53,6 +63,67 @@ func parser(config *SsmagentConfig) {
 		DefaultSsmHealthFrequencyMinutesMin,
 		DefaultSsmHealthFrequencyMinutesMax,
 		DefaultSsmHealthFrequencyMinutes)
+
+	// DLP config
+	config.Dlp.ScannerPath = getStringValue(config.Dlp.ScannerPath, "")
+	config.Dlp.TimeoutSeconds = getNumericValue(
+		config.Dlp.TimeoutSeconds,
+		DefaultDlpTimeoutSecondsMin,
+		DefaultDlpTimeoutSecondsMax,
+		DefaultDlpTimeoutSeconds)
+
+	// External plugins config
+	config.ExternalPlugins.Directory = getStringValue(config.ExternalPlugins.Directory, DefaultExternalPluginsDir)
+	config.ExternalPlugins.ManifestDirectory = getStringValue(config.ExternalPlugins.ManifestDirectory, DefaultExternalPluginManifestsDir)
+	config.ExternalPlugins.CancelGracePeriodSeconds = getNumericValue(
+		config.ExternalPlugins.CancelGracePeriodSeconds,
+		DefaultExternalPluginCancelGracePeriodSecondsMin,
+		DefaultExternalPluginCancelGracePeriodSecondsMax,
+		DefaultExternalPluginCancelGracePeriodSeconds)
+
+	// Concurrency config, a limit below one is no limit
+	for pluginName, limit := range config.Concurrency.Plugins {
+		if limit < 1 {
+			delete(config.Concurrency.Plugins, pluginName)
+		}
+	}
+
+	// Metrics config
+	config.Metrics.Port = getNumericValue(
+		config.Metrics.Port,
+		DefaultMetricsPortMin,
+		DefaultMetricsPortMax,
+		DefaultMetricsPort)
+
+	// Log rotation config
+	config.LogRotation.MaxFileSizeMB = getNumericValue(
+		config.LogRotation.MaxFileSizeMB,
+		DefaultLogRotationMaxFileSizeMBMin,
+		DefaultLogRotationMaxFileSizeMBMax,
+		DefaultLogRotationMaxFileSizeMB)
+	config.LogRotation.MaxFileAgeHours = getNumericValue(
+		config.LogRotation.MaxFileAgeHours,
+		DefaultLogRotationMaxFileAgeHoursMin,
+		DefaultLogRotationMaxFileAgeHoursMax,
+		DefaultLogRotationMaxFileAgeHours)
+	config.LogRotation.MaxTotalSizeMB = getNumericValue(
+		config.LogRotation.MaxTotalSizeMB,
+		DefaultLogRotationMaxTotalSizeMBMin,
+		DefaultLogRotationMaxTotalSizeMBMax,
+		DefaultLogRotationMaxTotalSizeMB)
+
+	// Syslog config
+	config.Syslog.Protocol = getStringValue(config.Syslog.Protocol, DefaultSyslogProtocol)
+	config.Syslog.Facility = getStringValue(config.Syslog.Facility, DefaultSyslogFacility)
+
+	// Updater config
+	for i := range config.Updater.DependentServices {
+		config.Updater.DependentServices[i].HealthCheckTimeoutSeconds = getNumericValue(
+			config.Updater.DependentServices[i].HealthCheckTimeoutSeconds,
+			DefaultDependentServiceHealthCheckTimeoutSecondsMin,
+			DefaultDependentServiceHealthCheckTimeoutSecondsMax,
+			DefaultDependentServiceHealthCheckTimeoutSeconds)
+	}
 }
 
 func getStringValue(configValue string, defaultValue string) string {
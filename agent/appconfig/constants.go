@@ -35,12 +35,58 @@ const (
 	DefaultSsmHealthFrequencyMinutesMin = 5
 	DefaultSsmHealthFrequencyMinutesMax = 60
 
+	// Message replay protection defaults
+	DefaultMessageMaxAgeMinutes         = 10080  // 7 days
+	DefaultMessageMaxAgeMinutesMin      = 0      // disables the check
+	DefaultMessageMaxAgeMinutesMax      = 525600 // 1 year
+	DefaultClockSkewToleranceMinutes    = 5
+	DefaultClockSkewToleranceMinutesMin = 1
+	DefaultClockSkewToleranceMinutesMax = 1440
+
+	// External plugins defaults
+	DefaultExternalPluginCancelGracePeriodSeconds    = 10
+	DefaultExternalPluginCancelGracePeriodSecondsMin = 1
+	DefaultExternalPluginCancelGracePeriodSecondsMax = 600
+
+	// Dependent services defaults
+	DefaultDependentServiceHealthCheckTimeoutSeconds    = 60
+	DefaultDependentServiceHealthCheckTimeoutSecondsMin = 1
+	DefaultDependentServiceHealthCheckTimeoutSecondsMax = 600
+
+	// DLP scanner defaults
+	DefaultDlpTimeoutSeconds    = 30
+	DefaultDlpTimeoutSecondsMin = 1
+	DefaultDlpTimeoutSecondsMax = 600
+
+	// Log rotation defaults
+	DefaultLogRotationMaxFileSizeMB      = 30
+	DefaultLogRotationMaxFileSizeMBMin   = 1
+	DefaultLogRotationMaxFileSizeMBMax   = 1024
+	DefaultLogRotationMaxFileAgeHours    = 24
+	DefaultLogRotationMaxFileAgeHoursMin = 1
+	DefaultLogRotationMaxFileAgeHoursMax = 8760 // 1 year
+	DefaultLogRotationMaxTotalSizeMB     = 200
+	DefaultLogRotationMaxTotalSizeMBMin  = 10
+	DefaultLogRotationMaxTotalSizeMBMax  = 102400
+
+	// Syslog defaults
+	DefaultSyslogProtocol = "udp"
+	DefaultSyslogFacility = "daemon"
+
+	// Metrics endpoint defaults
+	DefaultMetricsPort    = 9487
+	DefaultMetricsPortMin = 1024
+	DefaultMetricsPortMax = 65535
+
 	//aws-ssm-agent bookkeeping constants
 	DefaultLocationOfPending   = "pending"
 	DefaultLocationOfCurrent   = "current"
 	DefaultLocationOfCompleted = "completed"
 	DefaultLocationOfCorrupt   = "corrupt"
 	DefaultLocationOfState     = "state"
+	DefaultLocationOfAudit     = "audit"
+	// DefaultLocationOfDocumentTemp is where the temporary directories of running documents are created
+	DefaultLocationOfDocumentTemp = "temp"
 	// DefaultCommandRootDirName is the root directory for storing command states
 	DefaultCommandRootDirName = "command"
 
@@ -62,6 +108,36 @@ const (
 	// PluginNameAwsAgentUpdate is the name for agent update plugin
 	PluginNameAwsAgentUpdate = "aws:updateSsmAgent"
 
+	// PluginNameAwsRunAnsiblePlaybook is the name of the ansible playbook plugin
+	PluginNameAwsRunAnsiblePlaybook = "aws:runAnsiblePlaybook"
+
+	// PluginNameAwsRunSaltState is the name of the salt state plugin
+	PluginNameAwsRunSaltState = "aws:runSaltState"
+
+	// PluginNameAwsRunChefRecipe is the name of the chef plugin
+	PluginNameAwsRunChefRecipe = "aws:runChefRecipe"
+
+	// PluginNameAwsCopyFile is the name of the file distribution plugin
+	PluginNameAwsCopyFile = "aws:copyFile"
+
+	// PluginNameAwsRunDockerCompose is the name of the docker compose plugin
+	PluginNameAwsRunDockerCompose = "aws:runDockerCompose"
+
+	// PluginNameAwsLoop is the name of the loop action, which repeats a set of steps
+	PluginNameAwsLoop = "aws:loop"
+
+	// PluginNameAwsSleepUntil is the name of the action waiting until a time of the day or for a delay
+	PluginNameAwsSleepUntil = "aws:sleepUntil"
+
+	// PluginNameAwsRunDocument is the name of the action running the steps of another document
+	PluginNameAwsRunDocument = "aws:runDocument"
+
+	// PluginNameAwsCaptureDebugLogs is the name of the plugin capturing the debug logs of the agent for a while
+	PluginNameAwsCaptureDebugLogs = "aws:captureDebugLogs"
+
+	// DefaultAuditJournalFileName is the name of the local command audit journal
+	DefaultAuditJournalFileName = "command_journal.jsonl"
+
 	AppConfigFileName    = "amazon-ssm-agent.json"
 	SeelogConfigFileName = "seelog.xml"
 )
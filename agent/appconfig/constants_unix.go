@@ -29,6 +29,12 @@ const (
 	// DefaultDataStorePath represents the directory for storing system data
 	DefaultDataStorePath = "/var/lib/amazon/ssm/"
 
+	// DefaultExternalPluginsDir holds the plugins shipped as separate executables
+	DefaultExternalPluginsDir = "/usr/lib/amazon/ssm/plugins/"
+
+	// DefaultExternalPluginManifestsDir holds the manifests of plugins installed elsewhere
+	DefaultExternalPluginManifestsDir = "/etc/amazon/ssm/plugins.d/"
+
 	// UpdaterArtifactsRoot represents the directory for storing update related information
 	UpdaterArtifactsRoot = "/var/lib/amazon/ssm/update/"
 
@@ -37,6 +43,9 @@ const (
 	// PluginNameAwsRunScript is the name for run script plugin
 	PluginNameAwsRunScript = "aws:runShellScript"
 
+	// PluginNameAwsRunPowerShellScript is the name of the plugin running PowerShell scripts with PowerShell Core
+	PluginNameAwsRunPowerShellScript = "aws:runPowerShellScript"
+
 	// RebootExitCode that would trigger a Soft Reboot
 	RebootExitCode = 194
 )
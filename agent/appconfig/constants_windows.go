@@ -56,6 +56,12 @@ var DownloadRoot string
 // UpdaterArtifactsRoot represents the directory for storing update related information
 var UpdaterArtifactsRoot string
 
+// DefaultExternalPluginsDir holds the plugins shipped as separate executables
+var DefaultExternalPluginsDir string
+
+// DefaultExternalPluginManifestsDir holds the manifests of plugins installed elsewhere
+var DefaultExternalPluginManifestsDir string
+
 // SSMData specifies the directory we used to store SSM data.
 var SSMDataPath string
 
@@ -88,4 +94,6 @@ func init() {
 	DefaultDataStorePath = filepath.Join(SSMDataPath, "InstanceData")
 	DownloadRoot = filepath.Join(temp, SSMFolder, "Download")
 	UpdaterArtifactsRoot = filepath.Join(temp, SSMFolder, "Update")
+	DefaultExternalPluginsDir = filepath.Join(DefaultProgramFolder, "Plugins")
+	DefaultExternalPluginManifestsDir = filepath.Join(DefaultProgramFolder, "plugins.d")
 }
@@ -28,6 +28,15 @@ type MdsCfg struct {
 	CommandWorkersLimit int
 	StopTimeoutMillis   int64
 	CommandRetryLimit   int
+	// DryRun forces every command received by the agent to run in dry-run mode
+	DryRun bool
+	// MessageMaxAgeMinutes is the age after which a received command is rejected as expired, 0 disables the check
+	MessageMaxAgeMinutes int
+	// ClockSkewToleranceMinutes is added to the maximum age to tolerate clock differences with the service
+	ClockSkewToleranceMinutes int
+	// DocumentPriorities maps document names to a priority class (critical, normal or background),
+	// used when the command does not carry a priority hint
+	DocumentPriorities map[string]string
 }
 
 // SsmCfg represents configuration for Simple system manager (SSM)
@@ -46,6 +55,12 @@ type AgentInfo struct {
 	Region               string
 	OrchestrationRootDir string
 	DownloadRootDir      string
+	// UserAgentSuffix is appended to the user agent of the AWS API calls, to attribute them in CloudTrail
+	UserAgentSuffix string
+	// RequestTags are attached to the requests of the APIs which accept caller defined key-values
+	RequestTags map[string]string
+	// LogFormat is text by default, json writes the agent logs as JSON lines whatever the formats of seelog.xml
+	LogFormat string
 }
 
 // OsInfo represents os related information
@@ -62,12 +77,211 @@ type S3Cfg struct {
 	LogKey    string
 }
 
+// AuditCfg represents configuration for the local command audit journal
+type AuditCfg struct {
+	JournalEnabled bool
+	JournalPath    string
+}
+
+// DlpCfg represents configuration for the local DLP scanner which inspects replies and uploaded outputs
+type DlpCfg struct {
+	// ScannerPath is the scanner executable, scanning is disabled when empty
+	ScannerPath    string
+	TimeoutSeconds int
+	// FailOpen lets the data leave the host when the scanner fails or times out
+	FailOpen bool
+}
+
+// AntimalwareCfg represents configuration for scanning scripts with the antimalware provider before they run
+type AntimalwareCfg struct {
+	// ScanScripts submits the scripts to AMSI on Windows, it has no effect on other platforms
+	ScanScripts bool
+}
+
+// ResourceLimitsCfg bounds the resources of the processes started by a plugin, zero values mean no limit
+type ResourceLimitsCfg struct {
+	// CPUShares is the relative cpu weight of the processes, 1024 is the weight of the other processes
+	CPUShares     int
+	MemoryLimitMB int
+	MaxProcesses  int
+	// Niceness is the scheduling priority of the processes, from -20 (highest) to 19 (lowest)
+	Niceness int
+}
+
+// SandboxCfg represents configuration for the cgroups (Linux) and job objects (Windows) enclosing the processes of the plugins
+type SandboxCfg struct {
+	// Plugins maps plugin names to the limits of their processes, documents can override them
+	Plugins map[string]ResourceLimitsCfg
+	// SystemdScopes launches the processes of the plugins as transient systemd scopes on the hosts booted with systemd,
+	// systemd then enforces the limits and stops all the processes of a step when it times out or is canceled
+	SystemdScopes bool
+}
+
+// RunAsCfg restricts the users and groups the commands run as, whatever the documents request.
+// The commands without a user run as the user of the agent, which the lists must then allow.
+type RunAsCfg struct {
+	// AllowedUsers lists the only users the commands can run as, any user is allowed when empty
+	AllowedUsers []string
+	// DeniedUsers lists the users the commands never run as, e.g. root, it takes precedence over AllowedUsers
+	DeniedUsers []string
+	// AllowedGroups lists the only groups the commands can run as, any group is allowed when empty
+	AllowedGroups []string
+	// DeniedGroups lists the groups the commands never run as, e.g. wheel, it takes precedence over AllowedGroups
+	DeniedGroups []string
+}
+
+// OutputLimitsCfg bounds the standard output and error of the steps of a plugin returned in the replies,
+// zero values keep the defaults of the agent
+type OutputLimitsCfg struct {
+	MaxStdoutLength int
+	MaxStderrLength int
+	// SpillToFile references the local file holding the full output of the steps exceeding the limits in the reply,
+	// only aws:runShellScript and aws:runPowerShellScript honour it
+	SpillToFile bool
+}
+
+// OutputCfg represents configuration for the output the plugins capture
+type OutputCfg struct {
+	// Plugins maps plugin names to the limits of their output, only the steps of aws:runShellScript and
+	// aws:runPowerShellScript can override them with the MaxStdoutLength, MaxStderrLength and SpillFullOutput inputs
+	Plugins map[string]OutputLimitsCfg
+	// StreamRedactionPatterns are regular expressions of the secrets masked in the output streamed to CloudWatch Logs,
+	// only the first group of a pattern is masked when it has groups, e.g. (?i)password=(\S+)
+	StreamRedactionPatterns []string
+}
+
+// ConcurrencyCfg bounds the number of steps of a plugin running at the same time, across all the documents
+type ConcurrencyCfg struct {
+	// Plugins maps plugin names to their maximum number of concurrent steps, the other steps wait for a slot
+	Plugins map[string]int
+}
+
+// LogRotationCfg represents the built-in rotation of the log files of the agent, which replaces the rolling files
+// of seelog.xml when it is enabled
+type LogRotationCfg struct {
+	Enabled bool
+	// MaxFileSizeMB and MaxFileAgeHours trigger the rotation of a log file, whichever is reached first
+	MaxFileSizeMB   int
+	MaxFileAgeHours int
+	// Compress gzips the rotated files
+	Compress bool
+	// MaxTotalSizeMB caps the size of the log directory, the oldest rotated files are deleted beyond it
+	MaxTotalSizeMB int
+}
+
+// SyslogCfg represents the syslog endpoint the agent logs are forwarded to, in the RFC 5424 format
+type SyslogCfg struct {
+	// Address is the host:port of the endpoint, the logs are not forwarded when it is empty
+	Address string
+	// Protocol is udp, tcp or tls
+	Protocol string
+	// Facility is the syslog facility of the messages, e.g. daemon or local0
+	Facility string
+	// CAFile is a PEM file of the certificates trusted for tls, the certificates of the system are trusted by default
+	CAFile string
+}
+
+// MetricsCfg represents the endpoint serving the metrics of the agent in the Prometheus text format
+type MetricsCfg struct {
+	Enabled bool
+	// Port is the port of the endpoint, which only listens on the loopback interface
+	Port int
+}
+
+// StorageCfg represents the roots of the directories of the agent, which can be on separate volumes.
+// Empty roots keep the default directory tree.
+type StorageCfg struct {
+	// DataRoot holds the state of the commands, the audit journal and the temporary directories of the documents
+	DataRoot string
+	// OrchestrationRoot holds the scripts and the outputs of the steps of the commands
+	OrchestrationRoot string
+	// DownloadRoot holds the downloaded files and updates
+	DownloadRoot string
+	// LogRoot holds the agent logs, unless the seelog configuration file names other files
+	LogRoot string
+	// MinFreeSpaceMB is the space the configured roots need at startup, not checked when zero
+	MinFreeSpaceMB int
+}
+
+// CredentialsCfg represents the sources of the aws credentials of the agent.
+type CredentialsCfg struct {
+	// SourcePrecedence lists the sources in the order they are tried: managed, profile, environment,
+	// webIdentity, container and instanceMetadata. Sources left out are never used.
+	// When empty, the sources are only selected in containers that provide ECS or EKS credentials.
+	SourcePrecedence []string
+	// MetadataEndpoint overrides the endpoint of the instance metadata credentials, e.g. an emulator
+	MetadataEndpoint string
+}
+
+// ExternalPluginsCfg represents configuration for the plugins shipped as separate executables.
+type ExternalPluginsCfg struct {
+	// Directory holds a subdirectory with the manifest and the executable of each plugin
+	Directory string
+	// ManifestDirectory holds the manifests dropped in by the packages of plugins, e.g. acme.json,
+	// each referencing an executable installed elsewhere
+	ManifestDirectory string
+	// CancelGracePeriodSeconds is how long a canceled plugin has to return its result before it is killed
+	CancelGracePeriodSeconds int
+}
+
+// ProxyCfg represents the proxy of the outbound connections of the agent.
+type ProxyCfg struct {
+	// Url of the proxy, e.g. http://proxy.example.com:3128. HTTPS_PROXY or HTTP_PROXY is used when empty
+	Url string
+	// NoProxy lists the hosts, and the domains with a leading dot, reached directly. NO_PROXY is used when empty
+	NoProxy string
+	// AuthType is basic, ntlm or negotiate, no authentication is sent when empty.
+	// ntlm and negotiate are only supported on Windows, with the identity of the agent when Username is empty
+	AuthType string
+	// Username is user, DOMAIN\user or user@domain
+	Username string
+	// Password of the username, PasswordParameter keeps it out of this file
+	Password string
+	// PasswordParameter names the SecureString parameter of the password. It is read at startup without
+	// proxy authentication, so Systems Manager must be reachable directly, e.g. through a VPC endpoint
+	PasswordParameter string
+}
+
+// UpdaterCfg represents configuration for the updater of the agent.
+type UpdaterCfg struct {
+	// DependentServices are restarted in this order once the updated agent is running, so that they
+	// reconnect to it instead of staying attached to the sockets of the previous agent
+	DependentServices []DependentServiceCfg
+	// MinimumVersion and MaximumVersion bound the versions aws:updateSsmAgent installs, e.g. to pin the fleet to
+	// a validated release. Without a target version, the latest version within the range is installed
+	MinimumVersion string
+	MaximumVersion string
+}
+
+// DependentServiceCfg is a service of the instance depending on the agent, e.g. amazon-cloudwatch-agent.
+type DependentServiceCfg struct {
+	// Name of the service
+	Name string
+	// HealthCheckTimeoutSeconds is how long the service has to be running again after its restart
+	HealthCheckTimeoutSeconds int
+}
+
 // SsmagentConfig stores agent configuration values.
 type SsmagentConfig struct {
-	Profile CredentialProfile
-	Mds     MdsCfg
-	Ssm     SsmCfg
-	Agent   AgentInfo
-	Os      OsInfo
-	S3      S3Cfg
+	Profile         CredentialProfile
+	Mds             MdsCfg
+	Ssm             SsmCfg
+	Agent           AgentInfo
+	Os              OsInfo
+	S3              S3Cfg
+	Audit           AuditCfg
+	Dlp             DlpCfg
+	Antimalware     AntimalwareCfg
+	Sandbox         SandboxCfg
+	RunAs           RunAsCfg
+	Output          OutputCfg
+	Concurrency     ConcurrencyCfg
+	Metrics         MetricsCfg
+	LogRotation     LogRotationCfg
+	Syslog          SyslogCfg
+	Storage         StorageCfg
+	Credentials     CredentialsCfg
+	ExternalPlugins ExternalPluginsCfg
+	Proxy           ProxyCfg
+	Updater         UpdaterCfg
 }
@@ -0,0 +1,121 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package appconfig manages the configuration of the agent.
+// storage contains the roots of the directories of the agent, which can be configured on separate volumes.
+package appconfig
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// storageConfig returns the configured roots of the directories of the agent.
+var storageConfig = func() (storage StorageCfg, orchestrationRootDir string, downloadRootDir string) {
+	config, _ := Config(false)
+	return config.Storage, config.Agent.OrchestrationRootDir, config.Agent.DownloadRootDir
+}
+
+// DataStorePath returns the root of the state of the commands, the audit journal and the temporary directories
+// of the documents. The registration and the vault of the instance stay under DefaultDataStorePath.
+func DataStorePath() string {
+	storage, _, _ := storageConfig()
+	if storage.DataRoot != "" {
+		return storage.DataRoot
+	}
+	return DefaultDataStorePath
+}
+
+// OrchestrationRootPath returns the directory of the scripts and outputs of the commands of the instance.
+// By default it is the orchestration directory of the commands in the data store.
+func OrchestrationRootPath(instanceID string) string {
+	storage, orchestrationRootDir, _ := storageConfig()
+	if storage.OrchestrationRoot != "" {
+		return filepath.Join(storage.OrchestrationRoot, instanceID)
+	}
+	return filepath.Join(DataStorePath(), instanceID, DefaultCommandRootDirName, orchestrationRootDir)
+}
+
+// DownloadRootPath returns the directory the files are downloaded to.
+func DownloadRootPath() string {
+	storage, _, downloadRootDir := storageConfig()
+	if storage.DownloadRoot != "" {
+		return storage.DownloadRoot
+	}
+	if downloadRootDir != "" {
+		return downloadRootDir
+	}
+	return DownloadRoot
+}
+
+// LogRootPath returns the directory of the agent logs, defaultLogDir when no root is configured.
+func LogRootPath(defaultLogDir string) string {
+	storage, _, _ := storageConfig()
+	if storage.LogRoot != "" {
+		return storage.LogRoot
+	}
+	return defaultLogDir
+}
+
+// ValidateStorage checks that the configured roots are absolute, can be created and written to by the agent,
+// and have the configured free space, so that the agent does not start with a volume it cannot use.
+func ValidateStorage(storage StorageCfg) error {
+	roots := []struct {
+		name string
+		path string
+	}{
+		{"DataRoot", storage.DataRoot},
+		{"OrchestrationRoot", storage.OrchestrationRoot},
+		{"DownloadRoot", storage.DownloadRoot},
+		{"LogRoot", storage.LogRoot},
+	}
+	for _, root := range roots {
+		if root.path == "" {
+			continue
+		}
+		if err := validateRoot(root.path, storage.MinFreeSpaceMB); err != nil {
+			return fmt.Errorf("invalid storage %v %v: %v", root.name, root.path, err)
+		}
+	}
+	return nil
+}
+
+// validateRoot creates the root if needed, then checks that it is writable and has the minimum free space.
+func validateRoot(root string, minFreeSpaceMB int) error {
+	if !filepath.IsAbs(root) {
+		return fmt.Errorf("the path must be absolute")
+	}
+	if err := os.MkdirAll(root, ReadWriteExecuteAccess); err != nil {
+		return err
+	}
+	probe, err := ioutil.TempFile(root, ".storage-check")
+	if err != nil {
+		return fmt.Errorf("the directory is not writable: %v", err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	if minFreeSpaceMB <= 0 {
+		return nil
+	}
+	free, err := freeSpace(root)
+	if err != nil {
+		return fmt.Errorf("failed to read the free space: %v", err)
+	}
+	if free < uint64(minFreeSpaceMB)*1024*1024 {
+		return fmt.Errorf("%vMB free, %vMB required", free/(1024*1024), minFreeSpaceMB)
+	}
+	return nil
+}
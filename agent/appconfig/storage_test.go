@@ -0,0 +1,75 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package appconfig
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubStorage configures the given roots and returns the function restoring the configuration.
+func stubStorage(storage StorageCfg, orchestrationRootDir string, downloadRootDir string) func() {
+	original := storageConfig
+	storageConfig = func() (StorageCfg, string, string) { return storage, orchestrationRootDir, downloadRootDir }
+	return func() { storageConfig = original }
+}
+
+func TestDefaultStoragePaths(t *testing.T) {
+	defer stubStorage(StorageCfg{}, "orchestration", "")()
+
+	assert.Equal(t, DefaultDataStorePath, DataStorePath())
+	assert.Equal(t, filepath.Join(DefaultDataStorePath, "i-123", DefaultCommandRootDirName, "orchestration"), OrchestrationRootPath("i-123"))
+	assert.Equal(t, DownloadRoot, DownloadRootPath())
+	assert.Equal(t, "logs", LogRootPath("logs"))
+}
+
+func TestConfiguredStoragePaths(t *testing.T) {
+	storage := StorageCfg{
+		DataRoot:          "/data/ssm",
+		OrchestrationRoot: "/output/ssm",
+		DownloadRoot:      "/downloads/ssm",
+		LogRoot:           "/logs/ssm",
+	}
+	defer stubStorage(storage, "orchestration", "/legacy/downloads")()
+
+	assert.Equal(t, "/data/ssm", DataStorePath())
+	assert.Equal(t, filepath.Join("/output/ssm", "i-123"), OrchestrationRootPath("i-123"))
+	assert.Equal(t, "/downloads/ssm", DownloadRootPath())
+	assert.Equal(t, "/logs/ssm", LogRootPath("logs"))
+
+	defer stubStorage(StorageCfg{}, "orchestration", "/legacy/downloads")()
+	assert.Equal(t, "/legacy/downloads", DownloadRootPath())
+}
+
+func TestValidateStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, ValidateStorage(StorageCfg{}))
+	assert.Nil(t, ValidateStorage(StorageCfg{DataRoot: filepath.Join(dir, "data"), LogRoot: filepath.Join(dir, "logs"), MinFreeSpaceMB: 1}))
+	assert.True(t, fileExists(filepath.Join(dir, "data")))
+	assert.NotNil(t, ValidateStorage(StorageCfg{DataRoot: "relative/data"}))
+	assert.NotNil(t, ValidateStorage(StorageCfg{DownloadRoot: dir, MinFreeSpaceMB: math.MaxInt32}))
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,229 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package audit implements a local, append-only journal of the commands received by the agent.
+// Every entry is a single json line which carries the hash of the previous entry, so that
+// removing or editing a line breaks the chain and can be detected with Verify.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+)
+
+// EventType identifies the kind of a journal entry.
+type EventType string
+
+const (
+	// EventCommandReceived is recorded when a command has been parsed and is about to run.
+	EventCommandReceived EventType = "CommandReceived"
+
+	// EventCommandCompleted is recorded when a command reached its final status.
+	EventCommandCompleted EventType = "CommandCompleted"
+
+	// EventCancelReceived is recorded when a cancel request was processed.
+	EventCancelReceived EventType = "CancelReceived"
+
+	// RedactedValue replaces the value of parameters that look like secrets.
+	RedactedValue = "***"
+
+	// genesisHash is the previous hash of the first entry of a journal.
+	genesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+)
+
+// secretParameterRegex matches parameter names whose values must never be written to the journal.
+var secretParameterRegex = regexp.MustCompile(`(?i)(password|passwd|secret|token|credential|private[_-]?key|api[_-]?key|access[_-]?key)`)
+
+// Entry is a single line of the audit journal.
+type Entry struct {
+	Sequence      int64                  `json:"sequence"`
+	Time          string                 `json:"time"`
+	Event         EventType              `json:"event"`
+	Source        string                 `json:"source,omitempty"`
+	MessageID     string                 `json:"messageId"`
+	CommandID     string                 `json:"commandId"`
+	DocumentName  string                 `json:"documentName,omitempty"`
+	Parameters    map[string]interface{} `json:"parameters,omitempty"`
+	StartDateTime string                 `json:"startDateTime,omitempty"`
+	EndDateTime   string                 `json:"endDateTime,omitempty"`
+	Status        contracts.ResultStatus `json:"status,omitempty"`
+	ErrorCodes    []string               `json:"errorCodes,omitempty"`
+	PreviousHash  string                 `json:"previousHash"`
+	Hash          string                 `json:"hash"`
+}
+
+// Journal appends hash chained entries to a file.
+type Journal struct {
+	path     string
+	mutex    sync.Mutex
+	loaded   bool
+	lastHash string
+	sequence int64
+}
+
+// NewJournal returns a journal that appends to the given file.
+// The file and its parent directories are created on the first append.
+func NewJournal(path string) *Journal {
+	return &Journal{path: path}
+}
+
+// Path returns the location of the journal file.
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Append stamps the entry with its sequence number and hashes, then appends it to the journal.
+func (j *Journal) Append(entry Entry) (err error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if !j.loaded {
+		if j.lastHash, j.sequence, err = readTail(j.path); err != nil {
+			return
+		}
+		j.loaded = true
+	}
+
+	entry.Sequence = j.sequence + 1
+	entry.PreviousHash = j.lastHash
+	if entry.Hash, err = computeHash(entry); err != nil {
+		return
+	}
+
+	var line []byte
+	if line, err = json.Marshal(entry); err != nil {
+		return
+	}
+
+	if err = fileutil.MakeDirs(filepath.Dir(j.path)); err != nil {
+		return
+	}
+
+	var file *os.File
+	if file, err = os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, appconfig.ReadWriteAccess); err != nil {
+		return
+	}
+	defer file.Close()
+
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		return
+	}
+
+	j.lastHash = entry.Hash
+	j.sequence = entry.Sequence
+	return
+}
+
+// Verify walks the journal and checks that every entry is correctly hashed and chained to its predecessor.
+// It returns the number of valid entries read before the first inconsistency.
+func Verify(path string) (count int, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	previousHash := genesisHash
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return count, fmt.Errorf("entry %v is not valid json: %v", count+1, err)
+		}
+		if entry.PreviousHash != previousHash {
+			return count, fmt.Errorf("entry %v does not chain to the previous entry", entry.Sequence)
+		}
+		var hash string
+		if hash, err = computeHash(entry); err != nil {
+			return
+		}
+		if hash != entry.Hash {
+			return count, fmt.Errorf("entry %v has been modified", entry.Sequence)
+		}
+		previousHash = entry.Hash
+		count++
+	}
+	err = scanner.Err()
+	return
+}
+
+// RedactParameters returns a copy of the parameters where values of secret looking parameters are replaced.
+func RedactParameters(parameters map[string]interface{}) map[string]interface{} {
+	if len(parameters) == 0 {
+		return nil
+	}
+	redacted := make(map[string]interface{}, len(parameters))
+	for name, value := range parameters {
+		if IsSecretName(name) {
+			redacted[name] = RedactedValue
+		} else {
+			redacted[name] = value
+		}
+	}
+	return redacted
+}
+
+// IsSecretName returns true if the values of the parameter or variable with the given name must not be recorded.
+func IsSecretName(name string) bool {
+	return secretParameterRegex.MatchString(name)
+}
+
+// computeHash returns the hex encoded sha256 of the entry with an empty Hash field.
+func computeHash(entry Entry) (string, error) {
+	entry.Hash = ""
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// readTail returns the hash and sequence number of the last entry of the journal.
+func readTail(path string) (lastHash string, sequence int64, err error) {
+	lastHash = genesisHash
+	if !fileutil.Exists(path) {
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return lastHash, sequence, fmt.Errorf("audit journal %v is corrupt: %v", path, err)
+		}
+		lastHash = entry.Hash
+		sequence = entry.Sequence
+	}
+	err = scanner.Err()
+	return
+}
@@ -0,0 +1,106 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournalAppendAndVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "journal", "commands.jsonl")
+	journal := NewJournal(path)
+	assert.Nil(t, journal.Append(Entry{Event: EventCommandReceived, MessageID: "m1", CommandID: "c1"}))
+	assert.Nil(t, journal.Append(Entry{Event: EventCommandCompleted, MessageID: "m1", CommandID: "c1", Status: contracts.ResultStatusSuccess}))
+
+	// a new journal on the same file continues the chain
+	assert.Nil(t, NewJournal(path).Append(Entry{Event: EventCommandReceived, MessageID: "m2", CommandID: "c2"}))
+
+	count, err := Verify(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "commands.jsonl")
+	journal := NewJournal(path)
+	assert.Nil(t, journal.Append(Entry{Event: EventCommandReceived, MessageID: "m1", CommandID: "c1"}))
+	assert.Nil(t, journal.Append(Entry{Event: EventCommandCompleted, MessageID: "m1", CommandID: "c1", Status: contracts.ResultStatusFailed}))
+
+	content, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	tampered := strings.Replace(string(content), string(contracts.ResultStatusFailed), string(contracts.ResultStatusSuccess), 1)
+	assert.Nil(t, ioutil.WriteFile(path, []byte(tampered), 0600))
+
+	count, err := Verify(path)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestRedactParameters(t *testing.T) {
+	params := map[string]interface{}{
+		"commands":      []interface{}{"ls"},
+		"adminPassword": "hunter2",
+		"ApiToken":      "abc",
+	}
+	redacted := RedactParameters(params)
+
+	assert.Equal(t, params["commands"], redacted["commands"])
+	assert.Equal(t, RedactedValue, redacted["adminPassword"])
+	assert.Equal(t, RedactedValue, redacted["ApiToken"])
+	assert.Equal(t, "hunter2", params["adminPassword"])
+	assert.Nil(t, RedactParameters(nil))
+}
+
+func TestIsSecretName(t *testing.T) {
+	testCases := []struct {
+		name   string
+		secret bool
+	}{
+		{"password", true},
+		{"DB_PASSWD", true},
+		{"clientSecret", true},
+		{"ApiToken", true},
+		{"credentials", true},
+		{"privateKey", true},
+		{"PRIVATE_KEY", true},
+		{"private-key", true},
+		{"apikey", true},
+		{"API_KEY", true},
+		{"api-key", true},
+		{"AWS_ACCESS_KEY_ID", true},
+		{"accessKey", true},
+		{"commands", false},
+		{"workingDirectory", false},
+		{"executionTimeout", false},
+		{"keyName", false},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.secret, IsSecretName(testCase.name), testCase.name)
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package backlog keeps the number of received messages waiting to be processed, which is reported in the agent health.
+package backlog
+
+import (
+	"sync/atomic"
+)
+
+var depth int32
+
+// Add adds n received messages to the backlog, a negative n removes messages which will not be processed.
+func Add(n int) {
+	atomic.AddInt32(&depth, int32(n))
+}
+
+// Done removes a message from the backlog once it is processed: its command completed, or it was rejected.
+func Done() {
+	atomic.AddInt32(&depth, -1)
+}
+
+// Depth returns the number of messages received and not processed yet.
+func Depth() int {
+	return int(atomic.LoadInt32(&depth))
+}
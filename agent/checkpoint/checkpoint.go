@@ -0,0 +1,139 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package checkpoint persists the progress of long running steps, so that a step interrupted by an agent update,
+// a shutdown or the preemption by a critical document resumes where it stopped instead of restarting from scratch.
+// The checkpoint is written in the orchestration directory of the step, which is kept until the command completes.
+package checkpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/task"
+	"github.com/aws/amazon-ssm-agent/agent/times"
+)
+
+// FileName is the name of the checkpoint file, written in the orchestration directory of the step.
+const FileName = "checkpoint.json"
+
+// T saves and restores the progress of a step.
+type T interface {
+	// Load restores the progress saved by a previous run of the step into progress.
+	// Returns false if the step has not saved any progress.
+	Load(progress interface{}) (found bool, err error)
+
+	// Save persists the progress of the step, then lets the executor run more urgent work.
+	// Plugins call it at their safe points, when the step can be resumed from progress.
+	Save(progress interface{}) error
+}
+
+// Checkpoint is the content of the checkpoint file.
+type Checkpoint struct {
+	PluginID  string          `json:"pluginId"`
+	MessageID string          `json:"messageId"`
+	Time      string          `json:"time"`
+	Sequence  int             `json:"sequence"`
+	Progress  json.RawMessage `json:"progress"`
+}
+
+// Store keeps the checkpoint of one step.
+type Store struct {
+	orchestrationDir string
+	pluginID         string
+	messageID        string
+	cancelFlag       task.CancelFlag
+	sequence         int
+}
+
+// NewStore returns the store of the checkpoint of the step with the given orchestration directory.
+func NewStore(orchestrationDir string, pluginID string, messageID string, cancelFlag task.CancelFlag) *Store {
+	return &Store{
+		orchestrationDir: orchestrationDir,
+		pluginID:         pluginID,
+		messageID:        messageID,
+		cancelFlag:       cancelFlag,
+	}
+}
+
+// Load restores the progress saved by a previous run of the step.
+// A checkpoint saved by another step or another command is ignored.
+func (s *Store) Load(progress interface{}) (found bool, err error) {
+	content, err := ioutil.ReadFile(s.path())
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return
+	}
+
+	var checkpoint Checkpoint
+	if err = json.Unmarshal(content, &checkpoint); err != nil {
+		return false, fmt.Errorf("invalid checkpoint %v: %v", s.path(), err)
+	}
+	if checkpoint.PluginID != s.pluginID || checkpoint.MessageID != s.messageID {
+		return false, nil
+	}
+	if err = json.Unmarshal(checkpoint.Progress, progress); err != nil {
+		return false, fmt.Errorf("invalid progress in checkpoint %v: %v", s.path(), err)
+	}
+	s.sequence = checkpoint.Sequence
+	return true, nil
+}
+
+// Save persists the progress of the step, then runs the critical jobs waiting for the worker of the step.
+// The file is replaced atomically, an interruption while saving keeps the previous checkpoint.
+func (s *Store) Save(progress interface{}) (err error) {
+	var content []byte
+	if content, err = json.Marshal(progress); err != nil {
+		return
+	}
+	s.sequence++
+	checkpoint := Checkpoint{
+		PluginID:  s.pluginID,
+		MessageID: s.messageID,
+		Time:      times.ToIso8601UTC(times.DefaultClock.Now()),
+		Sequence:  s.sequence,
+		Progress:  json.RawMessage(content),
+	}
+	if content, err = json.MarshalIndent(checkpoint, "", "  "); err != nil {
+		return
+	}
+	if err = fileutil.MakeDirs(s.orchestrationDir); err != nil {
+		return
+	}
+	if err = fileutil.WriteFileAtomic(s.path(), content, appconfig.ReadWriteAccess); err != nil {
+		return
+	}
+
+	task.SafePoint(s.cancelFlag)
+	return nil
+}
+
+// Clear deletes the checkpoint, once the step has completed.
+func (s *Store) Clear() error {
+	if err := os.Remove(s.path()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// path returns the path of the checkpoint file.
+func (s *Store) path() string {
+	return filepath.Join(s.orchestrationDir, FileName)
+}
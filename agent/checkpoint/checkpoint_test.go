@@ -0,0 +1,65 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package checkpoint
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/task"
+	"github.com/stretchr/testify/assert"
+)
+
+type progress struct {
+	Done []string
+	Next int
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	store := NewStore(dir, "aws:runPatchBaseline", "aws.ssm.c1.i-1", task.NewChanneledCancelFlag())
+	var restored progress
+	found, err := store.Load(&restored)
+	assert.Nil(t, err)
+	assert.False(t, found)
+
+	assert.Nil(t, store.Save(progress{Done: []string{"kernel"}, Next: 1}))
+	assert.Nil(t, store.Save(progress{Done: []string{"kernel", "openssl"}, Next: 2}))
+
+	// a new run of the same step resumes from the last checkpoint
+	resumed := NewStore(dir, "aws:runPatchBaseline", "aws.ssm.c1.i-1", task.NewChanneledCancelFlag())
+	found, err = resumed.Load(&restored)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, progress{Done: []string{"kernel", "openssl"}, Next: 2}, restored)
+	assert.Nil(t, resumed.Save(restored))
+	checkpoint, err := ioutil.ReadFile(resumed.path())
+	assert.Nil(t, err)
+	assert.Contains(t, string(checkpoint), `"sequence": 3`)
+
+	// the checkpoint of another command is ignored
+	found, err = NewStore(dir, "aws:runPatchBaseline", "aws.ssm.c2.i-1", task.NewChanneledCancelFlag()).Load(&restored)
+	assert.Nil(t, err)
+	assert.False(t, found)
+
+	assert.Nil(t, resumed.Clear())
+	assert.Nil(t, resumed.Clear())
+	found, err = resumed.Load(&restored)
+	assert.Nil(t, err)
+	assert.False(t, found)
+}
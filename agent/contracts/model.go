@@ -20,14 +20,19 @@ package contracts
 type ResultStatus string
 
 const (
-	ResultStatusUnknown          ResultStatus = "Unknown"
-	ResultStatusNotStarted       ResultStatus = "NotStarted"
-	ResultStatusInProgress       ResultStatus = "InProgress"
-	ResultStatusSuccess          ResultStatus = "Success"
-	ResultStatusSuccessAndReboot ResultStatus = "SuccessAndReboot"
-	ResultStatusFailed           ResultStatus = "Failed"
-	ResultStatusCancelled        ResultStatus = "Cancelled"
-	ResultStatusTimedOut         ResultStatus = "TimedOut"
+	ResultStatusUnknown              ResultStatus = "Unknown"
+	ResultStatusNotStarted           ResultStatus = "NotStarted"
+	ResultStatusInProgress           ResultStatus = "InProgress"
+	ResultStatusSuccess              ResultStatus = "Success"
+	ResultStatusSuccessAndReboot     ResultStatus = "SuccessAndReboot"
+	ResultStatusFailed               ResultStatus = "Failed"
+	ResultStatusCancelled            ResultStatus = "Cancelled"
+	ResultStatusTimedOut             ResultStatus = "TimedOut"
+	ResultStatusExpired              ResultStatus = "Expired"
+	ResultStatusBlockedByAntimalware ResultStatus = "BlockedByAntimalware"
+	// ResultStatusSkipped is the status of a step which is not on the execution path of the document,
+	// it does not fail the document.
+	ResultStatusSkipped ResultStatus = "Skipped"
 )
 
 type StopType string
@@ -46,16 +51,55 @@ type Parameter struct {
 
 // PluginConfig stores plugin configuration
 type PluginConfig struct {
-	Properties  interface{} `json:"properties"`
-	Description string      `json:"description"`
+	Properties          interface{} `json:"properties"`
+	Description         string      `json:"description"`
+	MaxAttempts         int         `json:"maxAttempts,omitempty"`
+	RetryBackoffSeconds int         `json:"retryBackoffSeconds,omitempty"`
+	OnSuccess           string      `json:"onSuccess,omitempty"`
+	OnFailure           string      `json:"onFailure,omitempty"`
+	// RunAt delays the step until a time of the day (HH:MM in the local time of the instance) or an RFC 3339 time
+	RunAt string `json:"runAt,omitempty"`
+	// DelaySeconds delays the step by the given number of seconds
+	DelaySeconds int `json:"delaySeconds,omitempty"`
+	// CaptureState captures the state of the machine before the step runs, for a rollback document
+	CaptureState *StateCapture `json:"captureState,omitempty"`
+}
+
+// StateCapture selects the state of the machine captured before a step runs.
+// A companion rollback document reads it with amazon-ssm-agent -machinestate <command id> to restore the machine.
+type StateCapture struct {
+	// Packages captures the names and the versions of the installed packages
+	Packages bool `json:"packages,omitempty"`
+	// Services captures the state and the start type of the services
+	Services bool `json:"services,omitempty"`
+	// Files lists the paths, or glob patterns, of the files whose sha256 hash is captured
+	Files []string `json:"files,omitempty"`
 }
 
+const (
+	// StepActionContinue runs the next step in order. It is the default action.
+	StepActionContinue = "continue"
+
+	// StepActionExit stops the document, the remaining steps are skipped.
+	StepActionExit = "exit"
+)
+
 // DocumentContent object which represents ssm document content.
 type DocumentContent struct {
 	SchemaVersion string                   `json:"schemaVersion"`
 	Description   string                   `json:"description"`
 	RuntimeConfig map[string]*PluginConfig `json:"runtimeConfig"`
 	Parameters    map[string]*Parameter    `json:"parameters"`
+	Preconditions map[string]string        `json:"preconditions,omitempty"`
+	// OutputCloudWatchLogs streams the output of the plugins to CloudWatch Logs while they run
+	OutputCloudWatchLogs *CloudWatchLogsOutput `json:"outputCloudWatchLogs,omitempty"`
+}
+
+// CloudWatchLogsOutput is the log group the output of a document is streamed to.
+// The stream prefix supports the {CommandId} and {InstanceId} placeholders.
+type CloudWatchLogsOutput struct {
+	LogGroupName    string `json:"logGroupName"`
+	LogStreamPrefix string `json:"logStreamPrefix,omitempty"`
 }
 
 // AdditionalInfo section in agent response
@@ -84,6 +128,8 @@ type PluginRuntimeStatus struct {
 	EndDateTime        string       `json:"endDateTime"`
 	OutputS3BucketName string       `json:"outputS3BucketName"`
 	OutputS3KeyPrefix  string       `json:"outputS3KeyPrefix"`
+	// ErrorCode is the stable code of the cause of the failure, see package agenterror
+	ErrorCode string `json:"errorCode,omitempty"`
 }
 
 // AgentConfiguration is a struct that stores information about the agent and instance.
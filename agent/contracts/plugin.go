@@ -16,17 +16,21 @@ package contracts
 
 import (
 	"fmt"
+	"strings"
 	"time"
-
-	"github.com/aws/amazon-ssm-agent/agent/context"
 )
 
 const (
 	//MaximumPluginOutputSize represents the maximum output size that agent supports
 	MaximumPluginOutputSize = 2400
 
+	// DryRunOutputPrefix is the first line of the output of a plugin executed in dry-run mode
+	DryRunOutputPrefix = "[dry-run] "
+
 	truncOut   = "\n---Output truncated---"
 	truncError = "\n---Error truncated----"
+
+	artifactsTitle = "\n----------ARTIFACTS-------\n"
 )
 
 var (
@@ -46,27 +50,6 @@ type PluginResult struct {
 	Error              error        `json:"-"`
 }
 
-// IPlugin is interface for authoring a functionality of work.
-// Every functionality of work is implemented as a plugin.
-type IPlugin interface {
-	Name() string
-	Execute(context context.T, input PluginConfig) (output PluginResult, err error)
-	RequestStop(stopType StopType) (err error)
-}
-
-// ICorePlugin is the very much of core itself will be implemented as plugins
-// that are simply hardcoded to run with agent framework.
-// The hardcoded plugins will implement the ICorePlugin
-type ICorePlugin interface {
-	Name() string
-	Execute(context context.T) (err error)
-	RequestStop(stopType StopType) (err error)
-}
-
-// IWorkerPlugin is the plugins which do not form part of core
-// These plugins are invoked on demand.
-type IWorkerPlugin IPlugin
-
 // Configuration represents a plugin configuration as in the json format.
 type Configuration struct {
 	Properties             interface{}
@@ -75,6 +58,18 @@ type Configuration struct {
 	OrchestrationDirectory string
 	MessageId              string
 	BookKeepingFileName    string
+	DryRun                 bool
+	MaxAttempts            int
+	RetryBackoffSeconds    int
+	DocumentTempDirectory  string
+	OnSuccess              string
+	OnFailure              string
+	RunAt                  string
+	DelaySeconds           int
+	CaptureState           *StateCapture
+	// CloudWatchLogGroupName is the log group the output is streamed to, streaming is disabled when empty
+	CloudWatchLogGroupName    string
+	CloudWatchLogStreamPrefix string
 }
 
 // Plugin wraps the plugin configuration and plugin result.
@@ -89,15 +84,25 @@ type PluginInput struct {
 
 // PluginOutput represents the output of the plugin.
 type PluginOutput struct {
-	ExitCode int
-	Status   ResultStatus
-	Stdout   string
-	Stderr   string
-	Errors   []string
+	ExitCode  int
+	Status    ResultStatus
+	Stdout    string
+	Stderr    string
+	Errors    []string
+	Artifacts []string
 }
 
 func (p *PluginOutput) String() (response string) {
-	return TruncateOutput(p.Stdout, p.Stderr, MaximumPluginOutputSize)
+	if len(p.Artifacts) == 0 {
+		return TruncateOutput(p.Stdout, p.Stderr, MaximumPluginOutputSize)
+	}
+
+	// the artifact destinations are listed after the output, and are given at most half of the space
+	artifacts := artifactsTitle + strings.Join(p.Artifacts, "\n")
+	if len(artifacts) > MaximumPluginOutputSize/2 {
+		artifacts = artifacts[:MaximumPluginOutputSize/2-lenTruncOut] + truncOut
+	}
+	return TruncateOutput(p.Stdout, p.Stderr, MaximumPluginOutputSize-len(artifacts)) + artifacts
 }
 
 // TruncateOutput truncates the output
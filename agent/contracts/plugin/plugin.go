@@ -0,0 +1,43 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package plugin contains the interfaces of the plugins of the agent.
+// They are kept out of package contracts, which holds the models of the messages and is used by tools
+// without the runtime of the agent.
+package plugin
+
+import (
+	"github.com/aws/amazon-ssm-agent/agent/context"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+)
+
+// IPlugin is interface for authoring a functionality of work.
+// Every functionality of work is implemented as a plugin.
+type IPlugin interface {
+	Name() string
+	Execute(context context.T, input contracts.PluginConfig) (output contracts.PluginResult, err error)
+	RequestStop(stopType contracts.StopType) (err error)
+}
+
+// ICorePlugin is the very much of core itself will be implemented as plugins
+// that are simply hardcoded to run with agent framework.
+// The hardcoded plugins will implement the ICorePlugin
+type ICorePlugin interface {
+	Name() string
+	Execute(context context.T) (err error)
+	RequestStop(stopType contracts.StopType) (err error)
+}
+
+// IWorkerPlugin is the plugins which do not form part of core
+// These plugins are invoked on demand.
+type IWorkerPlugin IPlugin
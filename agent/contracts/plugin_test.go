@@ -58,3 +58,14 @@ func TestTruncateOutput(t *testing.T) {
 		assert.Equal(t, test.expected, actual, "failed test case: %v", i)
 	}
 }
+
+func TestPluginOutputStringListsArtifacts(t *testing.T) {
+	out := PluginOutput{
+		Stdout:    "sample output",
+		Artifacts: []string{"s3://bucket/key/artifacts/a.xml", "s3://bucket/key/artifacts/b.xml"},
+	}
+	assert.Equal(t, "sample output\n----------ARTIFACTS-------\ns3://bucket/key/artifacts/a.xml\ns3://bucket/key/artifacts/b.xml", out.String())
+
+	out.Stdout = longMessage
+	assert.True(t, len(out.String()) <= MaximumPluginOutputSize)
+}
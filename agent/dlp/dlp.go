@@ -0,0 +1,168 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package dlp passes the data leaving the host through a local DLP (data loss prevention) scanner.
+// The scanner is an executable configured by the customer. It receives the kind of data as its only
+// argument and the data on stdin, and exits with 0 when the data can leave the host. Any other exit
+// code blocks the data, the scanner can print the reason on stdout.
+package dlp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+// Kind identifies the data given to the scanner.
+type Kind string
+
+const (
+	// KindReply is a reply payload sent to the service.
+	KindReply Kind = "reply"
+
+	// KindOutput is an output file uploaded to S3.
+	KindOutput Kind = "output"
+
+	// KindStream is a batch of output lines streamed to CloudWatch Logs.
+	KindStream Kind = "stream"
+
+	// maxReasonLength is the maximum length of the reason printed by the scanner which is kept.
+	maxReasonLength = 512
+)
+
+// BlockedError is returned when the scanner does not let the data leave the host.
+type BlockedError struct {
+	Reason string
+}
+
+func (e *BlockedError) Error() string {
+	if e.Reason == "" {
+		return "blocked by the DLP scanner"
+	}
+	return "blocked by the DLP scanner: " + e.Reason
+}
+
+// Scanner runs the configured scanner executable.
+type Scanner struct {
+	path     string
+	timeout  time.Duration
+	failOpen bool
+}
+
+// NewScanner returns the scanner for the given configuration, or nil when scanning is disabled.
+// A nil scanner lets all the data through.
+func NewScanner(config appconfig.DlpCfg) *Scanner {
+	if config.ScannerPath == "" {
+		return nil
+	}
+	return &Scanner{
+		path:     config.ScannerPath,
+		timeout:  time.Duration(config.TimeoutSeconds) * time.Second,
+		failOpen: config.FailOpen,
+	}
+}
+
+// Default returns the scanner of the agent configuration.
+func Default() *Scanner {
+	config, err := appconfig.Config(false)
+	if err != nil {
+		return nil
+	}
+	return NewScanner(config.Dlp)
+}
+
+// ScanBytes scans the given data.
+func (s *Scanner) ScanBytes(log log.T, kind Kind, data []byte) error {
+	if s == nil {
+		return nil
+	}
+	return s.scan(log, kind, bytes.NewReader(data))
+}
+
+// ScanFile scans the content of the given file.
+func (s *Scanner) ScanFile(log log.T, kind Kind, path string) error {
+	if s == nil {
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return s.scan(log, kind, file)
+}
+
+// scan runs the scanner on the content. Scanner failures and timeouts are
+// resolved with the fail open/closed policy.
+func (s *Scanner) scan(log log.T, kind Kind, content io.Reader) error {
+	var stdout bytes.Buffer
+	cmd := exec.Command(s.path, string(kind))
+	cmd.Stdin = content
+	cmd.Stdout = &stdout
+
+	err := run(cmd, s.timeout)
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*exec.ExitError); ok {
+		blocked := &BlockedError{Reason: reason(stdout.String())}
+		log.Warnf("%v %v", kind, blocked)
+		return blocked
+	}
+
+	if s.failOpen {
+		log.Warnf("DLP scanner %v failed, letting %v through: %v", s.path, kind, err)
+		return nil
+	}
+	log.Errorf("DLP scanner %v failed, blocking %v: %v", s.path, kind, err)
+	return fmt.Errorf("DLP scanner failed: %v", err)
+}
+
+// run runs the command and kills it when it does not complete within the timeout.
+func run(cmd *exec.Cmd, timeout time.Duration) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		// children of the scanner may keep its output open, Wait completes in the background
+		cmd.Process.Kill()
+		return fmt.Errorf("timed out after %v", timeout)
+	}
+}
+
+// reason returns the first line printed by the scanner, truncated.
+func reason(output string) string {
+	output = strings.TrimSpace(output)
+	if i := strings.IndexByte(output, '\n'); i >= 0 {
+		output = strings.TrimSpace(output[:i])
+	}
+	if len(output) > maxReasonLength {
+		output = output[:maxReasonLength]
+	}
+	return output
+}
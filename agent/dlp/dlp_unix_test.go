@@ -0,0 +1,81 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build darwin freebsd linux netbsd openbsd
+
+package dlp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// scannerScript blocks the data containing "secret" and hangs on "slow".
+const scannerScript = `#!/bin/sh
+content=$(cat)
+case "$content" in
+  *secret*) echo "found a secret in $1"; exit 1 ;;
+  *slow*) sleep 10 ;;
+esac
+exit 0
+`
+
+func newTestScanner(t *testing.T, dir string, failOpen bool) *Scanner {
+	path := filepath.Join(dir, "scanner.sh")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(scannerScript), 0700))
+	return NewScanner(appconfig.DlpCfg{ScannerPath: path, TimeoutSeconds: 1, FailOpen: failOpen})
+}
+
+func TestScan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dlp")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	logger := log.NewMockLog()
+	scanner := newTestScanner(t, dir, false)
+
+	assert.Nil(t, scanner.ScanBytes(logger, KindReply, []byte("hello")))
+
+	err = scanner.ScanBytes(logger, KindReply, []byte("my secret"))
+	assert.Equal(t, &BlockedError{Reason: "found a secret in reply"}, err)
+
+	outputPath := filepath.Join(dir, "stdout")
+	assert.Nil(t, ioutil.WriteFile(outputPath, []byte("secret"), 0600))
+	err = scanner.ScanFile(logger, KindOutput, outputPath)
+	assert.Equal(t, &BlockedError{Reason: "found a secret in output"}, err)
+}
+
+func TestScanFailurePolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dlp")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	logger := log.NewMockLog()
+
+	// fail closed blocks the data when the scanner times out
+	assert.NotNil(t, newTestScanner(t, dir, false).ScanBytes(logger, KindReply, []byte("slow")))
+
+	// fail open lets the data through when the scanner times out or is missing
+	assert.Nil(t, newTestScanner(t, dir, true).ScanBytes(logger, KindReply, []byte("slow")))
+	missing := NewScanner(appconfig.DlpCfg{ScannerPath: filepath.Join(dir, "missing"), TimeoutSeconds: 1, FailOpen: true})
+	assert.Nil(t, missing.ScanBytes(logger, KindReply, []byte("hello")))
+
+	// without scanner everything goes through
+	var disabled *Scanner
+	assert.Nil(t, disabled.ScanBytes(logger, KindReply, []byte("secret")))
+	assert.Nil(t, NewScanner(appconfig.DlpCfg{}))
+}
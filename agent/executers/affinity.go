@@ -0,0 +1,116 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package executers contains general purpose (shell) command executing objects.
+// affinity contains functions that pin the processes started by a step to a set of cpus or a NUMA node.
+package executers
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ProcessAffinity describes the cpus and NUMA node the processes of a step are allowed to run on.
+// CPUs is a cpu list such as "0-3,6"; NumaNode is the index of a NUMA node. Empty values mean no restriction.
+type ProcessAffinity struct {
+	CPUs     string
+	NumaNode string
+}
+
+// IsEmpty returns true if the affinity does not restrict the process.
+func (a ProcessAffinity) IsEmpty() bool {
+	return strings.TrimSpace(a.CPUs) == "" && strings.TrimSpace(a.NumaNode) == ""
+}
+
+// Validate checks the format of the cpu list and of the NUMA node.
+func (a ProcessAffinity) Validate() (err error) {
+	if strings.TrimSpace(a.CPUs) != "" {
+		if _, err = ParseCPUList(a.CPUs); err != nil {
+			return
+		}
+	}
+	if strings.TrimSpace(a.NumaNode) != "" {
+		if _, err = parseNumaNode(a.NumaNode); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// setAffinity makes the command start with the given affinity. The command is unchanged when the affinity is empty.
+func setAffinity(command *exec.Cmd, affinity ProcessAffinity) error {
+	if affinity.IsEmpty() {
+		return nil
+	}
+	if err := affinity.Validate(); err != nil {
+		return err
+	}
+	return withAffinity(command, affinity)
+}
+
+// ParseCPUList parses a cpu list such as "0-3,6" and returns the sorted, unique cpu indexes.
+func ParseCPUList(list string) (cpus []int, err error) {
+	seen := make(map[int]bool)
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		bounds := strings.SplitN(item, "-", 2)
+		var first, last int
+		if first, err = parseCPUIndex(bounds[0]); err != nil {
+			return nil, err
+		}
+		last = first
+		if len(bounds) == 2 {
+			if last, err = parseCPUIndex(bounds[1]); err != nil {
+				return nil, err
+			}
+		}
+		if last < first {
+			return nil, fmt.Errorf("invalid cpu range %v", item)
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			if !seen[cpu] {
+				seen[cpu] = true
+				cpus = append(cpus, cpu)
+			}
+		}
+	}
+	if len(cpus) == 0 {
+		return nil, fmt.Errorf("cpu list %q does not contain any cpu", list)
+	}
+	sort.Ints(cpus)
+	return
+}
+
+// parseCPUIndex parses a single cpu index.
+func parseCPUIndex(value string) (int, error) {
+	cpu, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || cpu < 0 {
+		return 0, fmt.Errorf("invalid cpu index %q", value)
+	}
+	return cpu, nil
+}
+
+// parseNumaNode parses the index of a NUMA node.
+func parseNumaNode(value string) (int, error) {
+	node, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || node < 0 {
+		return 0, fmt.Errorf("invalid NUMA node %q", value)
+	}
+	return node, nil
+}
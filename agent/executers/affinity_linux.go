@@ -0,0 +1,57 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build linux
+
+package executers
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const (
+	tasksetCommand = "taskset"
+	numactlCommand = "numactl"
+)
+
+// withAffinity prefixes the command with numactl when a NUMA node is requested, or with taskset otherwise.
+func withAffinity(command *exec.Cmd, affinity ProcessAffinity) error {
+	cpus := strings.TrimSpace(affinity.CPUs)
+	node := strings.TrimSpace(affinity.NumaNode)
+
+	var wrapperName string
+	var wrapperArguments []string
+	if node != "" {
+		wrapperName = numactlCommand
+		if cpus != "" {
+			wrapperArguments = []string{"--physcpubind=" + cpus, "--membind=" + node}
+		} else {
+			wrapperArguments = []string{"--cpunodebind=" + node, "--membind=" + node}
+		}
+	} else {
+		wrapperName = tasksetCommand
+		wrapperArguments = []string{"-c", cpus}
+	}
+
+	path, err := exec.LookPath(wrapperName)
+	if err != nil {
+		return fmt.Errorf("%v is required to set the process affinity: %v", wrapperName, err)
+	}
+
+	arguments := append([]string{wrapperName}, wrapperArguments...)
+	command.Args = append(append(arguments, command.Path), command.Args[1:]...)
+	command.Path = path
+	return nil
+}
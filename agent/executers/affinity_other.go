@@ -0,0 +1,27 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build darwin freebsd netbsd openbsd
+
+package executers
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// withAffinity returns an error, process affinity is not supported on this platform.
+func withAffinity(command *exec.Cmd, affinity ProcessAffinity) error {
+	return fmt.Errorf("process affinity is not supported on %v", runtime.GOOS)
+}
@@ -0,0 +1,46 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package executers
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCPUList(t *testing.T) {
+	cpus, err := ParseCPUList("4, 0-2,2,7-7")
+	assert.Nil(t, err)
+	assert.Equal(t, []int{0, 1, 2, 4, 7}, cpus)
+
+	for _, invalid := range []string{"", ",", "a", "3-1", "-1", "1-b"} {
+		_, err = ParseCPUList(invalid)
+		assert.NotNil(t, err, "cpu list %q", invalid)
+	}
+}
+
+func TestSetEmptyAffinity(t *testing.T) {
+	command := exec.Command("sh", "-c", "true")
+	path := command.Path
+	assert.Nil(t, setAffinity(command, ProcessAffinity{}))
+	assert.Equal(t, path, command.Path)
+	assert.Equal(t, []string{"sh", "-c", "true"}, command.Args)
+	assert.Nil(t, command.SysProcAttr)
+}
+
+func TestSetInvalidAffinity(t *testing.T) {
+	assert.NotNil(t, setAffinity(exec.Command("sh", "-c", "true"), ProcessAffinity{NumaNode: "first"}))
+	assert.NotNil(t, setAffinity(exec.Command("sh", "-c", "true"), ProcessAffinity{CPUs: "0-"}))
+}
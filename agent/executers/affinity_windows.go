@@ -0,0 +1,97 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build windows
+
+package executers
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// withAffinity starts the command through "start /affinity /node", which keeps the console of the agent
+// and waits for the command, so that output redirection and exit codes are preserved.
+// Go quotes the arguments for CommandLineToArgvW, which start does not parse: the empty title of the window
+// would become \"\", the command line is therefore set explicitly.
+func withAffinity(command *exec.Cmd, affinity ProcessAffinity) error {
+	arguments := []string{"cmd", "/C", "start", `""`, "/B", "/WAIT"}
+	if node := strings.TrimSpace(affinity.NumaNode); node != "" {
+		arguments = append(arguments, "/NODE", node)
+	}
+	if cpus := strings.TrimSpace(affinity.CPUs); cpus != "" {
+		mask, err := cpuMask(cpus)
+		if err != nil {
+			return err
+		}
+		arguments = append(arguments, "/AFFINITY", mask)
+	}
+	path, err := exec.LookPath("cmd")
+	if err != nil {
+		return fmt.Errorf("cmd is required to set the process affinity: %v", err)
+	}
+
+	commandLine := strings.Join(arguments, " ")
+	commandLine += " " + quoteArgument(command.Path)
+	for _, argument := range command.Args[1:] {
+		commandLine += " " + quoteArgument(argument)
+	}
+	command.Args = append(append(arguments, command.Path), command.Args[1:]...)
+	command.Path = path
+	if command.SysProcAttr == nil {
+		command.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	command.SysProcAttr.CmdLine = commandLine
+	return nil
+}
+
+// quoteArgument quotes an argument for CommandLineToArgvW. The argument is always enclosed in quotes,
+// so that cmd does not interpret the metacharacters it contains.
+func quoteArgument(argument string) string {
+	quoted := []byte{'"'}
+	slashes := 0
+	for i := 0; i < len(argument); i++ {
+		switch argument[i] {
+		case '\\':
+			slashes++
+		case '"':
+			// the backslashes preceding a quote, and the quote, are escaped
+			quoted = append(quoted, strings.Repeat(`\`, slashes+1)...)
+			slashes = 0
+		default:
+			slashes = 0
+		}
+		quoted = append(quoted, argument[i])
+	}
+	// the backslashes preceding the closing quote are escaped
+	quoted = append(quoted, strings.Repeat(`\`, slashes)...)
+	return string(append(quoted, '"'))
+}
+
+// cpuMask converts a cpu list to the hexadecimal mask expected by "start /affinity".
+func cpuMask(list string) (string, error) {
+	cpus, err := ParseCPUList(list)
+	if err != nil {
+		return "", err
+	}
+	var mask uint64
+	for _, cpu := range cpus {
+		if cpu >= 64 {
+			return "", fmt.Errorf("cpu %v is outside of the processor group of the agent", cpu)
+		}
+		mask |= 1 << uint(cpu)
+	}
+	return fmt.Sprintf("%X", mask), nil
+}
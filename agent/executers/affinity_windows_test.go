@@ -0,0 +1,37 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build windows
+
+package executers
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithAffinity(t *testing.T) {
+	command := exec.Command(`C:\Program Files\PowerShell\pwsh.exe`, "-f", `C:\scripts\a&b.ps1`, `say "hi"`, `C:\dir\`)
+	assert.Nil(t, withAffinity(command, ProcessAffinity{CPUs: "0-1,3", NumaNode: "1"}))
+	assert.Equal(t, `cmd /C start "" /B /WAIT /NODE 1 /AFFINITY B "C:\Program Files\PowerShell\pwsh.exe" "-f" "C:\scripts\a&b.ps1" "say \"hi\"" "C:\dir\\"`,
+		command.SysProcAttr.CmdLine)
+}
+
+func TestQuoteArgument(t *testing.T) {
+	assert.Equal(t, `""`, quoteArgument(""))
+	assert.Equal(t, `"a b"`, quoteArgument("a b"))
+	assert.Equal(t, `"a\\\"b"`, quoteArgument(`a\"b`))
+	assert.Equal(t, `"a\\"`, quoteArgument(`a\`))
+}
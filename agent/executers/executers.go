@@ -23,9 +23,9 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/aws/amazon-ssm-agent/agent/audit"
 	"github.com/aws/amazon-ssm-agent/agent/fileutil"
 	"github.com/aws/amazon-ssm-agent/agent/log"
-	"github.com/aws/amazon-ssm-agent/agent/plugins/pluginutil"
 	"github.com/aws/amazon-ssm-agent/agent/task"
 )
 
@@ -36,6 +36,7 @@ type ShellCommandExecuter struct {
 // Execute executes a list of shell commands in the given working directory.
 // The orchestration directory specifies where to create the script file and where
 // to save stdout and stderr. The orchestration directory will be created if it doesn't exist.
+// The options set the environment, the credentials and the resource limits of the process, see ExecuteOptions.
 // Returns readers for the standard output and standard error streams and a set of errors.
 // The errors need not be fatal - the output streams may still have data
 // even though some errors are reported. For example, if the command got killed while executing,
@@ -50,10 +51,11 @@ func (sh ShellCommandExecuter) Execute(
 	executionTimeout int,
 	commandName string,
 	commandArguments []string,
+	options ExecuteOptions,
 ) (stdout io.Reader, stderr io.Reader, exitCode int, errs []error) {
 
 	var err error
-	exitCode, err = runCommandOutputToFiles(log, cancelFlag, workingDir, stdoutFilePath, stderrFilePath, executionTimeout, commandName, commandArguments)
+	exitCode, err = runCommandOutputToFiles(log, cancelFlag, workingDir, stdoutFilePath, stderrFilePath, executionTimeout, commandName, commandArguments, options)
 	if err != nil {
 		errs = append(errs, err)
 	}
@@ -113,6 +115,7 @@ func runCommandOutputToFiles(
 	executionTimeout int,
 	commandName string,
 	commandArguments []string,
+	options ExecuteOptions,
 ) (exitCode int, err error) {
 
 	// create stdout file
@@ -133,11 +136,15 @@ func runCommandOutputToFiles(
 	}
 	defer stderrWriter.Close()
 
-	return RunCommand(log, cancelFlag, workingDir, stdoutWriter, stderrWriter, executionTimeout, commandName, commandArguments)
+	return RunCommand(log, cancelFlag, workingDir, stdoutWriter, stderrWriter, executionTimeout, commandName, commandArguments, options)
 }
 
 // RunCommand runs the given commands using the given working directory.
 // Standard output and standard error are sent to the given writers.
+// The environment variables of the options are added to the environment of the agent, or to the environment
+// of the user when the process runs as the user and group of the options, see setRunAs.
+// The resources of the process are bounded by the limits of the options when they are given, see newSandbox.
+// On Linux, the process runs in a transient systemd scope enforcing the limits when enabled, see newTransientScope.
 func RunCommand(log log.T,
 	cancelFlag task.CancelFlag,
 	workingDir string,
@@ -146,32 +153,105 @@ func RunCommand(log log.T,
 	executionTimeout int,
 	commandName string,
 	commandArguments []string,
+	options ExecuteOptions,
 ) (exitCode int, err error) {
 
 	command := exec.Command(commandName, commandArguments...)
 	command.Dir = workingDir
 	command.Stdout = stdoutWriter
 	command.Stderr = stderrWriter
+	runAs, limits := options.RunAs, options.Limits
+
+	// mask the secrets before the output reaches the writers, the output files are read while the command runs
+	if len(options.Secrets) > 0 {
+		stdoutMask := newMaskingWriter(stdoutWriter, options.Secrets, audit.RedactedValue)
+		stderrMask := newMaskingWriter(stderrWriter, options.Secrets, audit.RedactedValue)
+		command.Stdout, command.Stderr = stdoutMask, stderrMask
+		defer flushMasks(log, stdoutMask, stderrMask)
+	}
 	exitCode = 0
 
 	// configure OS-specific process settings
 	prepareProcess(command)
+	if err = setAffinity(command, options.Affinity); err != nil {
+		log.Errorf("failed to set process affinity. %v", err)
+		exitCode = 1
+		return
+	}
+
+	// switch the credentials, the variables of the document are set afterwards so that they take precedence
+	if err = checkRunAsPolicy(runAs); err != nil {
+		log.Errorf("denied running the command. %v", err)
+		exitCode = 1
+		return
+	}
+	if err = setRunAs(command, runAs); err != nil {
+		log.Errorf("unable to run the command as %v: %v", runAs, err)
+		exitCode = 1
+		return
+	}
+	defer releaseRunAs(command)
+	if len(options.EnvVars) > 0 {
+		if command.Env == nil {
+			command.Env = os.Environ()
+		}
+		for name, value := range options.EnvVars {
+			command.Env = append(command.Env, name+"="+value)
+		}
+	}
+	if options.BeforeStart != nil {
+		env := command.Env
+		if env == nil {
+			env = os.Environ()
+		}
+		options.BeforeStart(command.Dir, env)
+	}
+
+	// create the sandbox before starting the process, the process is held until it is enclosed in the sandbox
+	if err = ValidateResourceLimits(limits); err != nil {
+		log.Errorf("unable to limit the resources of the command: %v", err)
+		exitCode = 1
+		return
+	}
+	scope := newTransientScope(log, limits, runAs)
+	sandbox, err := newSandbox(scope.sandboxLimits(limits))
+	if err != nil {
+		log.Errorf("unable to limit the resources of the command: %v", err)
+		exitCode = 1
+		return
+	}
+	defer sandbox.close(log)
+	if err = sandbox.wrap(command); err != nil {
+		log.Errorf("unable to limit the resources of the command: %v", err)
+		exitCode = 1
+		return
+	}
+	scope.wrap(command)
 
 	log.Debug()
 	log.Debugf("Running in directory %v, command: %v %v.", workingDir, commandName, commandArguments)
 	log.Debug()
-	if err = command.Start(); err != nil {
+	wait, err := startProcess(command)
+	if err != nil {
 		log.Error("error occurred starting the command", err)
 		exitCode = 1
 		return
 	}
+	if err = sandbox.add(command.Process); err != nil {
+		log.Errorf("unable to limit the resources of the command: %v", err)
+		killProcess(command.Process)
+		scope.stop(log)
+		wait()
+		exitCode = 1
+		return
+	}
 
-	go killProcessOnCancel(log, command, cancelFlag)
+	go killProcessOnCancel(log, command, scope, cancelFlag)
 
 	timer := time.NewTimer(time.Duration(executionTimeout) * time.Second)
-	go killProcessOnTimeout(log, command, timer)
+	go killProcessOnTimeout(log, command, scope, timer)
 
-	err = command.Wait()
+	err = wait()
 	timedOut := !timer.Stop() // returns false if called previously - indicates timedOut.
 	if err != nil {
 		exitCode = 1
@@ -185,11 +265,11 @@ func RunCommand(log log.T,
 				if exitCode == -1 {
 					if cancelFlag.Canceled() {
 						// set appropriate exit code based on cancel or timeout
-						exitCode = pluginutil.CommandStoppedPreemptivelyExitCode
+						exitCode = CommandStoppedPreemptivelyExitCode
 						log.Infof("The execution of command was cancelled.")
 					} else if timedOut {
 						// set appropriate exit code based on cancel or timeout
-						exitCode = pluginutil.CommandStoppedPreemptivelyExitCode
+						exitCode = CommandStoppedPreemptivelyExitCode
 						log.Infof("The execution of command was timedout.")
 					}
 				} else {
@@ -215,14 +295,25 @@ func RunCommand(log log.T,
 	return
 }
 
+// flushMasks writes the output held back by the masking writers once the command has exited.
+func flushMasks(log log.T, masks ...*maskingWriter) {
+	for _, mask := range masks {
+		if err := mask.Flush(); err != nil {
+			log.Errorf("unable to write the end of the output: %v", err)
+		}
+	}
+}
+
 // killProcessOnCancel waits for a cancel request.
 // If a cancel request is received, this method kills the underlying
 // process of the command. This will unblock the command.Wait() call.
+// The processes of the transient scope of the command are killed too, when it runs in one.
 // If the task completed successfully this method returns with no action.
-func killProcessOnCancel(log log.T, command *exec.Cmd, cancelFlag task.CancelFlag) {
+func killProcessOnCancel(log log.T, command *exec.Cmd, scope *transientScope, cancelFlag task.CancelFlag) {
 	cancelFlag.Wait()
 	if cancelFlag.Canceled() {
 		log.Debug("Process cancelled. Attempting to stop process.")
+		defer scope.stop(log)
 
 		// task has been asked to cancel, kill process
 		if err := killProcess(command.Process); err != nil {
@@ -237,10 +328,12 @@ func killProcessOnCancel(log log.T, command *exec.Cmd, cancelFlag task.CancelFla
 // killProcessOnTimeout waits for a timeout.
 // When the timeout is reached, this method kills the underlying
 // process of the command. This will unblock the command.Wait() call.
+// The processes of the transient scope of the command are killed too, when it runs in one.
 // If the task completed successfully this method returns with no action.
-func killProcessOnTimeout(log log.T, command *exec.Cmd, timer *time.Timer) {
+func killProcessOnTimeout(log log.T, command *exec.Cmd, scope *transientScope, timer *time.Timer) {
 	<-timer.C
 	log.Debug("Process exceeded timeout. Attempting to stop process.")
+	defer scope.stop(log)
 
 	// task has been exceeded the allowed execution timeout, kill process
 	if err := killProcess(command.Process); err != nil {
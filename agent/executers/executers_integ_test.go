@@ -20,13 +20,13 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/aws/amazon-ssm-agent/agent/log"
-	"github.com/aws/amazon-ssm-agent/agent/plugins/pluginutil"
 	"github.com/aws/amazon-ssm-agent/agent/task"
 	"github.com/stretchr/testify/assert"
 )
@@ -38,6 +38,7 @@ const (
 	successExitCode                 = 0
 	processTerminatedByUserExitCode = 137
 	defaultExecutionTimeout         = 5000
+	scriptName                      = "_script.sh"
 	stdOutFileName                  = "stdout"
 	stdErrFileName                  = "stderr"
 )
@@ -134,7 +135,7 @@ func TestRunCommand_cancel(t *testing.T) {
 func TestShellCommandExecuter(t *testing.T) {
 	runTest := func(testCase TestCase) {
 		orchestrationDir, shCommandExecuterInvoker, _ := prepareTestShellCommandExecuter(t)
-		defer pluginutil.DeleteDirectory(logger, orchestrationDir)
+		defer os.RemoveAll(orchestrationDir)
 		testCommandInvoker(t, shCommandExecuterInvoker, testCase)
 	}
 
@@ -147,7 +148,7 @@ func TestShellCommandExecuter(t *testing.T) {
 func TestShellCommandExecuter_cancel(t *testing.T) {
 	runTest := func(testCase TestCase) {
 		orchestrationDir, shCommandExecuterInvoker, cancelFlag := prepareTestShellCommandExecuter(t)
-		defer pluginutil.DeleteDirectory(logger, orchestrationDir)
+		defer os.RemoveAll(orchestrationDir)
 		testCommandInvokerCancel(t, shCommandExecuterInvoker, cancelFlag, testCase)
 	}
 
@@ -219,13 +220,13 @@ func prepareTestShellCommandExecuter(t *testing.T) (orchestrationDir string, com
 	// commandInvoker calls the shell then sets the state of the flag to completed
 	commandInvoker = func(commands []string) (stdout io.Reader, stderr io.Reader, exitCode int, errs []error) {
 		defer cancelFlag.Set(task.Completed)
-		scriptPath := filepath.Join(orchestrationDir, pluginutil.RunCommandScriptName)
+		scriptPath := filepath.Join(orchestrationDir, scriptName)
 		stdoutFilePath := filepath.Join(orchestrationDir, stdOutFileName)
 		stderrFilePath := filepath.Join(orchestrationDir, stdErrFileName)
 
 		// Used to mimic the process
 		CreateScriptFile(scriptPath, commands)
-		return sh.Execute(logger, workDir, stdoutFilePath, stderrFilePath, cancelFlag, defaultExecutionTimeout, commands[0], commands[1:])
+		return sh.Execute(logger, workDir, stdoutFilePath, stderrFilePath, cancelFlag, defaultExecutionTimeout, commands[0], commands[1:], ExecuteOptions{})
 	}
 
 	return
@@ -241,7 +242,7 @@ func prepareTestRunCommand(t *testing.T) (commandInvoker CommandInvoker, cancelF
 		var stdoutBuf bytes.Buffer
 		var stderrBuf bytes.Buffer
 		workDir := "."
-		tempExitCode, err := RunCommand(logger, cancelFlag, workDir, &stdoutBuf, &stderrBuf, defaultExecutionTimeout, commands[0], commands[1:])
+		tempExitCode, err := RunCommand(logger, cancelFlag, workDir, &stdoutBuf, &stderrBuf, defaultExecutionTimeout, commands[0], commands[1:], ExecuteOptions{})
 		exitCode = tempExitCode
 
 		// record error if any
@@ -267,6 +268,24 @@ func assertReaderEquals(t *testing.T, expected string, reader io.Reader) {
 }
 
 // TestCreateScriptFile tests that CreateScriptFile correctly returns error (to avoid shadowing bug).
+// TestRunCommandBeforeStart checks the options get the working directory and the environment of the process.
+func TestRunCommandBeforeStart(t *testing.T) {
+	var workingDir string
+	var env []string
+	var stdout, stderr bytes.Buffer
+	exitCode, err := RunCommand(logger, task.NewChanneledCancelFlag(), os.TempDir(), &stdout, &stderr, defaultExecutionTimeout, "true", nil, ExecuteOptions{
+		EnvVars: map[string]string{"STEP_VARIABLE": "value"},
+		BeforeStart: func(dir string, variables []string) {
+			workingDir, env = dir, variables
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, os.TempDir(), workingDir)
+	assert.Contains(t, env, "STEP_VARIABLE=value")
+	assert.True(t, len(env) > 1, "the variables of the step are added to the environment of the agent")
+}
+
 func TestCreateScriptFile(t *testing.T) {
 	err := CreateScriptFile("/someDir,ThatDoes:Not#Exist/scriptName.sh", []string{"echo hello"})
 	assert.NotNil(t, err)
@@ -21,12 +21,23 @@ import (
 	"syscall"
 )
 
+// CommandStoppedPreemptivelyExitCode is the exit code of a command killed on cancel or timeout.
+const CommandStoppedPreemptivelyExitCode = 137 // Fatal error (128) + signal for SIGKILL (9) = 137
+
 func prepareProcess(command *exec.Cmd) {
 	// make the process the leader of its process group
 	// (otherwise we cannot kill it properly)
 	command.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 }
 
+// startProcess starts the command, the returned function waits for it.
+func startProcess(command *exec.Cmd) (wait func() error, err error) {
+	if err = command.Start(); err != nil {
+		return nil, err
+	}
+	return command.Wait, nil
+}
+
 func killProcess(process *os.Process) error {
 	//   NOTE: go only kills the process but not its sub processes.
 	//   The consequence is that command.Wait() does not return, for some reason.
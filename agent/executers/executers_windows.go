@@ -20,10 +20,25 @@ import (
 	"os/exec"
 )
 
+// CommandStoppedPreemptivelyExitCode is the exit code of a command killed on cancel or timeout.
+const CommandStoppedPreemptivelyExitCode = -1
+
 func prepareProcess(command *exec.Cmd) {
 	// nothing to do on windows
 }
 
+// startProcess starts the command, the returned function waits for it.
+// The commands running with the token of another session are started by startAsUser.
+func startProcess(command *exec.Cmd) (wait func() error, err error) {
+	if command.SysProcAttr != nil && command.SysProcAttr.Token != 0 {
+		return startAsUser(command)
+	}
+	if err = command.Start(); err != nil {
+		return nil, err
+	}
+	return command.Wait, nil
+}
+
 func killProcess(process *os.Process) error {
 	return process.Kill()
 }
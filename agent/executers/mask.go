@@ -0,0 +1,109 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package executers contains general purpose (shell) command executing objects.
+// mask contains the writer replacing the secrets in the output of the commands.
+package executers
+
+import (
+	"bytes"
+	"io"
+)
+
+// maskingWriter replaces the secrets in the stream written to the underlying writer. The end of the stream, which can be
+// the beginning of a secret, is held back until the next write shows whether it is, or until flush.
+type maskingWriter struct {
+	writer  io.Writer
+	secrets [][]byte
+	mask    []byte
+	longest int
+	pending []byte
+}
+
+// newMaskingWriter returns a writer replacing the non empty secrets with the mask.
+func newMaskingWriter(writer io.Writer, secrets []string, mask string) *maskingWriter {
+	m := &maskingWriter{writer: writer, mask: []byte(mask)}
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		m.secrets = append(m.secrets, []byte(secret))
+		if len(secret) > m.longest {
+			m.longest = len(secret)
+		}
+	}
+	return m
+}
+
+// Write masks the secrets found in the stream and writes all of it but the bytes held back.
+func (m *maskingWriter) Write(p []byte) (int, error) {
+	m.pending = append(m.pending, p...)
+	out := m.maskPending(false)
+
+	// a secret starting in the last bytes would end in the next write
+	held := m.longest - 1
+	if held < 0 {
+		held = 0
+	}
+	if held > len(m.pending) {
+		held = len(m.pending)
+	}
+	out = append(out, m.pending[:len(m.pending)-held]...)
+	m.pending = append([]byte(nil), m.pending[len(m.pending)-held:]...)
+	if _, err := m.writer.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush masks and writes the bytes held back, once the stream has ended.
+func (m *maskingWriter) Flush() error {
+	out := append(m.maskPending(true), m.pending...)
+	m.pending = nil
+	if len(out) == 0 {
+		return nil
+	}
+	_, err := m.writer.Write(out)
+	return err
+}
+
+// maskPending returns the pending bytes up to the end of the last secret found, with the secrets masked, and leaves
+// the rest pending. Until the stream has ended, a secret found in the last bytes can be the beginning of a longer secret,
+// it is left pending.
+func (m *maskingWriter) maskPending(ended bool) (out []byte) {
+	for {
+		index, length := m.nextSecret()
+		if index < 0 || (!ended && index+m.longest > len(m.pending)) {
+			return
+		}
+		out = append(out, m.pending[:index]...)
+		out = append(out, m.mask...)
+		m.pending = m.pending[index+length:]
+	}
+}
+
+// nextSecret returns the index and the length of the first secret in the pending bytes, the longest one
+// when several secrets start at this index, or -1 when there is none.
+func (m *maskingWriter) nextSecret() (index int, length int) {
+	index = -1
+	for _, secret := range m.secrets {
+		i := bytes.Index(m.pending, secret)
+		if i < 0 {
+			continue
+		}
+		if index < 0 || i < index || (i == index && len(secret) > length) {
+			index, length = i, len(secret)
+		}
+	}
+	return
+}
@@ -0,0 +1,55 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package executers
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaskingWriter(t *testing.T) {
+	for _, chunks := range [][]string{
+		{"the password is hunter2 and hunter2"},
+		{"the password is hun", "ter2 and hunte", "r2"},
+		{"the password is h", "u", "n", "t", "e", "r", "2 and hunter", "2"},
+	} {
+		var out bytes.Buffer
+		writer := newMaskingWriter(&out, []string{"hunter2", "", "hunter"}, "***")
+		for _, chunk := range chunks {
+			n, err := writer.Write([]byte(chunk))
+			assert.Nil(t, err)
+			assert.Equal(t, len(chunk), n)
+			assert.NotContains(t, out.String(), "hunter")
+		}
+		assert.Nil(t, writer.Flush())
+		assert.Equal(t, "the password is *** and ***", out.String(), "%q", chunks)
+	}
+
+	// the end of the stream is held back until flush
+	var out bytes.Buffer
+	writer := newMaskingWriter(&out, []string{"hunter2"}, "***")
+	writer.Write([]byte("output hun"))
+	assert.Equal(t, "outp", out.String())
+	assert.Nil(t, writer.Flush())
+	assert.Equal(t, "output hun", out.String())
+
+	// a shorter secret at the end of the stream is masked on flush
+	out.Reset()
+	writer = newMaskingWriter(&out, []string{"hunter2", "hunter"}, "***")
+	writer.Write([]byte("output hunter"))
+	assert.Nil(t, writer.Flush())
+	assert.Equal(t, "output ***", out.String())
+}
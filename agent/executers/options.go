@@ -0,0 +1,81 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package executers contains general purpose (shell) command executing objects.
+// options contains the settings of the processes started by the executers beyond their command line.
+package executers
+
+import (
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+)
+
+// ExecuteOptions are the settings of the process of a command. The zero value runs the command
+// with the environment, the credentials and the resources of the agent.
+type ExecuteOptions struct {
+	// EnvVars are added to the environment of the process, their values are not logged.
+	EnvVars map[string]string
+	// RunAs is the user and group the process runs as, see setRunAs.
+	RunAs RunAs
+	// Limits bound the resources of the process and its descendants, see newSandbox.
+	Limits ResourceLimits
+	// Affinity pins the process to a set of cpus or a NUMA node, see setAffinity.
+	Affinity ProcessAffinity
+	// Secrets are replaced in the output as it is written, before it is read, truncated, uploaded or streamed.
+	Secrets []string
+	// BeforeStart, if set, is called with the working directory and the complete environment of the process
+	// before it starts, once the credentials and the variables are set.
+	BeforeStart func(workingDir string, env []string)
+}
+
+// RunAs is the user and group a command runs as. Empty values keep the user and the group of the agent,
+// when only the user is given the command runs with the primary group of the user.
+// On Windows, the command can only run as a user logged on the instance, in the session of this user.
+type RunAs struct {
+	User  string
+	Group string
+	// UserSession runs the command in the session of the logged-on user instead of the session of the agent (Windows)
+	UserSession bool
+}
+
+// IsEmpty returns true if the command runs with the credentials of the agent.
+func (r RunAs) IsEmpty() bool {
+	return strings.TrimSpace(r.User) == "" && strings.TrimSpace(r.Group) == ""
+}
+
+// ResourceLimits bounds the resources of the processes started by a step, zero values mean no limit.
+// The processes are enclosed in a cgroup on Linux and in a job object on Windows.
+type ResourceLimits appconfig.ResourceLimitsCfg
+
+// IsEmpty returns true if the processes run without limits.
+func (l ResourceLimits) IsEmpty() bool {
+	return l == ResourceLimits{}
+}
+
+// Override returns the limits with the non zero values of the given limits replacing their own.
+func (l ResourceLimits) Override(override ResourceLimits) ResourceLimits {
+	if override.CPUShares != 0 {
+		l.CPUShares = override.CPUShares
+	}
+	if override.MemoryLimitMB != 0 {
+		l.MemoryLimitMB = override.MemoryLimitMB
+	}
+	if override.MaxProcesses != 0 {
+		l.MaxProcesses = override.MaxProcesses
+	}
+	if override.Niceness != 0 {
+		l.Niceness = override.Niceness
+	}
+	return l
+}
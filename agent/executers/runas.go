@@ -0,0 +1,103 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package executers contains general purpose (shell) command executing objects.
+// runas contains the policy of the agent configuration on the users the commands run as.
+package executers
+
+import (
+	"fmt"
+	"os/user"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+)
+
+// configuredRunAsPolicy returns the users the commands are allowed and denied to run as in the agent configuration.
+var configuredRunAsPolicy = func() appconfig.RunAsCfg {
+	config, err := appconfig.Config(false)
+	if err != nil {
+		return appconfig.RunAsCfg{}
+	}
+	return config.RunAs
+}
+
+// currentUserName returns the user of the agent, the commands without a user run as it.
+var currentUserName = func() (string, error) {
+	current, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	return current.Username, nil
+}
+
+// runAsGroups returns the groups the process of a command holds.
+var runAsGroups = effectiveGroups
+
+// checkRunAsPolicy returns an error if the agent configuration does not allow the commands to run as the user and groups
+// of runAs. The commands without a user are checked as the user of the agent. Every group the process of the command
+// holds is checked, the supplementary groups of its user included: a command holding a denied group, or a group
+// missing from a non-empty allow list, is refused. The denied users and groups take precedence over the allowed ones.
+func checkRunAsPolicy(runAs RunAs) error {
+	policy := configuredRunAsPolicy()
+	if len(policy.AllowedUsers) == 0 && len(policy.DeniedUsers) == 0 &&
+		len(policy.AllowedGroups) == 0 && len(policy.DeniedGroups) == 0 {
+		return nil
+	}
+	userName := strings.TrimSpace(runAs.User)
+	if userName == "" {
+		var err error
+		if userName, err = currentUserName(); err != nil {
+			return fmt.Errorf("unable to find the user of the agent: %v", err)
+		}
+	}
+	if err := checkRunAsList("user", userName, policy.AllowedUsers, policy.DeniedUsers, allowedUser, sameUser); err != nil {
+		return err
+	}
+	if len(policy.AllowedGroups) == 0 && len(policy.DeniedGroups) == 0 {
+		return nil
+	}
+	groups, err := runAsGroups(runAs)
+	if err != nil {
+		return err
+	}
+	for _, groupName := range groups {
+		if err := checkRunAsList("group", groupName, nil, policy.DeniedGroups, sameGroup, sameGroup); err != nil {
+			return err
+		}
+	}
+	for _, groupName := range groups {
+		if err := checkRunAsList("group", groupName, policy.AllowedGroups, nil, sameGroup, sameGroup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRunAsList returns an error if name is denied, or if it is not allowed when the allow list is not empty.
+func checkRunAsList(kind string, name string, allowed []string, denied []string, allows func(name string, entry string) bool, denies func(name string, entry string) bool) error {
+	for _, entry := range denied {
+		if denies(name, strings.TrimSpace(entry)) {
+			return fmt.Errorf("the agent configuration denies running commands as %v %v", kind, name)
+		}
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+	for _, entry := range allowed {
+		if allows(name, strings.TrimSpace(entry)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("the agent configuration does not allow running commands as %v %v", kind, name)
+}
@@ -0,0 +1,92 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package executers
+
+import (
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubRunAsPolicy makes the commands run with the given policy of the agent configuration.
+func stubRunAsPolicy(policy appconfig.RunAsCfg) func() {
+	original := configuredRunAsPolicy
+	configuredRunAsPolicy = func() appconfig.RunAsCfg { return policy }
+	return func() { configuredRunAsPolicy = original }
+}
+
+// stubCurrentUser makes the agent run as the given user.
+func stubCurrentUser(name string) func() {
+	original := currentUserName
+	currentUserName = func() (string, error) { return name, nil }
+	return func() { currentUserName = original }
+}
+
+func TestCheckRunAsPolicy(t *testing.T) {
+	defer stubCurrentUser("agent")()
+	defer stubRunAsPolicy(appconfig.RunAsCfg{DeniedUsers: []string{"admin"}})()
+	assert.Nil(t, checkRunAsPolicy(RunAs{}))
+	assert.Nil(t, checkRunAsPolicy(RunAs{Group: "admin"}))
+	assert.Nil(t, checkRunAsPolicy(RunAs{User: "deploy"}))
+	assert.NotNil(t, checkRunAsPolicy(RunAs{User: " admin "}))
+
+	// the denied users take precedence over the allowed ones
+	defer stubRunAsPolicy(appconfig.RunAsCfg{AllowedUsers: []string{"deploy", "admin"}, DeniedUsers: []string{"admin"}})()
+	assert.Nil(t, checkRunAsPolicy(RunAs{User: "deploy"}))
+	assert.NotNil(t, checkRunAsPolicy(RunAs{User: "admin"}))
+	assert.NotNil(t, checkRunAsPolicy(RunAs{User: "backup"}))
+
+	// the commands without a user run as the user of the agent
+	assert.NotNil(t, checkRunAsPolicy(RunAs{}))
+	assert.NotNil(t, checkRunAsPolicy(RunAs{Group: "deploy"}))
+	defer stubCurrentUser("deploy")()
+	assert.Nil(t, checkRunAsPolicy(RunAs{}))
+}
+
+// stubRunAsGroups gives the users the given groups, a command holds the group of its runAs and the groups of its user.
+func stubRunAsGroups(userGroups map[string][]string) func() {
+	original := runAsGroups
+	runAsGroups = func(runAs RunAs) (groups []string, err error) {
+		if runAs.Group != "" {
+			groups = append(groups, runAs.Group)
+		}
+		return append(groups, userGroups[runAs.User]...), nil
+	}
+	return func() { runAsGroups = original }
+}
+
+func TestCheckRunAsPolicyGroups(t *testing.T) {
+	defer stubCurrentUser("agent")()
+	defer stubRunAsGroups(map[string][]string{"deploy": {"deploy"}, "admin": {"admin", "wheel"}})()
+	defer stubRunAsPolicy(appconfig.RunAsCfg{AllowedGroups: []string{"deploy", "wheel"}, DeniedGroups: []string{"wheel"}})()
+	assert.Nil(t, checkRunAsPolicy(RunAs{Group: "deploy"}))
+	assert.NotNil(t, checkRunAsPolicy(RunAs{Group: "wheel"}))
+	assert.NotNil(t, checkRunAsPolicy(RunAs{User: "deploy", Group: "backup"}))
+}
+
+// TestCheckRunAsPolicyDeniedSupplementaryGroup tests that a command is refused when any group of its user is denied.
+func TestCheckRunAsPolicyDeniedSupplementaryGroup(t *testing.T) {
+	defer stubCurrentUser("agent")()
+	defer stubRunAsGroups(map[string][]string{"deploy": {"deploy"}, "admin": {"admin", "wheel"}})()
+	defer stubRunAsPolicy(appconfig.RunAsCfg{DeniedGroups: []string{"wheel"}})()
+	assert.Nil(t, checkRunAsPolicy(RunAs{User: "deploy"}))
+	assert.NotNil(t, checkRunAsPolicy(RunAs{User: "admin"}))
+	assert.NotNil(t, checkRunAsPolicy(RunAs{User: "admin", Group: "admin"}))
+
+	// the allow list applies to every group of the command
+	defer stubRunAsPolicy(appconfig.RunAsCfg{AllowedGroups: []string{"deploy", "admin"}})()
+	assert.Nil(t, checkRunAsPolicy(RunAs{User: "deploy"}))
+	assert.NotNil(t, checkRunAsPolicy(RunAs{User: "admin"}))
+}
@@ -0,0 +1,251 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build darwin freebsd linux netbsd openbsd
+
+package executers
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// runAsPath is the PATH of the commands running as another user, the PATH of the agent can list directories of root.
+const runAsPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// runAsInheritedVariables are the variables of the agent kept in the environment of the commands running as another user.
+var runAsInheritedVariables = []string{"LANG", "LC_ALL", "TZ"}
+
+// runAsIdentity is the resolved user and group of a RunAs.
+type runAsIdentity struct {
+	uid    uint32
+	gid    uint32
+	groups []uint32
+	// user is nil when only the group is switched
+	user *user.User
+}
+
+// ValidateRunAs checks that the user and the group of runAs exist.
+func ValidateRunAs(runAs RunAs) (err error) {
+	if err = checkRunAsPolicy(runAs); err != nil {
+		return
+	}
+	if !runAs.IsEmpty() || runAs.UserSession {
+		_, err = lookupRunAs(runAs)
+	}
+	return
+}
+
+// ChownToRunAs gives the files to the user and group of runAs, so that the command can read them.
+func ChownToRunAs(runAs RunAs, paths ...string) error {
+	if runAs.IsEmpty() {
+		return nil
+	}
+	identity, err := lookupRunAs(runAs)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err = os.Chown(path, int(identity.uid), int(identity.gid)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setRunAs makes the command run with the credentials of the user and group of runAs.
+// When the user changes, the supplementary groups are the groups of the user and the environment is the one of runAsEnvironment.
+func setRunAs(command *exec.Cmd, runAs RunAs) error {
+	if runAs.IsEmpty() {
+		return nil
+	}
+	identity, err := lookupRunAs(runAs)
+	if err != nil {
+		return err
+	}
+
+	if command.SysProcAttr == nil {
+		command.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	command.SysProcAttr.Credential = &syscall.Credential{Uid: identity.uid, Gid: identity.gid, Groups: identity.groups}
+
+	if identity.user != nil {
+		command.Env = runAsEnvironment(identity.user)
+	}
+	return nil
+}
+
+// runAsEnvironment returns the environment of the commands running as the user: the variables set by a login
+// and the locale of the agent. The other variables of the agent, such as its proxy settings, are not handed over.
+func runAsEnvironment(user *user.User) []string {
+	env := []string{
+		"PATH=" + runAsPath,
+		"HOME=" + user.HomeDir,
+		"USER=" + user.Username,
+		"LOGNAME=" + user.Username,
+	}
+	for _, name := range runAsInheritedVariables {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// releaseRunAs has nothing to release, the credentials are ids.
+func releaseRunAs(command *exec.Cmd) {}
+
+// lookupRunAs resolves the names (or ids) of the user and group of runAs.
+// The session of a logged-on user is specific to Windows.
+func lookupRunAs(runAs RunAs) (identity runAsIdentity, err error) {
+	if runAs.UserSession {
+		return identity, fmt.Errorf("running commands in the session of a logged-on user is only supported on windows")
+	}
+	userName := strings.TrimSpace(runAs.User)
+	groupName := strings.TrimSpace(runAs.Group)
+	identity.uid = uint32(os.Getuid())
+	identity.gid = uint32(os.Getgid())
+
+	if userName != "" {
+		if identity.user, err = lookupUser(userName); err != nil {
+			return identity, fmt.Errorf("unknown user %v: %v", userName, err)
+		}
+		if identity.uid, err = parseID(identity.user.Uid); err != nil {
+			return
+		}
+		if identity.gid, err = parseID(identity.user.Gid); err != nil {
+			return
+		}
+		var groupIDs []string
+		if groupIDs, err = userGroupIds(identity.user); err != nil {
+			return identity, fmt.Errorf("unable to list the groups of user %v: %v", userName, err)
+		}
+		for _, groupID := range groupIDs {
+			var gid uint32
+			if gid, err = parseID(groupID); err != nil {
+				return
+			}
+			identity.groups = append(identity.groups, gid)
+		}
+	}
+
+	if groupName != "" {
+		var group *user.Group
+		if group, err = lookupGroup(groupName); err != nil {
+			return identity, fmt.Errorf("unknown group %v: %v", groupName, err)
+		}
+		if identity.gid, err = parseID(group.Gid); err != nil {
+			return
+		}
+		if identity.user == nil {
+			// drop the supplementary groups of the agent
+			identity.groups = []uint32{identity.gid}
+		} else {
+			identity.groups = append(identity.groups, identity.gid)
+		}
+	}
+	return
+}
+
+// sameUser returns true if the names, or ids, designate the same user.
+func sameUser(name string, other string) bool {
+	if name == other {
+		return true
+	}
+	user, err := lookupUser(name)
+	if err != nil {
+		return false
+	}
+	otherUser, err := lookupUser(other)
+	return err == nil && user.Uid == otherUser.Uid
+}
+
+// allowedUser returns true if the entry of an allow list designates the user.
+func allowedUser(name string, entry string) bool {
+	return sameUser(name, entry)
+}
+
+// effectiveGroups returns the ids of the groups the process of the command holds, as lookupRunAs sets them:
+// the group of runAs and the groups of its user, or the groups of the agent when runAs is empty.
+func effectiveGroups(runAs RunAs) (groups []string, err error) {
+	identity, err := lookupRunAs(runAs)
+	if err != nil {
+		return nil, err
+	}
+	ids := append([]uint32{identity.gid}, identity.groups...)
+	if runAs.IsEmpty() {
+		var agentGroups []int
+		if agentGroups, err = os.Getgroups(); err != nil {
+			return nil, fmt.Errorf("unable to list the groups of the agent: %v", err)
+		}
+		for _, gid := range agentGroups {
+			ids = append(ids, uint32(gid))
+		}
+	}
+	seen := make(map[uint32]bool)
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			groups = append(groups, strconv.FormatUint(uint64(id), 10))
+		}
+	}
+	return groups, nil
+}
+
+// sameGroup returns true if the names, or ids, designate the same group.
+func sameGroup(name string, other string) bool {
+	if name == other {
+		return true
+	}
+	group, err := lookupGroup(name)
+	if err != nil {
+		return false
+	}
+	otherGroup, err := lookupGroup(other)
+	return err == nil && group.Gid == otherGroup.Gid
+}
+
+// userGroupIds returns the ids of the groups of a user, its primary group included.
+var userGroupIds = func(user *user.User) ([]string, error) {
+	return user.GroupIds()
+}
+
+// lookupUser looks up a user by name, or by id when the name is numeric.
+func lookupUser(name string) (*user.User, error) {
+	if _, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return user.LookupId(name)
+	}
+	return user.Lookup(name)
+}
+
+// lookupGroup looks up a group by name, or by id when the name is numeric.
+func lookupGroup(name string) (*user.Group, error) {
+	if _, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return user.LookupGroupId(name)
+	}
+	return user.LookupGroup(name)
+}
+
+// parseID parses a user or group id.
+func parseID(id string) (uint32, error) {
+	value, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid id %v: %v", id, err)
+	}
+	return uint32(value), nil
+}
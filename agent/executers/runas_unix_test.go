@@ -0,0 +1,148 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build darwin freebsd linux netbsd openbsd
+
+package executers
+
+import (
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetRunAs(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Skip("unable to determine the current user", err)
+	}
+
+	// an empty run as keeps the credentials of the agent
+	command := exec.Command("true")
+	assert.Nil(t, setRunAs(command, RunAs{}))
+	assert.Nil(t, command.SysProcAttr)
+
+	for _, name := range []string{current.Username, current.Uid} {
+		command = exec.Command("true")
+		assert.Nil(t, setRunAs(command, RunAs{User: name}))
+		assert.Equal(t, uint32(os.Getuid()), command.SysProcAttr.Credential.Uid)
+		assert.Equal(t, current.Gid, formatID(command.SysProcAttr.Credential.Gid))
+		assert.Equal(t, runAsEnvironment(current), command.Env)
+	}
+
+	// only the group changes, the supplementary groups are dropped
+	command = exec.Command("true")
+	assert.Nil(t, setRunAs(command, RunAs{Group: current.Gid}))
+	assert.Equal(t, uint32(os.Getuid()), command.SysProcAttr.Credential.Uid)
+	assert.Equal(t, []uint32{command.SysProcAttr.Credential.Gid}, command.SysProcAttr.Credential.Groups)
+	assert.Nil(t, command.Env)
+
+	assert.NotNil(t, setRunAs(exec.Command("true"), RunAs{User: "no-such-user-for-ssm-agent"}))
+	assert.NotNil(t, ValidateRunAs(RunAs{Group: "no-such-group-for-ssm-agent"}))
+	assert.NotNil(t, ValidateRunAs(RunAs{User: current.Username, UserSession: true}))
+}
+
+func TestRunAsEnvironment(t *testing.T) {
+	defer os.Unsetenv("SSM_AGENT_TEST_SECRET")
+	os.Setenv("SSM_AGENT_TEST_SECRET", "value")
+	os.Setenv("TZ", "UTC")
+	defer os.Unsetenv("TZ")
+
+	env := runAsEnvironment(&user.User{Username: "deploy", HomeDir: "/home/deploy"})
+	assert.Equal(t, []string{"PATH=" + runAsPath, "HOME=/home/deploy", "USER=deploy", "LOGNAME=deploy"}, env[:4])
+	assert.Contains(t, env, "TZ=UTC")
+	for _, variable := range env {
+		assert.NotContains(t, variable, "SSM_AGENT_TEST_SECRET")
+	}
+}
+
+func TestSameUser(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Skip("unable to determine the current user", err)
+	}
+	assert.True(t, sameUser("no-such-user-for-ssm-agent", "no-such-user-for-ssm-agent"))
+	assert.True(t, sameUser(current.Uid, current.Username))
+	assert.False(t, sameUser(current.Username, "no-such-user-for-ssm-agent"))
+}
+
+// stubUserGroups gives the users the given supplementary groups.
+func stubUserGroups(groupIDs ...string) func() {
+	original := userGroupIds
+	userGroupIds = func(user *user.User) ([]string, error) { return append([]string{user.Gid}, groupIDs...), nil }
+	return func() { userGroupIds = original }
+}
+
+func TestEffectiveGroups(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Skip("unable to determine the current user", err)
+	}
+	defer stubUserGroups("4242")()
+	groups, err := effectiveGroups(RunAs{User: current.Username, Group: current.Gid})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{current.Gid, "4242"}, groups)
+	groups, err = effectiveGroups(RunAs{User: current.Username})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{current.Gid, "4242"}, groups)
+
+	// the commands without user nor group keep the groups of the agent
+	groups, err = effectiveGroups(RunAs{})
+	assert.Nil(t, err)
+	assert.Equal(t, formatID(uint32(os.Getgid())), groups[0])
+	agentGroups, err := os.Getgroups()
+	assert.Nil(t, err)
+	for _, gid := range agentGroups {
+		assert.Contains(t, groups, formatID(uint32(gid)))
+	}
+
+	_, err = effectiveGroups(RunAs{User: "no-such-user-for-ssm-agent"})
+	assert.NotNil(t, err)
+
+	group, err := user.LookupGroupId(current.Gid)
+	if err != nil {
+		t.Skip("unable to determine the current group", err)
+	}
+	assert.True(t, sameGroup(current.Gid, group.Name))
+	assert.False(t, sameGroup(group.Name, "no-such-group-for-ssm-agent"))
+}
+
+// TestCheckRunAsPolicySupplementaryGroups tests that the supplementary groups of the user are checked.
+func TestCheckRunAsPolicySupplementaryGroups(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Skip("unable to determine the current user", err)
+	}
+	defer stubUserGroups("4242")()
+	defer stubRunAsPolicy(appconfig.RunAsCfg{DeniedGroups: []string{"4242"}})()
+	assert.NotNil(t, checkRunAsPolicy(RunAs{User: current.Username}))
+	assert.NotNil(t, checkRunAsPolicy(RunAs{User: current.Username, Group: current.Gid}))
+	// the supplementary groups of the agent are dropped when only the group changes
+	assert.Nil(t, checkRunAsPolicy(RunAs{Group: current.Gid}))
+
+	// every group must be allowed
+	defer stubRunAsPolicy(appconfig.RunAsCfg{AllowedGroups: []string{current.Gid}})()
+	assert.NotNil(t, checkRunAsPolicy(RunAs{User: current.Username}))
+	defer stubRunAsPolicy(appconfig.RunAsCfg{AllowedGroups: []string{current.Gid, "4242"}})()
+	assert.Nil(t, checkRunAsPolicy(RunAs{User: current.Username}))
+}
+
+// formatID formats a user or group id like os/user does.
+func formatID(id uint32) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
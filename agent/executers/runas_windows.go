@@ -0,0 +1,475 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build windows
+
+package executers
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	// wtsCurrentServerHandle designates the local server in the WTS functions
+	wtsCurrentServerHandle = 0
+
+	// wtsActive is the state of a session connected to the console or a remote desktop client
+	wtsActive = 0
+
+	// wtsUserName and wtsDomainName are the WTS_INFO_CLASS values of the user logged on a session
+	wtsUserName   = 5
+	wtsDomainName = 7
+
+	// interactiveDesktop is the desktop of the session of the logged-on user
+	interactiveDesktop = `winsta0\default`
+
+	// createUnicodeEnvironment is CREATE_UNICODE_ENVIRONMENT, the environment block is UTF-16
+	createUnicodeEnvironment = 0x00000400
+)
+
+var (
+	// errRunAsNotSupported is returned when a command is asked to run as another user outside of the session of the user.
+	errRunAsNotSupported = fmt.Errorf("running commands as another user is only supported in the session of a logged-on user on windows")
+
+	wtsapi32                       = windows.NewLazyDLL(filepath.Join(os.Getenv("SystemRoot"), "System32", "wtsapi32.dll"))
+	procWTSEnumerateSessions       = wtsapi32.NewProc("WTSEnumerateSessionsW")
+	procWTSQuerySessionInformation = wtsapi32.NewProc("WTSQuerySessionInformationW")
+	procWTSQueryUserToken          = wtsapi32.NewProc("WTSQueryUserToken")
+	procWTSFreeMemory              = wtsapi32.NewProc("WTSFreeMemory")
+
+	userenv                     = windows.NewLazyDLL(filepath.Join(os.Getenv("SystemRoot"), "System32", "userenv.dll"))
+	procCreateEnvironmentBlock  = userenv.NewProc("CreateEnvironmentBlock")
+	procDestroyEnvironmentBlock = userenv.NewProc("DestroyEnvironmentBlock")
+)
+
+// wtsSessionInfo is the WTS_SESSION_INFOW structure.
+type wtsSessionInfo struct {
+	sessionID      uint32
+	winStationName *uint16
+	state          uint32
+}
+
+// ValidateRunAs checks that the user of runAs is logged on, when the command runs in the session of the user.
+func ValidateRunAs(runAs RunAs) error {
+	if runAs.IsEmpty() && !runAs.UserSession {
+		return nil
+	}
+	if err := checkRunAsPolicy(runAs); err != nil {
+		return err
+	}
+	if err := checkUserSession(runAs); err != nil {
+		return err
+	}
+	token, err := userSessionToken(runAs.User)
+	if err != nil {
+		return err
+	}
+	return token.Close()
+}
+
+// ChownToRunAs grants the user of runAs read and execute access to the files, so that the command can read them.
+// The owner of the files stays the agent.
+func ChownToRunAs(runAs RunAs, paths ...string) error {
+	if runAs.IsEmpty() && !runAs.UserSession {
+		return nil
+	}
+	if err := checkUserSession(runAs); err != nil {
+		return err
+	}
+	for _, path := range paths {
+		permission := runAs.User + ":(RX)"
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			permission = runAs.User + ":(OI)(CI)(RX)"
+		}
+		if output, err := exec.Command("icacls", path, "/grant", permission).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to grant %v access to %v: %v %v", runAs.User, path, err, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
+
+// setRunAs makes the command run with the token of the session of the user of runAs, the process gets the environment
+// and the registry hive of the user, and runs on the desktop of the session of the user instead of the session of
+// the agent, see startAsUser. The agent must run as LocalSystem to query the token of another session.
+func setRunAs(command *exec.Cmd, runAs RunAs) error {
+	if runAs.IsEmpty() && !runAs.UserSession {
+		return nil
+	}
+	if err := checkUserSession(runAs); err != nil {
+		return err
+	}
+	token, err := userSessionToken(runAs.User)
+	if err != nil {
+		return err
+	}
+	env, err := userEnvironment(token)
+	if err != nil {
+		token.Close()
+		return fmt.Errorf("unable to build the environment of user %v: %v", runAs.User, err)
+	}
+
+	if command.SysProcAttr == nil {
+		command.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	command.SysProcAttr.Token = token
+	command.Env = env
+	return nil
+}
+
+// userEnvironment returns the environment a logon gives the user of the token: the variables of the system and
+// of the profile of the user. The variables of the agent are not handed over.
+func userEnvironment(token syscall.Token) (env []string, err error) {
+	var block *uint16
+	if r, _, e := procCreateEnvironmentBlock.Call(uintptr(unsafe.Pointer(&block)), uintptr(token), 0); r == 0 {
+		return nil, e
+	}
+	defer procDestroyEnvironmentBlock.Call(uintptr(unsafe.Pointer(block)))
+
+	// the block is a sequence of NUL terminated variables, ended by an empty variable
+	chars := (*[1 << 24]uint16)(unsafe.Pointer(block))
+	for start, i := 0, 0; ; i++ {
+		if chars[i] != 0 {
+			continue
+		}
+		if i == start {
+			break
+		}
+		env = append(env, syscall.UTF16ToString(chars[start:i]))
+		start = i + 1
+	}
+	return env, nil
+}
+
+// startAsUser starts the command with the token of its SysProcAttr on the interactive desktop of the session of
+// the token. os/exec starts the process on the desktop of the agent, which a process of another session cannot open.
+// The output of the process is copied to the writers of the command, the returned function waits for the process
+// and the copies.
+func startAsUser(command *exec.Cmd) (wait func() error, err error) {
+	commandLine := command.SysProcAttr.CmdLine
+	if commandLine == "" {
+		arguments := make([]string, len(command.Args))
+		for i, argument := range command.Args {
+			arguments[i] = syscall.EscapeArg(argument)
+		}
+		commandLine = strings.Join(arguments, " ")
+	}
+	applicationName, err := syscall.UTF16PtrFromString(command.Path)
+	if err != nil {
+		return
+	}
+	commandLinePtr, err := syscall.UTF16PtrFromString(commandLine)
+	if err != nil {
+		return
+	}
+	desktop, err := syscall.UTF16PtrFromString(interactiveDesktop)
+	if err != nil {
+		return
+	}
+	var directory *uint16
+	if command.Dir != "" {
+		if directory, err = syscall.UTF16PtrFromString(command.Dir); err != nil {
+			return
+		}
+	}
+	env, err := environmentBlock(command.Env)
+	if err != nil {
+		return
+	}
+
+	stdin, err := os.Open(os.DevNull)
+	if err != nil {
+		return
+	}
+	defer stdin.Close()
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return
+	}
+	defer stdoutWriter.Close()
+	stderrReader, stderrWriter, err := os.Pipe()
+	if err != nil {
+		stdoutReader.Close()
+		return
+	}
+	defer stderrWriter.Close()
+	defer func() {
+		if err != nil {
+			stdoutReader.Close()
+			stderrReader.Close()
+		}
+	}()
+
+	var info syscall.ProcessInformation
+	if err = createProcessAsUser(command, applicationName, commandLinePtr, env, directory, desktop,
+		[]*os.File{stdin, stdoutWriter, stderrWriter}, &info); err != nil {
+		return
+	}
+	defer syscall.CloseHandle(info.Thread)
+	defer syscall.CloseHandle(info.Process)
+	process, err := os.FindProcess(int(info.ProcessId))
+	if err != nil {
+		return
+	}
+	command.Process = process
+
+	var copies sync.WaitGroup
+	copyErrors := make([]error, 2)
+	for i, output := range []struct {
+		writer io.Writer
+		reader *os.File
+	}{{command.Stdout, stdoutReader}, {command.Stderr, stderrReader}} {
+		if output.writer == nil {
+			output.writer = ioutil.Discard
+		}
+		copies.Add(1)
+		go func(i int, writer io.Writer, reader *os.File) {
+			defer copies.Done()
+			defer reader.Close()
+			_, copyErrors[i] = io.Copy(writer, reader)
+		}(i, output.writer, output.reader)
+	}
+
+	return func() error {
+		state, err := process.Wait()
+		copies.Wait()
+		if err != nil {
+			return err
+		}
+		command.ProcessState = state
+		if !state.Success() {
+			return &exec.ExitError{ProcessState: state}
+		}
+		for _, err := range copyErrors {
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
+
+// createProcessAsUser creates the process of the command with inheritable duplicates of the standard handles.
+// The fork lock keeps the processes started meanwhile from inheriting the duplicates.
+func createProcessAsUser(command *exec.Cmd, applicationName *uint16, commandLine *uint16, env []uint16, directory *uint16, desktop *uint16, files []*os.File, info *syscall.ProcessInformation) error {
+	syscall.ForkLock.Lock()
+	defer syscall.ForkLock.Unlock()
+
+	currentProcess, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return err
+	}
+	handles := make([]syscall.Handle, len(files))
+	for i, file := range files {
+		if err = syscall.DuplicateHandle(currentProcess, syscall.Handle(file.Fd()), currentProcess, &handles[i], 0, true, syscall.DUPLICATE_SAME_ACCESS); err != nil {
+			break
+		}
+		defer syscall.CloseHandle(handles[i])
+	}
+	if err != nil {
+		return err
+	}
+
+	startupInfo := &syscall.StartupInfo{
+		Desktop:   desktop,
+		Flags:     syscall.STARTF_USESTDHANDLES,
+		StdInput:  handles[0],
+		StdOutput: handles[1],
+		StdErr:    handles[2],
+	}
+	startupInfo.Cb = uint32(unsafe.Sizeof(*startupInfo))
+	return syscall.CreateProcessAsUser(command.SysProcAttr.Token, applicationName, commandLine, nil, nil, true,
+		command.SysProcAttr.CreationFlags|createUnicodeEnvironment, &env[0], directory, startupInfo, info)
+}
+
+// environmentBlock returns the UTF-16 environment block of the variables, the last value of a variable set
+// several times wins, the names of the variables are case insensitive.
+func environmentBlock(env []string) ([]uint16, error) {
+	index := map[string]int{}
+	var variables []string
+	for _, variable := range env {
+		if variable == "" {
+			continue
+		}
+		name := variable
+		// the names of the variables of the current directories of the drives start with =
+		if i := strings.Index(variable[1:], "="); i >= 0 {
+			name = variable[:i+1]
+		}
+		name = strings.ToUpper(name)
+		if i, ok := index[name]; ok {
+			variables[i] = variable
+			continue
+		}
+		index[name] = len(variables)
+		variables = append(variables, variable)
+	}
+
+	var block []uint16
+	for _, variable := range variables {
+		chars, err := syscall.UTF16FromString(variable)
+		if err != nil {
+			return nil, err
+		}
+		block = append(block, chars...)
+	}
+	if len(block) == 0 {
+		block = append(block, 0)
+	}
+	return append(block, 0), nil
+}
+
+// releaseRunAs closes the token of the session the command ran in.
+func releaseRunAs(command *exec.Cmd) {
+	if command.SysProcAttr != nil && command.SysProcAttr.Token != 0 {
+		command.SysProcAttr.Token.Close()
+	}
+}
+
+// checkUserSession returns an error unless the command runs in the session of a user, without a group.
+func checkUserSession(runAs RunAs) error {
+	if !runAs.UserSession {
+		return errRunAsNotSupported
+	}
+	if strings.TrimSpace(runAs.User) == "" {
+		return fmt.Errorf("the user of the session to run the commands in is not set")
+	}
+	if strings.TrimSpace(runAs.Group) != "" {
+		return fmt.Errorf("running commands as another group is not supported on windows")
+	}
+	return nil
+}
+
+// userSessionToken returns the primary token of the session the user is logged on, an active session is preferred
+// to a disconnected one.
+func userSessionToken(user string) (token syscall.Token, err error) {
+	if err = wtsapi32.Load(); err != nil {
+		return token, fmt.Errorf("the sessions of the users are not available: %v", err)
+	}
+
+	var sessions *wtsSessionInfo
+	var count uint32
+	if r, _, e := procWTSEnumerateSessions.Call(wtsCurrentServerHandle, 0, 1, uintptr(unsafe.Pointer(&sessions)), uintptr(unsafe.Pointer(&count))); r == 0 {
+		return token, fmt.Errorf("unable to list the sessions: %v", e)
+	}
+	defer procWTSFreeMemory.Call(uintptr(unsafe.Pointer(sessions)))
+
+	found := false
+	var sessionID uint32
+	for _, session := range (*[1 << 16]wtsSessionInfo)(unsafe.Pointer(sessions))[:count:count] {
+		domain, name := sessionInformation(session.sessionID, wtsDomainName), sessionInformation(session.sessionID, wtsUserName)
+		if !sessionUserMatches(user, domain, name) {
+			continue
+		}
+		if !found || session.state == wtsActive {
+			found, sessionID = true, session.sessionID
+		}
+	}
+	if !found {
+		return token, fmt.Errorf("user %v is not logged on", user)
+	}
+
+	if r, _, e := procWTSQueryUserToken.Call(uintptr(sessionID), uintptr(unsafe.Pointer(&token))); r == 0 {
+		return token, fmt.Errorf("unable to get the token of the session of user %v: %v", user, e)
+	}
+	return token, nil
+}
+
+// sessionInformation returns the user or domain name of a session, empty when the session is not logged on.
+func sessionInformation(sessionID uint32, infoClass uint32) string {
+	var buffer *uint16
+	var length uint32
+	if r, _, _ := procWTSQuerySessionInformation.Call(wtsCurrentServerHandle, uintptr(sessionID), uintptr(infoClass), uintptr(unsafe.Pointer(&buffer)), uintptr(unsafe.Pointer(&length))); r == 0 {
+		return ""
+	}
+	defer procWTSFreeMemory.Call(uintptr(unsafe.Pointer(buffer)))
+	return syscall.UTF16ToString((*[1 << 16]uint16)(unsafe.Pointer(buffer))[:length/2])
+}
+
+// sessionUserMatches returns true if user, with or without its domain, is the user logged on a session.
+func sessionUserMatches(user string, domain string, name string) bool {
+	if name == "" {
+		return false
+	}
+	if i := strings.Index(user, `\`); i >= 0 {
+		return strings.EqualFold(user[:i], domain) && strings.EqualFold(user[i+1:], name)
+	}
+	return strings.EqualFold(user, name)
+}
+
+// sameUser returns true if the names designate the same user, a name without domain matches the user of any domain.
+func sameUser(name string, other string) bool {
+	if strings.Contains(name, `\`) && strings.Contains(other, `\`) {
+		return strings.EqualFold(name, other)
+	}
+	return strings.EqualFold(userName(name), userName(other))
+}
+
+// allowedUser returns true if the entry of an allow list designates the user. An entry with a domain only allows
+// the user of that domain, named with the domain.
+func allowedUser(name string, entry string) bool {
+	if strings.Contains(entry, `\`) {
+		return strings.EqualFold(name, entry)
+	}
+	return strings.EqualFold(userName(name), entry)
+}
+
+// effectiveGroups returns the names of the groups of the process of the command: the group of runAs and the local
+// groups of its user, or of the user of the agent, since the commands keep the groups of their user on windows.
+func effectiveGroups(runAs RunAs) (groups []string, err error) {
+	if groupName := strings.TrimSpace(runAs.Group); groupName != "" {
+		groups = append(groups, groupName)
+	}
+	var account *user.User
+	if userName := strings.TrimSpace(runAs.User); userName != "" {
+		account, err = user.Lookup(userName)
+	} else {
+		account, err = user.Current()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to find the user of the command: %v", err)
+	}
+	groupIDs, err := account.GroupIds()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the groups of user %v: %v", account.Username, err)
+	}
+	for _, groupID := range groupIDs {
+		group, err := user.LookupGroupId(groupID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to find the group %v of user %v: %v", groupID, account.Username, err)
+		}
+		groups = append(groups, group.Name)
+	}
+	return groups, nil
+}
+
+// sameGroup returns true if the names designate the same group.
+func sameGroup(name string, other string) bool {
+	return strings.EqualFold(name, other)
+}
+
+// userName returns the name of a user without its domain.
+func userName(user string) string {
+	return user[strings.LastIndex(user, `\`)+1:]
+}
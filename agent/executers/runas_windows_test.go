@@ -0,0 +1,69 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build windows
+
+package executers
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionUserMatches(t *testing.T) {
+	assert.True(t, sessionUserMatches("Administrator", "EC2AMAZ", "administrator"))
+	assert.True(t, sessionUserMatches(`ec2amaz\Administrator`, "EC2AMAZ", "Administrator"))
+	assert.False(t, sessionUserMatches(`CORP\Administrator`, "EC2AMAZ", "Administrator"))
+	assert.False(t, sessionUserMatches("Administrator", "", ""))
+	assert.Equal(t, "Administrator", userName(`CORP\Administrator`))
+	assert.Equal(t, "Administrator", userName("Administrator"))
+}
+
+func TestSameUser(t *testing.T) {
+	assert.True(t, sameUser("Administrator", "administrator"))
+	assert.True(t, sameUser(`CORP\Administrator`, "Administrator"))
+	assert.True(t, sameUser(`corp\administrator`, `CORP\Administrator`))
+	assert.False(t, sameUser(`EC2AMAZ\Administrator`, `CORP\Administrator`))
+}
+
+func TestAllowedUser(t *testing.T) {
+	assert.True(t, allowedUser(`CORP\Administrator`, "administrator"))
+	assert.True(t, allowedUser(`corp\administrator`, `CORP\Administrator`))
+	assert.False(t, allowedUser("Administrator", `CORP\Administrator`))
+	assert.False(t, allowedUser(`EC2AMAZ\Administrator`, `CORP\Administrator`))
+}
+
+func TestCheckUserSession(t *testing.T) {
+	assert.Equal(t, errRunAsNotSupported, checkUserSession(RunAs{User: "Administrator"}))
+	assert.NotNil(t, checkUserSession(RunAs{UserSession: true}))
+	assert.NotNil(t, checkUserSession(RunAs{User: "Administrator", Group: "Users", UserSession: true}))
+	assert.Nil(t, checkUserSession(RunAs{User: "Administrator", UserSession: true}))
+	assert.Nil(t, ValidateRunAs(RunAs{}))
+}
+
+func TestEnvironmentBlock(t *testing.T) {
+	block, err := environmentBlock([]string{"Path=C:\\Windows", "=C:=C:\\", "TEMP=C:\\Temp", "PATH=C:\\Tools"})
+	assert.Nil(t, err)
+	expected := []uint16{}
+	for _, variable := range []string{"PATH=C:\\Tools", "=C:=C:\\", "TEMP=C:\\Temp"} {
+		chars, _ := syscall.UTF16FromString(variable)
+		expected = append(expected, chars...)
+	}
+	assert.Equal(t, append(expected, 0), block)
+
+	block, err = environmentBlock(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint16{0, 0}, block)
+}
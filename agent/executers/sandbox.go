@@ -0,0 +1,49 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package executers contains general purpose (shell) command executing objects.
+// sandbox contains the validation of the resource limits enclosing the processes started by a step.
+package executers
+
+import (
+	"fmt"
+)
+
+const (
+	// minCPUShares and maxCPUShares are the bounds of the cpu shares of a cgroup
+	minCPUShares = 2
+	maxCPUShares = 262144
+
+	// defaultCPUShares is the weight of the processes which are not limited
+	defaultCPUShares = 1024
+
+	minNiceness = -20
+	maxNiceness = 19
+)
+
+// ValidateResourceLimits checks that the resource limits are in the ranges supported by the platforms.
+func ValidateResourceLimits(limits ResourceLimits) error {
+	if limits.CPUShares != 0 && (limits.CPUShares < minCPUShares || limits.CPUShares > maxCPUShares) {
+		return fmt.Errorf("cpu shares %v are not between %v and %v", limits.CPUShares, minCPUShares, maxCPUShares)
+	}
+	if limits.MemoryLimitMB < 0 {
+		return fmt.Errorf("invalid memory limit %vMB", limits.MemoryLimitMB)
+	}
+	if limits.MaxProcesses < 0 {
+		return fmt.Errorf("invalid maximum number of processes %v", limits.MaxProcesses)
+	}
+	if limits.Niceness < minNiceness || limits.Niceness > maxNiceness {
+		return fmt.Errorf("niceness %v is not between %v and %v", limits.Niceness, minNiceness, maxNiceness)
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build linux
+
+package executers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+)
+
+const (
+	// cgroupParent names the systemd slice and scopes the commands run in, see transientScope
+	cgroupParent = "amazon-ssm-agent"
+
+	// agentGroupName is the leaf group the agent moves its processes into, in the group systemd delegates to the agent:
+	// a group of the unified hierarchy cannot both hold processes and distribute resources to its children
+	agentGroupName = "agent"
+
+	// commandGroupPrefix is the prefix of the names of the groups of the commands
+	commandGroupPrefix = "command"
+
+	// cgroupProcs is the file of a control group which processes are moved into the group with
+	cgroupProcs = "cgroup.procs"
+
+	defaultCPUWeight = 100
+	maxCPUWeight     = 10000
+
+	// staleGroupAge is the age after which the group of a previous command is deleted once its processes have exited
+	staleGroupAge = 10 * time.Minute
+)
+
+var (
+	// cgroupRoot is where the control group hierarchies are mounted
+	cgroupRoot = "/sys/fs/cgroup"
+
+	// selfCgroupFile lists the control groups of the agent process
+	selfCgroupFile = "/proc/self/cgroup"
+)
+
+// cgroupSetting is a value written to a file of a controller.
+type cgroupSetting struct {
+	controller string
+	file       string
+	value      string
+}
+
+// createGroups creates the control groups of a command, in the unified hierarchy (cgroup v2) when it is mounted,
+// or in the hierarchies of the controllers otherwise (cgroup v1).
+func createGroups(limits ResourceLimits) ([]string, error) {
+	if limits.CPUShares == 0 && limits.MemoryLimitMB == 0 && limits.MaxProcesses == 0 {
+		return nil, nil
+	}
+	if fileutil.Exists(filepath.Join(cgroupRoot, "cgroup.controllers")) {
+		return createUnifiedGroup(limits)
+	}
+	return createLegacyGroups(limits)
+}
+
+// createUnifiedGroup creates the group of the command in the unified hierarchy, under the group of the agent which
+// systemd delegates to it (Delegate=yes in the unit), after enabling the controllers it needs for the children.
+func createUnifiedGroup(limits ResourceLimits) (groups []string, err error) {
+	var settings []cgroupSetting
+	if limits.CPUShares != 0 {
+		settings = append(settings, cgroupSetting{"cpu", "cpu.weight", strconv.Itoa(cpuWeight(limits.CPUShares))})
+	}
+	if limits.MemoryLimitMB != 0 {
+		settings = append(settings, cgroupSetting{"memory", "memory.max", memoryLimitBytes(limits.MemoryLimitMB)})
+	}
+	if limits.MaxProcesses != 0 {
+		settings = append(settings, cgroupSetting{"pids", "pids.max", strconv.Itoa(limits.MaxProcesses)})
+	}
+
+	var controllers []string
+	for _, setting := range settings {
+		controllers = append(controllers, "+"+setting.controller)
+	}
+	parent, err := delegatedGroup()
+	if err != nil {
+		return
+	}
+	removeStaleGroups(parent)
+	if err = writeCgroupFile(filepath.Join(parent, "cgroup.subtree_control"), strings.Join(controllers, " ")); err != nil {
+		return nil, fmt.Errorf("failed to enable the controllers in %v, the unit of the agent must delegate its group: %v", parent, err)
+	}
+
+	group, err := ioutil.TempDir(parent, commandGroupPrefix)
+	if err != nil {
+		return
+	}
+	for _, setting := range settings {
+		if err = writeCgroupFile(filepath.Join(group, setting.file), setting.value); err != nil {
+			os.Remove(group)
+			return nil, err
+		}
+	}
+	return []string{group}, nil
+}
+
+// createLegacyGroups creates a group with the same name in the hierarchy of each controller the limits need,
+// under the group of the agent in the hierarchy.
+func createLegacyGroups(limits ResourceLimits) (groups []string, err error) {
+	var settings []cgroupSetting
+	if limits.CPUShares != 0 {
+		settings = append(settings, cgroupSetting{"cpu", "cpu.shares", strconv.Itoa(limits.CPUShares)})
+	}
+	if limits.MemoryLimitMB != 0 {
+		settings = append(settings, cgroupSetting{"memory", "memory.limit_in_bytes", memoryLimitBytes(limits.MemoryLimitMB)})
+	}
+	if limits.MaxProcesses != 0 {
+		settings = append(settings, cgroupSetting{"pids", "pids.max", strconv.Itoa(limits.MaxProcesses)})
+	}
+
+	var name string
+	for _, setting := range settings {
+		var path string
+		if path, err = agentGroup(setting.controller); err != nil {
+			break
+		}
+		parent := filepath.Join(cgroupRoot, setting.controller, path)
+		removeStaleGroups(parent)
+		var group string
+		if name == "" {
+			if group, err = ioutil.TempDir(parent, commandGroupPrefix); err != nil {
+				break
+			}
+			name = filepath.Base(group)
+		} else {
+			group = filepath.Join(parent, name)
+			if err = os.Mkdir(group, appconfig.ReadWriteExecuteAccess); err != nil {
+				break
+			}
+		}
+		groups = append(groups, group)
+		if err = writeCgroupFile(filepath.Join(group, setting.file), setting.value); err != nil {
+			break
+		}
+	}
+	if err != nil {
+		for _, group := range groups {
+			os.Remove(group)
+		}
+		return nil, fmt.Errorf("failed to create the control groups: %v", err)
+	}
+	return
+}
+
+// delegatedGroup returns the group of the agent in the unified hierarchy, once the processes it holds are moved into
+// its leaf group so that the controllers can be enabled for its children. The root group may hold processes, the
+// groups of the commands are created in it when the agent does not run in a group of its own.
+func delegatedGroup() (group string, err error) {
+	path, err := agentGroup("")
+	if err != nil {
+		return
+	}
+	if filepath.Base(path) == agentGroupName {
+		path = filepath.Dir(path)
+	}
+	group = filepath.Join(cgroupRoot, path)
+	if group == filepath.Clean(cgroupRoot) {
+		return
+	}
+	leaf := filepath.Join(group, agentGroupName)
+	if err = os.MkdirAll(leaf, appconfig.ReadWriteExecuteAccess); err != nil {
+		return
+	}
+	content, err := ioutil.ReadFile(filepath.Join(group, cgroupProcs))
+	if err != nil {
+		return
+	}
+	for _, pid := range strings.Fields(string(content)) {
+		// a process which has exited meanwhile cannot be moved
+		if err = writeCgroupFile(filepath.Join(leaf, cgroupProcs), pid); err != nil && !isNoSuchProcess(err) {
+			return "", fmt.Errorf("failed to move the process %v into %v: %v", pid, leaf, err)
+		}
+	}
+	return group, nil
+}
+
+// agentGroup returns the path of the group of the agent in the hierarchy of a controller,
+// or in the unified hierarchy when the controller is empty.
+func agentGroup(controller string) (string, error) {
+	content, err := ioutil.ReadFile(selfCgroupFile)
+	if err != nil {
+		return "", err
+	}
+	// each line is hierarchy-ID:controller-list:path, the controller list of the unified hierarchy is empty
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if controller == "" && fields[0] == "0" && fields[1] == "" {
+			return fields[2], nil
+		}
+		for _, name := range strings.Split(fields[1], ",") {
+			if controller != "" && name == controller {
+				return fields[2], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("the agent is in no control group of the %v hierarchy", controllerName(controller))
+}
+
+// controllerName names the hierarchy of a controller in the errors.
+func controllerName(controller string) string {
+	if controller == "" {
+		return "unified"
+	}
+	return controller
+}
+
+// isNoSuchProcess reports whether moving a process failed because it has exited.
+func isNoSuchProcess(err error) bool {
+	if pathErr, ok := err.(*os.PathError); ok {
+		return pathErr.Err == syscall.ESRCH
+	}
+	return false
+}
+
+// removeStaleGroups deletes the groups of previous commands which were kept by processes outliving the commands.
+// Deleting a group fails while it holds processes, the groups of the commands starting now are too recent to be deleted.
+func removeStaleGroups(parent string) {
+	entries, err := ioutil.ReadDir(parent)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), commandGroupPrefix) && time.Since(entry.ModTime()) > staleGroupAge {
+			os.Remove(filepath.Join(parent, entry.Name()))
+		}
+	}
+}
+
+// addToGroup moves a process into a control group.
+func addToGroup(group string, pid int) error {
+	return writeCgroupFile(filepath.Join(group, cgroupProcs), strconv.Itoa(pid))
+}
+
+// writeCgroupFile writes a value to a file of a control group.
+func writeCgroupFile(path string, value string) error {
+	return ioutil.WriteFile(path, []byte(value), appconfig.ReadWriteAccess)
+}
+
+// cpuWeight converts cpu shares to the cpu weight of the unified hierarchy (1 to 10000),
+// the default weight 100 of the other groups corresponds to the default 1024 shares.
+func cpuWeight(shares int) int {
+	weight := shares * defaultCPUWeight / defaultCPUShares
+	if weight < 1 {
+		return 1
+	}
+	if weight > maxCPUWeight {
+		return maxCPUWeight
+	}
+	return weight
+}
+
+// memoryLimitBytes returns the memory limit in bytes.
+func memoryLimitBytes(megabytes int) string {
+	return strconv.FormatInt(int64(megabytes)*1024*1024, 10)
+}
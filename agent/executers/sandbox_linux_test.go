@@ -0,0 +1,196 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build linux
+
+package executers
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// agentService is the group systemd runs the agent in, in the tests
+const agentService = "system.slice/amazon-ssm-agent.service"
+
+// withCgroupRoot runs the test with the control groups created in a temporary directory,
+// the agent being in the group of its service in every hierarchy.
+func withCgroupRoot(t *testing.T, test func(root string)) {
+	defer func(original string) { cgroupRoot = original }(cgroupRoot)
+	defer func(original string) { selfCgroupFile = original }(selfCgroupFile)
+	root, err := ioutil.TempDir("", "cgroup")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+	cgroupRoot = root
+	selfCgroupFile = filepath.Join(root, "self")
+	writeSelfCgroup(t, "12:pids:/"+agentService+"\n4:cpu,cpuacct:/"+agentService+"\n0::/"+agentService+"\n")
+	for _, dir := range []string{agentService, filepath.Join("cpu", agentService), filepath.Join("pids", agentService)} {
+		assert.Nil(t, os.MkdirAll(filepath.Join(root, dir), 0700))
+	}
+	test(root)
+}
+
+func writeSelfCgroup(t *testing.T, content string) {
+	assert.Nil(t, ioutil.WriteFile(selfCgroupFile, []byte(content), 0600))
+}
+
+func readCgroupFile(t *testing.T, path string) string {
+	content, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	return string(content)
+}
+
+func TestUnifiedSandbox(t *testing.T) {
+	withCgroupRoot(t, func(root string) {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(root, "cgroup.controllers"), []byte("cpu memory pids"), 0600))
+		service := filepath.Join(root, agentService)
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(service, cgroupProcs), []byte("1234\n"), 0600))
+
+		s, err := newSandbox(ResourceLimits{CPUShares: 512, MemoryLimitMB: 64, MaxProcesses: 20})
+		assert.Nil(t, err)
+		assert.Len(t, s.groups, 1)
+		group := s.groups[0]
+		// the group is created under the group systemd delegates to the agent, which moved into its leaf group
+		assert.Equal(t, service, filepath.Dir(group))
+		assert.Equal(t, "1234", readCgroupFile(t, filepath.Join(service, agentGroupName, cgroupProcs)))
+		assert.Equal(t, "+cpu +memory +pids", readCgroupFile(t, filepath.Join(service, "cgroup.subtree_control")))
+		assert.False(t, fileutil.Exists(filepath.Join(root, "cgroup.subtree_control")))
+		assert.Equal(t, "50", readCgroupFile(t, filepath.Join(group, "cpu.weight")))
+		assert.Equal(t, "67108864", readCgroupFile(t, filepath.Join(group, "memory.max")))
+		assert.Equal(t, "20", readCgroupFile(t, filepath.Join(group, "pids.max")))
+
+		assert.Nil(t, s.add(&os.Process{Pid: 4242}))
+		assert.Equal(t, "4242", readCgroupFile(t, filepath.Join(group, cgroupProcs)))
+	})
+}
+
+func TestUnifiedSandboxFromAgentLeafGroup(t *testing.T) {
+	withCgroupRoot(t, func(root string) {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(root, "cgroup.controllers"), []byte("cpu memory pids"), 0600))
+		writeSelfCgroup(t, "0::/"+agentService+"/"+agentGroupName+"\n")
+		service := filepath.Join(root, agentService)
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(service, cgroupProcs), nil, 0600))
+
+		s, err := newSandbox(ResourceLimits{MaxProcesses: 20})
+		assert.Nil(t, err)
+		assert.Equal(t, service, filepath.Dir(s.groups[0]))
+		assert.Equal(t, "+pids", readCgroupFile(t, filepath.Join(service, "cgroup.subtree_control")))
+	})
+}
+
+func TestUnifiedSandboxWithoutAgentGroup(t *testing.T) {
+	withCgroupRoot(t, func(root string) {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(root, "cgroup.controllers"), []byte("cpu memory pids"), 0600))
+		writeSelfCgroup(t, "12:pids:/"+agentService+"\n")
+
+		_, err := newSandbox(ResourceLimits{MaxProcesses: 20})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestLegacySandbox(t *testing.T) {
+	withCgroupRoot(t, func(root string) {
+		s, err := newSandbox(ResourceLimits{CPUShares: 512, MaxProcesses: 20})
+		assert.Nil(t, err)
+		assert.Len(t, s.groups, 2)
+		name := filepath.Base(s.groups[0])
+		assert.Equal(t, filepath.Join(root, "cpu", agentService, name), s.groups[0])
+		assert.Equal(t, filepath.Join(root, "pids", agentService, name), s.groups[1])
+		assert.Equal(t, "512", readCgroupFile(t, filepath.Join(s.groups[0], "cpu.shares")))
+		assert.Equal(t, "20", readCgroupFile(t, filepath.Join(s.groups[1], "pids.max")))
+	})
+}
+
+func TestSandboxWithoutGroups(t *testing.T) {
+	withCgroupRoot(t, func(root string) {
+		s, err := newSandbox(ResourceLimits{})
+		assert.Nil(t, err)
+		assert.Nil(t, s)
+		assert.Nil(t, s.add(&os.Process{Pid: 4242}))
+
+		s, err = newSandbox(ResourceLimits{Niceness: 5})
+		assert.Nil(t, err)
+		assert.Empty(t, s.groups)
+
+		_, err = newSandbox(ResourceLimits{MemoryLimitMB: -1})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestSandboxGate(t *testing.T) {
+	withCgroupRoot(t, func(root string) {
+		// the command executes once its process is enclosed, with the niceness of the sandbox
+		s, err := newSandbox(ResourceLimits{Niceness: 5})
+		assert.Nil(t, err)
+		var out bytes.Buffer
+		command := exec.Command("cut", "-d", " ", "-f", "19", "/proc/self/stat")
+		command.Stdout = &out
+		assert.Nil(t, s.wrap(command))
+		assert.Nil(t, command.Start())
+		assert.Nil(t, s.add(command.Process))
+		assert.Nil(t, command.Wait())
+		assert.Equal(t, "5\n", out.String())
+		s.close(log.NewMockLog())
+
+		// the command does not execute when the gate is closed
+		marker := filepath.Join(root, "executed")
+		s, err = newSandbox(ResourceLimits{Niceness: 5})
+		assert.Nil(t, err)
+		command = exec.Command("touch", marker)
+		assert.Nil(t, s.wrap(command))
+		assert.Nil(t, command.Start())
+		s.close(log.NewMockLog())
+		assert.NotNil(t, command.Wait())
+		assert.Equal(t, gateClosedExitCode, command.ProcessState.ExitCode())
+		_, err = os.Stat(marker)
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestRemoveStaleGroups(t *testing.T) {
+	withCgroupRoot(t, func(root string) {
+		parent := filepath.Join(root, "pids", agentService)
+		stale := filepath.Join(parent, "command-stale")
+		recent := filepath.Join(parent, "command-recent")
+		other := filepath.Join(parent, "other")
+		for _, group := range []string{stale, recent, other} {
+			assert.Nil(t, os.MkdirAll(group, 0700))
+		}
+		old := time.Now().Add(-2 * staleGroupAge)
+		assert.Nil(t, os.Chtimes(stale, old, old))
+		assert.Nil(t, os.Chtimes(other, old, old))
+
+		s, err := newSandbox(ResourceLimits{MaxProcesses: 20})
+		assert.Nil(t, err)
+		_, err = os.Stat(stale)
+		assert.True(t, os.IsNotExist(err))
+		assert.True(t, fileutil.Exists(recent))
+		assert.True(t, fileutil.Exists(other))
+		assert.True(t, fileutil.Exists(s.groups[0]))
+	})
+}
+
+func TestCPUWeight(t *testing.T) {
+	assert.Equal(t, 100, cpuWeight(defaultCPUShares))
+	assert.Equal(t, 1, cpuWeight(minCPUShares))
+	assert.Equal(t, maxCPUWeight, cpuWeight(maxCPUShares))
+}
@@ -0,0 +1,34 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build darwin freebsd netbsd openbsd
+
+package executers
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// createGroups returns an error when a limit other than the niceness is set, control groups are specific to Linux.
+func createGroups(limits ResourceLimits) ([]string, error) {
+	if limits.CPUShares != 0 || limits.MemoryLimitMB != 0 || limits.MaxProcesses != 0 {
+		return nil, fmt.Errorf("only the niceness of the processes can be limited on %v", runtime.GOOS)
+	}
+	return nil, nil
+}
+
+// addToGroup is never called, there are no groups on this platform.
+func addToGroup(group string, pid int) error {
+	return fmt.Errorf("control groups are not supported on %v", runtime.GOOS)
+}
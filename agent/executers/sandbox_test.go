@@ -0,0 +1,36 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package executers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateResourceLimits(t *testing.T) {
+	assert.Nil(t, ValidateResourceLimits(ResourceLimits{}))
+	assert.Nil(t, ValidateResourceLimits(ResourceLimits{CPUShares: 512, MemoryLimitMB: 1024, MaxProcesses: 100, Niceness: -5}))
+
+	for _, limits := range []ResourceLimits{
+		{CPUShares: 1},
+		{CPUShares: 262145},
+		{MemoryLimitMB: -1},
+		{MaxProcesses: -1},
+		{Niceness: -21},
+		{Niceness: 20},
+	} {
+		assert.NotNil(t, ValidateResourceLimits(limits), "%v", limits)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build darwin freebsd linux netbsd openbsd
+
+package executers
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+const (
+	// gateShell runs the gate script
+	gateShell = "/bin/sh"
+
+	// gateScript waits until the agent writes to the gate (the file descriptor of the argument), then executes the command
+	// without the gate. The command does not run when the agent closes the gate without writing.
+	gateScript = `read -r gate <&%[1]d || exit %[2]d; exec "$@" %[1]d<&-`
+
+	// gateClosedExitCode is the exit code of the gate when the process could not be enclosed in the sandbox
+	gateClosedExitCode = 125
+)
+
+// sandbox encloses the processes of a command in control groups and sets their niceness.
+type sandbox struct {
+	limits ResourceLimits
+	groups []string
+
+	// gate holds the process of the command until it is enclosed in the sandbox, see wrap
+	gate       *os.File
+	gateReader *os.File
+}
+
+// newSandbox creates the control groups enforcing the limits, nil is returned when there is no limit.
+func newSandbox(limits ResourceLimits) (s *sandbox, err error) {
+	if limits.IsEmpty() {
+		return nil, nil
+	}
+	if err = ValidateResourceLimits(limits); err != nil {
+		return
+	}
+	s = &sandbox{limits: limits}
+	if s.groups, err = createGroups(limits); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// wrap makes the command start through a gate which holds it until add has enclosed its process in the sandbox.
+// The command is only executed afterwards, so that the processes it creates inherit the limits.
+func (s *sandbox) wrap(command *exec.Cmd) (err error) {
+	if s == nil {
+		return nil
+	}
+	if s.gateReader, s.gate, err = os.Pipe(); err != nil {
+		return
+	}
+	fd := 3 + len(command.ExtraFiles)
+	command.ExtraFiles = append(command.ExtraFiles, s.gateReader)
+	script := fmt.Sprintf(gateScript, fd, gateClosedExitCode)
+	command.Args = append([]string{gateShell, "-c", script, "sh", command.Path}, command.Args[1:]...)
+	command.Path = gateShell
+	return nil
+}
+
+// add moves a started process into the control groups and sets its niceness, then opens the gate.
+// The command inherits the niceness of the gate when it executes.
+func (s *sandbox) add(process *os.Process) (err error) {
+	if s == nil {
+		return nil
+	}
+	defer s.closeGate()
+	for _, group := range s.groups {
+		if err = addToGroup(group, process.Pid); err != nil {
+			return
+		}
+	}
+	if s.limits.Niceness != 0 {
+		if err = syscall.Setpriority(syscall.PRIO_PROCESS, process.Pid, s.limits.Niceness); err != nil {
+			return
+		}
+	}
+	if s.gate != nil {
+		_, err = s.gate.Write([]byte("\n"))
+	}
+	return
+}
+
+// closeGate closes both ends of the gate, which stops the command if the gate was not opened.
+func (s *sandbox) closeGate() {
+	for _, file := range []**os.File{&s.gate, &s.gateReader} {
+		if *file != nil {
+			(*file).Close()
+			*file = nil
+		}
+	}
+}
+
+// close deletes the control groups, once the processes of the command have exited.
+// A group still holding processes that outlived the command, such as daemons, is deleted by a later command.
+func (s *sandbox) close(log log.T) {
+	if s == nil {
+		return
+	}
+	s.closeGate()
+	for _, group := range s.groups {
+		if err := os.Remove(group); err != nil {
+			log.Infof("the control group %v is not deleted yet: %v", group, err)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build windows
+
+package executers
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"golang.org/x/sys/windows"
+)
+
+// Job object information classes and flags
+// https://msdn.microsoft.com/en-us/library/windows/desktop/ms686216(v=vs.85).aspx
+const (
+	jobObjectExtendedLimitInformation  = 9
+	jobObjectCPURateControlInformation = 15
+
+	jobObjectLimitActiveProcess = 0x00000008
+	jobObjectLimitPriorityClass = 0x00000020
+	jobObjectLimitJobMemory     = 0x00000200
+
+	jobObjectCPURateControlEnable      = 0x1
+	jobObjectCPURateControlWeightBased = 0x2
+
+	// the weights of the cpu rate control go from 1 to 9, 5 is the weight of the processes outside of jobs
+	defaultCPURateWeight = 5
+	maxCPURateWeight     = 9
+
+	processSetQuota = 0x0100
+
+	createSuspended     = 0x00000004
+	threadSuspendResume = 0x0002
+	th32csSnapThread    = 0x00000004
+
+	highPriorityClass        = 0x00000080
+	aboveNormalPriorityClass = 0x00008000
+	belowNormalPriorityClass = 0x00004000
+	idlePriorityClass        = 0x00000040
+)
+
+var (
+	kernel32                     = windows.NewLazyDLL(filepath.Join(os.Getenv("SystemRoot"), "System32", "kernel32.dll"))
+	procCreateJobObject          = kernel32.NewProc("CreateJobObjectW")
+	procSetInformationJobObject  = kernel32.NewProc("SetInformationJobObject")
+	procAssignProcessToJobObject = kernel32.NewProc("AssignProcessToJobObject")
+	procCreateToolhelp32Snapshot = kernel32.NewProc("CreateToolhelp32Snapshot")
+	procThread32First            = kernel32.NewProc("Thread32First")
+	procThread32Next             = kernel32.NewProc("Thread32Next")
+	procOpenThread               = kernel32.NewProc("OpenThread")
+	procResumeThread             = kernel32.NewProc("ResumeThread")
+)
+
+type threadEntry32 struct {
+	Size           uint32
+	Usage          uint32
+	ThreadID       uint32
+	OwnerProcessID uint32
+	BasePriority   int32
+	DeltaPriority  int32
+	Flags          uint32
+}
+
+type jobObjectBasicLimitInformation struct {
+	PerProcessUserTimeLimit int64
+	PerJobUserTimeLimit     int64
+	LimitFlags              uint32
+	MinimumWorkingSetSize   uintptr
+	MaximumWorkingSetSize   uintptr
+	ActiveProcessLimit      uint32
+	Affinity                uintptr
+	PriorityClass           uint32
+	SchedulingClass         uint32
+}
+
+type ioCounters struct {
+	ReadOperationCount  uint64
+	WriteOperationCount uint64
+	OtherOperationCount uint64
+	ReadTransferCount   uint64
+	WriteTransferCount  uint64
+	OtherTransferCount  uint64
+}
+
+type jobObjectExtendedLimitInformationData struct {
+	BasicLimitInformation jobObjectBasicLimitInformation
+	IoInfo                ioCounters
+	ProcessMemoryLimit    uintptr
+	JobMemoryLimit        uintptr
+	PeakProcessMemoryUsed uintptr
+	PeakJobMemoryUsed     uintptr
+}
+
+type jobObjectCPURateControlInformationData struct {
+	ControlFlags uint32
+	Weight       uint32
+}
+
+// sandbox encloses the processes of a command in a job object.
+type sandbox struct {
+	job syscall.Handle
+}
+
+// newSandbox creates the job object enforcing the limits, nil is returned when there is no limit.
+func newSandbox(limits ResourceLimits) (s *sandbox, err error) {
+	if limits.IsEmpty() {
+		return nil, nil
+	}
+	if err = ValidateResourceLimits(limits); err != nil {
+		return
+	}
+
+	job, _, err := procCreateJobObject.Call(0, 0)
+	if job == 0 {
+		return nil, fmt.Errorf("CreateJobObject failed: %v", err)
+	}
+	s = &sandbox{job: syscall.Handle(job)}
+
+	var extended jobObjectExtendedLimitInformationData
+	if limits.MemoryLimitMB != 0 {
+		extended.BasicLimitInformation.LimitFlags |= jobObjectLimitJobMemory
+		extended.JobMemoryLimit = uintptr(limits.MemoryLimitMB) * 1024 * 1024
+	}
+	if limits.MaxProcesses != 0 {
+		extended.BasicLimitInformation.LimitFlags |= jobObjectLimitActiveProcess
+		extended.BasicLimitInformation.ActiveProcessLimit = uint32(limits.MaxProcesses)
+	}
+	if limits.Niceness != 0 {
+		extended.BasicLimitInformation.LimitFlags |= jobObjectLimitPriorityClass
+		extended.BasicLimitInformation.PriorityClass = priorityClass(limits.Niceness)
+	}
+	if extended.BasicLimitInformation.LimitFlags != 0 {
+		if err = s.setInformation(jobObjectExtendedLimitInformation, unsafe.Pointer(&extended), unsafe.Sizeof(extended)); err != nil {
+			syscall.CloseHandle(s.job)
+			return nil, err
+		}
+	}
+	if limits.CPUShares != 0 {
+		rate := jobObjectCPURateControlInformationData{
+			ControlFlags: jobObjectCPURateControlEnable | jobObjectCPURateControlWeightBased,
+			Weight:       cpuRateWeight(limits.CPUShares),
+		}
+		if err = s.setInformation(jobObjectCPURateControlInformation, unsafe.Pointer(&rate), unsafe.Sizeof(rate)); err != nil {
+			syscall.CloseHandle(s.job)
+			return nil, err
+		}
+	}
+	return
+}
+
+// setInformation sets a class of limits of the job object.
+func (s *sandbox) setInformation(class uintptr, information unsafe.Pointer, size uintptr) error {
+	if ok, _, err := procSetInformationJobObject.Call(uintptr(s.job), class, uintptr(information), size); ok == 0 {
+		return fmt.Errorf("SetInformationJobObject failed: %v", err)
+	}
+	return nil
+}
+
+// wrap makes the command start suspended, its process is resumed by add once it belongs to the job object,
+// so that the processes it creates belong to the job too.
+func (s *sandbox) wrap(command *exec.Cmd) error {
+	if s == nil {
+		return nil
+	}
+	if command.SysProcAttr == nil {
+		command.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	command.SysProcAttr.CreationFlags |= createSuspended
+	return nil
+}
+
+// add assigns a started, suspended, process to the job object and resumes it.
+// The process is left suspended when it cannot be assigned, it is then killed.
+func (s *sandbox) add(process *os.Process) error {
+	if s == nil {
+		return nil
+	}
+	handle, err := syscall.OpenProcess(processSetQuota|syscall.PROCESS_TERMINATE, false, uint32(process.Pid))
+	if err != nil {
+		return err
+	}
+	defer syscall.CloseHandle(handle)
+	if ok, _, err := procAssignProcessToJobObject.Call(uintptr(s.job), uintptr(handle)); ok == 0 {
+		return fmt.Errorf("AssignProcessToJobObject failed: %v", err)
+	}
+	return resumeProcess(uint32(process.Pid))
+}
+
+// resumeProcess resumes the threads of a process started suspended, that is its main thread.
+func resumeProcess(pid uint32) error {
+	snapshot, _, err := procCreateToolhelp32Snapshot.Call(th32csSnapThread, 0)
+	if syscall.Handle(snapshot) == syscall.InvalidHandle {
+		return fmt.Errorf("CreateToolhelp32Snapshot failed: %v", err)
+	}
+	defer syscall.CloseHandle(syscall.Handle(snapshot))
+
+	entry := threadEntry32{}
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	resumed := 0
+	ok, _, err := procThread32First.Call(snapshot, uintptr(unsafe.Pointer(&entry)))
+	for ; ok != 0; ok, _, err = procThread32Next.Call(snapshot, uintptr(unsafe.Pointer(&entry))) {
+		if entry.OwnerProcessID != pid {
+			continue
+		}
+		thread, _, openErr := procOpenThread.Call(threadSuspendResume, 0, uintptr(entry.ThreadID))
+		if thread == 0 {
+			return fmt.Errorf("OpenThread failed: %v", openErr)
+		}
+		previous, _, resumeErr := procResumeThread.Call(thread)
+		syscall.CloseHandle(syscall.Handle(thread))
+		if int32(previous) == -1 {
+			return fmt.Errorf("ResumeThread failed: %v", resumeErr)
+		}
+		resumed++
+	}
+	if resumed == 0 {
+		return fmt.Errorf("no thread of process %v to resume: %v", pid, err)
+	}
+	return nil
+}
+
+// close releases the job object, the limits stay in force for the processes still running.
+func (s *sandbox) close(log log.T) {
+	if s == nil {
+		return
+	}
+	if err := syscall.CloseHandle(s.job); err != nil {
+		log.Warnf("failed to close the job object: %v", err)
+	}
+}
+
+// cpuRateWeight converts cpu shares to the weight of the cpu rate control of the job.
+func cpuRateWeight(shares int) uint32 {
+	weight := shares * defaultCPURateWeight / defaultCPUShares
+	if weight < 1 {
+		return 1
+	}
+	if weight > maxCPURateWeight {
+		return maxCPURateWeight
+	}
+	return uint32(weight)
+}
+
+// priorityClass converts a niceness to the closest priority class.
+func priorityClass(niceness int) uint32 {
+	switch {
+	case niceness <= -10:
+		return highPriorityClass
+	case niceness < 0:
+		return aboveNormalPriorityClass
+	case niceness < 10:
+		return belowNormalPriorityClass
+	default:
+		return idlePriorityClass
+	}
+}
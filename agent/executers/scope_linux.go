@@ -0,0 +1,139 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build linux
+
+package executers
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+const (
+	// systemdRun starts a command in a transient unit, systemctl stops the unit
+	systemdRun = "systemd-run"
+	systemctl  = "systemctl"
+
+	// scopeSlice is the slice grouping the scopes of the commands, for the accounting of the resources of the agent
+	scopeSlice = cgroupParent + ".slice"
+)
+
+var (
+	// systemdRuntimeDir only exists when the host has been booted with systemd, see sd_booted(3)
+	systemdRuntimeDir = "/run/systemd/system"
+
+	lookPath = exec.LookPath
+
+	// systemdScopesEnabled returns whether the agent configuration enables the transient scopes
+	systemdScopesEnabled = func() bool {
+		config, err := appconfig.Config(false)
+		return err == nil && config.Sandbox.SystemdScopes
+	}
+
+	// scopeSequence makes the names of the scopes of the agent unique
+	scopeSequence int32
+)
+
+// transientScope is the transient systemd scope a command runs in.
+// systemd creates the control group of the scope, enforces the limits in it and kills all its processes when it is stopped,
+// including the grandchildren which left the process group of the command.
+type transientScope struct {
+	unit   string
+	limits ResourceLimits
+}
+
+// newTransientScope returns the scope to run a command with the limits in, or nil when the scopes are disabled in the
+// agent configuration or systemd is not available.
+// The scope is not used when the command runs as another user, systemd-run then requires the authorization of polkit.
+func newTransientScope(log log.T, limits ResourceLimits, runAs RunAs) *transientScope {
+	if !runAs.IsEmpty() || !systemdScopesEnabled() {
+		return nil
+	}
+	if !fileutil.Exists(systemdRuntimeDir) {
+		log.Debugf("the host is not booted with systemd, the command does not run in a transient scope")
+		return nil
+	}
+	if _, err := lookPath(systemdRun); err != nil {
+		log.Warnf("unable to run the command in a transient scope: %v", err)
+		return nil
+	}
+	return &transientScope{
+		unit:   fmt.Sprintf("%v-command-%v-%v.scope", cgroupParent, os.Getpid(), atomic.AddInt32(&scopeSequence, 1)),
+		limits: limits,
+	}
+}
+
+// sandboxLimits returns the limits the sandbox still enforces: systemd enforces all the others in the scope.
+func (s *transientScope) sandboxLimits(limits ResourceLimits) ResourceLimits {
+	if s == nil {
+		return limits
+	}
+	return ResourceLimits{Niceness: limits.Niceness}
+}
+
+// wrap makes the command start through systemd-run, which executes the command in place once the scope is created:
+// the process keeps its pid, process group and standard streams.
+func (s *transientScope) wrap(command *exec.Cmd) {
+	if s == nil {
+		return
+	}
+	path, _ := lookPath(systemdRun)
+	args := []string{systemdRun, "--scope", "--quiet", "--collect", "--unit=" + s.unit, "--slice=" + scopeSlice}
+	for _, property := range s.properties() {
+		args = append(args, "--property="+property)
+	}
+	command.Args = append(append(args, "--", command.Path), command.Args[1:]...)
+	command.Path = path
+}
+
+// properties returns the resource control properties of the scope, named after the hierarchy of the control groups.
+func (s *transientScope) properties() (properties []string) {
+	unified := fileutil.Exists(filepath.Join(cgroupRoot, "cgroup.controllers"))
+	if s.limits.CPUShares != 0 {
+		if unified {
+			properties = append(properties, "CPUWeight="+strconv.Itoa(cpuWeight(s.limits.CPUShares)))
+		} else {
+			properties = append(properties, "CPUShares="+strconv.Itoa(s.limits.CPUShares))
+		}
+	}
+	if s.limits.MemoryLimitMB != 0 {
+		if unified {
+			properties = append(properties, "MemoryMax="+memoryLimitBytes(s.limits.MemoryLimitMB))
+		} else {
+			properties = append(properties, "MemoryLimit="+memoryLimitBytes(s.limits.MemoryLimitMB))
+		}
+	}
+	if s.limits.MaxProcesses != 0 {
+		properties = append(properties, "TasksMax="+strconv.Itoa(s.limits.MaxProcesses))
+	}
+	return
+}
+
+// stop kills all the processes of the scope.
+func (s *transientScope) stop(log log.T) {
+	if s == nil {
+		return
+	}
+	if output, err := exec.Command(systemctl, "kill", "--signal=SIGKILL", s.unit).CombinedOutput(); err != nil {
+		log.Warnf("failed to kill the processes of the scope %v: %v %v", s.unit, err, string(output))
+	}
+}
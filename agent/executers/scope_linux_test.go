@@ -0,0 +1,96 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build linux
+
+package executers
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// withSystemd runs the test as if the host was booted with systemd and the scopes were enabled.
+func withSystemd(t *testing.T, test func()) {
+	defer func(dir string, look func(string) (string, error), enabled func() bool) {
+		systemdRuntimeDir, lookPath, systemdScopesEnabled = dir, look, enabled
+	}(systemdRuntimeDir, lookPath, systemdScopesEnabled)
+	dir, err := ioutil.TempDir("", "systemd")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	systemdRuntimeDir = dir
+	lookPath = func(file string) (string, error) { return "/usr/bin/" + file, nil }
+	systemdScopesEnabled = func() bool { return true }
+	test()
+}
+
+func TestTransientScope(t *testing.T) {
+	withSystemd(t, func() {
+		withCgroupRoot(t, func(root string) {
+			assert.Nil(t, ioutil.WriteFile(filepath.Join(root, "cgroup.controllers"), []byte("cpu memory pids"), 0600))
+			limits := ResourceLimits{CPUShares: 512, MemoryLimitMB: 64, MaxProcesses: 20, Niceness: 5}
+
+			scope := newTransientScope(log.NewMockLog(), limits, RunAs{})
+			assert.NotNil(t, scope)
+			assert.Equal(t, ResourceLimits{Niceness: 5}, scope.sandboxLimits(limits))
+
+			command := exec.Command("/bin/sh", "-c", "echo hello")
+			scope.wrap(command)
+			assert.Equal(t, "/usr/bin/systemd-run", command.Path)
+			assert.Equal(t, []string{
+				"systemd-run", "--scope", "--quiet", "--collect", "--unit=" + scope.unit, "--slice=amazon-ssm-agent.slice",
+				"--property=CPUWeight=50", "--property=MemoryMax=67108864", "--property=TasksMax=20",
+				"--", "/bin/sh", "-c", "echo hello"}, command.Args)
+		})
+	})
+}
+
+func TestTransientScopeLegacyProperties(t *testing.T) {
+	withCgroupRoot(t, func(root string) {
+		scope := &transientScope{limits: ResourceLimits{CPUShares: 512, MemoryLimitMB: 64}}
+		assert.Equal(t, []string{"CPUShares=512", "MemoryLimit=67108864"}, scope.properties())
+	})
+}
+
+func TestTransientScopeNotUsed(t *testing.T) {
+	withSystemd(t, func() {
+		logger := log.NewMockLog()
+		limits := ResourceLimits{MaxProcesses: 20}
+
+		// the scopes are not used for the commands running as another user
+		assert.Nil(t, newTransientScope(logger, limits, RunAs{User: "nobody"}))
+
+		lookPath = func(file string) (string, error) { return "", errors.New("not found") }
+		assert.Nil(t, newTransientScope(logger, limits, RunAs{}))
+
+		systemdRuntimeDir = filepath.Join(systemdRuntimeDir, "missing")
+		assert.Nil(t, newTransientScope(logger, limits, RunAs{}))
+
+		systemdScopesEnabled = func() bool { return false }
+		assert.Nil(t, newTransientScope(logger, limits, RunAs{}))
+	})
+
+	// a nil scope leaves the command and the limits of the sandbox unchanged
+	var scope *transientScope
+	command := exec.Command("/bin/sh", "-c", "echo hello")
+	scope.wrap(command)
+	assert.Equal(t, []string{"/bin/sh", "-c", "echo hello"}, command.Args)
+	assert.Equal(t, ResourceLimits{MaxProcesses: 20}, scope.sandboxLimits(ResourceLimits{MaxProcesses: 20}))
+}
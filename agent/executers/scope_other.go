@@ -0,0 +1,41 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build darwin freebsd netbsd openbsd windows
+
+package executers
+
+import (
+	"os/exec"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+// transientScope is never created, systemd is specific to Linux.
+type transientScope struct{}
+
+// newTransientScope returns nil, the commands are enclosed by the sandbox of the platform.
+func newTransientScope(log log.T, limits ResourceLimits, runAs RunAs) *transientScope {
+	return nil
+}
+
+// sandboxLimits returns the limits unchanged.
+func (s *transientScope) sandboxLimits(limits ResourceLimits) ResourceLimits {
+	return limits
+}
+
+// wrap has no effect.
+func (s *transientScope) wrap(command *exec.Cmd) {}
+
+// stop has no effect.
+func (s *transientScope) stop(log log.T) {}
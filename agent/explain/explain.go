@@ -0,0 +1,186 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package explain simulates how the agent would run a document, without running anything: for each target platform,
+// the plugins that would run, in order, with their parameters replaced, and the preconditions evaluated against
+// a profile describing the instance.
+package explain
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/message/parser"
+	"github.com/aws/amazon-ssm-agent/agent/precondition"
+)
+
+const (
+	// PlatformLinux is the linux agent.
+	PlatformLinux = "linux"
+
+	// PlatformDarwin is the macOS agent.
+	PlatformDarwin = "darwin"
+
+	// PlatformWindows is the windows agent.
+	PlatformWindows = "windows"
+)
+
+// commonPlugins are the plugins and actions of the agent on all platforms.
+var commonPlugins = []string{
+	appconfig.PluginNameAwsAgentUpdate,
+	appconfig.PluginNameAwsCopyFile,
+	appconfig.PluginNameAwsCaptureDebugLogs,
+	appconfig.PluginNameAwsLoop,
+	appconfig.PluginNameAwsSleepUntil,
+	appconfig.PluginNameAwsRunDocument,
+}
+
+// unixPlugins are the plugins registered by the linux and macOS agents.
+var unixPlugins = []string{
+	"aws:runShellScript",
+	"aws:runPowerShellScript",
+	appconfig.PluginNameAwsRunAnsiblePlaybook,
+	appconfig.PluginNameAwsRunSaltState,
+	appconfig.PluginNameAwsRunChefRecipe,
+	appconfig.PluginNameAwsRunDockerCompose,
+}
+
+// platformPlugins are the plugins registered by the agent of each platform. The names of the platform dependent
+// plugins are only defined in the build of their platform, they are repeated here.
+var platformPlugins = map[string][]string{
+	PlatformLinux:  append(append([]string{}, commonPlugins...), unixPlugins...),
+	PlatformDarwin: append(append([]string{}, commonPlugins...), unixPlugins...),
+	PlatformWindows: append(append([]string{}, commonPlugins...),
+		"aws:runPowerShellScript",
+		"aws:psModule",
+		"aws:applications",
+	),
+}
+
+// Profile describes the instance the document is explained for.
+type Profile struct {
+	// Platforms are the platforms to explain the document for, all platforms when empty.
+	Platforms []string `json:"platforms,omitempty"`
+
+	// Preconditions is the state of the instance the preconditions of the document are evaluated against.
+	Preconditions precondition.Profile `json:"preconditions"`
+}
+
+// Validate checks that the platforms and the cluster role of the profile are known.
+func (profile Profile) Validate() error {
+	for _, platform := range profile.Platforms {
+		if _, ok := platformPlugins[platform]; !ok {
+			return fmt.Errorf("unknown platform %v, expected one of %v, %v, %v", platform, PlatformLinux, PlatformDarwin, PlatformWindows)
+		}
+	}
+	switch profile.Preconditions.ClusterRole {
+	case "", precondition.ClusterRoleActive, precondition.ClusterRolePassive, precondition.ClusterRoleNotClustered:
+		return nil
+	default:
+		return fmt.Errorf("unknown cluster role %v, expected one of %v, %v, %v", profile.Preconditions.ClusterRole,
+			precondition.ClusterRoleActive, precondition.ClusterRolePassive, precondition.ClusterRoleNotClustered)
+	}
+}
+
+// Step is a plugin of the document, as the agent would run it.
+type Step struct {
+	Name string `json:"name"`
+
+	// Supported is false if the agent of the platform does not have the plugin, the step would fail.
+	Supported bool `json:"supported"`
+
+	// Properties are the properties of the plugin, with the parameters replaced.
+	Properties interface{} `json:"properties"`
+
+	MaxAttempts         int                     `json:"maxAttempts,omitempty"`
+	RetryBackoffSeconds int                     `json:"retryBackoffSeconds,omitempty"`
+	OnSuccess           string                  `json:"onSuccess,omitempty"`
+	OnFailure           string                  `json:"onFailure,omitempty"`
+	RunAt               string                  `json:"runAt,omitempty"`
+	DelaySeconds        int                     `json:"delaySeconds,omitempty"`
+	CaptureState        *contracts.StateCapture `json:"captureState,omitempty"`
+}
+
+// Explanation is how the agent of a platform would run the document.
+type Explanation struct {
+	Platform string `json:"platform"`
+
+	// PreconditionsSatisfied is false if the agent would skip all the steps of the document, Reason explains why.
+	PreconditionsSatisfied bool   `json:"preconditionsSatisfied"`
+	Reason                 string `json:"reason,omitempty"`
+
+	// Steps are the steps of the document in the order they run when no branching happens.
+	Steps []Step `json:"steps"`
+}
+
+// Explain returns how the agent of each platform of the profile would run the document with the given parameters.
+func Explain(log log.T, document contracts.DocumentContent, params map[string]interface{}, profile Profile) (explanations []Explanation, err error) {
+	if err = profile.Validate(); err != nil {
+		return
+	}
+	platforms := profile.Platforms
+	if len(platforms) == 0 {
+		platforms = []string{PlatformLinux, PlatformDarwin, PlatformWindows}
+	}
+
+	runtimeConfig := parser.ReplaceDocumentParameters(log, document, params)
+	satisfied, reason := precondition.ProfileProviders(profile.Preconditions).Evaluate(log, document.Preconditions)
+	for _, platform := range platforms {
+		explanations = append(explanations, Explanation{
+			Platform:               platform,
+			PreconditionsSatisfied: satisfied,
+			Reason:                 reason,
+			Steps:                  steps(runtimeConfig, platformPlugins[platform]),
+		})
+	}
+	return
+}
+
+// steps returns the steps of the runtime configuration, ordered by name like the engine runs them.
+func steps(runtimeConfig map[string]*contracts.PluginConfig, plugins []string) (steps []Step) {
+	var names []string
+	for name := range runtimeConfig {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		config := runtimeConfig[name]
+		steps = append(steps, Step{
+			Name:                name,
+			Supported:           contains(plugins, name),
+			Properties:          config.Properties,
+			MaxAttempts:         config.MaxAttempts,
+			RetryBackoffSeconds: config.RetryBackoffSeconds,
+			OnSuccess:           config.OnSuccess,
+			OnFailure:           config.OnFailure,
+			RunAt:               config.RunAt,
+			DelaySeconds:        config.DelaySeconds,
+			CaptureState:        config.CaptureState,
+		})
+	}
+	return
+}
+
+// contains returns true if the list contains the value.
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package explain
+
+import (
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/precondition"
+	"github.com/stretchr/testify/assert"
+)
+
+var document = contracts.DocumentContent{
+	SchemaVersion: "1.2",
+	Parameters: map[string]*contracts.Parameter{
+		"commands":         {ParamType: "StringList"},
+		"workingDirectory": {ParamType: "String", DefaultVal: "/tmp"},
+	},
+	RuntimeConfig: map[string]*contracts.PluginConfig{
+		"aws:runShellScript": {
+			Properties: map[string]interface{}{
+				"runCommand":       "{{ commands }}",
+				"workingDirectory": "{{ workingDirectory }}",
+			},
+			MaxAttempts: 3,
+		},
+		"aws:psModule": {Properties: map[string]interface{}{"runCommand": "{{ commands }}"}},
+	},
+	Preconditions: map[string]string{precondition.ClusterPreconditionName: "active"},
+}
+
+func TestExplain(t *testing.T) {
+	logger := log.NewMockLog()
+	params := map[string]interface{}{"commands": []interface{}{"ls"}}
+
+	explanations, err := Explain(logger, document, params, Profile{})
+	assert.Nil(t, err)
+	assert.Len(t, explanations, 3)
+
+	linux := explanations[0]
+	assert.Equal(t, PlatformLinux, linux.Platform)
+	assert.True(t, linux.PreconditionsSatisfied)
+	assert.Equal(t, []Step{
+		{Name: "aws:psModule", Supported: false, Properties: map[string]interface{}{"runCommand": []interface{}{"ls"}}},
+		{Name: "aws:runShellScript", Supported: true, MaxAttempts: 3, Properties: map[string]interface{}{
+			"runCommand":       []interface{}{"ls"},
+			"workingDirectory": "/tmp",
+		}},
+	}, linux.Steps)
+
+	windows := explanations[2]
+	assert.Equal(t, PlatformWindows, windows.Platform)
+	assert.True(t, windows.Steps[0].Supported)
+	assert.False(t, windows.Steps[1].Supported)
+}
+
+func TestExplainPreconditions(t *testing.T) {
+	logger := log.NewMockLog()
+	profile := Profile{
+		Platforms:     []string{PlatformWindows},
+		Preconditions: precondition.Profile{ClusterRole: precondition.ClusterRolePassive},
+	}
+
+	explanations, err := Explain(logger, document, nil, profile)
+	assert.Nil(t, err)
+	assert.Len(t, explanations, 1)
+	assert.False(t, explanations[0].PreconditionsSatisfied)
+	assert.NotEmpty(t, explanations[0].Reason)
+}
+
+func TestInvalidProfile(t *testing.T) {
+	logger := log.NewMockLog()
+	for _, profile := range []Profile{
+		{Platforms: []string{"solaris"}},
+		{Preconditions: precondition.Profile{ClusterRole: "Leader"}},
+	} {
+		_, err := Explain(logger, document, nil, profile)
+		assert.NotNil(t, err, "%v", profile)
+	}
+}
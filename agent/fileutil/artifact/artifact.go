@@ -17,6 +17,7 @@ package artifact
 import (
 	"crypto/md5"
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
 	"fmt"
 	"io"
@@ -29,9 +30,11 @@ import (
 	"github.com/aws/amazon-ssm-agent/agent/appconfig"
 	"github.com/aws/amazon-ssm-agent/agent/fileutil"
 	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/proxy"
 	"github.com/aws/amazon-ssm-agent/agent/s3util"
+	"github.com/aws/amazon-ssm-agent/agent/sdkutil/attribution"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
@@ -48,54 +51,185 @@ type DownloadInput struct {
 	DestinationDirectory string
 	SourceHashValue      string
 	SourceHashType       string
+
+	// SourceType forces the kind of download, SourceTypeHTTP downloads urls that look like S3 urls
+	// (e.g. presigned urls) as plain http/https files. By default the kind is detected from the url.
+	SourceType string
+
+	// Headers are added to the requests of http/https downloads.
+	Headers map[string]string
+
+	// Auth authenticates the requests of http/https downloads.
+	Auth *HTTPAuth
+
+	// ShareAuth connects to the share of a UNC source with the credentials of a domain user.
+	// Without it the share is accessed with the identity of the agent, e.g. the computer account or a gMSA.
+	ShareAuth *ShareAuth
+
+	// Git selects the file of the git repository of the SourceURL, when SourceType is SourceTypeGit.
+	Git *GitSource
+}
+
+const (
+	// SourceTypeHTTP is the source type of http/https downloads.
+	SourceTypeHTTP = "http"
+
+	// AuthTypeBasic authenticates with a username and a password.
+	AuthTypeBasic = "basic"
+
+	// AuthTypeBearer authenticates with a bearer token.
+	AuthTypeBearer = "bearer"
+
+	// maxRedirects is the number of redirects followed by http/https downloads.
+	maxRedirects = 10
+
+	// partialSuffix is appended to the destination file while it is downloaded.
+	partialSuffix = ".partial"
+)
+
+// HTTPAuth holds the credentials of http/https downloads.
+type HTTPAuth struct {
+	// Type is AuthTypeBasic or AuthTypeBearer.
+	Type string
+
+	// Username is the user of the basic authentication.
+	Username string
+
+	// Secret is the password of the basic authentication or the bearer token.
+	Secret string
+}
+
+// authorize sets the Authorization header of the request.
+func (auth *HTTPAuth) authorize(request *http.Request) error {
+	switch strings.ToLower(auth.Type) {
+	case AuthTypeBasic:
+		request.SetBasicAuth(auth.Username, auth.Secret)
+	case AuthTypeBearer:
+		request.Header.Set("Authorization", "Bearer "+auth.Secret)
+	default:
+		return fmt.Errorf("unsupported authentication type %v, expected one of %v, %v", auth.Type, AuthTypeBasic, AuthTypeBearer)
+	}
+	return nil
 }
 
-// httpDownload attempts to download a file via http/s call
-func httpDownload(log log.T, fileURL string, destFile string) (output DownloadOutput, err error) {
+// newHTTPClient returns the client of http/https downloads, connecting through the proxy of the agent with
+// the transport shared by the agent so that the connections are reused. The callerHeaders are the headers
+// the caller of the download set.
+func newHTTPClient(callerHeaders map[string]string) *http.Client {
+	return &http.Client{
+		Transport:     proxy.Transport(),
+		CheckRedirect: redirectPolicy(callerHeaders),
+	}
+}
+
+// redirectPolicy follows up to maxRedirects redirects, but never from https to http. The headers of the download
+// are sent again, except the credentials and the callerHeaders once a redirect changes the host or the scheme,
+// so that they do not leak to another server such as the storage an artifact repository redirects to.
+func redirectPolicy(callerHeaders map[string]string) func(r *http.Request, via []*http.Request) error {
+	return func(r *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %v redirects", maxRedirects)
+		}
+		if previous := via[len(via)-1]; previous.URL.Scheme == "https" && r.URL.Scheme != "https" {
+			return fmt.Errorf("refused the redirect from https://%v to the insecure http://%v", previous.URL.Host, r.URL.Host)
+		}
+		r.URL.Opaque = r.URL.Path
+		original := via[0]
+		for name, values := range original.Header {
+			r.Header[name] = values
+		}
+		if r.URL.Host != original.URL.Host || r.URL.Scheme != original.URL.Scheme {
+			r.Header.Del("Authorization")
+			for name := range callerHeaders {
+				r.Header.Del(name)
+			}
+		}
+		return nil
+	}
+}
+
+// httpDownload attempts to download a file via http/s call.
+// The file is downloaded to a partial file first, an interrupted download is resumed with a range request
+// if the server supports it and the file has not changed since.
+func httpDownload(log log.T, input DownloadInput, destFile string) (output DownloadOutput, err error) {
 	log.Debugf("attempting to download as http/https download %v", destFile)
 	eTagFile := destFile + ".etag"
-	var check http.Client
+	partialFile := destFile + partialSuffix
+	partialETagFile := partialFile + ".etag"
 	var request *http.Request
-	request, err = http.NewRequest("GET", fileURL, nil)
+	request, err = http.NewRequest("GET", input.SourceURL, nil)
 	if err != nil {
 		return
 	}
+	for name, value := range input.Headers {
+		request.Header.Set(name, value)
+	}
+	if input.Auth != nil {
+		if err = input.Auth.authorize(request); err != nil {
+			return
+		}
+	}
 	if fileutil.Exists(destFile) == true && fileutil.Exists(eTagFile) == true {
 		var existingETag string
 		existingETag, err = fileutil.ReadAllText(eTagFile)
 		request.Header.Add("If-None-Match", existingETag)
 	}
 
-	check = http.Client{
-		CheckRedirect: func(r *http.Request, via []*http.Request) error {
-			r.URL.Opaque = r.URL.Path
-			return nil
-		},
+	// resume the partial download, If-Range makes the server send the whole file if it changed
+	var offset int64
+	if info, statErr := os.Stat(partialFile); statErr == nil && info.Size() > 0 && fileutil.Exists(partialETagFile) {
+		if partialETag, readErr := fileutil.ReadAllText(partialETagFile); readErr == nil && partialETag != "" {
+			offset = info.Size()
+			request.Header.Set("Range", fmt.Sprintf("bytes=%v-", offset))
+			request.Header.Set("If-Range", partialETag)
+		}
 	}
 
 	var resp *http.Response
-	resp, err = check.Do(request)
+	resp, err = newHTTPClient(input.Headers).Do(request)
 	if err != nil {
 		log.Debug("failed to download from http/https, ", err)
 		fileutil.DeleteFile(destFile)
 		fileutil.DeleteFile(eTagFile)
 		return
 	}
+	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusNotModified {
+	switch resp.StatusCode {
+	case http.StatusNotModified:
 		log.Debugf("Unchanged file.")
 		output.IsUpdated = false
 		output.LocalFilePath = destFile
 		return output, nil
-	} else if resp.StatusCode != http.StatusOK {
-		log.Debug("failed to download from http/https, ", err)
+	case http.StatusPartialContent:
+		log.Debugf("resuming download of %v from byte %v", destFile, offset)
+	case http.StatusOK:
+		offset = 0
+	default:
 		fileutil.DeleteFile(destFile)
 		fileutil.DeleteFile(eTagFile)
+		fileutil.DeleteFile(partialFile)
+		fileutil.DeleteFile(partialETagFile)
 		err = fmt.Errorf("http request failed. status:%v statuscode:%v", resp.Status, resp.StatusCode)
+		log.Debug("failed to download from http/https, ", err)
 		return
 	}
-	defer resp.Body.Close()
+
 	eTagValue := resp.Header.Get("Etag")
+	if err = fileutil.WriteAllText(partialETagFile, eTagValue); err != nil {
+		log.Errorf("failed to write eTagfile %v, %v ", partialETagFile, err)
+		return
+	}
+	if _, err = fileAppend(log, partialFile, offset, resp.Body); err != nil {
+		log.Errorf("failed to write destFile %v, %v ", partialFile, err)
+		return
+	}
+	if err = os.Rename(partialFile, destFile); err != nil {
+		log.Errorf("failed to write destFile %v, %v ", destFile, err)
+		return
+	}
+	fileutil.DeleteFile(partialETagFile)
+
 	if eTagValue != "" {
 		log.Debug("file eTagValue is ", eTagValue)
 		err = fileutil.WriteAllText(eTagFile, eTagValue)
@@ -103,21 +237,36 @@ func httpDownload(log log.T, fileURL string, destFile string) (output DownloadOu
 			log.Errorf("failed to write eTagfile %v, %v ", eTagFile, err)
 			return
 		}
-	}
-	_, err = FileCopy(log, destFile, resp.Body)
-	if err == nil {
-		output.LocalFilePath = destFile
-		output.IsUpdated = true
 	} else {
-		log.Errorf("failed to write destFile %v, %v ", destFile, err)
+		fileutil.DeleteFile(eTagFile)
 	}
+	output.LocalFilePath = destFile
+	output.IsUpdated = true
 	return
 }
 
+// s3PartSize is the size of the ranges of an S3 object downloaded by each GET request.
+var s3PartSize int64 = 16 * 1024 * 1024
+
+// s3Client is the part of the S3 API the downloads use.
+type s3Client interface {
+	HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error)
+	GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error)
+}
+
+// newS3Client returns the client downloading the objects of the region of the url.
+var newS3Client = func(config *aws.Config) s3Client {
+	return s3.New(attribution.NewSession(config))
+}
+
 // s3Download attempts to download a file via the aws sdk.
+// The object is streamed to a partial file with ranged GET requests of s3PartSize bytes, an interrupted download
+// is resumed from the last complete range if the object has not changed since.
 func s3Download(log log.T, amazonS3URL s3util.AmazonS3URL, destFile string) (output DownloadOutput, err error) {
 	log.Debugf("attempting to download as s3 download %v", destFile)
 	eTagFile := destFile + ".etag"
+	partialFile := destFile + partialSuffix
+	partialETagFile := partialFile + ".etag"
 
 	config := &aws.Config{}
 	var appConfig appconfig.SsmagentConfig
@@ -133,7 +282,7 @@ func s3Download(log log.T, amazonS3URL s3util.AmazonS3URL, destFile string) (out
 	config.S3ForcePathStyle = aws.Bool(amazonS3URL.IsPathStyle)
 	config.Region = aws.String(amazonS3URL.Region)
 
-	params := &s3.GetObjectInput{
+	params := &s3.HeadObjectInput{
 		Bucket: aws.String(amazonS3URL.Bucket),
 		Key:    aws.String(amazonS3URL.Key),
 	}
@@ -148,12 +297,10 @@ func s3Download(log log.T, amazonS3URL s3util.AmazonS3URL, destFile string) (out
 		params.IfNoneMatch = aws.String(existingETag)
 	}
 
-	s3client := s3.New(session.New(config))
-
-	req, resp := s3client.GetObjectRequest(params)
-	err = req.Send()
+	s3client := newS3Client(config)
+	head, err := s3client.HeadObject(params)
 	if err != nil {
-		if req.HTTPResponse == nil || req.HTTPResponse.StatusCode != http.StatusNotModified {
+		if failure, ok := err.(awserr.RequestFailure); !ok || failure.StatusCode() != http.StatusNotModified {
 			log.Debug("failed to download from s3, ", err)
 			fileutil.DeleteFile(destFile)
 			fileutil.DeleteFile(eTagFile)
@@ -165,24 +312,78 @@ func s3Download(log log.T, amazonS3URL s3util.AmazonS3URL, destFile string) (out
 		output.LocalFilePath = destFile
 		return output, nil
 	}
+	eTag := aws.StringValue(head.ETag)
+	size := aws.Int64Value(head.ContentLength)
+
+	// resume the partial download of the same version of the object
+	var offset int64
+	if info, statErr := os.Stat(partialFile); statErr == nil && info.Size() <= size && eTag != "" && fileutil.Exists(partialETagFile) {
+		if partialETag, readErr := fileutil.ReadAllText(partialETagFile); readErr == nil && partialETag == eTag {
+			offset = info.Size()
+			log.Debugf("resuming download of %v from byte %v", destFile, offset)
+		}
+	}
+	if err = fileutil.WriteAllText(partialETagFile, eTag); err != nil {
+		log.Errorf("failed to write eTagfile %v, %v ", partialETagFile, err)
+		return
+	}
+	if _, err = fileAppend(log, partialFile, offset, strings.NewReader("")); err != nil {
+		log.Errorf("failed to write destFile %v, %v ", partialFile, err)
+		return
+	}
 
-	if *resp.ETag != "" {
-		log.Debug("files etag is ", *resp.ETag)
-		err = fileutil.WriteAllText(eTagFile, *resp.ETag)
+	for offset < size {
+		end := offset + s3PartSize
+		if end > size {
+			end = size
+		}
+		partParams := &s3.GetObjectInput{
+			Bucket: params.Bucket,
+			Key:    params.Key,
+			Range:  aws.String(fmt.Sprintf("bytes=%v-%v", offset, end-1)),
+		}
+		if eTag != "" {
+			// the ranges must come from the same version of the object
+			partParams.IfMatch = aws.String(eTag)
+		}
+		var part *s3.GetObjectOutput
+		if part, err = s3client.GetObject(partParams); err != nil {
+			// the partial file is kept, the next download resumes from this range
+			log.Debug("failed to download from s3, ", err)
+			return
+		}
+		var written int64
+		written, err = fileAppend(log, partialFile, offset, part.Body)
+		part.Body.Close()
 		if err != nil {
-			log.Errorf("failed to write eTagfile %v, %v ", eTagFile, err)
+			log.Errorf("failed to write destFile %v, %v ", partialFile, err)
 			return
 		}
+		if written != end-offset {
+			return output, fmt.Errorf("range %v of s3 object %v is %v bytes long, expected %v", *partParams.Range, amazonS3URL.Key, written, end-offset)
+		}
+		offset = end
 	}
 
-	defer resp.Body.Close()
-	_, err = FileCopy(log, destFile, resp.Body)
-	if err == nil {
-		output.LocalFilePath = destFile
-		output.IsUpdated = true
-	} else {
+	if err = os.Rename(partialFile, destFile); err != nil {
 		log.Errorf("failed to write destFile %v, %v ", destFile, err)
+		return
 	}
+	fileutil.DeleteFile(partialETagFile)
+	log.Infof("%s with %v bytes downloaded", destFile, size)
+
+	if eTag != "" {
+		log.Debug("files etag is ", eTag)
+		err = fileutil.WriteAllText(eTagFile, eTag)
+		if err != nil {
+			log.Errorf("failed to write eTagfile %v, %v ", eTagFile, err)
+			return
+		}
+	} else {
+		fileutil.DeleteFile(eTagFile)
+	}
+	output.LocalFilePath = destFile
+	output.IsUpdated = true
 	return
 }
 
@@ -202,20 +403,32 @@ func FileCopy(log log.T, destinationPath string, src io.Reader) (written int64,
 	return
 }
 
-// Download is a generic utility which attempts to download smartly.
-func Download(log log.T, input DownloadInput) (output DownloadOutput, err error) {
-	// parse the url
-	var fileURL *url.URL
-	fileURL, err = url.Parse(input.SourceURL)
+// fileAppend writes the content from reader to destinationPath file from the offset, the file is truncated there.
+func fileAppend(log log.T, destinationPath string, offset int64, src io.Reader) (written int64, err error) {
+	var file *os.File
+	file, err = os.OpenFile(destinationPath, os.O_WRONLY|os.O_CREATE, appconfig.ReadWriteAccess)
 	if err != nil {
-		err = fmt.Errorf("url parsing failed. %v", err)
+		log.Errorf("failed to create file. %v", err)
 		return
 	}
+	defer file.Close()
+	if err = file.Truncate(offset); err != nil {
+		return
+	}
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		return
+	}
+	written, err = io.Copy(file, src)
+	log.Infof("%s with %v bytes downloaded", destinationPath, written)
+	return
+}
 
+// Download is a generic utility which attempts to download smartly.
+func Download(log log.T, input DownloadInput) (output DownloadOutput, err error) {
 	// create destination directory
 	var destinationDir = input.DestinationDirectory
 	if destinationDir == "" {
-		destinationDir = appconfig.DownloadRoot
+		destinationDir = appconfig.DownloadRootPath()
 	}
 
 	// create directory where artifacts are downloaded.
@@ -225,6 +438,24 @@ func Download(log log.T, input DownloadInput) (output DownloadOutput, err error)
 		return
 	}
 
+	// files on network shares are copied, so that the share is only connected during the download
+	if IsUNCPath(input.SourceURL) {
+		return shareDownload(log, input, destinationDir)
+	}
+
+	// files of git repositories are read at the pinned ref of a shallow fetch
+	if strings.EqualFold(input.SourceType, SourceTypeGit) {
+		return gitDownload(log, input, destinationDir)
+	}
+
+	// parse the url
+	var fileURL *url.URL
+	fileURL, err = url.Parse(input.SourceURL)
+	if err != nil {
+		err = fmt.Errorf("url parsing failed. %v", err)
+		return
+	}
+
 	// process if the url is local file or it has already been downloaded.
 	var isLocalFile = false
 	isLocalFile, err = fileutil.LocalFileExist(input.SourceURL)
@@ -249,12 +480,12 @@ func Download(log log.T, input DownloadInput) (output DownloadOutput, err error)
 		output.LocalFilePath = filepath.Join(destinationDir, fmt.Sprintf("%x_%v", urlHash, fileName))
 
 		amazonS3URL := s3util.ParseAmazonS3URL(log, fileURL)
-		if amazonS3URL.IsBucketAndKeyPresent() {
+		if !strings.EqualFold(input.SourceType, SourceTypeHTTP) && amazonS3URL.IsBucketAndKeyPresent() {
 			// source is s3
 			output, err = s3Download(log, amazonS3URL, output.LocalFilePath)
 		} else {
 			// simple httphttps download
-			output, err = httpDownload(log, input.SourceURL, output.LocalFilePath)
+			output, err = httpDownload(log, input, output.LocalFilePath)
 		}
 		if err != nil {
 			return
@@ -288,15 +519,22 @@ func VerifyHash(log log.T, input DownloadInput, output DownloadOutput) (match bo
 	if strings.EqualFold(hashAlgorithm, "sha256") {
 		computedHashValue, err = Sha256HashValue(log, output.LocalFilePath)
 
+	} else if strings.EqualFold(hashAlgorithm, "sha512") {
+		computedHashValue, err = Sha512HashValue(log, output.LocalFilePath)
+
 	} else if strings.EqualFold(hashAlgorithm, "md5") {
 		computedHashValue, err = Md5HashValue(log, output.LocalFilePath)
+
+	} else {
+		err = fmt.Errorf("unsupported hash type %v, expected one of sha256, sha512, md5", hashAlgorithm)
 	}
 	if err != nil {
 		return
 	}
 	match = strings.EqualFold(input.SourceHashValue, computedHashValue)
 	if match == false {
-		err = fmt.Errorf("failed to verify hash of downloadinput %v", input)
+		err = fmt.Errorf("integrity check failed for %v: expected %v hash %v, the downloaded file has %v",
+			input.SourceURL, hashAlgorithm, input.SourceHashValue, computedHashValue)
 	}
 	return
 }
@@ -324,6 +562,31 @@ func Sha256HashValue(log log.T, filePath string) (hash string, err error) {
 	return
 }
 
+// Sha512HashValue gets the sha512 hash value
+func Sha512HashValue(log log.T, filePath string) (hash string, err error) {
+	var exists = false
+	exists, err = fileutil.LocalFileExist(filePath)
+	if err != nil || exists == false {
+		return
+	}
+
+	var f *os.File
+	f, err = os.Open(filePath)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer f.Close()
+	hasher := sha512.New()
+	if _, err = io.Copy(hasher, f); err != nil {
+		log.Error(err)
+		return
+	}
+	hash = hex.EncodeToString(hasher.Sum(nil))
+	log.Debugf("Hash=%v, FilePath=%v", hash, filePath)
+	return
+}
+
 // Md5HashValue gets the md5 hash value
 func Md5HashValue(log log.T, filePath string) (hash string, err error) {
 	var exists = false
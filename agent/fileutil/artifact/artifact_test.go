@@ -0,0 +1,316 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package artifact
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/s3util"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyHash(t *testing.T) {
+	mockLog := log.NewMockLog()
+	output := DownloadOutput{LocalFilePath: filepath.Join("testdata", "CheckMyHash.txt")}
+	sha512Hash := "1772bb8f8804d5f2173298683931470c883c3a5ddd2e91821b0d5ace7f335d8bba7049977be733c21669d22289a7863d7592d4a0d7b5786e5786c69fecd083e8"
+
+	for _, input := range []DownloadInput{
+		{SourceHashValue: ""},
+		{SourceHashValue: "090c1965e46155b2b23ba9093ed7c67243957a397e3ad5531a693d57958a760a"},
+		{SourceHashValue: sha512Hash, SourceHashType: "sha512"},
+		{SourceHashValue: "e84913ff3a8eef39238b32170e657ba8", SourceHashType: "MD5"},
+	} {
+		match, err := VerifyHash(mockLog, input, output)
+		assert.Nil(t, err, "%v", input)
+		assert.True(t, match, "%v", input)
+	}
+
+	match, err := VerifyHash(mockLog, DownloadInput{SourceURL: "https://example.com/file", SourceHashValue: sha512Hash}, output)
+	assert.False(t, match)
+	assert.Contains(t, err.Error(), "integrity check failed for https://example.com/file")
+
+	match, err = VerifyHash(mockLog, DownloadInput{SourceHashValue: sha512Hash, SourceHashType: "crc32"}, output)
+	assert.False(t, match)
+	assert.Contains(t, err.Error(), "unsupported hash type")
+}
+
+func TestSha512HashValueReadError(t *testing.T) {
+	// a directory can be opened but not read
+	hash, err := Sha512HashValue(log.NewMockLog(), t.TempDir())
+	assert.NotNil(t, err)
+	assert.Empty(t, hash)
+}
+
+func TestHTTPDownloadWithAuthAndRedirect(t *testing.T) {
+	mockLog := log.NewMockLog()
+	dir, err := ioutil.TempDir("", "artifact")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// the storage the repository redirects to must not receive the credentials nor the headers of the caller
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Authorization"))
+		assert.Empty(t, r.Header.Get("X-Client"))
+		fmt.Fprint(w, "artifact")
+	}))
+	defer storage.Close()
+	repository := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "deploy" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.Redirect(w, r, storage.URL+"/blob", http.StatusFound)
+	}))
+	defer repository.Close()
+
+	input := DownloadInput{
+		SourceURL: repository.URL + "/app.tar",
+		Headers:   map[string]string{"X-Client": "ci"},
+		Auth:      &HTTPAuth{Type: AuthTypeBasic, Username: "deploy", Secret: "secret"},
+	}
+	destFile := filepath.Join(dir, "app.tar")
+	output, err := httpDownload(mockLog, input, destFile)
+	assert.Nil(t, err)
+	assert.True(t, output.IsUpdated)
+	content, _ := ioutil.ReadFile(destFile)
+	assert.Equal(t, "artifact", string(content))
+	assert.False(t, fileExists(destFile+partialSuffix))
+
+	input.Auth.Secret = "wrong"
+	_, err = httpDownload(mockLog, input, destFile)
+	assert.Contains(t, err.Error(), "statuscode:401")
+
+	input.Auth = &HTTPAuth{Type: "digest"}
+	_, err = httpDownload(mockLog, input, destFile)
+	assert.Contains(t, err.Error(), "unsupported authentication type")
+}
+
+func TestRedirectPolicy(t *testing.T) {
+	policy := redirectPolicy(map[string]string{"X-Api-Key": "key"})
+	newRequest := func(url string) *http.Request {
+		request, _ := http.NewRequest("GET", url, nil)
+		return request
+	}
+	original := newRequest("https://repository/app.tar")
+	original.Header.Set("X-Api-Key", "key")
+	original.Header.Set("Authorization", "Bearer token")
+	original.Header.Set("Range", "bytes=10-")
+
+	// the same host and scheme receives all the headers
+	redirect := newRequest("https://repository/blob")
+	assert.Nil(t, policy(redirect, []*http.Request{original}))
+	assert.Equal(t, "key", redirect.Header.Get("X-Api-Key"))
+	assert.Equal(t, "Bearer token", redirect.Header.Get("Authorization"))
+
+	// another host only receives the headers of the download
+	redirect = newRequest("https://storage/blob")
+	assert.Nil(t, policy(redirect, []*http.Request{original}))
+	assert.Empty(t, redirect.Header.Get("X-Api-Key"))
+	assert.Empty(t, redirect.Header.Get("Authorization"))
+	assert.Equal(t, "bytes=10-", redirect.Header.Get("Range"))
+
+	// https is never downgraded to http, even on the same host
+	err := policy(newRequest("http://repository/blob"), []*http.Request{original})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "insecure")
+
+	// a scheme upgrade is a change of scheme
+	original = newRequest("http://repository/app.tar")
+	original.Header.Set("X-Api-Key", "key")
+	redirect = newRequest("https://repository/app.tar")
+	assert.Nil(t, policy(redirect, []*http.Request{original}))
+	assert.Empty(t, redirect.Header.Get("X-Api-Key"))
+}
+
+func TestHTTPDownloadResume(t *testing.T) {
+	mockLog := log.NewMockLog()
+	dir, err := ioutil.TempDir("", "artifact")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		w.Header().Set("Etag", `"v1"`)
+		http.ServeContent(w, r, "app.tar", time.Time{}, strings.NewReader("0123456789"))
+	}))
+	defer server.Close()
+
+	// a previous download was interrupted after 4 bytes
+	destFile := filepath.Join(dir, "app.tar")
+	assert.Nil(t, ioutil.WriteFile(destFile+partialSuffix, []byte("0123"), 0600))
+	assert.Nil(t, ioutil.WriteFile(destFile+partialSuffix+".etag", []byte(`"v1"`), 0600))
+
+	input := DownloadInput{SourceURL: server.URL, Auth: &HTTPAuth{Type: AuthTypeBearer, Secret: "token"}}
+	output, err := httpDownload(mockLog, input, destFile)
+	assert.Nil(t, err)
+	assert.True(t, output.IsUpdated)
+	assert.Equal(t, []string{"bytes=4-"}, ranges)
+	content, _ := ioutil.ReadFile(destFile)
+	assert.Equal(t, "0123456789", string(content))
+
+	// a partial download of a file that changed since is restarted
+	assert.Nil(t, ioutil.WriteFile(destFile+partialSuffix, []byte("abcd"), 0600))
+	assert.Nil(t, ioutil.WriteFile(destFile+partialSuffix+".etag", []byte(`"v0"`), 0600))
+	os.Remove(destFile + ".etag")
+	_, err = httpDownload(mockLog, input, destFile)
+	assert.Nil(t, err)
+	content, _ = ioutil.ReadFile(destFile)
+	assert.Equal(t, "0123456789", string(content))
+}
+
+// fakeS3 serves an object from memory, failing the GET requests after failAfter ranges when failAfter is positive.
+type fakeS3 struct {
+	content   string
+	eTag      string
+	ranges    []string
+	failAfter int
+}
+
+func (f *fakeS3) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(int64(len(f.content))), ETag: aws.String(f.eTag)}, nil
+}
+
+func (f *fakeS3) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	if f.failAfter > 0 && len(f.ranges) == f.failAfter {
+		return nil, errors.New("connection reset")
+	}
+	if aws.StringValue(input.IfMatch) != f.eTag {
+		return nil, errors.New("precondition failed")
+	}
+	f.ranges = append(f.ranges, aws.StringValue(input.Range))
+	var start, end int
+	fmt.Sscanf(aws.StringValue(input.Range), "bytes=%d-%d", &start, &end)
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(strings.NewReader(f.content[start : end+1]))}, nil
+}
+
+func TestS3DownloadRanges(t *testing.T) {
+	mockLog := log.NewMockLog()
+	dir, err := ioutil.TempDir("", "artifact")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer func(partSize int64, client func(config *aws.Config) s3Client) {
+		s3PartSize, newS3Client = partSize, client
+	}(s3PartSize, newS3Client)
+	s3PartSize = 4
+	object := &fakeS3{content: "0123456789", eTag: `"v1"`, failAfter: 2}
+	newS3Client = func(config *aws.Config) s3Client { return object }
+	url := s3util.AmazonS3URL{Bucket: "bucket", Key: "scripts/install.sh", Region: "us-east-1"}
+	destFile := filepath.Join(dir, "install.sh")
+
+	// the download is interrupted after two ranges, then resumed from the third one
+	_, err = s3Download(mockLog, url, destFile)
+	assert.NotNil(t, err)
+	content, _ := ioutil.ReadFile(destFile + partialSuffix)
+	assert.Equal(t, "01234567", string(content))
+
+	object.failAfter = 0
+	output, err := s3Download(mockLog, url, destFile)
+	assert.Nil(t, err)
+	assert.True(t, output.IsUpdated)
+	assert.Equal(t, []string{"bytes=0-3", "bytes=4-7", "bytes=8-9"}, object.ranges)
+	content, _ = ioutil.ReadFile(destFile)
+	assert.Equal(t, "0123456789", string(content))
+	assert.False(t, fileutil.Exists(destFile+partialSuffix))
+
+	// a partial download of an object that changed since is restarted
+	object.ranges, object.eTag = nil, `"v2"`
+	assert.Nil(t, ioutil.WriteFile(destFile+partialSuffix, []byte("abcd"), 0600))
+	assert.Nil(t, ioutil.WriteFile(destFile+partialSuffix+".etag", []byte(`"v1"`), 0600))
+	os.Remove(destFile + ".etag")
+	_, err = s3Download(mockLog, url, destFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "bytes=0-3", object.ranges[0])
+	content, _ = ioutil.ReadFile(destFile)
+	assert.Equal(t, "0123456789", string(content))
+}
+
+func TestShareRoot(t *testing.T) {
+	assert.True(t, IsUNCPath(`\\fs01\installers\app.msi`))
+	assert.False(t, IsUNCPath("/mnt/installers/app.msi"))
+
+	share, err := shareRoot(`\\fs01\installers\tools\app.msi`)
+	assert.Nil(t, err)
+	assert.Equal(t, `\\fs01\installers`, share)
+
+	for _, invalid := range []string{`\\fs01`, `\\fs01\installers`, `\\\installers\app.msi`} {
+		_, err = shareRoot(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestAcquireShare(t *testing.T) {
+	mockLog := log.NewMockLog()
+	var connects, disconnects int
+	existing := false
+	connectShare = func(share string, auth ShareAuth) (bool, error) {
+		connects++
+		return existing, nil
+	}
+	disconnectShare = func(share string) error {
+		disconnects++
+		return nil
+	}
+	defer func() {
+		connectShare = connectPlatformShare
+		disconnectShare = disconnectPlatformShare
+	}()
+	auth := ShareAuth{Username: `CORP\deploy`, Password: "secret"}
+
+	// the concurrent downloads share the connection, the last one disconnects it
+	releaseFirst, err := acquireShare(mockLog, `\\fs01\installers`, auth)
+	assert.Nil(t, err)
+	releaseSecond, err := acquireShare(mockLog, `\\FS01\installers`, auth)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, connects)
+	releaseFirst()
+	assert.Equal(t, 0, disconnects)
+	releaseSecond()
+	assert.Equal(t, 1, disconnects)
+
+	// a connection the agent did not open is never disconnected
+	existing = true
+	release, err := acquireShare(mockLog, `\\fs01\installers`, auth)
+	assert.Nil(t, err)
+	release()
+	assert.Equal(t, 2, connects)
+	assert.Equal(t, 1, disconnects)
+
+	connectShare = func(share string, auth ShareAuth) (bool, error) {
+		return false, errors.New("access denied")
+	}
+	_, err = acquireShare(mockLog, `\\fs01\installers`, auth)
+	assert.NotNil(t, err)
+	assert.Empty(t, shareConnections)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
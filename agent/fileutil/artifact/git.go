@@ -0,0 +1,156 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package artifact
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+// SourceTypeGit is the source type of the files of git repositories fetched over ssh.
+const SourceTypeGit = "git"
+
+// GitSource selects the file of a git repository downloaded with SourceTypeGit.
+type GitSource struct {
+	// Ref is the branch, the tag or the full id of the commit the file is read at.
+	// The default branch of the repository is used without it.
+	Ref string
+
+	// Path is the path of the file in the repository.
+	Path string
+
+	// PrivateKey is the deploy key of the repository. It is only held by a private ssh-agent for the download,
+	// and never written to disk.
+	PrivateKey string
+
+	// KnownHosts are the known_hosts lines of the server, the known hosts of the user of the agent are used without them.
+	KnownHosts string
+}
+
+// commitID matches the full id of a commit, which is fetched by id instead of by name.
+var commitID = regexp.MustCompile(`^[0-9a-fA-F]{40}$`)
+
+// startKeyAgent is the private ssh-agent of the platform, stubbed by the tests.
+var startKeyAgent = startPlatformKeyAgent
+
+// gitDownload fetches the commit of the ref from the repository, with a shallow fetch into a temporary bare
+// repository, and copies the file at its path to the destination directory.
+// ssh authenticates with the key of the source, held by a private ssh-agent, and checks the host key of the server.
+func gitDownload(log log.T, input DownloadInput, destinationDir string) (output DownloadOutput, err error) {
+	log.Debugf("attempting to download from git repository %v", input.SourceURL)
+	if input.Git == nil || strings.Trim(input.Git.Path, "/") == "" {
+		return output, errors.New("the path of the file in the git repository is required")
+	}
+	source := *input.Git
+	workDir, err := ioutil.TempDir(destinationDir, "git")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(workDir)
+
+	env := append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_SSH_COMMAND="+sshCommand(workDir, source))
+	if source.KnownHosts != "" {
+		if err = ioutil.WriteFile(filepath.Join(workDir, "known_hosts"), []byte(source.KnownHosts+"\n"), 0600); err != nil {
+			return
+		}
+	}
+	if source.PrivateKey != "" {
+		var socket string
+		var stop func()
+		if socket, stop, err = startKeyAgent(workDir, source.PrivateKey); err != nil {
+			return output, fmt.Errorf("failed to load the key of %v: %v", input.SourceURL, err)
+		}
+		defer stop()
+		env = append(env, "SSH_AUTH_SOCK="+socket)
+	}
+
+	repository := filepath.Join(workDir, "repository")
+	if _, err = runGit(env, workDir, "init", "--quiet", "--bare", repository); err != nil {
+		return
+	}
+	ref := source.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if _, err = runGit(env, repository, "fetch", "--quiet", "--no-tags", "--depth", "1", input.SourceURL, ref); err != nil {
+		return output, fmt.Errorf("failed to fetch %v of %v: %v", ref, input.SourceURL, err)
+	}
+	if commitID.MatchString(ref) {
+		var fetched []byte
+		if fetched, err = runGit(env, repository, "rev-parse", "FETCH_HEAD"); err != nil {
+			return
+		}
+		if !strings.EqualFold(strings.TrimSpace(string(fetched)), ref) {
+			return output, fmt.Errorf("fetched commit %v instead of %v", strings.TrimSpace(string(fetched)), ref)
+		}
+	}
+	filePath := strings.Trim(path.Clean("/"+filepath.ToSlash(source.Path)), "/")
+	content, err := runGit(env, repository, "cat-file", "blob", "FETCH_HEAD:"+filePath)
+	if err != nil {
+		return output, fmt.Errorf("failed to read %v at %v of %v: %v", filePath, ref, input.SourceURL, err)
+	}
+
+	urlHash := md5.Sum([]byte(input.SourceURL + "@" + ref + ":" + filePath))
+	localFilePath := filepath.Join(destinationDir, fmt.Sprintf("%x_%v", urlHash, path.Base(filePath)))
+	if _, err = FileCopy(log, localFilePath, bytes.NewReader(content)); err != nil {
+		return
+	}
+	output.LocalFilePath = localFilePath
+	output.IsUpdated = true
+	output.IsHashMatched, err = VerifyHash(log, input, output)
+	return
+}
+
+// sshCommand returns the ssh command git connects with. It never prompts, only offers the keys of the ssh-agent
+// when the source has a key, and checks the host key against the known hosts of the source if given.
+func sshCommand(workDir string, source GitSource) string {
+	command := "ssh -o BatchMode=yes -o StrictHostKeyChecking=yes"
+	if source.PrivateKey != "" {
+		command += " -o IdentityFile=none"
+	}
+	if source.KnownHosts != "" {
+		command += " -o UserKnownHostsFile=" + quoteShellArgument(filepath.ToSlash(filepath.Join(workDir, "known_hosts")))
+	}
+	return command
+}
+
+// quoteShellArgument quotes an argument of the ssh command, which git runs with the shell.
+func quoteShellArgument(argument string) string {
+	return "'" + strings.Replace(argument, "'", `'\''`, -1) + "'"
+}
+
+// runGit runs git in a directory and returns its output, or an error with its standard error.
+func runGit(env []string, dir string, args ...string) ([]byte, error) {
+	command := exec.Command("git", args...)
+	command.Dir = dir
+	command.Env = env
+	var stderr bytes.Buffer
+	command.Stderr = &stderr
+	output, err := command.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %v: %v %v", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build darwin freebsd linux netbsd openbsd
+
+package artifact
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+)
+
+const (
+	// keyAgentStartTimeout is how long the private ssh-agent has to create its socket.
+	keyAgentStartTimeout = 5 * time.Second
+
+	// keyLifetime is the lifetime of the key in the private ssh-agent, in case the agent outlives the download.
+	keyLifetime = "3600"
+)
+
+// startPlatformKeyAgent starts a ssh-agent listening on a socket of the private directory, and gives it the key
+// through the standard input of ssh-add so that the key is only held in memory. stop kills the ssh-agent.
+func startPlatformKeyAgent(dir string, privateKey string) (socket string, stop func(), err error) {
+	socket = filepath.Join(dir, "agent.sock")
+	agent := exec.Command("ssh-agent", "-D", "-a", socket)
+	if err = agent.Start(); err != nil {
+		return "", nil, err
+	}
+	stop = func() {
+		agent.Process.Kill()
+		agent.Wait()
+	}
+	for deadline := time.Now().Add(keyAgentStartTimeout); !fileutil.Exists(socket); time.Sleep(50 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			stop()
+			return "", nil, fmt.Errorf("ssh-agent did not create %v", socket)
+		}
+	}
+
+	add := exec.Command("ssh-add", "-q", "-t", keyLifetime, "-")
+	add.Env = []string{"SSH_AUTH_SOCK=" + socket}
+	add.Stdin = strings.NewReader(strings.TrimSpace(privateKey) + "\n")
+	var stderr bytes.Buffer
+	add.Stderr = &stderr
+	if err = add.Run(); err != nil {
+		stop()
+		return "", nil, fmt.Errorf("ssh-add: %v %v", err, strings.TrimSpace(stderr.String()))
+	}
+	return socket, stop, nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build darwin freebsd linux netbsd openbsd
+
+package artifact
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// commitFile commits the content of a file to the repository and returns the id of the commit.
+func commitFile(t *testing.T, repository string, name string, content string) string {
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(repository, name), []byte(content), 0600))
+	for _, args := range [][]string{{"add", name}, {"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", content}} {
+		output, err := exec.Command("git", append([]string{"-C", repository}, args...)...).CombinedOutput()
+		assert.Nil(t, err, string(output))
+	}
+	id, err := exec.Command("git", "-C", repository, "rev-parse", "HEAD").Output()
+	assert.Nil(t, err)
+	return strings.TrimSpace(string(id))
+}
+
+func TestGitDownload(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "git")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	repository := filepath.Join(dir, "origin")
+	output, err := exec.Command("git", "init", "--quiet", repository).CombinedOutput()
+	assert.Nil(t, err, string(output))
+	output, err = exec.Command("git", "-C", repository, "symbolic-ref", "HEAD", "refs/heads/main").CombinedOutput()
+	assert.Nil(t, err, string(output))
+	first := commitFile(t, repository, "app.conf", "v1")
+	output, err = exec.Command("git", "-C", repository, "tag", "v1").CombinedOutput()
+	assert.Nil(t, err, string(output))
+	commitFile(t, repository, "app.conf", "v2")
+
+	// the key is handed to the private ssh-agent
+	defer func() { startKeyAgent = startPlatformKeyAgent }()
+	var keys []string
+	startKeyAgent = func(dir string, privateKey string) (string, func(), error) {
+		keys = append(keys, privateKey)
+		return filepath.Join(dir, "agent.sock"), func() {}, nil
+	}
+
+	mockLog := log.NewMockLog()
+	destination := filepath.Join(dir, "download")
+	for ref, content := range map[string]string{"": "v2", "main": "v2", "v1": "v1", first: "v1"} {
+		input := DownloadInput{
+			SourceURL:            repository,
+			SourceType:           SourceTypeGit,
+			DestinationDirectory: destination,
+			Git:                  &GitSource{Ref: ref, Path: "/app.conf", PrivateKey: "key"},
+		}
+		downloadOutput, err := Download(mockLog, input)
+		assert.Nil(t, err, ref)
+		assert.True(t, downloadOutput.IsHashMatched)
+		downloaded, err := ioutil.ReadFile(downloadOutput.LocalFilePath)
+		assert.Nil(t, err)
+		assert.Equal(t, content, string(downloaded), ref)
+	}
+	assert.Equal(t, []string{"key", "key", "key", "key"}, keys)
+
+	// the work directory holding the fetched repository is deleted
+	entries, err := ioutil.ReadDir(destination)
+	assert.Nil(t, err)
+	for _, entry := range entries {
+		assert.False(t, entry.IsDir(), entry.Name())
+	}
+
+	// missing file, ref and path
+	for _, source := range []*GitSource{{Path: "missing.conf"}, {Ref: "v3", Path: "app.conf"}, {Path: "/"}, nil} {
+		_, err = Download(mockLog, DownloadInput{SourceURL: repository, SourceType: SourceTypeGit, DestinationDirectory: destination, Git: source})
+		assert.NotNil(t, err, "%v", source)
+	}
+}
+
+func TestSSHCommand(t *testing.T) {
+	command := sshCommand("/var/lib/amazon/ssm/download/git1", GitSource{PrivateKey: "key", KnownHosts: "github.com ssh-ed25519 AAAA"})
+	assert.Equal(t, "ssh -o BatchMode=yes -o StrictHostKeyChecking=yes -o IdentityFile=none "+
+		"-o UserKnownHostsFile='/var/lib/amazon/ssm/download/git1/known_hosts'", command)
+	assert.Equal(t, "ssh -o BatchMode=yes -o StrictHostKeyChecking=yes", sshCommand("/tmp", GitSource{}))
+}
+
+func TestStartKeyAgent(t *testing.T) {
+	for _, tool := range []string{"ssh-agent", "ssh-add", "ssh-keygen"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%v is not installed", tool)
+		}
+	}
+	dir, err := ioutil.TempDir("", "git")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "deploy")
+	output, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", "deploy", "-f", keyFile).CombinedOutput()
+	assert.Nil(t, err, string(output))
+	privateKey, err := ioutil.ReadFile(keyFile)
+	assert.Nil(t, err)
+	os.Remove(keyFile)
+
+	socket, stop, err := startKeyAgent(dir, string(privateKey))
+	assert.Nil(t, err)
+	list := exec.Command("ssh-add", "-l")
+	list.Env = []string{"SSH_AUTH_SOCK=" + socket}
+	output, err = list.Output()
+	assert.Nil(t, err)
+	assert.Contains(t, string(output), "deploy (ED25519)")
+	// the key is only held by the ssh-agent
+	entries, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"agent.sock", "deploy.pub"}, names)
+
+	// the key is gone with the ssh-agent
+	stop()
+	list = exec.Command("ssh-add", "-l")
+	list.Env = []string{"SSH_AUTH_SOCK=" + socket}
+	assert.NotNil(t, list.Run())
+
+	_, _, err = startKeyAgent(dir, "not a key")
+	assert.NotNil(t, err)
+}
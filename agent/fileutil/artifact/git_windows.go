@@ -0,0 +1,26 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build windows
+
+package artifact
+
+import (
+	"errors"
+)
+
+// startPlatformKeyAgent is not supported, the ssh-agent of Windows is a service shared by all the users
+// which would keep the key after the download.
+func startPlatformKeyAgent(dir string, privateKey string) (socket string, stop func(), err error) {
+	return "", nil, errors.New("keys of git sources are only supported on Linux and macOS")
+}
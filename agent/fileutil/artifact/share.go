@@ -0,0 +1,123 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package artifact
+
+import (
+	"crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+// ShareAuth holds the credentials of a network share.
+type ShareAuth struct {
+	// Username is the domain user, e.g. CORP\deploy or deploy@corp.example.com.
+	Username string
+
+	// Password is the password of the user.
+	Password string
+}
+
+var (
+	// connectShare and disconnectShare are the connections of the platform, stubbed by the tests.
+	connectShare    = connectPlatformShare
+	disconnectShare = disconnectPlatformShare
+
+	shareConnectionsLock sync.Mutex
+	// shareConnections counts the downloads using each share the agent connected to.
+	shareConnections = map[string]int{}
+)
+
+// IsUNCPath returns true if the path is a file on a network share, e.g. \\server\share\installer.msi.
+func IsUNCPath(path string) bool {
+	return strings.HasPrefix(path, `\\`)
+}
+
+// shareRoot returns the share of a UNC path, e.g. \\server\share.
+func shareRoot(path string) (string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(path, `\\`), `\`, 3)
+	if len(parts) < 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", fmt.Errorf("invalid UNC path %v, expected \\\\server\\share\\file", path)
+	}
+	return `\\` + parts[0] + `\` + parts[1], nil
+}
+
+// shareDownload copies a file from a network share, connected with the credentials of the input if given.
+// Kerberos or NTLM is negotiated by the platform.
+func shareDownload(log log.T, input DownloadInput, destinationDir string) (output DownloadOutput, err error) {
+	log.Debugf("attempting to download from network share %v", input.SourceURL)
+	share, err := shareRoot(input.SourceURL)
+	if err != nil {
+		return
+	}
+	if input.ShareAuth != nil {
+		var release func()
+		if release, err = acquireShare(log, share, *input.ShareAuth); err != nil {
+			return output, fmt.Errorf("failed to connect to %v: %v", share, err)
+		}
+		defer release()
+	}
+
+	source, err := os.Open(input.SourceURL)
+	if err != nil {
+		return output, fmt.Errorf("failed to open %v: %v", input.SourceURL, err)
+	}
+	defer source.Close()
+
+	urlHash := md5.Sum([]byte(input.SourceURL))
+	fileName := input.SourceURL[strings.LastIndex(input.SourceURL, `\`)+1:]
+	localFilePath := filepath.Join(destinationDir, fmt.Sprintf("%x_%v", urlHash, fileName))
+	if _, err = FileCopy(log, localFilePath, source); err != nil {
+		return
+	}
+	output.LocalFilePath = localFilePath
+	output.IsUpdated = true
+	output.IsHashMatched, err = VerifyHash(log, input, output)
+	return
+}
+
+// acquireShare connects to the share unless another download already did, and returns the function releasing it.
+// The last download releasing the share disconnects it. A connection the agent did not open, e.g. a share mapped
+// by the administrator, is used as is and never disconnected.
+func acquireShare(log log.T, share string, auth ShareAuth) (release func(), err error) {
+	key := strings.ToLower(share)
+	shareConnectionsLock.Lock()
+	defer shareConnectionsLock.Unlock()
+	if shareConnections[key] == 0 {
+		var existing bool
+		if existing, err = connectShare(share, auth); err != nil {
+			return nil, err
+		}
+		if existing {
+			log.Infof("%v is already connected, downloading through the existing connection", share)
+			return func() {}, nil
+		}
+	}
+	shareConnections[key]++
+	return func() {
+		shareConnectionsLock.Lock()
+		defer shareConnectionsLock.Unlock()
+		if shareConnections[key]--; shareConnections[key] > 0 {
+			return
+		}
+		delete(shareConnections, key)
+		if err := disconnectShare(share); err != nil {
+			log.Warnf("failed to disconnect from %v: %v", share, err)
+		}
+	}, nil
+}
@@ -0,0 +1,30 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build darwin freebsd linux netbsd openbsd
+
+package artifact
+
+import (
+	"errors"
+)
+
+// connectPlatformShare is not supported, network shares are mounted by the administrator on these platforms.
+func connectPlatformShare(share string, auth ShareAuth) (existing bool, err error) {
+	return false, errors.New("credentials for network shares are only supported on Windows")
+}
+
+// disconnectPlatformShare is not supported on these platforms.
+func disconnectPlatformShare(share string) error {
+	return nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build windows
+
+package artifact
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	// resourceTypeDisk is RESOURCETYPE_DISK, a shared directory.
+	resourceTypeDisk = 0x1
+
+	// connectTemporary is CONNECT_TEMPORARY, the connection is not remembered for the next logon.
+	connectTemporary = 0x4
+
+	// errorAlreadyAssigned is ERROR_ALREADY_ASSIGNED, the share is already connected.
+	errorAlreadyAssigned = 85
+
+	// errorSessionCredentialConflict is ERROR_SESSION_CREDENTIAL_CONFLICT, the server is already connected
+	// with other credentials.
+	errorSessionCredentialConflict = 1219
+)
+
+var (
+	mprDll                     = windows.NewLazyDLL(filepath.Join(os.Getenv("SystemRoot"), "System32", "mpr.dll"))
+	procWNetAddConnection2W    = mprDll.NewProc("WNetAddConnection2W")
+	procWNetCancelConnection2W = mprDll.NewProc("WNetCancelConnection2W")
+)
+
+// netResource is the NETRESOURCE structure.
+// https://msdn.microsoft.com/en-us/library/windows/desktop/aa385353(v=vs.85).aspx
+type netResource struct {
+	Scope       uint32
+	Type        uint32
+	DisplayType uint32
+	Usage       uint32
+	LocalName   *uint16
+	RemoteName  *uint16
+	Comment     *uint16
+	Provider    *uint16
+}
+
+// connectPlatformShare connects to the share with the credentials, without mapping a drive letter.
+// existing is true when the share or its server was already connected, the connection is then left to its owner.
+func connectPlatformShare(share string, auth ShareAuth) (existing bool, err error) {
+	remoteName, err := syscall.UTF16PtrFromString(share)
+	if err != nil {
+		return
+	}
+	username, err := syscall.UTF16PtrFromString(auth.Username)
+	if err != nil {
+		return
+	}
+	password, err := syscall.UTF16PtrFromString(auth.Password)
+	if err != nil {
+		return
+	}
+	resource := netResource{Type: resourceTypeDisk, RemoteName: remoteName}
+	code, _, _ := procWNetAddConnection2W.Call(
+		uintptr(unsafe.Pointer(&resource)),
+		uintptr(unsafe.Pointer(password)),
+		uintptr(unsafe.Pointer(username)),
+		connectTemporary)
+	switch code {
+	case 0:
+		return false, nil
+	case errorAlreadyAssigned, errorSessionCredentialConflict:
+		return true, nil
+	default:
+		return false, syscall.Errno(code)
+	}
+}
+
+// disconnectPlatformShare closes the connection to the share, even if files are still open.
+func disconnectPlatformShare(share string) error {
+	remoteName, err := syscall.UTF16PtrFromString(share)
+	if err != nil {
+		return err
+	}
+	if code, _, _ := procWNetCancelConnection2W.Call(uintptr(unsafe.Pointer(remoteName)), 0, 1); code != 0 {
+		return syscall.Errno(code)
+	}
+	return nil
+}
@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
@@ -161,6 +162,35 @@ func WriteIntoFileWithPermissions(absolutePath, content string, perm os.FileMode
 	return
 }
 
+// WriteFileAtomic writes the content into a temporary file of the destination directory, flushes it to disk and
+// renames it over the destination, so that a crash never leaves a partially written file behind.
+func WriteFileAtomic(absolutePath string, content []byte, perm os.FileMode) (err error) {
+	tempFile, err := ioutil.TempFile(filepath.Dir(absolutePath), filepath.Base(absolutePath)+".tmp")
+	if err != nil {
+		return fmt.Errorf("couldn't create temporary file - %v", err)
+	}
+	tempPath := tempFile.Name()
+	defer func() {
+		if err != nil {
+			os.Remove(tempPath)
+		}
+	}()
+
+	if _, err = tempFile.Write(content); err == nil {
+		err = tempFile.Sync()
+	}
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't write into file - %v", err)
+	}
+	if err = os.Chmod(tempPath, perm); err != nil {
+		return
+	}
+	return os.Rename(tempPath, absolutePath)
+}
+
 // IsDirEmpty returns true if the given directory is empty else it returns false
 func IsDirEmpty(location string) (bool, error) {
 	f, err := os.Open(location)
@@ -15,6 +15,7 @@ package fileutil
 
 import (
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
@@ -210,3 +211,42 @@ type ioUtilStub struct {
 func (a ioUtilStub) ReadFile(filename string) ([]byte, error) {
 	return a.b, a.err
 }
+
+func TestSecureRemoveAll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secureremove")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	nested := filepath.Join(dir, "nested")
+	assert.Nil(t, os.Mkdir(nested, RWXPermission))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), RWPermission))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(nested, "empty.txt"), []byte{}, RWPermission))
+
+	assert.Nil(t, SecureRemoveAll(dir))
+	assert.False(t, Exists(dir))
+
+	// removing a missing directory is not an error
+	assert.Nil(t, SecureRemoveAll(dir))
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomic")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state")
+	assert.Nil(t, WriteFileAtomic(path, []byte("first"), RWPermission))
+	assert.Nil(t, WriteFileAtomic(path, []byte("second"), RWPermission))
+
+	content, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "second", string(content))
+
+	// no temporary file is left behind
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(files))
+
+	// the destination is untouched when its directory does not exist
+	assert.NotNil(t, WriteFileAtomic(filepath.Join(dir, "missing", "state"), []byte("third"), RWPermission))
+}
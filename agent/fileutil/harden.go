@@ -7,7 +7,8 @@ import (
 )
 
 const (
-	RWPermission = 0600
+	RWPermission  = 0600
+	RWXPermission = 0700
 )
 
 // HardenedWriteFile calls ioutil.WriteFile and guarantees a hardened permission
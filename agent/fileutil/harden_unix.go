@@ -49,3 +49,11 @@ func Harden(path string) (err error) {
 	}
 	return
 }
+
+// HardenDirectory restricts the access to the provided directory to root only.
+func HardenDirectory(path string) (err error) {
+	if err = os.Chmod(path, RWXPermission); err != nil {
+		return
+	}
+	return os.Chown(path, int(rootUid), int(rootGid))
+}
@@ -73,3 +73,8 @@ func mallocSID(sidSize int) (sidPtr *windows.SID, sidLen uint32) {
 	sidLen = uint32(len(sid))
 	return
 }
+
+// HardenDirectory restricts the access to the provided directory to administrators only.
+func HardenDirectory(path string) (err error) {
+	return Harden(path)
+}
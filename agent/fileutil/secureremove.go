@@ -0,0 +1,63 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+//Package fileutil contains utilities for working with the file system.
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// overwriteBufferSize is the size of the buffer used to overwrite the content of files.
+const overwriteBufferSize = 64 * 1024
+
+// SecureRemoveAll overwrites the content of every regular file under path with zeros, then removes path
+// and everything it contains. Files which cannot be overwritten are still removed.
+func SecureRemoveAll(path string) (err error) {
+	if !Exists(path) {
+		return nil
+	}
+	walkErr := filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.Mode().IsRegular() {
+			return nil
+		}
+		return overwriteFile(p, fi.Size())
+	})
+	if err = os.RemoveAll(path); err != nil {
+		return
+	}
+	return walkErr
+}
+
+// overwriteFile overwrites the first size bytes of the file with zeros and syncs it to disk.
+func overwriteFile(path string, size int64) (err error) {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	zeros := make([]byte, overwriteBufferSize)
+	for remaining := size; remaining > 0; {
+		chunk := int64(len(zeros))
+		if remaining < chunk {
+			chunk = remaining
+		}
+		if _, err = file.Write(zeros[:chunk]); err != nil {
+			return
+		}
+		remaining -= chunk
+	}
+	return file.Sync()
+}
@@ -15,7 +15,6 @@
 package coremanager
 
 import (
-	"path"
 	"sync"
 	"time"
 
@@ -25,6 +24,7 @@ import (
 	"github.com/aws/amazon-ssm-agent/agent/fileutil"
 	"github.com/aws/amazon-ssm-agent/agent/framework/coreplugins"
 	logger "github.com/aws/amazon-ssm-agent/agent/log"
+	commandStateHelper "github.com/aws/amazon-ssm-agent/agent/message/statemanager"
 	"github.com/aws/amazon-ssm-agent/agent/platform"
 	"github.com/aws/amazon-ssm-agent/agent/rebooter"
 )
@@ -100,35 +100,16 @@ func NewCoreManager(instanceIdPtr *string, regionPtr *string, log logger.T) (cm
 	}, nil
 }
 
-// initializeBookkeepingLocations - initializes all folder locations required for bookkeeping
+// initializeBookkeepingLocations - initializes the store of the states of the commands, importing the state
+// files of the pending, current, completed and corrupt folders of the previous versions of the agent
 func initializeBookkeepingLocations(log logger.T, instanceID string) bool {
 
-	//Create folders pending, current, completed, corrupt under the location DefaultLogDirPath/<instanceId>
-	log.Info("Initializing bookkeeping folders")
-	initStatus := true
-	folders := []string{
-		appconfig.DefaultLocationOfPending,
-		appconfig.DefaultLocationOfCurrent,
-		appconfig.DefaultLocationOfCompleted,
-		appconfig.DefaultLocationOfCorrupt}
-
-	for _, folder := range folders {
-
-		directoryName := path.Join(appconfig.DefaultDataStorePath,
-			instanceID,
-			appconfig.DefaultCommandRootDirName,
-			appconfig.DefaultLocationOfState,
-			folder)
-
-		err := fileutil.MakeDirs(directoryName)
-		if err != nil {
-			log.Errorf("Encountered error while creating folders for internal state management. %v", err)
-			initStatus = false
-			break
-		}
+	log.Info("Initializing bookkeeping store")
+	if err := commandStateHelper.Initialize(log, instanceID); err != nil {
+		log.Errorf("Encountered error while initializing the store for internal state management. %v", err)
+		return false
 	}
-
-	return initStatus
+	return true
 }
 
 // Start executes the registered core plugins while watching for reboot request
@@ -15,14 +15,17 @@
 package coreplugins
 
 import (
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
 	"github.com/aws/amazon-ssm-agent/agent/context"
-	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/contracts/plugin"
 	"github.com/aws/amazon-ssm-agent/agent/health"
 	message "github.com/aws/amazon-ssm-agent/agent/message/processor"
+	"github.com/aws/amazon-ssm-agent/agent/metrics"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/external"
 )
 
 // PluginRegistry stores a set of core plugins.
-type PluginRegistry []contracts.ICorePlugin
+type PluginRegistry []plugin.ICorePlugin
 
 // registeredCorePlugins stores the registered core plugins.
 var registeredCorePlugins PluginRegistry
@@ -37,7 +40,7 @@ func RegisteredCorePlugins(context context.T) *PluginRegistry {
 
 // register core plugins here
 func loadCorePlugins(context context.T) {
-	registeredCorePlugins = make([]contracts.ICorePlugin, 2)
+	registeredCorePlugins = make([]plugin.ICorePlugin, 3)
 
 	// registering the health core plugin
 	registeredCorePlugins[0] = health.NewHealthCheck(context)
@@ -45,5 +48,15 @@ func loadCorePlugins(context context.T) {
 	// registering the messages core plugin
 	registeredCorePlugins[1] = message.NewProcessor(context)
 
-	//registeredCorePlugins[2] = config
+	// registering the metrics core plugin, which serves the metrics when they are enabled
+	registeredCorePlugins[2] = metrics.NewServer(context)
+
+	//registeredCorePlugins[3] = config
+
+	// registering the long-running plugins shipped as separate executables
+	if config, err := appconfig.Config(false); err == nil {
+		for _, longRunningPlugin := range external.DiscoverLongRunning(context.Log(), config.ExternalPlugins.Directory, config.ExternalPlugins.ManifestDirectory) {
+			registeredCorePlugins = append(registeredCorePlugins, longRunningPlugin)
+		}
+	}
 }
@@ -0,0 +1,96 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package engine contains the general purpose plugin runner of the plugin framework.
+// branching contains the onSuccess/onFailure step branching.
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+// executionOrder returns the steps of the document in the order they run when no branching happens.
+// Steps are ordered by name, so that the order is stable between executions.
+func executionOrder(plugins map[string]*contracts.Configuration) (order []string) {
+	for pluginID := range plugins {
+		order = append(order, pluginID)
+	}
+	sort.Strings(order)
+	return
+}
+
+// nextStep returns the index of the step to run after the step at the given index, or len(order) when the
+// document must stop. The step declares with onSuccess/onFailure whether to continue with the next step,
+// to exit, or to jump to another step by name. A step never runs twice, jumping back to a step which
+// already ran stops the document.
+func nextStep(log log.T, order []string, index int, config contracts.Configuration, status contracts.ResultStatus, pluginOutputs map[string]*contracts.PluginResult) int {
+	var action string
+	switch status {
+	case contracts.ResultStatusSuccess:
+		action = config.OnSuccess
+	case contracts.ResultStatusFailed, contracts.ResultStatusTimedOut, contracts.ResultStatusBlockedByAntimalware:
+		action = config.OnFailure
+	default:
+		// cancelled steps and steps requesting a reboot do not branch
+		return index + 1
+	}
+
+	switch strings.ToLower(action) {
+	case "", contracts.StepActionContinue:
+		return index + 1
+	case contracts.StepActionExit:
+		log.Infof("Step %v finished with status %v and requested to exit", order[index], status)
+		return len(order)
+	}
+
+	for next, pluginID := range order {
+		if pluginID != action {
+			continue
+		}
+		if _, ran := pluginOutputs[pluginID]; ran {
+			log.Errorf("Step %v cannot branch to %v which already ran, stopping the document", order[index], action)
+			return len(order)
+		}
+		log.Infof("Step %v finished with status %v, branching to %v", order[index], status, action)
+		return next
+	}
+
+	log.Errorf("Step %v branches to unknown step %v, stopping the document", order[index], action)
+	return len(order)
+}
+
+// skipRemainingSteps adds a skipped result for every step which did not run and returns their names.
+func skipRemainingSteps(order []string, executionPath []string, plugins map[string]*contracts.Configuration, pluginOutputs map[string]*contracts.PluginResult) (skipped []string) {
+	now := time.Now()
+	for _, pluginID := range order {
+		if _, ran := pluginOutputs[pluginID]; ran {
+			continue
+		}
+		skipped = append(skipped, pluginID)
+		pluginOutputs[pluginID] = &contracts.PluginResult{
+			Status:             contracts.ResultStatusSkipped,
+			Output:             fmt.Sprintf("Step skipped: not on the execution path %v", strings.Join(executionPath, " -> ")),
+			StartDateTime:      now,
+			EndDateTime:        now,
+			OutputS3BucketName: plugins[pluginID].OutputS3BucketName,
+			OutputS3KeyPrefix:  plugins[pluginID].OutputS3KeyPrefix,
+		}
+	}
+	return
+}
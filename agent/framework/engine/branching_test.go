@@ -0,0 +1,79 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/context"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/framework/plugin"
+	"github.com/aws/amazon-ssm-agent/agent/task"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRunPluginsBranching tests that a failed step branches to the cleanup step and that the steps
+// which are not on the execution path are reported as skipped.
+func TestRunPluginsBranching(t *testing.T) {
+	ctx := context.NewMockDefault()
+	var cancelFlag task.CancelFlag
+	sendResponse := func(messageID string, pluginID string, results map[string]*contracts.PluginResult) {}
+
+	pluginConfigs := map[string]*contracts.Configuration{
+		"1.install": {OnFailure: "3.cleanup"},
+		"2.verify":  {},
+		"3.cleanup": {OnSuccess: contracts.StepActionExit},
+		"4.report":  {},
+	}
+	results := map[string]contracts.PluginResult{
+		"1.install": {Status: contracts.ResultStatusFailed},
+		"3.cleanup": {Status: contracts.ResultStatusSuccess},
+	}
+
+	pluginRegistry := plugin.PluginRegistry{}
+	mocks := make(map[string]*plugin.Mock)
+	for name, config := range pluginConfigs {
+		mocks[name] = new(plugin.Mock)
+		if result, ok := results[name]; ok {
+			mocks[name].On("Execute", ctx, *config, cancelFlag).Return(result)
+		}
+		pluginRegistry[name] = mocks[name]
+	}
+
+	outputs := RunPlugins(ctx, "TestDocument", pluginConfigs, pluginRegistry, sendResponse, cancelFlag)
+
+	for _, mockPlugin := range mocks {
+		mockPlugin.AssertExpectations(t)
+	}
+	mocks["2.verify"].AssertNotCalled(t, "Execute", ctx, *pluginConfigs["2.verify"], cancelFlag)
+	assert.Equal(t, contracts.ResultStatusFailed, outputs["1.install"].Status)
+	assert.Equal(t, contracts.ResultStatusSuccess, outputs["3.cleanup"].Status)
+	assert.Equal(t, contracts.ResultStatusSkipped, outputs["2.verify"].Status)
+	assert.Equal(t, contracts.ResultStatusSkipped, outputs["4.report"].Status)
+	assert.Contains(t, outputs["2.verify"].Output, "1.install -> 3.cleanup")
+	assert.Contains(t, outputs["4.report"].Output, "skipped")
+}
+
+func TestNextStep(t *testing.T) {
+	ctx := context.NewMockDefault()
+	order := []string{"a", "b", "c"}
+	ran := map[string]*contracts.PluginResult{"a": {}, "b": {}}
+
+	assert.Equal(t, 2, nextStep(ctx.Log(), order, 1, contracts.Configuration{}, contracts.ResultStatusFailed, ran))
+	assert.Equal(t, 3, nextStep(ctx.Log(), order, 1, contracts.Configuration{OnFailure: "Exit"}, contracts.ResultStatusFailed, ran))
+	assert.Equal(t, 3, nextStep(ctx.Log(), order, 1, contracts.Configuration{OnSuccess: "a"}, contracts.ResultStatusSuccess, ran))
+	assert.Equal(t, 3, nextStep(ctx.Log(), order, 1, contracts.Configuration{OnSuccess: "missing"}, contracts.ResultStatusSuccess, ran))
+	assert.Equal(t, 2, nextStep(ctx.Log(), order, 1, contracts.Configuration{OnSuccess: "exit"}, contracts.ResultStatusSuccessAndReboot, ran))
+	assert.Equal(t, 2, nextStep(ctx.Log(), order, 0, contracts.Configuration{OnSuccess: "c"}, contracts.ResultStatusSuccess, map[string]*contracts.PluginResult{"a": {}}))
+}
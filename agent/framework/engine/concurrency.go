@@ -0,0 +1,163 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package engine contains the general purpose plugin runner of the plugin framework.
+// concurrency bounds the number of steps of a plugin running at the same time, across the documents.
+package engine
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/checkpoint"
+	"github.com/aws/amazon-ssm-agent/agent/context"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/framework/plugin"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/metrics"
+	"github.com/aws/amazon-ssm-agent/agent/task"
+)
+
+var (
+	// pluginSlots holds a semaphore per limited plugin, shared by all the documents the agent runs
+	pluginSlots     = make(map[string]chan struct{})
+	pluginSlotsLock sync.Mutex
+)
+
+// configuredConcurrency returns the maximum number of concurrent steps of the plugins in the agent configuration.
+var configuredConcurrency = func() map[string]int {
+	config, err := appconfig.Config(false)
+	if err != nil {
+		return nil
+	}
+	return config.Concurrency.Plugins
+}
+
+// pluginSlot returns the semaphore of a plugin, nil when the number of its steps is not limited.
+func pluginSlot(pluginID string) chan struct{} {
+	limit := configuredConcurrency()[pluginID]
+	if limit < 1 {
+		return nil
+	}
+	pluginSlotsLock.Lock()
+	defer pluginSlotsLock.Unlock()
+	slot, ok := pluginSlots[pluginID]
+	if !ok {
+		slot = make(chan struct{}, limit)
+		pluginSlots[pluginID] = slot
+	}
+	return slot
+}
+
+// acquirePluginSlot takes a slot of the plugin, once one of its steps releases it when the plugin is at its limit.
+// waiting is called with a notice before the step starts waiting. Returns false if the command got canceled meanwhile.
+func acquirePluginSlot(log log.T, pluginID string, cancelFlag task.CancelFlag, waiting func(notice string)) (release func(), ok bool) {
+	slot := pluginSlot(pluginID)
+	if slot == nil {
+		return func() {}, true
+	}
+	release = func() { <-slot }
+	select {
+	case slot <- struct{}{}:
+		return release, true
+	default:
+	}
+
+	notice := fmt.Sprintf("Waiting for a slot of %v, %v steps of the plugin are running", pluginID, cap(slot))
+	log.Info(notice)
+	waiting(notice)
+	metrics.PluginSlotWaiting.Add(1, pluginID)
+	defer metrics.PluginSlotWaiting.Add(-1, pluginID)
+	select {
+	case slot <- struct{}{}:
+		log.Infof("Got a slot of %v", pluginID)
+		return release, true
+	case <-cancelFlag.Done():
+		return nil, false
+	}
+}
+
+// runPluginInSlot runs a step in a slot of its plugin, the dry runs and the nested aws:runDocument steps do not
+// take slots. The slot is only held while the plugin executes: the step waits for its schedule and between its
+// attempts without holding a slot, so that the other steps of the plugin can run meanwhile.
+func runPluginInSlot(context context.T, p plugin.T, pluginID string, config contracts.Configuration, cancelFlag task.CancelFlag, waiting func(notice string)) (res contracts.PluginResult) {
+	if config.DryRun || isNestedRunDocument(p) || pluginSlot(pluginID) == nil {
+		return runPlugin(context, p, pluginID, config, cancelFlag)
+	}
+	slot := pluginSlotHolder{pluginID: pluginID, waiting: waiting}
+	if checkpointer, ok := p.(plugin.Checkpointer); ok {
+		return runPlugin(context, slottedCheckpointer{Checkpointer: checkpointer, pluginSlotHolder: slot}, pluginID, config, cancelFlag)
+	}
+	return runPlugin(context, slottedPlugin{T: p, pluginSlotHolder: slot}, pluginID, config, cancelFlag)
+}
+
+// pluginSlotHolder takes a slot of a plugin for each execution of a step.
+type pluginSlotHolder struct {
+	pluginID string
+	waiting  func(notice string)
+}
+
+// inSlot executes the step once it gets a slot of its plugin, and releases the slot after the execution.
+func (h pluginSlotHolder) inSlot(context context.T, cancelFlag task.CancelFlag, execute func() contracts.PluginResult) (res contracts.PluginResult) {
+	release, ok := acquirePluginSlot(context.Log(), h.pluginID, cancelFlag, h.waiting)
+	if !ok {
+		context.Log().Infof("%v canceled while waiting for a slot of its plugin", h.pluginID)
+		res.Status = contracts.ResultStatusCancelled
+		res.Code = 1
+		res.Output = fmt.Sprintf("%v canceled while waiting for a slot of its plugin", h.pluginID)
+		return
+	}
+	defer release()
+	return execute()
+}
+
+// slottedPlugin executes a plugin in a slot.
+type slottedPlugin struct {
+	plugin.T
+	pluginSlotHolder
+}
+
+// Execute executes the plugin in a slot.
+func (p slottedPlugin) Execute(context context.T, config contracts.Configuration, cancelFlag task.CancelFlag) contracts.PluginResult {
+	return p.inSlot(context, cancelFlag, func() contracts.PluginResult {
+		return p.T.Execute(context, config, cancelFlag)
+	})
+}
+
+// slottedCheckpointer executes a plugin resuming from its checkpoints in a slot.
+type slottedCheckpointer struct {
+	plugin.Checkpointer
+	pluginSlotHolder
+}
+
+// Execute executes the plugin in a slot.
+func (p slottedCheckpointer) Execute(context context.T, config contracts.Configuration, cancelFlag task.CancelFlag) contracts.PluginResult {
+	return p.inSlot(context, cancelFlag, func() contracts.PluginResult {
+		return p.Checkpointer.Execute(context, config, cancelFlag)
+	})
+}
+
+// ExecuteWithCheckpoint executes the plugin with its checkpoints in a slot.
+func (p slottedCheckpointer) ExecuteWithCheckpoint(context context.T, config contracts.Configuration, cancelFlag task.CancelFlag, checkpoints checkpoint.T) contracts.PluginResult {
+	return p.inSlot(context, cancelFlag, func() contracts.PluginResult {
+		return p.Checkpointer.ExecuteWithCheckpoint(context, config, cancelFlag, checkpoints)
+	})
+}
+
+// isNestedRunDocument returns true for the aws:runDocument steps of the child documents. They run within the slot
+// of the aws:runDocument step of the top document, waiting for another slot would deadlock at a limit of 1.
+func isNestedRunDocument(p plugin.T) bool {
+	runDocument, ok := p.(*runDocumentPlugin)
+	return ok && runDocument.depth > 0
+}
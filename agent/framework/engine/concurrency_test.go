@@ -0,0 +1,149 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/context"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/framework/plugin"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/task"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// stubConcurrency limits the plugins to the given number of concurrent steps, with fresh slots.
+func stubConcurrency(limits map[string]int) func() {
+	originalConcurrency, originalSlots := configuredConcurrency, pluginSlots
+	configuredConcurrency = func() map[string]int { return limits }
+	pluginSlots = make(map[string]chan struct{})
+	return func() { configuredConcurrency, pluginSlots = originalConcurrency, originalSlots }
+}
+
+func TestAcquirePluginSlot(t *testing.T) {
+	defer stubConcurrency(map[string]int{"aws:configurePackage": 1})()
+	logger := log.NewMockLog()
+	notWaiting := func(string) { t.Error("the step should not wait") }
+
+	// plugins without a limit never wait
+	release, ok := acquirePluginSlot(logger, "aws:runShellScript", task.NewChanneledCancelFlag(), notWaiting)
+	assert.True(t, ok)
+	release()
+
+	release, ok = acquirePluginSlot(logger, "aws:configurePackage", task.NewChanneledCancelFlag(), notWaiting)
+	assert.True(t, ok)
+
+	// the second step waits until the first one releases the slot
+	waiting := make(chan string, 1)
+	acquired := make(chan bool)
+	go func() {
+		secondRelease, secondOk := acquirePluginSlot(logger, "aws:configurePackage", task.NewChanneledCancelFlag(), func(notice string) { waiting <- notice })
+		if secondOk {
+			secondRelease()
+		}
+		acquired <- secondOk
+	}()
+	assert.Contains(t, <-waiting, "Waiting for a slot of aws:configurePackage")
+	select {
+	case <-acquired:
+		t.Fatal("the second step got a slot while the first one is running")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	assert.True(t, <-acquired)
+}
+
+func TestAcquirePluginSlotCanceled(t *testing.T) {
+	defer stubConcurrency(map[string]int{"aws:configurePackage": 1})()
+	logger := log.NewMockLog()
+
+	release, ok := acquirePluginSlot(logger, "aws:configurePackage", task.NewChanneledCancelFlag(), func(string) {})
+	assert.True(t, ok)
+	defer release()
+
+	cancelFlag := task.NewChanneledCancelFlag()
+	res := runPluginInSlot(context.NewMockDefault(), nil, "aws:configurePackage", contracts.Configuration{}, cancelFlag, func(string) {
+		cancelFlag.Set(task.Canceled)
+	})
+	assert.Equal(t, contracts.ResultStatusCancelled, res.Status)
+}
+
+// TestNestedRunDocumentInSlot tests that the nested aws:runDocument steps do not wait for the slot of the top one.
+func TestNestedRunDocumentInSlot(t *testing.T) {
+	defer stubConcurrency(map[string]int{appconfig.PluginNameAwsRunDocument: 1})()
+	defer stubPersistPluginInformation()()
+	original := getDocumentContent
+	defer func() { getDocumentContent = original }()
+	getDocumentContent = func(log log.T, name string) (string, error) {
+		if name == "Acme-Parent" {
+			return `{"runtimeConfig": {"aws:runDocument": {"properties": {"documentType": "SSMDocument", "documentPath": "Acme-Child"}}}}`, nil
+		}
+		return `{"runtimeConfig": {"step": {"properties": "echo child"}}}`, nil
+	}
+	step := new(plugin.Mock)
+	step.On("Execute", mock.Anything, mock.Anything, mock.Anything).Return(contracts.PluginResult{Status: contracts.ResultStatusSuccess})
+
+	done := make(chan map[string]*contracts.PluginResult)
+	go func() {
+		done <- RunPlugins(context.NewMockDefault(), "document", map[string]*contracts.Configuration{
+			appconfig.PluginNameAwsRunDocument: {
+				OrchestrationDirectory: t.TempDir(),
+				Properties:             map[string]interface{}{"documentType": "SSMDocument", "documentPath": "Acme-Parent"},
+			},
+		}, plugin.PluginRegistry{"step": step}, func(string, string, map[string]*contracts.PluginResult) {}, task.NewChanneledCancelFlag())
+	}()
+	select {
+	case outputs := <-done:
+		assert.Equal(t, contracts.ResultStatusSuccess, outputs[appconfig.PluginNameAwsRunDocument].Status)
+		step.AssertExpectations(t)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the nested aws:runDocument step waits for the slot of its parent")
+	}
+}
+
+// TestDelayedStepWaitsWithoutSlot tests that a step only holds the slot of its plugin while it executes,
+// not while it waits for its delay or to be retried.
+func TestDelayedStepWaitsWithoutSlot(t *testing.T) {
+	defer stubConcurrency(map[string]int{"step": 1})()
+	var delays []time.Duration
+	defer stubSchedule(&fakeClock{now: time.Now()}, &delays, true)()
+	defer func(wait func(time.Duration, task.CancelFlag) bool) { waitForRetry = wait }(waitForRetry)
+	notWaiting := func(string) { t.Error("the step should not wait for a slot") }
+
+	// the slot is free for the other steps of the plugin while the step waits
+	var freeSlots []int
+	wait := func(delay time.Duration, cancelFlag task.CancelFlag) bool {
+		freeSlots = append(freeSlots, cap(pluginSlot("step"))-len(pluginSlot("step")))
+		return true
+	}
+	waitForSchedule = wait
+	waitForRetry = wait
+
+	var heldSlots []int
+	step := new(plugin.Mock)
+	holdsSlot := func(mock.Arguments) { heldSlots = append(heldSlots, len(pluginSlot("step"))) }
+	step.On("Execute", mock.Anything, mock.Anything, mock.Anything).Run(holdsSlot).Return(contracts.PluginResult{Status: contracts.ResultStatusFailed}).Once()
+	step.On("Execute", mock.Anything, mock.Anything, mock.Anything).Run(holdsSlot).Return(contracts.PluginResult{Status: contracts.ResultStatusSuccess}).Once()
+
+	config := contracts.Configuration{DelaySeconds: 60, MaxAttempts: 2}
+	res := runPluginInSlot(context.NewMockDefault(), step, "step", config, task.NewChanneledCancelFlag(), notWaiting)
+	assert.Equal(t, contracts.ResultStatusSuccess, res.Status)
+	assert.Equal(t, []int{1, 1}, freeSlots)
+	assert.Equal(t, []int{1, 1}, heldSlots)
+	assert.Equal(t, 0, len(pluginSlot("step")))
+}
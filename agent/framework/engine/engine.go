@@ -16,12 +16,23 @@ package engine
 
 import (
 	"fmt"
+	"path/filepath"
 	"time"
 
+	"github.com/aws/amazon-ssm-agent/agent/agenterror"
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/checkpoint"
 	"github.com/aws/amazon-ssm-agent/agent/context"
 	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/dlp"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
 	"github.com/aws/amazon-ssm-agent/agent/framework/plugin"
+	"github.com/aws/amazon-ssm-agent/agent/jsonutil"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/logstreamer"
+	"github.com/aws/amazon-ssm-agent/agent/metrics"
 	"github.com/aws/amazon-ssm-agent/agent/rebooter"
+	"github.com/aws/amazon-ssm-agent/agent/snapshot"
 	"github.com/aws/amazon-ssm-agent/agent/task"
 )
 
@@ -47,7 +58,16 @@ func RunPlugins(
 	requestReboot := false
 
 	pluginOutputs = make(map[string]*contracts.PluginResult)
-	for pluginID, pluginConfig := range plugins {
+	order := executionOrder(plugins)
+	var executionPath []string
+	for index := 0; index < len(order); {
+		// between two steps, a background document gives way to the critical ones
+		task.SafePoint(cancelFlag)
+
+		pluginID := order[index]
+		pluginConfig := plugins[pluginID]
+		executionPath = append(executionPath, pluginID)
+
 		// populate plugin start time and status
 		pluginOutputs[pluginID] = &contracts.PluginResult{
 			Status:        contracts.ResultStatusInProgress,
@@ -61,13 +81,27 @@ func RunPlugins(
 			}
 		}
 		p, ok := pluginRegistry[pluginID]
+		if !ok && pluginID == appconfig.PluginNameAwsLoop {
+			p, ok = newLoopPlugin(pluginRegistry), true
+		}
+		if !ok && pluginID == appconfig.PluginNameAwsSleepUntil {
+			p, ok = sleepUntilPlugin{}, true
+		}
+		if !ok && pluginID == appconfig.PluginNameAwsRunDocument {
+			p, ok = newRunDocumentPlugin(pluginRegistry, 0), true
+		}
 		if !ok {
-			err := fmt.Errorf("Plugin with id %s not found!", pluginID)
+			err := agenterror.New(agenterror.PluginNotFound, "Plugin with id %s not found!", pluginID)
 			pluginOutputs[pluginID].Status = contracts.ResultStatusFailed
 			pluginOutputs[pluginID].Error = err
 			context.Log().Error(err)
 		} else {
-			r := runPlugin(context, p, pluginID, *pluginConfig, cancelFlag)
+			// the step stays in progress while its plugin is at its concurrency limit, its output tells it waits
+			waiting := func(notice string) {
+				pluginOutputs[pluginID].Output = notice
+				sendReply(documentID, pluginID, pluginOutputs)
+			}
+			r := runPluginInSlot(context, p, pluginID, *pluginConfig, cancelFlag, waiting)
 			pluginOutputs[pluginID].Code = r.Code
 			pluginOutputs[pluginID].Status = r.Status
 			pluginOutputs[pluginID].Error = r.Error
@@ -79,10 +113,23 @@ func RunPlugins(
 		}
 		// set end time.
 		pluginOutputs[pluginID].EndDateTime = time.Now()
+		metrics.PluginDuration.Observe(pluginOutputs[pluginID].EndDateTime.Sub(pluginOutputs[pluginID].StartDateTime).Seconds(),
+			pluginID, string(pluginOutputs[pluginID].Status))
+		if code := agenterror.CodeOfResult(pluginOutputs[pluginID].Status, pluginOutputs[pluginID].Error); code != "" {
+			agenterror.Record(code)
+			context.Log().Infof("Plugin %v finished with status %v, error code %v", pluginID, pluginOutputs[pluginID].Status, code)
+		}
 
 		context.Log().Infof("Sending response on plugin completion: %v", pluginID)
 		sendReply(documentID, pluginID, pluginOutputs)
 
+		index = nextStep(context.Log(), order, index, *pluginConfig, pluginOutputs[pluginID].Status, pluginOutputs)
+	}
+
+	// steps which are not on the execution path are reported as skipped
+	if skipped := skipRemainingSteps(order, executionPath, plugins, pluginOutputs); len(skipped) > 0 {
+		context.Log().Infof("Steps %v are not on the execution path %v", skipped, executionPath)
+		sendReply(documentID, "", pluginOutputs)
 	}
 
 	// request reboot if any of the plugins have requested a reboot
@@ -111,10 +158,143 @@ func runPlugin(
 		if err := recover(); err != nil {
 			res.Status = contracts.ResultStatusFailed
 			res.Code = 1
-			res.Error = fmt.Errorf("Plugin crashed with message %v!", err)
+			res.Error = agenterror.New(agenterror.PluginCrashed, "Plugin crashed with message %v!", err)
 			log.Error(res.Error)
 		}
 	}()
+	if config.DryRun {
+		log.Debug("Dry running plugin")
+		return dryRunScheduledPlugin(context, p, pluginID, config)
+	}
+	if isScheduled(config) {
+		if waitRes, ok := waitUntil(context, ScheduleFileName, pluginID, config, config.RunAt, config.DelaySeconds, cancelFlag); !ok {
+			return waitRes
+		}
+	}
 	log.Debug("Running plugin")
-	return p.Execute(context, config, cancelFlag)
+	if err := saveSnapshot(pluginID, config); err != nil {
+		log.Warnf("failed to save the execution snapshot of %v: %v", pluginID, err)
+	}
+	if err := saveMachineState(pluginID, config); err != nil {
+		log.Warnf("failed to save the machine state before %v: %v", pluginID, err)
+	}
+	stopStreaming := streamOutput(log, config)
+	defer stopStreaming()
+	if checkpointer, ok := p.(plugin.Checkpointer); ok && config.OrchestrationDirectory != "" {
+		return executeFromCheckpoint(context, checkpointer, pluginID, config, cancelFlag)
+	}
+	return executeWithRetry(context, p, config, cancelFlag)
+}
+
+// executeFromCheckpoint runs a plugin which resumes from the progress saved by its previous runs.
+// The checkpoint is kept when the run is interrupted by a shutdown, and deleted once the step is over.
+func executeFromCheckpoint(context context.T, p plugin.Checkpointer, pluginID string, config contracts.Configuration, cancelFlag task.CancelFlag) (res contracts.PluginResult) {
+	store := checkpoint.NewStore(config.OrchestrationDirectory, pluginID, config.MessageId, cancelFlag)
+	res = executeWithRetry(context, checkpointedPlugin{Checkpointer: p, checkpoints: store}, config, cancelFlag)
+	if cancelFlag != nil && cancelFlag.ShutDown() {
+		context.Log().Infof("Keeping the checkpoint of %v to resume it after the restart", pluginID)
+		return
+	}
+	if err := store.Clear(); err != nil {
+		context.Log().Warnf("failed to delete the checkpoint of %v: %v", pluginID, err)
+	}
+	return
+}
+
+// checkpointedPlugin executes a Checkpointer with the checkpoints of its step.
+type checkpointedPlugin struct {
+	plugin.Checkpointer
+	checkpoints checkpoint.T
+}
+
+// Execute runs the plugin with its checkpoints.
+func (p checkpointedPlugin) Execute(context context.T, config contracts.Configuration, cancelFlag task.CancelFlag) contracts.PluginResult {
+	return p.ExecuteWithCheckpoint(context, config, cancelFlag, p.checkpoints)
+}
+
+// streamOutput streams the output of the step to CloudWatch Logs while it runs, if the document asks for it.
+// The secrets matching the redaction patterns of the agent configuration are masked, then the lines go through
+// the DLP scanner of the agent configuration. The returned function streams the remaining output and stops.
+var streamOutput = func(log log.T, config contracts.Configuration) (stop func()) {
+	if config.CloudWatchLogGroupName == "" || config.OrchestrationDirectory == "" {
+		return func() {}
+	}
+	redaction, errs := logstreamer.NewRedaction(configuredRedactionPatterns())
+	for _, err := range errs {
+		log.Warnf("%v", err)
+	}
+	streamer := logstreamer.Start(log, logstreamer.NewClient(), config.CloudWatchLogGroupName, config.CloudWatchLogStreamPrefix, config.OrchestrationDirectory, redaction, dlp.Default())
+	return streamer.Stop
+}
+
+// configuredRedactionPatterns returns the patterns of the secrets masked in the streamed output in the agent configuration.
+var configuredRedactionPatterns = func() []string {
+	config, err := appconfig.Config(false)
+	if err != nil {
+		return nil
+	}
+	return config.Output.StreamRedactionPatterns
+}
+
+// saveSnapshot persists the execution context of the step next to its output, for post-mortem.
+var saveSnapshot = func(pluginID string, config contracts.Configuration) error {
+	if config.OrchestrationDirectory == "" {
+		return nil
+	}
+	return snapshot.Save(config.OrchestrationDirectory, snapshot.Capture(pluginID, config))
+}
+
+// saveMachineState captures the state of the machine before the step, if the document asks for it.
+// A step resumed after a reboot keeps the state captured before its first run.
+var saveMachineState = func(pluginID string, config contracts.Configuration) error {
+	if config.CaptureState == nil || config.OrchestrationDirectory == "" {
+		return nil
+	}
+	if fileutil.Exists(filepath.Join(config.OrchestrationDirectory, snapshot.MachineStateFileName)) {
+		return nil
+	}
+	return snapshot.SaveMachineState(config.OrchestrationDirectory, snapshot.CaptureMachineState(pluginID, config))
+}
+
+// dryRunScheduledPlugin validates the schedule of the step, then dry runs the plugin.
+func dryRunScheduledPlugin(context context.T, p plugin.T, pluginID string, config contracts.Configuration) (res contracts.PluginResult) {
+	if !isScheduled(config) {
+		return dryRunPlugin(context, p, pluginID, config)
+	}
+	next, err := nextRunTime(scheduleClock.Now(), config.RunAt, config.DelaySeconds)
+	if err != nil {
+		res.StartDateTime = time.Now()
+		res.EndDateTime = res.StartDateTime
+		res.Status = contracts.ResultStatusFailed
+		res.Code = 1
+		res.Output = fmt.Sprintf("%vinvalid schedule of %v: %v", contracts.DryRunOutputPrefix, pluginID, err)
+		return
+	}
+	res = dryRunPlugin(context, p, pluginID, config)
+	if output, ok := res.Output.(string); ok {
+		res.Output = fmt.Sprintf("%v\n%v would wait until %v", output, pluginID, next.Format(time.RFC3339))
+	}
+	return
+}
+
+// dryRunPlugin validates the plugin configuration without executing the plugin.
+// Plugins that do not implement plugin.DryRunner only report the properties they would have been run with.
+func dryRunPlugin(context context.T, p plugin.T, pluginID string, config contracts.Configuration) (res contracts.PluginResult) {
+	if dryRunner, ok := p.(plugin.DryRunner); ok {
+		return dryRunner.DryRun(context, config)
+	}
+
+	res.StartDateTime = time.Now()
+	defer func() { res.EndDateTime = time.Now() }()
+
+	properties, err := jsonutil.Marshal(config.Properties)
+	if err != nil {
+		res.Status = contracts.ResultStatusFailed
+		res.Code = 1
+		res.Output = fmt.Sprintf("%vunable to parse the properties of %v: %v", contracts.DryRunOutputPrefix, pluginID, err)
+		return
+	}
+	res.Status = contracts.ResultStatusSuccess
+	res.Output = fmt.Sprintf("%v%v would run with properties:\n%v", contracts.DryRunOutputPrefix, pluginID, jsonutil.Indent(properties))
+	return
 }
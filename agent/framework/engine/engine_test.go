@@ -14,13 +14,18 @@
 package engine
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/aws/amazon-ssm-agent/agent/checkpoint"
 	"github.com/aws/amazon-ssm-agent/agent/context"
 	"github.com/aws/amazon-ssm-agent/agent/contracts"
 	"github.com/aws/amazon-ssm-agent/agent/framework/plugin"
 	"github.com/aws/amazon-ssm-agent/agent/rebooter"
+	"github.com/aws/amazon-ssm-agent/agent/snapshot"
 	"github.com/aws/amazon-ssm-agent/agent/task"
 	"github.com/stretchr/testify/assert"
 )
@@ -79,3 +84,97 @@ func TestRunPluginsWithRegistry(t *testing.T) {
 	time.Sleep(10 * time.Second)
 	assert.Equal(t, true, rebooter.RebootRequested())
 }
+
+// TestRunPluginsDryRun tests that plugins are not executed in dry-run mode.
+func TestRunPluginsDryRun(t *testing.T) {
+	pluginName := "plugin1"
+	pluginConfigs := map[string]*contracts.Configuration{
+		pluginName: {Properties: map[string]interface{}{"commands": "ls"}, DryRun: true},
+	}
+	mockPlugin := new(plugin.Mock)
+	pluginRegistry := plugin.PluginRegistry{pluginName: mockPlugin}
+
+	sendResponse := func(messageID string, pluginID string, results map[string]*contracts.PluginResult) {
+	}
+
+	var cancelFlag task.CancelFlag
+	outputs := RunPlugins(context.NewMockDefault(), "TestDocument", pluginConfigs, pluginRegistry, sendResponse, cancelFlag)
+
+	mockPlugin.AssertNotCalled(t, "Execute")
+	assert.Equal(t, contracts.ResultStatusSuccess, outputs[pluginName].Status)
+	assert.Contains(t, outputs[pluginName].Output, contracts.DryRunOutputPrefix)
+	assert.Contains(t, outputs[pluginName].Output, "commands")
+}
+
+// resumablePlugin counts up to a limit and saves its progress after each step.
+type resumablePlugin struct {
+	plugin.Mock
+	resumedFrom int
+}
+
+func (p *resumablePlugin) ExecuteWithCheckpoint(context context.T, config contracts.Configuration, cancelFlag task.CancelFlag, checkpoints checkpoint.T) (res contracts.PluginResult) {
+	checkpoints.Load(&p.resumedFrom)
+	for i := p.resumedFrom + 1; i <= 3; i++ {
+		checkpoints.Save(i)
+	}
+	res.Status = contracts.ResultStatusSuccess
+	return
+}
+
+// TestRunPluginsWithCheckpoint tests that a Checkpointer resumes from its checkpoint, which is deleted once the step completes.
+func TestRunPluginsWithCheckpoint(t *testing.T) {
+	orchestrationDir, err := ioutil.TempDir("", "engine")
+	assert.Nil(t, err)
+	defer os.RemoveAll(orchestrationDir)
+
+	pluginName := "plugin1"
+	pluginConfigs := map[string]*contracts.Configuration{
+		pluginName: {OrchestrationDirectory: orchestrationDir, MessageId: "aws.ssm.c1.i-1"},
+	}
+	assert.Nil(t, checkpoint.NewStore(orchestrationDir, pluginName, "aws.ssm.c1.i-1", nil).Save(2))
+	resumable := new(resumablePlugin)
+	pluginRegistry := plugin.PluginRegistry{pluginName: resumable}
+
+	sendResponse := func(messageID string, pluginID string, results map[string]*contracts.PluginResult) {
+	}
+
+	var cancelFlag task.CancelFlag
+	outputs := RunPlugins(context.NewMockDefault(), "TestDocument", pluginConfigs, pluginRegistry, sendResponse, cancelFlag)
+
+	resumable.AssertNotCalled(t, "Execute")
+	assert.Equal(t, contracts.ResultStatusSuccess, outputs[pluginName].Status)
+	assert.Equal(t, 2, resumable.resumedFrom)
+	_, err = os.Stat(filepath.Join(orchestrationDir, checkpoint.FileName))
+	assert.True(t, os.IsNotExist(err))
+}
+
+// TestSaveMachineState tests that the machine state is captured before the first run of the step only.
+func TestSaveMachineState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "engine")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "app.conf")
+	config := contracts.Configuration{
+		MessageId:              "m1",
+		OrchestrationDirectory: dir,
+		CaptureState:           &contracts.StateCapture{Files: []string{file}},
+	}
+
+	assert.Nil(t, saveMachineState("aws:runShellScript", config))
+	state, err := snapshot.LoadMachineState(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, []snapshot.FileState{{Path: file}}, state.Files)
+
+	// the step resumed after a reboot keeps the state from before its changes
+	assert.Nil(t, ioutil.WriteFile(file, []byte("port=80\n"), 0600))
+	assert.Nil(t, saveMachineState("aws:runShellScript", config))
+	state, err = snapshot.LoadMachineState(dir)
+	assert.Nil(t, err)
+	assert.False(t, state.Files[0].Exists)
+
+	config.CaptureState = nil
+	config.OrchestrationDirectory = filepath.Join(dir, "other")
+	assert.Nil(t, saveMachineState("aws:runShellScript", config))
+	_, err = os.Stat(filepath.Join(dir, "other"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,197 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package engine contains the general purpose plugin runner of the plugin framework.
+// loop implements the aws:loop action, which repeats a set of steps.
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/context"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/framework/plugin"
+	"github.com/aws/amazon-ssm-agent/agent/jsonutil"
+	"github.com/aws/amazon-ssm-agent/agent/message/parameters"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/pluginutil"
+	"github.com/aws/amazon-ssm-agent/agent/task"
+)
+
+const (
+	// maxLoopIterations caps the number of iterations of a loop.
+	maxLoopIterations = 100
+
+	// LoopUntilSuccess stops the loop after the first iteration where every step succeeded.
+	LoopUntilSuccess = "success"
+
+	// LoopItemParameter is replaced by the current item in the properties of the steps of the loop.
+	LoopItemParameter = "loopItem"
+
+	// LoopIndexParameter is replaced by the current iteration index, starting at 0.
+	LoopIndexParameter = "loopIndex"
+)
+
+// persistPluginInformation records the result of the loop in the command state.
+var persistPluginInformation = pluginutil.PersistPluginInformationToCurrent
+
+// LoopInput represents the properties of the aws:loop action.
+type LoopInput struct {
+	Items         []interface{}
+	MaxIterations int
+	Until         string
+	Steps         map[string]*contracts.PluginConfig
+}
+
+// loopPlugin runs the steps of a loop with the plugins of the registry.
+type loopPlugin struct {
+	registry plugin.PluginRegistry
+}
+
+// newLoopPlugin returns the loop action, running its steps with the given plugins.
+func newLoopPlugin(registry plugin.PluginRegistry) plugin.T {
+	return &loopPlugin{registry: registry}
+}
+
+// Execute runs the steps of the loop once per item, or up to MaxIterations times, and aggregates the outputs
+// of every iteration. With Until set to "success" the loop stops as soon as an iteration succeeds, and its
+// status is the status of the last iteration; otherwise the loop fails if any iteration failed.
+// Nested loops are not supported.
+func (l *loopPlugin) Execute(context context.T, config contracts.Configuration, cancelFlag task.CancelFlag) (res contracts.PluginResult) {
+	log := context.Log()
+	res.StartDateTime = time.Now()
+	defer func() { res.EndDateTime = time.Now() }()
+
+	var input LoopInput
+	iterations, err := parseLoopInput(config.Properties, &input)
+	if err != nil {
+		log.Error(err)
+		res.Status = contracts.ResultStatusFailed
+		res.Code = 1
+		res.Output = err.Error()
+		res.Error = err
+		persistPluginInformation(log, appconfig.PluginNameAwsLoop, config, res)
+		return
+	}
+
+	stepNames := make([]string, 0, len(input.Steps))
+	for stepName := range input.Steps {
+		stepNames = append(stepNames, stepName)
+	}
+	sort.Strings(stepNames)
+
+	var output bytes.Buffer
+	res.Status = contracts.ResultStatusSuccess
+	for i := 0; i < iterations; i++ {
+		if cancelFlag.Canceled() {
+			res.Status = contracts.ResultStatusCancelled
+			break
+		}
+
+		loopParameters := map[string]interface{}{LoopIndexParameter: strconv.Itoa(i)}
+		if len(input.Items) > 0 {
+			loopParameters[LoopItemParameter] = input.Items[i]
+		}
+		log.Infof("Running iteration %v of %v", i+1, iterations)
+		fmt.Fprintf(&output, "----------ITERATION %v----------\n", i)
+
+		iterationStatus := contracts.ResultStatusSuccess
+		for _, stepName := range stepNames {
+			stepResult := l.runStep(context, config, i, stepName, input.Steps[stepName], loopParameters, cancelFlag)
+			fmt.Fprintf(&output, "%v: %v\n%v\n", stepName, stepResult.Status, stepResult.Output)
+			if stepResult.Status != contracts.ResultStatusSuccess {
+				iterationStatus = stepResult.Status
+			}
+		}
+
+		if input.Until == LoopUntilSuccess {
+			res.Status = iterationStatus
+			if iterationStatus == contracts.ResultStatusSuccess {
+				break
+			}
+		} else if iterationStatus != contracts.ResultStatusSuccess && res.Status == contracts.ResultStatusSuccess {
+			res.Status = iterationStatus
+		}
+	}
+
+	if res.Status != contracts.ResultStatusSuccess {
+		res.Code = 1
+	}
+	res.Output = contracts.TruncateOutput(output.String(), "", contracts.MaximumPluginOutputSize)
+	persistPluginInformation(log, appconfig.PluginNameAwsLoop, config, res)
+	return
+}
+
+// DryRun dry runs the steps of every iteration of the loop.
+func (l *loopPlugin) DryRun(context context.T, config contracts.Configuration) contracts.PluginResult {
+	return l.Execute(context, config, task.NewChanneledCancelFlag())
+}
+
+// runStep runs one step of an iteration, with its own orchestration directory and output prefix.
+func (l *loopPlugin) runStep(context context.T, config contracts.Configuration, iteration int, stepName string, step *contracts.PluginConfig, loopParameters map[string]interface{}, cancelFlag task.CancelFlag) (res contracts.PluginResult) {
+	p, ok := l.registry[stepName]
+	if !ok {
+		res.Status = contracts.ResultStatusFailed
+		res.Output = fmt.Sprintf("Plugin with id %s not found!", stepName)
+		return
+	}
+
+	stepConfig := config
+	stepConfig.Properties = parameters.ReplaceParameters(step.Properties, loopParameters, context.Log())
+	stepConfig.OrchestrationDirectory = filepath.Join(config.OrchestrationDirectory, strconv.Itoa(iteration), fileutil.RemoveInvalidChars(stepName))
+	stepConfig.OutputS3KeyPrefix = path.Join(config.OutputS3KeyPrefix, strconv.Itoa(iteration), fileutil.RemoveInvalidChars(stepName))
+	stepConfig.MaxAttempts = step.MaxAttempts
+	stepConfig.RetryBackoffSeconds = step.RetryBackoffSeconds
+	stepConfig.RunAt = step.RunAt
+	stepConfig.DelaySeconds = step.DelaySeconds
+	stepConfig.OnSuccess = ""
+	stepConfig.OnFailure = ""
+	return runPluginInSlot(context, p, stepName, stepConfig, cancelFlag, func(string) {})
+}
+
+// parseLoopInput parses the properties of the loop and returns the number of iterations to run.
+func parseLoopInput(properties interface{}, input *LoopInput) (iterations int, err error) {
+	if err = jsonutil.Remarshal(properties, input); err != nil {
+		return 0, fmt.Errorf("invalid format in %v properties %v; error %v", appconfig.PluginNameAwsLoop, properties, err)
+	}
+	if len(input.Steps) == 0 {
+		return 0, fmt.Errorf("%v does not declare any step", appconfig.PluginNameAwsLoop)
+	}
+	if _, nested := input.Steps[appconfig.PluginNameAwsLoop]; nested {
+		return 0, fmt.Errorf("%v cannot be nested", appconfig.PluginNameAwsLoop)
+	}
+	input.Until = strings.ToLower(input.Until)
+	if input.Until != "" && input.Until != LoopUntilSuccess {
+		return 0, fmt.Errorf("unsupported loop condition %v, expected %v", input.Until, LoopUntilSuccess)
+	}
+
+	iterations = len(input.Items)
+	if iterations == 0 || (input.MaxIterations > 0 && input.MaxIterations < iterations) {
+		iterations = input.MaxIterations
+	}
+	if iterations <= 0 {
+		return 0, fmt.Errorf("%v requires a list of items or a positive maxIterations", appconfig.PluginNameAwsLoop)
+	}
+	if iterations > maxLoopIterations {
+		return 0, fmt.Errorf("%v is limited to %v iterations", appconfig.PluginNameAwsLoop, maxLoopIterations)
+	}
+	return
+}
@@ -0,0 +1,96 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/context"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/framework/plugin"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/task"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func stubPersistPluginInformation() func() {
+	persist := persistPluginInformation
+	persistPluginInformation = func(log log.T, pluginName string, config contracts.Configuration, res contracts.PluginResult) {}
+	return func() { persistPluginInformation = persist }
+}
+
+// TestLoopOverItems tests that the steps of the loop run once per item with the item replaced in their properties.
+func TestLoopOverItems(t *testing.T) {
+	defer stubPersistPluginInformation()()
+
+	ctx := context.NewMockDefault()
+	cancelFlag := task.NewChanneledCancelFlag()
+	step := new(plugin.Mock)
+	var properties []interface{}
+	step.On("Execute", ctx, mock.Anything, cancelFlag).Run(func(args mock.Arguments) {
+		properties = append(properties, args.Get(1).(contracts.Configuration).Properties)
+	}).Return(contracts.PluginResult{Status: contracts.ResultStatusSuccess, Output: "done"})
+
+	loop := newLoopPlugin(plugin.PluginRegistry{"step": step})
+	res := loop.Execute(ctx, contracts.Configuration{OrchestrationDirectory: t.TempDir(), Properties: map[string]interface{}{
+		"items": []interface{}{"a", "b"},
+		"steps": map[string]interface{}{
+			"step": map[string]interface{}{"properties": "echo {{ loopIndex }}:{{ loopItem }}"},
+		},
+	}}, cancelFlag)
+
+	assert.Equal(t, contracts.ResultStatusSuccess, res.Status)
+	assert.Equal(t, []interface{}{"echo 0:a", "echo 1:b"}, properties)
+	assert.Contains(t, res.Output, "ITERATION 1")
+}
+
+// TestLoopUntilSuccess tests that the loop stops at the first successful iteration.
+func TestLoopUntilSuccess(t *testing.T) {
+	defer stubPersistPluginInformation()()
+
+	ctx := context.NewMockDefault()
+	cancelFlag := task.NewChanneledCancelFlag()
+	step := new(plugin.Mock)
+	step.On("Execute", ctx, mock.Anything, cancelFlag).Return(contracts.PluginResult{Status: contracts.ResultStatusFailed}).Once()
+	step.On("Execute", ctx, mock.Anything, cancelFlag).Return(contracts.PluginResult{Status: contracts.ResultStatusSuccess}).Once()
+
+	loop := newLoopPlugin(plugin.PluginRegistry{"step": step})
+	res := loop.Execute(ctx, contracts.Configuration{OrchestrationDirectory: t.TempDir(), Properties: map[string]interface{}{
+		"maxIterations": 5,
+		"until":         "success",
+		"steps":         map[string]interface{}{"step": map[string]interface{}{}},
+	}}, cancelFlag)
+
+	step.AssertExpectations(t)
+	assert.Equal(t, contracts.ResultStatusSuccess, res.Status)
+}
+
+func TestParseLoopInput(t *testing.T) {
+	steps := map[string]interface{}{"step": map[string]interface{}{}}
+	var input LoopInput
+
+	iterations, err := parseLoopInput(map[string]interface{}{"items": []interface{}{1, 2, 3}, "maxIterations": 2, "steps": steps}, &input)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, iterations)
+
+	_, err = parseLoopInput(map[string]interface{}{"steps": steps}, &LoopInput{})
+	assert.NotNil(t, err)
+
+	_, err = parseLoopInput(map[string]interface{}{"maxIterations": 1000, "steps": steps}, &LoopInput{})
+	assert.NotNil(t, err)
+
+	_, err = parseLoopInput(map[string]interface{}{"maxIterations": 1, "steps": map[string]interface{}{"aws:loop": map[string]interface{}{}}}, &LoopInput{})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,96 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package engine contains the general purpose plugin runner of the plugin framework.
+// retry contains the step level retry policy.
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/context"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/framework/plugin"
+	"github.com/aws/amazon-ssm-agent/agent/task"
+)
+
+const (
+	// maxStepAttempts caps the number of attempts a document can request for a step.
+	maxStepAttempts = 10
+
+	// defaultRetryBackoff is the delay before the first retry when the step does not declare one.
+	defaultRetryBackoff = 2 * time.Second
+
+	// maxRetryBackoff caps the exponential backoff between two attempts.
+	maxRetryBackoff = 5 * time.Minute
+)
+
+// waitForRetry waits for the given delay and returns false if the command got canceled meanwhile.
+var waitForRetry = task.WaitFor
+
+// executeWithRetry executes the plugin and, when the step declares more than one attempt,
+// executes it again with an exponential backoff as long as it fails.
+// Cancelled, timed out and reboot results are never retried.
+func executeWithRetry(context context.T, p plugin.T, config contracts.Configuration, cancelFlag task.CancelFlag) (res contracts.PluginResult) {
+	log := context.Log()
+	maxAttempts := stepMaxAttempts(config)
+
+	for attempt := 1; ; attempt++ {
+		res = p.Execute(context, config, cancelFlag)
+		if res.Status != contracts.ResultStatusFailed || attempt >= maxAttempts || cancelFlag.Canceled() {
+			if attempt > 1 {
+				log.Infof("Step finished with status %v after %v attempts", res.Status, attempt)
+				if output, ok := res.Output.(string); ok {
+					res.Output = fmt.Sprintf("%v\n(step finished after %v attempts)", output, attempt)
+				}
+			}
+			return
+		}
+
+		delay := retryBackoff(config, attempt)
+		log.Infof("Step failed on attempt %v of %v, retrying in %v", attempt, maxAttempts, delay)
+		if !waitForRetry(delay, cancelFlag) {
+			log.Info("Step canceled while waiting to be retried")
+			return
+		}
+	}
+}
+
+// stepMaxAttempts returns the number of attempts declared by the step, within [1, maxStepAttempts].
+func stepMaxAttempts(config contracts.Configuration) int {
+	switch {
+	case config.MaxAttempts < 1:
+		return 1
+	case config.MaxAttempts > maxStepAttempts:
+		return maxStepAttempts
+	default:
+		return config.MaxAttempts
+	}
+}
+
+// retryBackoff returns the delay before the attempt following the given one.
+// The delay doubles after every attempt, starting from the backoff declared by the step.
+func retryBackoff(config contracts.Configuration, attempt int) time.Duration {
+	delay := defaultRetryBackoff
+	if config.RetryBackoffSeconds > 0 {
+		delay = time.Duration(config.RetryBackoffSeconds) * time.Second
+	}
+	for i := 1; i < attempt && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryBackoff {
+		delay = maxRetryBackoff
+	}
+	return delay
+}
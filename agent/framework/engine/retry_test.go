@@ -0,0 +1,75 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/context"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/framework/plugin"
+	"github.com/aws/amazon-ssm-agent/agent/task"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteWithRetry(t *testing.T) {
+	var delays []time.Duration
+	defer func(wait func(time.Duration, task.CancelFlag) bool) { waitForRetry = wait }(waitForRetry)
+	waitForRetry = func(delay time.Duration, cancelFlag task.CancelFlag) bool {
+		delays = append(delays, delay)
+		return true
+	}
+
+	ctx := context.NewMockDefault()
+	cancelFlag := task.NewChanneledCancelFlag()
+	config := contracts.Configuration{MaxAttempts: 3, RetryBackoffSeconds: 1}
+
+	mockPlugin := new(plugin.Mock)
+	mockPlugin.On("Execute", ctx, config, cancelFlag).Return(contracts.PluginResult{Status: contracts.ResultStatusFailed, Output: "mirror unavailable"}).Twice()
+	mockPlugin.On("Execute", ctx, config, cancelFlag).Return(contracts.PluginResult{Status: contracts.ResultStatusSuccess, Output: "installed"}).Once()
+
+	res := executeWithRetry(ctx, mockPlugin, config, cancelFlag)
+
+	mockPlugin.AssertExpectations(t)
+	assert.Equal(t, contracts.ResultStatusSuccess, res.Status)
+	assert.Contains(t, res.Output, "after 3 attempts")
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, delays)
+}
+
+func TestExecuteWithRetryGivesUp(t *testing.T) {
+	defer func(wait func(time.Duration, task.CancelFlag) bool) { waitForRetry = wait }(waitForRetry)
+	waitForRetry = func(delay time.Duration, cancelFlag task.CancelFlag) bool { return true }
+
+	ctx := context.NewMockDefault()
+	cancelFlag := task.NewChanneledCancelFlag()
+	config := contracts.Configuration{MaxAttempts: 2}
+
+	mockPlugin := new(plugin.Mock)
+	mockPlugin.On("Execute", ctx, config, cancelFlag).Return(contracts.PluginResult{Status: contracts.ResultStatusFailed}).Twice()
+
+	res := executeWithRetry(ctx, mockPlugin, config, cancelFlag)
+
+	mockPlugin.AssertExpectations(t)
+	assert.Equal(t, contracts.ResultStatusFailed, res.Status)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	assert.Equal(t, 1, stepMaxAttempts(contracts.Configuration{}))
+	assert.Equal(t, maxStepAttempts, stepMaxAttempts(contracts.Configuration{MaxAttempts: 100}))
+
+	assert.Equal(t, defaultRetryBackoff, retryBackoff(contracts.Configuration{}, 1))
+	assert.Equal(t, 20*time.Second, retryBackoff(contracts.Configuration{RetryBackoffSeconds: 5}, 3))
+	assert.Equal(t, maxRetryBackoff, retryBackoff(contracts.Configuration{RetryBackoffSeconds: 60}, 9))
+}
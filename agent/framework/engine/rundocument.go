@@ -0,0 +1,273 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package engine contains the general purpose plugin runner of the plugin framework.
+// rundocument implements the aws:runDocument action, which runs the steps of another document as a child execution.
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/context"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil/artifact"
+	"github.com/aws/amazon-ssm-agent/agent/framework/plugin"
+	"github.com/aws/amazon-ssm-agent/agent/jsonutil"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/message/parser"
+	"github.com/aws/amazon-ssm-agent/agent/precondition"
+	"github.com/aws/amazon-ssm-agent/agent/ssm"
+	"github.com/aws/amazon-ssm-agent/agent/task"
+)
+
+const (
+	// DocumentTypeSSMDocument runs a document of the document store, documentPath is its name.
+	DocumentTypeSSMDocument = "SSMDocument"
+
+	// DocumentTypeS3 runs a document downloaded from S3, documentPath is its url.
+	DocumentTypeS3 = "S3"
+
+	// DocumentTypeLocalPath runs a document file of the instance, documentPath is its absolute path.
+	DocumentTypeLocalPath = "LocalPath"
+
+	// maxRunDocumentDepth caps the nesting of aws:runDocument, so that documents running each other terminate.
+	maxRunDocumentDepth = 3
+)
+
+var (
+	// getDocumentContent returns the content of a document of the document store.
+	getDocumentContent = func(log log.T, name string) (string, error) {
+		response, err := ssm.NewService().GetDocument(log, name)
+		if err != nil {
+			return "", err
+		}
+		if response.Content == nil {
+			return "", fmt.Errorf("document %v has no content", name)
+		}
+		return *response.Content, nil
+	}
+
+	// downloadDocument downloads a document from S3.
+	downloadDocument = artifact.Download
+
+	// evaluatePreconditions evaluates the preconditions of the child document on the instance.
+	evaluatePreconditions = precondition.Evaluate
+)
+
+// RunDocumentInput represents the properties of the aws:runDocument action.
+type RunDocumentInput struct {
+	DocumentType string
+	DocumentPath string
+	// DocumentParameters is a json object, or a string containing one, mapping the parameters of the child document.
+	DocumentParameters interface{}
+}
+
+// runDocumentPlugin runs the steps of a child document with the plugins of the registry.
+type runDocumentPlugin struct {
+	registry plugin.PluginRegistry
+	depth    int
+}
+
+// newRunDocumentPlugin returns the aws:runDocument action of a parent document run at the given nesting depth.
+func newRunDocumentPlugin(registry plugin.PluginRegistry, depth int) plugin.T {
+	return &runDocumentPlugin{registry: registry, depth: depth}
+}
+
+// Execute loads the child document, replaces its parameters and runs its steps like the steps of a command.
+// The status of the action aggregates the statuses of the child steps, with the same precedence as the
+// status of a command, and its output lists the output of each child step.
+func (r *runDocumentPlugin) Execute(context context.T, config contracts.Configuration, cancelFlag task.CancelFlag) (res contracts.PluginResult) {
+	log := context.Log()
+	res.StartDateTime = time.Now()
+	defer func() {
+		res.EndDateTime = time.Now()
+		persistPluginInformation(log, appconfig.PluginNameAwsRunDocument, config, res)
+	}()
+
+	document, params, err := r.loadDocument(log, config)
+	if err != nil {
+		log.Error(err)
+		res.Status = contracts.ResultStatusFailed
+		res.Code = 1
+		res.Output = err.Error()
+		res.Error = err
+		return
+	}
+
+	if satisfied, reason := evaluatePreconditions(log, document.Preconditions); !satisfied {
+		log.Infof("Skipping the child document: %v", reason)
+		res.Status = contracts.ResultStatusSuccess
+		res.Output = fmt.Sprintf("Document skipped: %v", reason)
+		return
+	}
+
+	childConfigs := childConfigurations(config, parser.ReplaceDocumentParameters(log, document, params))
+	childRegistry := make(plugin.PluginRegistry, len(r.registry)+1)
+	for name, p := range r.registry {
+		childRegistry[name] = p
+	}
+	childRegistry[appconfig.PluginNameAwsRunDocument] = newRunDocumentPlugin(r.registry, r.depth+1)
+
+	// the child steps are reported through the output of the action, not to the service
+	sendReply := func(messageID string, pluginID string, results map[string]*contracts.PluginResult) {}
+	outputs := RunPlugins(context, config.MessageId, childConfigs, childRegistry, sendReply, cancelFlag)
+
+	res.Status = aggregateStatus(outputs)
+	if res.Status != contracts.ResultStatusSuccess && res.Status != contracts.ResultStatusSuccessAndReboot {
+		res.Code = 1
+	}
+	res.Output = contracts.TruncateOutput(childOutput(outputs), "", contracts.MaximumPluginOutputSize)
+	return
+}
+
+// DryRun dry runs the steps of the child document.
+func (r *runDocumentPlugin) DryRun(context context.T, config contracts.Configuration) contracts.PluginResult {
+	config.DryRun = true
+	return r.Execute(context, config, task.NewChanneledCancelFlag())
+}
+
+// loadDocument returns the child document of the action and the parameters it runs with.
+func (r *runDocumentPlugin) loadDocument(log log.T, config contracts.Configuration) (document contracts.DocumentContent, params map[string]interface{}, err error) {
+	if r.depth >= maxRunDocumentDepth {
+		return document, nil, fmt.Errorf("%v is limited to %v nested documents", appconfig.PluginNameAwsRunDocument, maxRunDocumentDepth)
+	}
+	var input RunDocumentInput
+	if err = jsonutil.Remarshal(config.Properties, &input); err != nil {
+		return document, nil, fmt.Errorf("invalid format in %v properties %v; error %v", appconfig.PluginNameAwsRunDocument, config.Properties, err)
+	}
+	if input.DocumentPath == "" {
+		return document, nil, fmt.Errorf("%v requires a documentPath", appconfig.PluginNameAwsRunDocument)
+	}
+	if params, err = parseDocumentParameters(input.DocumentParameters); err != nil {
+		return
+	}
+
+	var content []byte
+	switch input.DocumentType {
+	case DocumentTypeSSMDocument:
+		var text string
+		text, err = getDocumentContent(log, input.DocumentPath)
+		content = []byte(text)
+	case DocumentTypeS3:
+		var output artifact.DownloadOutput
+		if output, err = downloadDocument(log, artifact.DownloadInput{SourceURL: input.DocumentPath, DestinationDirectory: config.OrchestrationDirectory}); err == nil {
+			content, err = ioutil.ReadFile(output.LocalFilePath)
+		}
+	case DocumentTypeLocalPath:
+		if !filepath.IsAbs(input.DocumentPath) {
+			return document, nil, fmt.Errorf("documentPath %v must be an absolute path", input.DocumentPath)
+		}
+		content, err = ioutil.ReadFile(input.DocumentPath)
+	default:
+		return document, nil, fmt.Errorf("unsupported documentType %v, expected %v, %v or %v", input.DocumentType, DocumentTypeSSMDocument, DocumentTypeS3, DocumentTypeLocalPath)
+	}
+	if err != nil {
+		return document, nil, fmt.Errorf("failed to load document %v: %v", input.DocumentPath, err)
+	}
+
+	if err = json.Unmarshal(content, &document); err != nil {
+		return document, nil, fmt.Errorf("invalid document %v: %v", input.DocumentPath, err)
+	}
+	if len(document.RuntimeConfig) == 0 {
+		return document, nil, fmt.Errorf("document %v does not declare any step", input.DocumentPath)
+	}
+	return
+}
+
+// parseDocumentParameters returns the parameters of the child document, given as a json object or a string containing one.
+func parseDocumentParameters(documentParameters interface{}) (params map[string]interface{}, err error) {
+	switch value := documentParameters.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if value == "" {
+			return nil, nil
+		}
+		err = json.Unmarshal([]byte(value), &params)
+	default:
+		err = jsonutil.Remarshal(value, &params)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid documentParameters %v: %v", documentParameters, err)
+	}
+	return
+}
+
+// childConfigurations returns the configurations of the child steps, with their orchestration directory and
+// output prefix nested under the ones of the action.
+func childConfigurations(config contracts.Configuration, runtimeConfig map[string]*contracts.PluginConfig) map[string]*contracts.Configuration {
+	configs := make(map[string]*contracts.Configuration)
+	for stepName, step := range runtimeConfig {
+		childConfig := config
+		childConfig.Properties = step.Properties
+		childConfig.OrchestrationDirectory = filepath.Join(config.OrchestrationDirectory, fileutil.RemoveInvalidChars(stepName))
+		childConfig.OutputS3KeyPrefix = path.Join(config.OutputS3KeyPrefix, fileutil.RemoveInvalidChars(stepName))
+		childConfig.MaxAttempts = step.MaxAttempts
+		childConfig.RetryBackoffSeconds = step.RetryBackoffSeconds
+		childConfig.OnSuccess = step.OnSuccess
+		childConfig.OnFailure = step.OnFailure
+		childConfig.RunAt = step.RunAt
+		childConfig.DelaySeconds = step.DelaySeconds
+		childConfig.CaptureState = step.CaptureState
+		configs[stepName] = &childConfig
+	}
+	return configs
+}
+
+// aggregateStatus returns the status of the child document, following the precedence of the status of a command:
+// BlockedByAntimalware > Failed > TimedOut > Cancelled > SuccessAndReboot > Success, skipped steps do not fail it.
+func aggregateStatus(outputs map[string]*contracts.PluginResult) contracts.ResultStatus {
+	counts := make(map[contracts.ResultStatus]int)
+	for _, output := range outputs {
+		counts[output.Status]++
+	}
+	for _, status := range []contracts.ResultStatus{
+		contracts.ResultStatusBlockedByAntimalware,
+		contracts.ResultStatusFailed,
+		contracts.ResultStatusTimedOut,
+		contracts.ResultStatusCancelled,
+		contracts.ResultStatusSuccessAndReboot,
+	} {
+		if counts[status] > 0 {
+			return status
+		}
+	}
+	if counts[contracts.ResultStatusSuccess]+counts[contracts.ResultStatusSkipped] == len(outputs) {
+		return contracts.ResultStatusSuccess
+	}
+	return contracts.ResultStatusFailed
+}
+
+// childOutput lists the status and the output of the child steps, ordered by name.
+func childOutput(outputs map[string]*contracts.PluginResult) string {
+	var stepNames []string
+	for stepName := range outputs {
+		stepNames = append(stepNames, stepName)
+	}
+	sort.Strings(stepNames)
+
+	var output bytes.Buffer
+	for _, stepName := range stepNames {
+		fmt.Fprintf(&output, "----------%v: %v----------\n%v\n", stepName, outputs[stepName].Status, outputs[stepName].Output)
+	}
+	return output.String()
+}
@@ -0,0 +1,161 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/context"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/framework/plugin"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/task"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const childDocument = `{
+	"schemaVersion": "1.2",
+	"parameters": {"name": {"type": "String", "default": "world"}},
+	"runtimeConfig": {"step": {"properties": "echo hello {{ name }}"}}
+}`
+
+// TestRunLocalDocument tests that the steps of a local document run with the mapped parameters.
+func TestRunLocalDocument(t *testing.T) {
+	defer stubPersistPluginInformation()()
+	dir, err := ioutil.TempDir("", "rundocument")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	documentPath := filepath.Join(dir, "child.json")
+	assert.Nil(t, ioutil.WriteFile(documentPath, []byte(childDocument), 0600))
+
+	ctx := context.NewMockDefault()
+	cancelFlag := task.NewChanneledCancelFlag()
+	step := new(plugin.Mock)
+	var stepConfig contracts.Configuration
+	step.On("Execute", mock.Anything, mock.Anything, cancelFlag).Run(func(args mock.Arguments) {
+		stepConfig = args.Get(1).(contracts.Configuration)
+	}).Return(contracts.PluginResult{Status: contracts.ResultStatusSuccess, Output: "hello agent"})
+
+	runDocument := newRunDocumentPlugin(plugin.PluginRegistry{"step": step}, 0)
+	res := runDocument.Execute(ctx, contracts.Configuration{
+		OrchestrationDirectory: filepath.Join(dir, "orchestration"),
+		Properties: map[string]interface{}{
+			"documentType":       "LocalPath",
+			"documentPath":       documentPath,
+			"documentParameters": `{"name": "agent"}`,
+		},
+	}, cancelFlag)
+
+	assert.Equal(t, contracts.ResultStatusSuccess, res.Status)
+	assert.Equal(t, "echo hello agent", stepConfig.Properties)
+	assert.Equal(t, filepath.Join(dir, "orchestration", "step"), stepConfig.OrchestrationDirectory)
+	assert.Contains(t, res.Output, "hello agent")
+}
+
+// TestRunStoredDocument tests that a failed child step fails the action.
+func TestRunStoredDocument(t *testing.T) {
+	defer stubPersistPluginInformation()()
+	original := getDocumentContent
+	defer func() { getDocumentContent = original }()
+	getDocumentContent = func(log log.T, name string) (string, error) {
+		assert.Equal(t, "Acme-Deploy", name)
+		return childDocument, nil
+	}
+
+	ctx := context.NewMockDefault()
+	cancelFlag := task.NewChanneledCancelFlag()
+	step := new(plugin.Mock)
+	step.On("Execute", mock.Anything, mock.Anything, cancelFlag).Return(contracts.PluginResult{Status: contracts.ResultStatusFailed})
+
+	runDocument := newRunDocumentPlugin(plugin.PluginRegistry{"step": step}, 0)
+	res := runDocument.Execute(ctx, contracts.Configuration{OrchestrationDirectory: t.TempDir(), Properties: map[string]interface{}{
+		"documentType": "SSMDocument",
+		"documentPath": "Acme-Deploy",
+	}}, cancelFlag)
+
+	step.AssertExpectations(t)
+	assert.Equal(t, contracts.ResultStatusFailed, res.Status)
+	assert.Equal(t, 1, res.Code)
+}
+
+// TestRunDocumentNestingLimit tests that a document running itself stops at the nesting limit.
+func TestRunDocumentNestingLimit(t *testing.T) {
+	defer stubPersistPluginInformation()()
+	original := getDocumentContent
+	defer func() { getDocumentContent = original }()
+	loads := 0
+	getDocumentContent = func(log log.T, name string) (string, error) {
+		loads++
+		return `{"runtimeConfig": {"aws:runDocument": {"properties": {"documentType": "SSMDocument", "documentPath": "Acme-Self"}}}}`, nil
+	}
+
+	runDocument := newRunDocumentPlugin(plugin.PluginRegistry{}, 0)
+	res := runDocument.Execute(context.NewMockDefault(), contracts.Configuration{OrchestrationDirectory: t.TempDir(), Properties: map[string]interface{}{
+		"documentType": "SSMDocument",
+		"documentPath": "Acme-Self",
+	}}, task.NewChanneledCancelFlag())
+
+	assert.Equal(t, contracts.ResultStatusFailed, res.Status)
+	assert.Equal(t, maxRunDocumentDepth, loads)
+	assert.Contains(t, res.Output, "nested documents")
+}
+
+func TestRunDocumentInvalidInput(t *testing.T) {
+	defer stubPersistPluginInformation()()
+	runDocument := newRunDocumentPlugin(plugin.PluginRegistry{}, 0)
+	for _, properties := range []map[string]interface{}{
+		{"documentType": "SSMDocument"},
+		{"documentType": "Git", "documentPath": "Acme-Deploy"},
+		{"documentType": "LocalPath", "documentPath": "child.json"},
+		{"documentType": "SSMDocument", "documentPath": "Acme-Deploy", "documentParameters": "{"},
+	} {
+		res := runDocument.Execute(context.NewMockDefault(), contracts.Configuration{OrchestrationDirectory: t.TempDir(), Properties: properties}, task.NewChanneledCancelFlag())
+		assert.Equal(t, contracts.ResultStatusFailed, res.Status, "%v", properties)
+	}
+}
+
+func TestParseDocumentParameters(t *testing.T) {
+	params, err := parseDocumentParameters(`{"commands": ["ls"]}`)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"commands": []interface{}{"ls"}}, params)
+
+	params, err = parseDocumentParameters(map[string]interface{}{"name": "agent"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "agent"}, params)
+
+	params, err = parseDocumentParameters(nil)
+	assert.Nil(t, err)
+	assert.Nil(t, params)
+
+	_, err = parseDocumentParameters([]interface{}{"agent"})
+	assert.NotNil(t, err)
+}
+
+func TestAggregateStatus(t *testing.T) {
+	results := func(statuses ...contracts.ResultStatus) map[string]*contracts.PluginResult {
+		outputs := make(map[string]*contracts.PluginResult)
+		for i, status := range statuses {
+			outputs[string(rune('a'+i))] = &contracts.PluginResult{Status: status}
+		}
+		return outputs
+	}
+	assert.Equal(t, contracts.ResultStatusSuccess, aggregateStatus(results(contracts.ResultStatusSuccess, contracts.ResultStatusSuccess)))
+	assert.Equal(t, contracts.ResultStatusSuccessAndReboot, aggregateStatus(results(contracts.ResultStatusSuccess, contracts.ResultStatusSuccessAndReboot)))
+	assert.Equal(t, contracts.ResultStatusFailed, aggregateStatus(results(contracts.ResultStatusCancelled, contracts.ResultStatusFailed)))
+	assert.Equal(t, contracts.ResultStatusTimedOut, aggregateStatus(results(contracts.ResultStatusTimedOut, contracts.ResultStatusSuccess)))
+}
@@ -0,0 +1,241 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package engine contains the general purpose plugin runner of the plugin framework.
+// schedule delays steps until a time of the day or for a duration, and implements the aws:sleepUntil action.
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/agenterror"
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/context"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/jsonutil"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/task"
+	"github.com/aws/amazon-ssm-agent/agent/times"
+)
+
+const (
+	// ScheduleFileName is the file of the orchestration directory of a delayed step which holds the time the step
+	// runs at, so that the schedule survives the restarts of the agent.
+	ScheduleFileName = "schedule.json"
+
+	// sleepFileName holds the time an aws:sleepUntil action sleeps until.
+	sleepFileName = "sleep.json"
+
+	// maxScheduleDelay caps how long a step can be delayed.
+	maxScheduleDelay = 7 * 24 * time.Hour
+)
+
+// timeOfDayLayouts are the layouts of a time of the day, in the local time of the instance.
+var timeOfDayLayouts = []string{"15:04", "15:04:05"}
+
+// scheduleClock provides the current time to the schedules.
+var scheduleClock times.Clock = times.DefaultClock
+
+// waitForSchedule waits for the given delay and returns false if the command got canceled meanwhile.
+var waitForSchedule = task.WaitFor
+
+// stepSchedule is the content of the schedule file of a step.
+type stepSchedule struct {
+	PluginID  string `json:"pluginId"`
+	MessageID string `json:"messageId"`
+	RunAt     string `json:"runAt"`
+}
+
+// SleepUntilInput represents the properties of the aws:sleepUntil action.
+// Time is a time of the day such as "02:00" in the local time of the instance, or an RFC 3339 time.
+type SleepUntilInput struct {
+	Time         string
+	DelaySeconds int
+}
+
+// isScheduled returns true if the step declares when it runs.
+func isScheduled(config contracts.Configuration) bool {
+	return config.RunAt != "" || config.DelaySeconds != 0
+}
+
+// nextRunTime returns when a step declared with the given time or delay runs.
+// A time of the day runs at its next occurrence, an RFC 3339 time which is already past runs immediately.
+func nextRunTime(now time.Time, runAt string, delaySeconds int) (next time.Time, err error) {
+	switch {
+	case runAt != "" && delaySeconds != 0:
+		return next, fmt.Errorf("a step cannot declare both a time and a delay")
+	case delaySeconds < 0:
+		return next, fmt.Errorf("invalid delay %v seconds", delaySeconds)
+	case delaySeconds > 0:
+		next = now.Add(time.Duration(delaySeconds) * time.Second)
+	default:
+		if next, err = parseRunAt(now, runAt); err != nil {
+			return
+		}
+	}
+	if next.Sub(now) > maxScheduleDelay {
+		return next, fmt.Errorf("%v is more than %v away", next.Format(time.RFC3339), maxScheduleDelay)
+	}
+	return
+}
+
+// parseRunAt returns the next occurrence of a time of the day, or the given RFC 3339 time.
+func parseRunAt(now time.Time, runAt string) (time.Time, error) {
+	runAt = strings.TrimSpace(runAt)
+	for _, layout := range timeOfDayLayouts {
+		if clock, err := time.ParseInLocation(layout, runAt, now.Location()); err == nil {
+			next := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, now.Location())
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			return next, nil
+		}
+	}
+	at, err := time.Parse(time.RFC3339, runAt)
+	if err != nil {
+		return at, fmt.Errorf("invalid time %q, expected HH:MM, HH:MM:SS or an RFC 3339 time", runAt)
+	}
+	if at.Before(now) {
+		return now, nil
+	}
+	return at, nil
+}
+
+// scheduledRunTime returns the time the step runs at: the time saved by a previous run of the step when the agent
+// restarted meanwhile, or the time computed from the declaration of the step, which is then saved.
+func scheduledRunTime(log log.T, fileName string, pluginID string, config contracts.Configuration, runAt string, delaySeconds int) (time.Time, error) {
+	path := filepath.Join(config.OrchestrationDirectory, fileName)
+	var saved stepSchedule
+	if config.OrchestrationDirectory != "" && jsonutil.UnmarshalFile(path, &saved) == nil &&
+		saved.PluginID == pluginID && saved.MessageID == config.MessageId {
+		if next, err := time.Parse(time.RFC3339Nano, saved.RunAt); err == nil {
+			log.Infof("Resuming the schedule of %v saved in %v", pluginID, path)
+			return next, nil
+		}
+	}
+
+	next, err := nextRunTime(scheduleClock.Now(), runAt, delaySeconds)
+	if err != nil || config.OrchestrationDirectory == "" {
+		return next, err
+	}
+	saved = stepSchedule{PluginID: pluginID, MessageID: config.MessageId, RunAt: next.Format(time.RFC3339Nano)}
+	content, err := json.Marshal(saved)
+	if err == nil {
+		if err = fileutil.MakeDirs(config.OrchestrationDirectory); err == nil {
+			err = fileutil.HardenedWriteFile(path, content)
+		}
+	}
+	if err != nil {
+		log.Warnf("failed to save the schedule of %v, it restarts with the agent: %v", pluginID, err)
+	}
+	return next, nil
+}
+
+// waitUntil waits until the scheduled time of the step and returns false if the step must not run,
+// the result then holds the reason.
+func waitUntil(context context.T, fileName string, pluginID string, config contracts.Configuration, runAt string, delaySeconds int, cancelFlag task.CancelFlag) (res contracts.PluginResult, ok bool) {
+	log := context.Log()
+	next, err := scheduledRunTime(log, fileName, pluginID, config, runAt, delaySeconds)
+	if err != nil {
+		err = agenterror.Wrap(agenterror.InvalidDocument, err, "invalid schedule of %v", pluginID)
+		log.Error(err)
+		res.Status = contracts.ResultStatusFailed
+		res.Code = 1
+		res.Output = err.Error()
+		res.Error = err
+		return res, false
+	}
+
+	delay := next.Sub(scheduleClock.Now())
+	if delay <= 0 {
+		return res, true
+	}
+	log.Infof("%v is scheduled at %v, waiting %v", pluginID, next.Format(time.RFC3339), delay)
+	if !waitForSchedule(delay, cancelFlag) {
+		log.Infof("%v canceled while waiting for its schedule", pluginID)
+		res.Status = contracts.ResultStatusCancelled
+		res.Code = 1
+		res.Output = fmt.Sprintf("%v canceled while waiting until %v", pluginID, next.Format(time.RFC3339))
+		return res, false
+	}
+	return res, true
+}
+
+// sleepUntilPlugin implements the aws:sleepUntil action, which waits until a time of the day or for a delay.
+type sleepUntilPlugin struct{}
+
+// Execute waits until the time, or for the delay, of the action.
+func (sleepUntilPlugin) Execute(context context.T, config contracts.Configuration, cancelFlag task.CancelFlag) (res contracts.PluginResult) {
+	log := context.Log()
+	startDateTime := time.Now()
+	defer func() {
+		res.StartDateTime = startDateTime
+		res.EndDateTime = time.Now()
+		persistPluginInformation(log, appconfig.PluginNameAwsSleepUntil, config, res)
+	}()
+
+	var input SleepUntilInput
+	if err := parseSleepUntilInput(config.Properties, &input); err != nil {
+		log.Error(err)
+		res.Status = contracts.ResultStatusFailed
+		res.Code = 1
+		res.Output = err.Error()
+		res.Error = err
+		return
+	}
+
+	var ok bool
+	if res, ok = waitUntil(context, sleepFileName, appconfig.PluginNameAwsSleepUntil, config, input.Time, input.DelaySeconds, cancelFlag); ok {
+		res.Status = contracts.ResultStatusSuccess
+		res.Output = fmt.Sprintf("Slept until %v", times.ToIso8601UTC(time.Now()))
+	}
+	return
+}
+
+// DryRun validates the time or the delay of the action.
+func (sleepUntilPlugin) DryRun(context context.T, config contracts.Configuration) (res contracts.PluginResult) {
+	res.StartDateTime = time.Now()
+	defer func() { res.EndDateTime = time.Now() }()
+
+	var input SleepUntilInput
+	err := parseSleepUntilInput(config.Properties, &input)
+	var next time.Time
+	if err == nil {
+		next, err = nextRunTime(scheduleClock.Now(), input.Time, input.DelaySeconds)
+	}
+	if err != nil {
+		res.Status = contracts.ResultStatusFailed
+		res.Code = 1
+		res.Output = fmt.Sprintf("%v%v", contracts.DryRunOutputPrefix, err)
+		return
+	}
+	res.Status = contracts.ResultStatusSuccess
+	res.Output = fmt.Sprintf("%v%v would sleep until %v", contracts.DryRunOutputPrefix, appconfig.PluginNameAwsSleepUntil, next.Format(time.RFC3339))
+	return
+}
+
+// parseSleepUntilInput parses the properties of the aws:sleepUntil action.
+func parseSleepUntilInput(properties interface{}, input *SleepUntilInput) error {
+	if err := jsonutil.Remarshal(properties, input); err != nil {
+		return fmt.Errorf("invalid format in %v properties %v; error %v", appconfig.PluginNameAwsSleepUntil, properties, err)
+	}
+	if input.Time == "" && input.DelaySeconds == 0 {
+		return fmt.Errorf("%v requires a time or a delay", appconfig.PluginNameAwsSleepUntil)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/context"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/framework/plugin"
+	"github.com/aws/amazon-ssm-agent/agent/task"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// fakeClock is a clock which only moves when the test advances it.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) chan struct{} {
+	return make(chan struct{})
+}
+
+// stubSchedule makes the schedules use the given clock and records the delays waited for instead of waiting.
+func stubSchedule(clock *fakeClock, delays *[]time.Duration, proceed bool) func() {
+	originalClock, originalWait := scheduleClock, waitForSchedule
+	scheduleClock = clock
+	waitForSchedule = func(delay time.Duration, cancelFlag task.CancelFlag) bool {
+		*delays = append(*delays, delay)
+		return proceed
+	}
+	return func() { scheduleClock, waitForSchedule = originalClock, originalWait }
+}
+
+func TestNextRunTime(t *testing.T) {
+	zone := time.FixedZone("UTC+2", 2*60*60)
+	morning := time.Date(2017, 3, 1, 1, 0, 0, 0, zone)
+	afternoon := time.Date(2017, 3, 1, 15, 0, 0, 0, zone)
+
+	next, err := nextRunTime(morning, "02:00", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2017, 3, 1, 2, 0, 0, 0, zone), next)
+
+	next, err = nextRunTime(afternoon, "02:00:30", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2017, 3, 2, 2, 0, 30, 0, zone), next)
+
+	next, err = nextRunTime(afternoon, "2017-03-01T14:00:00Z", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2017, 3, 1, 16, 0, 0, 0, zone).Unix(), next.Unix())
+
+	next, err = nextRunTime(afternoon, "2017-03-01T10:00:00Z", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, afternoon, next)
+
+	next, err = nextRunTime(morning, "", 90)
+	assert.Nil(t, err)
+	assert.Equal(t, morning.Add(90*time.Second), next)
+
+	for _, invalid := range []struct {
+		runAt        string
+		delaySeconds int
+	}{
+		{"02:00", 60},
+		{"", -1},
+		{"2am", 0},
+		{"2017-04-01T00:00:00Z", 0},
+		{"", 8 * 24 * 60 * 60},
+	} {
+		_, err = nextRunTime(morning, invalid.runAt, invalid.delaySeconds)
+		assert.NotNil(t, err, "%v", invalid)
+	}
+}
+
+// TestScheduledStepSurvivesRestart tests that a delayed step waits for the rest of its delay after a restart.
+func TestScheduledStepSurvivesRestart(t *testing.T) {
+	orchestrationDir, err := ioutil.TempDir("", "schedule")
+	assert.Nil(t, err)
+	defer os.RemoveAll(orchestrationDir)
+
+	clock := &fakeClock{now: time.Now()}
+	var delays []time.Duration
+	defer stubSchedule(clock, &delays, true)()
+
+	ctx := context.NewMockDefault()
+	cancelFlag := task.NewChanneledCancelFlag()
+	config := contracts.Configuration{OrchestrationDirectory: orchestrationDir, MessageId: "aws.ssm.c1.i-1", DelaySeconds: 600}
+	step := new(plugin.Mock)
+	step.On("Execute", mock.Anything, config, cancelFlag).Return(contracts.PluginResult{Status: contracts.ResultStatusSuccess})
+
+	res := runPlugin(ctx, step, "step", config, cancelFlag)
+	assert.Equal(t, contracts.ResultStatusSuccess, res.Status)
+
+	// the agent restarts 200 seconds later, before the step completed
+	clock.now = clock.now.Add(200 * time.Second)
+	res = runPlugin(ctx, step, "step", config, cancelFlag)
+	assert.Equal(t, contracts.ResultStatusSuccess, res.Status)
+
+	assert.Equal(t, []time.Duration{600 * time.Second, 400 * time.Second}, delays)
+	step.AssertNumberOfCalls(t, "Execute", 2)
+}
+
+// TestScheduledStepCanceled tests that a step canceled while waiting, or with an invalid schedule, does not run.
+func TestScheduledStepCanceled(t *testing.T) {
+	var delays []time.Duration
+	defer stubSchedule(&fakeClock{now: time.Now()}, &delays, false)()
+
+	step := new(plugin.Mock)
+	res := runPlugin(context.NewMockDefault(), step, "step", contracts.Configuration{DelaySeconds: 60}, task.NewChanneledCancelFlag())
+	assert.Equal(t, contracts.ResultStatusCancelled, res.Status)
+	assert.Equal(t, []time.Duration{60 * time.Second}, delays)
+
+	res = runPlugin(context.NewMockDefault(), step, "step", contracts.Configuration{RunAt: "2099-01-01T00:00:00Z"}, task.NewChanneledCancelFlag())
+	assert.Equal(t, contracts.ResultStatusFailed, res.Status)
+	step.AssertNotCalled(t, "Execute")
+}
+
+func TestSleepUntil(t *testing.T) {
+	defer stubPersistPluginInformation()()
+	var delays []time.Duration
+	defer stubSchedule(&fakeClock{now: time.Now()}, &delays, true)()
+
+	ctx := context.NewMockDefault()
+	res := sleepUntilPlugin{}.Execute(ctx, contracts.Configuration{Properties: map[string]interface{}{"delaySeconds": 30}}, task.NewChanneledCancelFlag())
+	assert.Equal(t, contracts.ResultStatusSuccess, res.Status)
+	assert.Equal(t, []time.Duration{30 * time.Second}, delays)
+
+	res = sleepUntilPlugin{}.Execute(ctx, contracts.Configuration{Properties: map[string]interface{}{}}, task.NewChanneledCancelFlag())
+	assert.Equal(t, contracts.ResultStatusFailed, res.Status)
+
+	res = sleepUntilPlugin{}.DryRun(ctx, contracts.Configuration{Properties: map[string]interface{}{"time": "02:00"}})
+	assert.Equal(t, contracts.ResultStatusSuccess, res.Status)
+	assert.Contains(t, res.Output, "would sleep until")
+}
@@ -18,8 +18,13 @@ package plugin
 import (
 	"sync"
 
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/checkpoint"
 	"github.com/aws/amazon-ssm-agent/agent/context"
 	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/copyfile"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/debuglogs"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/external"
 	"github.com/aws/amazon-ssm-agent/agent/plugins/pluginutil"
 	"github.com/aws/amazon-ssm-agent/agent/plugins/runcommand"
 	"github.com/aws/amazon-ssm-agent/agent/plugins/updatessmagent"
@@ -31,6 +36,21 @@ type T interface {
 	Execute(context context.T, config contracts.Configuration, cancelFlag task.CancelFlag) contracts.PluginResult
 }
 
+// DryRunner is implemented by plugins that can validate their configuration, and fetch the content
+// they depend on, without performing any side-effecting action.
+type DryRunner interface {
+	DryRun(context context.T, config contracts.Configuration) contracts.PluginResult
+}
+
+// Checkpointer is implemented by long running plugins (patching, large synchronizations) which save their progress
+// at safe points, so that the executor can interrupt them and resume them without restarting from scratch.
+// The engine runs a Checkpointer with ExecuteWithCheckpoint instead of Execute. A run interrupted by a ShutDown
+// must return without persisting its result, the step is then run again from its checkpoint when the agent restarts.
+type Checkpointer interface {
+	T
+	ExecuteWithCheckpoint(context context.T, config contracts.Configuration, cancelFlag task.CancelFlag, checkpoints checkpoint.T) contracts.PluginResult
+}
+
 // PluginRegistry stores a set of plugins, indexed by ID.
 type PluginRegistry map[string]T
 
@@ -77,6 +97,27 @@ func loadWorkerPlugins(context context.T) PluginRegistry {
 		workerPlugins[key] = value
 	}
 
+	for key, value := range loadExternalPlugins(context) {
+		if _, exists := workerPlugins[key]; exists {
+			context.Log().Warnf("skipping external plugin %v, a plugin of the agent has the same name", key)
+			continue
+		}
+		workerPlugins[key] = value
+	}
+
+	return workerPlugins
+}
+
+// loadExternalPlugins registers the plugins shipped as separate executables
+func loadExternalPlugins(context context.T) PluginRegistry {
+	var workerPlugins = PluginRegistry{}
+	config, err := appconfig.Config(false)
+	if err != nil {
+		return workerPlugins
+	}
+	for key, value := range external.Discover(context.Log(), config.ExternalPlugins.Directory, config.ExternalPlugins.ManifestDirectory) {
+		workerPlugins[key] = value
+	}
 	return workerPlugins
 }
 
@@ -87,7 +128,7 @@ func loadPlatformIndependentPlugins(context context.T) PluginRegistry {
 
 	// registering aws:runPowerShellScript & aws:runShellScript plugin
 	runcommandPluginName := runcommand.Name()
-	runcommandPlugin, err := runcommand.NewPlugin(pluginutil.DefaultPluginConfig())
+	runcommandPlugin, err := runcommand.NewPlugin(pluginutil.PluginConfigFor(runcommand.Name()))
 	if err != nil {
 		log.Errorf("failed to create plugin %s %v", runcommandPluginName, err)
 	} else {
@@ -103,5 +144,23 @@ func loadPlatformIndependentPlugins(context context.T) PluginRegistry {
 		workerPlugins[updateAgentPluginName] = updateAgentPlugin
 	}
 
+	// registering aws:copyFile plugin
+	copyFilePluginName := copyfile.Name()
+	copyFilePlugin, err := copyfile.NewPlugin(pluginutil.PluginConfigFor(copyfile.Name()))
+	if err != nil {
+		log.Errorf("failed to create plugin %s %v", copyFilePluginName, err)
+	} else {
+		workerPlugins[copyFilePluginName] = copyFilePlugin
+	}
+
+	// registering aws:captureDebugLogs plugin
+	debugLogsPluginName := debuglogs.Name()
+	debugLogsPlugin, err := debuglogs.NewPlugin(pluginutil.PluginConfigFor(debuglogs.Name()))
+	if err != nil {
+		log.Errorf("failed to create plugin %s %v", debugLogsPluginName, err)
+	} else {
+		workerPlugins[debugLogsPluginName] = debugLogsPlugin
+	}
+
 	return workerPlugins
 }
@@ -15,9 +15,63 @@ package plugin
 
 import (
 	"github.com/aws/amazon-ssm-agent/agent/context"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/ansible"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/chef"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/dockercompose"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/pluginutil"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/runcommand"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/salt"
 )
 
 // loadPlatformDependentPlugins registers platform dependent plugins
 func loadPlatformDependentPlugins(context context.T) PluginRegistry {
-	return PluginRegistry{}
+	log := context.Log()
+	var workerPlugins = PluginRegistry{}
+
+	// registering aws:runPowerShellScript plugin, running the scripts with PowerShell Core
+	powerShellPluginName := runcommand.PowerShellName()
+	powerShellPlugin, err := runcommand.NewPowerShellPlugin(pluginutil.PluginConfigFor(runcommand.PowerShellName()))
+	if err != nil {
+		log.Errorf("failed to create plugin %s %v", powerShellPluginName, err)
+	} else {
+		workerPlugins[powerShellPluginName] = powerShellPlugin
+	}
+
+	// registering aws:runAnsiblePlaybook plugin
+	ansiblePluginName := ansible.Name()
+	ansiblePlugin, err := ansible.NewPlugin(pluginutil.PluginConfigFor(ansible.Name()))
+	if err != nil {
+		log.Errorf("failed to create plugin %s %v", ansiblePluginName, err)
+	} else {
+		workerPlugins[ansiblePluginName] = ansiblePlugin
+	}
+
+	// registering aws:runSaltState plugin
+	saltPluginName := salt.Name()
+	saltPlugin, err := salt.NewPlugin(pluginutil.PluginConfigFor(salt.Name()))
+	if err != nil {
+		log.Errorf("failed to create plugin %s %v", saltPluginName, err)
+	} else {
+		workerPlugins[saltPluginName] = saltPlugin
+	}
+
+	// registering aws:runChefRecipe plugin
+	chefPluginName := chef.Name()
+	chefPlugin, err := chef.NewPlugin(pluginutil.PluginConfigFor(chef.Name()))
+	if err != nil {
+		log.Errorf("failed to create plugin %s %v", chefPluginName, err)
+	} else {
+		workerPlugins[chefPluginName] = chefPlugin
+	}
+
+	// registering aws:runDockerCompose plugin
+	dockerComposePluginName := dockercompose.Name()
+	dockerComposePlugin, err := dockercompose.NewPlugin(pluginutil.PluginConfigFor(dockercompose.Name()))
+	if err != nil {
+		log.Errorf("failed to create plugin %s %v", dockerComposePluginName, err)
+	} else {
+		workerPlugins[dockerComposePluginName] = dockerComposePlugin
+	}
+
+	return workerPlugins
 }
@@ -27,7 +27,7 @@ func loadPlatformDependentPlugins(context context.T) PluginRegistry {
 
 	// registering aws:psModule plugin
 	psModulePluginName := psmodule.Name()
-	psModulePlugin, err := psmodule.NewPlugin(pluginutil.DefaultPluginConfig())
+	psModulePlugin, err := psmodule.NewPlugin(pluginutil.PluginConfigFor(psmodule.Name()))
 	if err != nil {
 		log.Errorf("failed to create plugin %s %v", psModulePluginName, err)
 	} else {
@@ -36,7 +36,7 @@ func loadPlatformDependentPlugins(context context.T) PluginRegistry {
 
 	// registering aws:applications plugin
 	applicationPluginName := application.Name()
-	applicationPlugin, err := application.NewPlugin(pluginutil.DefaultPluginConfig())
+	applicationPlugin, err := application.NewPlugin(pluginutil.PluginConfigFor(application.Name()))
 	if err != nil {
 		log.Errorf("failed to create plugin %s %v", applicationPluginName, err)
 	} else {
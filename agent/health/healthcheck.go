@@ -15,8 +15,14 @@
 package health
 
 import (
+	"fmt"
+
+	"github.com/aws/amazon-ssm-agent/agent/agenterror"
+	"github.com/aws/amazon-ssm-agent/agent/backlog"
 	"github.com/aws/amazon-ssm-agent/agent/context"
 	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/contracts/plugin"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/external"
 	"github.com/aws/amazon-ssm-agent/agent/sdkutil"
 	"github.com/aws/amazon-ssm-agent/agent/ssm"
 	"github.com/aws/amazon-ssm-agent/agent/version"
@@ -25,7 +31,7 @@ import (
 
 // HealthCheck encapsulates the logic on configuring, starting and stopping core plugins
 type HealthCheck struct {
-	contracts.ICorePlugin
+	plugin.ICorePlugin
 	context               context.T
 	healthCheckStopPolicy *sdkutil.StopPolicy
 	healthJob             *scheduler.Job
@@ -52,12 +58,24 @@ func NewHealthCheck(context context.T) *HealthCheck {
 // updates SSM with the instance health information
 func (h *HealthCheck) updateHealth() {
 	log := h.context.Log()
-	log.Infof("%s reporting agent health.", name)
+	depth := backlog.Depth()
+	log.Infof("%s reporting agent health, %v messages waiting to be processed.", name, depth)
+	healthDetails := []string{fmt.Sprintf("backlog/%d", depth)}
+	if counts := agenterror.Counts(); len(counts) > 0 {
+		log.Infof("%s failures by error code since the agent started: %v", name, counts)
+	}
+	if plugins := external.LongRunningHealth(); len(plugins) > 0 {
+		log.Infof("%s long-running plugins: %v", name, external.HealthSummary(plugins))
+		healthDetails = append(healthDetails, external.HealthDetails(plugins)...)
+		if err := external.SaveLongRunningHealth(); err != nil {
+			log.Warnf("%s failed to save the health of the long-running plugins: %v", name, err)
+		}
+	}
 
 	var err error
 	//TODO when will status become inactive?
 	// If both ssm config and command is inactive => agent is inactive.
-	if _, err = h.service.UpdateInstanceInformation(log, version.Version, "Active"); err != nil {
+	if _, err = h.service.UpdateInstanceInformation(log, version.Version, "Active", healthDetails...); err != nil {
 		sdkutil.HandleAwsError(log, err, h.healthCheckStopPolicy)
 	}
 	return
@@ -0,0 +1,210 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package log is used to initialize the logger. This package should be imported once, usually from main, then call GetLogger.
+// capture contains the logger which also writes the messages, at a more verbose level, to a capture file.
+package log
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+
+	"github.com/cihub/seelog"
+)
+
+// captureLogger delegates to the agent logger, and to the capture logger while a capture is running.
+// Its fields are guarded by pkgMutex, like the calls of the wrappers.
+type captureLogger struct {
+	seelog.LoggerInterface
+	capture    seelog.LoggerInterface
+	stackDepth int
+}
+
+// newCaptureLogger returns a logger delegating to the given agent logger.
+func newCaptureLogger(logger seelog.LoggerInterface) *captureLogger {
+	return &captureLogger{LoggerInterface: logger}
+}
+
+// StartCapture writes the messages of the agent, from the given level (e.g. trace or debug), to the file until
+// StopCapture is called. The agent logs are written as configured meanwhile. Only one capture runs at a time.
+func StartCapture(filePath string, minLevel string) error {
+	if _, found := seelog.LogLevelFromString(minLevel); !found {
+		return fmt.Errorf("unknown log level %v", minLevel)
+	}
+	var path bytes.Buffer
+	if err := xml.EscapeText(&path, []byte(filePath)); err != nil {
+		return err
+	}
+	capture, err := seelog.LoggerFromConfigAsBytes([]byte(fmt.Sprintf(`
+<seelog type="sync" minlevel="%v">
+    <outputs formatid="fmtdebug">
+        <file path="%v"/>
+    </outputs>
+    <formats>
+        <format id="fmtdebug" format="%%Date %%Time %%LEVEL [%%FuncShort @ %%File.%%Line] %%Msg%%n"/>
+    </formats>
+</seelog>
+`, minLevel, path.String())))
+	if err != nil {
+		return err
+	}
+
+	pkgMutex.Lock()
+	defer pkgMutex.Unlock()
+	logger, ok := seelogDefault.(*captureLogger)
+	if !ok {
+		capture.Close()
+		return errors.New("the agent logger is not initialized")
+	}
+	if logger.capture != nil {
+		capture.Close()
+		return errors.New("a log capture is already running")
+	}
+	capture.SetAdditionalStackDepth(logger.stackDepth)
+	logger.capture = capture
+	return nil
+}
+
+// StopCapture stops the running capture, if any, and closes the capture file.
+func StopCapture() {
+	pkgMutex.Lock()
+	defer pkgMutex.Unlock()
+	if logger, ok := seelogDefault.(*captureLogger); ok && logger.capture != nil {
+		logger.capture.Close()
+		logger.capture = nil
+	}
+}
+
+// SetAdditionalStackDepth sets the frames to skip for both loggers, including the frame of the captureLogger.
+func (l *captureLogger) SetAdditionalStackDepth(depth int) error {
+	l.stackDepth = depth + 1
+	if l.capture != nil {
+		l.capture.SetAdditionalStackDepth(l.stackDepth)
+	}
+	return l.LoggerInterface.SetAdditionalStackDepth(l.stackDepth)
+}
+
+// Tracef writes the message to the agent logger and to the capture.
+func (l *captureLogger) Tracef(format string, params ...interface{}) {
+	l.LoggerInterface.Tracef(format, params...)
+	if l.capture != nil {
+		l.capture.Tracef(format, params...)
+	}
+}
+
+// Debugf writes the message to the agent logger and to the capture.
+func (l *captureLogger) Debugf(format string, params ...interface{}) {
+	l.LoggerInterface.Debugf(format, params...)
+	if l.capture != nil {
+		l.capture.Debugf(format, params...)
+	}
+}
+
+// Infof writes the message to the agent logger and to the capture.
+func (l *captureLogger) Infof(format string, params ...interface{}) {
+	l.LoggerInterface.Infof(format, params...)
+	if l.capture != nil {
+		l.capture.Infof(format, params...)
+	}
+}
+
+// Warnf writes the message to the agent logger and to the capture.
+func (l *captureLogger) Warnf(format string, params ...interface{}) error {
+	if l.capture != nil {
+		l.capture.Warnf(format, params...)
+	}
+	return l.LoggerInterface.Warnf(format, params...)
+}
+
+// Errorf writes the message to the agent logger and to the capture.
+func (l *captureLogger) Errorf(format string, params ...interface{}) error {
+	if l.capture != nil {
+		l.capture.Errorf(format, params...)
+	}
+	return l.LoggerInterface.Errorf(format, params...)
+}
+
+// Criticalf writes the message to the agent logger and to the capture.
+func (l *captureLogger) Criticalf(format string, params ...interface{}) error {
+	if l.capture != nil {
+		l.capture.Criticalf(format, params...)
+	}
+	return l.LoggerInterface.Criticalf(format, params...)
+}
+
+// Trace writes the message to the agent logger and to the capture.
+func (l *captureLogger) Trace(v ...interface{}) {
+	l.LoggerInterface.Trace(v...)
+	if l.capture != nil {
+		l.capture.Trace(v...)
+	}
+}
+
+// Debug writes the message to the agent logger and to the capture.
+func (l *captureLogger) Debug(v ...interface{}) {
+	l.LoggerInterface.Debug(v...)
+	if l.capture != nil {
+		l.capture.Debug(v...)
+	}
+}
+
+// Info writes the message to the agent logger and to the capture.
+func (l *captureLogger) Info(v ...interface{}) {
+	l.LoggerInterface.Info(v...)
+	if l.capture != nil {
+		l.capture.Info(v...)
+	}
+}
+
+// Warn writes the message to the agent logger and to the capture.
+func (l *captureLogger) Warn(v ...interface{}) error {
+	if l.capture != nil {
+		l.capture.Warn(v...)
+	}
+	return l.LoggerInterface.Warn(v...)
+}
+
+// Error writes the message to the agent logger and to the capture.
+func (l *captureLogger) Error(v ...interface{}) error {
+	if l.capture != nil {
+		l.capture.Error(v...)
+	}
+	return l.LoggerInterface.Error(v...)
+}
+
+// Critical writes the message to the agent logger and to the capture.
+func (l *captureLogger) Critical(v ...interface{}) error {
+	if l.capture != nil {
+		l.capture.Critical(v...)
+	}
+	return l.LoggerInterface.Critical(v...)
+}
+
+// Flush flushes both loggers.
+func (l *captureLogger) Flush() {
+	if l.capture != nil {
+		l.capture.Flush()
+	}
+	l.LoggerInterface.Flush()
+}
+
+// Close stops the capture and closes the agent logger.
+func (l *captureLogger) Close() {
+	if l.capture != nil {
+		l.capture.Close()
+		l.capture = nil
+	}
+	l.LoggerInterface.Close()
+}
@@ -0,0 +1,49 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cihub/seelog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "LogCapture")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	capturePath := filepath.Join(dir, "debug.log")
+
+	defer func(original seelog.LoggerInterface) { seelogDefault = original }(seelogDefault)
+	seelogDefault = newCaptureLogger(seelog.Disabled)
+	logger := WithContext("[test]")
+
+	assert.NotNil(t, StartCapture(capturePath, "verbose"))
+	assert.Nil(t, StartCapture(capturePath, "debug"))
+	assert.NotNil(t, StartCapture(capturePath, "debug"))
+	logger.Debugf("captured %v", 1)
+	logger.Tracef("too verbose")
+	StopCapture()
+	logger.Debugf("after the capture")
+
+	content, err := ioutil.ReadFile(capturePath)
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), "[test] captured 1")
+	assert.NotContains(t, string(content), "too verbose")
+	assert.NotContains(t, string(content), "after the capture")
+}
@@ -16,10 +16,14 @@
 
 package log
 
-import "path/filepath"
+import (
+	"path/filepath"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+)
 
 func defaultConfig() []byte {
-	return loadLog(DefaultLogDir, LogFile)
+	return loadLog(appconfig.LogRootPath(DefaultLogDir), LogFile)
 }
 
 func defaultUpdaterConfig(logRoot string, logFile string) []byte {
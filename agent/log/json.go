@@ -0,0 +1,133 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package log is used to initialize the logger. This package should be imported once, usually from main, then call GetLogger.
+// json formats the log messages as JSON lines, which log pipelines ingest without parsing the text of the messages.
+package log
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// LogFormatJSON is the log format of the agent configuration writing the logs as JSON lines
+	LogFormatJSON = "json"
+
+	// jsonFormatter is the seelog formatter of the JSON lines, seelog.xml can use it as format="%Json%n"
+	jsonFormatter = "Json"
+
+	// messageIDField is the context of the messages logged while a command runs, see processor
+	messageIDField = "messageID"
+)
+
+var (
+	// contextTag matches a context prefixed to a message by the context loggers, e.g. [messageID=aws.ssm.<command>.<instance>]
+	contextTag = regexp.MustCompile(`^\[([^\]\s]+)\]\s*`)
+
+	// formatAttribute matches the format attributes of the formats of a seelog configuration
+	formatAttribute = regexp.MustCompile(`(<format\s+id="[^"]*"\s+format=")[^"]*(")`)
+
+	// configuredLogFormat returns the log format of the agent configuration
+	configuredLogFormat = func() string {
+		config, _ := appconfig.Config(false)
+		return config.Agent.LogFormat
+	}
+)
+
+// jsonLine is the JSON line of a log message.
+type jsonLine struct {
+	Timestamp string            `json:"timestamp"`
+	Level     string            `json:"level"`
+	Component string            `json:"component,omitempty"`
+	CommandID string            `json:"commandId,omitempty"`
+	Message   string            `json:"message"`
+	Fields    map[string]string `json:"fields,omitempty"`
+}
+
+func init() {
+	seelog.RegisterCustomFormatter(jsonFormatter, func(param string) seelog.FormatterFunc {
+		return formatJSON
+	})
+}
+
+// applyLogFormat makes all the formats of the seelog configuration write JSON lines when the format is json.
+func applyLogFormat(seelogConfig []byte, format string) []byte {
+	if !strings.EqualFold(strings.TrimSpace(format), LogFormatJSON) {
+		return seelogConfig
+	}
+	return formatAttribute.ReplaceAll(seelogConfig, []byte("${1}%"+jsonFormatter+"%n${2}"))
+}
+
+// formatJSON returns the JSON line of a message. The contexts prefixed to the message become fields, the context
+// without value is the component, e.g. [MessageProcessor], which is the package of the caller otherwise.
+func formatJSON(message string, level seelog.LogLevel, context seelog.LogContextInterface) interface{} {
+	line := jsonLine{Level: strings.ToUpper(level.String())}
+	callTime := time.Now()
+	if context != nil && context.IsValid() {
+		callTime = context.CallTime()
+		line.Component = packageName(context.Func())
+	}
+	line.Timestamp = callTime.UTC().Format(time.RFC3339Nano)
+
+	for {
+		match := contextTag.FindStringSubmatch(message)
+		if match == nil {
+			break
+		}
+		message = message[len(match[0]):]
+		i := strings.Index(match[1], "=")
+		if i < 0 {
+			line.Component = match[1]
+			continue
+		}
+		if line.Fields == nil {
+			line.Fields = make(map[string]string)
+		}
+		name, value := match[1][:i], match[1][i+1:]
+		line.Fields[name] = value
+		if name == messageIDField {
+			line.CommandID = commandID(value)
+		}
+	}
+	line.Message = message
+
+	content, err := json.Marshal(line)
+	if err != nil {
+		return message
+	}
+	return string(content)
+}
+
+// packageName returns the package of a function, e.g. engine for github.com/aws/amazon-ssm-agent/agent/framework/engine.runPlugin
+func packageName(function string) string {
+	name := function[strings.LastIndex(function, "/")+1:]
+	if i := strings.Index(name, "."); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// commandID returns the command of a message id, which is in the format aws.ssm.<command id>.<instance id>.
+func commandID(messageID string) string {
+	parts := strings.Split(messageID, ".")
+	if len(parts) < 4 {
+		return ""
+	}
+	return parts[len(parts)-2]
+}
@@ -0,0 +1,61 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	seelog "github.com/cihub/seelog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONLogFormat(t *testing.T) {
+	var out bytes.Buffer
+	seelogger, err := seelog.LoggerFromWriterWithMinLevelAndFormat(&out, seelog.TraceLvl, "%Json%n")
+	assert.Nil(t, err)
+
+	logger := withContext(seelogger, "[instanceID=i-1234]", "[MessageProcessor]", "[messageID=aws.ssm.2b196342-d7d4-436e-8f09-3883a1116ac3.i-1234]")
+	logger.Infof("Running plugin %v\nwith a second line", "aws:runShellScript")
+	logger.Flush()
+
+	var line jsonLine
+	assert.True(t, strings.HasSuffix(out.String(), "}\n"))
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &line))
+	assert.Equal(t, "INFO", line.Level)
+	assert.Equal(t, "MessageProcessor", line.Component)
+	assert.Equal(t, "2b196342-d7d4-436e-8f09-3883a1116ac3", line.CommandID)
+	assert.Equal(t, "Running plugin aws:runShellScript\nwith a second line", line.Message)
+	assert.Equal(t, map[string]string{
+		"instanceID": "i-1234",
+		"messageID":  "aws.ssm.2b196342-d7d4-436e-8f09-3883a1116ac3.i-1234",
+	}, line.Fields)
+	assert.NotEmpty(t, line.Timestamp)
+}
+
+func TestApplyLogFormat(t *testing.T) {
+	config := []byte(`<formats><format id="fmtinfo" format="%Date %Time %LEVEL %Msg%n"/></formats>`)
+	assert.Equal(t, config, applyLogFormat(config, ""))
+	assert.Equal(t, config, applyLogFormat(config, "text"))
+	assert.Equal(t, `<formats><format id="fmtinfo" format="%Json%n"/></formats>`, string(applyLogFormat(config, "JSON")))
+}
+
+func TestLogContextHelpers(t *testing.T) {
+	assert.Equal(t, "engine", packageName("github.com/aws/amazon-ssm-agent/agent/framework/engine.runPlugin"))
+	assert.Equal(t, "engine", packageName("github.com/aws/amazon-ssm-agent/agent/framework/engine.(*loopPlugin).Execute"))
+	assert.Equal(t, "cmd-1", commandID("aws.ssm.cmd-1.i-1234"))
+	assert.Equal(t, "", commandID("invalid"))
+}
@@ -131,10 +131,13 @@ func (f ContextFormatFilter) Filterf(format string, params ...interface{}) (newF
 func initLoggerFromBytes(seelogConfig []byte) (logger T) {
 	var seelogger seelog.LoggerInterface
 	var err error
+	seelogConfig = applySyslog(seelogConfig, configuredSyslog())
+	seelogConfig = applyLogFormat(seelogConfig, configuredLogFormat())
+	seelogConfig = applyLogRotation(seelogConfig, configuredLogRotation())
 	if seelogger, err = seelog.LoggerFromConfigAsBytes(seelogConfig); err != nil {
 		fmt.Println("Error parsing logger config:", err)
 		return nil
 	}
-	seelogDefault = seelogger
+	seelogDefault = newCaptureLogger(seelogger)
 	return withContext(seelogDefault)
 }
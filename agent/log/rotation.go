@@ -0,0 +1,370 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package log is used to initialize the logger. This package should be imported once, usually from main, then call GetLogger.
+// rotation rotates the log files of the agent on their size and age, compresses the rotated files and keeps
+// the log directory under a disk budget, so that verbose logging does not fill the volume.
+package log
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// rotatingFileReceiverName is the name of the seelog custom receiver replacing the rolling files
+	rotatingFileReceiverName = "rotatingfile"
+
+	// rotatedTimeLayout is the layout of the time appended to the name of the rotated files
+	rotatedTimeLayout = "2006-01-02T15-04-05.000"
+
+	// compressedExtension is the extension of the compressed rotated files
+	compressedExtension = ".gz"
+
+	logFilePermissions      = 0644
+	logDirectoryPermissions = 0755
+)
+
+var (
+	// rollingFileElement matches the rolling files of a seelog configuration
+	rollingFileElement = regexp.MustCompile(`<rollingfile\s([^>]*?)/>`)
+
+	// xmlAttribute matches an attribute of an element of a seelog configuration
+	xmlAttribute = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+	// rotatedFileName matches the rotated files, e.g. amazon-ssm-agent.log.2016-10-31T12-00-00.000.gz,
+	// the groups are the name of the log file and the time of the rotation
+	rotatedFileName = regexp.MustCompile(`^(.+)\.(\d{4}-\d{2}-\d{2}T\d{2}-\d{2}-\d{2}\.\d{3})(\.gz)?$`)
+
+	// logFiles are the paths of the files written by rotating files, the disk budget only counts them and their rotated files
+	logFiles     = make(map[string]bool)
+	logFilesLock sync.Mutex
+
+	// archiveLocks run the archives of the rotated files of a directory one at a time, whichever receiver rotated them,
+	// pendingArchives are the rotated files whose archive has not completed, which pruning skips
+	archiveLocks    = make(map[string]*sync.Mutex)
+	pendingArchives = make(map[string]bool)
+	archivesLock    sync.Mutex
+
+	// configuredLogRotation returns the log rotation of the agent configuration
+	configuredLogRotation = func() appconfig.LogRotationCfg {
+		config, _ := appconfig.Config(false)
+		return config.LogRotation
+	}
+
+	// now returns the current time, it is replaced in the tests
+	now = time.Now
+)
+
+func init() {
+	seelog.RegisterReceiver(rotatingFileReceiverName, &rotatingFile{})
+}
+
+// applyLogRotation replaces the rolling files of the seelog configuration with rotating files when the
+// built-in rotation is enabled. The rotating files keep the file names and formats of the rolling files.
+func applyLogRotation(seelogConfig []byte, rotation appconfig.LogRotationCfg) []byte {
+	if !rotation.Enabled {
+		return seelogConfig
+	}
+	return rollingFileElement.ReplaceAllFunc(seelogConfig, func(element []byte) []byte {
+		attributes := make(map[string]string)
+		for _, attribute := range xmlAttribute.FindAllSubmatch(element, -1) {
+			attributes[string(attribute[1])] = string(attribute[2])
+		}
+		if attributes["filename"] == "" {
+			return element
+		}
+		custom := fmt.Sprintf(`<custom name="%s"`, rotatingFileReceiverName)
+		if formatID, found := attributes["formatid"]; found {
+			custom += fmt.Sprintf(` formatid="%s"`, formatID)
+		}
+		custom += fmt.Sprintf(` data-filename="%s" data-maxsize="%d" data-maxage="%v" data-compress="%v" data-maxtotalsize="%d"/>`,
+			attributes["filename"],
+			int64(rotation.MaxFileSizeMB)*1024*1024,
+			time.Duration(rotation.MaxFileAgeHours)*time.Hour,
+			rotation.Compress,
+			int64(rotation.MaxTotalSizeMB)*1024*1024)
+		return []byte(custom)
+	})
+}
+
+// rotatingFile is the seelog receiver writing a log file, which it rotates when the file reaches its maximum
+// size or age. The rotated files are named after the time of the rotation.
+type rotatingFile struct {
+	path         string
+	maxSize      int64
+	maxAge       time.Duration
+	compress     bool
+	maxTotalSize int64
+
+	file   *os.File
+	size   int64
+	opened time.Time
+
+	// archives are the compressions and prunings of the rotated files running in the background
+	archives sync.WaitGroup
+}
+
+// registerLogFile adds a log file to the files of the disk budget of its directory.
+func registerLogFile(path string) {
+	logFilesLock.Lock()
+	defer logFilesLock.Unlock()
+	logFiles[filepath.Clean(path)] = true
+}
+
+// isLogFile returns true if the path is the file of a rotating file.
+func isLogFile(path string) bool {
+	logFilesLock.Lock()
+	defer logFilesLock.Unlock()
+	return logFiles[filepath.Clean(path)]
+}
+
+// archiveLock returns the lock of the archives of the rotated files of a directory.
+func archiveLock(directory string) *sync.Mutex {
+	archivesLock.Lock()
+	defer archivesLock.Unlock()
+	directory = filepath.Clean(directory)
+	lock, found := archiveLocks[directory]
+	if !found {
+		lock = &sync.Mutex{}
+		archiveLocks[directory] = lock
+	}
+	return lock
+}
+
+// setArchivePending marks a rotated file as waiting for its archive, or unmarks it once archived.
+func setArchivePending(path string, pending bool) {
+	archivesLock.Lock()
+	defer archivesLock.Unlock()
+	if pending {
+		pendingArchives[filepath.Clean(path)] = true
+	} else {
+		delete(pendingArchives, filepath.Clean(path))
+	}
+}
+
+// isArchivePending returns true if the rotated file, or its compressed copy, is waiting for its archive.
+func isArchivePending(path string) bool {
+	archivesLock.Lock()
+	defer archivesLock.Unlock()
+	return pendingArchives[filepath.Clean(strings.TrimSuffix(path, compressedExtension))]
+}
+
+// AfterParse reads the settings of the receiver and opens the log file.
+func (r *rotatingFile) AfterParse(initArgs seelog.CustomReceiverInitArgs) (err error) {
+	attributes := initArgs.XmlCustomAttrs
+	if r.path = attributes["filename"]; r.path == "" {
+		return fmt.Errorf("%v requires a filename", rotatingFileReceiverName)
+	}
+	if r.maxSize, err = strconv.ParseInt(attributes["maxsize"], 10, 64); err != nil {
+		return fmt.Errorf("invalid maxsize of %v: %v", r.path, err)
+	}
+	if r.maxAge, err = time.ParseDuration(attributes["maxage"]); err != nil {
+		return fmt.Errorf("invalid maxage of %v: %v", r.path, err)
+	}
+	if r.maxTotalSize, err = strconv.ParseInt(attributes["maxtotalsize"], 10, 64); err != nil {
+		return fmt.Errorf("invalid maxtotalsize of %v: %v", r.path, err)
+	}
+	r.compress = attributes["compress"] == "true"
+	registerLogFile(r.path)
+	return r.open()
+}
+
+// ReceiveMessage writes a formatted message, after rotating the file when the message does not fit or the file is too old.
+func (r *rotatingFile) ReceiveMessage(message string, level seelog.LogLevel, context seelog.LogContextInterface) error {
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return err
+		}
+	}
+	if r.size > 0 && (r.size+int64(len(message)) > r.maxSize || now().Sub(r.opened) >= r.maxAge) {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := r.file.WriteString(message)
+	r.size += int64(n)
+	return err
+}
+
+// Flush is a no-op, the messages are written to the file when they are received.
+func (r *rotatingFile) Flush() {
+}
+
+// Close closes the log file, once the rotated files are archived.
+func (r *rotatingFile) Close() error {
+	err := r.closeFile()
+	r.archives.Wait()
+	return err
+}
+
+// closeFile closes the log file.
+func (r *rotatingFile) closeFile() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// open opens the log file for appending. A file left over by a previous run is rotated first when it is too old.
+func (r *rotatingFile) open() (err error) {
+	if err = os.MkdirAll(filepath.Dir(r.path), logDirectoryPermissions); err != nil {
+		return
+	}
+	if info, statErr := os.Stat(r.path); statErr == nil && info.Size() > 0 && now().Sub(info.ModTime()) >= r.maxAge {
+		if err = r.archive(); err != nil {
+			return
+		}
+	}
+	if r.file, err = os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, logFilePermissions); err != nil {
+		return
+	}
+	info, err := r.file.Stat()
+	if err != nil {
+		r.file.Close()
+		r.file = nil
+		return
+	}
+	r.size = info.Size()
+	r.opened = now()
+	return nil
+}
+
+// rotate closes the log file, archives it and opens a new one.
+func (r *rotatingFile) rotate() (err error) {
+	if err = r.closeFile(); err != nil {
+		return
+	}
+	if err = r.archive(); err != nil {
+		return
+	}
+	return r.open()
+}
+
+// archive renames the log file after the current time. The rotated file is compressed in the background,
+// then the oldest rotated files are deleted until the log directory fits its budget, the messages are not
+// held up meanwhile. The errors are printed, the logger cannot log them.
+func (r *rotatingFile) archive() (err error) {
+	rotatedPath := r.path + "." + now().UTC().Format(rotatedTimeLayout)
+	setArchivePending(rotatedPath, true)
+	if err = os.Rename(r.path, rotatedPath); err != nil {
+		setArchivePending(rotatedPath, false)
+		return
+	}
+	r.archives.Add(1)
+	go func() {
+		defer r.archives.Done()
+		lock := archiveLock(filepath.Dir(r.path))
+		lock.Lock()
+		defer lock.Unlock()
+		if r.compress {
+			if err := compressFile(rotatedPath); err != nil {
+				fmt.Println("Error compressing the rotated log file", rotatedPath, err)
+			}
+		}
+		setArchivePending(rotatedPath, false)
+		if err := pruneLogDirectory(filepath.Dir(r.path), r.maxTotalSize); err != nil {
+			fmt.Println("Error deleting the oldest rotated log files:", err)
+		}
+	}()
+	return nil
+}
+
+// compressFile replaces a file with its gzip compressed copy.
+func compressFile(path string) (err error) {
+	source, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer source.Close()
+
+	destination, err := os.OpenFile(path+compressedExtension, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, logFilePermissions)
+	if err != nil {
+		return
+	}
+	writer := gzip.NewWriter(destination)
+	if _, err = io.Copy(writer, source); err == nil {
+		err = writer.Close()
+	}
+	if closeErr := destination.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + compressedExtension)
+		return
+	}
+	source.Close()
+	return os.Remove(path)
+}
+
+// pruneLogDirectory deletes the oldest rotated files until the log files of the directory and their rotated files
+// fit in maxTotalSize. The log files being written and the rotated files waiting for their archive are counted but
+// never deleted. The other files, e.g. the rolls of the rolling files of seelog, are neither counted nor deleted.
+func pruneLogDirectory(directory string, maxTotalSize int64) error {
+	files, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return err
+	}
+
+	var totalSize int64
+	var rotated []os.FileInfo
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		if isLogFile(filepath.Join(directory, file.Name())) {
+			totalSize += file.Size()
+		} else if match := rotatedFileName.FindStringSubmatch(file.Name()); match != nil && isLogFile(filepath.Join(directory, match[1])) {
+			totalSize += file.Size()
+			if !isArchivePending(filepath.Join(directory, file.Name())) {
+				rotated = append(rotated, file)
+			}
+		}
+	}
+
+	sort.Sort(rotatedFilesByTime(rotated))
+	for _, file := range rotated {
+		if totalSize <= maxTotalSize {
+			break
+		}
+		if err = os.Remove(filepath.Join(directory, file.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		totalSize -= file.Size()
+	}
+	return nil
+}
+
+// rotatedFilesByTime sorts the rotated files by their time of rotation, the oldest first.
+type rotatedFilesByTime []os.FileInfo
+
+func (f rotatedFilesByTime) Len() int      { return len(f) }
+func (f rotatedFilesByTime) Swap(i, j int) { f[i], f[j] = f[j], f[i] }
+func (f rotatedFilesByTime) Less(i, j int) bool {
+	return rotatedFileName.FindStringSubmatch(f[i].Name())[2] < rotatedFileName.FindStringSubmatch(f[j].Name())[2]
+}
@@ -0,0 +1,199 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package log
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	seelog "github.com/cihub/seelog"
+	"github.com/stretchr/testify/assert"
+)
+
+// newRotatingFile returns a rotating file writing the agent log in the test directory.
+func newRotatingFile(t *testing.T, directory string, maxSize string, maxTotalSize string) *rotatingFile {
+	receiver := &rotatingFile{}
+	err := receiver.AfterParse(seelog.CustomReceiverInitArgs{XmlCustomAttrs: map[string]string{
+		"filename":     filepath.Join(directory, LogFile),
+		"maxsize":      maxSize,
+		"maxage":       "24h0m0s",
+		"compress":     "true",
+		"maxtotalsize": maxTotalSize,
+	}})
+	assert.Nil(t, err)
+	return receiver
+}
+
+// stubNow sets the time of the rotations.
+func stubNow(current time.Time) {
+	now = func() time.Time { return current }
+}
+
+func readCompressed(t *testing.T, path string) string {
+	file, err := os.Open(path)
+	assert.Nil(t, err)
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	assert.Nil(t, err)
+	content, err := ioutil.ReadAll(reader)
+	assert.Nil(t, err)
+	return string(content)
+}
+
+func TestApplyLogRotation(t *testing.T) {
+	config := []byte(`<outputs formatid="fmtinfo">
+        <rollingfile type="size" filename="/var/log/amazon/ssm/amazon-ssm-agent.log" maxsize="30000000" maxrolls="5"/>
+        <filter levels="error,critical" formatid="fmterror">
+            <rollingfile formatid="fmterror" type="size" filename="/var/log/amazon/ssm/errors.log" maxsize="10000000" maxrolls="5"/>
+        </filter>
+    </outputs>`)
+	rotation := appconfig.LogRotationCfg{MaxFileSizeMB: 30, MaxFileAgeHours: 24, Compress: true, MaxTotalSizeMB: 200}
+	assert.Equal(t, config, applyLogRotation(config, rotation))
+
+	rotation.Enabled = true
+	assert.Equal(t, `<outputs formatid="fmtinfo">
+        <custom name="rotatingfile" data-filename="/var/log/amazon/ssm/amazon-ssm-agent.log" data-maxsize="31457280" data-maxage="24h0m0s" data-compress="true" data-maxtotalsize="209715200"/>
+        <filter levels="error,critical" formatid="fmterror">
+            <custom name="rotatingfile" formatid="fmterror" data-filename="/var/log/amazon/ssm/errors.log" data-maxsize="31457280" data-maxage="24h0m0s" data-compress="true" data-maxtotalsize="209715200"/>
+        </filter>
+    </outputs>`, string(applyLogRotation(config, rotation)))
+}
+
+func TestRotatedConfigIsValid(t *testing.T) {
+	directory, err := ioutil.TempDir("", "rotation")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+
+	rotation := appconfig.LogRotationCfg{Enabled: true, MaxFileSizeMB: 1, MaxFileAgeHours: 1, MaxTotalSizeMB: 10}
+	config := applyLogRotation(loadLog(directory, LogFile), rotation)
+	logger, err := seelog.LoggerFromConfigAsBytes(config)
+	assert.Nil(t, err)
+	logger.Error("rotated")
+	logger.Close()
+
+	content, err := ioutil.ReadFile(filepath.Join(directory, ErrorFile))
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), "ERROR")
+	assert.Contains(t, string(content), "rotated")
+}
+
+func TestRotateOnSize(t *testing.T) {
+	directory, err := ioutil.TempDir("", "rotation")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+	defer func() { now = time.Now }()
+	start := time.Date(2016, 10, 31, 12, 0, 0, 0, time.UTC)
+	stubNow(start)
+
+	receiver := newRotatingFile(t, directory, "10", "1048576")
+	assert.Nil(t, receiver.ReceiveMessage("first\n", seelog.InfoLvl, nil))
+	assert.Nil(t, receiver.ReceiveMessage("second\n", seelog.InfoLvl, nil))
+	assert.Nil(t, receiver.Close())
+
+	content, err := ioutil.ReadFile(filepath.Join(directory, LogFile))
+	assert.Nil(t, err)
+	assert.Equal(t, "second\n", string(content))
+	assert.Equal(t, "first\n", readCompressed(t, filepath.Join(directory, LogFile+".2016-10-31T12-00-00.000.gz")))
+}
+
+func TestRotateOnAge(t *testing.T) {
+	directory, err := ioutil.TempDir("", "rotation")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+	defer func() { now = time.Now }()
+	start := time.Date(2016, 10, 31, 12, 0, 0, 0, time.UTC)
+	stubNow(start)
+
+	receiver := newRotatingFile(t, directory, "1048576", "1048576")
+	assert.Nil(t, receiver.ReceiveMessage("first\n", seelog.InfoLvl, nil))
+	stubNow(start.Add(23 * time.Hour))
+	assert.Nil(t, receiver.ReceiveMessage("second\n", seelog.InfoLvl, nil))
+	stubNow(start.Add(24 * time.Hour))
+	assert.Nil(t, receiver.ReceiveMessage("third\n", seelog.InfoLvl, nil))
+	assert.Nil(t, receiver.Close())
+
+	content, err := ioutil.ReadFile(filepath.Join(directory, LogFile))
+	assert.Nil(t, err)
+	assert.Equal(t, "third\n", string(content))
+	assert.Equal(t, "first\nsecond\n", readCompressed(t, filepath.Join(directory, LogFile+".2016-11-01T12-00-00.000.gz")))
+}
+
+func TestPruneLogDirectory(t *testing.T) {
+	directory, err := ioutil.TempDir("", "rotation")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+
+	write := func(name string, size int) {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(directory, name), []byte(strings.Repeat("x", size)), 0644))
+	}
+	registerLogFile(filepath.Join(directory, LogFile))
+	registerLogFile(filepath.Join(directory, ErrorFile))
+	write(LogFile, 100)
+	write(ErrorFile, 100)
+	write(LogFile+".2016-10-29T12-00-00.000.gz", 100)
+	write(ErrorFile+".2016-10-30T12-00-00.000.gz", 100)
+	write(LogFile+".2016-10-31T12-00-00.000", 100)
+	// the files the rotation does not manage do not count
+	write(LogFile+".1", 1000)
+	write("other.log.2016-10-28T12-00-00.000", 1000)
+
+	assert.Nil(t, pruneLogDirectory(directory, 350))
+
+	files, err := ioutil.ReadDir(directory)
+	assert.Nil(t, err)
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	assert.Equal(t, []string{LogFile, LogFile + ".1", LogFile + ".2016-10-31T12-00-00.000", ErrorFile, "other.log.2016-10-28T12-00-00.000"}, names)
+}
+
+// TestPruneSkipsPendingArchives tests that pruning the directory does not delete the rotated files another
+// receiver has not archived yet, and that the receivers of a directory share the lock of its archives.
+func TestPruneSkipsPendingArchives(t *testing.T) {
+	directory, err := ioutil.TempDir("", "rotation")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+
+	registerLogFile(filepath.Join(directory, LogFile))
+	registerLogFile(filepath.Join(directory, ErrorFile))
+	pending := filepath.Join(directory, ErrorFile+".2016-10-29T12-00-00.000")
+	archived := filepath.Join(directory, LogFile+".2016-10-30T12-00-00.000.gz")
+	for _, path := range []string{pending, pending + compressedExtension, archived} {
+		assert.Nil(t, ioutil.WriteFile(path, []byte(strings.Repeat("x", 100)), 0644))
+	}
+	setArchivePending(pending, true)
+
+	assert.Nil(t, pruneLogDirectory(directory, 0))
+	for _, path := range []string{pending, pending + compressedExtension} {
+		_, err = os.Stat(path)
+		assert.Nil(t, err, path)
+	}
+	_, err = os.Stat(archived)
+	assert.True(t, os.IsNotExist(err))
+
+	setArchivePending(pending, false)
+	assert.Nil(t, pruneLogDirectory(directory, 0))
+	_, err = os.Stat(pending)
+	assert.True(t, os.IsNotExist(err))
+
+	assert.True(t, archiveLock(directory) == archiveLock(directory+string(filepath.Separator)))
+	assert.False(t, archiveLock(directory) == archiveLock(filepath.Join(directory, "other")))
+}
@@ -0,0 +1,408 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package log is used to initialize the logger. This package should be imported once, usually from main, then call GetLogger.
+// syslog forwards the agent logs to a syslog endpoint in the RFC 5424 format, for the environments which centralize
+// their logs without CloudWatch.
+package log
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// syslogReceiverName is the name of the seelog custom receiver forwarding the logs to syslog
+	syslogReceiverName = "syslog"
+
+	// syslogFormatID is the format of the messages forwarded to syslog, which carries the time and level in its header
+	syslogFormatID = "fmtsyslog"
+
+	// syslogAppName is the APP-NAME of the syslog messages
+	syslogAppName = "amazon-ssm-agent"
+
+	// The transports of the syslog sink, tls is TCP with TLS (RFC 5425)
+	SyslogProtocolUDP = "udp"
+	SyslogProtocolTCP = "tcp"
+	SyslogProtocolTLS = "tls"
+
+	syslogTimeout = 5 * time.Second
+
+	// syslogMinBackoff and syslogMaxBackoff bound the wait following a failed connection or write to the endpoint
+	syslogMinBackoff = time.Second
+	syslogMaxBackoff = time.Minute
+
+	// syslogMaxDatagramSize is the size the UDP messages are truncated to, the default maximum message size of the
+	// common syslog servers and well below the largest datagram the network takes
+	syslogMaxDatagramSize = 8192
+)
+
+var (
+	// outputsElement and formatsElement match the opening tags of the outputs and the formats of a seelog configuration
+	outputsElement = regexp.MustCompile(`<outputs(\s[^>]*)?>`)
+	formatsElement = regexp.MustCompile(`<formats>`)
+
+	// syslogFacilities are the facility codes of RFC 5424
+	syslogFacilities = map[string]int{
+		"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+		"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+		"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+	}
+
+	// syslogSeverities are the severity codes of RFC 5424 for the seelog levels
+	syslogSeverities = map[seelog.LogLevel]int{
+		seelog.CriticalLvl: 2,
+		seelog.ErrorLvl:    3,
+		seelog.WarnLvl:     4,
+		seelog.InfoLvl:     6,
+		seelog.DebugLvl:    7,
+		seelog.TraceLvl:    7,
+	}
+
+	// syslogBufferSize is the number of messages waiting to be sent, the messages received while the buffer is full
+	// are dropped so that an unreachable endpoint never holds up the agent
+	syslogBufferSize = 1000
+
+	// configuredSyslog returns the syslog sink of the agent configuration
+	configuredSyslog = func() appconfig.SyslogCfg {
+		config, _ := appconfig.Config(false)
+		return config.Syslog
+	}
+)
+
+func init() {
+	seelog.RegisterReceiver(syslogReceiverName, &syslogSink{})
+}
+
+// applySyslog adds the syslog sink to the outputs of the seelog configuration when a syslog endpoint is configured.
+// An invalid sink is reported and left out, so that the agent still writes its other logs.
+func applySyslog(seelogConfig []byte, syslog appconfig.SyslogCfg) []byte {
+	if syslog.Address == "" {
+		return seelogConfig
+	}
+	if err := validateSyslog(syslog); err != nil {
+		fmt.Println("Error in the syslog configuration, the logs are not forwarded:", err)
+		return seelogConfig
+	}
+	if !outputsElement.Match(seelogConfig) || !formatsElement.Match(seelogConfig) {
+		fmt.Println("Error in the syslog configuration, seelog.xml has no outputs or formats")
+		return seelogConfig
+	}
+
+	attributes := map[string]string{
+		"address":  syslog.Address,
+		"protocol": strings.ToLower(syslog.Protocol),
+		"facility": strings.ToLower(syslog.Facility),
+		"cafile":   syslog.CAFile,
+	}
+	custom := fmt.Sprintf(`<custom name="%s" formatid="%s"`, syslogReceiverName, syslogFormatID)
+	for _, name := range []string{"address", "protocol", "facility", "cafile"} {
+		var value bytes.Buffer
+		xml.EscapeText(&value, []byte(attributes[name]))
+		custom += fmt.Sprintf(` data-%s="%s"`, name, value.String())
+	}
+	custom += "/>"
+
+	seelogConfig = outputsElement.ReplaceAllFunc(seelogConfig, func(element []byte) []byte {
+		return append(append([]byte{}, element...), []byte("\n        "+custom)...)
+	})
+	return formatsElement.ReplaceAll(seelogConfig, []byte(`<formats>
+        <format id="`+syslogFormatID+`" format="%Msg"/>`))
+}
+
+// validateSyslog checks the protocol and the facility of the syslog sink.
+func validateSyslog(syslog appconfig.SyslogCfg) error {
+	switch strings.ToLower(syslog.Protocol) {
+	case SyslogProtocolUDP, SyslogProtocolTCP, SyslogProtocolTLS:
+	default:
+		return fmt.Errorf("unknown protocol %v, expected %v, %v or %v", syslog.Protocol, SyslogProtocolUDP, SyslogProtocolTCP, SyslogProtocolTLS)
+	}
+	if _, found := syslogFacilities[strings.ToLower(syslog.Facility)]; !found {
+		return fmt.Errorf("unknown facility %v", syslog.Facility)
+	}
+	if _, _, err := net.SplitHostPort(syslog.Address); err != nil {
+		return fmt.Errorf("invalid address %v: %v", syslog.Address, err)
+	}
+	return nil
+}
+
+// syslogSink is the seelog receiver sending the messages to a syslog endpoint. The messages are buffered and sent
+// in the background. The connection is opened when the first message is sent and opened again after a failure.
+type syslogSink struct {
+	address   string
+	protocol  string
+	facility  int
+	tlsConfig *tls.Config
+	hostname  string
+
+	frames   chan []byte
+	dropped  int64
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+
+	// the connection and the backoff are only used by the goroutine sending the messages
+	connection net.Conn
+	backoff    time.Duration
+	retryAt    time.Time
+}
+
+// AfterParse reads the settings of the receiver and starts sending the messages.
+func (s *syslogSink) AfterParse(initArgs seelog.CustomReceiverInitArgs) (err error) {
+	attributes := initArgs.XmlCustomAttrs
+	s.address = attributes["address"]
+	s.protocol = attributes["protocol"]
+	s.facility = syslogFacilities[attributes["facility"]]
+	if err = validateSyslog(appconfig.SyslogCfg{Address: s.address, Protocol: s.protocol, Facility: attributes["facility"]}); err != nil {
+		return
+	}
+	if s.protocol == SyslogProtocolTLS {
+		if s.tlsConfig, err = newSyslogTLSConfig(s.address, attributes["cafile"]); err != nil {
+			return
+		}
+	}
+	if s.hostname, err = os.Hostname(); err != nil || s.hostname == "" {
+		s.hostname = "-"
+	}
+	s.frames = make(chan []byte, syslogBufferSize)
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.send()
+	return nil
+}
+
+// newSyslogTLSConfig returns the TLS configuration of the endpoint, which trusts the certificates of the CA file
+// when one is given and the certificates of the system otherwise.
+func newSyslogTLSConfig(address string, caFile string) (*tls.Config, error) {
+	host, _, _ := net.SplitHostPort(address)
+	config := &tls.Config{ServerName: host}
+	if caFile == "" {
+		return config, nil
+	}
+	content, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the syslog CA file: %v", err)
+	}
+	config.RootCAs = x509.NewCertPool()
+	if !config.RootCAs.AppendCertsFromPEM(content) {
+		return nil, fmt.Errorf("no certificate found in the syslog CA file %v", caFile)
+	}
+	return config, nil
+}
+
+// ReceiveMessage queues a message, it is dropped when the buffer is full.
+func (s *syslogSink) ReceiveMessage(message string, level seelog.LogLevel, context seelog.LogContextInterface) error {
+	callTime := time.Now()
+	if context != nil && context.IsValid() {
+		callTime = context.CallTime()
+	}
+	select {
+	case s.frames <- s.frame(formatSyslog(s.facility, level, callTime, s.hostname, os.Getpid(), message)):
+	default:
+		atomic.AddInt64(&s.dropped, 1)
+	}
+	return nil
+}
+
+// send sends the queued messages until the sink is closed, then the messages left in the buffer while the
+// endpoint is reachable. The number of dropped messages is reported once the endpoint takes messages again.
+func (s *syslogSink) send() {
+	defer close(s.done)
+	defer s.closeConnection()
+	for {
+		select {
+		case frame := <-s.frames:
+			if s.deliver(frame) {
+				s.reportDropped()
+			}
+		case <-s.stop:
+			for {
+				select {
+				case frame := <-s.frames:
+					if !s.deliver(frame) {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// reportDropped sends the number of messages dropped since the last report.
+func (s *syslogSink) reportDropped() {
+	if dropped := atomic.SwapInt64(&s.dropped, 0); dropped > 0 {
+		notice := fmt.Sprintf("%d log messages were dropped, the syslog endpoint did not take them fast enough", dropped)
+		s.deliver(s.frame(formatSyslog(s.facility, seelog.WarnLvl, time.Now(), s.hostname, os.Getpid(), notice)))
+	}
+}
+
+// deliver sends a frame, connecting first when there is no connection. A connection following a failed connection
+// or write waits for a backoff, doubled after each failure. A frame failing on a new connection is dropped, as the
+// endpoint would refuse it again. Returns false if the frame is dropped or the sink is closed before it is sent.
+func (s *syslogSink) deliver(frame []byte) bool {
+	for {
+		newConnection := s.connection == nil
+		if newConnection {
+			if !s.waitBackoff() {
+				return false
+			}
+			var err error
+			if s.connection, err = s.dial(); err != nil {
+				s.armBackoff()
+				if s.stopped() {
+					return false
+				}
+				continue
+			}
+		}
+		s.connection.SetWriteDeadline(time.Now().Add(syslogTimeout))
+		if _, err := s.connection.Write(frame); err == nil {
+			s.backoff = 0
+			return true
+		}
+		s.closeConnection()
+		s.armBackoff()
+		if newConnection {
+			atomic.AddInt64(&s.dropped, 1)
+			return false
+		}
+		if s.stopped() {
+			return false
+		}
+	}
+}
+
+// armBackoff delays the next connection after a failure.
+func (s *syslogSink) armBackoff() {
+	s.backoff = nextSyslogBackoff(s.backoff)
+	s.retryAt = time.Now().Add(s.backoff)
+}
+
+// stopped returns true once the sink is closed.
+func (s *syslogSink) stopped() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// waitBackoff waits until the next connection is allowed. Returns false if the sink is closed meanwhile.
+func (s *syslogSink) waitBackoff() bool {
+	wait := s.retryAt.Sub(time.Now())
+	if wait <= 0 {
+		return true
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-s.stop:
+		return false
+	}
+}
+
+// nextSyslogBackoff returns the wait following a failure, from syslogMinBackoff to syslogMaxBackoff.
+func nextSyslogBackoff(backoff time.Duration) time.Duration {
+	if backoff < syslogMinBackoff {
+		return syslogMinBackoff
+	}
+	if backoff *= 2; backoff > syslogMaxBackoff {
+		return syslogMaxBackoff
+	}
+	return backoff
+}
+
+// dial opens the connection to the endpoint.
+func (s *syslogSink) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: syslogTimeout}
+	if s.protocol == SyslogProtocolTLS {
+		return tls.DialWithDialer(dialer, "tcp", s.address, s.tlsConfig)
+	}
+	return dialer.Dial(s.protocol, s.address)
+}
+
+// frame returns the bytes sent for a message, the stream transports prefix the messages with their length (RFC 6587)
+// and the UDP messages are truncated to syslogMaxDatagramSize, on a character boundary.
+func (s *syslogSink) frame(message string) []byte {
+	if s.protocol == SyslogProtocolUDP {
+		if len(message) > syslogMaxDatagramSize {
+			size := syslogMaxDatagramSize
+			for size > 0 && !utf8.RuneStart(message[size]) {
+				size--
+			}
+			message = message[:size]
+		}
+		return []byte(message)
+	}
+	return []byte(fmt.Sprintf("%d %s", len(message), message))
+}
+
+// Flush is a no-op, the messages are sent in the background.
+func (s *syslogSink) Flush() {
+}
+
+// Close stops sending the messages, after sending the buffered ones for up to syslogTimeout.
+func (s *syslogSink) Close() error {
+	if s.stop == nil {
+		return nil
+	}
+	s.stopOnce.Do(func() { close(s.stop) })
+	select {
+	case <-s.done:
+	case <-time.After(syslogTimeout):
+	}
+	return nil
+}
+
+// closeConnection closes the connection to the endpoint.
+func (s *syslogSink) closeConnection() {
+	if s.connection != nil {
+		s.connection.Close()
+		s.connection = nil
+	}
+}
+
+// formatSyslog returns the RFC 5424 message of a log message, without structured data.
+func formatSyslog(facility int, level seelog.LogLevel, callTime time.Time, hostname string, pid int, message string) string {
+	severity, found := syslogSeverities[level]
+	if !found {
+		severity = syslogSeverities[seelog.InfoLvl]
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %d - - %s",
+		facility*8+severity,
+		callTime.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		hostname,
+		syslogAppName,
+		pid,
+		strings.TrimRight(message, "\r\n"))
+}
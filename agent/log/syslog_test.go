@@ -0,0 +1,213 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package log
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	seelog "github.com/cihub/seelog"
+	"github.com/stretchr/testify/assert"
+)
+
+// newSyslogSink returns a syslog sink sending to the given address.
+func newSyslogSink(t *testing.T, address string, protocol string) *syslogSink {
+	sink := &syslogSink{}
+	err := sink.AfterParse(seelog.CustomReceiverInitArgs{XmlCustomAttrs: map[string]string{
+		"address":  address,
+		"protocol": protocol,
+		"facility": "local0",
+	}})
+	assert.Nil(t, err)
+	return sink
+}
+
+func TestApplySyslog(t *testing.T) {
+	config := []byte(`<seelog>
+    <outputs formatid="fmtinfo">
+        <console formatid="fmtinfo"/>
+    </outputs>
+    <formats>
+        <format id="fmtinfo" format="%Date %Time %LEVEL %Msg%n"/>
+    </formats>
+</seelog>`)
+	assert.Equal(t, config, applySyslog(config, appconfig.SyslogCfg{Protocol: "udp", Facility: "daemon"}))
+	assert.Equal(t, config, applySyslog(config, appconfig.SyslogCfg{Address: "logs:514", Protocol: "http", Facility: "daemon"}))
+	assert.Equal(t, config, applySyslog(config, appconfig.SyslogCfg{Address: "logs:514", Protocol: "udp", Facility: "local9"}))
+	assert.Equal(t, config, applySyslog(config, appconfig.SyslogCfg{Address: "logs", Protocol: "udp", Facility: "daemon"}))
+
+	assert.Equal(t, `<seelog>
+    <outputs formatid="fmtinfo">
+        <custom name="syslog" formatid="fmtsyslog" data-address="logs:6514" data-protocol="tls" data-facility="local0" data-cafile="/etc/ssl/a&amp;b.pem"/>
+        <console formatid="fmtinfo"/>
+    </outputs>
+    <formats>
+        <format id="fmtsyslog" format="%Msg"/>
+        <format id="fmtinfo" format="%Date %Time %LEVEL %Msg%n"/>
+    </formats>
+</seelog>`, string(applySyslog(config, appconfig.SyslogCfg{Address: "logs:6514", Protocol: "TLS", Facility: "local0", CAFile: "/etc/ssl/a&b.pem"})))
+}
+
+func TestSyslogConfigIsValid(t *testing.T) {
+	directory, err := ioutil.TempDir("", "syslog")
+	assert.Nil(t, err)
+	defer os.RemoveAll(directory)
+
+	config := applySyslog(loadLog(directory, LogFile), appconfig.SyslogCfg{Address: "127.0.0.1:514", Protocol: "tcp", Facility: "daemon"})
+	assert.Contains(t, string(config), `<custom name="syslog"`)
+	logger, err := seelog.LoggerFromConfigAsBytes(config)
+	assert.Nil(t, err)
+	logger.Close()
+}
+
+func TestFormatSyslog(t *testing.T) {
+	callTime := time.Date(2016, 10, 31, 12, 0, 0, 123456000, time.UTC)
+	assert.Equal(t, "<134>1 2016-10-31T12:00:00.123456Z host amazon-ssm-agent 42 - - Running plugin",
+		formatSyslog(16, seelog.InfoLvl, callTime, "host", 42, "Running plugin\n"))
+	assert.Equal(t, "<26>1 2016-10-31T12:00:00.123456Z host amazon-ssm-agent 42 - - failed",
+		formatSyslog(3, seelog.CriticalLvl, callTime, "host", 42, "failed"))
+}
+
+func TestSyslogSinkUDP(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	sink := newSyslogSink(t, listener.LocalAddr().String(), SyslogProtocolUDP)
+	defer sink.Close()
+	assert.Nil(t, sink.ReceiveMessage("first message\n", seelog.WarnLvl, nil))
+
+	buffer := make([]byte, 1024)
+	listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := listener.ReadFrom(buffer)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(buffer[:n]), "<132>1 "))
+	assert.True(t, strings.HasSuffix(string(buffer[:n]), " amazon-ssm-agent "+strconv.Itoa(os.Getpid())+" - - first message"))
+}
+
+func TestSyslogSinkUDPTruncates(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	sink := newSyslogSink(t, listener.LocalAddr().String(), SyslogProtocolUDP)
+	defer sink.Close()
+	assert.Nil(t, sink.ReceiveMessage(strings.Repeat("é", 70*1024), seelog.InfoLvl, nil))
+
+	buffer := make([]byte, 128*1024)
+	listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := listener.ReadFrom(buffer)
+	assert.Nil(t, err)
+	assert.True(t, n <= syslogMaxDatagramSize && n > syslogMaxDatagramSize-utf8.UTFMax, "datagram of %v bytes", n)
+	assert.True(t, utf8.Valid(buffer[:n]))
+}
+
+// TestSyslogSinkWriteFailure checks a frame the endpoint refuses on a new connection is dropped and delays the
+// next connection, instead of being sent again.
+func TestSyslogSinkWriteFailure(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	sink := &syslogSink{address: listener.LocalAddr().String(), protocol: SyslogProtocolUDP, stop: make(chan struct{})}
+	defer sink.closeConnection()
+	assert.False(t, sink.deliver(make([]byte, 128*1024)))
+	assert.Equal(t, int64(1), atomic.LoadInt64(&sink.dropped))
+	assert.Equal(t, syslogMinBackoff, sink.backoff)
+	assert.True(t, sink.retryAt.After(time.Now()))
+
+	// the next frame waits for the backoff, unless the sink is closed
+	close(sink.stop)
+	start := time.Now()
+	assert.False(t, sink.deliver([]byte("message")))
+	assert.True(t, time.Since(start) < syslogMinBackoff)
+}
+
+func TestSyslogSinkTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	received := make(chan string, 2)
+	go func() {
+		connection, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer connection.Close()
+		reader := bufio.NewReader(connection)
+		for i := 0; i < 2; i++ {
+			var length int
+			if _, err := fmt.Fscanf(reader, "%d ", &length); err != nil {
+				return
+			}
+			message := make([]byte, length)
+			if _, err := io.ReadFull(reader, message); err != nil {
+				return
+			}
+			received <- string(message)
+		}
+	}()
+
+	sink := newSyslogSink(t, listener.Addr().String(), SyslogProtocolTCP)
+	defer sink.Close()
+	assert.Nil(t, sink.ReceiveMessage("first\n", seelog.InfoLvl, nil))
+	assert.Nil(t, sink.ReceiveMessage("second\n", seelog.ErrorLvl, nil))
+
+	for _, expected := range []string{"<134>1 ", "<131>1 "} {
+		select {
+		case message := <-received:
+			assert.True(t, strings.HasPrefix(message, expected), message)
+		case <-time.After(5 * time.Second):
+			assert.Fail(t, "syslog message not received")
+		}
+	}
+}
+
+func TestSyslogSinkUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	defer func(bufferSize int) { syslogBufferSize = bufferSize }(syslogBufferSize)
+	syslogBufferSize = 2
+	sink := newSyslogSink(t, address, SyslogProtocolTCP)
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, sink.ReceiveMessage("lost\n", seelog.InfoLvl, nil))
+	}
+	assert.True(t, atomic.LoadInt64(&sink.dropped) >= 2)
+
+	// closing does not wait for the backoff
+	start := time.Now()
+	assert.Nil(t, sink.Close())
+	assert.True(t, time.Since(start) < syslogMinBackoff)
+}
+
+func TestNextSyslogBackoff(t *testing.T) {
+	assert.Equal(t, syslogMinBackoff, nextSyslogBackoff(0))
+	assert.Equal(t, 2*syslogMinBackoff, nextSyslogBackoff(syslogMinBackoff))
+	assert.Equal(t, syslogMaxBackoff, nextSyslogBackoff(syslogMaxBackoff))
+}
@@ -37,6 +37,8 @@ func NewMockLog() *Mock {
 	log.On("Errorf", mock.Anything, mock.Anything).Return(nil)
 	log.On("Tracef", mock.Anything, mock.Anything).Return()
 	log.On("Infof", mock.Anything, mock.Anything).Return()
+	log.On("Warn", mock.Anything).Return(nil)
+	log.On("Warnf", mock.Anything, mock.Anything).Return(nil)
 	return log
 }
 
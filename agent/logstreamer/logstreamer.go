@@ -0,0 +1,348 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package logstreamer streams the output of the plugins to CloudWatch Logs while they run,
+// so that long running scripts can be watched live instead of waiting for the reply.
+package logstreamer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/amazon-ssm-agent/agent/dlp"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/sdkutil"
+	"github.com/aws/amazon-ssm-agent/agent/sdkutil/attribution"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+)
+
+const (
+	// maxEventSize is the size limit of a log event, less the overhead counted by CloudWatch Logs.
+	maxEventSize = 256*1024 - 26
+
+	// maxBatchEvents is the number of events sent at most by one PutLogEvents call.
+	maxBatchEvents = 1000
+
+	// maxBatchSize is the size sent at most by one PutLogEvents call, well under the limit of the API.
+	maxBatchSize = 512 * 1024
+)
+
+// outputFileNames are the names of the files written by the plugins which are streamed.
+var outputFileNames = []string{"stdout", "stderr"}
+
+// pollInterval is how often the output files are checked for new data.
+var pollInterval = time.Second
+
+// Scanner decides whether data can leave the instance, see dlp.Scanner.
+type Scanner interface {
+	ScanBytes(log log.T, kind dlp.Kind, data []byte) error
+}
+
+// NewClient returns a CloudWatch Logs client for the region of the instance.
+func NewClient() cloudwatchlogsiface.CloudWatchLogsAPI {
+	return cloudwatchlogs.New(attribution.NewSession(sdkutil.AwsConfig()))
+}
+
+// Streamer tails the output files written under a directory and pushes their lines to a log group,
+// one log stream per file.
+type Streamer struct {
+	log          log.T
+	client       cloudwatchlogsiface.CloudWatchLogsAPI
+	groupName    string
+	streamPrefix string
+	dir          string
+	redaction    *Redaction
+	scanner      Scanner
+	groupReady   bool
+	files        map[string]*tailedFile
+	stop         chan bool
+	done         sync.WaitGroup
+}
+
+// tailedFile is an output file being streamed.
+type tailedFile struct {
+	streamName    string
+	offset        int64
+	partialLine   string
+	streamReady   bool
+	sequenceToken *string
+}
+
+// Start starts streaming the output files found under dir to the log group, in streams named after
+// the prefix and the path of the files relative to dir. The lines are masked by the redaction, unless it is nil,
+// then go through the scanner, which withholds the lines it blocks.
+func Start(log log.T, client cloudwatchlogsiface.CloudWatchLogsAPI, groupName string, streamPrefix string, dir string, redaction *Redaction, scanner Scanner) *Streamer {
+	s := &Streamer{
+		log:          log,
+		client:       client,
+		groupName:    groupName,
+		streamPrefix: streamPrefix,
+		dir:          dir,
+		redaction:    redaction,
+		scanner:      scanner,
+		files:        make(map[string]*tailedFile),
+		stop:         make(chan bool),
+	}
+	s.done.Add(1)
+	go s.run()
+	return s
+}
+
+// Stop streams the remaining output, including incomplete last lines, and stops the streamer.
+func (s *Streamer) Stop() {
+	close(s.stop)
+	s.done.Wait()
+}
+
+// run polls the output files until the streamer is stopped.
+func (s *Streamer) run() {
+	defer s.done.Done()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.poll(false)
+		case <-s.stop:
+			s.poll(true)
+			return
+		}
+	}
+}
+
+// poll streams the lines added to the output files since the last poll. Incomplete lines are kept
+// for the next poll, unless final is set.
+func (s *Streamer) poll(final bool) {
+	for _, path := range s.findOutputFiles() {
+		file, ok := s.files[path]
+		if !ok {
+			file = &tailedFile{streamName: s.streamName(path)}
+			s.files[path] = file
+		}
+		lines, err := file.readLines(path, final)
+		if err != nil {
+			s.log.Debugf("failed to read %v for streaming: %v", path, err)
+			continue
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		for i := range lines {
+			lines[i] = s.redaction.Redact(lines[i])
+		}
+		if err = s.scan(lines); err != nil {
+			lines = []string{"Output withheld: " + err.Error()}
+		}
+		if err = s.put(file, lines); err != nil {
+			s.log.Warnf("failed to stream output to %v/%v: %v", s.groupName, file.streamName, err)
+		}
+	}
+}
+
+// scan passes the lines through the scanner, if any.
+func (s *Streamer) scan(lines []string) error {
+	if s.scanner == nil {
+		return nil
+	}
+	return s.scanner.ScanBytes(s.log, dlp.KindStream, []byte(strings.Join(lines, "\n")))
+}
+
+// findOutputFiles returns the output files currently under the directory.
+func (s *Streamer) findOutputFiles() (paths []string) {
+	filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		for _, name := range outputFileNames {
+			if info.Name() == name {
+				paths = append(paths, path)
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// streamName returns the log stream of an output file. Characters not allowed in stream names are replaced.
+func (s *Streamer) streamName(path string) string {
+	relativePath, err := filepath.Rel(s.dir, path)
+	if err != nil {
+		relativePath = filepath.Base(path)
+	}
+	name := filepath.ToSlash(relativePath)
+	if s.streamPrefix != "" {
+		name = strings.TrimSuffix(s.streamPrefix, "/") + "/" + name
+	}
+	return strings.NewReplacer(":", "_", "*", "_").Replace(name)
+}
+
+// readLines reads the data appended to the file since the last read and returns its complete lines.
+// An incomplete line is returned in pieces of the size limit of an event rather than kept growing.
+func (f *tailedFile) readLines(path string, final bool) (lines []string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	if _, err = file.Seek(f.offset, os.SEEK_SET); err != nil {
+		return
+	}
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return
+	}
+	f.offset += int64(len(data))
+	f.partialLine += string(data)
+
+	if end := strings.LastIndex(f.partialLine, "\n"); end >= 0 {
+		lines = strings.Split(f.partialLine[:end], "\n")
+		f.partialLine = f.partialLine[end+1:]
+	}
+	for len(f.partialLine) >= maxEventSize {
+		piece := truncate(f.partialLine, maxEventSize)
+		lines = append(lines, piece)
+		f.partialLine = f.partialLine[len(piece):]
+	}
+	if final && f.partialLine != "" {
+		lines = append(lines, f.partialLine)
+		f.partialLine = ""
+	}
+	return
+}
+
+// put sends the lines to the stream of the file, creating the log group and the stream the first time.
+func (s *Streamer) put(file *tailedFile, lines []string) (err error) {
+	if !s.groupReady {
+		if err = ignoreAlreadyExists(s.client.CreateLogGroup(&cloudwatchlogs.CreateLogGroupInput{
+			LogGroupName: aws.String(s.groupName),
+		})); err != nil {
+			return
+		}
+		s.groupReady = true
+	}
+	if !file.streamReady {
+		if err = ignoreAlreadyExists(s.client.CreateLogStream(&cloudwatchlogs.CreateLogStreamInput{
+			LogGroupName:  aws.String(s.groupName),
+			LogStreamName: aws.String(file.streamName),
+		})); err != nil {
+			return
+		}
+		file.streamReady = true
+	}
+
+	for _, batch := range toBatches(lines, time.Now()) {
+		if err = s.putBatch(file, batch); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// putBatch sends one batch of events. The sequence token of the stream is looked up and the batch
+// sent again when the stream was written by someone else, e.g. the previous run of the agent.
+func (s *Streamer) putBatch(file *tailedFile, batch []*cloudwatchlogs.InputLogEvent) error {
+	for attempt := 0; ; attempt++ {
+		output, err := s.client.PutLogEvents(&cloudwatchlogs.PutLogEventsInput{
+			LogGroupName:  aws.String(s.groupName),
+			LogStreamName: aws.String(file.streamName),
+			LogEvents:     batch,
+			SequenceToken: file.sequenceToken,
+		})
+		if err == nil {
+			file.sequenceToken = output.NextSequenceToken
+			return nil
+		}
+		if awsErr, ok := err.(awserr.Error); !ok || attempt > 0 ||
+			(awsErr.Code() != "InvalidSequenceTokenException" && awsErr.Code() != "DataAlreadyAcceptedException") {
+			return err
+		}
+		if file.sequenceToken, err = s.lookupSequenceToken(file.streamName); err != nil {
+			return err
+		}
+	}
+}
+
+// lookupSequenceToken returns the token to use for the next PutLogEvents call on the stream.
+func (s *Streamer) lookupSequenceToken(streamName string) (*string, error) {
+	output, err := s.client.DescribeLogStreams(&cloudwatchlogs.DescribeLogStreamsInput{
+		LogGroupName:        aws.String(s.groupName),
+		LogStreamNamePrefix: aws.String(streamName),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, stream := range output.LogStreams {
+		if aws.StringValue(stream.LogStreamName) == streamName {
+			return stream.UploadSequenceToken, nil
+		}
+	}
+	return nil, nil
+}
+
+// toBatches maps the lines to events, truncated to the size limit of an event, grouped in batches
+// within the limits of PutLogEvents. Empty lines are skipped, CloudWatch Logs does not accept them.
+func toBatches(lines []string, now time.Time) (batches [][]*cloudwatchlogs.InputLogEvent) {
+	timestamp := aws.Int64(now.UnixNano() / int64(time.Millisecond))
+	var batch []*cloudwatchlogs.InputLogEvent
+	batchSize := 0
+	for _, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			continue
+		}
+		line = truncate(line, maxEventSize)
+		if len(batch) == maxBatchEvents || batchSize+len(line) > maxBatchSize {
+			batches = append(batches, batch)
+			batch, batchSize = nil, 0
+		}
+		batch = append(batch, &cloudwatchlogs.InputLogEvent{Message: aws.String(line), Timestamp: timestamp})
+		batchSize += len(line)
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return
+}
+
+// truncate returns the longest prefix of the line that fits in maxSize bytes without splitting a character.
+func truncate(line string, maxSize int) string {
+	if len(line) <= maxSize {
+		return line
+	}
+	end := maxSize
+	for end > 0 && !utf8.RuneStart(line[end]) {
+		end--
+	}
+	if end == 0 {
+		// not valid utf-8, there is no boundary to keep
+		end = maxSize
+	}
+	return line[:end]
+}
+
+// ignoreAlreadyExists returns nil for the errors of resources created before.
+func ignoreAlreadyExists(_ interface{}, err error) error {
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "ResourceAlreadyExistsException" {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,77 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package logstreamer streams the output of the plugins to CloudWatch Logs while they run.
+// redaction masks the secrets matching locally configured patterns before the lines leave the instance.
+package logstreamer
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/aws/amazon-ssm-agent/agent/audit"
+)
+
+// Redaction masks the text matching a set of regular expressions.
+// When an expression has groups, only the text of its first group is masked, e.g. the value of (?i)password=(\S+)
+type Redaction struct {
+	patterns []*regexp.Regexp
+}
+
+// NewRedaction compiles the patterns. The invalid patterns are reported and left out, the others still apply.
+func NewRedaction(patterns []string) (r *Redaction, errs []error) {
+	r = &Redaction{}
+	for _, pattern := range patterns {
+		expression, err := regexp.Compile(pattern)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid redaction pattern %q: %v", pattern, err))
+			continue
+		}
+		r.patterns = append(r.patterns, expression)
+	}
+	return
+}
+
+// Redact returns the line with the text matching the patterns replaced by audit.RedactedValue.
+func (r *Redaction) Redact(line string) string {
+	if r == nil {
+		return line
+	}
+	for _, pattern := range r.patterns {
+		if pattern.NumSubexp() == 0 {
+			line = pattern.ReplaceAllLiteralString(line, audit.RedactedValue)
+			continue
+		}
+		line = redactFirstGroup(pattern, line)
+	}
+	return line
+}
+
+// redactFirstGroup replaces the text of the first group of each match of the pattern.
+func redactFirstGroup(pattern *regexp.Regexp, line string) string {
+	var redacted []byte
+	last := 0
+	for _, match := range pattern.FindAllStringSubmatchIndex(line, -1) {
+		start, end := match[2], match[3]
+		if start < 0 {
+			continue
+		}
+		redacted = append(redacted, line[last:start]...)
+		redacted = append(redacted, audit.RedactedValue...)
+		last = end
+	}
+	if last == 0 {
+		return line
+	}
+	return string(append(redacted, line[last:]...))
+}
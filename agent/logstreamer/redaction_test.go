@@ -0,0 +1,33 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package logstreamer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedact(t *testing.T) {
+	redaction, errs := NewRedaction([]string{`(?i)(?:password|secret)=(\S+)`, `ghp_[0-9A-Za-z]{8}`, `(unclosed`})
+	assert.Len(t, errs, 1)
+
+	assert.Equal(t, "PASSWORD=*** secret=*** user=admin", redaction.Redact("PASSWORD=hunter2 secret=s3cr3t user=admin"))
+	assert.Equal(t, "clone with *** done", redaction.Redact("clone with ghp_abcd1234 done"))
+	assert.Equal(t, "nothing to hide", redaction.Redact("nothing to hide"))
+
+	// a nil redaction leaves the lines unchanged
+	var none *Redaction
+	assert.Equal(t, "password=hunter2", none.Redact("password=hunter2"))
+}
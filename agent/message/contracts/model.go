@@ -31,6 +31,8 @@ type SendCommandPayload struct {
 	DocumentName       string                    `json:"DocumentName"`
 	OutputS3KeyPrefix  string                    `json:"OutputS3KeyPrefix"`
 	OutputS3BucketName string                    `json:"OutputS3BucketName"`
+	DryRun             bool                      `json:"DryRun"`
+	Priority           string                    `json:"Priority"`
 }
 
 // SendReplyPayload represents the json structure of a reply sent to MDS.
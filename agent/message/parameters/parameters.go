@@ -18,12 +18,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
-
-	"github.com/aws/amazon-ssm-agent/agent/log"
 )
 
 const paramNameRegex = "^[a-zA-Z0-9]+$"
 
+// Logger receives the parameters which cannot be replaced. log.T implements it, tools which do not use
+// the logging of the agent provide their own.
+type Logger interface {
+	Error(v ...interface{}) error
+	Errorf(format string, params ...interface{}) error
+}
+
 // ReplaceParameters traverses an arbitrarily complex input object (maps/slices/strings/etc.)
 // and tries to replace parameters given as {{parameter}} with their values from the parameters map.
 //
@@ -37,7 +42,7 @@ const paramNameRegex = "^[a-zA-Z0-9]+$"
 // produces by default. If your object contains []string, for example, the object will be returned as is.
 //
 // Returns a new object with replaced parameters.
-func ReplaceParameters(input interface{}, parameters map[string]interface{}, logger log.T) interface{} {
+func ReplaceParameters(input interface{}, parameters map[string]interface{}, logger Logger) interface{} {
 	switch input := input.(type) {
 	case string:
 		// handle single parameter case first
@@ -109,7 +114,7 @@ func ReplaceParameter(input string, paramName string, paramValue string) string
 }
 
 // ValidParameters checks if parameter names are valid. Returns valid parameters only.
-func ValidParameters(log log.T, params map[string]interface{}) map[string]interface{} {
+func ValidParameters(log Logger, params map[string]interface{}) map[string]interface{} {
 	validParams := make(map[string]interface{})
 	for paramName, paramValue := range params {
 		if validName(paramName) {
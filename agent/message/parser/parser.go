@@ -12,6 +12,29 @@
 // permissions and limitations under the License.
 
 // Package parser contains utilities for parsing and encoding MDS/SSM messages.
+//
+// It is the public API of the agent for tools that check documents and replies with the exact semantics of the
+// agent, such as document linters and CI validators. The API is made of this package and the packages it uses:
+//
+//	github.com/aws/amazon-ssm-agent/agent/contracts           documents, plugin results and replies
+//	github.com/aws/amazon-ssm-agent/agent/message/contracts   send command, cancel and reply payloads
+//	github.com/aws/amazon-ssm-agent/agent/message/parameters  replacement of the {{ parameters }}
+//	github.com/aws/amazon-ssm-agent/agent/agenterror          stable error codes of the replies
+//	github.com/aws/amazon-ssm-agent/agent/times               time format of the replies
+//
+// These packages only depend on each other and on the standard library, so tools can import them without the
+// runtime of the agent. Within an APIVersion, exported identifiers and json fields are only added; a change
+// which breaks tools built against the previous API increments APIVersion.
+//
+// A typical validator parses a message, then inspects the runtime configuration with the parameters replaced:
+//
+//	message, err := parser.ParseMessageWithParams(logger, payload)
+//	for stepName, step := range message.DocumentContent.RuntimeConfig {
+//		...
+//	}
+//
+// and builds the reply the agent would send for a set of plugin results with PrepareRuntimeStatuses and
+// PrepareReplyPayload.
 package parser
 
 import (
@@ -19,32 +42,41 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/aws/amazon-ssm-agent/agent/agenterror"
 	"github.com/aws/amazon-ssm-agent/agent/contracts"
-	"github.com/aws/amazon-ssm-agent/agent/log"
 	messageContracts "github.com/aws/amazon-ssm-agent/agent/message/contracts"
 	"github.com/aws/amazon-ssm-agent/agent/message/parameters"
 	"github.com/aws/amazon-ssm-agent/agent/times"
 )
 
+// APIVersion is the version of the public API of the parser and of the packages it uses.
+const APIVersion = 1
+
 // ParseMessageWithParams parses an MDS message and replaces the parameters where needed.
-func ParseMessageWithParams(log log.T, payload string) (parsedMessage messageContracts.SendCommandPayload, err error) {
+func ParseMessageWithParams(log parameters.Logger, payload string) (parsedMessage messageContracts.SendCommandPayload, err error) {
 	// parse message to retrieve parameters
 	err = json.Unmarshal([]byte(payload), &parsedMessage)
 	if err != nil {
 		return
 	}
 
-	parameters := parameters.ValidParameters(log, parsedMessage.Parameters)
+	parsedMessage.DocumentContent.RuntimeConfig = ReplaceDocumentParameters(log, parsedMessage.DocumentContent, parsedMessage.Parameters)
+	return
+}
+
+// ReplaceDocumentParameters returns the runtime configuration of the document with the given parameters replaced,
+// the parameters which are not given take the default value declared by the document.
+func ReplaceDocumentParameters(log parameters.Logger, document contracts.DocumentContent, params map[string]interface{}) map[string]*contracts.PluginConfig {
+	parameters := parameters.ValidParameters(log, params)
 
 	// add default values for missing parameters
-	for k, v := range parsedMessage.DocumentContent.Parameters {
+	for k, v := range document.Parameters {
 		if _, ok := parameters[k]; !ok {
 			parameters[k] = v.DefaultVal
 		}
 	}
 
-	parsedMessage.DocumentContent.RuntimeConfig = ReplacePluginParameters(parsedMessage.DocumentContent.RuntimeConfig, parameters, log)
-	return
+	return ReplacePluginParameters(document.RuntimeConfig, parameters, log)
 }
 
 // PrepareReplyPayload creates the payload object for SendReply based on plugin outputs.
@@ -63,7 +95,8 @@ func PrepareReplyPayload(pluginID string, runtimeStatuses map[string]*contracts.
 	}
 
 	//	  New precedence order of plugin states
-	//	  Failed > TimedOut > Cancelled > Success > Cancelling > InProgress > Pending
+	//	  BlockedByAntimalware > Failed > TimedOut > Cancelled > Success > Cancelling > InProgress > Pending
+	//	  Steps skipped by the branching of the document count as successful for the status of the document.
 	//	  The above order is a contract between SSM service and agent and hence for the calculation of aggregate
 	//	  status of a (command) document, we follow the above precedence order.
 	//
@@ -73,7 +106,9 @@ func PrepareReplyPayload(pluginID string, runtimeStatuses map[string]*contracts.
 	//	  with number of failed/cancelled items.
 	//    TODO : We need to handle above to be able to send document traceoutput in case of document level errors.
 
-	if runtimeStatusCounts[string(contracts.ResultStatusFailed)] > 0 {
+	if runtimeStatusCounts[string(contracts.ResultStatusBlockedByAntimalware)] > 0 {
+		documentStatus = contracts.ResultStatusBlockedByAntimalware
+	} else if runtimeStatusCounts[string(contracts.ResultStatusFailed)] > 0 {
 		documentStatus = contracts.ResultStatusFailed
 	} else if runtimeStatusCounts[string(contracts.ResultStatusTimedOut)] > 0 {
 		documentStatus = contracts.ResultStatusTimedOut
@@ -81,7 +116,7 @@ func PrepareReplyPayload(pluginID string, runtimeStatuses map[string]*contracts.
 		documentStatus = contracts.ResultStatusCancelled
 	} else if runtimeStatusCounts[string(contracts.ResultStatusSuccessAndReboot)] > 0 {
 		documentStatus = contracts.ResultStatusSuccessAndReboot
-	} else if runtimeStatusCounts[string(contracts.ResultStatusSuccess)] == pluginCounts {
+	} else if runtimeStatusCounts[string(contracts.ResultStatusSuccess)]+runtimeStatusCounts[string(contracts.ResultStatusSkipped)] == pluginCounts {
 		documentStatus = contracts.ResultStatusSuccess
 	} else {
 		documentStatus = contracts.ResultStatusInProgress
@@ -124,7 +159,7 @@ func PrepareReplyPayloadToUpdateDocumentStatus(agentInfo contracts.AgentInfo, do
 // PrepareRuntimeStatuses creates runtime statuses from plugin outputs.
 // contracts.PluginResult and contracts.PluginRuntimeStatus are mostly same.
 // however they are decoupled on purpose so that we can do any special handling / serializing when sending response to server side.
-func PrepareRuntimeStatuses(log log.T, pluginOutputs map[string]*contracts.PluginResult) (runtimeStatuses map[string]*contracts.PluginRuntimeStatus) {
+func PrepareRuntimeStatuses(log parameters.Logger, pluginOutputs map[string]*contracts.PluginResult) (runtimeStatuses map[string]*contracts.PluginRuntimeStatus) {
 	runtimeStatuses = make(map[string]*contracts.PluginRuntimeStatus)
 	for pluginID, pluginResult := range pluginOutputs {
 		rs := prepareRuntimeStatus(log, *pluginResult)
@@ -134,19 +169,20 @@ func PrepareRuntimeStatuses(log log.T, pluginOutputs map[string]*contracts.Plugi
 }
 
 // ReplacePluginParameters replaces parameters with their values, within the plugin Properties.
-func ReplacePluginParameters(input map[string]*contracts.PluginConfig, params map[string]interface{}, logger log.T) (result map[string]*contracts.PluginConfig) {
+// The other settings of the plugin configuration (retry and branching policies) are kept as is.
+func ReplacePluginParameters(input map[string]*contracts.PluginConfig, params map[string]interface{}, logger parameters.Logger) (result map[string]*contracts.PluginConfig) {
 	result = make(map[string]*contracts.PluginConfig)
 	for pluginName, pluginConfig := range input {
-		result[pluginName] = &contracts.PluginConfig{
-			Properties: parameters.ReplaceParameters(pluginConfig.Properties, params, logger),
-		}
+		replaced := *pluginConfig
+		replaced.Properties = parameters.ReplaceParameters(pluginConfig.Properties, params, logger)
+		result[pluginName] = &replaced
 	}
 	return
 }
 
 // prepareRuntimeStatus creates the structure for the runtimeStatus section of the payload of SendReply
 // for a particular plugin.
-func prepareRuntimeStatus(log log.T, pluginResult contracts.PluginResult) contracts.PluginRuntimeStatus {
+func prepareRuntimeStatus(log parameters.Logger, pluginResult contracts.PluginResult) contracts.PluginRuntimeStatus {
 	var resultAsString string
 
 	if err := pluginResult.Error; err == nil {
@@ -161,6 +197,7 @@ func prepareRuntimeStatus(log log.T, pluginResult contracts.PluginResult) contra
 		Output:        resultAsString,
 		StartDateTime: times.ToIso8601UTC(pluginResult.StartDateTime),
 		EndDateTime:   times.ToIso8601UTC(pluginResult.EndDateTime),
+		ErrorCode:     string(agenterror.CodeOfResult(pluginResult.Status, pluginResult.Error)),
 	}
 
 	if pluginResult.OutputS3BucketName != "" {
@@ -17,10 +17,12 @@ package parser
 import (
 	"encoding/json"
 	"fmt"
+	"go/build"
 	"io/ioutil"
 	"testing"
 	"time"
 
+	"github.com/aws/amazon-ssm-agent/agent/agenterror"
 	"github.com/aws/amazon-ssm-agent/agent/contracts"
 	"github.com/aws/amazon-ssm-agent/agent/log"
 	messageContracts "github.com/aws/amazon-ssm-agent/agent/message/contracts"
@@ -101,6 +103,22 @@ func TestPrepareReplyPayload(t *testing.T) {
 	}
 }
 
+// TestPrepareReplyPayloadSkippedSteps checks the steps skipped by branching keep their status and do not fail the document.
+func TestPrepareReplyPayloadSkippedSteps(t *testing.T) {
+	runtimeStatuses := map[string]*contracts.PluginRuntimeStatus{
+		"1.install": {Status: contracts.ResultStatusSuccess},
+		"2.cleanup": {Status: contracts.ResultStatusSkipped},
+	}
+	payload := PrepareReplyPayload("", runtimeStatuses, time.Now(), contracts.AgentInfo{})
+	assert.Equal(t, contracts.ResultStatusSuccess, payload.DocumentStatus)
+	assert.Equal(t, contracts.ResultStatusSkipped, payload.RuntimeStatus["2.cleanup"].Status)
+	assert.Equal(t, 1, payload.AdditionalInfo.RuntimeStatusCounts[string(contracts.ResultStatusSkipped)])
+
+	runtimeStatuses["1.install"].Status = contracts.ResultStatusFailed
+	payload = PrepareReplyPayload("", runtimeStatuses, time.Now(), contracts.AgentInfo{})
+	assert.Equal(t, contracts.ResultStatusFailed, payload.DocumentStatus)
+}
+
 func TestPrepareRuntimeStatus(t *testing.T) {
 	type testCase struct {
 		Input  contracts.PluginResult
@@ -135,6 +153,13 @@ func TestPrepareRuntimeStatus(t *testing.T) {
 	pluginResult := contracts.PluginResult{Error: fmt.Errorf("Plugin failed with error code 1")}
 	runtimeStatus := prepareRuntimeStatus(logger, pluginResult)
 	assert.NotNil(t, runtimeStatus.Output)
+	assert.Equal(t, string(agenterror.Unknown), runtimeStatus.ErrorCode)
+
+	// test that the error code of the failure is reported
+	pluginResult = contracts.PluginResult{Status: contracts.ResultStatusFailed, Error: agenterror.New(agenterror.PluginNotFound, "no plugin")}
+	assert.Equal(t, string(agenterror.PluginNotFound), prepareRuntimeStatus(logger, pluginResult).ErrorCode)
+	pluginResult = contracts.PluginResult{Status: contracts.ResultStatusTimedOut}
+	assert.Equal(t, string(agenterror.CommandTimedOut), prepareRuntimeStatus(logger, pluginResult).ErrorCode)
 	return
 }
 
@@ -194,3 +219,44 @@ func Marshalling(t *testing.T) {
 	logger.Info("PluginRuntimeStatus=", string(resultbytes1))
 
 }
+
+func TestReplacePluginParametersKeepsRetryPolicy(t *testing.T) {
+	input := map[string]*contracts.PluginConfig{
+		"aws:runShellScript": {
+			Properties:          map[string]interface{}{"runCommand": "{{ command }}"},
+			MaxAttempts:         3,
+			RetryBackoffSeconds: 10,
+		},
+	}
+	result := ReplacePluginParameters(input, map[string]interface{}{"command": "ls"}, log.NewMockLog())
+	assert.Equal(t, map[string]interface{}{"runCommand": "ls"}, result["aws:runShellScript"].Properties)
+	assert.Equal(t, 3, result["aws:runShellScript"].MaxAttempts)
+	assert.Equal(t, 10, result["aws:runShellScript"].RetryBackoffSeconds)
+}
+
+// TestPublicAPIDependencies checks the packages of the public API only depend on each other and on the standard library.
+func TestPublicAPIDependencies(t *testing.T) {
+	api := map[string]bool{
+		"github.com/aws/amazon-ssm-agent/agent/message/parser":     true,
+		"github.com/aws/amazon-ssm-agent/agent/contracts":          true,
+		"github.com/aws/amazon-ssm-agent/agent/message/contracts":  true,
+		"github.com/aws/amazon-ssm-agent/agent/message/parameters": true,
+		"github.com/aws/amazon-ssm-agent/agent/agenterror":         true,
+		"github.com/aws/amazon-ssm-agent/agent/times":              true,
+	}
+
+	for path := range api {
+		pkg, err := build.Import(path, "", 0)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		for _, imported := range pkg.Imports {
+			if api[imported] {
+				continue
+			}
+			dependency, err := build.Import(imported, pkg.Dir, build.FindOnly)
+			assert.NoError(t, err)
+			assert.True(t, dependency.Goroot, "%v imports %v, which is not part of the public API", path, imported)
+		}
+	}
+}
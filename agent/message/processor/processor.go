@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/audit"
 	"github.com/aws/amazon-ssm-agent/agent/context"
 	"github.com/aws/amazon-ssm-agent/agent/contracts"
 	"github.com/aws/amazon-ssm-agent/agent/framework/engine"
@@ -63,6 +64,9 @@ const (
 
 	// the default stoppolicy error threshold. After 10 consecutive errors the plugin will stop for 15 minutes.
 	stopPolicyErrorThreshold = 10
+
+	// defaultLogStreamPrefix is the prefix of the CloudWatch Logs streams of the output of a document
+	defaultLogStreamPrefix = "{CommandId}/{InstanceId}"
 )
 
 type replyBuilder func(pluginID string, results map[string]*contracts.PluginResult) messageContracts.SendReplyPayload
@@ -87,6 +91,10 @@ type Processor struct {
 	orchestrationRootDir string
 	messagePollJob       *scheduler.Job
 	processorStopPolicy  *sdkutil.StopPolicy
+	auditJournal         *audit.Journal
+	documentTempRootDir  string
+	messageMaxAge        time.Duration
+	lastSuccessfulPoll   time.Time
 }
 
 // PluginRunner is a function that can run a set of plugins and return their outputs.
@@ -131,7 +139,7 @@ func NewProcessor(context context.T) *Processor {
 	cancelCommandTaskPool := task.NewPool(log, CancelWorkersLimit, cancelWaitDuration, clock)
 
 	// create new message processor
-	orchestrationRootDir := path.Join(appconfig.DefaultDataStorePath, instanceID, appconfig.DefaultCommandRootDirName, config.Agent.OrchestrationRootDir)
+	orchestrationRootDir := appconfig.OrchestrationRootPath(instanceID)
 
 	replyBuilder := func(pluginID string, results map[string]*contracts.PluginResult) messageContracts.SendReplyPayload {
 		runtimeStatuses := parser.PrepareRuntimeStatuses(log, results)
@@ -179,6 +187,9 @@ func NewProcessor(context context.T) *Processor {
 		orchestrationRootDir: orchestrationRootDir,
 		persistData:          persistData,
 		processorStopPolicy:  processorStopPolicy,
+		auditJournal:         newAuditJournal(config, instanceID),
+		messageMaxAge:        messageMaxAge(config.Mds),
+		documentTempRootDir:  path.Join(appconfig.DataStorePath(), instanceID, appconfig.DefaultCommandRootDirName, appconfig.DefaultLocationOfDocumentTemp),
 	}
 }
 
@@ -187,6 +198,12 @@ func processSendReply(log log.T, messageID string, mdsService service.Service, p
 	if err != nil {
 		log.Error("could not marshal reply payload!", err)
 	}
+	if err = scanReply(log, payloadB); err != nil {
+		payloadDoc = withholdReplyOutputs(payloadDoc, err)
+		if payloadB, err = json.Marshal(payloadDoc); err != nil {
+			log.Error("could not marshal reply payload!", err)
+		}
+	}
 	payload := string(payloadB)
 	log.Info("Sending reply ", jsonutil.Indent(payload))
 	err = mdsService.SendReply(log, messageID, payload)
@@ -0,0 +1,128 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package processor implements MDS plugin processor
+// processor_audit records received commands in the local audit journal
+package processor
+
+import (
+	"path"
+	"sort"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/agenterror"
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/audit"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	messageContracts "github.com/aws/amazon-ssm-agent/agent/message/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/times"
+	"github.com/aws/aws-sdk-go/service/ssmmds"
+)
+
+// newAuditJournal returns the command audit journal, or nil when the journal is disabled.
+func newAuditJournal(config appconfig.SsmagentConfig, instanceID string) *audit.Journal {
+	if !config.Audit.JournalEnabled {
+		return nil
+	}
+	journalPath := config.Audit.JournalPath
+	if journalPath == "" {
+		journalPath = path.Join(appconfig.DataStorePath(),
+			instanceID,
+			appconfig.DefaultLocationOfAudit,
+			appconfig.DefaultAuditJournalFileName)
+	}
+	return audit.NewJournal(journalPath)
+}
+
+// auditCommandReceived records a send command message with its (redacted) parameters.
+func (p *Processor) auditCommandReceived(log log.T, msg ssmmds.Message, parsedMessage messageContracts.SendCommandPayload) {
+	p.appendAuditEntry(log, audit.Entry{
+		Event:         audit.EventCommandReceived,
+		Source:        *msg.Topic,
+		MessageID:     *msg.MessageId,
+		CommandID:     parsedMessage.CommandID,
+		DocumentName:  parsedMessage.DocumentName,
+		Parameters:    audit.RedactParameters(parsedMessage.Parameters),
+		StartDateTime: times.ToIso8601UTC(times.DefaultClock.Now()),
+	})
+}
+
+// auditCommandCompleted records the final status of a command.
+func (p *Processor) auditCommandCompleted(log log.T, documentInfo messageContracts.DocumentInfo, outputs map[string]*contracts.PluginResult) {
+	entry := audit.Entry{
+		Event:        audit.EventCommandCompleted,
+		MessageID:    documentInfo.MessageID,
+		CommandID:    documentInfo.CommandID,
+		DocumentName: documentInfo.DocumentName,
+		Status:       documentInfo.DocumentStatus,
+		EndDateTime:  times.ToIso8601UTC(times.DefaultClock.Now()),
+	}
+	if start, ok := earliestStartTime(outputs); ok {
+		entry.StartDateTime = times.ToIso8601UTC(start)
+	}
+	entry.ErrorCodes = errorCodes(outputs)
+	p.appendAuditEntry(log, entry)
+}
+
+// auditCancelReceived records a cancel command message and whether the cancellation succeeded.
+func (p *Processor) auditCancelReceived(log log.T, msg ssmmds.Message, cancelCmd messageContracts.CancelCommandState) {
+	p.appendAuditEntry(log, audit.Entry{
+		Event:     audit.EventCancelReceived,
+		Source:    *msg.Topic,
+		MessageID: *msg.MessageId,
+		CommandID: cancelCmd.CancelCommandID,
+		Status:    cancelCmd.Status,
+	})
+}
+
+// appendAuditEntry timestamps the entry and appends it to the journal, if one is configured.
+func (p *Processor) appendAuditEntry(log log.T, entry audit.Entry) {
+	if p.auditJournal == nil {
+		return
+	}
+	entry.Time = times.ToIso8601UTC(times.DefaultClock.Now())
+	if err := p.auditJournal.Append(entry); err != nil {
+		log.Errorf("failed to append %v of command %v to audit journal %v: %v", entry.Event, entry.CommandID, p.auditJournal.Path(), err)
+	}
+}
+
+// earliestStartTime returns the earliest start time of the given plugin results.
+func earliestStartTime(outputs map[string]*contracts.PluginResult) (start time.Time, ok bool) {
+	for _, output := range outputs {
+		if output == nil || output.StartDateTime.IsZero() {
+			continue
+		}
+		if !ok || output.StartDateTime.Before(start) {
+			start = output.StartDateTime
+			ok = true
+		}
+	}
+	return
+}
+
+// errorCodes returns the sorted, unique error codes of the plugins which did not succeed.
+func errorCodes(outputs map[string]*contracts.PluginResult) (codes []string) {
+	seen := make(map[agenterror.Code]bool)
+	for _, output := range outputs {
+		if output == nil {
+			continue
+		}
+		if code := agenterror.CodeOfResult(output.Status, output.Error); code != "" && !seen[code] {
+			seen[code] = true
+			codes = append(codes, string(code))
+		}
+	}
+	sort.Strings(codes)
+	return
+}
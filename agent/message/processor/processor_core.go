@@ -18,17 +18,17 @@ package processor
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"path"
 	"path/filepath"
 	"strings"
 
 	"sync"
 
+	"github.com/aws/amazon-ssm-agent/agent/agenterror"
 	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/backlog"
 	"github.com/aws/amazon-ssm-agent/agent/context"
 	"github.com/aws/amazon-ssm-agent/agent/contracts"
-	"github.com/aws/amazon-ssm-agent/agent/fileutil"
 	"github.com/aws/amazon-ssm-agent/agent/framework/engine"
 	"github.com/aws/amazon-ssm-agent/agent/jsonutil"
 	messageContracts "github.com/aws/amazon-ssm-agent/agent/message/contracts"
@@ -36,6 +36,7 @@ import (
 	"github.com/aws/amazon-ssm-agent/agent/message/service"
 	commandStateHelper "github.com/aws/amazon-ssm-agent/agent/message/statemanager"
 	"github.com/aws/amazon-ssm-agent/agent/platform"
+	"github.com/aws/amazon-ssm-agent/agent/precondition"
 	"github.com/aws/amazon-ssm-agent/agent/sdkutil"
 	"github.com/aws/amazon-ssm-agent/agent/task"
 	"github.com/aws/aws-sdk-go/service/ssmmds"
@@ -54,53 +55,31 @@ func (p *Processor) processOlderMessages() {
 		return
 	}
 
-	//process older messages from PENDING folder
-	unprocessedMsgsLocation := path.Join(appconfig.DefaultDataStorePath,
-		instanceID,
-		appconfig.DefaultCommandRootDirName,
-		appconfig.DefaultLocationOfState,
-		appconfig.DefaultLocationOfPending)
+	// delete the temporary directories of commands which will not be resumed
+	p.removeOrphanedDocumentTempDirs(log, instanceID)
 
-	if isDirectoryEmpty, _ := fileutil.IsDirEmpty(unprocessedMsgsLocation); isDirectoryEmpty {
-
-		log.Debugf("No messages to process from %v", unprocessedMsgsLocation)
+	//process older messages from PENDING location of the store
+	commandIDs := commandStateHelper.ListCommands(log, instanceID, appconfig.DefaultLocationOfPending)
+	if len(commandIDs) == 0 {
+		log.Debugf("No messages to process from %v", appconfig.DefaultLocationOfPending)
+	}
 
-	} else {
+	//iterate through all pending messages
+	for _, commandID := range commandIDs {
+		log.Debugf("Processing an older message with messageID - %v", commandID)
 
-		//get all pending messages
-		files, err := ioutil.ReadDir(unprocessedMsgsLocation)
+		var msg ssmmds.Message
 
-		//TODO:  revisit this when bookkeeping is made invasive
-		if err != nil {
-			log.Errorf("skipping reading pending messages from %v. unexpected error encountered - %v", unprocessedMsgsLocation, err)
-			return
-		}
+		//parse the message
+		if err := commandStateHelper.GetData(log, commandID, instanceID, appconfig.DefaultLocationOfPending, &msg); err != nil {
+			log.Errorf("skipping processsing of pending messages. encountered error %v while reading pending message - %v", err, commandID)
+		} else {
+			//call processMessage for every message read from the pending location
 
-		//iterate through all pending messages
-		for _, f := range files {
-			log.Debugf("Processing an older message with messageID - %v", f.Name())
-
-			//construct the absolute path - safely assuming that interim state for older messages are already present in Pending folder
-			file := path.Join(appconfig.DefaultDataStorePath,
-				instanceID,
-				appconfig.DefaultCommandRootDirName,
-				appconfig.DefaultLocationOfState,
-				appconfig.DefaultLocationOfPending,
-				f.Name())
-
-			var msg ssmmds.Message
-
-			//parse the message
-			if err := jsonutil.UnmarshalFile(file, &msg); err != nil {
-				log.Errorf("skipping processsing of pending messages. encountered error %v while reading pending message from file - %v", err, f)
-			} else {
-				//call processMessage for every message read from the pending folder
-
-				//we will end up sending acks again for this message - but that's ok because
-				//unless a message has been deleted - multiple acks are allowed by MDS.
-				//If this becomes an issue - we can stub out ack part from processMessage
-				p.processMessage(&msg)
-			}
+			//we will end up sending acks again for this message - but that's ok because
+			//unless a message has been deleted - multiple acks are allowed by MDS.
+			//If this becomes an issue - we can stub out ack part from processMessage
+			p.processMessage(&msg)
 		}
 	}
 
@@ -115,85 +94,61 @@ func (p *Processor) processMessagesFromCurrent(instanceID string) {
 	log := p.context.Log()
 	config := p.context.AppConfig()
 
-	unprocessedMsgsLocation := path.Join(appconfig.DefaultDataStorePath,
-		instanceID,
-		appconfig.DefaultCommandRootDirName,
-		appconfig.DefaultLocationOfState,
-		appconfig.DefaultLocationOfCurrent)
-
-	if isDirectoryEmpty, _ := fileutil.IsDirEmpty(unprocessedMsgsLocation); isDirectoryEmpty {
-
-		log.Debugf("no older messages to process from %v", unprocessedMsgsLocation)
-
-	} else {
+	//get all older messages from previous run of agent
+	commandIDs := commandStateHelper.ListCommands(log, instanceID, appconfig.DefaultLocationOfCurrent)
+	if len(commandIDs) == 0 {
+		log.Debugf("no older messages to process from %v", appconfig.DefaultLocationOfCurrent)
+	}
 
-		//get all older messages from previous run of agent
-		files, err := ioutil.ReadDir(unprocessedMsgsLocation)
+	//iterate through all old executing messages
+	for _, commandID := range commandIDs {
+		log.Debugf("processing previously unexecuted message - %v", commandID)
 
-		//TODO:  revisit this when bookkeeping is made invasive
-		if err != nil {
-			log.Errorf("skipping reading inprogress messages from %v. unexpected error encountered - %v", unprocessedMsgsLocation, err)
-			return
-		}
+		var oldCmdState messageContracts.CommandState
 
-		//iterate through all old executing messages
-		for _, f := range files {
-			log.Debugf("processing previously unexecuted message - %v", f.Name())
-
-			//construct the absolute path - safely assuming that interim state for older messages are already present in Current folder
-			file := path.Join(appconfig.DefaultDataStorePath,
-				instanceID,
-				appconfig.DefaultCommandRootDirName,
-				appconfig.DefaultLocationOfState,
-				appconfig.DefaultLocationOfCurrent,
-				f.Name())
-
-			var oldCmdState messageContracts.CommandState
-
-			//parse the message
-			//TODO:  Not all messages in Current folder correspond to SendCommand.
-			if err := jsonutil.UnmarshalFile(file, &oldCmdState); err != nil {
-				log.Errorf("skipping processsing of previously unexecuted messages. encountered error %v while reading unprocessed message from file - %v", err, f)
-			} else {
-				if oldCmdState.DocumentInformation.RunCount >= config.Mds.CommandRetryLimit {
-					//TODO:  Move command to corrupt/failed
-					// do not process as the command has failed too many times
-					break
-				}
+		//parse the message
+		//TODO:  Not all messages in Current location correspond to SendCommand.
+		if err := commandStateHelper.GetData(log, commandID, instanceID, appconfig.DefaultLocationOfCurrent, &oldCmdState); err != nil {
+			log.Errorf("skipping processsing of previously unexecuted messages. encountered error %v while reading unprocessed message - %v", err, commandID)
+		} else {
+			if oldCmdState.DocumentInformation.RunCount >= config.Mds.CommandRetryLimit {
+				//TODO:  Move command to corrupt/failed
+				// do not process as the command has failed too many times
+				break
+			}
 
-				pluginOutputs := make(map[string]*contracts.PluginResult)
-
-				// increment the command run count
-				oldCmdState.DocumentInformation.RunCount++
-				// Update reboot status
-				for v := range oldCmdState.PluginsInformation {
-					plugin := oldCmdState.PluginsInformation[v]
-					if plugin.HasExecuted && plugin.Result.Status == contracts.ResultStatusSuccessAndReboot {
-						log.Debugf("plugin %v has completed a reboot. Setting status to Success.", v)
-						plugin.Result.Status = contracts.ResultStatusSuccess
-						oldCmdState.PluginsInformation[v] = plugin
-						pluginOutputs[v] = &plugin.Result
-						p.sendResponse(oldCmdState.DocumentInformation.MessageID, v, pluginOutputs)
-					}
+			pluginOutputs := make(map[string]*contracts.PluginResult)
+
+			// increment the command run count
+			oldCmdState.DocumentInformation.RunCount++
+			// Update reboot status
+			for v := range oldCmdState.PluginsInformation {
+				plugin := oldCmdState.PluginsInformation[v]
+				if plugin.HasExecuted && plugin.Result.Status == contracts.ResultStatusSuccessAndReboot {
+					log.Debugf("plugin %v has completed a reboot. Setting status to Success.", v)
+					plugin.Result.Status = contracts.ResultStatusSuccess
+					oldCmdState.PluginsInformation[v] = plugin
+					pluginOutputs[v] = &plugin.Result
+					p.sendResponse(oldCmdState.DocumentInformation.MessageID, v, pluginOutputs)
 				}
+			}
 
-				// func PersistData(log log.T, commandID, instanceID, locationFolder string, object interface{}) {
-				commandStateHelper.PersistData(log, oldCmdState.DocumentInformation.CommandID, instanceID, appconfig.DefaultLocationOfCurrent, oldCmdState)
-
-				//Submit the work to Job Pool so that we don't block for processing of new messages
-				err := p.sendCommandPool.Submit(log, oldCmdState.DocumentInformation.MessageID, func(cancelFlag task.CancelFlag) {
-					p.runCmdsUsingCmdState(p.context.With("[messageID="+oldCmdState.DocumentInformation.MessageID+"]"),
-						p.service,
-						p.pluginRunner,
-						cancelFlag,
-						p.buildReply,
-						p.sendResponse,
-						oldCmdState)
-				})
-				if err != nil {
-					log.Error("SendCommand failed for previously unexecuted commands", err)
-					return
-				}
+			// func PersistData(log log.T, commandID, instanceID, locationFolder string, object interface{}) {
+			commandStateHelper.PersistData(log, oldCmdState.DocumentInformation.CommandID, instanceID, appconfig.DefaultLocationOfCurrent, oldCmdState)
+
+			//Submit the work to Job Pool so that we don't block for processing of new messages
+			err := p.sendCommandPool.Submit(log, oldCmdState.DocumentInformation.MessageID, func(cancelFlag task.CancelFlag) {
+				p.runCmdsUsingCmdState(p.context.With("[messageID="+oldCmdState.DocumentInformation.MessageID+"]"),
+					p.service,
+					p.pluginRunner,
+					cancelFlag,
+					p.buildReply,
+					p.sendResponse,
+					oldCmdState)
+			})
+			if err != nil {
+				log.Error("SendCommand failed for previously unexecuted commands", err)
+				return
 			}
 		}
 	}
@@ -282,6 +237,10 @@ func (p *Processor) runCmdsUsingCmdState(context context.T,
 	//send document level reply
 	log.Debug("sending reply on message completion ", outputs)
 	sendResponse(command.DocumentInformation.MessageID, "", outputs)
+	newCmdState.DocumentInformation.DocumentStatus = documentInfo.DocumentStatus
+	p.auditCommandCompleted(log, newCmdState.DocumentInformation, outputs)
+	recordMessageProcessed(SendCommandTopicPrefix, newCmdState.DocumentInformation.DocumentStatus)
+	p.removeDocumentTempDir(log, newCmdState.DocumentInformation.CommandID)
 
 	//persist : commands execution in completed folder (terminal state folder)
 	log.Debugf("execution of %v is over. Moving interimState file from Current to Completed folder", newCmdState.DocumentInformation.MessageID)
@@ -314,6 +273,14 @@ func (p *Processor) processMessage(msg *ssmmds.Message) {
 	context := p.context.With("[messageID=" + *msg.MessageId + "]")
 	log := context.Log()
 
+	// the message leaves the backlog when its job completes, or right away when no job is submitted
+	submitted := false
+	defer func() {
+		if !submitted {
+			backlog.Done()
+		}
+	}()
+
 	log.Debug("Processing message")
 
 	if err := validate(msg); err != nil {
@@ -328,6 +295,11 @@ func (p *Processor) processMessage(msg *ssmmds.Message) {
 	}
 	log.Debugf("Ack done. Received message - messageId - %v, MessageString - %v", *msg.MessageId, msg.GoString())
 
+	// reject stale send commands, which can be redelivered long after they were sent
+	if strings.HasPrefix(*msg.Topic, string(SendCommandTopicPrefix)) && p.rejectExpiredMessage(log, msg) {
+		return
+	}
+
 	//persisting received msg in file-system [pending folder]
 	p.persistData(msg, appconfig.DefaultLocationOfPending)
 
@@ -339,7 +311,10 @@ func (p *Processor) processMessage(msg *ssmmds.Message) {
 
 	switch {
 	case strings.HasPrefix(*msg.Topic, string(SendCommandTopicPrefix)):
-		err := p.sendCommandPool.Submit(log, *msg.MessageId, func(cancelFlag task.CancelFlag) {
+		priority := commandPriority(log, msg.Payload, p.context.AppConfig().Mds.DocumentPriorities)
+		log.Debugf("Scheduling the command with %v priority", priority)
+		err := p.sendCommandPool.SubmitWithPriority(log, *msg.MessageId, func(cancelFlag task.CancelFlag) {
+			defer backlog.Done()
 			p.processSendCommandMessage(context,
 				p.service,
 				p.orchestrationRootDir,
@@ -348,20 +323,23 @@ func (p *Processor) processMessage(msg *ssmmds.Message) {
 				p.buildReply,
 				p.sendResponse,
 				*msg)
-		})
+		}, priority)
 		if err != nil {
 			log.Error("SendCommand failed", err)
 			return
 		}
+		submitted = true
 
 	case strings.HasPrefix(*msg.Topic, string(CancelCommandTopicPrefix)):
 		err := p.cancelCommandPool.Submit(log, *msg.MessageId, func(cancelFlag task.CancelFlag) {
+			defer backlog.Done()
 			p.processCancelCommandMessage(context, p.service, p.sendCommandPool, *msg)
 		})
 		if err != nil {
 			log.Error("CancelCommand failed", err)
 			return
 		}
+		submitted = true
 
 	default:
 		log.Error("unexpected topic name ", *msg.Topic)
@@ -386,7 +364,10 @@ func (p *Processor) processSendCommandMessage(context context.T,
 
 	parsedMessage, err := parser.ParseMessageWithParams(log, *msg.Payload)
 	if err != nil {
-		log.Error("format of received message is invalid ", err)
+		err = agenterror.Wrap(agenterror.InvalidDocument, err, "format of received message is invalid")
+		agenterror.Record(agenterror.InvalidDocument)
+		recordMessageProcessed(SendCommandTopicPrefix, contracts.ResultStatusFailed)
+		log.Error(err)
 		err = mdsService.FailMessage(log, *msg.MessageId, service.InternalHandlerException)
 		if err != nil {
 			sdkutil.HandleAwsError(log, err, p.processorStopPolicy)
@@ -397,6 +378,8 @@ func (p *Processor) processSendCommandMessage(context context.T,
 	parsedMessageContent, _ := jsonutil.Marshal(parsedMessage)
 	log.Debug("ParsedMessage is ", jsonutil.Indent(parsedMessageContent))
 
+	p.auditCommandReceived(log, msg, parsedMessage)
+
 	// adapt plugin configuration format from MDS to plugin expected format
 	s3KeyPrefix := path.Join(parsedMessage.OutputS3KeyPrefix, parsedMessage.CommandID, *msg.Destination)
 
@@ -424,20 +407,36 @@ func (p *Processor) processSendCommandMessage(context context.T,
 		s3KeyPrefix,
 		*msg.MessageId)
 
+	// dry-run can be requested by the message or forced by the local configuration
+	dryRun := parsedMessage.DryRun || context.AppConfig().Mds.DryRun
+	if dryRun {
+		log.Infof("Command %v will be executed in dry-run mode, no plugin will perform side-effecting actions", commandID)
+		setDryRun(pluginConfigurations)
+	}
+
+	setCloudWatchLogs(pluginConfigurations, parsedMessage.DocumentContent.OutputCloudWatchLogs, commandID, *msg.Destination)
+
+	// create the temporary directory of the document, it is deleted once the reply is sent
+	setDocumentTempDir(pluginConfigurations, p.createDocumentTempDir(log, commandID))
+
 	//persist : all information in current folder
 	log.Info("Persisting message in current execution folder")
 
 	//Data format persisted in Current Folder is defined by the struct - CommandState
 	interimCmdState := initializeCommandState(pluginConfigurations, msg, parsedMessage)
 
-	// persist new interim command state in current folder
-	commandStateHelper.PersistData(log, commandID, *msg.Destination, appconfig.DefaultLocationOfCurrent, interimCmdState)
+	// persist new interim command state in current folder, deleting it from pending folder since the command is getting executed
+	commandStateHelper.MoveData(log, commandID, *msg.Destination, appconfig.DefaultLocationOfPending, appconfig.DefaultLocationOfCurrent, interimCmdState)
 
-	//Deleting from pending folder since the command is getting executed
-	commandStateHelper.RemoveData(log, commandID, *msg.Destination, appconfig.DefaultLocationOfPending)
-
-	log.Debug("Running plugins...")
-	outputs := runPlugins(context, *msg.MessageId, pluginConfigurations, sendResponse, cancelFlag)
+	var outputs map[string]*contracts.PluginResult
+	satisfied, reason := precondition.Evaluate(log, parsedMessage.DocumentContent.Preconditions)
+	if satisfied {
+		log.Debug("Running plugins...")
+		outputs = runPlugins(context, *msg.MessageId, pluginConfigurations, sendResponse, cancelFlag)
+	} else {
+		log.Infof("Skipping plugins of command %v: %v", commandID, reason)
+		outputs = skippedPluginResults(pluginConfigurations, reason)
+	}
 	pluginOutputContent, _ := jsonutil.Marshal(outputs)
 	log.Debugf("Plugin outputs %v", jsonutil.Indent(pluginOutputContent))
 
@@ -475,6 +474,9 @@ func (p *Processor) processSendCommandMessage(context context.T,
 
 	log.Debug("Sending reply on message completion ", outputs)
 	sendResponse(*msg.MessageId, "", outputs)
+	p.auditCommandCompleted(log, documentInfo, outputs)
+	recordMessageProcessed(SendCommandTopicPrefix, documentInfo.DocumentStatus)
+	p.removeDocumentTempDir(log, commandID)
 
 	//persist : commands execution in completed folder (terminal state folder)
 	log.Debugf("execution of %v is over. Moving interimState file from Current to Completed folder", *msg.MessageId)
@@ -492,7 +494,7 @@ func (p *Processor) processSendCommandMessage(context context.T,
 			isUpdate = true
 		}
 	}
-	if !isUpdate {
+	if !isUpdate || dryRun || !satisfied {
 		err = mdsService.DeleteMessage(log, *msg.MessageId)
 		if err != nil {
 			sdkutil.HandleAwsError(log, err, p.processorStopPolicy)
@@ -514,7 +516,10 @@ func (p *Processor) processCancelCommandMessage(context context.T,
 	var parsedMessage messageContracts.CancelPayload
 	err := json.Unmarshal([]byte(*msg.Payload), &parsedMessage)
 	if err != nil {
-		log.Error("format of received cancel message is invalid ", err)
+		err = agenterror.Wrap(agenterror.InvalidCancelRequest, err, "format of received cancel message is invalid")
+		agenterror.Record(agenterror.InvalidCancelRequest)
+		recordMessageProcessed(CancelCommandTopicPrefix, contracts.ResultStatusFailed)
+		log.Error(err)
 		err = mdsService.FailMessage(log, *msg.MessageId, service.InternalHandlerException)
 		if err != nil {
 			sdkutil.HandleAwsError(log, err, p.processorStopPolicy)
@@ -526,11 +531,8 @@ func (p *Processor) processCancelCommandMessage(context context.T,
 	//persist in current folder here
 	cancelCmd := initializeCancelCommandState(msg, parsedMessage)
 	commandID := getCommandID(*msg.MessageId)
-	// persist new interim command state in current folder
-	commandStateHelper.PersistData(log, commandID, *msg.Destination, appconfig.DefaultLocationOfCurrent, cancelCmd)
-
-	//remove from pending folder
-	commandStateHelper.RemoveData(log, commandID, *msg.Destination, appconfig.DefaultLocationOfPending)
+	// persist new interim command state in current folder and remove it from pending folder
+	commandStateHelper.MoveData(log, commandID, *msg.Destination, appconfig.DefaultLocationOfPending, appconfig.DefaultLocationOfCurrent, cancelCmd)
 
 	log.Debugf("Canceling job with id %v...", parsedMessage.CancelMessageID)
 
@@ -545,6 +547,8 @@ func (p *Processor) processCancelCommandMessage(context context.T,
 
 	//persist the final status of cancel-message in current folder
 	commandStateHelper.PersistData(log, commandID, *msg.Destination, appconfig.DefaultLocationOfCurrent, cancelCmd)
+	p.auditCancelReceived(log, msg, cancelCmd)
+	recordMessageProcessed(CancelCommandTopicPrefix, cancelCmd.Status)
 
 	//persist : commands execution in completed folder (terminal state folder)
 	log.Debugf("Execution of %v is over. Moving interimState file from Current to Completed folder", *msg.MessageId)
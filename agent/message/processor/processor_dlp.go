@@ -0,0 +1,50 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package processor implements MDS plugin processor
+// processor_dlp passes the reply payloads through the DLP scanner before they are sent
+package processor
+
+import (
+	"fmt"
+
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/dlp"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	messageContracts "github.com/aws/amazon-ssm-agent/agent/message/contracts"
+)
+
+// scanReply passes the reply payload through the DLP scanner of the agent configuration
+var scanReply = func(log log.T, payload []byte) error {
+	return dlp.Default().ScanBytes(log, dlp.KindReply, payload)
+}
+
+// withholdReplyOutputs replaces the outputs of a reply the DLP scanner did not let through.
+// The statuses are kept, so that the service still learns how the command went.
+func withholdReplyOutputs(payloadDoc messageContracts.SendReplyPayload, scanErr error) messageContracts.SendReplyPayload {
+	notice := fmt.Sprintf("Output withheld: %v", scanErr)
+	if payloadDoc.DocumentTraceOutput != "" {
+		payloadDoc.DocumentTraceOutput = notice
+	}
+	runtimeStatuses := make(map[string]*contracts.PluginRuntimeStatus, len(payloadDoc.RuntimeStatus))
+	for pluginID, status := range payloadDoc.RuntimeStatus {
+		if status == nil {
+			continue
+		}
+		withheld := *status
+		withheld.Output = notice
+		runtimeStatuses[pluginID] = &withheld
+	}
+	payloadDoc.RuntimeStatus = runtimeStatuses
+	return payloadDoc
+}
@@ -0,0 +1,76 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package processor implements MDS plugin processor
+// processor_expiry rejects messages which are older than the configured maximum age
+package processor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/sdkutil"
+	"github.com/aws/amazon-ssm-agent/agent/times"
+	"github.com/aws/aws-sdk-go/service/ssmmds"
+)
+
+// createdDateLayout is the layout of the CreatedDate of MDS messages.
+const createdDateLayout = "2006-01-02T15:04:05.000Z"
+
+// messageMaxAge returns the maximum age of the messages, clock skew tolerance included.
+// Returns zero, which disables the check, when the configured maximum age is zero.
+func messageMaxAge(config appconfig.MdsCfg) time.Duration {
+	if config.MessageMaxAgeMinutes <= 0 {
+		return 0
+	}
+	return time.Duration(config.MessageMaxAgeMinutes+config.ClockSkewToleranceMinutes) * time.Minute
+}
+
+// messageAge returns the age of the message, based on its CreatedDate.
+func messageAge(msg *ssmmds.Message, now time.Time) (age time.Duration, err error) {
+	createdDate, err := time.Parse(createdDateLayout, *msg.CreatedDate)
+	if err != nil {
+		return 0, fmt.Errorf("invalid CreatedDate %v: %v", *msg.CreatedDate, err)
+	}
+	return now.Sub(createdDate), nil
+}
+
+// rejectExpiredMessage replies with an Expired status and deletes the message when it is older than the maximum age
+// (clock skew tolerance included). Returns true if the message was rejected. A maximum age of zero disables the check.
+func (p *Processor) rejectExpiredMessage(log log.T, msg *ssmmds.Message) bool {
+	if p.messageMaxAge <= 0 {
+		return false
+	}
+
+	age, err := messageAge(msg, times.DefaultClock.Now())
+	if err != nil {
+		log.Warnf("unable to determine the age of the message, processing it: %v", err)
+		return false
+	}
+	if age <= p.messageMaxAge {
+		return false
+	}
+
+	traceOutput := fmt.Sprintf("Command was created %v ago and exceeds the maximum age of %v accepted by the agent.", age-age%time.Second, p.messageMaxAge)
+	log.Warnf("rejecting expired message: %v", traceOutput)
+	p.sendDocLevelResponse(*msg.MessageId, contracts.ResultStatusExpired, traceOutput)
+	recordMessageProcessed(SendCommandTopicPrefix, contracts.ResultStatusExpired)
+
+	if err = p.service.DeleteMessage(log, *msg.MessageId); err != nil {
+		sdkutil.HandleAwsError(log, err, p.processorStopPolicy)
+	}
+	return true
+}
@@ -0,0 +1,171 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package processor implements MDS plugin processor
+// processor_intake processes the backlog of messages queued while the agent was not polling, in priority order
+package processor
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/backlog"
+	messageContracts "github.com/aws/amazon-ssm-agent/agent/message/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/sdkutil"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ssmmds"
+)
+
+const (
+	// bulkIntakeMaxPolls bounds the number of GetMessages calls made to collect the backlog.
+	bulkIntakeMaxPolls = 20
+
+	// bulkIntakeOfflineThreshold is how long the agent must have gone without a successful poll
+	// for the backlog to be collected in bulk again.
+	bulkIntakeOfflineThreshold = 30 * time.Minute
+)
+
+// intake priorities, lower first
+const (
+	priorityCancel = iota
+	priorityUpdate
+	priorityRun
+)
+
+// needsBulkIntake returns true on the first poll of the processor and after long periods without a successful poll,
+// when a large backlog of messages is likely queued for the instance.
+func (p *Processor) needsBulkIntake() bool {
+	return p.lastSuccessfulPoll.IsZero() || time.Since(p.lastSuccessfulPoll) > bulkIntakeOfflineThreshold
+}
+
+// bulkIntake collects the queued messages with consecutive polls and processes them in priority order:
+// cancels first, then agent updates, then the other commands, the oldest first. The number of
+// workers of the pools still limits how many commands run concurrently.
+func (p *Processor) bulkIntake() {
+	log := p.context.Log()
+	log.Debugf("Collecting the backlog of messages")
+
+	var messages []*ssmmds.Message
+	received := make(map[string]bool)
+	for i := 0; i < bulkIntakeMaxPolls && !p.isDone(); i++ {
+		output, err := p.service.GetMessages(log, p.config.InstanceID)
+		if err != nil {
+			sdkutil.HandleAwsError(log, err, p.processorStopPolicy)
+			break
+		}
+		p.lastSuccessfulPoll = time.Now()
+
+		newMessages := 0
+		for _, msg := range output.Messages {
+			if msg.MessageId == nil || received[*msg.MessageId] {
+				continue
+			}
+			received[*msg.MessageId] = true
+			messages = append(messages, msg)
+			newMessages++
+		}
+		if newMessages == 0 {
+			break
+		}
+	}
+
+	messages = orderForIntake(messages)
+	log.Infof("Processing a backlog of %v messages", len(messages))
+	backlog.Add(len(messages))
+	for i, msg := range messages {
+		if p.isDone() {
+			// the messages left are delivered again once they are no longer acknowledged
+			backlog.Add(i - len(messages))
+			break
+		}
+		processMessage(p, msg)
+	}
+}
+
+// orderForIntake sorts the messages by priority, then by creation date. A cancel whose command is part
+// of the backlog is moved right after the command, so that the command is found when it is canceled.
+func orderForIntake(messages []*ssmmds.Message) (ordered []*ssmmds.Message) {
+	byPriority := byIntakePriority{messages: messages, priorities: make([]int, len(messages))}
+	for i, msg := range messages {
+		byPriority.priorities[i] = intakePriority(msg)
+	}
+	sort.Stable(byPriority)
+
+	present := make(map[string]bool)
+	for _, msg := range messages {
+		present[aws.StringValue(msg.MessageId)] = true
+	}
+	deferredCancels := make(map[string][]*ssmmds.Message)
+	for _, msg := range messages {
+		if target := cancelTarget(msg); target != "" && present[target] {
+			deferredCancels[target] = append(deferredCancels[target], msg)
+			continue
+		}
+		ordered = append(ordered, msg)
+	}
+	for i := 0; i < len(ordered); i++ {
+		if cancels, ok := deferredCancels[aws.StringValue(ordered[i].MessageId)]; ok {
+			ordered = append(ordered[:i+1], append(cancels, ordered[i+1:]...)...)
+		}
+	}
+	return
+}
+
+// intakePriority returns the priority of a message in bulk intake.
+func intakePriority(msg *ssmmds.Message) int {
+	topic := aws.StringValue(msg.Topic)
+	if strings.HasPrefix(topic, string(CancelCommandTopicPrefix)) {
+		return priorityCancel
+	}
+	var payload messageContracts.SendCommandPayload
+	if err := json.Unmarshal([]byte(aws.StringValue(msg.Payload)), &payload); err == nil {
+		if _, ok := payload.DocumentContent.RuntimeConfig[appconfig.PluginNameAwsAgentUpdate]; ok {
+			return priorityUpdate
+		}
+	}
+	return priorityRun
+}
+
+// cancelTarget returns the message id of the command canceled by a cancel message, if any.
+func cancelTarget(msg *ssmmds.Message) string {
+	if !strings.HasPrefix(aws.StringValue(msg.Topic), string(CancelCommandTopicPrefix)) {
+		return ""
+	}
+	var payload messageContracts.CancelPayload
+	if err := json.Unmarshal([]byte(aws.StringValue(msg.Payload)), &payload); err != nil {
+		return ""
+	}
+	return payload.CancelMessageID
+}
+
+// byIntakePriority sorts messages by priority, then by creation date. The creation dates share one layout,
+// so they sort chronologically as strings.
+type byIntakePriority struct {
+	messages   []*ssmmds.Message
+	priorities []int
+}
+
+func (s byIntakePriority) Len() int { return len(s.messages) }
+func (s byIntakePriority) Swap(i, j int) {
+	s.messages[i], s.messages[j] = s.messages[j], s.messages[i]
+	s.priorities[i], s.priorities[j] = s.priorities[j], s.priorities[i]
+}
+func (s byIntakePriority) Less(i, j int) bool {
+	if s.priorities[i] != s.priorities[j] {
+		return s.priorities[i] < s.priorities[j]
+	}
+	return aws.StringValue(s.messages[i].CreatedDate) < aws.StringValue(s.messages[j].CreatedDate)
+}
@@ -0,0 +1,48 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package processor implements MDS plugin processor
+// processor_priority determines the scheduling priority of send commands
+package processor
+
+import (
+	"encoding/json"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	messageContracts "github.com/aws/amazon-ssm-agent/agent/message/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/task"
+)
+
+// commandPriority returns the scheduling priority of a send command. The priority hint of the message
+// takes precedence over the priority configured for the document; commands are normal by default.
+func commandPriority(log log.T, payload *string, documentPriorities map[string]string) task.Priority {
+	var parsedMessage messageContracts.SendCommandPayload
+	if payload == nil {
+		return task.PriorityNormal
+	}
+	if err := json.Unmarshal([]byte(*payload), &parsedMessage); err != nil {
+		// the message is rejected later on, when it is processed
+		return task.PriorityNormal
+	}
+
+	for _, name := range []string{parsedMessage.Priority, documentPriorities[parsedMessage.DocumentName]} {
+		if name == "" {
+			continue
+		}
+		if priority, ok := task.ParsePriority(name); ok {
+			return priority
+		}
+		log.Warnf("ignoring unknown priority %v of document %v", name, parsedMessage.DocumentName)
+	}
+	return task.PriorityNormal
+}
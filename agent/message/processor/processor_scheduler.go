@@ -20,6 +20,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/aws/amazon-ssm-agent/agent/backlog"
 	"github.com/aws/amazon-ssm-agent/agent/sdkutil"
 	"github.com/carlescere/scheduler"
 )
@@ -62,7 +63,11 @@ func (p *Processor) loop() {
 			p.processorStopPolicy = newStopPolicy()
 		}
 
-		p.pollOnce()
+		if p.needsBulkIntake() {
+			p.bulkIntake()
+		} else {
+			p.pollOnce()
+		}
 		log.Debugf("mdsprocessor's stoppolicy after polling is %v", p.processorStopPolicy)
 
 		// Slow down a bit in case GetMessages returns
@@ -129,8 +134,10 @@ func (p *Processor) pollOnce() {
 		sdkutil.HandleAwsError(log, err, p.processorStopPolicy)
 		return
 	}
+	p.lastSuccessfulPoll = time.Now()
 	log.Debugf("Got %v messages", len(messages.Messages))
 
+	backlog.Add(len(messages.Messages))
 	for _, msg := range messages.Messages {
 		processMessage(p, msg)
 	}
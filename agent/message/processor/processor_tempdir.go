@@ -0,0 +1,100 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package processor implements MDS plugin processor
+// processor_tempdir manages the temporary directory dedicated to each document execution
+package processor
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	commandStateHelper "github.com/aws/amazon-ssm-agent/agent/message/statemanager"
+)
+
+// getDocumentTempDir returns the temporary directory of the given command, or an empty string
+// when the processor is not configured with a temporary root directory.
+func (p *Processor) getDocumentTempDir(commandID string) string {
+	if p.documentTempRootDir == "" {
+		return ""
+	}
+	return filepath.Join(p.documentTempRootDir, fileutil.RemoveInvalidChars(commandID))
+}
+
+// createDocumentTempDir creates the temporary directory of the command, accessible to administrators only.
+// It returns an empty string if the directory could not be created, in which case the document runs without one.
+func (p *Processor) createDocumentTempDir(log log.T, commandID string) string {
+	tempDir := p.getDocumentTempDir(commandID)
+	if tempDir == "" {
+		return ""
+	}
+	if err := fileutil.MakeDirsWithExecuteAccess(tempDir); err != nil {
+		log.Errorf("failed to create temporary directory of command %v: %v", commandID, err)
+		return ""
+	}
+	if err := fileutil.HardenDirectory(tempDir); err != nil {
+		log.Errorf("failed to restrict access to temporary directory %v, removing it: %v", tempDir, err)
+		p.removeDocumentTempDir(log, commandID)
+		return ""
+	}
+	log.Debugf("created temporary directory %v for command %v", tempDir, commandID)
+	return tempDir
+}
+
+// removeDocumentTempDir securely deletes the temporary directory of the command.
+func (p *Processor) removeDocumentTempDir(log log.T, commandID string) {
+	tempDir := p.getDocumentTempDir(commandID)
+	if tempDir == "" {
+		return
+	}
+	if err := fileutil.SecureRemoveAll(tempDir); err != nil {
+		log.Errorf("failed to securely delete temporary directory %v: %v", tempDir, err)
+	}
+}
+
+// removeOrphanedDocumentTempDirs deletes the temporary directories left behind by commands which are not
+// in progress anymore, for instance when the agent crashed before the directory could be deleted.
+// Commands still in the current location of the store keep their directory since they are about to be resumed.
+func (p *Processor) removeOrphanedDocumentTempDirs(log log.T, instanceID string) {
+	if p.documentTempRootDir == "" || !fileutil.Exists(p.documentTempRootDir) {
+		return
+	}
+	dirs, err := ioutil.ReadDir(p.documentTempRootDir)
+	if err != nil {
+		log.Errorf("failed to list temporary directories in %v: %v", p.documentTempRootDir, err)
+		return
+	}
+
+	current := make(map[string]bool)
+	for _, commandID := range commandStateHelper.ListCommands(log, instanceID, appconfig.DefaultLocationOfCurrent) {
+		current[fileutil.RemoveInvalidChars(commandID)] = true
+	}
+	for _, dir := range dirs {
+		if current[dir.Name()] {
+			continue
+		}
+		log.Infof("deleting orphaned temporary directory of command %v", dir.Name())
+		p.removeDocumentTempDir(log, dir.Name())
+	}
+}
+
+// setDocumentTempDir exposes the temporary directory of the document to every plugin configuration
+func setDocumentTempDir(pluginConfigurations map[string]*contracts.Configuration, tempDir string) {
+	for _, pluginConfig := range pluginConfigurations {
+		pluginConfig.DocumentTempDirectory = tempDir
+	}
+}
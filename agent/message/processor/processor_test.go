@@ -22,8 +22,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/aws/amazon-ssm-agent/agent/agenterror"
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/backlog"
 	"github.com/aws/amazon-ssm-agent/agent/context"
 	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/dlp"
 	"github.com/aws/amazon-ssm-agent/agent/jsonutil"
 	"github.com/aws/amazon-ssm-agent/agent/log"
 	messageContracts "github.com/aws/amazon-ssm-agent/agent/message/contracts"
@@ -230,7 +234,7 @@ func TestProcessMessageWithSendCommandTopicPrefix(t *testing.T) {
 
 	// set the expectations
 	tc.MdsMock.On("AcknowledgeMessage", mock.Anything, *tc.Message.MessageId).Return(nil)
-	tc.SendCommandTaskPoolMock.On("Submit", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("task.Job")).Return(nil)
+	tc.SendCommandTaskPoolMock.On("SubmitWithPriority", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("task.Job"), task.PriorityNormal).Return(nil)
 
 	// execute processMessage
 	proc.processMessage(&tc.Message)
@@ -263,7 +267,7 @@ func TestProcessMessageWithCancelCommandTopicPrefix(t *testing.T) {
 	tc.ContextMock.AssertCalled(t, "Log")
 	tc.MdsMock.AssertExpectations(t)
 	tc.CancelCommandTaskPoolMock.AssertExpectations(t)
-	tc.SendCommandTaskPoolMock.AssertNotCalled(t, "Submit")
+	tc.SendCommandTaskPoolMock.AssertNotCalled(t, "SubmitWithPriority")
 	assert.True(t, *tc.IsDocLevelResponseSent)
 	assert.True(t, *tc.IsDataPersisted)
 }
@@ -285,13 +289,130 @@ func TestProcessMessageWithInvalidCommandTopicPrefix(t *testing.T) {
 	// check expectations
 	tc.ContextMock.AssertCalled(t, "Log")
 	tc.MdsMock.AssertExpectations(t)
-	tc.SendCommandTaskPoolMock.AssertNotCalled(t, "Submit")
+	tc.SendCommandTaskPoolMock.AssertNotCalled(t, "SubmitWithPriority")
 	tc.CancelCommandTaskPoolMock.AssertNotCalled(t, "Submit")
 	assert.True(t, *tc.IsDocLevelResponseSent)
 	assert.True(t, *tc.IsDataPersisted)
 }
 
+// TestProcessMessageExpired tests that processMessage rejects a send command older than the maximum age
+func TestProcessMessageExpired(t *testing.T) {
+	// prepare processor and test case fields, the test message was created in 2015
+	proc, tc := prepareTestProcessMessage(testTopicSend)
+	proc.messageMaxAge = time.Hour
+
+	// set the expectations
+	tc.MdsMock.On("AcknowledgeMessage", mock.Anything, *tc.Message.MessageId).Return(nil)
+	tc.MdsMock.On("DeleteMessage", mock.Anything, *tc.Message.MessageId).Return(nil)
+
+	// execute processMessage
+	proc.processMessage(&tc.Message)
+
+	// check expectations
+	tc.MdsMock.AssertExpectations(t)
+	tc.SendCommandTaskPoolMock.AssertNotCalled(t, "SubmitWithPriority")
+	assert.True(t, *tc.IsDocLevelResponseSent)
+	assert.False(t, *tc.IsDataPersisted)
+}
+
+// TestMessageMaxAge tests that a maximum age of zero disables the check instead of keeping the clock skew tolerance
+func TestMessageMaxAge(t *testing.T) {
+	assert.Equal(t, time.Duration(0), messageMaxAge(appconfig.MdsCfg{MessageMaxAgeMinutes: 0, ClockSkewToleranceMinutes: 5}))
+	assert.Equal(t, 65*time.Minute, messageMaxAge(appconfig.MdsCfg{MessageMaxAgeMinutes: 60, ClockSkewToleranceMinutes: 5}))
+}
+
+// TestProcessSendReplyBlockedByDlp tests that the outputs of a reply blocked by the DLP scanner are withheld
+func TestProcessSendReplyBlockedByDlp(t *testing.T) {
+	scanReply = func(log log.T, payload []byte) error { return &dlp.BlockedError{Reason: "credit card number"} }
+	defer func() { scanReply = func(log.T, []byte) error { return nil } }()
+
+	payloadDoc := messageContracts.SendReplyPayload{
+		DocumentStatus: contracts.ResultStatusSuccess,
+		RuntimeStatus: map[string]*contracts.PluginRuntimeStatus{
+			"aws:runShellScript": {Status: contracts.ResultStatusSuccess, Output: "4111 1111 1111 1111"},
+		},
+	}
+
+	var sent messageContracts.SendReplyPayload
+	mdsMock := new(MockedMDS)
+	mdsMock.On("SendReply", mock.Anything, "m1", mock.AnythingOfType("string")).Return(nil).Run(func(args mock.Arguments) {
+		json.Unmarshal([]byte(args.Get(2).(string)), &sent)
+	})
+	processSendReply(log.NewMockLog(), "m1", mdsMock, payloadDoc, newStopPolicy())
+
+	mdsMock.AssertExpectations(t)
+	assert.Equal(t, contracts.ResultStatusSuccess, sent.RuntimeStatus["aws:runShellScript"].Status)
+	assert.Equal(t, "Output withheld: blocked by the DLP scanner: credit card number", sent.RuntimeStatus["aws:runShellScript"].Output)
+	assert.Equal(t, "4111 1111 1111 1111", payloadDoc.RuntimeStatus["aws:runShellScript"].Output)
+}
+
 // TestProcessMessageWithInvalidMessage tests processMessage with invalid message
+func TestSetCloudWatchLogs(t *testing.T) {
+	pluginConfigurations := map[string]*contracts.Configuration{"aws:runShellScript": {}}
+
+	setCloudWatchLogs(pluginConfigurations, nil, "cmd", "i-1")
+	assert.Equal(t, "", pluginConfigurations["aws:runShellScript"].CloudWatchLogGroupName)
+
+	setCloudWatchLogs(pluginConfigurations, &contracts.CloudWatchLogsOutput{LogGroupName: "ops"}, "cmd", "i-1")
+	assert.Equal(t, "ops", pluginConfigurations["aws:runShellScript"].CloudWatchLogGroupName)
+	assert.Equal(t, "cmd/i-1/aws:runShellScript", pluginConfigurations["aws:runShellScript"].CloudWatchLogStreamPrefix)
+
+	setCloudWatchLogs(pluginConfigurations, &contracts.CloudWatchLogsOutput{LogGroupName: "ops", LogStreamPrefix: "deploy/{InstanceId}"}, "cmd", "i-1")
+	assert.Equal(t, "deploy/i-1/aws:runShellScript", pluginConfigurations["aws:runShellScript"].CloudWatchLogStreamPrefix)
+}
+
+func TestCommandPriority(t *testing.T) {
+	logger := log.NewMockLog()
+	documentPriorities := map[string]string{"AWS-RunPatchBaseline": "background", "Security-Isolate": "critical"}
+
+	testCases := []struct {
+		Payload  string
+		Priority task.Priority
+	}{
+		{Payload: `{"DocumentName": "AWS-RunShellScript"}`, Priority: task.PriorityNormal},
+		{Payload: `{"DocumentName": "AWS-RunPatchBaseline"}`, Priority: task.PriorityBackground},
+		{Payload: `{"DocumentName": "AWS-RunPatchBaseline", "Priority": "Critical"}`, Priority: task.PriorityCritical},
+		{Payload: `{"DocumentName": "Security-Isolate", "Priority": "urgent"}`, Priority: task.PriorityCritical},
+		{Payload: `not json`, Priority: task.PriorityNormal},
+	}
+	assert.Equal(t, task.PriorityNormal, commandPriority(logger, nil, documentPriorities))
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.Priority, commandPriority(logger, &testCase.Payload, documentPriorities), testCase.Payload)
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	outputs := map[string]*contracts.PluginResult{
+		"ok":       {Status: contracts.ResultStatusSuccess},
+		"failed":   {Status: contracts.ResultStatusFailed},
+		"failed2":  {Status: contracts.ResultStatusFailed},
+		"missing":  {Status: contracts.ResultStatusFailed, Error: agenterror.New(agenterror.PluginNotFound, "no plugin")},
+		"timedOut": {Status: contracts.ResultStatusTimedOut},
+		"skipped":  nil,
+	}
+	assert.Equal(t, []string{"SSM-1002", "SSM-2001", "SSM-2002"}, errorCodes(outputs))
+	assert.Empty(t, errorCodes(map[string]*contracts.PluginResult{"ok": {Status: contracts.ResultStatusSuccess}}))
+}
+
+func TestOrderForIntake(t *testing.T) {
+	newMessage := func(id string, topic string, createdDate string, payload string) *ssmmds.Message {
+		return &ssmmds.Message{MessageId: aws.String(id), Topic: aws.String(topic), CreatedDate: aws.String(createdDate), Payload: aws.String(payload)}
+	}
+	messages := []*ssmmds.Message{
+		newMessage("runA", testTopicSend, "2015-01-01T00:00:02.000Z", `{"DocumentName":"AWS-RunShellScript"}`),
+		newMessage("update", testTopicSend, "2015-01-01T00:00:03.000Z", `{"DocumentContent":{"runtimeConfig":{"aws:updateSsmAgent":{}}}}`),
+		newMessage("cancelA", testTopicCancel, "2015-01-01T00:00:04.000Z", `{"CancelMessageId":"runA"}`),
+		newMessage("cancelRunning", testTopicCancel, "2015-01-01T00:00:05.000Z", `{"CancelMessageId":"running"}`),
+		newMessage("runB", testTopicSend, "2015-01-01T00:00:01.000Z", `{"DocumentName":"AWS-RunShellScript"}`),
+	}
+
+	var order []string
+	for _, msg := range orderForIntake(messages) {
+		order = append(order, *msg.MessageId)
+	}
+	assert.Equal(t, []string{"cancelRunning", "update", "runB", "runA", "cancelA"}, order)
+}
+
 func TestProcessMessageWithInvalidMessage(t *testing.T) {
 	// prepare processor and test case fields
 	proc, tc := prepareTestProcessMessage(testTopicSend)
@@ -304,13 +425,16 @@ func TestProcessMessageWithInvalidMessage(t *testing.T) {
 		Topic:       &testEmptyMessage,
 	}
 
-	// execute processMessage
+	// execute processMessage, the rejected message leaves the backlog
+	depth := backlog.Depth()
+	backlog.Add(1)
 	proc.processMessage(&tc.Message)
+	assert.Equal(t, depth, backlog.Depth())
 
 	// check expectations
 	tc.ContextMock.AssertCalled(t, "Log")
 	tc.MdsMock.AssertNotCalled(t, "AcknowledgeMessage", mock.AnythingOfType("log.T"))
-	tc.SendCommandTaskPoolMock.AssertNotCalled(t, "Submit")
+	tc.SendCommandTaskPoolMock.AssertNotCalled(t, "SubmitWithPriority")
 	tc.CancelCommandTaskPoolMock.AssertNotCalled(t, "Submit")
 	assert.False(t, *tc.IsDocLevelResponseSent)
 	assert.False(t, *tc.IsDataPersisted)
@@ -24,6 +24,7 @@ import (
 	"github.com/aws/amazon-ssm-agent/agent/contracts"
 	"github.com/aws/amazon-ssm-agent/agent/fileutil"
 	messageContracts "github.com/aws/amazon-ssm-agent/agent/message/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/metrics"
 	"github.com/aws/amazon-ssm-agent/agent/times"
 	"github.com/aws/aws-sdk-go/service/ssmmds"
 )
@@ -90,7 +91,63 @@ func getPluginConfigurations(runtimeConfig map[string]*contracts.PluginConfig, o
 			OrchestrationDirectory: filepath.Join(orchestrationDir, fileutil.RemoveInvalidChars(pluginName)),
 			MessageId:              messageID,
 			BookKeepingFileName:    getCommandID(messageID),
+			MaxAttempts:            pluginConfig.MaxAttempts,
+			RetryBackoffSeconds:    pluginConfig.RetryBackoffSeconds,
+			OnSuccess:              pluginConfig.OnSuccess,
+			OnFailure:              pluginConfig.OnFailure,
+			RunAt:                  pluginConfig.RunAt,
+			DelaySeconds:           pluginConfig.DelaySeconds,
+			CaptureState:           pluginConfig.CaptureState,
 		}
 	}
 	return
 }
+
+// setDryRun marks every plugin configuration to be executed in dry-run mode
+func setDryRun(pluginConfigurations map[string]*contracts.Configuration) {
+	for _, pluginConfig := range pluginConfigurations {
+		pluginConfig.DryRun = true
+	}
+}
+
+// setCloudWatchLogs sets the log group and the stream prefix the plugins stream their output to, as requested
+// by the document. The streams of a plugin are named after the prefix, which defaults to {CommandId}/{InstanceId},
+// and the name of the plugin.
+func setCloudWatchLogs(pluginConfigurations map[string]*contracts.Configuration, output *contracts.CloudWatchLogsOutput, commandID string, instanceID string) {
+	if output == nil || output.LogGroupName == "" {
+		return
+	}
+	prefix := output.LogStreamPrefix
+	if prefix == "" {
+		prefix = defaultLogStreamPrefix
+	}
+	prefix = strings.NewReplacer("{CommandId}", commandID, "{InstanceId}", instanceID).Replace(prefix)
+	for pluginName, pluginConfig := range pluginConfigurations {
+		pluginConfig.CloudWatchLogGroupName = output.LogGroupName
+		pluginConfig.CloudWatchLogStreamPrefix = path.Join(prefix, pluginName)
+	}
+}
+
+// skippedPluginResults returns a successful result for every plugin, explaining that the plugins
+// were skipped because the preconditions of the document are not met on this instance.
+func skippedPluginResults(pluginConfigurations map[string]*contracts.Configuration, reason string) (outputs map[string]*contracts.PluginResult) {
+	outputs = make(map[string]*contracts.PluginResult)
+	now := times.DefaultClock.Now()
+	for pluginName, pluginConfig := range pluginConfigurations {
+		outputs[pluginName] = &contracts.PluginResult{
+			Status:             contracts.ResultStatusSuccess,
+			Output:             "Step skipped: " + reason,
+			StartDateTime:      now,
+			EndDateTime:        now,
+			OutputS3BucketName: pluginConfig.OutputS3BucketName,
+			OutputS3KeyPrefix:  pluginConfig.OutputS3KeyPrefix,
+		}
+	}
+	return
+}
+
+// recordMessageProcessed counts a processed message in the metrics of the agent, by topic and final status.
+func recordMessageProcessed(topic TopicPrefix, status contracts.ResultStatus) {
+	topicName := strings.Trim(strings.TrimPrefix(string(topic), "aws.ssm."), ".")
+	metrics.MessagesProcessed.Inc(topicName, string(status))
+}
@@ -23,11 +23,12 @@ import (
 	"time"
 
 	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/proxy"
 	"github.com/aws/amazon-ssm-agent/agent/sdkutil"
+	"github.com/aws/amazon-ssm-agent/agent/sdkutil/attribution"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/request"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ssmmds"
 	"github.com/twinj/uuid"
 )
@@ -85,16 +86,16 @@ func NewService(region string, endpoint string, creds *credentials.Credentials,
 
 	// capture Transport so we can use it to cancel requests
 	tr := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
 		Dial: (&net.Dialer{
 			Timeout:   connectionTimeout,
 			KeepAlive: 0,
 		}).Dial,
 		TLSHandshakeTimeout: 10 * time.Second,
 	}
+	proxy.ConfigureTransport(tr)
 	config.HTTPClient = &http.Client{Transport: tr, Timeout: connectionTimeout}
 
-	msgSvc := ssmmds.New(session.New(config))
+	msgSvc := ssmmds.New(attribution.NewSession(config))
 
 	//adding server based expected error messages
 	serverBasedErrorMessages = make([]string, 2)
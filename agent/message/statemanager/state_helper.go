@@ -15,12 +15,9 @@
 package bookkeeping
 
 import (
-	"os"
-	"path"
 	"sync"
 
 	"github.com/aws/amazon-ssm-agent/agent/appconfig"
-	"github.com/aws/amazon-ssm-agent/agent/fileutil"
 	"github.com/aws/amazon-ssm-agent/agent/jsonutil"
 	"github.com/aws/amazon-ssm-agent/agent/log"
 	message "github.com/aws/amazon-ssm-agent/agent/message/contracts"
@@ -31,55 +28,66 @@ import (
 var lock sync.RWMutex
 var docLock = make(map[string]*sync.RWMutex)
 
-// GetCommandInterimState returns CommandState object after reading file <commandID> from locationFolder
-// under defaultLogDir/instanceID
+// GetCommandInterimState returns CommandState object after reading the state of <commandID> from locationFolder
+// in the store of instanceID
 func GetCommandInterimState(log log.T, commandID, instanceID, locationFolder string) message.CommandState {
 
 	rLockDocument(commandID)
 	defer rUnlockDocument(commandID)
 
-	absoluteFileName := getCmdStateFileName(commandID, instanceID, locationFolder)
-
-	commandState := getCmdState(log, absoluteFileName)
+	commandState := getCmdState(log, commandID, instanceID, locationFolder)
 
 	return commandState
 }
 
-// PersistData stores the given object in the file-system in pretty Json indented format
-// This will override the contents of an already existing file
+// GetData reads the state of <commandID> from locationFolder in the store of instanceID into object
+func GetData(log log.T, commandID, instanceID, locationFolder string, object interface{}) (err error) {
+
+	rLockDocument(commandID)
+	defer rUnlockDocument(commandID)
+
+	if err = getState(instanceID, locationFolder, commandID, object); err != nil {
+		log.Errorf("encountered error with message %v while reading the state of command %v from %v", err, commandID, locationFolder)
+	}
+	return
+}
+
+// PersistData stores the given object in the store in Json format
+// This will atomically replace an already existing state
 func PersistData(log log.T, commandID, instanceID, locationFolder string, object interface{}) {
 
 	lockDocument(commandID)
 	defer unlockDocument(commandID)
 
-	absoluteFileName := getCmdStateFileName(commandID, instanceID, locationFolder)
+	if err := putState(instanceID, locationFolder, commandID, object); err == nil {
+		log.Debugf("successfully persisted interim state in %v", locationFolder)
+	} else {
+		log.Debugf("persisting interim state in %v failed with error %v", locationFolder, err)
+	}
+}
 
-	content, err := jsonutil.Marshal(object)
-	if err != nil {
-		log.Errorf("encountered error with message %v while marshalling %v to string", err, object)
+// MoveData stores the given object in dstLocationFolder and removes the state of commandID from srcLocationFolder
+// in one transaction, so that the command is never in both locations after a crash
+func MoveData(log log.T, commandID, instanceID, srcLocationFolder, dstLocationFolder string, object interface{}) {
+
+	lockDocument(commandID)
+	defer unlockDocument(commandID)
+
+	if err := replaceState(instanceID, srcLocationFolder, dstLocationFolder, commandID, object); err == nil {
+		log.Debugf("successfully moved interim state from %v to %v", srcLocationFolder, dstLocationFolder)
 	} else {
-		if fileutil.Exists(absoluteFileName) {
-			log.Debugf("overwriting contents of %v", absoluteFileName)
-		}
-		log.Tracef("persisting interim state %v in file %v", jsonutil.Indent(content), absoluteFileName)
-		if s, err := fileutil.WriteIntoFileWithPermissions(absoluteFileName, jsonutil.Indent(content), os.FileMode(int(appconfig.ReadWriteAccess))); s && err == nil {
-			log.Debugf("successfully persisted interim state in %v", locationFolder)
-		} else {
-			log.Debugf("persisting interim state in %v failed with error %v", locationFolder, err)
-		}
+		log.Errorf("moving interim state from %v to %v failed with error %v", srcLocationFolder, dstLocationFolder, err)
 	}
 }
 
-// RemoveData deletes the fileName from locationFolder under defaultLogDir/instanceID
+// RemoveData deletes the state of commandID from locationFolder in the store of instanceID
 func RemoveData(log log.T, commandID, instanceID, locationFolder string) {
 
-	absoluteFileName := getCmdStateFileName(commandID, instanceID, locationFolder)
-
-	err := fileutil.DeleteFile(absoluteFileName)
+	err := deleteState(instanceID, locationFolder, commandID)
 	if err != nil {
-		log.Errorf("encountered error %v while deleting file %v", err, absoluteFileName)
+		log.Errorf("encountered error %v while deleting the state of command %v from %v", err, commandID, locationFolder)
 	} else {
-		log.Debugf("successfully deleted file %v", absoluteFileName)
+		log.Debugf("successfully deleted the state of command %v from %v", commandID, locationFolder)
 	}
 }
 
@@ -89,22 +97,10 @@ func MoveCommandState(log log.T, commandID, instanceID, srcLocationFolder, dstLo
 	//get a lock for documentID specific lock
 	lockDocument(commandID)
 
-	absoluteSource := path.Join(appconfig.DefaultDataStorePath,
-		instanceID,
-		appconfig.DefaultCommandRootDirName,
-		appconfig.DefaultLocationOfState,
-		srcLocationFolder)
-
-	absoluteDestination := path.Join(appconfig.DefaultDataStorePath,
-		instanceID,
-		appconfig.DefaultCommandRootDirName,
-		appconfig.DefaultLocationOfState,
-		dstLocationFolder)
-
-	if s, err := fileutil.MoveFile(commandID, absoluteSource, absoluteDestination); s && err == nil {
-		log.Debugf("moved file %v from %v to %v successfully", commandID, srcLocationFolder, dstLocationFolder)
+	if err := moveState(instanceID, srcLocationFolder, dstLocationFolder, commandID); err == nil {
+		log.Debugf("moved state of command %v from %v to %v successfully", commandID, srcLocationFolder, dstLocationFolder)
 	} else {
-		log.Debugf("moving file %v from %v to %v failed with error %v", commandID, srcLocationFolder, dstLocationFolder, err)
+		log.Debugf("moving state of command %v from %v to %v failed with error %v", commandID, srcLocationFolder, dstLocationFolder, err)
 	}
 
 	//release documentID specific lock - before deleting the entry from the map
@@ -123,111 +119,82 @@ func GetDocumentInfo(log log.T, commandID, instanceID, locationFolder string) me
 	rLockDocument(commandID)
 	defer rUnlockDocument(commandID)
 
-	absoluteFileName := getCmdStateFileName(commandID, instanceID, locationFolder)
-
-	commandState := getCmdState(log, absoluteFileName)
+	commandState := getCmdState(log, commandID, instanceID, locationFolder)
 
 	return commandState.DocumentInformation
 }
 
-// PersistDocumentInfo stores the given PluginState in file-system in pretty Json indented format
-// This will override the contents of an already existing file
+// PersistDocumentInfo stores the given DocumentInfo in the state of the command
+// This will override the document info of an already existing state
 func PersistDocumentInfo(log log.T, docInfo message.DocumentInfo, commandID, instanceID, locationFolder string) {
 
-	absoluteFileName := getCmdStateFileName(commandID, instanceID, locationFolder)
-
 	//get documentID specific write lock
 	lockDocument(commandID)
 	defer unlockDocument(commandID)
 
 	//Plugins should safely assume that there already
-	//exists a persisted interim state file - if not then it should throw error
-
-	//read command state from file-system first
-	commandState := getCmdState(log, absoluteFileName)
-
-	commandState.DocumentInformation = docInfo
-
-	setCmdState(log, commandState, absoluteFileName, locationFolder)
+	//exists a persisted interim state - the state is read and written in one transaction
+	var commandState message.CommandState
+	err := updateState(instanceID, locationFolder, commandID, &commandState, func() {
+		commandState.DocumentInformation = docInfo
+	})
+	if err != nil {
+		log.Errorf("persisting document info in %v failed with error %v", locationFolder, err)
+	}
 }
 
-// GetPluginState returns PluginState after reading fileName from given locationFolder under defaultLogDir/instanceID
+// GetPluginState returns PluginState after reading the state of commandID from given locationFolder
 func GetPluginState(log log.T, pluginID, commandID, instanceID, locationFolder string) message.PluginState {
 
 	rLockDocument(commandID)
 	defer rUnlockDocument(commandID)
 
-	absoluteFileName := getCmdStateFileName(commandID, instanceID, locationFolder)
-
-	commandState := getCmdState(log, absoluteFileName)
+	commandState := getCmdState(log, commandID, instanceID, locationFolder)
 
 	return commandState.PluginsInformation[pluginID]
 }
 
-// PersistPluginState stores the given PluginState in file-system in pretty Json indented format
-// This will override the contents of an already existing file
+// PersistPluginState stores the given PluginState in the state of the command
+// This will override the state of the plugin in an already existing state
 func PersistPluginState(log log.T, pluginState message.PluginState, pluginID, commandID, instanceID, locationFolder string) {
 
 	lockDocument(commandID)
 	defer unlockDocument(commandID)
 
-	absoluteFileName := getCmdStateFileName(commandID, instanceID, locationFolder)
-
 	//Plugins should safely assume that there already
-	//exists a persisted interim state file - if not then it should throw error
-	commandState := getCmdState(log, absoluteFileName)
-
-	//TODO:  after adding unit-tests for persist data - this can be removed
-	if commandState.PluginsInformation == nil {
-		pluginsInfo := make(map[string]message.PluginState)
-		pluginsInfo[pluginID] = pluginState
-		commandState.PluginsInformation = pluginsInfo
-	} else {
+	//exists a persisted interim state - the state is read and written in one transaction
+	var commandState message.CommandState
+	err := updateState(instanceID, locationFolder, commandID, &commandState, func() {
+		if commandState.PluginsInformation == nil {
+			commandState.PluginsInformation = make(map[string]message.PluginState)
+		}
 		commandState.PluginsInformation[pluginID] = pluginState
+	})
+	if err != nil {
+		log.Errorf("persisting plugin state in %v failed with error %v", locationFolder, err)
 	}
-
-	setCmdState(log, commandState, absoluteFileName, locationFolder)
 }
 
-// getCmdState reads commandState from given file
-func getCmdState(log log.T, fileName string) message.CommandState {
+// getCmdState reads commandState of the command from the given location
+func getCmdState(log log.T, commandID, instanceID, locationFolder string) message.CommandState {
 
 	var commandState message.CommandState
-	err := jsonutil.UnmarshalFile(fileName, &commandState)
+	err := getState(instanceID, locationFolder, commandID, &commandState)
 	if err != nil {
-		log.Errorf("encountered error with message %v while reading Interim state of command from file - %v", err, fileName)
+		log.Errorf("encountered error with message %v while reading Interim state of command %v from %v", err, commandID, locationFolder)
 	} else {
-		//logging interim state as read from the file
+		//logging interim state as read from the store
 		jsonString, err := jsonutil.Marshal(commandState)
 		if err != nil {
 			log.Errorf("encountered error with message %v while marshalling %v to string", err, commandState)
 		} else {
-			log.Tracef("interim CommandState read from file-system - %v", jsonutil.Indent(jsonString))
+			log.Tracef("interim CommandState read from the store - %v", jsonutil.Indent(jsonString))
 		}
 	}
 
 	return commandState
 }
 
-// setCmdState persists given commandState
-func setCmdState(log log.T, commandState message.CommandState, absoluteFileName, locationFolder string) {
-
-	content, err := jsonutil.Marshal(commandState)
-	if err != nil {
-		log.Errorf("encountered error with message %v while marshalling %v to string", err, commandState)
-	} else {
-		if fileutil.Exists(absoluteFileName) {
-			log.Debugf("overwriting contents of %v", absoluteFileName)
-		}
-		log.Tracef("persisting interim state %v in file %v", jsonutil.Indent(content), absoluteFileName)
-		if s, err := fileutil.WriteIntoFileWithPermissions(absoluteFileName, jsonutil.Indent(content), os.FileMode(int(appconfig.ReadWriteAccess))); s && err == nil {
-			log.Debugf("successfully persisted interim state in %v", locationFolder)
-		} else {
-			log.Debugf("persisting interim state in %v failed with error %v", locationFolder, err)
-		}
-	}
-}
-
 // rLockDocument locks id specific RWMutex for reading
 func rLockDocument(id string) {
 	//check if document lock even exists
@@ -279,13 +246,3 @@ func deleteLock(id string) {
 	defer lock.Unlock()
 	delete(docLock, id)
 }
-
-//getCmdStateFileName returns absolute filename where command states are persisted
-func getCmdStateFileName(commandID, instanceID, locationFolder string) string {
-	return path.Join(appconfig.DefaultDataStorePath,
-		instanceID,
-		appconfig.DefaultCommandRootDirName,
-		appconfig.DefaultLocationOfState,
-		locationFolder,
-		commandID)
-}
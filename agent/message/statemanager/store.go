@@ -0,0 +1,392 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package bookkeeping helps persist documents state to disk
+// store contains the transactional store holding the states of the commands of an instance.
+package bookkeeping
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// StoreFileName is the name of the store of the states of the commands, in the state directory of the instance.
+	// The store has a bucket per location (pending, current, completed, corrupt) keyed by command id.
+	StoreFileName = "state.db"
+
+	// storeOpenTimeout bounds the wait for the lock of a store held by another process.
+	storeOpenTimeout = 10 * time.Second
+
+	// compactionMinSize is the size under which a store is never compacted.
+	compactionMinSize = 1 << 20
+
+	// compactionFreeRatio is the share of free pages in the store above which it is compacted when opened.
+	compactionFreeRatio = 0.5
+
+	// legacyTempFileMarker is part of the name of the temporary files written next to the legacy state files.
+	legacyTempFileMarker = ".tmp"
+)
+
+// locations are the buckets of the store, they were the folders of the state files before the store.
+var locations = []string{
+	appconfig.DefaultLocationOfPending,
+	appconfig.DefaultLocationOfCurrent,
+	appconfig.DefaultLocationOfCompleted,
+	appconfig.DefaultLocationOfCorrupt,
+}
+
+var (
+	storesLock    sync.Mutex
+	stores        = make(map[string]*bolt.DB)
+	dataStorePath = appconfig.DataStorePath
+)
+
+// errStateNotFound is returned when a command has no state in a location.
+type errStateNotFound struct {
+	commandID string
+	location  string
+}
+
+func (e errStateNotFound) Error() string {
+	return fmt.Sprintf("no state for command %v in %v", e.commandID, e.location)
+}
+
+// Initialize prepares the store of the states of the commands of the instance: it compacts the store when most
+// of it is free, then imports the state files written by the previous versions of the agent.
+func Initialize(log log.T, instanceID string) (err error) {
+	stateDir := getStateDir(instanceID)
+	if err = fileutil.MakeDirs(stateDir); err != nil {
+		return fmt.Errorf("unable to create the state directory %v: %v", stateDir, err)
+	}
+
+	storesLock.Lock()
+	_, opened := stores[getStorePath(instanceID)]
+	storesLock.Unlock()
+	if !opened {
+		if err = compactStore(log, getStorePath(instanceID)); err != nil {
+			log.Warnf("unable to compact the store of the states of the commands: %v", err)
+		}
+	}
+
+	db, err := openStore(instanceID)
+	if err != nil {
+		return
+	}
+	return importLegacyFiles(log, db, stateDir)
+}
+
+// ListCommands returns the ids of the commands having a state in the location.
+func ListCommands(log log.T, instanceID, locationFolder string) (commandIDs []string) {
+	db, err := openStore(instanceID)
+	if err != nil {
+		log.Errorf("unable to list the commands in %v: %v", locationFolder, err)
+		return
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(locationFolder))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(key, value []byte) error {
+			commandIDs = append(commandIDs, string(key))
+			return nil
+		})
+	})
+	if err != nil {
+		log.Errorf("unable to list the commands in %v: %v", locationFolder, err)
+	}
+	return
+}
+
+// openStore returns the store of the instance, opened once per process. The state directory is created
+// by Initialize, the store is not created anywhere else.
+func openStore(instanceID string) (db *bolt.DB, err error) {
+	storesLock.Lock()
+	defer storesLock.Unlock()
+
+	storePath := getStorePath(instanceID)
+	if db, ok := stores[storePath]; ok {
+		return db, nil
+	}
+	if !fileutil.Exists(filepath.Dir(storePath)) {
+		return nil, fmt.Errorf("state directory %v is not initialized", filepath.Dir(storePath))
+	}
+	if db, err = bolt.Open(storePath, appconfig.ReadWriteAccess, &bolt.Options{Timeout: storeOpenTimeout}); err != nil {
+		return nil, fmt.Errorf("unable to open the store of the states of the commands %v: %v", storePath, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, location := range locations {
+			if _, err := tx.CreateBucketIfNotExists([]byte(location)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	stores[storePath] = db
+	return db, nil
+}
+
+// closeStores closes the stores opened by the process.
+func closeStores() {
+	storesLock.Lock()
+	defer storesLock.Unlock()
+	for storePath, db := range stores {
+		db.Close()
+		delete(stores, storePath)
+	}
+}
+
+// getState reads the state of the command in the location into object.
+func getState(instanceID, locationFolder, commandID string, object interface{}) error {
+	db, err := openStore(instanceID)
+	if err != nil {
+		return err
+	}
+	return db.View(func(tx *bolt.Tx) error {
+		content := tx.Bucket([]byte(locationFolder)).Get([]byte(commandID))
+		if content == nil {
+			return errStateNotFound{commandID: commandID, location: locationFolder}
+		}
+		return json.Unmarshal(content, object)
+	})
+}
+
+// putState writes the state of the command in the location, replacing the previous state.
+func putState(instanceID, locationFolder, commandID string, object interface{}) error {
+	content, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	db, err := openStore(instanceID)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(locationFolder)).Put([]byte(commandID), content)
+	})
+}
+
+// updateState reads the state of the command in the location into object, calls update, and writes the object back,
+// all in one transaction. A command without state starts from the zero value of object.
+func updateState(instanceID, locationFolder, commandID string, object interface{}, update func()) error {
+	db, err := openStore(instanceID)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(locationFolder))
+		if content := bucket.Get([]byte(commandID)); content != nil {
+			if err := json.Unmarshal(content, object); err != nil {
+				return err
+			}
+		}
+		update()
+		content, err := json.Marshal(object)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(commandID), content)
+	})
+}
+
+// deleteState removes the state of the command from the location.
+func deleteState(instanceID, locationFolder, commandID string) error {
+	db, err := openStore(instanceID)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(locationFolder)).Delete([]byte(commandID))
+	})
+}
+
+// moveState moves the state of the command from one location to another in one transaction,
+// the command is never in both locations, nor in none.
+func moveState(instanceID, srcLocationFolder, dstLocationFolder, commandID string) error {
+	db, err := openStore(instanceID)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		src := tx.Bucket([]byte(srcLocationFolder))
+		content := src.Get([]byte(commandID))
+		if content == nil {
+			return errStateNotFound{commandID: commandID, location: srcLocationFolder}
+		}
+		if err := tx.Bucket([]byte(dstLocationFolder)).Put([]byte(commandID), append([]byte(nil), content...)); err != nil {
+			return err
+		}
+		return src.Delete([]byte(commandID))
+	})
+}
+
+// replaceState writes the state of the command in the destination location and removes it from the source
+// location in one transaction.
+func replaceState(instanceID, srcLocationFolder, dstLocationFolder, commandID string, object interface{}) error {
+	content, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	db, err := openStore(instanceID)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket([]byte(dstLocationFolder)).Put([]byte(commandID), content); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(srcLocationFolder)).Delete([]byte(commandID))
+	})
+}
+
+// compactStore rewrites the store into a new file when most of its pages are free, bolt never shrinks its file.
+// The new file replaces the store once complete, a crash leaves the store as it was.
+func compactStore(log log.T, storePath string) (err error) {
+	info, err := os.Stat(storePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if info.Size() < compactionMinSize {
+		return nil
+	}
+
+	src, err := bolt.Open(storePath, appconfig.ReadWriteAccess, &bolt.Options{Timeout: storeOpenTimeout})
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	free := int64(src.Stats().FreePageN) * int64(src.Info().PageSize)
+	if float64(free) < float64(info.Size())*compactionFreeRatio {
+		return nil
+	}
+
+	compactPath := storePath + ".compact"
+	os.Remove(compactPath)
+	dst, err := bolt.Open(compactPath, appconfig.ReadWriteAccess, &bolt.Options{Timeout: storeOpenTimeout})
+	if err != nil {
+		return err
+	}
+	err = src.View(func(srcTx *bolt.Tx) error {
+		return dst.Update(func(dstTx *bolt.Tx) error {
+			return srcTx.ForEach(func(name []byte, srcBucket *bolt.Bucket) error {
+				dstBucket, err := dstTx.CreateBucketIfNotExists(name)
+				if err != nil {
+					return err
+				}
+				return srcBucket.ForEach(func(key, value []byte) error {
+					return dstBucket.Put(key, value)
+				})
+			})
+		})
+	})
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(compactPath)
+		return err
+	}
+
+	src.Close()
+	if err = os.Rename(compactPath, storePath); err != nil {
+		os.Remove(compactPath)
+		return err
+	}
+	log.Infof("compacted the store of the states of the commands %v from %v bytes", storePath, info.Size())
+	return nil
+}
+
+// importLegacyFiles moves the state files of the previous versions of the agent into the store.
+// The temporary files left by a crash in the middle of a write are deleted, they are never states of commands.
+// Files which are not json are kept in the corrupt location of the store.
+func importLegacyFiles(log log.T, db *bolt.DB, stateDir string) error {
+	for _, location := range locations {
+		folder := path.Join(stateDir, location)
+		files, err := ioutil.ReadDir(folder)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("unable to read the state files in %v: %v", folder, err)
+		}
+
+		for _, f := range files {
+			file := path.Join(folder, f.Name())
+			if f.IsDir() {
+				continue
+			}
+			if strings.Contains(f.Name(), legacyTempFileMarker) {
+				log.Infof("deleting the temporary state file %v", file)
+				if err = os.Remove(file); err != nil {
+					log.Warnf("unable to delete the temporary state file %v: %v", file, err)
+				}
+				continue
+			}
+
+			content, err := ioutil.ReadFile(file)
+			if err != nil {
+				log.Errorf("unable to read the state file %v: %v", file, err)
+				continue
+			}
+			bucket := location
+			if !json.Valid(content) {
+				log.Errorf("state file %v is not valid json, keeping it as corrupt", file)
+				bucket = appconfig.DefaultLocationOfCorrupt
+			}
+			err = db.Update(func(tx *bolt.Tx) error {
+				return tx.Bucket([]byte(bucket)).Put([]byte(f.Name()), content)
+			})
+			if err != nil {
+				return fmt.Errorf("unable to import the state file %v: %v", file, err)
+			}
+			log.Debugf("imported the state file %v into the store", file)
+			if err = os.Remove(file); err != nil {
+				log.Warnf("unable to delete the imported state file %v: %v", file, err)
+			}
+		}
+		os.Remove(folder)
+	}
+	return nil
+}
+
+// getStateDir returns the directory of the state of the commands of the instance.
+func getStateDir(instanceID string) string {
+	return path.Join(dataStorePath(),
+		instanceID,
+		appconfig.DefaultCommandRootDirName,
+		appconfig.DefaultLocationOfState)
+}
+
+// getStorePath returns the path of the store of the states of the commands of the instance.
+func getStorePath(instanceID string) string {
+	return path.Join(getStateDir(instanceID), StoreFileName)
+}
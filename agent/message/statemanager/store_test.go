@@ -0,0 +1,149 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package bookkeeping
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	message "github.com/aws/amazon-ssm-agent/agent/message/contracts"
+	"github.com/stretchr/testify/assert"
+)
+
+const testInstanceID = "i-1234567890"
+
+var logger = log.NewMockLog()
+
+// useTempDataStore points the store to a temporary data store, the returned function restores it.
+func useTempDataStore(t *testing.T) (root string, restore func()) {
+	root, err := ioutil.TempDir("", "statemanager")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataStorePath = func() string { return root }
+	return root, func() {
+		closeStores()
+		dataStorePath = appconfig.DataStorePath
+		os.RemoveAll(root)
+	}
+}
+
+func TestStateIsNotCreatedBeforeInitialize(t *testing.T) {
+	root, restore := useTempDataStore(t)
+	defer restore()
+
+	PersistData(logger, "cmd", testInstanceID, appconfig.DefaultLocationOfCurrent, message.CommandState{})
+	assert.Empty(t, ListCommands(logger, testInstanceID, appconfig.DefaultLocationOfCurrent))
+	_, err := os.Stat(filepath.Join(root, testInstanceID))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCommandLifecycle(t *testing.T) {
+	_, restore := useTempDataStore(t)
+	defer restore()
+	assert.Nil(t, Initialize(logger, testInstanceID))
+
+	msg := map[string]string{"MessageId": "aws.ssm.cmd.i-1234567890"}
+	PersistData(logger, "cmd", testInstanceID, appconfig.DefaultLocationOfPending, msg)
+	assert.Equal(t, []string{"cmd"}, ListCommands(logger, testInstanceID, appconfig.DefaultLocationOfPending))
+
+	// the command leaves pending and enters current in one transaction
+	state := message.CommandState{DocumentInformation: message.DocumentInfo{CommandID: "cmd"}}
+	MoveData(logger, "cmd", testInstanceID, appconfig.DefaultLocationOfPending, appconfig.DefaultLocationOfCurrent, state)
+	assert.Empty(t, ListCommands(logger, testInstanceID, appconfig.DefaultLocationOfPending))
+	assert.Equal(t, []string{"cmd"}, ListCommands(logger, testInstanceID, appconfig.DefaultLocationOfCurrent))
+
+	PersistPluginState(logger, message.PluginState{HasExecuted: true}, "aws:runShellScript", "cmd", testInstanceID, appconfig.DefaultLocationOfCurrent)
+	PersistDocumentInfo(logger, message.DocumentInfo{CommandID: "cmd", RunCount: 1}, "cmd", testInstanceID, appconfig.DefaultLocationOfCurrent)
+	state = GetCommandInterimState(logger, "cmd", testInstanceID, appconfig.DefaultLocationOfCurrent)
+	assert.Equal(t, 1, state.DocumentInformation.RunCount)
+	assert.True(t, state.PluginsInformation["aws:runShellScript"].HasExecuted)
+
+	MoveCommandState(logger, "cmd", testInstanceID, appconfig.DefaultLocationOfCurrent, appconfig.DefaultLocationOfCompleted)
+	assert.Empty(t, ListCommands(logger, testInstanceID, appconfig.DefaultLocationOfCurrent))
+	assert.Equal(t, []string{"cmd"}, ListCommands(logger, testInstanceID, appconfig.DefaultLocationOfCompleted))
+}
+
+// TestRestartAfterCrashDuringLegacyWrite checks a command left by a crash of a previous agent between the write of
+// its temporary state file and the rename is imported once, and that the temporary files are deleted.
+func TestRestartAfterCrashDuringLegacyWrite(t *testing.T) {
+	root, restore := useTempDataStore(t)
+	defer restore()
+
+	pending := filepath.Join(root, testInstanceID, appconfig.DefaultCommandRootDirName, appconfig.DefaultLocationOfState, appconfig.DefaultLocationOfPending)
+	current := filepath.Join(root, testInstanceID, appconfig.DefaultCommandRootDirName, appconfig.DefaultLocationOfState, appconfig.DefaultLocationOfCurrent)
+	assert.Nil(t, os.MkdirAll(pending, 0700))
+	assert.Nil(t, os.MkdirAll(current, 0700))
+	pendingMessage := `{"MessageId": "aws.ssm.cmd.i-1234567890"}`
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(pending, "cmd"), []byte(pendingMessage), 0600))
+	// complete and partial temporary files of the same command, and a truncated state
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(pending, "cmd.tmp123"), []byte(pendingMessage), 0600))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(current, "cmd2.tmp456"), []byte(`{"DocumentInformation": {`), 0600))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(current, "cmd3"), []byte(`{"DocumentInformation": {`), 0600))
+
+	assert.Nil(t, Initialize(logger, testInstanceID))
+	assert.Equal(t, []string{"cmd"}, ListCommands(logger, testInstanceID, appconfig.DefaultLocationOfPending))
+	assert.Empty(t, ListCommands(logger, testInstanceID, appconfig.DefaultLocationOfCurrent))
+	assert.Equal(t, []string{"cmd3"}, ListCommands(logger, testInstanceID, appconfig.DefaultLocationOfCorrupt))
+
+	var msg map[string]string
+	assert.Nil(t, GetData(logger, "cmd", testInstanceID, appconfig.DefaultLocationOfPending, &msg))
+	assert.Equal(t, "aws.ssm.cmd.i-1234567890", msg["MessageId"])
+
+	// the legacy folders are gone, a restart finds the same commands
+	_, err := os.Stat(pending)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(current)
+	assert.True(t, os.IsNotExist(err))
+	closeStores()
+	assert.Nil(t, Initialize(logger, testInstanceID))
+	assert.Equal(t, []string{"cmd"}, ListCommands(logger, testInstanceID, appconfig.DefaultLocationOfPending))
+}
+
+func TestCompactStore(t *testing.T) {
+	_, restore := useTempDataStore(t)
+	defer restore()
+	assert.Nil(t, Initialize(logger, testInstanceID))
+
+	payload := strings.Repeat("x", 8*1024)
+	for i := 0; i < 300; i++ {
+		PersistData(logger, fmt.Sprintf("cmd%03d", i), testInstanceID, appconfig.DefaultLocationOfCompleted, payload)
+	}
+	commandIDs := ListCommands(logger, testInstanceID, appconfig.DefaultLocationOfCompleted)
+	for _, commandID := range commandIDs[1:] {
+		RemoveData(logger, commandID, testInstanceID, appconfig.DefaultLocationOfCompleted)
+	}
+	closeStores()
+
+	storePath := getStorePath(testInstanceID)
+	before, err := os.Stat(storePath)
+	assert.Nil(t, err)
+	assert.True(t, before.Size() >= compactionMinSize)
+
+	assert.Nil(t, Initialize(logger, testInstanceID))
+	after, err := os.Stat(storePath)
+	assert.Nil(t, err)
+	assert.True(t, after.Size() < before.Size()/2, "store of %v bytes compacted to %v bytes", before.Size(), after.Size())
+	assert.Equal(t, commandIDs[:1], ListCommands(logger, testInstanceID, appconfig.DefaultLocationOfCompleted))
+
+	var content string
+	assert.Nil(t, GetData(logger, commandIDs[0], testInstanceID, appconfig.DefaultLocationOfCompleted, &content))
+	assert.Equal(t, payload, content)
+}
@@ -0,0 +1,66 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package metrics keeps counters of the activity of the agent and exposes them in the Prometheus text format.
+// agent defines the metrics of the agent, which the other packages update.
+package metrics
+
+import (
+	"github.com/aws/amazon-ssm-agent/agent/agenterror"
+	"github.com/aws/amazon-ssm-agent/agent/backlog"
+	"github.com/aws/amazon-ssm-agent/agent/version"
+)
+
+// namespace prefixes the names of the metrics of the agent.
+const namespace = "ssm_agent_"
+
+// pluginDurationBuckets are the upper bounds, in seconds, of the buckets of the durations of the steps.
+var pluginDurationBuckets = []float64{0.1, 0.5, 1, 5, 15, 60, 300, 900, 3600, 14400}
+
+var (
+	// MessagesProcessed counts the messages received from the service, by topic and final status.
+	MessagesProcessed = NewCounter(namespace+"messages_processed_total",
+		"Messages processed by the agent, by topic and final status.", "topic", "status")
+
+	// PluginDuration observes the durations of the steps, by plugin and status.
+	PluginDuration = NewHistogram(namespace+"plugin_duration_seconds",
+		"Durations of the steps of the documents, by plugin and status.", pluginDurationBuckets, "plugin", "status")
+
+	// PluginSlotWaiting counts the steps waiting for a slot of their plugin, by plugin.
+	PluginSlotWaiting = NewGauge(namespace+"plugin_slot_waiting",
+		"Steps waiting for a slot of their plugin, which is at its concurrency limit.", "plugin")
+
+	// APIErrors counts the failed calls to the AWS services, by error code of the service.
+	APIErrors = NewCounter(namespace+"api_errors_total",
+		"Failed calls to the AWS services, by error code.", "code")
+
+	// APIThrottles counts the calls to the AWS services rejected by throttling, by error code of the service.
+	APIThrottles = NewCounter(namespace+"api_throttles_total",
+		"Calls to the AWS services rejected by throttling, by error code.", "code")
+)
+
+func init() {
+	NewGaugeFunc(namespace+"info", "Version of the agent.", "version", func() map[string]float64 {
+		return map[string]float64{version.Version: 1}
+	})
+	NewGaugeFunc(namespace+"message_queue_depth", "Messages received and waiting to be processed.", "", func() map[string]float64 {
+		return map[string]float64{"": float64(backlog.Depth())}
+	})
+	NewCounterFunc(namespace+"errors_total", "Failures since the agent started, by agent error code.", "code", func() map[string]float64 {
+		values := make(map[string]float64)
+		for code, count := range agenterror.Counts() {
+			values[string(code)] = float64(count)
+		}
+		return values
+	})
+}
@@ -0,0 +1,366 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package metrics keeps counters of the activity of the agent and exposes them in the Prometheus text format,
+// for the fleets which scrape the instances with a node level collector.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// collector is a metric family written in the exposition.
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+var (
+	registry     = make(map[string]collector)
+	registryLock sync.Mutex
+)
+
+// register adds a metric family to the exposition, the names must be unique.
+func register(c collector) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if _, found := registry[c.name()]; found {
+		panic(fmt.Sprintf("metric %v is registered twice", c.name()))
+	}
+	registry[c.name()] = c
+}
+
+// Write writes all the metrics in the Prometheus text format, sorted by name.
+func Write(w io.Writer) {
+	registryLock.Lock()
+	collectors := make([]collector, 0, len(registry))
+	for _, c := range registry {
+		collectors = append(collectors, c)
+	}
+	registryLock.Unlock()
+
+	sort.Sort(collectorsByName(collectors))
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// family holds the description of a metric family and its series, keyed by their label values.
+type family struct {
+	metricName string
+	help       string
+	metricType string
+	labelNames []string
+	lock       sync.Mutex
+}
+
+func (f *family) name() string {
+	return f.metricName
+}
+
+// key returns the key of the series with the given label values.
+func (f *family) key(labelValues []string) string {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metric %v has labels %v, got values %v", f.metricName, f.labelNames, labelValues))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+// header writes the HELP and TYPE lines of the family.
+func (f *family) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.metricName, f.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.metricName, f.metricType)
+}
+
+// sample writes a line of the exposition.
+func (f *family) sample(w io.Writer, suffix string, labelValues []string, extraLabel string, extraValue string, value float64) {
+	var labels bytes.Buffer
+	for i, labelName := range f.labelNames {
+		writeLabel(&labels, labelName, labelValues[i])
+	}
+	if extraLabel != "" {
+		writeLabel(&labels, extraLabel, extraValue)
+	}
+	if labels.Len() > 0 {
+		fmt.Fprintf(w, "%s%s{%s} %s\n", f.metricName, suffix, labels.String(), formatValue(value))
+	} else {
+		fmt.Fprintf(w, "%s%s %s\n", f.metricName, suffix, formatValue(value))
+	}
+}
+
+// Counter is a metric which only goes up, e.g. the number of processed messages.
+type Counter struct {
+	family
+	values map[string]float64
+	labels map[string][]string
+}
+
+// NewCounter registers a counter with the given label names.
+func NewCounter(name string, help string, labelNames ...string) *Counter {
+	c := &Counter{
+		family: family{metricName: name, help: help, metricType: typeCounter, labelNames: labelNames},
+		values: make(map[string]float64),
+		labels: make(map[string][]string),
+	}
+	register(c)
+	return c
+}
+
+// Inc adds one to the series with the given label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds a positive value to the series with the given label values.
+func (c *Counter) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		return
+	}
+	key := c.key(labelValues)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.values[key] += value
+	c.labels[key] = labelValues
+}
+
+// Value returns the value of the series with the given label values.
+func (c *Counter) Value(labelValues ...string) float64 {
+	key := c.key(labelValues)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.values[key]
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.header(w)
+	for _, key := range sortedKeys(c.labels) {
+		c.sample(w, "", c.labels[key], "", "", c.values[key])
+	}
+}
+
+// Gauge is a metric which goes up and down, e.g. the number of steps waiting for a slot of their plugin.
+type Gauge struct {
+	family
+	values map[string]float64
+	labels map[string][]string
+}
+
+// NewGauge registers a gauge with the given label names.
+func NewGauge(name string, help string, labelNames ...string) *Gauge {
+	g := &Gauge{
+		family: family{metricName: name, help: help, metricType: typeGauge, labelNames: labelNames},
+		values: make(map[string]float64),
+		labels: make(map[string][]string),
+	}
+	register(g)
+	return g
+}
+
+// Set sets the value of the series with the given label values.
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	key := g.key(labelValues)
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.values[key] = value
+	g.labels[key] = labelValues
+}
+
+// Add adds a value, which can be negative, to the series with the given label values.
+func (g *Gauge) Add(value float64, labelValues ...string) {
+	key := g.key(labelValues)
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.values[key] += value
+	g.labels[key] = labelValues
+}
+
+// Value returns the value of the series with the given label values.
+func (g *Gauge) Value(labelValues ...string) float64 {
+	key := g.key(labelValues)
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.values[key]
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.header(w)
+	for _, key := range sortedKeys(g.labels) {
+		g.sample(w, "", g.labels[key], "", "", g.values[key])
+	}
+}
+
+// Histogram counts observations, e.g. durations, in cumulative buckets.
+type Histogram struct {
+	family
+	buckets []float64
+	series  map[string]*histogramSeries
+}
+
+// histogramSeries holds the observations of a histogram with some label values.
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64
+	count       uint64
+	sum         float64
+}
+
+// NewHistogram registers a histogram with the given upper bounds of the buckets, in increasing order.
+func NewHistogram(name string, help string, buckets []float64, labelNames ...string) *Histogram {
+	h := &Histogram{
+		family:  family{metricName: name, help: help, metricType: typeHistogram, labelNames: labelNames},
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	register(h)
+	return h
+}
+
+// Observe adds an observation to the series with the given label values.
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	series, found := h.series[key]
+	if !found {
+		series = &histogramSeries{labelValues: labelValues, counts: make([]uint64, len(h.buckets))}
+		h.series[key] = series
+	}
+	for i, upperBound := range h.buckets {
+		if value <= upperBound {
+			series.counts[i]++
+		}
+	}
+	series.count++
+	series.sum += value
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.header(w)
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		series := h.series[key]
+		for i, upperBound := range h.buckets {
+			h.sample(w, "_bucket", series.labelValues, "le", formatValue(upperBound), float64(series.counts[i]))
+		}
+		h.sample(w, "_bucket", series.labelValues, "le", "+Inf", float64(series.count))
+		h.sample(w, "_sum", series.labelValues, "", "", series.sum)
+		h.sample(w, "_count", series.labelValues, "", "", float64(series.count))
+	}
+}
+
+// funcCollector reads the values of a metric from another package when the metrics are written.
+type funcCollector struct {
+	family
+	collect func() map[string]float64
+}
+
+// NewCounterFunc registers a counter whose values are read by collect, keyed by the value of a single label.
+// The key is ignored when the label name is empty.
+func NewCounterFunc(name string, help string, labelName string, collect func() map[string]float64) {
+	registerFunc(name, help, typeCounter, labelName, collect)
+}
+
+// NewGaugeFunc registers a gauge whose values are read by collect, keyed by the value of a single label.
+// The key is ignored when the label name is empty.
+func NewGaugeFunc(name string, help string, labelName string, collect func() map[string]float64) {
+	registerFunc(name, help, typeGauge, labelName, collect)
+}
+
+func registerFunc(name string, help string, metricType string, labelName string, collect func() map[string]float64) {
+	f := &funcCollector{
+		family:  family{metricName: name, help: help, metricType: metricType},
+		collect: collect,
+	}
+	if labelName != "" {
+		f.labelNames = []string{labelName}
+	}
+	register(f)
+}
+
+func (f *funcCollector) write(w io.Writer) {
+	values := f.collect()
+	f.header(w)
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var labelValues []string
+		if len(f.labelNames) > 0 {
+			labelValues = []string{key}
+		}
+		f.sample(w, "", labelValues, "", "", values[key])
+	}
+}
+
+// writeLabel appends a label pair, escaping the value as the text format requires.
+func writeLabel(labels *bytes.Buffer, name string, value string) {
+	if labels.Len() > 0 {
+		labels.WriteString(",")
+	}
+	value = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(value)
+	fmt.Fprintf(labels, `%s="%s"`, name, value)
+}
+
+// formatValue formats a sample value, with the special values of the text format.
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys(labels map[string][]string) []string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// collectorsByName sorts metric families by name.
+type collectorsByName []collector
+
+func (c collectorsByName) Len() int           { return len(c) }
+func (c collectorsByName) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c collectorsByName) Less(i, j int) bool { return c[i].name() < c[j].name() }
@@ -0,0 +1,143 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// unregister removes the metrics registered by a test, so that the tests can run again.
+func unregister(names ...string) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	for _, name := range names {
+		delete(registry, name)
+	}
+}
+
+func TestCounter(t *testing.T) {
+	defer unregister("test_counter_total")
+	counter := NewCounter("test_counter_total", "A test counter.", "topic", "status")
+	counter.Inc("sendCommand", "Success")
+	counter.Inc("sendCommand", "Success")
+	counter.Add(3, "cancelCommand", "Failed")
+	counter.Add(-1, "cancelCommand", "Failed")
+
+	assert.Equal(t, float64(2), counter.Value("sendCommand", "Success"))
+	assert.Equal(t, float64(3), counter.Value("cancelCommand", "Failed"))
+	assert.Equal(t, float64(0), counter.Value("sendCommand", "Failed"))
+
+	var output bytes.Buffer
+	counter.write(&output)
+	assert.Equal(t, `# HELP test_counter_total A test counter.
+# TYPE test_counter_total counter
+test_counter_total{topic="cancelCommand",status="Failed"} 3
+test_counter_total{topic="sendCommand",status="Success"} 2
+`, output.String())
+}
+
+func TestCounterPanicsOnWrongLabels(t *testing.T) {
+	defer unregister("test_labels_total")
+	counter := NewCounter("test_labels_total", "A test counter.", "code")
+	assert.Panics(t, func() { counter.Inc() })
+	assert.Panics(t, func() { counter.Inc("a", "b") })
+}
+
+func TestRegisterTwicePanics(t *testing.T) {
+	defer unregister("test_duplicate")
+	NewGauge("test_duplicate", "A test gauge.")
+	assert.Panics(t, func() { NewGauge("test_duplicate", "A test gauge.") })
+}
+
+func TestGauge(t *testing.T) {
+	defer unregister("test_gauge")
+	gauge := NewGauge("test_gauge", "A test gauge.", "plugin")
+	gauge.Add(1, "aws:runShellScript")
+	gauge.Add(1, "aws:runShellScript")
+	gauge.Add(-1, "aws:runShellScript")
+	gauge.Set(5, "aws:copyFile")
+
+	var output bytes.Buffer
+	gauge.write(&output)
+	assert.Equal(t, `# HELP test_gauge A test gauge.
+# TYPE test_gauge gauge
+test_gauge{plugin="aws:copyFile"} 5
+test_gauge{plugin="aws:runShellScript"} 1
+`, output.String())
+}
+
+func TestHistogram(t *testing.T) {
+	defer unregister("test_duration_seconds")
+	histogram := NewHistogram("test_duration_seconds", "A test histogram.", []float64{1, 10}, "plugin")
+	histogram.Observe(0.5, "aws:runShellScript")
+	histogram.Observe(5, "aws:runShellScript")
+	histogram.Observe(20, "aws:runShellScript")
+
+	var output bytes.Buffer
+	histogram.write(&output)
+	assert.Equal(t, `# HELP test_duration_seconds A test histogram.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{plugin="aws:runShellScript",le="1"} 1
+test_duration_seconds_bucket{plugin="aws:runShellScript",le="10"} 2
+test_duration_seconds_bucket{plugin="aws:runShellScript",le="+Inf"} 3
+test_duration_seconds_sum{plugin="aws:runShellScript"} 25.5
+test_duration_seconds_count{plugin="aws:runShellScript"} 3
+`, output.String())
+}
+
+func TestFuncCollectors(t *testing.T) {
+	defer unregister("test_depth", "test_errors_total")
+	NewGaugeFunc("test_depth", "A test gauge.", "", func() map[string]float64 {
+		return map[string]float64{"": 4}
+	})
+	NewCounterFunc("test_errors_total", "A test counter.", "code", func() map[string]float64 {
+		return map[string]float64{"SSM-4001": 2, "SSM-2001": 1}
+	})
+
+	var output bytes.Buffer
+	registry["test_depth"].write(&output)
+	registry["test_errors_total"].write(&output)
+	assert.Equal(t, `# HELP test_depth A test gauge.
+# TYPE test_depth gauge
+test_depth 4
+# HELP test_errors_total A test counter.
+# TYPE test_errors_total counter
+test_errors_total{code="SSM-2001"} 1
+test_errors_total{code="SSM-4001"} 2
+`, output.String())
+}
+
+func TestLabelValuesAreEscaped(t *testing.T) {
+	defer unregister("test_escaped_total")
+	counter := NewCounter("test_escaped_total", "A test counter.", "code")
+	counter.Inc("a\"b\\c\nd")
+
+	var output bytes.Buffer
+	counter.write(&output)
+	assert.Contains(t, output.String(), `test_escaped_total{code="a\"b\\c\nd"} 1`)
+}
+
+func TestWriteSortsTheAgentMetrics(t *testing.T) {
+	MessagesProcessed.Inc("sendCommand", "Success")
+
+	var output bytes.Buffer
+	Write(&output)
+	assert.Regexp(t, `ssm_agent_messages_processed_total\{topic="sendCommand",status="Success"\} [1-9]`, output.String())
+	assert.Contains(t, output.String(), "# TYPE ssm_agent_plugin_duration_seconds histogram\n")
+	assert.Contains(t, output.String(), "ssm_agent_message_queue_depth 0\n")
+	assert.True(t, bytes.Index(output.Bytes(), []byte("ssm_agent_api_errors_total")) < bytes.Index(output.Bytes(), []byte("ssm_agent_info")))
+}
@@ -0,0 +1,110 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package metrics keeps counters of the activity of the agent and exposes them in the Prometheus text format.
+// server serves the metrics on the loopback interface, when the agent configuration enables it.
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/aws/amazon-ssm-agent/agent/context"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/contracts/plugin"
+)
+
+const (
+	name = "MetricsServer"
+
+	// Path is the path of the metrics on the endpoint.
+	Path = "/metrics"
+
+	// contentType is the content type of the Prometheus text format.
+	contentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// Server is the core plugin serving the metrics to the collectors running on the instance.
+type Server struct {
+	plugin.ICorePlugin
+	context  context.T
+	listener net.Listener
+}
+
+// NewServer creates the metrics core plugin.
+func NewServer(context context.T) *Server {
+	return &Server{
+		context: context.With("[" + name + "]"),
+	}
+}
+
+// Address returns the address of the endpoint, which only listens on the loopback interface.
+func Address(port int) string {
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+}
+
+// Handler returns the handler writing the metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		Write(w)
+	})
+}
+
+// ICorePlugin implementation
+
+// Name returns the Plugin Name
+func (s *Server) Name() string {
+	return name
+}
+
+// Execute starts serving the metrics when they are enabled in the agent configuration
+func (s *Server) Execute(context context.T) (err error) {
+	log := s.context.Log()
+	config := s.context.AppConfig().Metrics
+	if !config.Enabled {
+		log.Debug("metrics endpoint is disabled")
+		return nil
+	}
+
+	if s.listener, err = net.Listen("tcp", Address(config.Port)); err != nil {
+		return fmt.Errorf("unable to listen on %v: %v", Address(config.Port), err)
+	}
+	log.Infof("serving metrics on http://%v%v", s.listener.Addr(), Path)
+
+	mux := http.NewServeMux()
+	mux.Handle(Path, Handler())
+	go func(listener net.Listener) {
+		if serveErr := http.Serve(listener, mux); serveErr != nil {
+			log.Debugf("metrics endpoint stopped: %v", serveErr)
+		}
+	}(s.listener)
+	return nil
+}
+
+// RequestStop closes the metrics endpoint
+func (s *Server) RequestStop(stopType contracts.StopType) (err error) {
+	if s.listener != nil {
+		s.context.Log().Info("stopping metrics endpoint.")
+		err = s.listener.Close()
+		s.listener = nil
+	}
+	return
+}
@@ -0,0 +1,85 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/context"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// newContext returns a context whose configuration enables the metrics on a free port.
+func newContext(enabled bool) *context.Mock {
+	config := appconfig.DefaultConfig()
+	config.Metrics.Enabled = enabled
+	config.Metrics.Port = 0
+	ctx := new(context.Mock)
+	ctx.On("Log").Return(log.NewMockLog())
+	ctx.On("AppConfig").Return(config)
+	ctx.On("With", mock.AnythingOfType("string")).Return(ctx)
+	return ctx
+}
+
+func TestAddressIsLoopback(t *testing.T) {
+	assert.Equal(t, "127.0.0.1:9487", Address(appconfig.DefaultMetricsPort))
+}
+
+func TestHandler(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, Path, nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, contentType, recorder.Header().Get("Content-Type"))
+	assert.Contains(t, recorder.Body.String(), "# TYPE ssm_agent_info gauge\n")
+
+	recorder = httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, Path, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func TestServerDisabled(t *testing.T) {
+	ctx := newContext(false)
+	server := NewServer(ctx)
+	assert.NoError(t, server.Execute(ctx))
+	assert.Nil(t, server.listener)
+	assert.NoError(t, server.RequestStop(contracts.StopTypeHardStop))
+}
+
+func TestServerServesMetrics(t *testing.T) {
+	ctx := newContext(true)
+	server := NewServer(ctx)
+	assert.NoError(t, server.Execute(ctx))
+	assert.NotNil(t, server.listener)
+	url := "http://" + server.listener.Addr().String() + Path
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+	response, err := client.Get(url)
+	assert.NoError(t, err)
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Contains(t, string(body), "ssm_agent_info{version=")
+
+	assert.NoError(t, server.RequestStop(contracts.StopTypeHardStop))
+	_, err = client.Get(url)
+	assert.Error(t, err)
+}
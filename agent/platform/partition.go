@@ -0,0 +1,77 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package platform contains platform specific utilities.
+// partition contains the naming rules of the aws partitions, so that the same binary runs in all of them.
+package platform
+
+import (
+	"strings"
+)
+
+const (
+	// PartitionAws is the commercial partition.
+	PartitionAws = "aws"
+
+	// PartitionAwsCn is the China partition.
+	PartitionAwsCn = "aws-cn"
+
+	// PartitionAwsUsGov is the GovCloud (US) partition.
+	PartitionAwsUsGov = "aws-us-gov"
+)
+
+// Partition describes the naming rules of a partition.
+type Partition struct {
+	// ID is the partition of the ARNs, e.g. aws-cn
+	ID string
+
+	// DNSSuffix is the domain of the endpoints, e.g. amazonaws.com.cn
+	DNSSuffix string
+}
+
+// partitions are matched on the prefix of the region, the commercial partition is the default.
+var partitions = []struct {
+	regionPrefix string
+	partition    Partition
+}{
+	{regionPrefix: "cn-", partition: Partition{ID: PartitionAwsCn, DNSSuffix: "amazonaws.com.cn"}},
+	{regionPrefix: "us-gov-", partition: Partition{ID: PartitionAwsUsGov, DNSSuffix: "amazonaws.com"}},
+}
+
+// PartitionForRegion returns the partition the region belongs to.
+func PartitionForRegion(region string) Partition {
+	for _, candidate := range partitions {
+		if strings.HasPrefix(region, candidate.regionPrefix) {
+			return candidate.partition
+		}
+	}
+	return Partition{ID: PartitionAws, DNSSuffix: "amazonaws.com"}
+}
+
+// ServiceEndpoint returns the regional endpoint of a service, e.g. ssm.cn-north-1.amazonaws.com.cn.
+func (p Partition) ServiceEndpoint(service string, region string) string {
+	return service + "." + region + "." + p.DNSSuffix
+}
+
+// S3Endpoint returns the endpoint of S3 in the region. The global endpoint is used for us-east-1.
+func (p Partition) S3Endpoint(region string) string {
+	if p.ID == PartitionAws && region == "us-east-1" {
+		return "s3." + p.DNSSuffix
+	}
+	return p.ServiceEndpoint("s3", region)
+}
+
+// S3BucketURL returns the path style url of an object in a bucket of the region.
+func (p Partition) S3BucketURL(region string, bucket string, key string) string {
+	return "https://" + p.S3Endpoint(region) + "/" + bucket + "/" + strings.TrimPrefix(key, "/")
+}
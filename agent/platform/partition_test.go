@@ -0,0 +1,40 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package platform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitionForRegion(t *testing.T) {
+	aws := PartitionForRegion("us-east-1")
+	assert.Equal(t, PartitionAws, aws.ID)
+	assert.Equal(t, "s3.amazonaws.com", aws.S3Endpoint("us-east-1"))
+	assert.Equal(t, "s3.eu-west-1.amazonaws.com", aws.S3Endpoint("eu-west-1"))
+
+	china := PartitionForRegion("cn-northwest-1")
+	assert.Equal(t, PartitionAwsCn, china.ID)
+	assert.Equal(t, "ssm.cn-northwest-1.amazonaws.com.cn", china.ServiceEndpoint("ssm", "cn-northwest-1"))
+	assert.Equal(t, "https://s3.cn-north-1.amazonaws.com.cn/amazon-ssm-cn-north-1/ssm-agent-manifest.json",
+		china.S3BucketURL("cn-north-1", "amazon-ssm-cn-north-1", "ssm-agent-manifest.json"))
+
+	gov := PartitionForRegion("us-gov-west-1")
+	assert.Equal(t, PartitionAwsUsGov, gov.ID)
+	assert.Equal(t, "s3.us-gov-west-1.amazonaws.com", gov.S3Endpoint("us-gov-west-1"))
+
+	// unknown regions belong to the commercial partition
+	assert.Equal(t, PartitionAws, PartitionForRegion("").ID)
+}
@@ -0,0 +1,228 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package ansible implements the aws:runAnsiblePlaybook plugin.
+package ansible
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/context"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/executers"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/jsonutil"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/pluginutil"
+	"github.com/aws/amazon-ssm-agent/agent/task"
+)
+
+const (
+	// playbookFileName is the name of the playbook downloaded from a source or written from inline content.
+	playbookFileName = "playbook.yml"
+
+	// extraVarsFileName is the name of the file passed to ansible-playbook with --extra-vars.
+	extraVarsFileName = "extra_vars.json"
+
+	// repositoryDirName is the directory where the git repository is cloned.
+	repositoryDirName = "repository"
+)
+
+// Plugin is the type for the aws:runAnsiblePlaybook plugin.
+type Plugin struct {
+	pluginutil.DefaultPlugin
+}
+
+// AnsiblePluginInput represents one playbook run by the aws:runAnsiblePlaybook plugin.
+// Exactly one of Playbook (inline content), PlaybookSource (S3 or http url) or GitRepository must be set.
+type AnsiblePluginInput struct {
+	contracts.PluginInput
+	ID                     string
+	Playbook               string
+	PlaybookSource         string
+	PlaybookSourceHash     string
+	PlaybookSourceHashType string
+	GitRepository          string
+	GitRef                 string
+	PlaybookPath           string
+	ExtraVars              map[string]interface{}
+	Tags                   string
+	SkipTags               string
+	Check                  bool
+	InstallDependencies    bool
+	WorkingDirectory       string
+	TimeoutSeconds         interface{}
+}
+
+// NewPlugin returns a new instance of the plugin.
+func NewPlugin(pluginConfig pluginutil.PluginConfig) (*Plugin, error) {
+	var plugin Plugin
+	plugin.MaxStdoutLength = pluginConfig.MaxStdoutLength
+	plugin.MaxStderrLength = pluginConfig.MaxStderrLength
+	plugin.StdoutFileName = pluginConfig.StdoutFileName
+	plugin.StderrFileName = pluginConfig.StderrFileName
+	plugin.OutputTruncatedSuffix = pluginConfig.OutputTruncatedSuffix
+	plugin.Uploader = pluginutil.GetS3Config()
+	plugin.ExecuteUploadOutputToS3Bucket = pluginutil.UploadOutputToS3BucketExecuter(plugin.UploadOutputToS3Bucket)
+
+	exec := executers.ShellCommandExecuter{}
+	plugin.ExecuteCommand = pluginutil.CommandExecuter(exec.Execute)
+
+	return &plugin, nil
+}
+
+// Name returns the plugin name
+func Name() string {
+	return appconfig.PluginNameAwsRunAnsiblePlaybook
+}
+
+// Execute runs the playbooks and returns their outputs.
+func (p *Plugin) Execute(context context.T, config contracts.Configuration, cancelFlag task.CancelFlag) (res contracts.PluginResult) {
+	log := context.Log()
+	log.Infof("%v started with configuration %v", Name(), config)
+	res.StartDateTime = time.Now()
+	defer func() { res.EndDateTime = time.Now() }()
+
+	var properties []interface{}
+	if properties, res = pluginutil.LoadParametersAsList(log, config.Properties); res.Code != 0 {
+		pluginutil.PersistPluginInformationToCurrent(log, Name(), config, res)
+		return res
+	}
+
+	out := make([]contracts.PluginOutput, len(properties))
+	for i, prop := range properties {
+		if cancelFlag.ShutDown() {
+			out[i] = contracts.PluginOutput{Errors: []string{"Execution canceled due to ShutDown"}}
+			out[i].ExitCode = 1
+			out[i].Status = contracts.ResultStatusFailed
+			break
+		}
+
+		if cancelFlag.Canceled() {
+			out[i] = contracts.PluginOutput{Errors: []string{"Execution canceled"}}
+			out[i].ExitCode = 1
+			out[i].Status = contracts.ResultStatusCancelled
+			break
+		}
+
+		out[i] = p.runPlaybookRawInput(log, prop, config.OrchestrationDirectory, cancelFlag, config.OutputS3BucketName, config.OutputS3KeyPrefix)
+	}
+
+	if len(properties) > 0 {
+		res.Code = out[0].ExitCode
+		res.Status = out[0].Status
+		res.Output = out[0].String()
+	}
+
+	pluginutil.PersistPluginInformationToCurrent(log, Name(), config, res)
+	return res
+}
+
+// runPlaybookRawInput runs one playbook and returns its output.
+// The input is in the default json unmarshal format (e.g. map[string]interface{}).
+func (p *Plugin) runPlaybookRawInput(log log.T, rawPluginInput interface{}, orchestrationDirectory string, cancelFlag task.CancelFlag, outputS3BucketName string, outputS3KeyPrefix string) (out contracts.PluginOutput) {
+	var pluginInput AnsiblePluginInput
+	if err := jsonutil.Remarshal(rawPluginInput, &pluginInput); err != nil {
+		errorString := fmt.Sprintf("Invalid format in plugin properties %v;\nerror %v", rawPluginInput, err)
+		out.Errors = append(out.Errors, errorString)
+		out.Status = contracts.ResultStatusFailed
+		log.Error(errorString)
+		return
+	}
+	return p.runPlaybook(log, pluginInput, orchestrationDirectory, cancelFlag, outputS3BucketName, outputS3KeyPrefix)
+}
+
+// runPlaybook fetches the playbook, runs it with ansible-playbook against the local host and
+// summarizes the results of its tasks in the output.
+func (p *Plugin) runPlaybook(log log.T, pluginInput AnsiblePluginInput, orchestrationDirectory string, cancelFlag task.CancelFlag, outputS3BucketName string, outputS3KeyPrefix string) (out contracts.PluginOutput) {
+	var err error
+
+	if err = validateInput(pluginInput); err != nil {
+		return pluginutil.MarkAsFailed(log, out, err)
+	}
+
+	// if no orchestration directory specified, create temp directory
+	var useTempDirectory = (orchestrationDirectory == "")
+	var tempDir string
+	if useTempDirectory {
+		if tempDir, err = ioutil.TempDir("", "Ec2RunCommand"); err != nil {
+			return pluginutil.MarkAsFailed(log, out, err)
+		}
+		orchestrationDirectory = tempDir
+	}
+
+	orchestrationDir := filepath.Join(orchestrationDirectory, fileutil.RemoveInvalidChars(pluginInput.ID))
+	if err = fileutil.MakeDirsWithExecuteAccess(orchestrationDir); err != nil {
+		return pluginutil.MarkAsFailed(log, out, err)
+	}
+
+	// fetch the playbook, git repositories are cloned by the script itself
+	playbookPath, err := preparePlaybook(log, pluginInput, orchestrationDir)
+	if err != nil {
+		return pluginutil.MarkAsFailed(log, out, err)
+	}
+
+	extraVarsPath := ""
+	if len(pluginInput.ExtraVars) > 0 {
+		extraVarsPath = filepath.Join(orchestrationDir, extraVarsFileName)
+		content, _ := jsonutil.Marshal(pluginInput.ExtraVars)
+		if err = fileutil.HardenedWriteFile(extraVarsPath, []byte(content)); err != nil {
+			return pluginutil.MarkAsFailed(log, out, err)
+		}
+	}
+
+	scriptPath := filepath.Join(orchestrationDir, pluginutil.RunCommandScriptName)
+	if err = pluginutil.CreateScriptFile(log, scriptPath, buildScript(pluginInput, orchestrationDir, playbookPath, extraVarsPath)); err != nil {
+		return pluginutil.MarkAsFailed(log, out, err)
+	}
+
+	executionTimeout := pluginutil.ValidateExecutionTimeout(log, pluginInput.TimeoutSeconds)
+	stdoutFilePath := filepath.Join(orchestrationDir, p.StdoutFileName)
+	stderrFilePath := filepath.Join(orchestrationDir, p.StderrFileName)
+	commandName := pluginutil.GetShellCommand()
+	commandArguments := append(pluginutil.GetShellArguments(), scriptPath, pluginutil.ExitCodeTrap)
+
+	_, stderr, exitCode, errs := p.ExecuteCommand(log, pluginInput.WorkingDirectory, stdoutFilePath, stderrFilePath, cancelFlag, executionTimeout, commandName, commandArguments, executers.ExecuteOptions{Limits: pluginutil.ResourceLimitsFor(Name(), executers.ResourceLimits{})})
+
+	out.ExitCode = exitCode
+	out.Status = pluginutil.GetStatus(out.ExitCode, cancelFlag)
+	for _, err := range errs {
+		out.Errors = append(out.Errors, err.Error())
+		if out.Status != contracts.ResultStatusCancelled && out.Status != contracts.ResultStatusTimedOut {
+			log.Error("failed to run playbook: ", err)
+			out.Status = contracts.ResultStatusFailed
+		}
+	}
+
+	// the json callback prints the whole run on stdout, it is summarized task by task
+	rawStdout, err := ioutil.ReadFile(stdoutFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		out.Errors = append(out.Errors, err.Error())
+	}
+	out.Stdout = summarizePlaybookRun(rawStdout)
+	if len(out.Stdout) > p.MaxStdoutLength {
+		out.Stdout = out.Stdout[:p.MaxStdoutLength] + p.OutputTruncatedSuffix
+	}
+	if out.Stderr, err = pluginutil.ReadPrefix(stderr, p.MaxStderrLength, p.OutputTruncatedSuffix); err != nil {
+		out.Errors = append(out.Errors, err.Error())
+	}
+
+	uploadOutputToS3BucketErrors := p.ExecuteUploadOutputToS3Bucket(log, pluginInput.ID, orchestrationDir, outputS3BucketName, outputS3KeyPrefix, useTempDirectory, tempDir, out.Stdout, out.Stderr)
+	out.Errors = append(out.Errors, uploadOutputToS3BucketErrors...)
+	return
+}
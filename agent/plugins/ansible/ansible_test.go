@@ -0,0 +1,73 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ansible
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var sampleJSONCallbackOutput = `[WARNING]: provided hosts list is empty
+{
+    "plays": [{
+        "play": {"name": "configure"},
+        "tasks": [
+            {"task": {"name": "install nginx"}, "hosts": {"localhost": {"changed": true}}},
+            {"task": {"name": "start nginx"}, "hosts": {"localhost": {"failed": true, "msg": "unit not found"}}}
+        ]
+    }],
+    "stats": {"localhost": {"ok": 1, "changed": 1, "failures": 1, "skipped": 0, "unreachable": 0}}
+}`
+
+func TestSummarizePlaybookRun(t *testing.T) {
+	summary := summarizePlaybookRun([]byte(sampleJSONCallbackOutput))
+
+	assert.Equal(t, "PLAY [configure]\n"+
+		"  changed: install nginx\n"+
+		"  failed: start nginx (unit not found)\n"+
+		"RECAP\n"+
+		"  localhost: ok=1 changed=1 failed=1 skipped=0 unreachable=0\n", summary)
+
+	assert.Equal(t, "not json", summarizePlaybookRun([]byte("not json")))
+}
+
+func TestBuildScript(t *testing.T) {
+	input := AnsiblePluginInput{
+		GitRepository:       "https://example.com/playbooks.git",
+		GitRef:              "v1",
+		PlaybookPath:        "site.yml",
+		Tags:                "web",
+		Check:               true,
+		InstallDependencies: true,
+	}
+	assert.Nil(t, validateInput(input))
+
+	commands := buildScript(input, "/orchestration", "/orchestration/repository/site.yml", "/orchestration/extra_vars.json")
+	assert.Equal(t, installAnsibleCommand, commands[0])
+	assert.Equal(t, checkAnsibleCommand, commands[1])
+	assert.True(t, strings.HasPrefix(commands[2], "git clone --quiet --depth 1 --branch 'v1' -- 'https://example.com/playbooks.git'"))
+	assert.Equal(t, "ANSIBLE_STDOUT_CALLBACK=json ansible-playbook -i 'localhost,' -c local --check --tags 'web' "+
+		"--extra-vars '@/orchestration/extra_vars.json' '/orchestration/repository/site.yml'", commands[3])
+}
+
+func TestValidateInput(t *testing.T) {
+	assert.NotNil(t, validateInput(AnsiblePluginInput{}))
+	assert.NotNil(t, validateInput(AnsiblePluginInput{Playbook: "- hosts: all", PlaybookSource: "s3://bucket/site.yml"}))
+	assert.NotNil(t, validateInput(AnsiblePluginInput{GitRepository: "https://example.com/playbooks.git"}))
+	assert.Nil(t, validateInput(AnsiblePluginInput{Playbook: "- hosts: all"}))
+	assert.NotNil(t, validateInput(AnsiblePluginInput{GitRepository: "--upload-pack=touch /tmp/pwned", PlaybookPath: "site.yml"}))
+	assert.NotNil(t, validateInput(AnsiblePluginInput{GitRepository: "https://example.com/playbooks.git", GitRef: "-b", PlaybookPath: "site.yml"}))
+}
@@ -0,0 +1,207 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package ansible implements the aws:runAnsiblePlaybook plugin.
+// playbook contains the functions preparing the playbook run and parsing its results.
+package ansible
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/pluginutil"
+)
+
+// installAnsibleCommand installs ansible with the first package manager available on the instance.
+const installAnsibleCommand = "command -v ansible-playbook >/dev/null 2>&1 || " +
+	"{ yum install -y ansible || apt-get install -y ansible || pip install ansible; } >&2"
+
+// checkAnsibleCommand fails the run when ansible is not installed.
+const checkAnsibleCommand = "command -v ansible-playbook >/dev/null 2>&1 || " +
+	"{ echo 'ansible-playbook is not installed, set InstallDependencies to install it' >&2; exit 1; }"
+
+// playbookRun is the part of the output of the ansible json callback used to summarize the run.
+type playbookRun struct {
+	Plays []struct {
+		Play struct {
+			Name string `json:"name"`
+		} `json:"play"`
+		Tasks []struct {
+			Task struct {
+				Name string `json:"name"`
+			} `json:"task"`
+			Hosts map[string]taskResult `json:"hosts"`
+		} `json:"tasks"`
+	} `json:"plays"`
+	Stats map[string]map[string]int `json:"stats"`
+}
+
+// taskResult is the result of a task on one host.
+type taskResult struct {
+	Changed     bool   `json:"changed"`
+	Failed      bool   `json:"failed"`
+	Skipped     bool   `json:"skipped"`
+	Unreachable bool   `json:"unreachable"`
+	Msg         string `json:"msg"`
+}
+
+// validateInput checks that exactly one playbook source is declared.
+func validateInput(input AnsiblePluginInput) error {
+	sources := 0
+	for _, source := range []string{input.Playbook, input.PlaybookSource, input.GitRepository} {
+		if strings.TrimSpace(source) != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return errors.New("exactly one of Playbook, PlaybookSource or GitRepository must be specified")
+	}
+	if input.GitRepository != "" && input.PlaybookPath == "" {
+		return errors.New("PlaybookPath is required to run a playbook from a git repository")
+	}
+	// git would take a repository or a ref starting with a dash for an option
+	if strings.HasPrefix(input.GitRepository, "-") || strings.HasPrefix(input.GitRef, "-") {
+		return errors.New("GitRepository and GitRef cannot start with -")
+	}
+	return nil
+}
+
+// preparePlaybook writes the inline playbook or downloads it from its source, and returns its path.
+// Playbooks from git repositories are referenced inside the clone made by the script.
+func preparePlaybook(log log.T, input AnsiblePluginInput, orchestrationDir string) (playbookPath string, err error) {
+	switch {
+	case input.GitRepository != "":
+		return filepath.Join(orchestrationDir, repositoryDirName, input.PlaybookPath), nil
+
+	case input.PlaybookSource != "":
+		downloadOutput, err := pluginutil.DownloadFileFromSource(log, input.PlaybookSource, input.PlaybookSourceHash, input.PlaybookSourceHashType)
+		if err != nil || !downloadOutput.IsHashMatched || downloadOutput.LocalFilePath == "" {
+			return "", fmt.Errorf("failed to download playbook reliably %v", input.PlaybookSource)
+		}
+		return downloadOutput.LocalFilePath, nil
+
+	default:
+		playbookPath = filepath.Join(orchestrationDir, playbookFileName)
+		if err = fileutil.HardenedWriteFile(playbookPath, []byte(input.Playbook)); err != nil {
+			return "", err
+		}
+		return playbookPath, nil
+	}
+}
+
+// buildScript returns the commands running the playbook against the local host, with the json callback
+// so that the results of the tasks can be parsed.
+func buildScript(input AnsiblePluginInput, orchestrationDir string, playbookPath string, extraVarsPath string) (commands []string) {
+	if input.InstallDependencies {
+		commands = append(commands, installAnsibleCommand)
+	}
+	commands = append(commands, checkAnsibleCommand)
+
+	if input.GitRepository != "" {
+		clone := "git clone --quiet --depth 1"
+		if input.GitRef != "" {
+			clone += " --branch " + pluginutil.ShellQuote(input.GitRef)
+		}
+		clone += " -- " + pluginutil.ShellQuote(input.GitRepository) + " " + pluginutil.ShellQuote(filepath.Join(orchestrationDir, repositoryDirName)) + " >&2 || exit 1"
+		commands = append(commands, clone)
+	}
+
+	run := "ANSIBLE_STDOUT_CALLBACK=json ansible-playbook -i 'localhost,' -c local"
+	if input.Check {
+		run += " --check"
+	}
+	if input.Tags != "" {
+		run += " --tags " + pluginutil.ShellQuote(input.Tags)
+	}
+	if input.SkipTags != "" {
+		run += " --skip-tags " + pluginutil.ShellQuote(input.SkipTags)
+	}
+	if extraVarsPath != "" {
+		run += " --extra-vars " + pluginutil.ShellQuote("@"+extraVarsPath)
+	}
+	run += " " + pluginutil.ShellQuote(playbookPath)
+	return append(commands, run)
+}
+
+// summarizePlaybookRun maps the output of the json callback to one line per task and host, followed by
+// the recap of the run. The raw output is returned when it cannot be parsed.
+func summarizePlaybookRun(rawOutput []byte) string {
+	start := bytes.IndexByte(rawOutput, '{')
+	if start < 0 {
+		return string(rawOutput)
+	}
+	var run playbookRun
+	if err := json.Unmarshal(rawOutput[start:], &run); err != nil {
+		return string(rawOutput)
+	}
+
+	var summary bytes.Buffer
+	for _, play := range run.Plays {
+		fmt.Fprintf(&summary, "PLAY [%v]\n", play.Play.Name)
+		for _, task := range play.Tasks {
+			for _, host := range sortedKeys(task.Hosts) {
+				result := task.Hosts[host]
+				fmt.Fprintf(&summary, "  %v: %v", taskStatus(result), task.Task.Name)
+				if (result.Failed || result.Unreachable) && result.Msg != "" {
+					fmt.Fprintf(&summary, " (%v)", result.Msg)
+				}
+				summary.WriteString("\n")
+			}
+		}
+	}
+
+	summary.WriteString("RECAP\n")
+	hosts := make([]string, 0, len(run.Stats))
+	for host := range run.Stats {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		stats := run.Stats[host]
+		fmt.Fprintf(&summary, "  %v: ok=%v changed=%v failed=%v skipped=%v unreachable=%v\n",
+			host, stats["ok"], stats["changed"], stats["failures"], stats["skipped"], stats["unreachable"])
+	}
+	return summary.String()
+}
+
+// taskStatus returns the status of a task result, as printed by ansible.
+func taskStatus(result taskResult) string {
+	switch {
+	case result.Unreachable:
+		return "unreachable"
+	case result.Failed:
+		return "failed"
+	case result.Skipped:
+		return "skipping"
+	case result.Changed:
+		return "changed"
+	default:
+		return "ok"
+	}
+}
+
+// sortedKeys returns the hosts of a task in alphabetical order.
+func sortedKeys(hosts map[string]taskResult) (keys []string) {
+	for host := range hosts {
+		keys = append(keys, host)
+	}
+	sort.Strings(keys)
+	return
+}
@@ -0,0 +1,227 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package chef implements the aws:runChefRecipe plugin.
+package chef
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/context"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/executers"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/jsonutil"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/pluginutil"
+	"github.com/aws/amazon-ssm-agent/agent/task"
+)
+
+const (
+	// repositoryDirName is the chef repository where the cookbooks archive is extracted.
+	repositoryDirName = "repository"
+
+	// reportDirName is the directory where the json report handler writes the converge report.
+	reportDirName = "reports"
+
+	// clientConfigFileName is the configuration passed to chef-client.
+	clientConfigFileName = "client.rb"
+
+	// attributesFileName is the json attributes file passed to chef-client.
+	attributesFileName = "attributes.json"
+)
+
+// Plugin is the type for the aws:runChefRecipe plugin.
+type Plugin struct {
+	pluginutil.DefaultPlugin
+}
+
+// ChefPluginInput represents one chef-client run in local mode by the aws:runChefRecipe plugin.
+// CookbooksSource is a S3 or http url to a tar.gz archive. With PolicyName it is an archive made by
+// chef export --archive, otherwise it holds a cookbooks directory and RunList lists the recipes to run.
+type ChefPluginInput struct {
+	contracts.PluginInput
+	ID                      string
+	CookbooksSource         string
+	CookbooksSourceHash     string
+	CookbooksSourceHashType string
+	PolicyName              string
+	PolicyGroup             string
+	RunList                 []string
+	JsonAttributes          map[string]interface{}
+	WhyRun                  bool
+	InstallDependencies     bool
+	WorkingDirectory        string
+	TimeoutSeconds          interface{}
+}
+
+// NewPlugin returns a new instance of the plugin.
+func NewPlugin(pluginConfig pluginutil.PluginConfig) (*Plugin, error) {
+	var plugin Plugin
+	plugin.MaxStdoutLength = pluginConfig.MaxStdoutLength
+	plugin.MaxStderrLength = pluginConfig.MaxStderrLength
+	plugin.StdoutFileName = pluginConfig.StdoutFileName
+	plugin.StderrFileName = pluginConfig.StderrFileName
+	plugin.OutputTruncatedSuffix = pluginConfig.OutputTruncatedSuffix
+	plugin.Uploader = pluginutil.GetS3Config()
+	plugin.ExecuteUploadOutputToS3Bucket = pluginutil.UploadOutputToS3BucketExecuter(plugin.UploadOutputToS3Bucket)
+
+	exec := executers.ShellCommandExecuter{}
+	plugin.ExecuteCommand = pluginutil.CommandExecuter(exec.Execute)
+
+	return &plugin, nil
+}
+
+// Name returns the plugin name
+func Name() string {
+	return appconfig.PluginNameAwsRunChefRecipe
+}
+
+// Execute converges the instance with the cookbooks and returns the outputs of the runs.
+func (p *Plugin) Execute(context context.T, config contracts.Configuration, cancelFlag task.CancelFlag) (res contracts.PluginResult) {
+	log := context.Log()
+	log.Infof("%v started with configuration %v", Name(), config)
+	res.StartDateTime = time.Now()
+	defer func() { res.EndDateTime = time.Now() }()
+
+	var properties []interface{}
+	if properties, res = pluginutil.LoadParametersAsList(log, config.Properties); res.Code != 0 {
+		pluginutil.PersistPluginInformationToCurrent(log, Name(), config, res)
+		return res
+	}
+
+	out := make([]contracts.PluginOutput, len(properties))
+	for i, prop := range properties {
+		if cancelFlag.ShutDown() {
+			out[i] = contracts.PluginOutput{Errors: []string{"Execution canceled due to ShutDown"}}
+			out[i].ExitCode = 1
+			out[i].Status = contracts.ResultStatusFailed
+			break
+		}
+
+		if cancelFlag.Canceled() {
+			out[i] = contracts.PluginOutput{Errors: []string{"Execution canceled"}}
+			out[i].ExitCode = 1
+			out[i].Status = contracts.ResultStatusCancelled
+			break
+		}
+
+		out[i] = p.runChefRawInput(log, prop, config.OrchestrationDirectory, cancelFlag, config.OutputS3BucketName, config.OutputS3KeyPrefix)
+	}
+
+	if len(properties) > 0 {
+		res.Code = out[0].ExitCode
+		res.Status = out[0].Status
+		res.Output = out[0].String()
+	}
+
+	pluginutil.PersistPluginInformationToCurrent(log, Name(), config, res)
+	return res
+}
+
+// runChefRawInput runs chef-client once and returns its output.
+// The input is in the default json unmarshal format (e.g. map[string]interface{}).
+func (p *Plugin) runChefRawInput(log log.T, rawPluginInput interface{}, orchestrationDirectory string, cancelFlag task.CancelFlag, outputS3BucketName string, outputS3KeyPrefix string) (out contracts.PluginOutput) {
+	var pluginInput ChefPluginInput
+	if err := jsonutil.Remarshal(rawPluginInput, &pluginInput); err != nil {
+		errorString := fmt.Sprintf("Invalid format in plugin properties %v;\nerror %v", rawPluginInput, err)
+		out.Errors = append(out.Errors, errorString)
+		out.Status = contracts.ResultStatusFailed
+		log.Error(errorString)
+		return
+	}
+	return p.runChef(log, pluginInput, orchestrationDirectory, cancelFlag, outputS3BucketName, outputS3KeyPrefix)
+}
+
+// runChef downloads the cookbooks, converges the instance with chef-client in local mode and
+// reports the resources it updated in the output.
+func (p *Plugin) runChef(log log.T, pluginInput ChefPluginInput, orchestrationDirectory string, cancelFlag task.CancelFlag, outputS3BucketName string, outputS3KeyPrefix string) (out contracts.PluginOutput) {
+	var err error
+
+	if err = validateInput(pluginInput); err != nil {
+		return pluginutil.MarkAsFailed(log, out, err)
+	}
+
+	// if no orchestration directory specified, create temp directory
+	var useTempDirectory = (orchestrationDirectory == "")
+	var tempDir string
+	if useTempDirectory {
+		if tempDir, err = ioutil.TempDir("", "Ec2RunCommand"); err != nil {
+			return pluginutil.MarkAsFailed(log, out, err)
+		}
+		orchestrationDirectory = tempDir
+	}
+
+	orchestrationDir := filepath.Join(orchestrationDirectory, fileutil.RemoveInvalidChars(pluginInput.ID))
+	if err = fileutil.MakeDirsWithExecuteAccess(orchestrationDir); err != nil {
+		return pluginutil.MarkAsFailed(log, out, err)
+	}
+
+	// fetch the cookbooks, the archive is extracted by the script
+	archivePath, err := downloadCookbooks(log, pluginInput)
+	if err != nil {
+		return pluginutil.MarkAsFailed(log, out, err)
+	}
+
+	reportDir := filepath.Join(orchestrationDir, reportDirName)
+	if err = prepareRun(pluginInput, orchestrationDir, reportDir); err != nil {
+		return pluginutil.MarkAsFailed(log, out, err)
+	}
+
+	scriptPath := filepath.Join(orchestrationDir, pluginutil.RunCommandScriptName)
+	if err = pluginutil.CreateScriptFile(log, scriptPath, buildScript(pluginInput, orchestrationDir, archivePath)); err != nil {
+		return pluginutil.MarkAsFailed(log, out, err)
+	}
+
+	executionTimeout := pluginutil.ValidateExecutionTimeout(log, pluginInput.TimeoutSeconds)
+	stdoutFilePath := filepath.Join(orchestrationDir, p.StdoutFileName)
+	stderrFilePath := filepath.Join(orchestrationDir, p.StderrFileName)
+	commandName := pluginutil.GetShellCommand()
+	commandArguments := append(pluginutil.GetShellArguments(), scriptPath, pluginutil.ExitCodeTrap)
+
+	stdout, stderr, exitCode, errs := p.ExecuteCommand(log, pluginInput.WorkingDirectory, stdoutFilePath, stderrFilePath, cancelFlag, executionTimeout, commandName, commandArguments, executers.ExecuteOptions{Limits: pluginutil.ResourceLimitsFor(Name(), executers.ResourceLimits{})})
+
+	out.ExitCode = exitCode
+	out.Status = pluginutil.GetStatus(out.ExitCode, cancelFlag)
+	for _, err := range errs {
+		out.Errors = append(out.Errors, err.Error())
+		if out.Status != contracts.ResultStatusCancelled && out.Status != contracts.ResultStatusTimedOut {
+			log.Error("failed to run chef-client: ", err)
+			out.Status = contracts.ResultStatusFailed
+		}
+	}
+
+	// the converge report is put before the output, so that it is not lost when the output is truncated
+	if out.Stdout, err = pluginutil.ReadPrefix(stdout, p.MaxStdoutLength, p.OutputTruncatedSuffix); err != nil {
+		out.Errors = append(out.Errors, err.Error())
+	}
+	if report, err := readConvergeReport(reportDir); err == nil {
+		out.Stdout = summarizeConverge(report) + "\n" + out.Stdout
+		if len(out.Stdout) > p.MaxStdoutLength {
+			out.Stdout = out.Stdout[:p.MaxStdoutLength] + p.OutputTruncatedSuffix
+		}
+	} else {
+		log.Debugf("no converge report: %v", err)
+	}
+	if out.Stderr, err = pluginutil.ReadPrefix(stderr, p.MaxStderrLength, p.OutputTruncatedSuffix); err != nil {
+		out.Errors = append(out.Errors, err.Error())
+	}
+
+	uploadOutputToS3BucketErrors := p.ExecuteUploadOutputToS3Bucket(log, pluginInput.ID, orchestrationDir, outputS3BucketName, outputS3KeyPrefix, useTempDirectory, tempDir, out.Stdout, out.Stderr)
+	out.Errors = append(out.Errors, uploadOutputToS3BucketErrors...)
+	return
+}
@@ -0,0 +1,94 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package chef
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var sampleReport = `{
+    "success": false,
+    "elapsed_time": 12.5,
+    "all_resources": [
+        {"json_class": "Chef::Resource::YumPackage", "instance_vars": {"name": "nginx", "declared_type": "package"}},
+        {"json_class": "Chef::Resource::Service", "instance_vars": {"name": "nginx", "resource_name": "service"}},
+        {"json_class": "Chef::Resource::Template", "instance_vars": {"name": "/etc/nginx/nginx.conf"}}
+    ],
+    "updated_resources": [
+        {"json_class": "Chef::Resource::YumPackage", "instance_vars": {"name": "nginx", "declared_type": "package"}},
+        {"json_class": "Chef::Resource::Service", "instance_vars": {"name": "nginx", "resource_name": "service"}}
+    ],
+    "exception": "Chef::Exceptions::FileNotFound: template[/etc/nginx/nginx.conf] not found"
+}`
+
+func TestConvergeReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chef")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = readConvergeReport(dir)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "chef-run-report-20170101000000.json"), []byte("{}"), 0600))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "chef-run-report-20170102000000.json"), []byte(sampleReport), 0600))
+	report, err := readConvergeReport(dir)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "updated: package[nginx]\n"+
+		"updated: service[nginx]\n"+
+		"Converge failed: 2/3 resources updated in 12.5 seconds\n"+
+		"Exception: Chef::Exceptions::FileNotFound: template[/etc/nginx/nginx.conf] not found\n", summarizeConverge(report))
+}
+
+func TestBuildScriptWithPolicy(t *testing.T) {
+	input := ChefPluginInput{CookbooksSource: "s3://bucket/policy.tgz", PolicyName: "web", WhyRun: true}
+	assert.Nil(t, validateInput(input))
+
+	commands := buildScript(input, "/orch", "/downloads/policy.tgz")
+	assert.Equal(t, []string{
+		checkChefCommand,
+		"mkdir -p '/orch/repository' && tar -xzf '/downloads/policy.tgz' -C '/orch/repository' || exit 1",
+		"chef-client --no-color --config '/orch/client.rb' --json-attributes '/orch/attributes.json' --why-run",
+	}, commands)
+
+	config := clientConfig(input, "/orch/repository", "/orch/reports")
+	assert.Contains(t, config, "use_policyfile true\n")
+	assert.Contains(t, config, "policy_name 'web'\npolicy_group 'local'\n")
+	assert.NotContains(t, config, "cookbook_path")
+	assert.Contains(t, config, "report_handlers << Chef::Handler::JsonFile.new(:path => '/orch/reports')\n")
+}
+
+func TestBuildScriptWithRunList(t *testing.T) {
+	input := ChefPluginInput{CookbooksSource: "s3://bucket/cookbooks.tgz", RunList: []string{"recipe[nginx]", "recipe[motd]"}}
+	assert.Nil(t, validateInput(input))
+
+	commands := buildScript(input, "/orch", "/downloads/cookbooks.tgz")
+	assert.Equal(t, "chef-client --no-color --config '/orch/client.rb' --json-attributes '/orch/attributes.json' "+
+		"--override-runlist 'recipe[nginx],recipe[motd]'", commands[2])
+
+	config := clientConfig(input, "/orch/repo's", "/orch/reports")
+	assert.Contains(t, config, `cookbook_path ['/orch/repo\'s/cookbooks']`)
+	assert.NotContains(t, config, "use_policyfile")
+}
+
+func TestValidateInput(t *testing.T) {
+	assert.NotNil(t, validateInput(ChefPluginInput{RunList: []string{"recipe[nginx]"}}))
+	assert.NotNil(t, validateInput(ChefPluginInput{CookbooksSource: "s3://bucket/cookbooks.tgz"}))
+	assert.NotNil(t, validateInput(ChefPluginInput{CookbooksSource: "s3://bucket/cookbooks.tgz", PolicyName: "web", RunList: []string{"recipe[nginx]"}}))
+}
@@ -0,0 +1,203 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package chef implements the aws:runChefRecipe plugin.
+// converge contains the functions preparing the chef-client run and parsing its report.
+package chef
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/jsonutil"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/pluginutil"
+)
+
+// defaultPolicyGroup is the policy group of the archives made by chef export.
+const defaultPolicyGroup = "local"
+
+// installChefCommand installs chef-client with the omnitruck installer when it is missing.
+const installChefCommand = "command -v chef-client >/dev/null 2>&1 || " +
+	"{ curl -fsSL https://omnitruck.chef.io/install.sh | bash -s -- -P chef; } >&2"
+
+// checkChefCommand fails the run when chef-client is not installed.
+const checkChefCommand = "command -v chef-client >/dev/null 2>&1 || " +
+	"{ echo 'chef-client is not installed, set InstallDependencies to install it' >&2; exit 1; }"
+
+// convergeReport is the part of the report written by Chef::Handler::JsonFile used to summarize the run.
+type convergeReport struct {
+	Success          bool             `json:"success"`
+	ElapsedTime      float64          `json:"elapsed_time"`
+	AllResources     []reportResource `json:"all_resources"`
+	UpdatedResources []reportResource `json:"updated_resources"`
+	Exception        string           `json:"exception"`
+}
+
+// reportResource is a resource of the converge report, serialized by chef with its instance variables.
+type reportResource struct {
+	JSONClass    string                 `json:"json_class"`
+	InstanceVars map[string]interface{} `json:"instance_vars"`
+}
+
+// validateInput checks that the input selects either a policy or a run list.
+func validateInput(input ChefPluginInput) error {
+	if strings.TrimSpace(input.CookbooksSource) == "" {
+		return errors.New("CookbooksSource is required")
+	}
+	if (input.PolicyName == "") == (len(input.RunList) == 0) {
+		return errors.New("exactly one of PolicyName or RunList must be specified")
+	}
+	return nil
+}
+
+// downloadCookbooks downloads the cookbooks archive and returns its local path.
+func downloadCookbooks(log log.T, input ChefPluginInput) (archivePath string, err error) {
+	downloadOutput, err := pluginutil.DownloadFileFromSource(log, input.CookbooksSource, input.CookbooksSourceHash, input.CookbooksSourceHashType)
+	if err != nil || !downloadOutput.IsHashMatched || downloadOutput.LocalFilePath == "" {
+		return "", fmt.Errorf("failed to download cookbooks reliably %v", input.CookbooksSource)
+	}
+	return downloadOutput.LocalFilePath, nil
+}
+
+// prepareRun writes the client configuration and the json attributes in the orchestration directory.
+func prepareRun(input ChefPluginInput, orchestrationDir string, reportDir string) (err error) {
+	if err = fileutil.MakeDirs(reportDir); err != nil {
+		return
+	}
+	attributes := input.JsonAttributes
+	if attributes == nil {
+		attributes = map[string]interface{}{}
+	}
+	content, err := jsonutil.Marshal(attributes)
+	if err != nil {
+		return
+	}
+	if err = fileutil.HardenedWriteFile(filepath.Join(orchestrationDir, attributesFileName), []byte(content)); err != nil {
+		return
+	}
+	config := clientConfig(input, filepath.Join(orchestrationDir, repositoryDirName), reportDir)
+	return fileutil.HardenedWriteFile(filepath.Join(orchestrationDir, clientConfigFileName), []byte(config))
+}
+
+// clientConfig returns the chef-client configuration running in local mode from the extracted repository,
+// with the json file handler writing the converge report whether the run succeeds or fails.
+func clientConfig(input ChefPluginInput, repositoryDir string, reportDir string) string {
+	lines := []string{
+		"local_mode true",
+		"chef_repo_path " + rubyQuote(repositoryDir),
+		"file_cache_path " + rubyQuote(filepath.Join(repositoryDir, ".cache")),
+	}
+	if input.PolicyName != "" {
+		policyGroup := input.PolicyGroup
+		if policyGroup == "" {
+			policyGroup = defaultPolicyGroup
+		}
+		lines = append(lines,
+			"use_policyfile true",
+			"policy_document_native_api true",
+			"policy_name "+rubyQuote(input.PolicyName),
+			"policy_group "+rubyQuote(policyGroup))
+	} else {
+		lines = append(lines, "cookbook_path ["+rubyQuote(filepath.Join(repositoryDir, "cookbooks"))+"]")
+	}
+	lines = append(lines,
+		"require 'chef/handler/json_file'",
+		"report_handlers << Chef::Handler::JsonFile.new(:path => "+rubyQuote(reportDir)+")",
+		"exception_handlers << Chef::Handler::JsonFile.new(:path => "+rubyQuote(reportDir)+")")
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// buildScript returns the commands extracting the cookbooks and converging the instance.
+func buildScript(input ChefPluginInput, orchestrationDir string, archivePath string) (commands []string) {
+	if input.InstallDependencies {
+		commands = append(commands, installChefCommand)
+	}
+	commands = append(commands, checkChefCommand)
+
+	repositoryDir := filepath.Join(orchestrationDir, repositoryDirName)
+	commands = append(commands,
+		"mkdir -p "+pluginutil.ShellQuote(repositoryDir)+" && tar -xzf "+pluginutil.ShellQuote(archivePath)+" -C "+pluginutil.ShellQuote(repositoryDir)+" || exit 1")
+
+	run := "chef-client --no-color --config " + pluginutil.ShellQuote(filepath.Join(orchestrationDir, clientConfigFileName)) +
+		" --json-attributes " + pluginutil.ShellQuote(filepath.Join(orchestrationDir, attributesFileName))
+	if input.PolicyName == "" {
+		run += " --override-runlist " + pluginutil.ShellQuote(strings.Join(input.RunList, ","))
+	}
+	if input.WhyRun {
+		run += " --why-run"
+	}
+	return append(commands, run)
+}
+
+// rubyQuote quotes the value as a ruby string literal.
+func rubyQuote(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	return "'" + strings.Replace(value, "'", `\'`, -1) + "'"
+}
+
+// readConvergeReport reads the latest report written by the json file handler.
+func readConvergeReport(reportDir string) (report convergeReport, err error) {
+	reports, err := filepath.Glob(filepath.Join(reportDir, "chef-run-report-*.json"))
+	if err != nil {
+		return
+	}
+	if len(reports) == 0 {
+		return report, errors.New("chef-client did not write a report")
+	}
+	sort.Strings(reports)
+	content, err := ioutil.ReadFile(reports[len(reports)-1])
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(content, &report)
+	return
+}
+
+// summarizeConverge lists the updated resources of the converge report, followed by the totals of the run.
+func summarizeConverge(report convergeReport) string {
+	var summary bytes.Buffer
+	for _, resource := range report.UpdatedResources {
+		fmt.Fprintf(&summary, "updated: %v\n", resource.String())
+	}
+	status := "succeeded"
+	if !report.Success {
+		status = "failed"
+	}
+	fmt.Fprintf(&summary, "Converge %v: %v/%v resources updated in %.1f seconds\n",
+		status, len(report.UpdatedResources), len(report.AllResources), report.ElapsedTime)
+	if report.Exception != "" {
+		fmt.Fprintf(&summary, "Exception: %v\n", report.Exception)
+	}
+	return summary.String()
+}
+
+// String returns the resource as chef prints it, e.g. package[nginx].
+func (r reportResource) String() string {
+	resourceType, _ := r.InstanceVars["declared_type"].(string)
+	if resourceType == "" {
+		resourceType, _ = r.InstanceVars["resource_name"].(string)
+	}
+	if resourceType == "" {
+		resourceType = r.JSONClass
+	}
+	name, _ := r.InstanceVars["name"].(string)
+	return fmt.Sprintf("%v[%v]", resourceType, name)
+}
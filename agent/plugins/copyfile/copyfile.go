@@ -0,0 +1,471 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package copyfile implements the aws:copyFile plugin.
+package copyfile
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/context"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil/artifact"
+	"github.com/aws/amazon-ssm-agent/agent/jsonutil"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/pluginutil"
+	"github.com/aws/amazon-ssm-agent/agent/ssm"
+	"github.com/aws/amazon-ssm-agent/agent/task"
+)
+
+var (
+	download     = artifact.Download
+	getParameter = ssm.GetParameter
+)
+
+const (
+	// backupSuffix is appended to the path of the replaced file to name its backup.
+	backupSuffix = ".bak"
+
+	// defaultMode is the mode of the files written without an explicit mode.
+	defaultMode = os.FileMode(0644)
+
+	// sourceTypeSMB is the source type of the files on network shares.
+	sourceTypeSMB = "smb"
+)
+
+// Plugin is the type for the aws:copyFile plugin.
+type Plugin struct {
+	pluginutil.DefaultPlugin
+}
+
+// CopyFilePluginInput represents one file written by the aws:copyFile plugin.
+// The content is given by exactly one of Content (text), ContentBase64 or Source (S3 or http url).
+// A Source is verified against SourceHash, a sha256 (default), sha512 or md5 hash given by SourceHashType.
+// With SourceType http the Source is downloaded as a plain https file, e.g. from an Artifactory or Nexus server,
+// with the SourceHeaders and the basic or bearer authentication given by SourceAuthType. The password or the token
+// is read from the Parameter Store parameter named by SourceAuthParameter, so that it is not part of the document.
+// With SourceType smb the Source is a UNC path on a network share, accessed with the identity of the agent
+// (the computer account or a gMSA) or on Windows with SourceUsername and the password of SourceAuthParameter.
+// With SourceType git the Source is a git repository fetched over ssh, e.g. git@github.com:org/config.git, and the
+// file is SourcePath read at SourceRef, a branch, a tag or the full id of a commit. SourceAuthParameter names the
+// SecureString parameter holding the deploy key, a secret of Secrets Manager is given by its reference parameter
+// /aws/reference/secretsmanager/<name>. SourceKnownHosts are the known_hosts lines of the server.
+type CopyFilePluginInput struct {
+	contracts.PluginInput
+	ID                  string
+	DestinationPath     string
+	Content             string
+	ContentBase64       string
+	Source              string
+	SourceHash          string
+	SourceHashType      string
+	SourceType          string
+	SourceHeaders       map[string]string
+	SourceAuthType      string
+	SourceUsername      string
+	SourceAuthParameter string
+	SourceRef           string
+	SourcePath          string
+	SourceKnownHosts    string
+	Owner               string
+	Group               string
+	Mode                string
+	Backup              bool
+}
+
+// NewPlugin returns a new instance of the plugin.
+func NewPlugin(pluginConfig pluginutil.PluginConfig) (*Plugin, error) {
+	var plugin Plugin
+	plugin.MaxStdoutLength = pluginConfig.MaxStdoutLength
+	plugin.MaxStderrLength = pluginConfig.MaxStderrLength
+	plugin.StdoutFileName = pluginConfig.StdoutFileName
+	plugin.StderrFileName = pluginConfig.StderrFileName
+	plugin.OutputTruncatedSuffix = pluginConfig.OutputTruncatedSuffix
+	plugin.Uploader = pluginutil.GetS3Config()
+	plugin.ExecuteUploadOutputToS3Bucket = pluginutil.UploadOutputToS3BucketExecuter(plugin.UploadOutputToS3Bucket)
+
+	return &plugin, nil
+}
+
+// Name returns the plugin name
+func Name() string {
+	return appconfig.PluginNameAwsCopyFile
+}
+
+// Execute writes the files and returns the summary of their changes.
+func (p *Plugin) Execute(context context.T, config contracts.Configuration, cancelFlag task.CancelFlag) (res contracts.PluginResult) {
+	log := context.Log()
+	log.Infof("%v started with configuration %v", Name(), config)
+	res.StartDateTime = time.Now()
+	defer func() { res.EndDateTime = time.Now() }()
+
+	var properties []interface{}
+	if properties, res = pluginutil.LoadParametersAsList(log, config.Properties); res.Code != 0 {
+		pluginutil.PersistPluginInformationToCurrent(log, Name(), config, res)
+		return res
+	}
+
+	out := make([]contracts.PluginOutput, len(properties))
+	for i, prop := range properties {
+		if cancelFlag.ShutDown() {
+			out[i] = contracts.PluginOutput{Errors: []string{"Execution canceled due to ShutDown"}}
+			out[i].ExitCode = 1
+			out[i].Status = contracts.ResultStatusFailed
+			break
+		}
+
+		if cancelFlag.Canceled() {
+			out[i] = contracts.PluginOutput{Errors: []string{"Execution canceled"}}
+			out[i].ExitCode = 1
+			out[i].Status = contracts.ResultStatusCancelled
+			break
+		}
+
+		out[i] = p.copyFileRawInput(log, prop, config.OrchestrationDirectory, config.OutputS3BucketName, config.OutputS3KeyPrefix)
+	}
+
+	if len(properties) > 0 {
+		res.Code = out[0].ExitCode
+		res.Status = out[0].Status
+		res.Output = out[0].String()
+	}
+
+	pluginutil.PersistPluginInformationToCurrent(log, Name(), config, res)
+	return res
+}
+
+// copyFileRawInput writes one file and returns its output.
+// The input is in the default json unmarshal format (e.g. map[string]interface{}).
+func (p *Plugin) copyFileRawInput(log log.T, rawPluginInput interface{}, orchestrationDirectory string, outputS3BucketName string, outputS3KeyPrefix string) (out contracts.PluginOutput) {
+	var pluginInput CopyFilePluginInput
+	if err := jsonutil.Remarshal(rawPluginInput, &pluginInput); err != nil {
+		errorString := fmt.Sprintf("Invalid format in plugin properties %v;\nerror %v", rawPluginInput, err)
+		out.Errors = append(out.Errors, errorString)
+		out.Status = contracts.ResultStatusFailed
+		log.Error(errorString)
+		return
+	}
+
+	summary, err := copyFile(log, pluginInput)
+	if err != nil {
+		return pluginutil.MarkAsFailed(log, out, err)
+	}
+	out.ExitCode = 0
+	out.Status = contracts.ResultStatusSuccess
+	out.Stdout = summary
+	if len(out.Stdout) > p.MaxStdoutLength {
+		out.Stdout = out.Stdout[:p.MaxStdoutLength] + p.OutputTruncatedSuffix
+	}
+
+	// the summary is written to the orchestration directory, so that it is uploaded like the output of other plugins
+	if orchestrationDirectory != "" && outputS3BucketName != "" {
+		orchestrationDir := filepath.Join(orchestrationDirectory, fileutil.RemoveInvalidChars(pluginInput.ID))
+		if err = fileutil.MakeDirs(orchestrationDir); err == nil {
+			err = fileutil.WriteAllText(filepath.Join(orchestrationDir, p.StdoutFileName), out.Stdout)
+		}
+		if err != nil {
+			out.Errors = append(out.Errors, err.Error())
+			return
+		}
+		uploadOutputToS3BucketErrors := p.ExecuteUploadOutputToS3Bucket(log, pluginInput.ID, orchestrationDir, outputS3BucketName, outputS3KeyPrefix, false, "", out.Stdout, "")
+		out.Errors = append(out.Errors, uploadOutputToS3BucketErrors...)
+	}
+	return
+}
+
+// copyFile writes the content to the destination, backing up and atomically replacing the existing file,
+// then applies the ownership and mode. It returns the summary of the changes.
+func copyFile(log log.T, input CopyFilePluginInput) (summary string, err error) {
+	if err = validateInput(input); err != nil {
+		return
+	}
+	mode, err := parseMode(input.Mode)
+	if err != nil {
+		return
+	}
+	content, err := readContent(log, input)
+	if err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	destination := input.DestinationPath
+	previous, err := ioutil.ReadFile(destination)
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	switch {
+	case exists && bytes.Equal(previous, content):
+		fmt.Fprintf(&buffer, "%v is up to date\n", destination)
+	default:
+		if err = fileutil.MakeDirs(filepath.Dir(destination)); err != nil {
+			return
+		}
+		if exists && input.Backup {
+			if err = backUp(destination, previous); err != nil {
+				return "", fmt.Errorf("failed to back up %v: %v", destination, err)
+			}
+		}
+		if err = fileutil.WriteFileAtomic(destination, content, mode); err != nil {
+			return
+		}
+		if exists {
+			fmt.Fprintf(&buffer, "%v replaced\n", destination)
+		} else {
+			fmt.Fprintf(&buffer, "%v created\n", destination)
+		}
+		if exists && input.Backup {
+			fmt.Fprintf(&buffer, "backup: %v%v\n", destination, backupSuffix)
+		}
+		buffer.WriteString(diffSummary(previous, content))
+	}
+
+	// ownership and mode are enforced even when the content is up to date
+	if err = os.Chmod(destination, mode); err != nil {
+		return
+	}
+	if err = setOwner(destination, input.Owner, input.Group); err != nil {
+		return
+	}
+	fmt.Fprintf(&buffer, "mode: %04o", mode)
+	if input.Owner != "" || input.Group != "" {
+		fmt.Fprintf(&buffer, ", owner: %v:%v", input.Owner, input.Group)
+	}
+	buffer.WriteString("\n")
+	return buffer.String(), nil
+}
+
+// backUp saves the previous content of the file next to it, with the mode and ownership of the file.
+func backUp(path string, previous []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	backupPath := path + backupSuffix
+	if err = fileutil.WriteFileAtomic(backupPath, previous, info.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return err
+	}
+	return copyOwner(backupPath, info)
+}
+
+// validateInput checks the destination and that the content is given exactly once.
+func validateInput(input CopyFilePluginInput) error {
+	if input.DestinationPath == "" || !filepath.IsAbs(input.DestinationPath) {
+		return errors.New("DestinationPath must be an absolute path")
+	}
+	sources := 0
+	for _, source := range []string{input.Content, input.ContentBase64, input.Source} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return errors.New("only one of Content, ContentBase64 or Source can be specified")
+	}
+	switch strings.ToLower(input.SourceHashType) {
+	case "", "sha256", "sha512", "md5":
+	default:
+		return fmt.Errorf("unsupported SourceHashType %v, expected one of sha256, sha512, md5", input.SourceHashType)
+	}
+	if err := validateSourceType(input); err != nil {
+		return err
+	}
+	if !ownershipSupported && (input.Owner != "" || input.Group != "") {
+		return errors.New("Owner and Group are not supported on this platform")
+	}
+	return nil
+}
+
+// validateSourceType checks the headers and the authentication are only given for https sources,
+// and the credentials of network shares for UNC sources.
+func validateSourceType(input CopyFilePluginInput) error {
+	if !strings.EqualFold(input.SourceType, artifact.SourceTypeGit) && (input.SourceRef != "" || input.SourcePath != "" || input.SourceKnownHosts != "") {
+		return errors.New("SourceRef, SourcePath and SourceKnownHosts require SourceType git")
+	}
+	switch strings.ToLower(input.SourceType) {
+	case "":
+		if len(input.SourceHeaders) > 0 || input.SourceAuthType != "" || input.SourceAuthParameter != "" {
+			return errors.New("SourceHeaders, SourceAuthType and SourceAuthParameter require a SourceType")
+		}
+		return nil
+	case artifact.SourceTypeHTTP:
+	case sourceTypeSMB:
+		return validateShareSource(input)
+	case artifact.SourceTypeGit:
+		return validateGitSource(input)
+	default:
+		return fmt.Errorf("unsupported SourceType %v, expected one of http, smb, git", input.SourceType)
+	}
+	if input.Source == "" {
+		return errors.New("SourceType requires a Source")
+	}
+	switch strings.ToLower(input.SourceAuthType) {
+	case "":
+		return nil
+	case artifact.AuthTypeBasic:
+		if input.SourceUsername == "" {
+			return errors.New("SourceAuthType basic requires a SourceUsername")
+		}
+	case artifact.AuthTypeBearer:
+	default:
+		return fmt.Errorf("unsupported SourceAuthType %v, expected one of basic, bearer", input.SourceAuthType)
+	}
+	if input.SourceAuthParameter == "" {
+		return errors.New("SourceAuthType requires a SourceAuthParameter")
+	}
+	if !strings.HasPrefix(strings.ToLower(input.Source), "https://") {
+		return errors.New("credentials are only sent to https sources")
+	}
+	return nil
+}
+
+// validateShareSource checks the source is a UNC path, accessed with the identity of the agent
+// or with both a SourceUsername and the SourceAuthParameter holding the password.
+func validateShareSource(input CopyFilePluginInput) error {
+	if !artifact.IsUNCPath(input.Source) {
+		return errors.New(`SourceType smb requires a UNC Source, e.g. \\server\share\file`)
+	}
+	if len(input.SourceHeaders) > 0 || input.SourceAuthType != "" {
+		return errors.New("SourceHeaders and SourceAuthType are not supported with SourceType smb")
+	}
+	if (input.SourceUsername == "") != (input.SourceAuthParameter == "") {
+		return errors.New("SourceType smb requires both SourceUsername and SourceAuthParameter, or neither")
+	}
+	return nil
+}
+
+// validateGitSource checks the source is a repository fetched over ssh, authenticated with the deploy key of the
+// SourceAuthParameter if given, and that the file is given by its path in the repository.
+func validateGitSource(input CopyFilePluginInput) error {
+	if !isSSHRepository(input.Source) {
+		return errors.New("SourceType git requires a ssh Source, e.g. ssh://git@github.com/org/repo.git or git@github.com:org/repo.git")
+	}
+	if strings.Trim(input.SourcePath, "/") == "" {
+		return errors.New("SourceType git requires the SourcePath of the file in the repository")
+	}
+	if len(input.SourceHeaders) > 0 || input.SourceAuthType != "" || input.SourceUsername != "" {
+		return errors.New("SourceHeaders, SourceAuthType and SourceUsername are not supported with SourceType git")
+	}
+	if strings.HasPrefix(input.SourceRef, "-") {
+		return fmt.Errorf("invalid SourceRef %v", input.SourceRef)
+	}
+	return nil
+}
+
+// isSSHRepository returns true if the url of the repository is a ssh url, or the scp-like user@host:path syntax of git.
+func isSSHRepository(source string) bool {
+	if strings.HasPrefix(source, "-") {
+		return false
+	}
+	if strings.HasPrefix(strings.ToLower(source), "ssh://") {
+		return true
+	}
+	at := strings.Index(source, "@")
+	colon := strings.Index(source, ":")
+	return at > 0 && colon > at+1 && colon < len(source)-1 && !strings.ContainsAny(source[:colon], "/ ")
+}
+
+// parseMode parses the octal mode of the file, e.g. 0640.
+func parseMode(mode string) (os.FileMode, error) {
+	if mode == "" {
+		return defaultMode, nil
+	}
+	value, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || value > 0777 {
+		return 0, fmt.Errorf("invalid file mode %v, expected an octal mode such as 0644", mode)
+	}
+	return os.FileMode(value), nil
+}
+
+// readContent returns the content of the file from the inline text, the base64 text or the source.
+// Without any of them the file is empty.
+func readContent(log log.T, input CopyFilePluginInput) ([]byte, error) {
+	switch {
+	case input.ContentBase64 != "":
+		content, err := base64.StdEncoding.DecodeString(strings.TrimSpace(input.ContentBase64))
+		if err != nil {
+			return nil, fmt.Errorf("ContentBase64 is not valid base64: %v", err)
+		}
+		return content, nil
+	case input.Source != "":
+		downloadInput, err := sourceDownloadInput(log, input)
+		if err != nil {
+			return nil, err
+		}
+		downloadOutput, err := download(log, downloadInput)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download file reliably %v: %v", input.Source, err)
+		}
+		if !downloadOutput.IsHashMatched || downloadOutput.LocalFilePath == "" {
+			return nil, fmt.Errorf("failed to download file reliably %v", input.Source)
+		}
+		return ioutil.ReadFile(downloadOutput.LocalFilePath)
+	default:
+		return []byte(input.Content), nil
+	}
+}
+
+// sourceDownloadInput returns the download of the source, with the credentials read from Parameter Store.
+func sourceDownloadInput(log log.T, input CopyFilePluginInput) (downloadInput artifact.DownloadInput, err error) {
+	downloadInput = artifact.DownloadInput{
+		SourceURL:       input.Source,
+		SourceHashValue: input.SourceHash,
+		SourceHashType:  input.SourceHashType,
+		SourceType:      input.SourceType,
+		Headers:         input.SourceHeaders,
+	}
+	if strings.EqualFold(input.SourceType, artifact.SourceTypeGit) {
+		downloadInput.Git = &artifact.GitSource{
+			Ref:        input.SourceRef,
+			Path:       input.SourcePath,
+			KnownHosts: input.SourceKnownHosts,
+		}
+	}
+	if input.SourceAuthParameter == "" {
+		return
+	}
+	secret, err := getParameter(log, input.SourceAuthParameter)
+	if err != nil {
+		return downloadInput, fmt.Errorf("failed to read the credentials of %v: %v", input.Source, err)
+	}
+	if downloadInput.Git != nil {
+		downloadInput.Git.PrivateKey = secret
+		return
+	}
+	if strings.EqualFold(input.SourceType, sourceTypeSMB) {
+		downloadInput.ShareAuth = &artifact.ShareAuth{
+			Username: input.SourceUsername,
+			Password: secret,
+		}
+		return
+	}
+	downloadInput.Auth = &artifact.HTTPAuth{
+		Type:     input.SourceAuthType,
+		Username: input.SourceUsername,
+		Secret:   secret,
+	}
+	return
+}
@@ -0,0 +1,210 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package copyfile
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/fileutil/artifact"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "copyfile")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	logger := log.NewMockLog()
+	destination := filepath.Join(dir, "etc", "app.conf")
+
+	// the file and its directory are created
+	summary, err := copyFile(logger, CopyFilePluginInput{DestinationPath: destination, Content: "a\nb\nc\n", Mode: "0600"})
+	assert.Nil(t, err)
+	assert.Equal(t, destination+" created\n3 lines added, 0 lines removed\n"+
+		"sha256: e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855 -> 880553fca8fcea94e325ee2cfb48e5a985cc797f39a14cc6d3cedecfeb2ae4d2\n"+
+		"mode: 0600\n", summary)
+	info, err := os.Stat(destination)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// the replaced file is backed up
+	content := base64.StdEncoding.EncodeToString([]byte("a\nB\nc\n"))
+	summary, err = copyFile(logger, CopyFilePluginInput{DestinationPath: destination, ContentBase64: content, Backup: true})
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(summary, destination+" replaced\nbackup: "+destination+".bak\n1 lines added, 1 lines removed\nsha256: "))
+	assert.NotContains(t, summary, "B")
+	backup, err := ioutil.ReadFile(destination + backupSuffix)
+	assert.Nil(t, err)
+	assert.Equal(t, "a\nb\nc\n", string(backup))
+	info, err = os.Stat(destination + backupSuffix)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// an identical file is left untouched
+	summary, err = copyFile(logger, CopyFilePluginInput{DestinationPath: destination, Content: "a\nB\nc\n"})
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(summary, destination+" is up to date\n"))
+}
+
+func TestValidateInput(t *testing.T) {
+	assert.NotNil(t, validateInput(CopyFilePluginInput{DestinationPath: "relative/app.conf", Content: "a"}))
+	assert.NotNil(t, validateInput(CopyFilePluginInput{DestinationPath: "/etc/app.conf", Content: "a", Source: "s3://bucket/app.conf"}))
+	assert.NotNil(t, validateInput(CopyFilePluginInput{DestinationPath: "/etc/app.conf", Source: "s3://bucket/app.conf", SourceHashType: "crc32"}))
+	assert.Nil(t, validateInput(CopyFilePluginInput{DestinationPath: "/etc/app.conf", Source: "s3://bucket/app.conf", SourceHashType: "SHA512"}))
+
+	_, err := parseMode("0999")
+	assert.NotNil(t, err)
+	mode, err := parseMode("640")
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0640), mode)
+}
+
+func TestDiffSummary(t *testing.T) {
+	assert.Equal(t, "binary content changed (2 bytes -> 3 bytes)\n", changeCounts([]byte{0, 1}, []byte{0, 1, 2}))
+	assert.Equal(t, "1 lines added, 1 lines removed\n"+
+		"sha256: 911169ddaaf146aff539f58c26c489af3b892dff0fe283c1c264c65ae5aa59a2 -> b72cf6d7918130f75347ff0f8b6e9fde004ee6d7fc26af90a349707207f72750\n",
+		diffSummary([]byte("a\nb\n"), []byte("a\nc\n")))
+	assert.NotContains(t, diffSummary([]byte("password=old\n"), []byte("password=new\n")), "password")
+	assert.Equal(t, []string{"-b", "+x", "+d"}, diffLines([]string{"a", "b", "c"}, []string{"a", "x", "c", "d"}))
+	assert.Nil(t, diffLines([]string{"a"}, []string{"a"}))
+}
+
+func TestValidateSourceType(t *testing.T) {
+	https := CopyFilePluginInput{DestinationPath: "/etc/app.conf", Source: "https://repo.example.com/app.conf", SourceType: "http"}
+	assert.Nil(t, validateInput(https))
+
+	for _, invalid := range []CopyFilePluginInput{
+		{SourceType: "git"},
+		{SourceHeaders: map[string]string{"X-Api-Key": "key"}},
+		{SourceAuthType: "basic", SourceUsername: "deploy", SourceAuthParameter: "/repo/password"},
+		{SourceType: "http", SourceAuthType: "basic", SourceAuthParameter: "/repo/password"},
+		{SourceType: "http", SourceAuthType: "bearer"},
+		{SourceType: "http", SourceAuthType: "digest", SourceAuthParameter: "/repo/password"},
+	} {
+		invalid.DestinationPath = https.DestinationPath
+		invalid.Source = https.Source
+		assert.NotNil(t, validateInput(invalid), "%v", invalid)
+	}
+
+	// credentials are not sent in clear text
+	plain := https
+	plain.Source = "http://repo.example.com/app.conf"
+	plain.SourceAuthType = "bearer"
+	plain.SourceAuthParameter = "/repo/token"
+	assert.NotNil(t, validateInput(plain))
+
+	share := CopyFilePluginInput{DestinationPath: "/etc/app.conf", Source: `\\fs01\config\app.conf`, SourceType: "smb"}
+	assert.Nil(t, validateInput(share))
+	share.SourceUsername = `CORP\deploy`
+	assert.NotNil(t, validateInput(share))
+	share.SourceAuthParameter = "/fs01/password"
+	assert.Nil(t, validateInput(share))
+	share.Source = "https://repo.example.com/app.conf"
+	assert.NotNil(t, validateInput(share))
+
+	git := CopyFilePluginInput{DestinationPath: "/etc/app.conf", Source: "git@github.com:org/config.git", SourceType: "git", SourcePath: "app.conf"}
+	assert.Nil(t, validateInput(git))
+	git.Source = "ssh://git@github.com/org/config.git"
+	git.SourceRef = "v1.2"
+	git.SourceAuthParameter = "/config/deploy-key"
+	assert.Nil(t, validateInput(git))
+	for _, invalid := range []CopyFilePluginInput{
+		{Source: "https://github.com/org/config.git"},
+		{Source: "-oProxyCommand=x@y:z"},
+		{SourcePath: "/"},
+		{SourceRef: "--upload-pack=x"},
+		{SourceAuthType: "basic"},
+		{SourceType: "http"},
+	} {
+		mixed := git
+		if invalid.Source != "" {
+			mixed.Source = invalid.Source
+		}
+		if invalid.SourcePath != "" {
+			mixed.SourcePath = invalid.SourcePath
+		}
+		if invalid.SourceRef != "" {
+			mixed.SourceRef = invalid.SourceRef
+		}
+		if invalid.SourceType != "" {
+			mixed.SourceType = invalid.SourceType
+		}
+		mixed.SourceAuthType = invalid.SourceAuthType
+		assert.NotNil(t, validateInput(mixed), "%v", invalid)
+	}
+}
+
+func TestSourceDownloadInput(t *testing.T) {
+	logger := log.NewMockLog()
+	original := getParameter
+	defer func() { getParameter = original }()
+	getParameter = func(log log.T, name string) (string, error) {
+		if name == "/repo/password" {
+			return "secret", nil
+		}
+		return "", errors.New("parameter not found")
+	}
+
+	input := CopyFilePluginInput{
+		Source:              "https://repo.example.com/app.conf",
+		SourceType:          "http",
+		SourceHeaders:       map[string]string{"X-Client": "ssm"},
+		SourceAuthType:      "basic",
+		SourceUsername:      "deploy",
+		SourceAuthParameter: "/repo/password",
+	}
+	downloadInput, err := sourceDownloadInput(logger, input)
+	assert.Nil(t, err)
+	assert.Equal(t, artifact.DownloadInput{
+		SourceURL:  input.Source,
+		SourceType: "http",
+		Headers:    input.SourceHeaders,
+		Auth:       &artifact.HTTPAuth{Type: "basic", Username: "deploy", Secret: "secret"},
+	}, downloadInput)
+
+	input.SourceAuthParameter = "/repo/missing"
+	_, err = sourceDownloadInput(logger, input)
+	assert.NotNil(t, err)
+
+	share := CopyFilePluginInput{
+		Source:              `\\fs01\config\app.conf`,
+		SourceType:          "smb",
+		SourceUsername:      `CORP\deploy`,
+		SourceAuthParameter: "/repo/password",
+	}
+	downloadInput, err = sourceDownloadInput(logger, share)
+	assert.Nil(t, err)
+	assert.Nil(t, downloadInput.Auth)
+	assert.Equal(t, &artifact.ShareAuth{Username: `CORP\deploy`, Password: "secret"}, downloadInput.ShareAuth)
+
+	// the deploy key is read at run time and only handed to the download
+	git := CopyFilePluginInput{
+		Source:              "git@github.com:org/config.git",
+		SourceType:          "git",
+		SourceRef:           "main",
+		SourcePath:          "app.conf",
+		SourceKnownHosts:    "github.com ssh-ed25519 AAAA",
+		SourceAuthParameter: "/repo/password",
+	}
+	downloadInput, err = sourceDownloadInput(logger, git)
+	assert.Nil(t, err)
+	assert.Nil(t, downloadInput.Auth)
+	assert.Equal(t, &artifact.GitSource{Ref: "main", Path: "app.conf", PrivateKey: "secret", KnownHosts: git.SourceKnownHosts}, downloadInput.Git)
+}
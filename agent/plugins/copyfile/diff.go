@@ -0,0 +1,101 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package copyfile implements the aws:copyFile plugin.
+// diff contains the functions summarizing the changes made to a file.
+package copyfile
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// maxDiffCells bounds the size of the table used to compute the diff, larger files are only counted.
+const maxDiffCells = 4000000
+
+// diffSummary returns the number of lines added and removed between the two contents, followed by their
+// sha256 hashes. The changed lines are not listed since the file may hold secrets. Binary contents are only
+// compared by size.
+func diffSummary(previous []byte, content []byte) string {
+	return changeCounts(previous, content) + fmt.Sprintf("sha256: %x -> %x\n", sha256.Sum256(previous), sha256.Sum256(content))
+}
+
+// changeCounts returns the number of lines added and removed between the two contents.
+func changeCounts(previous []byte, content []byte) string {
+	if bytes.IndexByte(previous, 0) >= 0 || bytes.IndexByte(content, 0) >= 0 {
+		return fmt.Sprintf("binary content changed (%v bytes -> %v bytes)\n", len(previous), len(content))
+	}
+	oldLines := splitLines(previous)
+	newLines := splitLines(content)
+	if len(oldLines)*len(newLines) > maxDiffCells {
+		return fmt.Sprintf("content changed (%v lines -> %v lines)\n", len(oldLines), len(newLines))
+	}
+
+	changes := diffLines(oldLines, newLines)
+	added, removed := 0, 0
+	for _, change := range changes {
+		if strings.HasPrefix(change, "+") {
+			added++
+		} else {
+			removed++
+		}
+	}
+	return fmt.Sprintf("%v lines added, %v lines removed\n", added, removed)
+}
+
+// diffLines returns the lines removed (prefixed with -) and added (prefixed with +) to turn
+// oldLines into newLines, based on their longest common subsequence.
+func diffLines(oldLines []string, newLines []string) (changes []string) {
+	// common[i][j] is the length of the longest common subsequence of oldLines[i:] and newLines[j:]
+	common := make([][]int, len(oldLines)+1)
+	for i := range common {
+		common[i] = make([]int, len(newLines)+1)
+	}
+	for i := len(oldLines) - 1; i >= 0; i-- {
+		for j := len(newLines) - 1; j >= 0; j-- {
+			if oldLines[i] == newLines[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(oldLines) || j < len(newLines) {
+		switch {
+		case i < len(oldLines) && j < len(newLines) && oldLines[i] == newLines[j]:
+			i++
+			j++
+		case i < len(oldLines) && (j == len(newLines) || common[i+1][j] >= common[i][j+1]):
+			changes = append(changes, "-"+oldLines[i])
+			i++
+		default:
+			changes = append(changes, "+"+newLines[j])
+			j++
+		}
+	}
+	return
+}
+
+// splitLines splits the content in lines, without the trailing empty line of a terminated file.
+func splitLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}
@@ -0,0 +1,32 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build windows
+
+// Package copyfile implements the aws:copyFile plugin.
+package copyfile
+
+import "os"
+
+// ownershipSupported is false on windows, the files inherit the permissions of their directory.
+const ownershipSupported = false
+
+// setOwner does nothing on windows, the input is validated before any file is written.
+func setOwner(path string, owner string, group string) error {
+	return nil
+}
+
+// copyOwner does nothing on windows, the backup inherits the permissions of the directory of the file.
+func copyOwner(path string, info os.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,278 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package debuglogs implements the aws:captureDebugLogs plugin. The plugin raises the verbosity of the agent logs
+// for a few minutes, then uploads the captured logs and a diagnostics snapshot to the output S3 bucket of the command,
+// so that support cases do not require interactive access to the instance.
+package debuglogs
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/agenterror"
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/context"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/jsonutil"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/platform"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/pluginutil"
+	"github.com/aws/amazon-ssm-agent/agent/task"
+	"github.com/aws/amazon-ssm-agent/agent/version"
+)
+
+const (
+	// defaultDurationMinutes is how long the logs are captured when the document does not say.
+	defaultDurationMinutes = 10
+
+	// maxDurationMinutes bounds the time the agent runs with verbose logs.
+	maxDurationMinutes = 60
+
+	// defaultLogLevel is the level of the captured logs when the document does not say.
+	defaultLogLevel = "debug"
+
+	// LogFileName is the name of the captured logs in the bundle.
+	LogFileName = "debug.log"
+
+	// DiagnosticsFileName is the name of the diagnostics snapshot in the bundle.
+	DiagnosticsFileName = "diagnostics.json"
+)
+
+// Plugin is the type for the aws:captureDebugLogs plugin.
+type Plugin struct {
+	pluginutil.DefaultPlugin
+}
+
+// CaptureDebugLogsPluginInput represents one capture of the debug logs.
+type CaptureDebugLogsPluginInput struct {
+	contracts.PluginInput
+	ID              string
+	DurationMinutes interface{}
+	LogLevel        string
+}
+
+// Diagnostics is the snapshot of the state of the agent uploaded with the captured logs.
+type Diagnostics struct {
+	Time            string                  `json:"time"`
+	AgentVersion    string                  `json:"agentVersion"`
+	InstanceID      string                  `json:"instanceId"`
+	Region          string                  `json:"region"`
+	PlatformName    string                  `json:"platformName"`
+	PlatformVersion string                  `json:"platformVersion"`
+	OS              string                  `json:"os"`
+	Arch            string                  `json:"arch"`
+	GoVersion       string                  `json:"goVersion"`
+	Goroutines      int                     `json:"goroutines"`
+	HeapAllocBytes  uint64                  `json:"heapAllocBytes"`
+	ErrorCounts     map[agenterror.Code]int `json:"errorCounts"`
+}
+
+var (
+	// startCapture and stopCapture raise and revert the verbosity of the agent logs.
+	startCapture = log.StartCapture
+	stopCapture  = log.StopCapture
+
+	// waitFor waits for the given delay and returns false if the command got canceled meanwhile.
+	waitFor = task.WaitFor
+)
+
+// NewPlugin returns a new instance of the plugin.
+func NewPlugin(pluginConfig pluginutil.PluginConfig) (*Plugin, error) {
+	var plugin Plugin
+	plugin.MaxStdoutLength = pluginConfig.MaxStdoutLength
+	plugin.MaxStderrLength = pluginConfig.MaxStderrLength
+	plugin.StdoutFileName = pluginConfig.StdoutFileName
+	plugin.StderrFileName = pluginConfig.StderrFileName
+	plugin.OutputTruncatedSuffix = pluginConfig.OutputTruncatedSuffix
+	plugin.Uploader = pluginutil.GetS3Config()
+	plugin.ExecuteUploadArtifactsToS3Bucket = pluginutil.UploadArtifactsToS3BucketExecuter(plugin.UploadArtifactsToS3Bucket)
+
+	return &plugin, nil
+}
+
+// Name returns the plugin name
+func Name() string {
+	return appconfig.PluginNameAwsCaptureDebugLogs
+}
+
+// Execute captures the debug logs of the agent and uploads them with a diagnostics snapshot.
+func (p *Plugin) Execute(context context.T, config contracts.Configuration, cancelFlag task.CancelFlag) (res contracts.PluginResult) {
+	log := context.Log()
+	log.Infof("%v started with configuration %v", Name(), config)
+	res.StartDateTime = time.Now()
+	defer func() { res.EndDateTime = time.Now() }()
+
+	var properties []interface{}
+	if properties, res = pluginutil.LoadParametersAsList(log, config.Properties); res.Code != 0 {
+		pluginutil.PersistPluginInformationToCurrent(log, Name(), config, res)
+		return res
+	}
+
+	out := make([]contracts.PluginOutput, len(properties))
+	for i, prop := range properties {
+		if cancelFlag.ShutDown() {
+			out[i] = contracts.PluginOutput{Errors: []string{"Execution canceled due to ShutDown"}}
+			out[i].ExitCode = 1
+			out[i].Status = contracts.ResultStatusFailed
+			break
+		}
+
+		if cancelFlag.Canceled() {
+			out[i] = contracts.PluginOutput{Errors: []string{"Execution canceled"}}
+			out[i].ExitCode = 1
+			out[i].Status = contracts.ResultStatusCancelled
+			break
+		}
+
+		out[i] = p.captureRawInput(log, prop, config.OrchestrationDirectory, cancelFlag, config.OutputS3BucketName, config.OutputS3KeyPrefix)
+	}
+
+	if len(properties) > 0 {
+		res.Code = out[0].ExitCode
+		res.Status = out[0].Status
+		res.Output = out[0].String()
+	}
+
+	pluginutil.PersistPluginInformationToCurrent(log, Name(), config, res)
+	return res
+}
+
+// captureRawInput captures the debug logs once and returns the output.
+// The input is in the default json unmarshal format (e.g. map[string]interface{}).
+func (p *Plugin) captureRawInput(log log.T, rawPluginInput interface{}, orchestrationDirectory string, cancelFlag task.CancelFlag, outputS3BucketName string, outputS3KeyPrefix string) (out contracts.PluginOutput) {
+	var pluginInput CaptureDebugLogsPluginInput
+	if err := jsonutil.Remarshal(rawPluginInput, &pluginInput); err != nil {
+		errorString := fmt.Sprintf("Invalid format in plugin properties %v;\nerror %v", rawPluginInput, err)
+		out.Errors = append(out.Errors, errorString)
+		out.Status = contracts.ResultStatusFailed
+		log.Error(errorString)
+		return
+	}
+	return p.capture(log, pluginInput, orchestrationDirectory, cancelFlag, outputS3BucketName, outputS3KeyPrefix)
+}
+
+// capture raises the verbosity of the agent logs for the duration of the input, then writes the diagnostics
+// snapshot next to the captured logs and uploads the bundle. A canceled capture uploads the logs captured so far.
+func (p *Plugin) capture(log log.T, pluginInput CaptureDebugLogsPluginInput, orchestrationDirectory string, cancelFlag task.CancelFlag, outputS3BucketName string, outputS3KeyPrefix string) (out contracts.PluginOutput) {
+	duration, level, err := parseInput(pluginInput)
+	if err == nil && outputS3BucketName == "" {
+		err = fmt.Errorf("an output S3 bucket is required to upload the debug logs")
+	}
+	if err == nil && orchestrationDirectory == "" {
+		err = fmt.Errorf("no orchestration directory to write the debug logs to")
+	}
+	if err != nil {
+		return pluginutil.MarkAsFailed(log, out, err)
+	}
+
+	bundleDir := filepath.Join(orchestrationDirectory, fileutil.RemoveInvalidChars(pluginInput.ID))
+	if err = fileutil.MakeDirs(bundleDir); err != nil {
+		return pluginutil.MarkAsFailed(log, out, err)
+	}
+	if err = startCapture(filepath.Join(bundleDir, LogFileName), level); err != nil {
+		return pluginutil.MarkAsFailed(log, out, fmt.Errorf("failed to raise the log verbosity: %v", err))
+	}
+	log.Infof("capturing %v logs for %v", level, duration)
+	completed := waitFor(duration, cancelFlag)
+	stopCapture()
+	log.Infof("log verbosity reverted")
+
+	content, err := jsonutil.Marshal(collectDiagnostics(log))
+	if err == nil {
+		err = fileutil.WriteAllText(filepath.Join(bundleDir, DiagnosticsFileName), jsonutil.Indent(content))
+	}
+	if err != nil {
+		out.Errors = append(out.Errors, fmt.Sprintf("failed to write the diagnostics: %v", err))
+	}
+
+	var uploadErrors []string
+	out.Artifacts, uploadErrors = p.ExecuteUploadArtifactsToS3Bucket(log, pluginInput.ID, bundleDir, []string{LogFileName, DiagnosticsFileName}, outputS3BucketName, outputS3KeyPrefix)
+	out.Errors = append(out.Errors, uploadErrors...)
+
+	switch {
+	case !completed:
+		out.ExitCode = 1
+		out.Status = contracts.ResultStatusCancelled
+		out.Stdout = fmt.Sprintf("capture of the %v logs canceled, the logs captured so far were uploaded", level)
+	case len(out.Artifacts) == 0:
+		out.ExitCode = 1
+		out.Status = contracts.ResultStatusFailed
+	default:
+		out.ExitCode = 0
+		out.Status = contracts.ResultStatusSuccess
+		out.Stdout = fmt.Sprintf("captured the %v logs for %v", level, duration)
+	}
+	return
+}
+
+// parseInput returns the duration and the level of the capture, with their defaults.
+func parseInput(pluginInput CaptureDebugLogsPluginInput) (duration time.Duration, level string, err error) {
+	minutes := defaultDurationMinutes
+	switch value := pluginInput.DurationMinutes.(type) {
+	case nil:
+	case float64:
+		minutes = int(value)
+		if value != float64(minutes) {
+			return 0, "", fmt.Errorf("DurationMinutes %v is not an integer", value)
+		}
+	case string:
+		if strings.TrimSpace(value) != "" {
+			if minutes, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return 0, "", fmt.Errorf("invalid DurationMinutes %v", value)
+			}
+		}
+	default:
+		return 0, "", fmt.Errorf("invalid DurationMinutes %v", value)
+	}
+	if minutes < 1 || minutes > maxDurationMinutes {
+		return 0, "", fmt.Errorf("DurationMinutes %v is not between 1 and %v", minutes, maxDurationMinutes)
+	}
+
+	level = strings.ToLower(strings.TrimSpace(pluginInput.LogLevel))
+	switch level {
+	case "":
+		level = defaultLogLevel
+	case "trace", "debug":
+	default:
+		return 0, "", fmt.Errorf("unsupported LogLevel %v, expected trace or debug", pluginInput.LogLevel)
+	}
+	return time.Duration(minutes) * time.Minute, level, nil
+}
+
+// collectDiagnostics returns the snapshot of the state of the agent, the values which cannot be read are left empty.
+var collectDiagnostics = func(log log.T) (diagnostics Diagnostics) {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	diagnostics = Diagnostics{
+		Time:           time.Now().UTC().Format(time.RFC3339),
+		AgentVersion:   version.Version,
+		OS:             runtime.GOOS,
+		Arch:           runtime.GOARCH,
+		GoVersion:      runtime.Version(),
+		Goroutines:     runtime.NumGoroutine(),
+		HeapAllocBytes: memStats.HeapAlloc,
+		ErrorCounts:    agenterror.Counts(),
+	}
+	diagnostics.InstanceID, _ = platform.InstanceID()
+	diagnostics.Region, _ = platform.Region()
+	diagnostics.PlatformName, _ = platform.PlatformName(log)
+	diagnostics.PlatformVersion, _ = platform.PlatformVersion(log)
+	return
+}
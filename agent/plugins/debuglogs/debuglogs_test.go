@@ -0,0 +1,135 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package debuglogs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/jsonutil"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/task"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubCapture replaces the log capture, the wait and the diagnostics, the wait returns the given result.
+func stubCapture(completed bool) (captured *[]string, restore func()) {
+	captured = &[]string{}
+	originalStart, originalStop, originalWait, originalDiagnostics := startCapture, stopCapture, waitFor, collectDiagnostics
+	startCapture = func(filePath string, minLevel string) error {
+		*captured = append(*captured, minLevel)
+		return ioutil.WriteFile(filePath, []byte("captured"), 0600)
+	}
+	stopCapture = func() { *captured = append(*captured, "stopped") }
+	waitFor = func(delay time.Duration, cancelFlag task.CancelFlag) bool {
+		*captured = append(*captured, delay.String())
+		return completed
+	}
+	collectDiagnostics = func(log log.T) Diagnostics { return Diagnostics{AgentVersion: "1.2.0.0"} }
+	return captured, func() {
+		startCapture, stopCapture, waitFor, collectDiagnostics = originalStart, originalStop, originalWait, originalDiagnostics
+	}
+}
+
+// newTestPlugin returns a plugin recording the files it uploads.
+func newTestPlugin(uploaded *[]string) *Plugin {
+	p := &Plugin{}
+	p.ExecuteUploadArtifactsToS3Bucket = func(log log.T, pluginID string, baseDir string, artifactPatterns []string, outputS3BucketName string, outputS3KeyPrefix string) (destinations []string, errs []string) {
+		for _, pattern := range artifactPatterns {
+			if _, err := os.Stat(filepath.Join(baseDir, pattern)); err == nil {
+				*uploaded = append(*uploaded, pattern)
+				destinations = append(destinations, "s3://"+outputS3BucketName+"/"+pattern)
+			}
+		}
+		return
+	}
+	return p
+}
+
+func TestCapture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debuglogs")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	captured, restore := stubCapture(true)
+	defer restore()
+	var uploaded []string
+	p := newTestPlugin(&uploaded)
+
+	out := p.capture(log.NewMockLog(), CaptureDebugLogsPluginInput{ID: "0.aws:captureDebugLogs", DurationMinutes: "5", LogLevel: "Trace"},
+		dir, task.NewChanneledCancelFlag(), "bucket", "prefix")
+	assert.Equal(t, contracts.ResultStatusSuccess, out.Status, "%v", out.Errors)
+	assert.Equal(t, []string{"trace", "5m0s", "stopped"}, *captured)
+	assert.Equal(t, []string{LogFileName, DiagnosticsFileName}, uploaded)
+	assert.Equal(t, []string{"s3://bucket/" + LogFileName, "s3://bucket/" + DiagnosticsFileName}, out.Artifacts)
+
+	var diagnostics Diagnostics
+	assert.Nil(t, jsonutil.UnmarshalFile(filepath.Join(dir, fileutil.RemoveInvalidChars("0.aws:captureDebugLogs"), DiagnosticsFileName), &diagnostics))
+	assert.NotEmpty(t, diagnostics.AgentVersion)
+}
+
+func TestCaptureCanceled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debuglogs")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	captured, restore := stubCapture(false)
+	defer restore()
+	var uploaded []string
+	p := newTestPlugin(&uploaded)
+
+	out := p.capture(log.NewMockLog(), CaptureDebugLogsPluginInput{ID: "capture"}, dir, task.NewChanneledCancelFlag(), "bucket", "")
+	assert.Equal(t, contracts.ResultStatusCancelled, out.Status)
+	assert.Equal(t, []string{defaultLogLevel, "10m0s", "stopped"}, *captured)
+	assert.Len(t, uploaded, 2)
+}
+
+func TestCaptureRequiresBucket(t *testing.T) {
+	captured, restore := stubCapture(true)
+	defer restore()
+	var uploaded []string
+	p := newTestPlugin(&uploaded)
+
+	out := p.capture(log.NewMockLog(), CaptureDebugLogsPluginInput{ID: "capture"}, "orchestration", task.NewChanneledCancelFlag(), "", "")
+	assert.Equal(t, contracts.ResultStatusFailed, out.Status)
+	assert.Empty(t, *captured)
+}
+
+func TestParseInput(t *testing.T) {
+	duration, level, err := parseInput(CaptureDebugLogsPluginInput{DurationMinutes: float64(60), LogLevel: "debug"})
+	assert.Nil(t, err)
+	assert.Equal(t, time.Hour, duration)
+	assert.Equal(t, "debug", level)
+
+	for _, input := range []CaptureDebugLogsPluginInput{
+		{DurationMinutes: "0"},
+		{DurationMinutes: float64(61)},
+		{DurationMinutes: 1.5},
+		{DurationMinutes: "ten"},
+		{LogLevel: "info"},
+	} {
+		_, _, err = parseInput(input)
+		assert.NotNil(t, err, "%v", input)
+	}
+}
+
+func TestControlDocument(t *testing.T) {
+	var document contracts.DocumentContent
+	assert.Nil(t, jsonutil.UnmarshalFile("AWS-CaptureAgentDebugLogs.json", &document))
+	assert.Contains(t, document.RuntimeConfig, Name())
+	assert.Equal(t, "10", document.Parameters["durationMinutes"].DefaultVal)
+}
@@ -0,0 +1,220 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package dockercompose implements the aws:runDockerCompose plugin.
+// compose contains the functions preparing the docker compose run and reporting the status of the services.
+package dockercompose
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/pluginutil"
+)
+
+const (
+	actionUp      = "up"
+	actionDown    = "down"
+	actionRestart = "restart"
+)
+
+// detectComposeCommand picks the compose v2 plugin of the docker cli, or the standalone docker-compose.
+const detectComposeCommand = "if docker compose version >/dev/null 2>&1; then COMPOSE='docker compose'; " +
+	"elif command -v docker-compose >/dev/null 2>&1; then COMPOSE=docker-compose; " +
+	"else echo 'docker compose is not installed' >&2; exit 1; fi"
+
+// projectNamePattern is the format of the project names accepted by docker compose.
+var projectNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// serviceStatus is the part of the output of docker compose ps used to report the status of a service.
+type serviceStatus struct {
+	Name     string `json:"Name"`
+	Service  string `json:"Service"`
+	State    string `json:"State"`
+	Health   string `json:"Health"`
+	ExitCode int    `json:"ExitCode"`
+}
+
+// validateInput checks the action, the project name and that exactly one compose file source is declared.
+func validateInput(input DockerComposePluginInput) error {
+	switch input.Action {
+	case actionUp, actionRestart:
+	case actionDown:
+		if len(input.Services) > 0 {
+			return errors.New("Services cannot be specified with the down action, which removes the whole project")
+		}
+	default:
+		return fmt.Errorf("unsupported action %v, supported actions are %v, %v and %v", input.Action, actionUp, actionDown, actionRestart)
+	}
+	if !projectNamePattern.MatchString(input.ProjectName) {
+		return errors.New("ProjectName is required and must consist of lowercase letters, digits, dashes and underscores")
+	}
+
+	sources := 0
+	for _, source := range []string{input.ComposeFile, input.ComposeFileSource, input.GitRepository} {
+		if strings.TrimSpace(source) != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return errors.New("exactly one of ComposeFile, ComposeFileSource or GitRepository must be specified")
+	}
+	if input.ComposeFilePath != "" && input.GitRepository == "" {
+		return errors.New("ComposeFilePath can only be specified with GitRepository")
+	}
+	// git would take a repository or a ref starting with a dash for an option
+	if strings.HasPrefix(input.GitRepository, "-") || strings.HasPrefix(input.GitRef, "-") {
+		return errors.New("GitRepository and GitRef cannot start with -")
+	}
+	return nil
+}
+
+// prepareComposeFile writes the inline compose file or downloads it from its source, and returns its path.
+// Compose files from git repositories are referenced inside the clone made by the script.
+func prepareComposeFile(log log.T, input DockerComposePluginInput, orchestrationDir string) (composeFilePath string, err error) {
+	switch {
+	case input.GitRepository != "":
+		path := input.ComposeFilePath
+		if path == "" {
+			path = composeFileName
+		}
+		return filepath.Join(orchestrationDir, repositoryDirName, path), nil
+
+	case input.ComposeFileSource != "":
+		downloadOutput, err := pluginutil.DownloadFileFromSource(log, input.ComposeFileSource, input.ComposeFileSourceHash, input.ComposeFileSourceHashType)
+		if err != nil || !downloadOutput.IsHashMatched || downloadOutput.LocalFilePath == "" {
+			return "", fmt.Errorf("failed to download compose file reliably %v", input.ComposeFileSource)
+		}
+		return downloadOutput.LocalFilePath, nil
+
+	default:
+		composeFilePath = filepath.Join(orchestrationDir, composeFileName)
+		if err = fileutil.HardenedWriteFile(composeFilePath, []byte(input.ComposeFile)); err != nil {
+			return "", err
+		}
+		return composeFilePath, nil
+	}
+}
+
+// formatEnvFile returns the variables in the env file format, sorted by name.
+func formatEnvFile(environment map[string]string) string {
+	names := make([]string, 0, len(environment))
+	for name := range environment {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var content bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&content, "%v=%v\n", name, environment[name])
+	}
+	return content.String()
+}
+
+// buildScript returns the commands running the action on the project. The status of the services is saved
+// to servicesFilePath whatever the result of the action, and the script exits with the code of the action.
+func buildScript(input DockerComposePluginInput, orchestrationDir string, composeFilePath string, envFiles []string, servicesFilePath string) (commands []string) {
+	commands = append(commands, detectComposeCommand)
+
+	if input.GitRepository != "" {
+		clone := "git clone --quiet --depth 1"
+		if input.GitRef != "" {
+			clone += " --branch " + pluginutil.ShellQuote(input.GitRef)
+		}
+		clone += " -- " + pluginutil.ShellQuote(input.GitRepository) + " " + pluginutil.ShellQuote(filepath.Join(orchestrationDir, repositoryDirName)) + " >&2 || exit 1"
+		commands = append(commands, clone)
+	}
+
+	compose := "$COMPOSE -p " + pluginutil.ShellQuote(input.ProjectName) + " -f " + pluginutil.ShellQuote(composeFilePath)
+	for _, envFile := range envFiles {
+		compose += " --env-file " + pluginutil.ShellQuote(envFile)
+	}
+	services := ""
+	for _, service := range input.Services {
+		services += " " + pluginutil.ShellQuote(service)
+	}
+
+	if input.Pull && input.Action != actionDown {
+		commands = append(commands, compose+" pull"+services+" >&2 || exit 1")
+	}
+	switch input.Action {
+	case actionUp:
+		commands = append(commands, compose+" up --detach --remove-orphans"+services)
+	case actionDown:
+		commands = append(commands, compose+" down --remove-orphans")
+	case actionRestart:
+		commands = append(commands, compose+" restart"+services)
+	}
+	return append(commands,
+		"status=$?",
+		compose+" ps --all --format json > "+pluginutil.ShellQuote(servicesFilePath)+" 2>/dev/null",
+		"exit $status")
+}
+
+// summarizeServices maps the output of docker compose ps to one line per container of the project.
+// Depending on its version docker compose prints a json array or one json object per line.
+func summarizeServices(projectName string, rawServices []byte) string {
+	rawServices = bytes.TrimSpace(rawServices)
+	var services []serviceStatus
+	if bytes.HasPrefix(rawServices, []byte("[")) {
+		if err := json.Unmarshal(rawServices, &services); err != nil {
+			return fmt.Sprintf("Project %v: status of the services is not available\n", projectName)
+		}
+	} else if len(rawServices) > 0 {
+		for _, line := range bytes.Split(rawServices, []byte("\n")) {
+			var service serviceStatus
+			if err := json.Unmarshal(line, &service); err != nil {
+				return fmt.Sprintf("Project %v: status of the services is not available\n", projectName)
+			}
+			services = append(services, service)
+		}
+	}
+	if len(services) == 0 {
+		return fmt.Sprintf("Project %v: no services\n", projectName)
+	}
+	sort.Sort(byService(services))
+
+	var summary bytes.Buffer
+	fmt.Fprintf(&summary, "Project %v:\n", projectName)
+	for _, service := range services {
+		fmt.Fprintf(&summary, "  %v (%v): %v", service.Service, service.Name, service.State)
+		switch {
+		case service.Health != "":
+			fmt.Fprintf(&summary, " (%v)", service.Health)
+		case service.State == "exited":
+			fmt.Fprintf(&summary, " (exit code %v)", service.ExitCode)
+		}
+		summary.WriteString("\n")
+	}
+	return summary.String()
+}
+
+// byService sorts the containers by service, then by name.
+type byService []serviceStatus
+
+func (s byService) Len() int      { return len(s) }
+func (s byService) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byService) Less(i, j int) bool {
+	if s[i].Service != s[j].Service {
+		return s[i].Service < s[j].Service
+	}
+	return s[i].Name < s[j].Name
+}
@@ -0,0 +1,98 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package dockercompose
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummarizeServices(t *testing.T) {
+	ndjson := `{"Name":"shop-web-1","Service":"web","State":"running","Health":"healthy","ExitCode":0}
+{"Name":"shop-migrate-1","Service":"migrate","State":"exited","Health":"","ExitCode":1}`
+	expected := "Project shop:\n" +
+		"  migrate (shop-migrate-1): exited (exit code 1)\n" +
+		"  web (shop-web-1): running (healthy)\n"
+	assert.Equal(t, expected, summarizeServices("shop", []byte(ndjson)))
+
+	array := `[{"Name":"shop-web-1","Service":"web","State":"running","Health":"healthy","ExitCode":0},
+{"Name":"shop-migrate-1","Service":"migrate","State":"exited","Health":"","ExitCode":1}]`
+	assert.Equal(t, expected, summarizeServices("shop", []byte(array)))
+
+	assert.Equal(t, "Project shop: no services\n", summarizeServices("shop", []byte("[]\n")))
+	assert.Equal(t, "Project shop: status of the services is not available\n", summarizeServices("shop", []byte("NAME COMMAND")))
+}
+
+func TestBuildScript(t *testing.T) {
+	input := DockerComposePluginInput{
+		ProjectName:   "shop",
+		Action:        actionUp,
+		GitRepository: "https://example.com/shop.git",
+		GitRef:        "v2",
+		Services:      []string{"web"},
+		Pull:          true,
+	}
+	assert.Nil(t, validateInput(input))
+
+	commands := buildScript(input, "/orchestration", "/orchestration/repository/docker-compose.yml",
+		[]string{"/orchestration/compose.env"}, "/orchestration/services.json")
+	compose := "$COMPOSE -p 'shop' -f '/orchestration/repository/docker-compose.yml' --env-file '/orchestration/compose.env'"
+	assert.Equal(t, []string{
+		detectComposeCommand,
+		"git clone --quiet --depth 1 --branch 'v2' -- 'https://example.com/shop.git' '/orchestration/repository' >&2 || exit 1",
+		compose + " pull 'web' >&2 || exit 1",
+		compose + " up --detach --remove-orphans 'web'",
+		"status=$?",
+		compose + " ps --all --format json > '/orchestration/services.json' 2>/dev/null",
+		"exit $status",
+	}, commands)
+}
+
+func TestValidateInput(t *testing.T) {
+	valid := DockerComposePluginInput{ProjectName: "shop", Action: actionDown, ComposeFile: "services: {}"}
+	assert.Nil(t, validateInput(valid))
+
+	invalid := valid
+	invalid.Action = "start"
+	assert.NotNil(t, validateInput(invalid))
+
+	invalid = valid
+	invalid.ProjectName = "Shop"
+	assert.NotNil(t, validateInput(invalid))
+
+	invalid = valid
+	invalid.Services = []string{"web"}
+	assert.NotNil(t, validateInput(invalid))
+
+	invalid = valid
+	invalid.ComposeFileSource = "s3://bucket/docker-compose.yml"
+	assert.NotNil(t, validateInput(invalid))
+
+	invalid = valid
+	invalid.ComposeFilePath = "deploy/docker-compose.yml"
+	assert.NotNil(t, validateInput(invalid))
+
+	invalid = valid
+	invalid.ComposeFile = ""
+	invalid.GitRepository = "--upload-pack=touch /tmp/pwned"
+	assert.NotNil(t, validateInput(invalid))
+
+	invalid.GitRepository = "https://example.com/shop.git"
+	assert.Nil(t, validateInput(invalid))
+	invalid.GitRef = "--upload-pack=touch /tmp/pwned"
+	assert.NotNil(t, validateInput(invalid))
+
+	assert.Equal(t, "A=1\nB=x y\n", formatEnvFile(map[string]string{"B": "x y", "A": "1"}))
+}
@@ -0,0 +1,197 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package external
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/pluginutil"
+	"github.com/aws/amazon-ssm-agent/agent/pluginsdk"
+)
+
+// reservedPrefix is the prefix of the names of the plugins of the agent.
+const reservedPrefix = "aws:"
+
+// manifestExtension is the extension of the manifests dropped in a plugin directory.
+const manifestExtension = ".json"
+
+// discovered is a valid plugin found in a plugin directory.
+type discovered struct {
+	manifest   pluginsdk.Manifest
+	executable string
+	source     string
+}
+
+// Discover returns the document plugins found in the directories.
+func Discover(log log.T, directories ...string) (plugins map[string]*Plugin) {
+	plugins = make(map[string]*Plugin)
+	gracePeriod := cancelGracePeriod()
+	for _, found := range discoverAll(log, directories) {
+		if found.manifest.Type != pluginsdk.TypeDocument {
+			continue
+		}
+		plugin, err := NewPlugin(pluginutil.PluginConfigFor(found.manifest.Name), found.manifest, found.executable, gracePeriod)
+		if err != nil {
+			log.Errorf("failed to create plugin %s %v", found.manifest.Name, err)
+			continue
+		}
+		log.Infof("discovered external plugin %v in %v", found.manifest.Name, found.source)
+		plugins[found.manifest.Name] = plugin
+	}
+	return
+}
+
+// DiscoverLongRunning returns the long-running plugins found in the directories.
+func DiscoverLongRunning(log log.T, directories ...string) (plugins []*LongRunningPlugin) {
+	gracePeriod := cancelGracePeriod()
+	for _, found := range discoverAll(log, directories) {
+		if found.manifest.Type != pluginsdk.TypeLongRunning {
+			continue
+		}
+		log.Infof("discovered long-running external plugin %v in %v", found.manifest.Name, found.source)
+		plugins = append(plugins, NewLongRunningPlugin(found.manifest, found.executable, gracePeriod))
+	}
+	return
+}
+
+// discoverAll returns the plugins of the directories that run on this platform. A directory holds subdirectories
+// with a plugin.json manifest, and manifests dropped in by the packages of the plugins. When several manifests
+// define the same name, the first one wins. Invalid manifests are logged and skipped.
+func discoverAll(log log.T, directories []string) (plugins []discovered) {
+	names := make(map[string]string)
+	for _, directory := range directories {
+		if directory == "" {
+			continue
+		}
+		entries, err := ioutil.ReadDir(directory)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Warnf("failed to read the external plugins directory %v: %v", directory, err)
+			}
+			continue
+		}
+
+		for _, entry := range entries {
+			var found discovered
+			switch {
+			case entry.IsDir():
+				found, err = loadManifest(filepath.Join(directory, entry.Name(), pluginsdk.ManifestFileName), false)
+			case strings.EqualFold(filepath.Ext(entry.Name()), manifestExtension):
+				found, err = loadManifest(filepath.Join(directory, entry.Name()), true)
+			default:
+				continue
+			}
+			if err != nil {
+				log.Warnf("skipping external plugin %v: %v", filepath.Join(directory, entry.Name()), err)
+				continue
+			}
+			if !supportsPlatform(found.manifest) {
+				log.Debugf("skipping external plugin %v, not supported on %v", found.manifest.Name, runtime.GOOS)
+				continue
+			}
+			if source, exists := names[found.manifest.Name]; exists {
+				log.Warnf("skipping external plugin %v, the plugin %v is already defined in %v", found.source, found.manifest.Name, source)
+				continue
+			}
+			names[found.manifest.Name] = found.source
+			plugins = append(plugins, found)
+		}
+	}
+	return
+}
+
+// loadManifest reads and validates a manifest. The executable of a manifest of its own plugin directory must be
+// in that directory, a dropped in manifest may reference an executable anywhere. The manifest, the executable and
+// their directories must be owned by root (the Administrators on Windows) and not writable by other users.
+func loadManifest(path string, droppedIn bool) (found discovered, err error) {
+	found.source = path
+	if err = checkTrusted(path); err != nil {
+		return
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	manifest := &found.manifest
+	if err = json.Unmarshal(content, manifest); err != nil {
+		return found, fmt.Errorf("invalid manifest: %v", err)
+	}
+	if manifest.Type == "" {
+		manifest.Type = pluginsdk.TypeDocument
+	}
+	switch {
+	case manifest.Name == "" || !strings.Contains(manifest.Name, ":"):
+		return found, fmt.Errorf("invalid name %v, expected a prefix such as acme:", manifest.Name)
+	case strings.HasPrefix(strings.ToLower(manifest.Name), reservedPrefix):
+		return found, fmt.Errorf("invalid name %v, the %v prefix is reserved", manifest.Name, reservedPrefix)
+	case manifest.Executable == "":
+		return found, fmt.Errorf("the executable is missing")
+	case !droppedIn && (filepath.IsAbs(manifest.Executable) || strings.HasPrefix(filepath.Clean(manifest.Executable), "..")):
+		return found, fmt.Errorf("invalid executable %v, expected a path in the plugin directory", manifest.Executable)
+	case manifest.ProtocolVersion != pluginsdk.ProtocolVersion:
+		return found, fmt.Errorf("unsupported protocol version %v, expected %v", manifest.ProtocolVersion, pluginsdk.ProtocolVersion)
+	case manifest.Type != pluginsdk.TypeDocument && manifest.Type != pluginsdk.TypeLongRunning:
+		return found, fmt.Errorf("invalid type %v, expected %v or %v", manifest.Type, pluginsdk.TypeDocument, pluginsdk.TypeLongRunning)
+	}
+
+	found.executable = manifest.Executable
+	if !filepath.IsAbs(found.executable) {
+		found.executable = filepath.Join(filepath.Dir(path), found.executable)
+	}
+	if !fileutil.Exists(found.executable) {
+		return found, fmt.Errorf("executable %v not found", manifest.Executable)
+	}
+	err = checkTrusted(found.executable)
+	return
+}
+
+// checkTrusted checks the ownership of a file of a plugin and of its directory,
+// in which another user could otherwise replace the file.
+func checkTrusted(path string) error {
+	for _, trusted := range []string{filepath.Dir(path), path} {
+		if err := checkOwnership(trusted); err != nil {
+			return fmt.Errorf("untrusted plugin file: %v", err)
+		}
+	}
+	return nil
+}
+
+// supportsPlatform returns true if the plugin runs on this operating system.
+func supportsPlatform(manifest pluginsdk.Manifest) bool {
+	if len(manifest.Platforms) == 0 {
+		return true
+	}
+	for _, platform := range manifest.Platforms {
+		if strings.EqualFold(platform, runtime.GOOS) {
+			return true
+		}
+	}
+	return false
+}
+
+// cancelGracePeriod returns how long a plugin has to stop once canceled.
+func cancelGracePeriod() time.Duration {
+	config, _ := appconfig.Config(false)
+	return time.Duration(config.ExternalPlugins.CancelGracePeriodSeconds) * time.Second
+}
@@ -0,0 +1,45 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+
+// +build darwin freebsd linux netbsd openbsd
+
+package external
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// untrustedModeBits are the permissions letting other users than the owner write the file.
+const untrustedModeBits os.FileMode = 0022
+
+// trustedUID is the user which must own the files of the plugins, root.
+var trustedUID uint32 = 0
+
+// checkOwnership returns an error unless the file or the directory is owned by root and only writable by root,
+// since the agent runs the plugins as root.
+func checkOwnership(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); !ok || stat.Uid != trustedUID {
+		return fmt.Errorf("%v is not owned by root", path)
+	}
+	if info.Mode().Perm()&untrustedModeBits != 0 {
+		return fmt.Errorf("%v is writable by other users than root, mode %04o", path, info.Mode().Perm())
+	}
+	return nil
+}
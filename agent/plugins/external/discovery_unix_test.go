@@ -0,0 +1,56 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+
+// +build darwin freebsd linux netbsd openbsd
+
+package external
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	// the files of the tests are owned by the user running them
+	trustedUID = uint32(os.Getuid())
+}
+
+func TestDiscoverUntrustedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "external")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	manifest := `{"name":"acme:%v","executable":"plugin","protocolVersion":1}`
+	for _, name := range []string{"trusted", "manifest", "directory", "executable"} {
+		writePlugin(t, dir, name, fmt.Sprintf(manifest, name))
+	}
+	assert.Nil(t, os.Chmod(filepath.Join(dir, "manifest", "plugin.json"), 0620))
+	assert.Nil(t, os.Chmod(filepath.Join(dir, "directory"), 0777))
+	assert.Nil(t, os.Chmod(filepath.Join(dir, "executable", "plugin"), 0702))
+
+	plugins := Discover(log.NewMockLog(), dir)
+	assert.Len(t, plugins, 1)
+	assert.NotNil(t, plugins["acme:trusted"])
+
+	// the files must be owned by root
+	defer func(original uint32) { trustedUID = original }(trustedUID)
+	trustedUID++
+	assert.Empty(t, Discover(log.NewMockLog(), dir))
+}
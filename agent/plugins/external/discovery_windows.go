@@ -0,0 +1,102 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+
+// +build windows
+
+package external
+
+import (
+	"fmt"
+	"unsafe"
+
+	aclapi "github.com/hectane/go-acl/api"
+	"golang.org/x/sys/windows"
+)
+
+const (
+	// accessAllowedAceType is ACCESS_ALLOWED_ACE_TYPE.
+	accessAllowedAceType = 0
+
+	// inheritOnlyAce is INHERIT_ONLY_ACE, the ace only applies to the children of a directory.
+	inheritOnlyAce = 0x8
+
+	// writeAccessMask are the rights to modify a file or a directory: FILE_WRITE_DATA (FILE_ADD_FILE),
+	// FILE_APPEND_DATA (FILE_ADD_SUBDIRECTORY), FILE_DELETE_CHILD, DELETE, WRITE_DAC, WRITE_OWNER,
+	// GENERIC_ALL and GENERIC_WRITE.
+	writeAccessMask = 0x2 | 0x4 | 0x40 | 0x10000 | 0x40000 | 0x80000 | 0x10000000 | 0x40000000
+)
+
+// trustedSids are the accounts which may own and modify the files of the plugins:
+// LocalSystem, the built-in Administrators and TrustedInstaller.
+var trustedSids = map[string]bool{
+	"S-1-5-18":     true,
+	"S-1-5-32-544": true,
+	"S-1-5-80-956008885-3418522649-1831038044-1853292631-2271478464": true,
+}
+
+// acl is the header of an ACL structure.
+type acl struct {
+	AclRevision byte
+	Sbz1        byte
+	AclSize     uint16
+	AceCount    uint16
+	Sbz2        uint16
+}
+
+// accessAllowedAce is the ACCESS_ALLOWED_ACE structure, the SID starts at SidStart.
+type accessAllowedAce struct {
+	AceType  byte
+	AceFlags byte
+	AceSize  uint16
+	Mask     uint32
+	SidStart uint32
+}
+
+// checkOwnership returns an error unless the file or the directory is owned by the Administrators or LocalSystem,
+// and only they can modify it, since the agent runs the plugins as LocalSystem.
+func checkOwnership(path string) error {
+	var owner *windows.SID
+	var dacl *acl
+	var securityDescriptor windows.Handle
+	if err := aclapi.GetNamedSecurityInfo(
+		path,
+		aclapi.SE_FILE_OBJECT,
+		aclapi.OWNER_SECURITY_INFORMATION|aclapi.DACL_SECURITY_INFORMATION,
+		&owner, nil, (*windows.Handle)(unsafe.Pointer(&dacl)), nil, &securityDescriptor,
+	); err != nil {
+		return fmt.Errorf("failed to read the security of %v: %v", path, err)
+	}
+	defer windows.LocalFree(securityDescriptor)
+
+	if ownerSid, err := owner.String(); err != nil || !trustedSids[ownerSid] {
+		return fmt.Errorf("%v is not owned by the Administrators", path)
+	}
+	if dacl == nil {
+		return fmt.Errorf("%v has no access control list, everyone can modify it", path)
+	}
+	offset := unsafe.Sizeof(*dacl)
+	for i := 0; i < int(dacl.AceCount); i++ {
+		ace := (*accessAllowedAce)(unsafe.Pointer(uintptr(unsafe.Pointer(dacl)) + offset))
+		offset += uintptr(ace.AceSize)
+		if ace.AceType != accessAllowedAceType || ace.AceFlags&inheritOnlyAce != 0 || ace.Mask&writeAccessMask == 0 {
+			continue
+		}
+		sid := (*windows.SID)(unsafe.Pointer(&ace.SidStart))
+		if sidString, err := sid.String(); err != nil || !trustedSids[sidString] {
+			account, domain, _, _ := sid.LookupAccount("")
+			return fmt.Errorf("%v can be modified by %v\\%v", path, domain, account)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package external implements the plugins shipped as separate executables, which talk to the agent with the protocol
+// of the pluginsdk package. Third parties add document actions without changing the agent.
+package external
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/context"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/pluginutil"
+	"github.com/aws/amazon-ssm-agent/agent/pluginsdk"
+	"github.com/aws/amazon-ssm-agent/agent/task"
+)
+
+// Plugin runs the steps of an external plugin.
+type Plugin struct {
+	pluginutil.DefaultPlugin
+	manifest    pluginsdk.Manifest
+	executable  string
+	gracePeriod time.Duration
+}
+
+// NewPlugin returns the plugin of the manifest, whose executable is at the given path.
+func NewPlugin(pluginConfig pluginutil.PluginConfig, manifest pluginsdk.Manifest, executable string, gracePeriod time.Duration) (*Plugin, error) {
+	var plugin Plugin
+	plugin.MaxStdoutLength = pluginConfig.MaxStdoutLength
+	plugin.MaxStderrLength = pluginConfig.MaxStderrLength
+	plugin.StdoutFileName = pluginConfig.StdoutFileName
+	plugin.StderrFileName = pluginConfig.StderrFileName
+	plugin.OutputTruncatedSuffix = pluginConfig.OutputTruncatedSuffix
+	plugin.Uploader = pluginutil.GetS3Config()
+	plugin.ExecuteUploadOutputToS3Bucket = pluginutil.UploadOutputToS3BucketExecuter(plugin.UploadOutputToS3Bucket)
+	plugin.manifest = manifest
+	plugin.executable = executable
+	plugin.gracePeriod = gracePeriod
+
+	return &plugin, nil
+}
+
+// Name returns the plugin name, the action of its steps in documents.
+func (p *Plugin) Name() string {
+	return p.manifest.Name
+}
+
+// Execute runs the step in a new process of the executable and returns its result.
+func (p *Plugin) Execute(context context.T, config contracts.Configuration, cancelFlag task.CancelFlag) (res contracts.PluginResult) {
+	log := context.Log()
+	log.Infof("%v started with configuration %v", p.Name(), config)
+	res.StartDateTime = time.Now()
+	defer func() { res.EndDateTime = time.Now() }()
+
+	out := p.run(log, config, cancelFlag)
+	res.Code = out.ExitCode
+	res.Status = out.Status
+	res.Output = out.String()
+
+	pluginutil.PersistPluginInformationToCurrent(log, p.Name(), config, res)
+	return res
+}
+
+// run exchanges the messages of the step with the process and returns its output.
+func (p *Plugin) run(log log.T, config contracts.Configuration, cancelFlag task.CancelFlag) (out contracts.PluginOutput) {
+	process, err := startProcess(log, p.Name(), p.executable, config.OrchestrationDirectory)
+	if err != nil {
+		return pluginutil.MarkAsFailed(log, out, fmt.Errorf("failed to start %v: %v", p.executable, err))
+	}
+
+	// the input stays open until the result is received, the plugin considers a closed input as a cancel
+	encoder := json.NewEncoder(process.stdin)
+	var encoderMutex sync.Mutex
+	send := func(message pluginsdk.Message) error {
+		encoderMutex.Lock()
+		defer encoderMutex.Unlock()
+		return encoder.Encode(message)
+	}
+	err = send(pluginsdk.Message{
+		Type: pluginsdk.MessageExecute,
+		Execute: &pluginsdk.ExecuteRequest{
+			ProtocolVersion:        pluginsdk.ProtocolVersion,
+			PluginName:             p.Name(),
+			MessageID:              config.MessageId,
+			Properties:             config.Properties,
+			OrchestrationDirectory: config.OrchestrationDirectory,
+			DocumentTempDirectory:  config.DocumentTempDirectory,
+		},
+	})
+	if err != nil {
+		process.kill()
+		process.wait()
+		return pluginutil.MarkAsFailed(log, out, fmt.Errorf("failed to send the step to %v: %v", p.Name(), err))
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go p.forwardCancel(log, cancelFlag, done, send, process)
+
+	var stdout, stderr bytes.Buffer
+	result, err := receive(log, p.Name(), process.stdout, &stdout, &stderr)
+	process.stdin.Close()
+	waitErr := process.wait()
+
+	out.Stdout = stdout.String()
+	out.Stderr = stderr.String()
+	switch {
+	case err != nil:
+		out = pluginutil.MarkAsFailed(log, out, err)
+	case result == nil:
+		out = pluginutil.MarkAsFailed(log, out, fmt.Errorf("%v exited without a result: %v", p.Name(), waitErr))
+	default:
+		out.ExitCode = result.ExitCode
+		out.Status = resultStatus(result.Status)
+	}
+	if cancelFlag.Canceled() && out.Status != contracts.ResultStatusSuccess {
+		out.Status = contracts.ResultStatusCancelled
+	}
+
+	p.saveOutput(log, config, &out)
+	return
+}
+
+// forwardCancel sends a cancel message when the step is canceled, then kills the process after the grace period.
+func (p *Plugin) forwardCancel(log log.T, cancelFlag task.CancelFlag, done chan struct{}, send func(pluginsdk.Message) error, process *process) {
+	canceled := make(chan bool, 1)
+	go func() {
+		state := cancelFlag.Wait()
+		canceled <- state == task.Canceled || state == task.ShutDown
+	}()
+
+	select {
+	case <-done:
+		return
+	case isCanceled := <-canceled:
+		if !isCanceled {
+			return
+		}
+	}
+	log.Infof("canceling %v", p.Name())
+	if err := send(pluginsdk.Message{Type: pluginsdk.MessageCancel, Cancel: &pluginsdk.CancelRequest{ShutDown: cancelFlag.ShutDown()}}); err != nil {
+		log.Debugf("failed to send the cancel message to %v: %v", p.Name(), err)
+	}
+	select {
+	case <-done:
+	case <-time.After(p.gracePeriod):
+		log.Warnf("%v did not stop within %v, killing it", p.Name(), p.gracePeriod)
+		process.kill()
+	}
+}
+
+// receive reads the messages of the process until its result, the output is appended to stdout and stderr.
+func receive(log log.T, pluginName string, in io.Reader, stdout io.Writer, stderr io.Writer) (*pluginsdk.Result, error) {
+	decoder := json.NewDecoder(in)
+	for {
+		var message pluginsdk.Message
+		if err := decoder.Decode(&message); err != nil {
+			if err == io.EOF {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("invalid message from %v: %v", pluginName, err)
+		}
+		switch message.Type {
+		case pluginsdk.MessageOutput:
+			if message.Output == nil {
+				continue
+			}
+			if message.Output.Stream == pluginsdk.StreamStderr {
+				io.WriteString(stderr, message.Output.Data)
+			} else {
+				io.WriteString(stdout, message.Output.Data)
+			}
+		case pluginsdk.MessageStatus:
+			if message.Status != nil {
+				log.Infof("%v: %v", pluginName, message.Status.Message)
+			}
+		case pluginsdk.MessageResult:
+			if message.Result == nil {
+				return nil, fmt.Errorf("empty result from %v", pluginName)
+			}
+			return message.Result, nil
+		default:
+			log.Debugf("ignoring message %v from %v", message.Type, pluginName)
+		}
+	}
+}
+
+// resultStatus maps the status of a result to the status of the plugin, unknown statuses are failures.
+func resultStatus(status string) contracts.ResultStatus {
+	switch status {
+	case pluginsdk.StatusSuccess:
+		return contracts.ResultStatusSuccess
+	case pluginsdk.StatusSuccessAndReboot:
+		return contracts.ResultStatusSuccessAndReboot
+	case pluginsdk.StatusCancelled:
+		return contracts.ResultStatusCancelled
+	default:
+		return contracts.ResultStatusFailed
+	}
+}
+
+// saveOutput writes the full output to the orchestration directory and uploads it, then truncates the output of the result.
+func (p *Plugin) saveOutput(log log.T, config contracts.Configuration, out *contracts.PluginOutput) {
+	if config.OrchestrationDirectory != "" {
+		err := fileutil.MakeDirs(config.OrchestrationDirectory)
+		if err == nil {
+			err = fileutil.WriteAllText(filepath.Join(config.OrchestrationDirectory, p.StdoutFileName), out.Stdout)
+		}
+		if err == nil {
+			err = fileutil.WriteAllText(filepath.Join(config.OrchestrationDirectory, p.StderrFileName), out.Stderr)
+		}
+		if err != nil {
+			out.Errors = append(out.Errors, err.Error())
+		} else if config.OutputS3BucketName != "" {
+			pluginID := fileutil.RemoveInvalidChars(p.Name())
+			errs := p.ExecuteUploadOutputToS3Bucket(log, pluginID, config.OrchestrationDirectory, config.OutputS3BucketName, config.OutputS3KeyPrefix, false, "", out.Stdout, out.Stderr)
+			out.Errors = append(out.Errors, errs...)
+		}
+	}
+
+	if len(out.Stdout) > p.MaxStdoutLength {
+		out.Stdout = out.Stdout[:p.MaxStdoutLength] + p.OutputTruncatedSuffix
+	}
+	if len(out.Stderr) > p.MaxStderrLength {
+		out.Stderr = out.Stderr[:p.MaxStderrLength] + p.OutputTruncatedSuffix
+	}
+}
@@ -0,0 +1,351 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package external
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/context"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/pluginsdk"
+	"github.com/aws/amazon-ssm-agent/agent/task"
+	"github.com/stretchr/testify/assert"
+)
+
+// writePlugin writes the manifest and an empty executable of a plugin in the directory.
+func writePlugin(t *testing.T, directory string, name string, manifest string) {
+	pluginDir := filepath.Join(directory, name)
+	assert.Nil(t, os.MkdirAll(pluginDir, 0700))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(pluginDir, pluginsdk.ManifestFileName), []byte(manifest), 0600))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(pluginDir, "plugin"), []byte{}, 0700))
+}
+
+func TestDiscover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "external")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writePlugin(t, dir, "deploy", `{"name":"acme:deploy","executable":"plugin","protocolVersion":1}`)
+	writePlugin(t, dir, "reserved", `{"name":"aws:deploy","executable":"plugin","protocolVersion":1}`)
+	writePlugin(t, dir, "unprefixed", `{"name":"deploy","executable":"plugin","protocolVersion":1}`)
+	writePlugin(t, dir, "outside", `{"name":"acme:outside","executable":"../deploy/plugin","protocolVersion":1}`)
+	writePlugin(t, dir, "missing", `{"name":"acme:missing","executable":"missing","protocolVersion":1}`)
+	writePlugin(t, dir, "future", `{"name":"acme:future","executable":"plugin","protocolVersion":2}`)
+	writePlugin(t, dir, "platform", `{"name":"acme:platform","executable":"plugin","protocolVersion":1,"platforms":["plan9"]}`)
+	writePlugin(t, dir, "native", `{"name":"acme:native","executable":"plugin","protocolVersion":1,"platforms":["`+runtime.GOOS+`"]}`)
+
+	plugins := Discover(log.NewMockLog(), dir)
+	assert.Len(t, plugins, 2)
+	assert.Equal(t, filepath.Join(dir, "deploy", "plugin"), plugins["acme:deploy"].executable)
+	assert.NotNil(t, plugins["acme:native"])
+
+	assert.Empty(t, Discover(log.NewMockLog(), filepath.Join(dir, "none")))
+}
+
+func TestDiscoverManifestDirectory(t *testing.T) {
+	pluginsDir, err := ioutil.TempDir("", "external")
+	assert.Nil(t, err)
+	defer os.RemoveAll(pluginsDir)
+	manifestsDir, err := ioutil.TempDir("", "plugins.d")
+	assert.Nil(t, err)
+	defer os.RemoveAll(manifestsDir)
+
+	writePlugin(t, pluginsDir, "deploy", `{"name":"acme:deploy","executable":"plugin","protocolVersion":1}`)
+	executable := filepath.Join(pluginsDir, "deploy", "plugin")
+	writeManifest := func(name string, manifest string) {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(manifestsDir, name), []byte(manifest), 0600))
+	}
+	writeManifest("watcher.json", `{"name":"acme:watcher","executable":`+strconv.Quote(executable)+`,"protocolVersion":1,"type":"longRunning"}`)
+	writeManifest("backup.json", `{"name":"acme:backup","executable":"../`+filepath.Base(pluginsDir)+`/deploy/plugin","protocolVersion":1}`)
+	writeManifest("duplicate.json", `{"name":"acme:deploy","executable":`+strconv.Quote(executable)+`,"protocolVersion":1}`)
+	writeManifest("invalid.json", `{"name":"acme:invalid","executable":`+strconv.Quote(executable)+`,"protocolVersion":1,"type":"daemon"}`)
+	writeManifest("readme.txt", `not a manifest`)
+
+	plugins := Discover(log.NewMockLog(), pluginsDir, manifestsDir)
+	assert.Len(t, plugins, 2)
+	assert.Equal(t, executable, plugins["acme:deploy"].executable)
+	assert.Equal(t, executable, filepath.Clean(plugins["acme:backup"].executable))
+
+	longRunning := DiscoverLongRunning(log.NewMockLog(), pluginsDir, manifestsDir)
+	assert.Len(t, longRunning, 1)
+	assert.Equal(t, "acme:watcher", longRunning[0].Name())
+	assert.Equal(t, executable, longRunning[0].executable)
+}
+
+// stubProcess runs the handler in the test process instead of starting an executable.
+func stubProcess(handler pluginsdk.Handler) (restore func()) {
+	original := startProcess
+	startProcess = func(log log.T, pluginName string, executable string, workingDirectory string) (*process, error) {
+		agentReader, pluginWriter := io.Pipe()
+		pluginReader, agentWriter := io.Pipe()
+		exited := make(chan struct{})
+		go func() {
+			pluginsdk.ServeStreams(pluginReader, pluginWriter, handler)
+			pluginWriter.Close()
+			close(exited)
+		}()
+		return &process{
+			stdin:  agentWriter,
+			stdout: agentReader,
+			wait:   func() error { <-exited; return nil },
+			kill: func() error {
+				pluginWriter.Close()
+				return nil
+			},
+		}, nil
+	}
+	return func() { startProcess = original }
+}
+
+// newTestPlugin returns a plugin recording the outputs it uploads.
+func newTestPlugin(uploaded *[]string) *Plugin {
+	p := &Plugin{manifest: pluginsdk.Manifest{Name: "acme:deploy"}, gracePeriod: time.Second}
+	p.MaxStdoutLength = 8
+	p.MaxStderrLength = 100
+	p.OutputTruncatedSuffix = "--"
+	p.StdoutFileName = "stdout"
+	p.StderrFileName = "stderr"
+	p.ExecuteUploadOutputToS3Bucket = func(log log.T, pluginID string, orchestrationDir string, outputS3BucketName string, outputS3KeyPrefix string, useTempDirectory bool, tempDir string, Stdout string, Stderr string) []string {
+		*uploaded = append(*uploaded, pluginID, Stdout)
+		return nil
+	}
+	return p
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "external")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer stubProcess(pluginsdk.HandlerFunc(func(request pluginsdk.ExecuteRequest, session *pluginsdk.Session) pluginsdk.Result {
+		session.ReportStatus("deploying")
+		session.Stdout("deployed web\n")
+		session.Stderr("warning\n")
+		return pluginsdk.Result{Status: pluginsdk.StatusSuccess}
+	}))()
+	var uploaded []string
+	p := newTestPlugin(&uploaded)
+
+	config := contracts.Configuration{OrchestrationDirectory: dir, OutputS3BucketName: "bucket", Properties: map[string]interface{}{"app": "web"}}
+	out := p.run(log.NewMockLog(), config, task.NewChanneledCancelFlag())
+	assert.Equal(t, contracts.ResultStatusSuccess, out.Status, "%v", out.Errors)
+	assert.Equal(t, "deployed--", out.Stdout)
+	assert.Equal(t, "warning\n", out.Stderr)
+	assert.Equal(t, []string{"acmedeploy", "deployed web\n"}, uploaded)
+	stdout, _ := ioutil.ReadFile(filepath.Join(dir, "stdout"))
+	assert.Equal(t, "deployed web\n", string(stdout))
+}
+
+func TestRunWithoutResult(t *testing.T) {
+	dir, err := ioutil.TempDir("", "external")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	original := startProcess
+	defer func() { startProcess = original }()
+	startProcess = func(log log.T, pluginName string, executable string, workingDirectory string) (*process, error) {
+		agentReader, pluginWriter := io.Pipe()
+		pluginReader, agentWriter := io.Pipe()
+		go io.Copy(ioutil.Discard, pluginReader)
+		go pluginWriter.Close()
+		return &process{stdin: agentWriter, stdout: agentReader, wait: func() error { return nil }, kill: func() error { return nil }}, nil
+	}
+	var uploaded []string
+
+	out := newTestPlugin(&uploaded).run(log.NewMockLog(), contracts.Configuration{OrchestrationDirectory: dir}, task.NewChanneledCancelFlag())
+	assert.Equal(t, contracts.ResultStatusFailed, out.Status)
+	assert.Contains(t, out.Errors[0], "exited without a result")
+}
+
+func TestRunCanceled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "external")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	started := make(chan struct{})
+	defer stubProcess(pluginsdk.HandlerFunc(func(request pluginsdk.ExecuteRequest, session *pluginsdk.Session) pluginsdk.Result {
+		close(started)
+		<-session.Canceled()
+		return pluginsdk.Result{Status: pluginsdk.StatusCancelled, ExitCode: 1}
+	}))()
+	var uploaded []string
+	cancelFlag := task.NewChanneledCancelFlag()
+	go func() {
+		<-started
+		cancelFlag.Set(task.Canceled)
+	}()
+
+	out := newTestPlugin(&uploaded).run(log.NewMockLog(), contracts.Configuration{OrchestrationDirectory: dir}, cancelFlag)
+	assert.Equal(t, contracts.ResultStatusCancelled, out.Status)
+	assert.Equal(t, 1, out.ExitCode)
+}
+
+// stubHealthFile saves the health of the long-running plugins in a temporary directory, forgetting the plugins
+// started by other tests, and returns a func removing it.
+func stubHealthFile(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "external")
+	assert.Nil(t, err)
+	originalPath, originalSupervised := healthFilePath, supervised
+	healthFilePath = func() string { return filepath.Join(dir, HealthFileName) }
+	supervised = nil
+	return func() {
+		healthFilePath, supervised = originalPath, originalSupervised
+		os.RemoveAll(dir)
+	}
+}
+
+func TestLongRunningPlugin(t *testing.T) {
+	defer stubHealthFile(t)()
+	defer func(delay time.Duration) { restartDelayMin = delay }(restartDelayMin)
+	restartDelayMin = time.Millisecond
+	original := startProcess
+	defer func() { startProcess = original }()
+	executable := filepath.Join("opt", "acme", "watcher")
+	starts := make(chan int, 2)
+	var count int32
+	startProcess = func(log log.T, pluginName string, executable string, workingDirectory string) (*process, error) {
+		assert.Equal(t, filepath.Dir(executable), workingDirectory)
+		start := atomic.AddInt32(&count, 1)
+		starts <- int(start)
+		agentReader, pluginWriter := io.Pipe()
+		pluginReader, agentWriter := io.Pipe()
+		exited := make(chan struct{})
+		go func() {
+			pluginsdk.RunLongRunningStreams(pluginReader, pluginWriter, func(session *pluginsdk.Session) error {
+				session.ReportStatus("watching")
+				if start > 1 {
+					// the first run exits right away, the restarted one runs until it is stopped
+					<-session.Canceled()
+				}
+				return nil
+			})
+			pluginWriter.Close()
+			close(exited)
+		}()
+		return &process{
+			stdin:  agentWriter,
+			stdout: agentReader,
+			wait:   func() error { <-exited; return nil },
+			kill: func() error {
+				pluginWriter.Close()
+				return nil
+			},
+		}, nil
+	}
+
+	p := NewLongRunningPlugin(pluginsdk.Manifest{Name: "acme:watcher"}, executable, time.Second)
+	assert.Nil(t, p.RequestStop(contracts.StopTypeSoftStop), "stopping a plugin that was not started")
+
+	p = NewLongRunningPlugin(pluginsdk.Manifest{Name: "acme:watcher"}, executable, time.Second)
+	assert.Nil(t, p.Execute(context.NewMockDefault()))
+	assert.NotNil(t, p.Execute(context.NewMockDefault()))
+	<-starts
+	<-starts
+	for {
+		p.mutex.Lock()
+		running := p.process != nil
+		p.mutex.Unlock()
+		if running {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	assert.Equal(t, StateRunning, p.Health().State)
+
+	assert.Nil(t, p.RequestStop(contracts.StopTypeSoftStop))
+	select {
+	case <-p.stopped:
+	default:
+		assert.Fail(t, "the plugin did not stop")
+	}
+
+	health := p.Health()
+	assert.Equal(t, StateStopped, health.State)
+	assert.Equal(t, 1, health.Restarts)
+	assert.NotEmpty(t, health.LastStartTime)
+	assert.NotEmpty(t, health.LastHeartbeatTime)
+	report, err := LoadLongRunningHealth()
+	assert.Nil(t, err)
+	assert.Equal(t, []PluginHealth{health}, report.Plugins)
+}
+
+func TestLongRunningPluginMissedHeartbeats(t *testing.T) {
+	defer stubHealthFile(t)()
+	defer func(delay, unit time.Duration) { restartDelayMin, heartbeatUnit = delay, unit }(restartDelayMin, heartbeatUnit)
+	restartDelayMin, heartbeatUnit = time.Millisecond, time.Millisecond
+	original := startProcess
+	defer func() { startProcess = original }()
+	startProcess = func(log log.T, pluginName string, executable string, workingDirectory string) (*process, error) {
+		// the plugin hangs without sending any message until it is killed
+		stdout, pluginWriter := io.Pipe()
+		stdin, agentWriter := io.Pipe()
+		go io.Copy(ioutil.Discard, stdin)
+		killed := make(chan struct{})
+		var killOnce sync.Once
+		return &process{
+			stdin:  agentWriter,
+			stdout: stdout,
+			wait:   func() error { <-killed; return nil },
+			kill: func() error {
+				killOnce.Do(func() {
+					pluginWriter.Close()
+					close(killed)
+				})
+				return nil
+			},
+		}, nil
+	}
+
+	p := NewLongRunningPlugin(pluginsdk.Manifest{Name: "acme:watcher", HeartbeatSeconds: 5}, "watcher", time.Second)
+	assert.Nil(t, p.Execute(context.NewMockDefault()))
+	for p.Health().Restarts == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	p.RequestStop(contracts.StopTypeSoftStop)
+
+	health := p.Health()
+	assert.Contains(t, health.LastExitError, "missed heartbeats")
+	assert.Equal(t, []PluginHealth{health}, LongRunningHealth())
+}
+
+func TestHealthSummary(t *testing.T) {
+	assert.Equal(t, "0 restarts", HealthSummary(nil))
+	assert.Equal(t, "2 running, 1 stopped, 3 restarts", HealthSummary([]PluginHealth{
+		{Name: "acme:a", State: StateRunning, Restarts: 1},
+		{Name: "acme:b", State: StateStopped},
+		{Name: "acme:c", State: StateRunning, Restarts: 2},
+	}))
+}
+
+func TestHealthDetails(t *testing.T) {
+	assert.Equal(t, []string{"plugin-acme_a/running-1", "plugin-acme_b_c/stopped-0"}, HealthDetails([]PluginHealth{
+		{Name: "acme:a", State: StateRunning, Restarts: 1},
+		{Name: "acme/b c", State: StateStopped},
+	}))
+}
+
+func TestResultStatus(t *testing.T) {
+	assert.Equal(t, contracts.ResultStatusSuccess, resultStatus(pluginsdk.StatusSuccess))
+	assert.Equal(t, contracts.ResultStatusSuccessAndReboot, resultStatus(pluginsdk.StatusSuccessAndReboot))
+	assert.Equal(t, contracts.ResultStatusCancelled, resultStatus(pluginsdk.StatusCancelled))
+	assert.Equal(t, contracts.ResultStatusFailed, resultStatus("Done"))
+}
@@ -0,0 +1,174 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package external
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/times"
+)
+
+// HealthFileName is the name of the file the agent saves the health of the long-running plugins to,
+// in its data store, for ssm-cli.
+const HealthFileName = "longrunningplugins.json"
+
+// States of the long-running plugins.
+const (
+	StateRunning    = "Running"
+	StateRestarting = "Restarting"
+	StateStopped    = "Stopped"
+)
+
+// PluginHealth is the health of a long-running plugin.
+type PluginHealth struct {
+	Name     string `json:"name"`
+	State    string `json:"state"`
+	Restarts int    `json:"restarts"`
+	// LastStartTime is when the executable was last started
+	LastStartTime string `json:"lastStartTime,omitempty"`
+	// LastHeartbeatTime is when the plugin last sent a message
+	LastHeartbeatTime string `json:"lastHeartbeatTime,omitempty"`
+	// LastExitError is why the executable last exited
+	LastExitError string `json:"lastExitError,omitempty"`
+}
+
+// HealthReport is the content of the health file.
+type HealthReport struct {
+	Time    string         `json:"time"`
+	Plugins []PluginHealth `json:"plugins"`
+}
+
+var (
+	supervised      []*LongRunningPlugin
+	supervisedMutex sync.Mutex
+	healthMutex     sync.Mutex
+)
+
+// healthFilePath returns the path of the health file.
+var healthFilePath = func() string {
+	return filepath.Join(appconfig.DataStorePath(), HealthFileName)
+}
+
+// addSupervised adds a started plugin to the plugins whose health is reported.
+func addSupervised(p *LongRunningPlugin) {
+	supervisedMutex.Lock()
+	defer supervisedMutex.Unlock()
+	supervised = append(supervised, p)
+}
+
+// LongRunningHealth returns the health of the long-running plugins started by the agent, sorted by name.
+func LongRunningHealth() []PluginHealth {
+	supervisedMutex.Lock()
+	defer supervisedMutex.Unlock()
+	plugins := make(pluginHealthByName, 0, len(supervised))
+	for _, p := range supervised {
+		plugins = append(plugins, p.Health())
+	}
+	sort.Sort(plugins)
+	return plugins
+}
+
+// HealthSummary aggregates the health of long-running plugins, e.g. "2 running, 1 restarting, 5 restarts".
+func HealthSummary(plugins []PluginHealth) string {
+	counts := make(map[string]int)
+	restarts := 0
+	for _, plugin := range plugins {
+		counts[plugin.State]++
+		restarts += plugin.Restarts
+	}
+	var summary []string
+	for _, state := range []string{StateRunning, StateRestarting, StateStopped} {
+		if counts[state] > 0 {
+			summary = append(summary, fmt.Sprintf("%v %v", counts[state], strings.ToLower(state)))
+		}
+	}
+	return strings.Join(append(summary, fmt.Sprintf("%v restarts", restarts)), ", ")
+}
+
+// HealthDetails returns one user agent token per long-running plugin sent with the health ping,
+// e.g. "plugin-aws_cloudWatch/running-2" for a running plugin restarted twice.
+func HealthDetails(plugins []PluginHealth) (details []string) {
+	for _, plugin := range plugins {
+		details = append(details, fmt.Sprintf("plugin-%v/%v-%d", userAgentToken(plugin.Name), strings.ToLower(plugin.State), plugin.Restarts))
+	}
+	return
+}
+
+// userAgentToken replaces the characters not allowed in a user agent product name.
+func userAgentToken(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r > ' ' && r < 0x7f && !strings.ContainsRune(`()<>@,;:\"/[]?={}`, r) {
+			return r
+		}
+		return '_'
+	}, value)
+}
+
+// SaveLongRunningHealth writes the health of the long-running plugins to the health file.
+// The file is replaced atomically, ssm-cli never reads a partial report.
+func SaveLongRunningHealth() (err error) {
+	report := HealthReport{
+		Time:    times.ToIso8601UTC(times.DefaultClock.Now()),
+		Plugins: LongRunningHealth(),
+	}
+	var content []byte
+	if content, err = json.MarshalIndent(report, "", "  "); err != nil {
+		return
+	}
+
+	healthMutex.Lock()
+	defer healthMutex.Unlock()
+	path := healthFilePath()
+	if err = fileutil.MakeDirs(filepath.Dir(path)); err != nil {
+		return
+	}
+	if err = fileutil.HardenedWriteFile(path+".tmp", content); err != nil {
+		return
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// LoadLongRunningHealth reads the health file saved by the agent.
+func LoadLongRunningHealth() (report HealthReport, err error) {
+	var content []byte
+	if content, err = ioutil.ReadFile(healthFilePath()); err != nil {
+		return
+	}
+	err = json.Unmarshal(content, &report)
+	return
+}
+
+// saveHealth saves the health file after a change of state of a plugin.
+func saveHealth(log log.T) {
+	if err := SaveLongRunningHealth(); err != nil {
+		log.Warnf("failed to save the health of the long-running plugins: %v", err)
+	}
+}
+
+// pluginHealthByName sorts the health of the plugins by name.
+type pluginHealthByName []PluginHealth
+
+func (p pluginHealthByName) Len() int           { return len(p) }
+func (p pluginHealthByName) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p pluginHealthByName) Less(i, j int) bool { return p[i].Name < p[j].Name }
@@ -0,0 +1,284 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package external
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/context"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/pluginsdk"
+	"github.com/aws/amazon-ssm-agent/agent/times"
+)
+
+var (
+	// restartDelayMin is the delay before the first restart of a plugin that exited, doubled on each restart.
+	restartDelayMin = time.Second
+
+	// restartDelayMax bounds the delay between the restarts of a plugin that keeps exiting.
+	restartDelayMax = 5 * time.Minute
+
+	// stableRunTime is how long a plugin runs before its restart delay is reset.
+	stableRunTime = time.Minute
+
+	// hardStopGracePeriod is how long a plugin has to exit when the agent stops.
+	hardStopGracePeriod = 3 * time.Second
+
+	// heartbeatUnit is the unit of the heartbeat interval of the manifests.
+	heartbeatUnit = time.Second
+)
+
+// missedHeartbeats is how many heartbeats a plugin misses before it is killed and restarted.
+const missedHeartbeats = 3
+
+// LongRunningPlugin runs the executable of a plugin as long as the agent, restarting it when it exits.
+type LongRunningPlugin struct {
+	manifest    pluginsdk.Manifest
+	executable  string
+	gracePeriod time.Duration
+
+	mutex    sync.Mutex
+	started  bool
+	process  *process
+	stop     chan struct{}
+	stopOnce sync.Once
+	stopped  chan struct{}
+
+	// health is reported by Health, lastHeartbeat is when the plugin last sent a message
+	health        PluginHealth
+	lastHeartbeat time.Time
+}
+
+// NewLongRunningPlugin returns the long-running plugin of the manifest, whose executable is at the given path.
+func NewLongRunningPlugin(manifest pluginsdk.Manifest, executable string, gracePeriod time.Duration) *LongRunningPlugin {
+	return &LongRunningPlugin{
+		manifest:    manifest,
+		executable:  executable,
+		gracePeriod: gracePeriod,
+		stop:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+		health:      PluginHealth{Name: manifest.Name, State: StateStopped},
+	}
+}
+
+// Name returns the name of the plugin.
+func (p *LongRunningPlugin) Name() string {
+	return p.manifest.Name
+}
+
+// Health returns the state and the restart count of the plugin.
+func (p *LongRunningPlugin) Health() PluginHealth {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	health := p.health
+	if !p.lastHeartbeat.IsZero() {
+		health.LastHeartbeatTime = times.ToIso8601UTC(p.lastHeartbeat)
+	}
+	return health
+}
+
+// Execute starts the plugin and returns, the plugin is restarted until RequestStop is called.
+func (p *LongRunningPlugin) Execute(context context.T) (err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.started {
+		return fmt.Errorf("%v is already started", p.Name())
+	}
+	p.started = true
+	addSupervised(p)
+	go p.supervise(context.Log())
+	return nil
+}
+
+// RequestStop sends a cancel message to the plugin and waits until it exits. The plugin is killed after the
+// grace period, or after hardStopGracePeriod for a hard stop, which the agent bounds.
+func (p *LongRunningPlugin) RequestStop(stopType contracts.StopType) (err error) {
+	p.stopOnce.Do(func() { close(p.stop) })
+	p.mutex.Lock()
+	started := p.started
+	process := p.process
+	p.mutex.Unlock()
+	if !started {
+		return nil
+	}
+
+	gracePeriod := p.gracePeriod
+	if stopType == contracts.StopTypeHardStop && gracePeriod > hardStopGracePeriod {
+		gracePeriod = hardStopGracePeriod
+	}
+	if process != nil {
+		json.NewEncoder(process.stdin).Encode(pluginsdk.Message{Type: pluginsdk.MessageCancel, Cancel: &pluginsdk.CancelRequest{ShutDown: true}})
+		process.stdin.Close()
+	}
+	select {
+	case <-p.stopped:
+		return nil
+	case <-time.After(gracePeriod):
+	}
+	if process != nil {
+		process.kill()
+	}
+	return fmt.Errorf("%v did not stop within %v, killed it", p.Name(), gracePeriod)
+}
+
+// supervise runs the plugin until it is stopped, waiting longer between the restarts of a plugin that keeps exiting.
+func (p *LongRunningPlugin) supervise(log log.T) {
+	defer close(p.stopped)
+	delay := restartDelayMin
+	for {
+		started := time.Now()
+		err := p.runOnce(log)
+		select {
+		case <-p.stop:
+			log.Infof("%v stopped", p.Name())
+			p.setState(log, StateStopped, err)
+			return
+		default:
+		}
+
+		if time.Since(started) >= stableRunTime {
+			delay = restartDelayMin
+		}
+		log.Warnf("%v exited (%v), restarting it in %v", p.Name(), err, delay)
+		p.mutex.Lock()
+		p.health.Restarts++
+		p.mutex.Unlock()
+		p.setState(log, StateRestarting, err)
+		select {
+		case <-p.stop:
+			return
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > restartDelayMax {
+			delay = restartDelayMax
+		}
+	}
+}
+
+// runOnce starts the executable and waits until it exits.
+func (p *LongRunningPlugin) runOnce(log log.T) error {
+	process, err := startProcess(log, p.Name(), p.executable, filepath.Dir(p.executable))
+	if err != nil {
+		return fmt.Errorf("failed to start %v: %v", p.executable, err)
+	}
+	p.mutex.Lock()
+	select {
+	case <-p.stop:
+		// stopped while starting, RequestStop did not see the process
+		p.mutex.Unlock()
+		process.kill()
+		return process.wait()
+	default:
+	}
+	p.process = process
+	p.health.LastStartTime = times.ToIso8601UTC(time.Now())
+	p.lastHeartbeat = time.Now()
+	p.mutex.Unlock()
+	p.setState(log, StateRunning, nil)
+
+	done := make(chan struct{})
+	var missed chan error
+	if p.manifest.HeartbeatSeconds > 0 {
+		missed = make(chan error, 1)
+		go p.watchHeartbeats(process, done, missed)
+	}
+	logMessages(log, p.Name(), process.stdout, p.heartbeat)
+	err = process.wait()
+	close(done)
+	select {
+	case missedErr := <-missed:
+		err = missedErr
+	default:
+	}
+
+	p.mutex.Lock()
+	p.process = nil
+	p.mutex.Unlock()
+	return err
+}
+
+// setState records the state of the plugin and why its executable last exited, then saves the health file.
+func (p *LongRunningPlugin) setState(log log.T, state string, exitErr error) {
+	p.mutex.Lock()
+	p.health.State = state
+	if exitErr != nil {
+		p.health.LastExitError = exitErr.Error()
+	}
+	p.mutex.Unlock()
+	saveHealth(log)
+}
+
+// heartbeat records that the plugin is alive, any message counts as a heartbeat.
+func (p *LongRunningPlugin) heartbeat() {
+	p.mutex.Lock()
+	p.lastHeartbeat = time.Now()
+	p.mutex.Unlock()
+}
+
+// watchHeartbeats kills the process of a plugin that missed missedHeartbeats heartbeats, until done is closed.
+// The error is sent before the process is killed, runOnce reports it instead of the exit status.
+func (p *LongRunningPlugin) watchHeartbeats(process *process, done <-chan struct{}, missed chan<- error) {
+	interval := time.Duration(p.manifest.HeartbeatSeconds) * heartbeatUnit
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		p.mutex.Lock()
+		silence := time.Since(p.lastHeartbeat)
+		p.mutex.Unlock()
+		if silence > missedHeartbeats*interval {
+			missed <- fmt.Errorf("missed heartbeats, no message for %v", silence)
+			process.kill()
+			return
+		}
+	}
+}
+
+// logMessages writes the status and the output messages of a long-running plugin to the agent log until it exits.
+// alive is called on each message.
+func logMessages(log log.T, pluginName string, in io.Reader, alive func()) {
+	decoder := json.NewDecoder(in)
+	for {
+		var message pluginsdk.Message
+		if err := decoder.Decode(&message); err != nil {
+			if err != io.EOF {
+				log.Warnf("invalid message from %v: %v", pluginName, err)
+				// keep reading, a plugin blocked on its output would never exit
+				io.Copy(ioutil.Discard, in)
+			}
+			return
+		}
+		alive()
+		switch {
+		case message.Type == pluginsdk.MessageHeartbeat:
+		case message.Type == pluginsdk.MessageStatus && message.Status != nil:
+			log.Infof("%v: %v", pluginName, message.Status.Message)
+		case message.Type == pluginsdk.MessageOutput && message.Output != nil:
+			log.Infof("%v %v: %v", pluginName, message.Output.Stream, message.Output.Data)
+		default:
+			log.Debugf("ignoring message %v from %v", message.Type, pluginName)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package external
+
+import (
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+// process is a running plugin executable.
+type process struct {
+	stdin  io.WriteCloser
+	stdout io.Reader
+	wait   func() error
+	kill   func() error
+}
+
+// startProcess starts the executable in the working directory, its standard error is written to the agent log.
+var startProcess = func(log log.T, pluginName string, executable string, workingDirectory string) (*process, error) {
+	command := exec.Command(executable)
+	command.Dir = workingDirectory
+	stdin, err := command.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := command.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	command.Stderr = &logWriter{log: log, prefix: pluginName}
+	if err = command.Start(); err != nil {
+		return nil, err
+	}
+	return &process{
+		stdin:  stdin,
+		stdout: stdout,
+		wait:   command.Wait,
+		kill:   command.Process.Kill,
+	}, nil
+}
+
+// logWriter writes the lines of the standard error of a plugin to the agent log.
+type logWriter struct {
+	log    log.T
+	prefix string
+}
+
+// Write logs each line of p.
+func (w *logWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		w.log.Infof("%v: %v", w.prefix, strings.TrimRight(line, "\r"))
+	}
+	return len(p), nil
+}
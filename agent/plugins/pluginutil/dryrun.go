@@ -0,0 +1,67 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package pluginutil implements some common functions shared by multiple plugins.
+// dryrun contains helpers for plugins reporting what they would do in dry-run mode.
+package pluginutil
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+)
+
+// DryRunReport collects the actions a plugin would perform and the validation errors it found.
+type DryRunReport struct {
+	Actions []string
+	Errors  []string
+}
+
+// AddAction records an action the plugin would perform.
+func (r *DryRunReport) AddAction(format string, params ...interface{}) {
+	r.Actions = append(r.Actions, fmt.Sprintf(format, params...))
+}
+
+// AddError records a validation error.
+func (r *DryRunReport) AddError(format string, params ...interface{}) {
+	r.Errors = append(r.Errors, fmt.Sprintf(format, params...))
+}
+
+// ValidateWorkingDirectory records an error if the given working directory is set but does not exist.
+func (r *DryRunReport) ValidateWorkingDirectory(workingDirectory string) {
+	if workingDirectory != "" && !fileutil.IsDirectory(workingDirectory) {
+		r.AddError("working directory %v does not exist", workingDirectory)
+	}
+}
+
+// Result converts the report into a plugin result. The result is Failed if any validation error was found.
+func (r *DryRunReport) Result() (res contracts.PluginResult) {
+	var output []string
+	for _, action := range r.Actions {
+		output = append(output, contracts.DryRunOutputPrefix+action)
+	}
+	for _, err := range r.Errors {
+		output = append(output, contracts.DryRunOutputPrefix+"error: "+err)
+	}
+	res.Output = strings.Join(output, "\n")
+
+	if len(r.Errors) > 0 {
+		res.Code = 1
+		res.Status = contracts.ResultStatusFailed
+	} else {
+		res.Status = contracts.ResultStatusSuccess
+	}
+	return
+}
@@ -0,0 +1,164 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package pluginutil implements some common functions shared by multiple plugins.
+// outputartifacts contains functions for publishing the files produced by a step.
+package pluginutil
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+// OutputArtifactsKeyName is the S3 key (under the plugin's output prefix) where artifacts are uploaded.
+const OutputArtifactsKeyName = "artifacts"
+
+// UploadArtifactsToS3BucketExecuter is a function that can upload the artifacts of a step to S3 bucket.
+type UploadArtifactsToS3BucketExecuter func(log log.T, pluginID string, baseDir string, artifactPatterns []string, outputS3BucketName string, outputS3KeyPrefix string) (destinations []string, errs []string)
+
+// recursiveWildcard is the element of a pattern matching any number of directories, e.g. reports/**/*.xml
+const recursiveWildcard = "**"
+
+// CollectArtifacts expands the given glob patterns into the list of regular files they match.
+// Relative patterns are resolved against baseDir, a ** element matches any number of directories.
+// Patterns that match nothing are reported as errors.
+func CollectArtifacts(baseDir string, artifactPatterns []string) (files []string, errs []string) {
+	seen := make(map[string]bool)
+	for _, pattern := range artifactPatterns {
+		if pattern == "" {
+			continue
+		}
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(baseDir, pattern)
+		}
+		matches, err := glob(pattern)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("invalid artifact pattern %v: %v", pattern, err))
+			continue
+		}
+
+		found := false
+		for _, match := range matches {
+			if !fileutil.IsFile(match) {
+				continue
+			}
+			found = true
+			if !seen[match] {
+				seen[match] = true
+				files = append(files, match)
+			}
+		}
+		if !found {
+			errs = append(errs, fmt.Sprintf("no artifact found for pattern %v", pattern))
+		}
+	}
+	sort.Strings(files)
+	return
+}
+
+// UploadArtifactsToS3Bucket uploads the files matching the artifact patterns and returns their S3 destinations.
+// Unlike the stdout/stderr upload this runs synchronously, so that the destinations can be listed in the reply.
+func (p *DefaultPlugin) UploadArtifactsToS3Bucket(log log.T, pluginID string, baseDir string, artifactPatterns []string, outputS3BucketName string, outputS3KeyPrefix string) (destinations []string, errs []string) {
+	if len(artifactPatterns) == 0 {
+		return
+	}
+	if outputS3BucketName == "" {
+		errs = append(errs, "output artifacts were declared but no output S3 bucket is configured for the command")
+		return
+	}
+
+	files, errs := CollectArtifacts(baseDir, artifactPatterns)
+	if len(files) == 0 {
+		return
+	}
+
+	if !p.prepareS3Upload(log, outputS3BucketName, outputS3KeyPrefix) {
+		errs = append(errs, fmt.Sprintf("the agent is not allowed to upload artifacts to s3://%v/%v", outputS3BucketName, outputS3KeyPrefix))
+		return
+	}
+
+	for _, localPath := range files {
+		s3Key := path.Join(outputS3KeyPrefix, pluginID, OutputArtifactsKeyName, artifactKeyName(baseDir, localPath))
+		log.Debugf("Uploading artifact %v to s3://%v/%v", localPath, outputS3BucketName, s3Key)
+		if err := p.scanAndUpload(log, outputS3BucketName, s3Key, localPath); err != nil {
+			log.Errorf("failed uploading artifact %v to s3://%v/%v err:%v", localPath, outputS3BucketName, s3Key, err)
+			errs = append(errs, err.Error())
+			continue
+		}
+		destinations = append(destinations, fmt.Sprintf("s3://%v/%v", outputS3BucketName, s3Key))
+	}
+	return
+}
+
+// glob returns the paths matching a pattern, the first ** element of the pattern matches any number of directories.
+func glob(pattern string) (matches []string, err error) {
+	elements := strings.Split(filepath.ToSlash(pattern), "/")
+	wildcard := -1
+	for i, element := range elements {
+		if element == recursiveWildcard {
+			wildcard = i
+			break
+		}
+	}
+	if wildcard < 0 {
+		return filepath.Glob(pattern)
+	}
+
+	root := filepath.FromSlash(strings.Join(elements[:wildcard], "/"))
+	if root == "" {
+		root = string(filepath.Separator)
+	}
+	rest := filepath.FromSlash(strings.Join(elements[wildcard+1:], "/"))
+	if _, err = filepath.Match(rest, ""); err != nil {
+		return
+	}
+	err = filepath.Walk(root, func(path string, info os.FileInfo, walkErr error) error {
+		if walkErr != nil || info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		if rest == "" {
+			matches = append(matches, path)
+			return nil
+		}
+		// the wildcard stands for the leading directories of the relative path, if any
+		relElements := strings.Split(rel, string(filepath.Separator))
+		for i := range relElements {
+			if matched, _ := filepath.Match(rest, filepath.Join(relElements[i:]...)); matched {
+				matches = append(matches, path)
+				break
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// artifactKeyName returns the key of an artifact relative to the base directory, or its file name
+// when the artifact lives outside of the base directory.
+func artifactKeyName(baseDir string, localPath string) string {
+	if rel, err := filepath.Rel(baseDir, localPath); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.Base(localPath)
+}
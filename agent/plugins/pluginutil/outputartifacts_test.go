@@ -0,0 +1,76 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package pluginutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectArtifacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "artifacts")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "reports"), 0700))
+	for _, name := range []string{"reports/a.xml", "reports/b.xml", "summary.txt"} {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0600))
+	}
+
+	files, errs := CollectArtifacts(dir, []string{"reports/*.xml", filepath.Join(dir, "summary.txt"), "reports/*.xml", "missing.log"})
+
+	assert.Equal(t, []string{
+		filepath.Join(dir, "reports", "a.xml"),
+		filepath.Join(dir, "reports", "b.xml"),
+		filepath.Join(dir, "summary.txt"),
+	}, files)
+	assert.Equal(t, 1, len(errs))
+}
+
+func TestCollectArtifactsRecursively(t *testing.T) {
+	dir, err := ioutil.TempDir("", "artifacts")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "reports", "unit", "engine"), 0700))
+	for _, name := range []string{"reports/a.xml", "reports/unit/b.xml", "reports/unit/engine/c.xml", "reports/unit/engine/c.log"} {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(name), 0600))
+	}
+
+	files, errs := CollectArtifacts(dir, []string{"reports/**/*.xml"})
+	assert.Empty(t, errs)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "reports", "a.xml"),
+		filepath.Join(dir, "reports", "unit", "b.xml"),
+		filepath.Join(dir, "reports", "unit", "engine", "c.xml"),
+	}, files)
+
+	files, errs = CollectArtifacts(dir, []string{"reports/**/engine/*", "reports/unit/**"})
+	assert.Empty(t, errs)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "reports", "unit", "b.xml"),
+		filepath.Join(dir, "reports", "unit", "engine", "c.log"),
+		filepath.Join(dir, "reports", "unit", "engine", "c.xml"),
+	}, files)
+}
+
+func TestArtifactKeyName(t *testing.T) {
+	base := filepath.Join("opt", "work")
+	assert.Equal(t, "reports/a.xml", artifactKeyName(base, filepath.Join(base, "reports", "a.xml")))
+	assert.Equal(t, "a.xml", artifactKeyName(base, filepath.Join("tmp", "a.xml")))
+}
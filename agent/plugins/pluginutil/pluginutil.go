@@ -10,6 +10,7 @@
 package pluginutil
 
 import (
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
@@ -18,8 +19,11 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/aws/amazon-ssm-agent/agent/antimalware"
 	"github.com/aws/amazon-ssm-agent/agent/appconfig"
 	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/dlp"
+	"github.com/aws/amazon-ssm-agent/agent/executers"
 	"github.com/aws/amazon-ssm-agent/agent/fileutil/artifact"
 	"github.com/aws/amazon-ssm-agent/agent/jsonutil"
 	"github.com/aws/amazon-ssm-agent/agent/log"
@@ -27,8 +31,8 @@ import (
 	"github.com/aws/amazon-ssm-agent/agent/platform"
 	"github.com/aws/amazon-ssm-agent/agent/s3util"
 	"github.com/aws/amazon-ssm-agent/agent/sdkutil"
+	"github.com/aws/amazon-ssm-agent/agent/sdkutil/attribution"
 	"github.com/aws/amazon-ssm-agent/agent/task"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
@@ -36,19 +40,54 @@ const (
 	defaultExecutionTimeoutInSeconds = 3600
 	maxExecutionTimeoutInSeconds     = 28800
 	minExecutionTimeoutInSeconds     = 5
+
+	// DocumentTempDirEnvVariable is the environment variable exposing the temporary directory of the document to the commands.
+	DocumentTempDirEnvVariable = "SSM_DOCUMENT_TEMP_DIR"
+
+	// MaxOutputLength caps the length of the stdout and stderr a step can capture.
+	MaxOutputLength = 1024 * 1024
+
+	// FullOutputReferencePrefix introduces the local file holding the full output of a truncated step output.
+	FullOutputReferencePrefix = "--full output saved to "
+
+	// outputReadSize is the size of the chunks the end of a long output is streamed in.
+	outputReadSize = 32 * 1024
 )
 
 // S3RegionUSStandard is a standard S3 Region used to upload output related documents.
 var S3RegionUSStandard = "us-east-1"
 
-var s3Bjs = "cn-north-1"
+// scanUpload passes the files uploaded to S3 through the DLP scanner of the agent configuration
+var scanUpload = func(log log.T, localPath string) error {
+	return dlp.Default().ScanFile(log, dlp.KindOutput, localPath)
+}
 
-var s3BjsEndpoint = "s3.cn-north-1.amazonaws.com.cn"
+// scanScriptsEnabled returns true if scripts are submitted to the antimalware provider before they run
+var scanScriptsEnabled = func() bool {
+	config, err := appconfig.Config(false)
+	return err == nil && config.Antimalware.ScanScripts
+}
 
-var s3StandardEndpoint = "s3.amazonaws.com"
+// scanScript submits the content of a script to the antimalware provider
+var scanScript = antimalware.ScanScript
 
 // CommandExecuter is a function that can execute a set of commands.
-type CommandExecuter func(log log.T, workingDir string, stdoutFilePath string, stderrFilePath string, cancelFlag task.CancelFlag, executionTimeout int, commandName string, commandArguments []string) (stdout io.Reader, stderr io.Reader, exitCode int, errs []error)
+type CommandExecuter func(log log.T, workingDir string, stdoutFilePath string, stderrFilePath string, cancelFlag task.CancelFlag, executionTimeout int, commandName string, commandArguments []string, options executers.ExecuteOptions) (stdout io.Reader, stderr io.Reader, exitCode int, errs []error)
+
+// configuredResourceLimits returns the limits of the processes of the plugins in the agent configuration
+var configuredResourceLimits = func() map[string]appconfig.ResourceLimitsCfg {
+	config, err := appconfig.Config(false)
+	if err != nil {
+		return nil
+	}
+	return config.Sandbox.Plugins
+}
+
+// ResourceLimitsFor returns the limits of the processes of a plugin: the limits configured for the plugin in the agent
+// configuration, overridden by the limits set in the document.
+func ResourceLimitsFor(pluginName string, document executers.ResourceLimits) executers.ResourceLimits {
+	return executers.ResourceLimits(configuredResourceLimits()[pluginName]).Override(document)
+}
 
 // UploadOutputToS3BucketExecuter is a function that can upload outputs to S3 bucket.
 type UploadOutputToS3BucketExecuter func(log log.T, pluginID string, orchestrationDir string, outputS3BucketName string, outputS3KeyPrefix string, useTempDirectory bool, tempDir string, Stdout string, Stderr string) []string
@@ -72,6 +111,9 @@ type DefaultPlugin struct {
 	// ExecuteUploadOutputToS3Bucket is an object that can upload command outputs to S3 bucket.
 	ExecuteUploadOutputToS3Bucket UploadOutputToS3BucketExecuter
 
+	// ExecuteUploadArtifactsToS3Bucket is an object that can upload the artifacts declared by a step to S3 bucket.
+	ExecuteUploadArtifactsToS3Bucket UploadArtifactsToS3BucketExecuter
+
 	// Uploader is an object that can upload data to s3.
 	Uploader S3Uploader
 
@@ -93,6 +135,9 @@ type DefaultPlugin struct {
 
 	// OutputTruncatedSuffix is an optional suffix that is inserted at the end of the truncated stdout/stderr.
 	OutputTruncatedSuffix string
+
+	// SpillFullOutput references the local files holding the full stdout/stderr of the steps exceeding the maximum lengths.
+	SpillFullOutput bool
 }
 
 // PluginConfig is used for initializing plugins with default values
@@ -102,6 +147,78 @@ type PluginConfig struct {
 	MaxStdoutLength       int
 	MaxStderrLength       int
 	OutputTruncatedSuffix string
+	SpillFullOutput       bool
+}
+
+// PowerShellEnvironmentVariableCommand returns the PowerShell command setting the environment variable to the given value.
+func PowerShellEnvironmentVariableCommand(name string, value string) string {
+	return fmt.Sprintf("$env:%v = %v", name, PowerShellQuote(value))
+}
+
+// ShellQuote returns the value as a single quoted POSIX shell word.
+func ShellQuote(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+// PowerShellQuote returns the value as a single quoted PowerShell string.
+func PowerShellQuote(value string) string {
+	return "'" + strings.Replace(value, "'", "''", -1) + "'"
+}
+
+// MarkAsFailed records the error in the output and marks it as failed.
+func MarkAsFailed(log log.T, out contracts.PluginOutput, err error) contracts.PluginOutput {
+	log.Error(err)
+	out.ExitCode = 1
+	out.Status = contracts.ResultStatusFailed
+	out.Errors = append(out.Errors, err.Error())
+	return out
+}
+
+// ReadOutput returns the output of a step, truncated to the given limit. Unless fullOutputPath is empty, an output
+// longer than the limit keeps both its beginning and its end, and ends with a reference to fullOutputPath,
+// the file the output is read from. The output is streamed, only the bytes returned are kept in memory.
+func ReadOutput(input io.Reader, maxLength int, truncatedSuffix string, fullOutputPath string) (out string, err error) {
+	headLength := (maxLength - len(truncatedSuffix)) / 2
+	tailLength := maxLength - len(truncatedSuffix) - headLength
+	if fullOutputPath == "" || tailLength <= 0 {
+		return ReadPrefix(input, maxLength, truncatedSuffix)
+	}
+
+	// read up to maxLength bytes from input
+	data := make([]byte, maxLength)
+	n, err := io.ReadFull(input, data)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		// no need to truncate
+		return string(data[:n]), nil
+	}
+	if err != nil {
+		return
+	}
+
+	// keep the beginning, and the last tailLength bytes of the rest of the output
+	head := string(data[:headLength])
+	tail := data[headLength:]
+	chunk := make([]byte, outputReadSize)
+	truncated := false
+	for {
+		n, err = input.Read(chunk)
+		truncated = truncated || n > 0
+		tail = append(tail, chunk[:n]...)
+		if len(tail) > tailLength+outputReadSize {
+			tail = append(tail[:0], tail[len(tail)-tailLength:]...)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return
+		}
+	}
+	if !truncated {
+		return string(data), nil
+	}
+	tail = tail[len(tail)-tailLength:]
+	return fmt.Sprintf("%v%v%v\n%v%v", head, truncatedSuffix, string(tail), FullOutputReferencePrefix, fullOutputPath), nil
 }
 
 // ReadPrefix returns the beginning data from a given Reader, truncated to the given limit.
@@ -153,63 +270,33 @@ func GetS3Config() *s3util.Manager {
 	//For other region endpoints, you get a BucketRegionError which is not useful for us in determining where the bucket is present.
 	//Revisit this if S3 ensures the PutObject API behavior consistent over all endpoints - in which case - instead of using IAD endpoint,
 	//we can then pick the endpoint from meta-data instead.
+	//The IAD endpoint only serves the aws partition, in the other partitions the regional endpoint of the instance is used.
 
 	awsConfig := sdkutil.AwsConfig()
 
-	if region, err := platform.Region(); err == nil && region == s3Bjs {
-		awsConfig.Endpoint = &s3BjsEndpoint
-		awsConfig.Region = &s3Bjs
-	} else {
-		awsConfig.Endpoint = &s3StandardEndpoint
-		awsConfig.Region = &S3RegionUSStandard
+	s3Region := S3RegionUSStandard
+	if region, err := platform.Region(); err == nil && usesRegionalS3Endpoint(region) {
+		s3Region = region
 	}
-	s3 := s3.New(session.New(awsConfig))
+	s3Endpoint := platform.PartitionForRegion(s3Region).S3Endpoint(s3Region)
+	awsConfig.Endpoint = &s3Endpoint
+	awsConfig.Region = &s3Region
+	s3 := s3.New(attribution.NewSession(awsConfig))
 	return s3util.NewManager(s3)
 }
 
+// usesRegionalS3Endpoint returns true if outputs are uploaded through the S3 endpoint of the instance region,
+// which is the case outside of the aws partition.
+func usesRegionalS3Endpoint(region string) bool {
+	return platform.PartitionForRegion(region).ID != platform.PartitionAws
+}
+
 // UploadOutputToS3Bucket uploads outputs (if any) to s3
 func (p *DefaultPlugin) UploadOutputToS3Bucket(log log.T, pluginID string, orchestrationDir string, outputS3BucketName string, outputS3KeyPrefix string, useTempDirectory bool, tempDir string, Stdout string, Stderr string) []string {
 	var uploadOutputToS3BucketErrors []string
 	if outputS3BucketName != "" {
 		uploadOutputsToS3 := func() {
-			uploadToS3 := true
-			var testUploadError error
-
-			if region, err := platform.Region(); err == nil && region != s3Bjs {
-				p.Uploader.SetS3ClientRegion(S3RegionUSStandard)
-			}
-
-			log.Infof("uploading a test file to s3 bucket - %v , s3 key - %v with S3Client using region endpoint - %v",
-				outputS3BucketName,
-				outputS3KeyPrefix,
-				p.Uploader.GetS3ClientRegion())
-
-			testUploadError = p.Uploader.UploadS3TestFile(log, outputS3BucketName, outputS3KeyPrefix)
-
-			if testUploadError != nil {
-				//Check if the error is related to Access Denied - i.e missing permissions
-				if p.Uploader.IsS3ErrorRelatedToAccessDenied(testUploadError.Error()) {
-					log.Debugf("encountered access denied related error - can't upload to S3 due to missing permissions -%v", testUploadError.Error())
-					uploadToS3 = false
-					//since we don't have permissions - no S3 calls will go through no matter what
-				} else if p.Uploader.IsS3ErrorRelatedToWrongBucketRegion(testUploadError.Error()) { //check if error is related to different bucket region
-
-					log.Debugf("encountered error related to wrong bucket region while uploading test file to S3 - %v. parsing the message to get expected region",
-						testUploadError.Error())
-
-					expectedBucketRegion := p.Uploader.GetS3BucketRegionFromErrorMsg(log, testUploadError.Error())
-
-					//set the region to expectedBucketRegion
-					p.Uploader.SetS3ClientRegion(expectedBucketRegion)
-				} else {
-					log.Debugf("encountered unexpected error while uploading test file to S3 - %v, no need to modify s3client", testUploadError.Error())
-				}
-			} else { //there were no errors while uploading a test file to S3 - our s3client should continue to use "us-east-1"
-
-				log.Debugf("there were no errors while uploading a test file to S3 in region - %v. S3 client will continue to use region - %v",
-					S3RegionUSStandard,
-					p.Uploader.GetS3ClientRegion())
-			}
+			uploadToS3 := p.prepareS3Upload(log, outputS3BucketName, outputS3KeyPrefix)
 
 			if uploadToS3 {
 				log.Infof("uploading logs to S3 with client configured to use region - %v", p.Uploader.GetS3ClientRegion())
@@ -223,7 +310,7 @@ func (p *DefaultPlugin) UploadOutputToS3Bucket(log log.T, pluginID string, orche
 					localPath := filepath.Join(orchestrationDir, p.StdoutFileName)
 					s3Key := path.Join(outputS3KeyPrefix, pluginID, p.StdoutFileName)
 					log.Debugf("Uploading %v to s3://%v/%v", localPath, outputS3BucketName, s3Key)
-					err := p.Uploader.S3Upload(outputS3BucketName, s3Key, localPath)
+					err := p.scanAndUpload(log, outputS3BucketName, s3Key, localPath)
 					if err != nil {
 
 						log.Errorf("failed uploading %v to s3://%v/%v err:%v", localPath, outputS3BucketName, s3Key, err)
@@ -238,7 +325,7 @@ func (p *DefaultPlugin) UploadOutputToS3Bucket(log log.T, pluginID string, orche
 					localPath := filepath.Join(orchestrationDir, p.StderrFileName)
 					s3Key := path.Join(outputS3KeyPrefix, pluginID, p.StderrFileName)
 					log.Debugf("Uploading %v to s3://%v/%v", localPath, outputS3BucketName, s3Key)
-					err := p.Uploader.S3Upload(outputS3BucketName, s3Key, localPath)
+					err := p.scanAndUpload(log, outputS3BucketName, s3Key, localPath)
 					if err != nil {
 						log.Errorf("failed uploading %v to s3://%v/%v err:%v", localPath, outputS3BucketName, s3Key, err)
 						if p.UploadToS3Sync {
@@ -263,6 +350,76 @@ func (p *DefaultPlugin) UploadOutputToS3Bucket(log log.T, pluginID string, orche
 	return uploadOutputToS3BucketErrors
 }
 
+// ScanScriptFileForMalware submits the script file to the antimalware provider when script scanning is enabled.
+// It returns an antimalware.BlockedError when the provider flags the script. Scripts that cannot be scanned,
+// for instance because the provider is not available, are logged and allowed to run.
+func ScanScriptFileForMalware(log log.T, scriptPath string) error {
+	if !scanScriptsEnabled() {
+		return nil
+	}
+	content, err := ioutil.ReadFile(scriptPath)
+	if err != nil {
+		return err
+	}
+	if err = scanScript(scriptPath, string(content)); err != nil && !antimalware.IsBlocked(err) {
+		log.Warnf("unable to scan %v for malware, running it anyway: %v", scriptPath, err)
+		return nil
+	}
+	return err
+}
+
+// scanAndUpload passes the file through the DLP scanner, if one is configured, before uploading it to S3.
+func (p *DefaultPlugin) scanAndUpload(log log.T, bucketName string, s3Key string, localPath string) error {
+	if err := scanUpload(log, localPath); err != nil {
+		return fmt.Errorf("%v was not uploaded: %v", localPath, err)
+	}
+	return p.Uploader.S3Upload(bucketName, s3Key, localPath)
+}
+
+// prepareS3Upload uploads a test file to the bucket and points the S3 client to the bucket's region.
+// It returns false if the agent lacks the permissions to upload to the bucket.
+func (p *DefaultPlugin) prepareS3Upload(log log.T, outputS3BucketName string, outputS3KeyPrefix string) (uploadToS3 bool) {
+	uploadToS3 = true
+	var testUploadError error
+
+	if region, err := platform.Region(); err == nil && !usesRegionalS3Endpoint(region) {
+		p.Uploader.SetS3ClientRegion(S3RegionUSStandard)
+	}
+
+	log.Infof("uploading a test file to s3 bucket - %v , s3 key - %v with S3Client using region endpoint - %v",
+		outputS3BucketName,
+		outputS3KeyPrefix,
+		p.Uploader.GetS3ClientRegion())
+
+	testUploadError = p.Uploader.UploadS3TestFile(log, outputS3BucketName, outputS3KeyPrefix)
+
+	if testUploadError != nil {
+		//Check if the error is related to Access Denied - i.e missing permissions
+		if p.Uploader.IsS3ErrorRelatedToAccessDenied(testUploadError.Error()) {
+			log.Debugf("encountered access denied related error - can't upload to S3 due to missing permissions -%v", testUploadError.Error())
+			uploadToS3 = false
+			//since we don't have permissions - no S3 calls will go through no matter what
+		} else if p.Uploader.IsS3ErrorRelatedToWrongBucketRegion(testUploadError.Error()) { //check if error is related to different bucket region
+
+			log.Debugf("encountered error related to wrong bucket region while uploading test file to S3 - %v. parsing the message to get expected region",
+				testUploadError.Error())
+
+			expectedBucketRegion := p.Uploader.GetS3BucketRegionFromErrorMsg(log, testUploadError.Error())
+
+			//set the region to expectedBucketRegion
+			p.Uploader.SetS3ClientRegion(expectedBucketRegion)
+		} else {
+			log.Debugf("encountered unexpected error while uploading test file to S3 - %v, no need to modify s3client", testUploadError.Error())
+		}
+	} else { //there were no errors while uploading a test file to S3 - our s3client should continue to use "us-east-1"
+
+		log.Debugf("there were no errors while uploading a test file to S3 in region - %v. S3 client will continue to use region - %v",
+			S3RegionUSStandard,
+			p.Uploader.GetS3ClientRegion())
+	}
+	return
+}
+
 // DeleteDirectory deletes a directory and all its content.
 func DeleteDirectory(log log.T, dirName string) {
 	if err := os.RemoveAll(dirName); err != nil {
@@ -335,6 +492,38 @@ func DefaultPluginConfig() PluginConfig {
 	}
 }
 
+// configuredOutputLimits returns the limits of the output of the plugins in the agent configuration
+var configuredOutputLimits = func() map[string]appconfig.OutputLimitsCfg {
+	config, err := appconfig.Config(false)
+	if err != nil {
+		return nil
+	}
+	return config.Output.Plugins
+}
+
+// PluginConfigFor returns the default values for the plugin, with the output limits configured for the plugin
+// in the agent configuration. Limits outside of [1, MaxOutputLength] are ignored.
+func PluginConfigFor(pluginName string) PluginConfig {
+	pluginConfig := DefaultPluginConfig()
+	limits := configuredOutputLimits()[pluginName]
+	if ValidateOutputLength(limits.MaxStdoutLength) == nil {
+		pluginConfig.MaxStdoutLength = limits.MaxStdoutLength
+	}
+	if ValidateOutputLength(limits.MaxStderrLength) == nil {
+		pluginConfig.MaxStderrLength = limits.MaxStderrLength
+	}
+	pluginConfig.SpillFullOutput = limits.SpillToFile
+	return pluginConfig
+}
+
+// ValidateOutputLength checks that a maximum output length is in [1, MaxOutputLength].
+func ValidateOutputLength(length int) error {
+	if length < 1 || length > MaxOutputLength {
+		return fmt.Errorf("output length %v is not between 1 and %v", length, MaxOutputLength)
+	}
+	return nil
+}
+
 // PersistPluginInformationToCurrent persists the plugin execution results
 func PersistPluginInformationToCurrent(log log.T, pluginName string, config contracts.Configuration, res contracts.PluginResult) {
 	//Every plugin should persist information inside the execute method.
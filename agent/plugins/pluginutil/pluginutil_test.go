@@ -11,11 +11,18 @@ package pluginutil
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/aws/amazon-ssm-agent/agent/antimalware"
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
 	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/executers"
 	"github.com/aws/amazon-ssm-agent/agent/log"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -119,3 +126,114 @@ func TestValidateExecutionTimeout(t *testing.T) {
 	num = ValidateExecutionTimeout(logger, input)
 	assert.Equal(t, defaultExecutionTimeoutInSeconds, num)
 }
+
+func TestDryRunReportResult(t *testing.T) {
+	var report DryRunReport
+	report.AddAction("would run %v", "ls")
+	res := report.Result()
+	assert.Equal(t, contracts.ResultStatusSuccess, res.Status)
+	assert.Equal(t, contracts.DryRunOutputPrefix+"would run ls", res.Output)
+
+	report.ValidateWorkingDirectory("/this/directory/does/not/exist")
+	res = report.Result()
+	assert.Equal(t, contracts.ResultStatusFailed, res.Status)
+	assert.Equal(t, 1, res.Code)
+}
+
+// TestScanScriptFileForMalware tests that only the scripts flagged by the antimalware provider are blocked.
+func TestScanScriptFileForMalware(t *testing.T) {
+	file, err := ioutil.TempFile("", "script")
+	assert.Nil(t, err)
+	defer os.Remove(file.Name())
+	file.WriteString("Invoke-Mimikatz")
+	file.Close()
+
+	var scanned string
+	defaultScanScriptsEnabled := scanScriptsEnabled
+	scanScriptsEnabled = func() bool { return true }
+	defer func() {
+		scanScriptsEnabled = defaultScanScriptsEnabled
+		scanScript = antimalware.ScanScript
+	}()
+	logger := log.NewMockLog()
+
+	scanScript = func(contentName string, content string) error {
+		scanned = content
+		return &antimalware.BlockedError{ContentName: contentName, Result: 32768}
+	}
+	err = ScanScriptFileForMalware(logger, file.Name())
+	assert.True(t, antimalware.IsBlocked(err))
+	assert.Equal(t, "Invoke-Mimikatz", scanned)
+
+	// scripts which cannot be scanned are allowed to run
+	scanScript = func(contentName string, content string) error { return errors.New("AMSI is not available") }
+	assert.Nil(t, ScanScriptFileForMalware(logger, file.Name()))
+
+	// nothing is scanned when scanning is disabled
+	scanScriptsEnabled = func() bool { return false }
+	scanned = ""
+	assert.Nil(t, ScanScriptFileForMalware(logger, file.Name()))
+	assert.Equal(t, "", scanned)
+}
+
+// TestResourceLimitsFor tests that the limits of the document override the limits of the agent configuration.
+func TestResourceLimitsFor(t *testing.T) {
+	defer func(original func() map[string]appconfig.ResourceLimitsCfg) { configuredResourceLimits = original }(configuredResourceLimits)
+	configuredResourceLimits = func() map[string]appconfig.ResourceLimitsCfg {
+		return map[string]appconfig.ResourceLimitsCfg{
+			"aws:runShellScript": {CPUShares: 512, MemoryLimitMB: 1024, Niceness: 10},
+		}
+	}
+
+	assert.Equal(t, executers.ResourceLimits{CPUShares: 512, MemoryLimitMB: 1024, Niceness: 10}, ResourceLimitsFor("aws:runShellScript", executers.ResourceLimits{}))
+	assert.Equal(t, executers.ResourceLimits{CPUShares: 512, MemoryLimitMB: 256, MaxProcesses: 50, Niceness: 10},
+		ResourceLimitsFor("aws:runShellScript", executers.ResourceLimits{MemoryLimitMB: 256, MaxProcesses: 50}))
+	assert.True(t, ResourceLimitsFor("aws:runChefRecipe", executers.ResourceLimits{}).IsEmpty())
+}
+
+func TestPluginConfigFor(t *testing.T) {
+	defer func(original func() map[string]appconfig.OutputLimitsCfg) { configuredOutputLimits = original }(configuredOutputLimits)
+	configuredOutputLimits = func() map[string]appconfig.OutputLimitsCfg {
+		return map[string]appconfig.OutputLimitsCfg{
+			"aws:runShellScript": {MaxStdoutLength: 10000, MaxStderrLength: MaxOutputLength + 1, SpillToFile: true},
+		}
+	}
+
+	config := PluginConfigFor("aws:runShellScript")
+	assert.Equal(t, 10000, config.MaxStdoutLength)
+	assert.Equal(t, DefaultPluginConfig().MaxStderrLength, config.MaxStderrLength)
+	assert.True(t, config.SpillFullOutput)
+	assert.Equal(t, DefaultPluginConfig(), PluginConfigFor("aws:runChefRecipe"))
+}
+
+func TestQuote(t *testing.T) {
+	assert.Equal(t, `'it'\''s'`, ShellQuote("it's"))
+	assert.Equal(t, `'it''s'`, PowerShellQuote("it's"))
+	assert.Equal(t, `$env:NAME = 'it''s'`, PowerShellEnvironmentVariableCommand("NAME", "it's"))
+}
+
+func TestReadOutput(t *testing.T) {
+	fullPath := filepath.Join("orchestration", "stdout")
+
+	out, err := ReadOutput(strings.NewReader("a secret"), 20, "--cut--", fullPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "a secret", out)
+
+	out, err = ReadOutput(strings.NewReader("the output is exactly"), 21, "--cut--", fullPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "the output is exactly", out)
+
+	out, err = ReadOutput(strings.NewReader("the secret output is too long"), 20, "--cut--", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "the secret ou--cut--", out)
+
+	out, err = ReadOutput(strings.NewReader("the secret output is too long"), 20, "--cut--", fullPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "the se--cut--oo long\n"+FullOutputReferencePrefix+fullPath, out)
+
+	// the end of the output is streamed in chunks
+	long := "start" + strings.Repeat("-", 3*outputReadSize+7) + "end"
+	out, err = ReadOutput(strings.NewReader(long), 14, "..", fullPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "start-..---end\n"+FullOutputReferencePrefix+fullPath, out)
+}
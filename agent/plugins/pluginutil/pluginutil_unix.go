@@ -14,8 +14,12 @@
 package pluginutil
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/aws/amazon-ssm-agent/agent/appconfig"
 	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/executers"
 	"github.com/aws/amazon-ssm-agent/agent/task"
 )
 
@@ -23,7 +27,7 @@ const (
 	// RunCommandScriptName is the script name where all downloaded or provided commands will be stored
 	RunCommandScriptName               = "_script.sh"
 	ExitCodeTrap                       = ""
-	CommandStoppedPreemptivelyExitCode = 137 // Fatal error (128) + signal for SIGKILL (9) = 137
+	CommandStoppedPreemptivelyExitCode = executers.CommandStoppedPreemptivelyExitCode
 )
 
 var ShellCommand = "sh"
@@ -54,3 +58,8 @@ func GetShellCommand() string {
 func GetShellArguments() []string {
 	return ShellArgs
 }
+
+// EnvironmentVariableCommand returns the shell command setting the environment variable to the given value.
+func EnvironmentVariableCommand(name string, value string) string {
+	return fmt.Sprintf("export %v='%v'", name, strings.Replace(value, "'", `'\''`, -1))
+}
@@ -20,6 +20,7 @@ import (
 
 	"github.com/aws/amazon-ssm-agent/agent/appconfig"
 	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/executers"
 	"github.com/aws/amazon-ssm-agent/agent/task"
 )
 
@@ -34,7 +35,7 @@ const (
 	// if we want to run multiple commands then we need to run them via shell and not directly the command.
 	// https://groups.google.com/forum/#!topic/golang-nuts/ggd3ww3ZKcI
 	ExitCodeTrap                       = " ; exit $LASTEXITCODE"
-	CommandStoppedPreemptivelyExitCode = -1
+	CommandStoppedPreemptivelyExitCode = executers.CommandStoppedPreemptivelyExitCode
 )
 
 var PowerShellCommand = filepath.Join(os.Getenv("SystemRoot"), "System32", "WindowsPowerShell", "v1.0", "powershell.exe")
@@ -66,3 +67,8 @@ func GetShellCommand() string {
 func GetShellArguments() []string {
 	return strings.Split(PowerShellArgs, " ")
 }
+
+// EnvironmentVariableCommand returns the powershell command setting the environment variable to the given value.
+func EnvironmentVariableCommand(name string, value string) string {
+	return PowerShellEnvironmentVariableCommand(name, value)
+}
@@ -17,9 +17,12 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/aws/amazon-ssm-agent/agent/antimalware"
 	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/audit"
 	"github.com/aws/amazon-ssm-agent/agent/context"
 	"github.com/aws/amazon-ssm-agent/agent/contracts"
 	"github.com/aws/amazon-ssm-agent/agent/executers"
@@ -49,6 +52,27 @@ type PSModulePluginInput struct {
 	Source           string
 	SourceHash       string
 	SourceHashType   string
+	OutputArtifacts  []string
+
+	// ModuleName installs the module from a PowerShell repository with Install-Module, instead of the zip of Source.
+	// RequiredVersion, or MinimumVersion and MaximumVersion, constrain the version installed.
+	ModuleName      string
+	RequiredVersion string
+	MinimumVersion  string
+	MaximumVersion  string
+
+	// Repository is the repository the module is installed from, PSGallery by default. With RepositoryUrl, a private
+	// NuGet feed is registered under that name unless a repository of that name is already registered.
+	Repository    string
+	RepositoryUrl string
+
+	// RepositoryUsername and RepositoryCredentialParameter, the Parameter Store parameter holding the password or
+	// the API key, authenticate to the repository.
+	RepositoryUsername            string
+	RepositoryCredentialParameter string
+
+	// RepositoryCertificateThumbprints pins the certificate of the repository while the module is installed.
+	RepositoryCertificateThumbprints []string
 }
 
 // PSModulePluginOutput represents the output of the plugin
@@ -79,6 +103,7 @@ func NewPlugin(pluginConfig pluginutil.PluginConfig) (*Plugin, error) {
 	plugin.OutputTruncatedSuffix = pluginConfig.OutputTruncatedSuffix
 	plugin.Uploader = pluginutil.GetS3Config()
 	plugin.ExecuteUploadOutputToS3Bucket = pluginutil.UploadOutputToS3BucketExecuter(plugin.UploadOutputToS3Bucket)
+	plugin.ExecuteUploadArtifactsToS3Bucket = pluginutil.UploadArtifactsToS3BucketExecuter(plugin.UploadArtifactsToS3Bucket)
 
 	exec := executers.ShellCommandExecuter{}
 	plugin.ExecuteCommand = pluginutil.CommandExecuter(exec.Execute)
@@ -143,6 +168,62 @@ func (p *Plugin) Execute(context context.T, config contracts.Configuration, canc
 	return res
 }
 
+// DryRun downloads and verifies the module sources and reports the commands that would be executed, without running them.
+func (p *Plugin) DryRun(context context.T, config contracts.Configuration) (res contracts.PluginResult) {
+	log := context.Log()
+	log.Infof("%v dry run with configuration %v", Name(), config)
+
+	var properties []interface{}
+	if properties, res = pluginutil.LoadParametersAsList(log, config.Properties); res.Code != 0 {
+		pluginutil.PersistPluginInformationToCurrent(log, Name(), config, res)
+		return res
+	}
+
+	var report pluginutil.DryRunReport
+	for _, prop := range properties {
+		var pluginInput PSModulePluginInput
+		if err := jsonutil.Remarshal(prop, &pluginInput); err != nil {
+			report.AddError("invalid format in plugin properties %v; error %v", prop, err)
+			continue
+		}
+		report.ValidateWorkingDirectory(pluginInput.WorkingDirectory)
+		if err := validateModuleInput(pluginInput); err != nil {
+			report.AddError("%v", err)
+			continue
+		}
+
+		if pluginInput.ModuleName != "" {
+			repository := pluginInput.Repository
+			if repository == "" {
+				repository = defaultRepository
+			}
+			report.AddAction("%v would install module %v %v from repository %v", Name(), pluginInput.ModuleName,
+				versionConstraint(pluginInput), repository)
+		} else {
+			downloadOutput, err := pluginutil.DownloadFileFromSource(log, pluginInput.Source, pluginInput.SourceHash, pluginInput.SourceHashType)
+			if err != nil || downloadOutput.IsHashMatched == false || downloadOutput.LocalFilePath == "" {
+				report.AddError("failed to download file reliably %v", pluginInput.Source)
+				continue
+			}
+			report.AddAction("%v would install module %v into %v", Name(), pluginInput.Source, PowerShellModulesDirectory)
+		}
+
+		executionTimeout := pluginutil.ValidateExecutionTimeout(log, pluginInput.TimeoutSeconds)
+		report.AddAction("%v would run %v command(s) with timeout %vs, working directory %q:",
+			Name(), len(pluginInput.RunCommand), executionTimeout, pluginInput.WorkingDirectory)
+		for _, command := range pluginInput.RunCommand {
+			report.AddAction("  %v", command)
+		}
+		if len(pluginInput.OutputArtifacts) > 0 {
+			report.AddAction("%v would upload artifacts matching %v", Name(), pluginInput.OutputArtifacts)
+		}
+	}
+
+	res = report.Result()
+	pluginutil.PersistPluginInformationToCurrent(log, Name(), config, res)
+	return res
+}
+
 // runCommandsRawInput executes one set of commands and returns their output.
 // The input is in the default json unmarshal format (e.g. map[string]interface{}).
 func (p *Plugin) runCommandsRawInput(log log.T, rawPluginInput interface{}, orchestrationDirectory string, cancelFlag task.CancelFlag, outputS3BucketName string, outputS3KeyPrefix string) (out PSModulePluginOutput) {
@@ -183,26 +264,57 @@ func (p *Plugin) runCommands(log log.T, pluginInput PSModulePluginInput, orchest
 		return
 	}
 
+	if err = validateModuleInput(pluginInput); err != nil {
+		out.MarkAsFailed(log, err)
+		return
+	}
+
+	// Modules of a repository are installed by the script, before the commands
+	commands := pluginInput.RunCommand
+	var envVars map[string]string
+	if pluginInput.ModuleName != "" {
+		var installCommands []string
+		if installCommands, envVars, err = installModuleCommands(log, pluginInput); err != nil {
+			out.MarkAsFailed(log, err)
+			return
+		}
+		commands = append(installCommands, commands...)
+	}
+
 	// Create script file path
 	scriptPath := filepath.Join(orchestrationDir, pluginutil.RunCommandScriptName)
 	log.Debugf("Writing commands %v to file %v", pluginInput, scriptPath)
 
 	// Create script file
-	if err = pluginutil.CreateScriptFile(log, scriptPath, pluginInput.RunCommand); err != nil {
+	if err = pluginutil.CreateScriptFile(log, scriptPath, commands); err != nil {
 		out.Errors = append(out.Errors, err.Error())
 		log.Errorf("failed to create script file. %v", err)
 		return
 	}
 
-	// Download file from source if available
-	downloadOutput, err := pluginutil.DownloadFileFromSource(log, pluginInput.Source, pluginInput.SourceHash, pluginInput.SourceHashType)
-	if err != nil || downloadOutput.IsHashMatched == false || downloadOutput.LocalFilePath == "" {
-		errorString := fmt.Errorf("failed to download file reliably %v", pluginInput.Source)
-		out.MarkAsFailed(log, errorString)
+	// Submit the script to the antimalware provider
+	if err = pluginutil.ScanScriptFileForMalware(log, scriptPath); err != nil {
+		out.Errors = append(out.Errors, err.Error())
+		out.Status = contracts.ResultStatusFailed
+		if antimalware.IsBlocked(err) {
+			out.Status = contracts.ResultStatusBlockedByAntimalware
+		}
+		out.ExitCode = 1
+		log.Error(err)
 		return
-	} else {
-		// Uncompress the zip file received
-		fileutil.Uncompress(downloadOutput.LocalFilePath, PowerShellModulesDirectory)
+	}
+
+	// Download file from source if available
+	if pluginInput.ModuleName == "" {
+		downloadOutput, err := pluginutil.DownloadFileFromSource(log, pluginInput.Source, pluginInput.SourceHash, pluginInput.SourceHashType)
+		if err != nil || downloadOutput.IsHashMatched == false || downloadOutput.LocalFilePath == "" {
+			errorString := fmt.Errorf("failed to download file reliably %v", pluginInput.Source)
+			out.MarkAsFailed(log, errorString)
+			return
+		} else {
+			// Uncompress the zip file received
+			fileutil.Uncompress(downloadOutput.LocalFilePath, PowerShellModulesDirectory)
+		}
 	}
 
 	// Set execution time
@@ -218,7 +330,7 @@ func (p *Plugin) runCommands(log log.T, pluginInput PSModulePluginInput, orchest
 	commandArguments := append(pluginutil.GetShellArguments(), scriptPath, pluginutil.ExitCodeTrap)
 
 	// Execute Command
-	stdout, stderr, exitCode, errs := p.ExecuteCommand(log, pluginInput.WorkingDirectory, stdoutFilePath, stderrFilePath, cancelFlag, executionTimeout, commandName, commandArguments)
+	stdout, stderr, exitCode, errs := p.ExecuteCommand(log, pluginInput.WorkingDirectory, stdoutFilePath, stderrFilePath, cancelFlag, executionTimeout, commandName, commandArguments, executers.ExecuteOptions{EnvVars: envVars, Limits: pluginutil.ResourceLimitsFor(Name(), executers.ResourceLimits{})})
 
 	// Set output status
 	out.ExitCode = exitCode
@@ -247,11 +359,26 @@ func (p *Plugin) runCommands(log log.T, pluginInput PSModulePluginInput, orchest
 		out.Errors = append(out.Errors, err.Error())
 		log.Error(err)
 	}
+	if password := envVars[repositoryPasswordVariable]; password != "" {
+		out.Stdout = strings.Replace(out.Stdout, password, audit.RedactedValue, -1)
+		out.Stderr = strings.Replace(out.Stderr, password, audit.RedactedValue, -1)
+	}
 
 	// Upload output to S3
 	uploadOutputToS3BucketErrors := p.ExecuteUploadOutputToS3Bucket(log, pluginInput.ID, orchestrationDir, outputS3BucketName, outputS3KeyPrefix, useTempDirectory, tempDir, out.Stdout, out.Stderr)
 	out.Errors = append(out.Errors, uploadOutputToS3BucketErrors...)
 
+	// Upload the artifacts declared by the step
+	if len(pluginInput.OutputArtifacts) > 0 && p.ExecuteUploadArtifactsToS3Bucket != nil {
+		artifactsDir := pluginInput.WorkingDirectory
+		if artifactsDir == "" {
+			artifactsDir = orchestrationDir
+		}
+		var uploadArtifactsErrors []string
+		out.Artifacts, uploadArtifactsErrors = p.ExecuteUploadArtifactsToS3Bucket(log, pluginInput.ID, artifactsDir, pluginInput.OutputArtifacts, outputS3BucketName, outputS3KeyPrefix)
+		out.Errors = append(out.Errors, uploadArtifactsErrors...)
+	}
+
 	// Return Json indented response
 	responseContent, _ := jsonutil.Marshal(out)
 	log.Debug("Returning response:\n", jsonutil.Indent(responseContent))
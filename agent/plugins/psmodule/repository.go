@@ -0,0 +1,174 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the AWS Customer Agreement (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/agreement/
+
+// +build windows
+
+package psmodule
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/pluginutil"
+	"github.com/aws/amazon-ssm-agent/agent/ssm"
+)
+
+const (
+	// defaultRepository is the repository modules are installed from when the input does not name one.
+	defaultRepository = "PSGallery"
+
+	// repositoryPasswordVariable passes the password of the repository to the script, so that it is not written to disk.
+	repositoryPasswordVariable = "SSM_PSMODULE_REPOSITORY_PASSWORD"
+)
+
+var (
+	// getParameter reads the password of the repository from Parameter Store.
+	getParameter = ssm.GetParameter
+
+	moduleVersionFormat = regexp.MustCompile(`^\d+(\.\d+){0,3}(-[0-9A-Za-z.]+)?$`)
+	thumbprintFormat    = regexp.MustCompile(`^[0-9A-Fa-f]{40}$`)
+)
+
+// certificatePinningType validates the certificates of the https connections made while the module is installed
+// against the pinned thumbprints instead of the certificate chain, so that feeds with a private or self-signed
+// certificate can be pinned.
+const certificatePinningType = `Add-Type -TypeDefinition @'
+using System;
+using System.Net;
+using System.Net.Security;
+using System.Security.Cryptography.X509Certificates;
+public static class SsmCertificatePinning {
+    private static string[] thumbprints;
+    public static void Enable(string[] pinned) {
+        thumbprints = pinned;
+        ServicePointManager.ServerCertificateValidationCallback = Validate;
+    }
+    private static bool Validate(object sender, X509Certificate certificate, X509Chain chain, SslPolicyErrors errors) {
+        return certificate != null && Array.IndexOf(thumbprints, certificate.GetCertHashString().ToUpperInvariant()) >= 0;
+    }
+}
+'@`
+
+// validateModuleInput checks the module, its version constraints and the repository it is installed from.
+func validateModuleInput(input PSModulePluginInput) error {
+	if input.ModuleName == "" {
+		if input.Repository != "" || input.RepositoryUrl != "" || input.RequiredVersion != "" || input.MinimumVersion != "" ||
+			input.MaximumVersion != "" || input.RepositoryCredentialParameter != "" || len(input.RepositoryCertificateThumbprints) > 0 {
+			return errors.New("the version constraints and the repository options require a ModuleName")
+		}
+		return nil
+	}
+	if input.Source != "" {
+		return errors.New("Source and ModuleName are exclusive")
+	}
+	if input.RequiredVersion != "" && (input.MinimumVersion != "" || input.MaximumVersion != "") {
+		return errors.New("RequiredVersion excludes MinimumVersion and MaximumVersion")
+	}
+	for _, version := range []string{input.RequiredVersion, input.MinimumVersion, input.MaximumVersion} {
+		if version != "" && !moduleVersionFormat.MatchString(version) {
+			return fmt.Errorf("invalid module version %v", version)
+		}
+	}
+	if (input.RepositoryUsername == "") != (input.RepositoryCredentialParameter == "") {
+		return errors.New("RepositoryUsername and RepositoryCredentialParameter are required together")
+	}
+	if input.RepositoryUrl != "" && input.Repository == "" {
+		return errors.New("RepositoryUrl requires the Repository name it is registered with")
+	}
+	secure := strings.HasPrefix(strings.ToLower(input.RepositoryUrl), "https://")
+	if input.RepositoryCredentialParameter != "" && !secure {
+		return errors.New("credentials are only sent to a repository with an https RepositoryUrl")
+	}
+	if len(input.RepositoryCertificateThumbprints) > 0 && !secure {
+		return errors.New("RepositoryCertificateThumbprints require an https RepositoryUrl")
+	}
+	for _, thumbprint := range input.RepositoryCertificateThumbprints {
+		if !thumbprintFormat.MatchString(thumbprint) {
+			return fmt.Errorf("invalid certificate thumbprint %v, expected 40 hexadecimal characters", thumbprint)
+		}
+	}
+	return nil
+}
+
+// installModuleCommands returns the PowerShell commands installing the module from its repository, run before the
+// commands of the input, and the environment of the script, holding the password read from Parameter Store.
+func installModuleCommands(log log.T, input PSModulePluginInput) (commands []string, envVars map[string]string, err error) {
+	repository := input.Repository
+	if repository == "" {
+		repository = defaultRepository
+	}
+	credential := ""
+	if input.RepositoryCredentialParameter != "" {
+		var password string
+		if password, err = getParameter(log, input.RepositoryCredentialParameter); err != nil {
+			return nil, nil, fmt.Errorf("failed to read the credentials of repository %v from %v: %v", repository, input.RepositoryCredentialParameter, err)
+		}
+		envVars = map[string]string{repositoryPasswordVariable: password}
+		credential = " -Credential $ssmRepositoryCredential"
+	}
+
+	commands = append(commands, "try {",
+		"[Net.ServicePointManager]::SecurityProtocol = [Net.ServicePointManager]::SecurityProtocol -bor [Net.SecurityProtocolType]::Tls12")
+	if len(input.RepositoryCertificateThumbprints) > 0 {
+		var thumbprints []string
+		for _, thumbprint := range input.RepositoryCertificateThumbprints {
+			thumbprints = append(thumbprints, pluginutil.PowerShellQuote(strings.ToUpper(thumbprint)))
+		}
+		commands = append(commands, certificatePinningType,
+			fmt.Sprintf("[SsmCertificatePinning]::Enable(@(%v))", strings.Join(thumbprints, ", ")))
+	}
+	if credential != "" {
+		commands = append(commands,
+			fmt.Sprintf("$ssmRepositoryCredential = New-Object System.Management.Automation.PSCredential(%v, (ConvertTo-SecureString $env:%v -AsPlainText -Force))",
+				pluginutil.PowerShellQuote(input.RepositoryUsername), repositoryPasswordVariable),
+			fmt.Sprintf("Remove-Item Env:\\%v", repositoryPasswordVariable))
+	}
+	if input.RepositoryUrl != "" {
+		commands = append(commands, fmt.Sprintf("if (-not (Get-PSRepository -Name %v -ErrorAction SilentlyContinue)) { Register-PSRepository -Name %v -SourceLocation %v -InstallationPolicy Trusted%v -ErrorAction Stop }",
+			pluginutil.PowerShellQuote(repository), pluginutil.PowerShellQuote(repository), pluginutil.PowerShellQuote(input.RepositoryUrl), credential))
+	}
+
+	install := fmt.Sprintf("Install-Module -Name %v -Repository %v -Scope AllUsers -Force%v", pluginutil.PowerShellQuote(input.ModuleName), pluginutil.PowerShellQuote(repository), credential)
+	for _, constraint := range []struct{ name, version string }{
+		{"RequiredVersion", input.RequiredVersion},
+		{"MinimumVersion", input.MinimumVersion},
+		{"MaximumVersion", input.MaximumVersion},
+	} {
+		if constraint.version != "" {
+			install += fmt.Sprintf(" -%v %v", constraint.name, pluginutil.PowerShellQuote(constraint.version))
+		}
+	}
+	commands = append(commands, install+" -ErrorAction Stop",
+		"} catch {",
+		fmt.Sprintf("Write-Error (\"failed to install module {0}: {1}\" -f %v, $_)", pluginutil.PowerShellQuote(input.ModuleName)),
+		"exit 1",
+		"}")
+	if len(input.RepositoryCertificateThumbprints) > 0 {
+		// the commands of the input validate certificates as usual
+		commands = append(commands, "[Net.ServicePointManager]::ServerCertificateValidationCallback = $null")
+	}
+	return
+}
+
+// versionConstraint describes the version constraints of the module, e.g. "version >= 1.2".
+func versionConstraint(input PSModulePluginInput) string {
+	switch {
+	case input.RequiredVersion != "":
+		return "version " + input.RequiredVersion
+	case input.MinimumVersion != "" && input.MaximumVersion != "":
+		return fmt.Sprintf("version >= %v and <= %v", input.MinimumVersion, input.MaximumVersion)
+	case input.MinimumVersion != "":
+		return "version >= " + input.MinimumVersion
+	case input.MaximumVersion != "":
+		return "version <= " + input.MaximumVersion
+	}
+	return "latest version"
+}
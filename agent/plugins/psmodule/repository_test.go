@@ -0,0 +1,91 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the AWS Customer Agreement (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/agreement/
+
+// +build windows
+
+package psmodule
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateModuleInput(t *testing.T) {
+	thumbprint := strings.Repeat("ab", 20)
+	valid := []PSModulePluginInput{
+		{Source: "https://example.com/module.zip"},
+		{ModuleName: "Acme.Tools", MinimumVersion: "1.2", MaximumVersion: "1.9.3"},
+		{ModuleName: "Acme.Tools", RequiredVersion: "2.0.0-beta1", Repository: "Acme", RepositoryUrl: "https://nuget.example.com/api/v2",
+			RepositoryUsername: "deploy", RepositoryCredentialParameter: "/acme/nuget", RepositoryCertificateThumbprints: []string{thumbprint}},
+	}
+	for _, input := range valid {
+		assert.Nil(t, validateModuleInput(input), "%+v", input)
+	}
+
+	invalid := []PSModulePluginInput{
+		{Source: "https://example.com/module.zip", RequiredVersion: "1.0"},
+		{Source: "https://example.com/module.zip", ModuleName: "Acme.Tools"},
+		{ModuleName: "Acme.Tools", RequiredVersion: "1.0", MinimumVersion: "0.9"},
+		{ModuleName: "Acme.Tools", MinimumVersion: "latest"},
+		{ModuleName: "Acme.Tools", RepositoryUrl: "https://nuget.example.com/api/v2"},
+		{ModuleName: "Acme.Tools", Repository: "Acme", RepositoryUrl: "https://nuget.example.com/api/v2", RepositoryUsername: "deploy"},
+		{ModuleName: "Acme.Tools", Repository: "Acme", RepositoryUrl: "http://nuget.example.com/api/v2",
+			RepositoryUsername: "deploy", RepositoryCredentialParameter: "/acme/nuget"},
+		{ModuleName: "Acme.Tools", Repository: "Acme", RepositoryUrl: "https://nuget.example.com/api/v2", RepositoryCertificateThumbprints: []string{"ab"}},
+	}
+	for _, input := range invalid {
+		assert.NotNil(t, validateModuleInput(input), "%+v", input)
+	}
+}
+
+func TestInstallModuleCommands(t *testing.T) {
+	original := getParameter
+	defer func() { getParameter = original }()
+	getParameter = func(log log.T, name string) (string, error) {
+		assert.Equal(t, "/acme/nuget", name)
+		return "s3cr3t", nil
+	}
+
+	commands, envVars, err := installModuleCommands(log.NewMockLog(), PSModulePluginInput{
+		ModuleName:                       "Acme.Tools",
+		MinimumVersion:                   "1.2",
+		Repository:                       "Acme's feed",
+		RepositoryUrl:                    "https://nuget.example.com/api/v2",
+		RepositoryUsername:               "deploy",
+		RepositoryCredentialParameter:    "/acme/nuget",
+		RepositoryCertificateThumbprints: []string{strings.Repeat("ab", 20)},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{repositoryPasswordVariable: "s3cr3t"}, envVars)
+	script := strings.Join(commands, "\n")
+	assert.NotContains(t, script, "s3cr3t")
+	assert.Contains(t, script, "[SsmCertificatePinning]::Enable(@('"+strings.Repeat("AB", 20)+"'))")
+	assert.Contains(t, script, "Register-PSRepository -Name 'Acme''s feed' -SourceLocation 'https://nuget.example.com/api/v2'")
+	assert.Contains(t, script, "Install-Module -Name 'Acme.Tools' -Repository 'Acme''s feed' -Scope AllUsers -Force -Credential $ssmRepositoryCredential -MinimumVersion '1.2'")
+
+	commands, envVars, err = installModuleCommands(log.NewMockLog(), PSModulePluginInput{ModuleName: "Acme.Tools"})
+	assert.Nil(t, err)
+	assert.Nil(t, envVars)
+	assert.Contains(t, strings.Join(commands, "\n"), "Install-Module -Name 'Acme.Tools' -Repository 'PSGallery'")
+	assert.NotContains(t, strings.Join(commands, "\n"), "Register-PSRepository")
+
+	getParameter = func(log log.T, name string) (string, error) { return "", errors.New("access denied") }
+	_, _, err = installModuleCommands(log.NewMockLog(), PSModulePluginInput{ModuleName: "Acme.Tools", Repository: "Acme",
+		RepositoryUrl: "https://nuget.example.com/api/v2", RepositoryUsername: "deploy", RepositoryCredentialParameter: "/acme/nuget"})
+	assert.NotNil(t, err)
+}
+
+func TestVersionConstraint(t *testing.T) {
+	assert.Equal(t, "latest version", versionConstraint(PSModulePluginInput{}))
+	assert.Equal(t, "version 1.0", versionConstraint(PSModulePluginInput{RequiredVersion: "1.0"}))
+	assert.Equal(t, "version >= 1.0 and <= 2.0", versionConstraint(PSModulePluginInput{MinimumVersion: "1.0", MaximumVersion: "2.0"}))
+}
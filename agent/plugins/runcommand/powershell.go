@@ -0,0 +1,134 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package runcommand implements the RunCommand plugin.
+// powershell contains the selection of the shell, which lets PowerShell documents choose the edition of PowerShell.
+package runcommand
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/pluginutil"
+)
+
+const (
+	// powerShellEditionCore is PowerShell Core (pwsh), available on all platforms
+	powerShellEditionCore = "core"
+
+	// powerShellEditionDesktop is Windows PowerShell (powershell.exe)
+	powerShellEditionDesktop = "desktop"
+
+	// powerShellScriptName is the name of the script run by PowerShell Core, which requires the .ps1 extension
+	powerShellScriptName = "_script.ps1"
+
+	// powerShellExitCodeCommand makes PowerShell Core exit with the exit code of the last native command
+	powerShellExitCodeCommand = "exit $LASTEXITCODE"
+)
+
+// powerShellCoreArguments are the arguments of pwsh, the path of the script is appended.
+var powerShellCoreArguments = []string{"-InputFormat", "None", "-NonInteractive", "-NoProfile", "-ExecutionPolicy", "Unrestricted", "-File"}
+
+// scriptShell describes how the script of a set of commands is run.
+type scriptShell struct {
+	command    string
+	arguments  []string
+	trailer    []string
+	scriptName string
+	powerShell bool
+	exitCode   string
+}
+
+// commandLine returns the command name and arguments running the script.
+func (s scriptShell) commandLine(scriptPath string) (string, []string) {
+	arguments := make([]string, 0, len(s.arguments)+1+len(s.trailer))
+	arguments = append(arguments, s.arguments...)
+	arguments = append(arguments, scriptPath)
+	arguments = append(arguments, s.trailer...)
+	return s.command, arguments
+}
+
+// environmentVariableCommand returns the command of the shell setting the environment variable to the given value.
+func (s scriptShell) environmentVariableCommand(name string, value string) string {
+	if s.powerShell {
+		return pluginutil.PowerShellEnvironmentVariableCommand(name, value)
+	}
+	return pluginutil.EnvironmentVariableCommand(name, value)
+}
+
+// defaultShell returns the shell of the platform.
+func defaultShell() scriptShell {
+	return scriptShell{
+		command:    pluginutil.GetShellCommand(),
+		arguments:  pluginutil.GetShellArguments(),
+		trailer:    []string{pluginutil.ExitCodeTrap},
+		scriptName: pluginutil.RunCommandScriptName,
+		powerShell: shellIsPowerShell,
+	}
+}
+
+// selectShell returns the shell running the commands of the input. PowerShell plugins use the edition
+// or the path of PowerShell requested by the input, the edition of the platform by default.
+func (p *Plugin) selectShell(pluginInput RunCommandPluginInput) (shell scriptShell, err error) {
+	edition := strings.ToLower(strings.TrimSpace(pluginInput.PowerShellEdition))
+	path := strings.TrimSpace(pluginInput.PowerShellPath)
+	if !p.powerShell {
+		if edition != "" || path != "" {
+			return shell, fmt.Errorf("PowerShellEdition and PowerShellPath are only supported by %v", powerShellPluginName)
+		}
+		return defaultShell(), nil
+	}
+
+	if path == "" {
+		if edition == "" {
+			edition = defaultPowerShellEdition
+		}
+		switch edition {
+		case powerShellEditionDesktop:
+			if !shellIsPowerShell {
+				return shell, fmt.Errorf("Windows PowerShell is not available on %v, use the Core edition", runtime.GOOS)
+			}
+			return defaultShell(), nil
+		case powerShellEditionCore:
+			if path, err = findPowerShellCore(); err != nil {
+				return
+			}
+		default:
+			return shell, fmt.Errorf("unknown PowerShell edition %v, expected Core or Desktop", pluginInput.PowerShellEdition)
+		}
+	}
+
+	return scriptShell{
+		command:    path,
+		arguments:  powerShellCoreArguments,
+		scriptName: powerShellScriptName,
+		powerShell: true,
+		exitCode:   powerShellExitCodeCommand,
+	}, nil
+}
+
+// findPowerShellCore looks for pwsh in the PATH, then in the default installation directories.
+var findPowerShellCore = func() (string, error) {
+	if path, err := exec.LookPath(powerShellCoreCommand); err == nil {
+		return path, nil
+	}
+	for _, location := range powerShellCoreLocations {
+		if fileutil.Exists(location) {
+			return location, nil
+		}
+	}
+	return "", fmt.Errorf("PowerShell Core (%v) is not installed", powerShellCoreCommand)
+}
@@ -0,0 +1,58 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build darwin freebsd linux netbsd openbsd
+
+package runcommand
+
+import (
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/pluginutil"
+)
+
+const (
+	// shellIsPowerShell is false since the scripts of aws:runShellScript are run by sh
+	shellIsPowerShell = false
+
+	// defaultPowerShellEdition is the only edition of PowerShell available on the platform
+	defaultPowerShellEdition = powerShellEditionCore
+
+	// powerShellCoreCommand is the executable of PowerShell Core
+	powerShellCoreCommand = "pwsh"
+
+	// powerShellPluginName is the name of the plugin running PowerShell scripts
+	powerShellPluginName = appconfig.PluginNameAwsRunPowerShellScript
+)
+
+// powerShellCoreLocations are the default installation paths of pwsh, used when it is not in the PATH.
+var powerShellCoreLocations = []string{
+	"/usr/bin/pwsh",
+	"/usr/local/bin/pwsh",
+	"/opt/microsoft/powershell/7/pwsh",
+	"/usr/local/microsoft/powershell/7/pwsh",
+}
+
+// PowerShellName returns the name of the plugin running PowerShell scripts.
+func PowerShellName() string {
+	return powerShellPluginName
+}
+
+// NewPowerShellPlugin returns a new instance of the plugin which runs the commands with PowerShell Core.
+func NewPowerShellPlugin(pluginConfig pluginutil.PluginConfig) (*Plugin, error) {
+	plugin, err := NewPlugin(pluginConfig)
+	if err != nil {
+		return nil, err
+	}
+	plugin.powerShell = true
+	return plugin, nil
+}
@@ -0,0 +1,42 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build windows
+
+package runcommand
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+)
+
+const (
+	// shellIsPowerShell is true since the scripts of aws:runPowerShellScript are run by Windows PowerShell
+	shellIsPowerShell = true
+
+	// defaultPowerShellEdition keeps Windows PowerShell unless the document asks for PowerShell Core
+	defaultPowerShellEdition = powerShellEditionDesktop
+
+	// powerShellCoreCommand is the executable of PowerShell Core
+	powerShellCoreCommand = "pwsh.exe"
+
+	// powerShellPluginName is the name of the plugin running PowerShell scripts
+	powerShellPluginName = appconfig.PluginNameAwsRunScript
+)
+
+// powerShellCoreLocations are the default installation paths of pwsh, used when it is not in the PATH.
+var powerShellCoreLocations = []string{
+	filepath.Join(os.Getenv("ProgramFiles"), "PowerShell", "7", "pwsh.exe"),
+}
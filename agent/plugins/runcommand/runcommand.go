@@ -17,10 +17,17 @@ package runcommand
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/aws/amazon-ssm-agent/agent/antimalware"
 	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/audit"
+	"github.com/aws/amazon-ssm-agent/agent/checkpoint"
 	"github.com/aws/amazon-ssm-agent/agent/context"
 	"github.com/aws/amazon-ssm-agent/agent/contracts"
 	"github.com/aws/amazon-ssm-agent/agent/executers"
@@ -29,21 +36,47 @@ import (
 	"github.com/aws/amazon-ssm-agent/agent/log"
 	"github.com/aws/amazon-ssm-agent/agent/plugins/pluginutil"
 	"github.com/aws/amazon-ssm-agent/agent/rebooter"
+	"github.com/aws/amazon-ssm-agent/agent/snapshot"
 	"github.com/aws/amazon-ssm-agent/agent/task"
 )
 
 // Plugin is the type for the RunCommand plugin.
 type Plugin struct {
 	pluginutil.DefaultPlugin
+
+	// powerShell is true if the plugin runs PowerShell scripts
+	powerShell bool
 }
 
 // RunCommandPluginInput represents one set of commands executed by the RunCommand plugin.
 type RunCommandPluginInput struct {
 	contracts.PluginInput
-	RunCommand       []string
-	ID               string
-	WorkingDirectory string
-	TimeoutSeconds   interface{}
+	RunCommand        []string
+	ID                string
+	WorkingDirectory  string
+	TimeoutSeconds    interface{}
+	OutputArtifacts   []string
+	CpuAffinity       string
+	NumaNode          string
+	Environment       map[string]string
+	RunAsUser         string
+	RunAsGroup        string
+	RunInUserSession  bool
+	PowerShellEdition string
+	PowerShellPath    string
+	CpuShares         interface{}
+	MemoryLimitMB     interface{}
+	MaxProcesses      interface{}
+	Niceness          interface{}
+	MaxStdoutLength   interface{}
+	MaxStderrLength   interface{}
+	SpillFullOutput   *bool
+
+	// ScriptSource is the url of a script in S3, run before RunCommand. The script is streamed to disk, an interrupted
+	// download resumes, and it only runs if it matches ScriptSourceHash, of type ScriptSourceHashType (sha256 by default).
+	ScriptSource         string
+	ScriptSourceHash     string
+	ScriptSourceHashType string
 }
 
 // NewPlugin returns a new instance of the plugin.
@@ -54,11 +87,14 @@ func NewPlugin(pluginConfig pluginutil.PluginConfig) (*Plugin, error) {
 	plugin.StdoutFileName = pluginConfig.StdoutFileName
 	plugin.StderrFileName = pluginConfig.StderrFileName
 	plugin.OutputTruncatedSuffix = pluginConfig.OutputTruncatedSuffix
+	plugin.SpillFullOutput = pluginConfig.SpillFullOutput
 	plugin.Uploader = pluginutil.GetS3Config()
 	plugin.ExecuteUploadOutputToS3Bucket = pluginutil.UploadOutputToS3BucketExecuter(plugin.UploadOutputToS3Bucket)
+	plugin.ExecuteUploadArtifactsToS3Bucket = pluginutil.UploadArtifactsToS3BucketExecuter(plugin.UploadArtifactsToS3Bucket)
 
 	exec := executers.ShellCommandExecuter{}
 	plugin.ExecuteCommand = pluginutil.CommandExecuter(exec.Execute)
+	plugin.powerShell = shellIsPowerShell
 
 	return &plugin, nil
 }
@@ -68,11 +104,35 @@ func Name() string {
 	return appconfig.PluginNameAwsRunScript
 }
 
+// name returns the name the plugin is registered with.
+func (p *Plugin) name() string {
+	if p.powerShell {
+		return powerShellPluginName
+	}
+	return Name()
+}
+
+// runCommandProgress is the progress saved in the checkpoint of a step: the outputs of the sets of commands which completed.
+type runCommandProgress struct {
+	Outputs []contracts.PluginOutput
+}
+
 // Execute runs multiple sets of commands and returns their outputs.
 // res.Output will contain a slice of RunCommandPluginOutput.
 func (p *Plugin) Execute(context context.T, config contracts.Configuration, cancelFlag task.CancelFlag) (res contracts.PluginResult) {
+	return p.execute(context, config, cancelFlag, nil)
+}
+
+// ExecuteWithCheckpoint runs multiple sets of commands like Execute, saving the output of each set which completes in the
+// checkpoints. A step interrupted by a shutdown does not run the completed sets again when it resumes.
+func (p *Plugin) ExecuteWithCheckpoint(context context.T, config contracts.Configuration, cancelFlag task.CancelFlag, checkpoints checkpoint.T) (res contracts.PluginResult) {
+	return p.execute(context, config, cancelFlag, checkpoints)
+}
+
+// execute runs multiple sets of commands, resuming from the checkpoints unless they are nil.
+func (p *Plugin) execute(context context.T, config contracts.Configuration, cancelFlag task.CancelFlag, checkpoints checkpoint.T) (res contracts.PluginResult) {
 	log := context.Log()
-	log.Infof("%v started with configuration %v", Name(), config)
+	log.Infof("%v started with configuration %v", p.name(), config)
 	res.StartDateTime = time.Now()
 	defer func() { res.EndDateTime = time.Now() }()
 
@@ -80,12 +140,26 @@ func (p *Plugin) Execute(context context.T, config contracts.Configuration, canc
 	var properties []interface{}
 	if properties, res = pluginutil.LoadParametersAsList(log, config.Properties); res.Code != 0 {
 
-		pluginutil.PersistPluginInformationToCurrent(log, Name(), config, res)
+		pluginutil.PersistPluginInformationToCurrent(log, p.name(), config, res)
 		return res
 	}
 
+	var progress runCommandProgress
+	if checkpoints != nil {
+		if _, err := checkpoints.Load(&progress); err != nil {
+			log.Warnf("ignoring the checkpoint of %v: %v", p.name(), err)
+			progress = runCommandProgress{}
+		}
+	}
+
 	out := make([]contracts.PluginOutput, len(properties))
 	for i, prop := range properties {
+		if i < len(progress.Outputs) {
+			log.Infof("Set of commands %v completed before the step was interrupted, not running it again", i)
+			out[i] = progress.Outputs[i]
+			continue
+		}
+
 		// check if a reboot has been requested
 		if rebooter.RebootRequested() {
 			log.Info("A plugin has requested a reboot.")
@@ -106,7 +180,19 @@ func (p *Plugin) Execute(context context.T, config contracts.Configuration, canc
 			break
 		}
 
-		out[i] = p.runCommandsRawInput(log, prop, config.OrchestrationDirectory, cancelFlag, config.OutputS3BucketName, config.OutputS3KeyPrefix)
+		out[i] = p.runCommandsRawInput(log, prop, config.OrchestrationDirectory, cancelFlag, config.OutputS3BucketName, config.OutputS3KeyPrefix, config.DocumentTempDirectory)
+		if checkpoints == nil {
+			continue
+		}
+		if cancelFlag.ShutDown() {
+			// the set was interrupted, the step runs it again from the checkpoint when the agent restarts
+			log.Infof("%v interrupted by a shutdown, resuming it after the restart", p.name())
+			return
+		}
+		progress.Outputs = append(progress.Outputs, out[i])
+		if err := checkpoints.Save(progress); err != nil {
+			log.Warnf("failed to save the checkpoint of %v: %v", p.name(), err)
+		}
 	}
 
 	// TODO: instance here we have to do more result processing, where individual sub properties results are merged smartly into plugin response.
@@ -117,14 +203,99 @@ func (p *Plugin) Execute(context context.T, config contracts.Configuration, canc
 		res.Output = out[0].String()
 	}
 
-	pluginutil.PersistPluginInformationToCurrent(log, Name(), config, res)
+	pluginutil.PersistPluginInformationToCurrent(log, p.name(), config, res)
 
 	return res
 }
 
+// DryRun validates the sets of commands and reports how they would be executed, without running them.
+func (p *Plugin) DryRun(context context.T, config contracts.Configuration) (res contracts.PluginResult) {
+	log := context.Log()
+	log.Infof("%v dry run with configuration %v", p.name(), config)
+
+	var properties []interface{}
+	if properties, res = pluginutil.LoadParametersAsList(log, config.Properties); res.Code != 0 {
+		pluginutil.PersistPluginInformationToCurrent(log, p.name(), config, res)
+		return res
+	}
+
+	var report pluginutil.DryRunReport
+	for _, prop := range properties {
+		var pluginInput RunCommandPluginInput
+		if err := jsonutil.Remarshal(prop, &pluginInput); err != nil {
+			report.AddError("invalid format in plugin properties %v; error %v", prop, err)
+			continue
+		}
+		if len(pluginInput.RunCommand) == 0 && pluginInput.ScriptSource == "" {
+			report.AddError("no commands to run for %v", pluginInput.ID)
+			continue
+		}
+		if err := validateScriptSource(log, pluginInput); err != nil {
+			report.AddError("invalid ScriptSource for %v: %v", pluginInput.ID, err)
+			continue
+		}
+		if pluginInput.ScriptSource != "" {
+			report.AddAction("%v would download the script %v and run it if its %v checksum is %v", p.name(),
+				pluginInput.ScriptSource, scriptSourceHashType(pluginInput), pluginInput.ScriptSourceHash)
+		}
+		report.ValidateWorkingDirectory(pluginInput.WorkingDirectory)
+		runAs := executers.RunAs{User: pluginInput.RunAsUser, Group: pluginInput.RunAsGroup, UserSession: pluginInput.RunInUserSession}
+		if err := executers.ValidateRunAs(runAs); err != nil {
+			report.AddError("invalid run as user for %v: %v", pluginInput.ID, err)
+		} else if !runAs.IsEmpty() {
+			report.AddAction("%v would run the commands as user %q, group %q", p.name(), runAs.User, runAs.Group)
+			if runAs.UserSession {
+				report.AddAction("%v would run the commands in the session of user %q", p.name(), runAs.User)
+			}
+		}
+		if err := validateEnvironment(pluginInput.Environment); err != nil {
+			report.AddError("invalid environment for %v: %v", pluginInput.ID, err)
+		} else if len(pluginInput.Environment) > 0 {
+			report.AddAction("%v would set the environment variables %v", p.name(), describeEnvironment(pluginInput.Environment))
+		}
+		affinity := executers.ProcessAffinity{CPUs: pluginInput.CpuAffinity, NumaNode: pluginInput.NumaNode}
+		if err := affinity.Validate(); err != nil {
+			report.AddError("invalid process affinity for %v: %v", pluginInput.ID, err)
+		} else if !affinity.IsEmpty() {
+			report.AddAction("%v would pin the commands to cpus %q, NUMA node %q", p.name(), affinity.CPUs, affinity.NumaNode)
+		}
+		if limits, err := p.resourceLimits(pluginInput); err != nil {
+			report.AddError("invalid resource limits for %v: %v", pluginInput.ID, err)
+		} else if !limits.IsEmpty() {
+			report.AddAction("%v would limit the commands to %v cpu shares, %vMB of memory, %v processes, niceness %v",
+				p.name(), limits.CPUShares, limits.MemoryLimitMB, limits.MaxProcesses, limits.Niceness)
+		}
+		if limits, err := p.outputLimits(pluginInput); err != nil {
+			report.AddError("invalid output limits for %v: %v", pluginInput.ID, err)
+		} else {
+			report.AddAction("%v would return up to %v characters of stdout and %v of stderr, referencing the full output files: %v",
+				p.name(), limits.MaxStdoutLength, limits.MaxStderrLength, limits.SpillFullOutput)
+		}
+
+		shell, err := p.selectShell(pluginInput)
+		if err != nil {
+			report.AddError("invalid shell for %v: %v", pluginInput.ID, err)
+			continue
+		}
+		executionTimeout := pluginutil.ValidateExecutionTimeout(log, pluginInput.TimeoutSeconds)
+		report.AddAction("%v would run %v command(s) with %v %v, timeout %vs, working directory %q:",
+			p.name(), len(pluginInput.RunCommand), shell.command, shell.arguments, executionTimeout, pluginInput.WorkingDirectory)
+		for _, command := range pluginInput.RunCommand {
+			report.AddAction("  %v", command)
+		}
+		if len(pluginInput.OutputArtifacts) > 0 {
+			report.AddAction("%v would upload artifacts matching %v", p.name(), pluginInput.OutputArtifacts)
+		}
+	}
+
+	res = report.Result()
+	pluginutil.PersistPluginInformationToCurrent(log, p.name(), config, res)
+	return res
+}
+
 // runCommandsRawInput executes one set of commands and returns their output.
 // The input is in the default json unmarshal format (e.g. map[string]interface{}).
-func (p *Plugin) runCommandsRawInput(log log.T, rawPluginInput interface{}, orchestrationDirectory string, cancelFlag task.CancelFlag, outputS3BucketName string, outputS3KeyPrefix string) (out contracts.PluginOutput) {
+func (p *Plugin) runCommandsRawInput(log log.T, rawPluginInput interface{}, orchestrationDirectory string, cancelFlag task.CancelFlag, outputS3BucketName string, outputS3KeyPrefix string, documentTempDirectory string) (out contracts.PluginOutput) {
 	var pluginInput RunCommandPluginInput
 	err := jsonutil.Remarshal(rawPluginInput, &pluginInput)
 	if err != nil {
@@ -134,11 +305,12 @@ func (p *Plugin) runCommandsRawInput(log log.T, rawPluginInput interface{}, orch
 		log.Error(errorString)
 		return
 	}
-	return p.runCommands(log, pluginInput, orchestrationDirectory, cancelFlag, outputS3BucketName, outputS3KeyPrefix)
+	return p.runCommands(log, pluginInput, orchestrationDirectory, cancelFlag, outputS3BucketName, outputS3KeyPrefix, documentTempDirectory)
 }
 
 // runCommands executes one set of commands and returns their output.
-func (p *Plugin) runCommands(log log.T, pluginInput RunCommandPluginInput, orchestrationDirectory string, cancelFlag task.CancelFlag, outputS3BucketName string, outputS3KeyPrefix string) (out contracts.PluginOutput) {
+// documentTempDirectory, when set, is exposed to the commands through the DocumentTempDirEnvVariable environment variable.
+func (p *Plugin) runCommands(log log.T, pluginInput RunCommandPluginInput, orchestrationDirectory string, cancelFlag task.CancelFlag, outputS3BucketName string, outputS3KeyPrefix string, documentTempDirectory string) (out contracts.PluginOutput) {
 	var err error
 
 	// if no orchestration directory specified, create temp directory
@@ -163,16 +335,103 @@ func (p *Plugin) runCommands(log log.T, pluginInput RunCommandPluginInput, orche
 		return
 	}
 
+	// Select the shell running the script
+	shell, err := p.selectShell(pluginInput)
+	if err != nil {
+		out.Errors = append(out.Errors, err.Error())
+		out.Status = contracts.ResultStatusFailed
+		out.ExitCode = 1
+		log.Error(err)
+		return
+	}
+
 	// Create script file path
-	scriptPath := filepath.Join(orchestrationDir, pluginutil.RunCommandScriptName)
-	log.Debugf("Writing commands %v to file %v", pluginInput, scriptPath)
+	scriptPath := filepath.Join(orchestrationDir, shell.scriptName)
+
+	// the orchestration directory is only accessible to the agent,
+	// the script of a command running as another user is written where this user can read it
+	runAs := executers.RunAs{User: pluginInput.RunAsUser, Group: pluginInput.RunAsGroup, UserSession: pluginInput.RunInUserSession}
+	var scriptDir string
+	if !runAs.IsEmpty() {
+		if scriptDir, err = ioutil.TempDir("", "Ec2RunCommandAs"); err != nil {
+			out.Errors = append(out.Errors, err.Error())
+			log.Error(err)
+			return
+		}
+		defer os.RemoveAll(scriptDir)
+		scriptPath = filepath.Join(scriptDir, shell.scriptName)
+	}
+	log.Debugf("Writing commands %v to file %v", pluginInput.RunCommand, scriptPath)
+
+	// Download the script run before the commands, next to the script of the commands
+	commands := pluginInput.RunCommand
+	if err = validateScriptSource(log, pluginInput); err != nil {
+		out.Errors = append(out.Errors, err.Error())
+		out.Status = contracts.ResultStatusFailed
+		out.ExitCode = 1
+		log.Error(err)
+		return
+	}
+	var sourcePath string
+	if pluginInput.ScriptSource != "" {
+		if sourcePath, err = fetchScriptSource(log, pluginInput, filepath.Dir(scriptPath), shell); err != nil {
+			out.Errors = append(out.Errors, err.Error())
+			out.Status = contracts.ResultStatusFailed
+			out.ExitCode = 1
+			log.Error(err)
+			return
+		}
+		commands = append([]string{shell.sourceCommand(sourcePath)}, commands...)
+	}
+
+	// Expose the temporary directory of the document to the commands
+	if documentTempDirectory != "" {
+		commands = append([]string{shell.environmentVariableCommand(pluginutil.DocumentTempDirEnvVariable, documentTempDirectory)}, commands...)
+	}
+	if shell.exitCode != "" {
+		commands = append(commands[:len(commands):len(commands)], shell.exitCode)
+	}
 
 	// Create script file
-	if err = pluginutil.CreateScriptFile(log, scriptPath, pluginInput.RunCommand); err != nil {
+	if err = pluginutil.CreateScriptFile(log, scriptPath, commands); err != nil {
 		out.Errors = append(out.Errors, err.Error())
 		log.Errorf("failed to create script file. %v", err)
 		return
 	}
+	if scriptDir != "" {
+		paths := []string{scriptDir, scriptPath}
+		if sourcePath != "" {
+			paths = append(paths, sourcePath)
+		}
+		if err = executers.ChownToRunAs(runAs, paths...); err != nil {
+			out.Errors = append(out.Errors, err.Error())
+			out.Status = contracts.ResultStatusFailed
+			out.ExitCode = 1
+			log.Errorf("failed to give the script file to %v. %v", runAs, err)
+			return
+		}
+	}
+
+	// Submit the scripts to the antimalware provider
+	if err = scanScripts(log, scriptPath, sourcePath); err != nil {
+		out.Errors = append(out.Errors, err.Error())
+		out.Status = contracts.ResultStatusFailed
+		if antimalware.IsBlocked(err) {
+			out.Status = contracts.ResultStatusBlockedByAntimalware
+		}
+		out.ExitCode = 1
+		log.Error(err)
+		return
+	}
+
+	// Environment variables are passed to the process rather than written into the script
+	if err = validateEnvironment(pluginInput.Environment); err != nil {
+		out.Errors = append(out.Errors, err.Error())
+		out.Status = contracts.ResultStatusFailed
+		out.ExitCode = 1
+		log.Error(err)
+		return
+	}
 
 	// Set execution time
 	executionTimeout := pluginutil.ValidateExecutionTimeout(log, pluginInput.TimeoutSeconds)
@@ -183,11 +442,56 @@ func (p *Plugin) runCommands(log log.T, pluginInput RunCommandPluginInput, orche
 	log.Debugf("stdout file %v, stderr file %v", stdoutFilePath, stderrFilePath)
 
 	// Construct Command Name and Arguments
-	commandName := pluginutil.GetShellCommand()
-	commandArguments := append(pluginutil.GetShellArguments(), scriptPath, pluginutil.ExitCodeTrap)
+	commandName, commandArguments := shell.commandLine(scriptPath)
 
-	// Execute Command
-	stdout, stderr, exitCode, errs := p.ExecuteCommand(log, pluginInput.WorkingDirectory, stdoutFilePath, stderrFilePath, cancelFlag, executionTimeout, commandName, commandArguments)
+	// Pin the commands to the requested cpus or NUMA node
+	affinity := executers.ProcessAffinity{CPUs: pluginInput.CpuAffinity, NumaNode: pluginInput.NumaNode}
+	if err = affinity.Validate(); err != nil {
+		out.Errors = append(out.Errors, err.Error())
+		out.Status = contracts.ResultStatusFailed
+		out.ExitCode = 1
+		log.Errorf("failed to set process affinity. %v", err)
+		return
+	}
+
+	// Bound the resources of the commands
+	limits, err := p.resourceLimits(pluginInput)
+	if err != nil {
+		out.Errors = append(out.Errors, err.Error())
+		out.Status = contracts.ResultStatusFailed
+		out.ExitCode = 1
+		log.Errorf("invalid resource limits. %v", err)
+		return
+	}
+
+	// Bound the output returned in the reply
+	outputLimits, err := p.outputLimits(pluginInput)
+	if err != nil {
+		out.Errors = append(out.Errors, err.Error())
+		out.Status = contracts.ResultStatusFailed
+		out.ExitCode = 1
+		log.Errorf("invalid output limits. %v", err)
+		return
+	}
+
+	// Execute Command, the snapshot of the step records the working directory and the environment of the process
+	secrets := secretValues(pluginInput.Environment)
+	recordProcess := func(workingDir string, env []string) {
+		if useTempDirectory {
+			return
+		}
+		if err := snapshot.RecordProcess(orchestrationDirectory, workingDir, env, secrets); err != nil {
+			log.Warnf("unable to record the process in the snapshot of the step: %v", err)
+		}
+	}
+	stdout, stderr, exitCode, errs := p.ExecuteCommand(log, pluginInput.WorkingDirectory, stdoutFilePath, stderrFilePath, cancelFlag, executionTimeout, commandName, commandArguments, executers.ExecuteOptions{
+		EnvVars:     pluginInput.Environment,
+		RunAs:       runAs,
+		Limits:      limits,
+		Affinity:    affinity,
+		Secrets:     secrets,
+		BeforeStart: recordProcess,
+	})
 
 	// Set output status
 	out.ExitCode = exitCode
@@ -205,13 +509,20 @@ func (p *Plugin) runCommands(log log.T, pluginInput RunCommandPluginInput, orche
 		}
 	}
 
-	// read (a prefix of) the standard output/error
-	out.Stdout, err = pluginutil.ReadPrefix(stdout, p.MaxStdoutLength, p.OutputTruncatedSuffix)
+	// read (the beginning and the end of) the standard output/error, the reply references the output files
+	// kept in the orchestration directory if requested.
+	// the secret variables echoed by the commands were masked in the output files by the executer
+	var stdoutFullPath, stderrFullPath string
+	if outputLimits.SpillFullOutput && !useTempDirectory {
+		stdoutFullPath = stdoutFilePath
+		stderrFullPath = stderrFilePath
+	}
+	out.Stdout, err = pluginutil.ReadOutput(stdout, outputLimits.MaxStdoutLength, p.OutputTruncatedSuffix, stdoutFullPath)
 	if err != nil {
 		out.Errors = append(out.Errors, err.Error())
 		log.Error(err)
 	}
-	out.Stderr, err = pluginutil.ReadPrefix(stderr, p.MaxStderrLength, p.OutputTruncatedSuffix)
+	out.Stderr, err = pluginutil.ReadOutput(stderr, outputLimits.MaxStderrLength, p.OutputTruncatedSuffix, stderrFullPath)
 	if err != nil {
 		out.Errors = append(out.Errors, err.Error())
 		log.Error(err)
@@ -221,8 +532,133 @@ func (p *Plugin) runCommands(log log.T, pluginInput RunCommandPluginInput, orche
 	uploadOutputToS3BucketErrors := p.ExecuteUploadOutputToS3Bucket(log, pluginInput.ID, orchestrationDir, outputS3BucketName, outputS3KeyPrefix, useTempDirectory, tempDir, out.Stdout, out.Stderr)
 	out.Errors = append(out.Errors, uploadOutputToS3BucketErrors...)
 
+	// Upload the artifacts declared by the step
+	if len(pluginInput.OutputArtifacts) > 0 && p.ExecuteUploadArtifactsToS3Bucket != nil {
+		artifactsDir := pluginInput.WorkingDirectory
+		if artifactsDir == "" {
+			artifactsDir = orchestrationDir
+		}
+		var uploadArtifactsErrors []string
+		out.Artifacts, uploadArtifactsErrors = p.ExecuteUploadArtifactsToS3Bucket(log, pluginInput.ID, artifactsDir, pluginInput.OutputArtifacts, outputS3BucketName, outputS3KeyPrefix)
+		out.Errors = append(out.Errors, uploadArtifactsErrors...)
+	}
+
 	// Return Json indented response
 	responseContent, _ := jsonutil.Marshal(out)
 	log.Debug("Returning response:\n", jsonutil.Indent(responseContent))
 	return
 }
+
+// validateEnvironment checks that the environment variables can be passed to the process.
+func validateEnvironment(environment map[string]string) error {
+	for name := range environment {
+		if name == "" || strings.ContainsAny(name, "=\x00") {
+			return fmt.Errorf("invalid environment variable name %q", name)
+		}
+	}
+	return nil
+}
+
+// describeEnvironment returns the sorted assignments of the environment variables, with the values of secrets redacted.
+func describeEnvironment(environment map[string]string) []string {
+	var assignments []string
+	for name, value := range environment {
+		if audit.IsSecretName(name) {
+			value = audit.RedactedValue
+		}
+		assignments = append(assignments, name+"="+value)
+	}
+	sort.Strings(assignments)
+	return assignments
+}
+
+// secretValues returns the values of the secret environment variables, the executer masks them in the output.
+func secretValues(environment map[string]string) (secrets []string) {
+	for name, value := range environment {
+		if value != "" && audit.IsSecretName(name) {
+			secrets = append(secrets, value)
+		}
+	}
+	return
+}
+
+// resourceLimits returns the limits of the processes of the commands: the limits configured for the plugin
+// in the agent configuration, overridden by the limits set in the document.
+func (p *Plugin) resourceLimits(pluginInput RunCommandPluginInput) (limits executers.ResourceLimits, err error) {
+	var document executers.ResourceLimits
+	inputs := []struct {
+		name  string
+		value interface{}
+		limit *int
+	}{
+		{"CpuShares", pluginInput.CpuShares, &document.CPUShares},
+		{"MemoryLimitMB", pluginInput.MemoryLimitMB, &document.MemoryLimitMB},
+		{"MaxProcesses", pluginInput.MaxProcesses, &document.MaxProcesses},
+		{"Niceness", pluginInput.Niceness, &document.Niceness},
+	}
+	for _, input := range inputs {
+		if *input.limit, err = parseLimit(input.value); err != nil {
+			return limits, fmt.Errorf("invalid %v: %v", input.name, err)
+		}
+	}
+	limits = pluginutil.ResourceLimitsFor(p.name(), document)
+	err = executers.ValidateResourceLimits(limits)
+	return
+}
+
+// outputLimits returns the limits of the output returned in the reply: the limits of the plugin,
+// overridden by the limits set in the document.
+func (p *Plugin) outputLimits(pluginInput RunCommandPluginInput) (limits pluginutil.PluginConfig, err error) {
+	limits = pluginutil.PluginConfig{
+		MaxStdoutLength: p.MaxStdoutLength,
+		MaxStderrLength: p.MaxStderrLength,
+		SpillFullOutput: p.SpillFullOutput,
+	}
+	inputs := []struct {
+		name  string
+		value interface{}
+		limit *int
+	}{
+		{"MaxStdoutLength", pluginInput.MaxStdoutLength, &limits.MaxStdoutLength},
+		{"MaxStderrLength", pluginInput.MaxStderrLength, &limits.MaxStderrLength},
+	}
+	for _, input := range inputs {
+		var length int
+		if length, err = parseLimit(input.value); err != nil {
+			return limits, fmt.Errorf("invalid %v: %v", input.name, err)
+		}
+		if length == 0 {
+			continue
+		}
+		if err = pluginutil.ValidateOutputLength(length); err != nil {
+			return limits, fmt.Errorf("invalid %v: %v", input.name, err)
+		}
+		*input.limit = length
+	}
+	if pluginInput.SpillFullOutput != nil {
+		limits.SpillFullOutput = *pluginInput.SpillFullOutput
+	}
+	return
+}
+
+// parseLimit parses a limit given as a number or as a string, a missing or empty value means no limit.
+func parseLimit(value interface{}) (int, error) {
+	switch limit := value.(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return limit, nil
+	case float64:
+		if limit != float64(int(limit)) {
+			return 0, fmt.Errorf("%v is not an integer", limit)
+		}
+		return int(limit), nil
+	case string:
+		if strings.TrimSpace(limit) == "" {
+			return 0, nil
+		}
+		return strconv.Atoi(strings.TrimSpace(limit))
+	default:
+		return 0, fmt.Errorf("unexpected value %v", value)
+	}
+}
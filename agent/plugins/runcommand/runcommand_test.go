@@ -17,13 +17,19 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
+	"os/user"
 	"path/filepath"
+	"runtime"
 	"testing"
 
+	"github.com/aws/amazon-ssm-agent/agent/checkpoint"
 	"github.com/aws/amazon-ssm-agent/agent/context"
 	"github.com/aws/amazon-ssm-agent/agent/contracts"
 	"github.com/aws/amazon-ssm-agent/agent/executers"
 	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil/artifact"
 	"github.com/aws/amazon-ssm-agent/agent/jsonutil"
 	"github.com/aws/amazon-ssm-agent/agent/log"
 	"github.com/aws/amazon-ssm-agent/agent/plugins/pluginutil"
@@ -43,13 +49,28 @@ type TestCase struct {
 type CommandTester func(p *Plugin, mockCancelFlag *task.MockCancelFlag, mockExecuter *executers.MockCommandExecuter, mockS3Uploader *pluginutil.MockDefaultPlugin)
 
 const (
-	orchestrationDirectory = "OrchesDir"
-	s3BucketName           = "bucket"
-	s3KeyPrefix            = "key"
-	testInstanceID         = "i-12345678"
-	bucketRegionErrorMsg   = "AuthorizationHeaderMalformed: The authorization header is malformed; the region 'us-east-1' is wrong; expecting 'us-west-2' status code: 400, request id: []"
+	s3BucketName         = "bucket"
+	s3KeyPrefix          = "key"
+	testInstanceID       = "i-12345678"
+	bucketRegionErrorMsg = "AuthorizationHeaderMalformed: The authorization header is malformed; the region 'us-east-1' is wrong; expecting 'us-west-2' status code: 400, request id: []"
 )
 
+// orchestrationDirectory is created outside the source tree so the scripts
+// written by the tests are not left behind.
+var orchestrationDirectory string
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "OrchesDir")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	orchestrationDirectory = dir
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 var TestCases = []TestCase{
 	generateTestCaseOk("0"),
 	generateTestCaseOk("1"),
@@ -112,9 +133,9 @@ func testRunCommands(t *testing.T, testCase TestCase, rawInput bool) {
 			err := jsonutil.Remarshal(testCase.Input, &rawPluginInput)
 			assert.Nil(t, err)
 
-			res = p.runCommandsRawInput(logger, rawPluginInput, orchestrationDirectory, mockCancelFlag, s3BucketName, s3KeyPrefix)
+			res = p.runCommandsRawInput(logger, rawPluginInput, orchestrationDirectory, mockCancelFlag, s3BucketName, s3KeyPrefix, "")
 		} else {
-			res = p.runCommands(logger, testCase.Input, orchestrationDirectory, mockCancelFlag, s3BucketName, s3KeyPrefix)
+			res = p.runCommands(logger, testCase.Input, orchestrationDirectory, mockCancelFlag, s3BucketName, s3KeyPrefix, "")
 		}
 
 		// assert output is correct (mocked object expectations are tested automatically by testExecution)
@@ -124,6 +145,21 @@ func testRunCommands(t *testing.T, testCase TestCase, rawInput bool) {
 	testExecution(t, runCommandTester)
 }
 
+// TestRunCommandsAsUser tests that the commands are run as the requested user, with a script this user owns.
+func TestRunCommandsAsUser(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("running commands as another user is not supported on windows")
+	}
+	current, err := user.Current()
+	if err != nil {
+		t.Skip("unable to determine the current user", err)
+	}
+
+	testCase := generateTestCaseOk("4")
+	testCase.Input.RunAsUser = current.Uid
+	testRunCommands(t, testCase, false)
+}
+
 // TestBucketsInDifferentRegions tests runCommands when S3Buckets are present in IAD and PDX region.
 func TestBucketsInDifferentRegions(t *testing.T) {
 	for _, testCase := range TestCases {
@@ -143,7 +179,7 @@ func testBucketsInDifferentRegions(t *testing.T, testCase TestCase, testingBucke
 
 		// call method under test
 		var res contracts.PluginOutput
-		res = p.runCommands(logger, testCase.Input, orchestrationDirectory, mockCancelFlag, s3BucketName, s3KeyPrefix)
+		res = p.runCommands(logger, testCase.Input, orchestrationDirectory, mockCancelFlag, s3BucketName, s3KeyPrefix, "")
 
 		// assert output is correct (mocked object expectations are tested automatically by testExecution)
 		assert.Equal(t, testCase.Output, res)
@@ -207,6 +243,40 @@ func testExecute(t *testing.T, testCase TestCase) {
 	testExecution(t, executeTester)
 }
 
+// TestExecuteWithCheckpoint tests that the sets of commands completed before an interruption are not run again.
+func TestExecuteWithCheckpoint(t *testing.T) {
+	completed, resumed := TestCases[0], TestCases[2]
+	testExecution(t, func(p *Plugin, mockCancelFlag *task.MockCancelFlag, mockExecuter *executers.MockCommandExecuter, mockS3Uploader *pluginutil.MockDefaultPlugin) {
+		setCancelFlagExpectations(mockCancelFlag)
+		setExecuterExpectations(mockExecuter, resumed, mockCancelFlag, p)
+		setS3UploaderExpectations(mockS3Uploader, resumed, p)
+
+		var properties []interface{}
+		for _, testCase := range []TestCase{completed, resumed} {
+			var rawPluginInput interface{}
+			assert.Nil(t, jsonutil.Remarshal(testCase.Input, &rawPluginInput))
+			properties = append(properties, rawPluginInput)
+		}
+		checkpoints := checkpoint.NewStore(t.TempDir(), p.name(), "aws.ssm.c1.i-1", mockCancelFlag)
+		assert.Nil(t, checkpoints.Save(runCommandProgress{Outputs: []contracts.PluginOutput{completed.Output}}))
+
+		res := p.ExecuteWithCheckpoint(context.NewMockDefault(), contracts.Configuration{
+			Properties:             properties,
+			OutputS3BucketName:     s3BucketName,
+			OutputS3KeyPrefix:      s3KeyPrefix,
+			OrchestrationDirectory: orchestrationDirectory,
+			BookKeepingFileName:    uuid.NewV4().String(),
+		}, mockCancelFlag, checkpoints)
+		assert.Equal(t, completed.Output.String(), res.Output)
+
+		var progress runCommandProgress
+		found, err := checkpoints.Load(&progress)
+		assert.Nil(t, err)
+		assert.True(t, found)
+		assert.Equal(t, []contracts.PluginOutput{completed.Output, resumed.Output}, progress.Outputs)
+	})
+}
+
 // testExecution sets up boiler plate mocked objects then delegates to a more
 // specific tester, then asserts general expectations on the mocked objects.
 // It is the responsibility of the inner tester to set up expectations
@@ -237,11 +307,148 @@ func testExecution(t *testing.T, commandtester CommandTester) {
 	mockS3Uploader.AssertExpectations(t)
 }
 
+func TestSelectShell(t *testing.T) {
+	if shellIsPowerShell {
+		t.Skip("the default shell of the platform is PowerShell")
+	}
+	defer func(find func() (string, error)) { findPowerShellCore = find }(findPowerShellCore)
+	findPowerShellCore = func() (string, error) { return "/opt/microsoft/powershell/7/pwsh", nil }
+
+	// aws:runShellScript runs sh and rejects the PowerShell inputs
+	shellPlugin := Plugin{}
+	shell, err := shellPlugin.selectShell(RunCommandPluginInput{})
+	assert.Nil(t, err)
+	assert.Equal(t, pluginutil.GetShellCommand(), shell.command)
+	_, err = shellPlugin.selectShell(RunCommandPluginInput{PowerShellEdition: "Core"})
+	assert.NotNil(t, err)
+
+	// aws:runPowerShellScript runs PowerShell Core, from the given path if any
+	powerShellPlugin := Plugin{powerShell: true}
+	assert.Equal(t, powerShellPluginName, powerShellPlugin.name())
+	shell, err = powerShellPlugin.selectShell(RunCommandPluginInput{})
+	assert.Nil(t, err)
+	name, arguments := shell.commandLine("/tmp/_script.ps1")
+	assert.Equal(t, "/opt/microsoft/powershell/7/pwsh", name)
+	assert.Equal(t, "/tmp/_script.ps1", arguments[len(arguments)-1])
+	assert.Equal(t, powerShellScriptName, shell.scriptName)
+	assert.Equal(t, "$env:NAME = 'it''s'", shell.environmentVariableCommand("NAME", "it's"))
+
+	shell, err = powerShellPlugin.selectShell(RunCommandPluginInput{PowerShellPath: "/usr/local/bin/pwsh-preview"})
+	assert.Nil(t, err)
+	assert.Equal(t, "/usr/local/bin/pwsh-preview", shell.command)
+
+	for _, edition := range []string{"Desktop", "ISE"} {
+		_, err = powerShellPlugin.selectShell(RunCommandPluginInput{PowerShellEdition: edition})
+		assert.NotNil(t, err, edition)
+	}
+}
+
+func TestValidateScriptSource(t *testing.T) {
+	source := "https://s3-us-west-2.amazonaws.com/bucket/scripts/install.sh"
+	assert.Nil(t, validateScriptSource(logger, RunCommandPluginInput{RunCommand: []string{"ls"}}))
+	assert.Nil(t, validateScriptSource(logger, RunCommandPluginInput{ScriptSource: source, ScriptSourceHash: "abc"}))
+	assert.NotNil(t, validateScriptSource(logger, RunCommandPluginInput{ScriptSource: source}))
+	assert.NotNil(t, validateScriptSource(logger, RunCommandPluginInput{ScriptSource: "https://example.com/install.sh", ScriptSourceHash: "abc"}))
+	assert.NotNil(t, validateScriptSource(logger, RunCommandPluginInput{ScriptSourceHash: "abc"}))
+}
+
+func TestFetchScriptSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runcommand")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer func(download func(log log.T, input artifact.DownloadInput) (artifact.DownloadOutput, error)) {
+		downloadScriptSource = download
+	}(downloadScriptSource)
+	matched := true
+	downloadScriptSource = func(log log.T, input artifact.DownloadInput) (output artifact.DownloadOutput, err error) {
+		assert.Equal(t, dir, input.DestinationDirectory)
+		assert.Equal(t, "abc", input.SourceHashValue)
+		output.LocalFilePath = filepath.Join(dir, "0123_install.sh")
+		output.IsHashMatched = matched
+		return output, ioutil.WriteFile(output.LocalFilePath, []byte("echo installed"), 0600)
+	}
+
+	input := RunCommandPluginInput{ScriptSource: "https://s3-us-west-2.amazonaws.com/bucket/scripts/install.sh", ScriptSourceHash: "abc"}
+	shell := defaultShell()
+	path, err := fetchScriptSource(logger, input, dir, shell)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, scriptSourcePrefix+shell.scriptName), path)
+	content, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "echo installed", string(content))
+
+	// a script which does not match its checksum is not kept
+	matched = false
+	_, err = fetchScriptSource(logger, input, dir, shell)
+	assert.NotNil(t, err)
+	assert.False(t, fileutil.Exists(filepath.Join(dir, "0123_install.sh")))
+}
+
+func TestSourceCommand(t *testing.T) {
+	assert.Equal(t, `. '/tmp/it'\''s/source_script.sh'`, scriptShell{}.sourceCommand("/tmp/it's/source_script.sh"))
+	assert.Equal(t, `. 'C:\it''s\source_script.ps1'`, scriptShell{powerShell: true}.sourceCommand(`C:\it's\source_script.ps1`))
+}
+
+func TestEnvironmentSecretsAreRedacted(t *testing.T) {
+	environment := map[string]string{"DB_PASSWORD": "hunter2", "REGION": "us-east-1"}
+
+	assert.Nil(t, validateEnvironment(environment))
+	assert.NotNil(t, validateEnvironment(map[string]string{"A=B": "c"}))
+	assert.NotNil(t, validateEnvironment(map[string]string{"": "c"}))
+
+	assert.Equal(t, []string{"DB_PASSWORD=***", "REGION=us-east-1"}, describeEnvironment(environment))
+	assert.Equal(t, []string{"hunter2"}, secretValues(environment))
+}
+
+func TestResourceLimits(t *testing.T) {
+	p := &Plugin{}
+	limits, err := p.resourceLimits(RunCommandPluginInput{CpuShares: float64(512), MemoryLimitMB: "256", Niceness: " 10 "})
+	assert.Nil(t, err)
+	assert.Equal(t, executers.ResourceLimits{CPUShares: 512, MemoryLimitMB: 256, Niceness: 10}, limits)
+
+	limits, err = p.resourceLimits(RunCommandPluginInput{MaxProcesses: ""})
+	assert.Nil(t, err)
+	assert.True(t, limits.IsEmpty())
+
+	for _, input := range []RunCommandPluginInput{
+		{CpuShares: 1.5},
+		{MemoryLimitMB: "lots"},
+		{MaxProcesses: []string{"10"}},
+		{Niceness: 20},
+	} {
+		_, err = p.resourceLimits(input)
+		assert.NotNil(t, err, "%v", input)
+	}
+}
+
+func TestOutputLimits(t *testing.T) {
+	p := &Plugin{}
+	p.MaxStdoutLength = 2500
+	p.MaxStderrLength = 2500
+	spill := true
+	limits, err := p.outputLimits(RunCommandPluginInput{MaxStdoutLength: float64(10000), MaxStderrLength: "", SpillFullOutput: &spill})
+	assert.Nil(t, err)
+	assert.Equal(t, pluginutil.PluginConfig{MaxStdoutLength: 10000, MaxStderrLength: 2500, SpillFullOutput: true}, limits)
+
+	for _, input := range []RunCommandPluginInput{
+		{MaxStdoutLength: -1},
+		{MaxStderrLength: pluginutil.MaxOutputLength + 1},
+		{MaxStdoutLength: "lots"},
+	} {
+		_, err = p.outputLimits(input)
+		assert.NotNil(t, err, "%v", input)
+	}
+}
+
 func setExecuterExpectations(mockExecuter *executers.MockCommandExecuter, t TestCase, cancelFlag task.CancelFlag, p *Plugin) {
 	orchestrationDir := filepath.Join(orchestrationDirectory, fileutil.RemoveInvalidChars(t.Input.ID))
 	stdoutFilePath := filepath.Join(orchestrationDir, p.StdoutFileName)
 	stderrFilePath := filepath.Join(orchestrationDir, p.StderrFileName)
-	mockExecuter.On("Execute", mock.Anything, t.Input.WorkingDirectory, stdoutFilePath, stderrFilePath, cancelFlag, mock.Anything, mock.Anything, mock.Anything).Return(
+	runAs := executers.RunAs{User: t.Input.RunAsUser, Group: t.Input.RunAsGroup, UserSession: t.Input.RunInUserSession}
+	options := mock.MatchedBy(func(options executers.ExecuteOptions) bool {
+		return assert.ObjectsAreEqual(t.Input.Environment, options.EnvVars) && options.RunAs == runAs &&
+			assert.ObjectsAreEqual(secretValues(t.Input.Environment), options.Secrets)
+	})
+	mockExecuter.On("Execute", mock.Anything, t.Input.WorkingDirectory, stdoutFilePath, stderrFilePath, cancelFlag, mock.Anything, mock.Anything, mock.Anything, options).Return(
 		readerFromString(t.Output.Stdout), readerFromString(t.Output.Stderr), t.Output.ExitCode, t.ExecuterErrors)
 }
 
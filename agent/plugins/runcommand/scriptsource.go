@@ -0,0 +1,107 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package runcommand implements the RunCommand plugin.
+// scriptsource downloads the script of a set of commands from S3, for scripts too large to be part of the document.
+package runcommand
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/fileutil/artifact"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/pluginutil"
+	"github.com/aws/amazon-ssm-agent/agent/s3util"
+)
+
+// scriptSourcePrefix prefixes the name of the downloaded script, which gets the extension of the script of the shell.
+const scriptSourcePrefix = "source"
+
+// downloadScriptSource downloads the script of ScriptSource.
+var downloadScriptSource = artifact.Download
+
+// validateScriptSource checks the script source is an S3 object with the checksum it is verified against.
+func validateScriptSource(log log.T, pluginInput RunCommandPluginInput) error {
+	if pluginInput.ScriptSource == "" {
+		if pluginInput.ScriptSourceHash != "" || pluginInput.ScriptSourceHashType != "" {
+			return errors.New("ScriptSourceHash and ScriptSourceHashType require a ScriptSource")
+		}
+		return nil
+	}
+	sourceURL, err := url.Parse(pluginInput.ScriptSource)
+	if err != nil {
+		return fmt.Errorf("invalid ScriptSource %v: %v", pluginInput.ScriptSource, err)
+	}
+	if !s3util.ParseAmazonS3URL(log, sourceURL).IsBucketAndKeyPresent() {
+		return fmt.Errorf("ScriptSource %v is not the url of an S3 object", pluginInput.ScriptSource)
+	}
+	if pluginInput.ScriptSourceHash == "" {
+		return errors.New("ScriptSource requires a ScriptSourceHash")
+	}
+	return nil
+}
+
+// fetchScriptSource downloads the script of the input to the directory, resuming an interrupted download, verifies
+// its checksum and returns its path. The script is named after the script of the shell, which runs it.
+func fetchScriptSource(log log.T, pluginInput RunCommandPluginInput, directory string, shell scriptShell) (path string, err error) {
+	output, err := downloadScriptSource(log, artifact.DownloadInput{
+		SourceURL:            pluginInput.ScriptSource,
+		DestinationDirectory: directory,
+		SourceHashValue:      pluginInput.ScriptSourceHash,
+		SourceHashType:       pluginInput.ScriptSourceHashType,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to download ScriptSource %v: %v", pluginInput.ScriptSource, err)
+	}
+	if !output.IsHashMatched {
+		os.Remove(output.LocalFilePath)
+		return "", fmt.Errorf("the checksum of ScriptSource %v does not match ScriptSourceHash", pluginInput.ScriptSource)
+	}
+	path = filepath.Join(directory, scriptSourcePrefix+shell.scriptName)
+	if err = os.Rename(output.LocalFilePath, path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// scriptSourceHashType returns the type of the checksum of the script source.
+func scriptSourceHashType(pluginInput RunCommandPluginInput) string {
+	if pluginInput.ScriptSourceHashType == "" {
+		return "sha256"
+	}
+	return pluginInput.ScriptSourceHashType
+}
+
+// scanScripts submits the script of the commands, and the downloaded script if any, to the antimalware provider.
+func scanScripts(log log.T, scriptPath string, sourcePath string) error {
+	if sourcePath != "" {
+		if err := pluginutil.ScanScriptFileForMalware(log, sourcePath); err != nil {
+			return err
+		}
+	}
+	return pluginutil.ScanScriptFileForMalware(log, scriptPath)
+}
+
+// sourceCommand returns the command of the shell running the script file in the shell of the commands,
+// so that the commands of the input run after it and an exit of the script ends the commands.
+func (s scriptShell) sourceCommand(path string) string {
+	if s.powerShell {
+		return ". '" + strings.Replace(path, "'", "''", -1) + "'"
+	}
+	return ". '" + strings.Replace(path, "'", `'\''`, -1) + "'"
+}
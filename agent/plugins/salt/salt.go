@@ -0,0 +1,214 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package salt implements the aws:runSaltState plugin.
+package salt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/context"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/executers"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/jsonutil"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/pluginutil"
+	"github.com/aws/amazon-ssm-agent/agent/task"
+)
+
+const (
+	// stateTreeDirName is the file root holding the state downloaded from a source or written from inline content.
+	stateTreeDirName = "states"
+
+	// stateName is the name of the state downloaded from a source or written from inline content.
+	stateName = "ssm"
+)
+
+// Plugin is the type for the aws:runSaltState plugin.
+type Plugin struct {
+	pluginutil.DefaultPlugin
+}
+
+// SaltPluginInput represents one state run by the aws:runSaltState plugin.
+// The state is given inline (State), downloaded from a S3 or http url (StateSource), or taken by name (States)
+// from FileRoot or the file roots of the minion configuration. Without any of them the highstate is applied.
+type SaltPluginInput struct {
+	contracts.PluginInput
+	ID                  string
+	State               string
+	StateSource         string
+	StateSourceHash     string
+	StateSourceHashType string
+	States              []string
+	FileRoot            string
+	Pillar              map[string]interface{}
+	Test                bool
+	InstallDependencies bool
+	WorkingDirectory    string
+	TimeoutSeconds      interface{}
+}
+
+// NewPlugin returns a new instance of the plugin.
+func NewPlugin(pluginConfig pluginutil.PluginConfig) (*Plugin, error) {
+	var plugin Plugin
+	plugin.MaxStdoutLength = pluginConfig.MaxStdoutLength
+	plugin.MaxStderrLength = pluginConfig.MaxStderrLength
+	plugin.StdoutFileName = pluginConfig.StdoutFileName
+	plugin.StderrFileName = pluginConfig.StderrFileName
+	plugin.OutputTruncatedSuffix = pluginConfig.OutputTruncatedSuffix
+	plugin.Uploader = pluginutil.GetS3Config()
+	plugin.ExecuteUploadOutputToS3Bucket = pluginutil.UploadOutputToS3BucketExecuter(plugin.UploadOutputToS3Bucket)
+
+	exec := executers.ShellCommandExecuter{}
+	plugin.ExecuteCommand = pluginutil.CommandExecuter(exec.Execute)
+
+	return &plugin, nil
+}
+
+// Name returns the plugin name
+func Name() string {
+	return appconfig.PluginNameAwsRunSaltState
+}
+
+// Execute applies the states and returns their outputs.
+func (p *Plugin) Execute(context context.T, config contracts.Configuration, cancelFlag task.CancelFlag) (res contracts.PluginResult) {
+	log := context.Log()
+	log.Infof("%v started with configuration %v", Name(), config)
+	res.StartDateTime = time.Now()
+	defer func() { res.EndDateTime = time.Now() }()
+
+	var properties []interface{}
+	if properties, res = pluginutil.LoadParametersAsList(log, config.Properties); res.Code != 0 {
+		pluginutil.PersistPluginInformationToCurrent(log, Name(), config, res)
+		return res
+	}
+
+	out := make([]contracts.PluginOutput, len(properties))
+	for i, prop := range properties {
+		if cancelFlag.ShutDown() {
+			out[i] = contracts.PluginOutput{Errors: []string{"Execution canceled due to ShutDown"}}
+			out[i].ExitCode = 1
+			out[i].Status = contracts.ResultStatusFailed
+			break
+		}
+
+		if cancelFlag.Canceled() {
+			out[i] = contracts.PluginOutput{Errors: []string{"Execution canceled"}}
+			out[i].ExitCode = 1
+			out[i].Status = contracts.ResultStatusCancelled
+			break
+		}
+
+		out[i] = p.runStateRawInput(log, prop, config.OrchestrationDirectory, cancelFlag, config.OutputS3BucketName, config.OutputS3KeyPrefix)
+	}
+
+	if len(properties) > 0 {
+		res.Code = out[0].ExitCode
+		res.Status = out[0].Status
+		res.Output = out[0].String()
+	}
+
+	pluginutil.PersistPluginInformationToCurrent(log, Name(), config, res)
+	return res
+}
+
+// runStateRawInput applies one state and returns its output.
+// The input is in the default json unmarshal format (e.g. map[string]interface{}).
+func (p *Plugin) runStateRawInput(log log.T, rawPluginInput interface{}, orchestrationDirectory string, cancelFlag task.CancelFlag, outputS3BucketName string, outputS3KeyPrefix string) (out contracts.PluginOutput) {
+	var pluginInput SaltPluginInput
+	if err := jsonutil.Remarshal(rawPluginInput, &pluginInput); err != nil {
+		errorString := fmt.Sprintf("Invalid format in plugin properties %v;\nerror %v", rawPluginInput, err)
+		out.Errors = append(out.Errors, errorString)
+		out.Status = contracts.ResultStatusFailed
+		log.Error(errorString)
+		return
+	}
+	return p.runState(log, pluginInput, orchestrationDirectory, cancelFlag, outputS3BucketName, outputS3KeyPrefix)
+}
+
+// runState fetches the state, applies it masterless with salt-call and summarizes the results
+// of its state declarations in the output.
+func (p *Plugin) runState(log log.T, pluginInput SaltPluginInput, orchestrationDirectory string, cancelFlag task.CancelFlag, outputS3BucketName string, outputS3KeyPrefix string) (out contracts.PluginOutput) {
+	var err error
+
+	if err = validateInput(pluginInput); err != nil {
+		return pluginutil.MarkAsFailed(log, out, err)
+	}
+
+	// if no orchestration directory specified, create temp directory
+	var useTempDirectory = (orchestrationDirectory == "")
+	var tempDir string
+	if useTempDirectory {
+		if tempDir, err = ioutil.TempDir("", "Ec2RunCommand"); err != nil {
+			return pluginutil.MarkAsFailed(log, out, err)
+		}
+		orchestrationDirectory = tempDir
+	}
+
+	orchestrationDir := filepath.Join(orchestrationDirectory, fileutil.RemoveInvalidChars(pluginInput.ID))
+	if err = fileutil.MakeDirsWithExecuteAccess(orchestrationDir); err != nil {
+		return pluginutil.MarkAsFailed(log, out, err)
+	}
+
+	// fetch the state into its own file root
+	fileRoot, states, err := prepareStates(log, pluginInput, orchestrationDir)
+	if err != nil {
+		return pluginutil.MarkAsFailed(log, out, err)
+	}
+
+	scriptPath := filepath.Join(orchestrationDir, pluginutil.RunCommandScriptName)
+	if err = pluginutil.CreateScriptFile(log, scriptPath, buildScript(pluginInput, fileRoot, states)); err != nil {
+		return pluginutil.MarkAsFailed(log, out, err)
+	}
+
+	executionTimeout := pluginutil.ValidateExecutionTimeout(log, pluginInput.TimeoutSeconds)
+	stdoutFilePath := filepath.Join(orchestrationDir, p.StdoutFileName)
+	stderrFilePath := filepath.Join(orchestrationDir, p.StderrFileName)
+	commandName := pluginutil.GetShellCommand()
+	commandArguments := append(pluginutil.GetShellArguments(), scriptPath, pluginutil.ExitCodeTrap)
+
+	_, stderr, exitCode, errs := p.ExecuteCommand(log, pluginInput.WorkingDirectory, stdoutFilePath, stderrFilePath, cancelFlag, executionTimeout, commandName, commandArguments, executers.ExecuteOptions{Limits: pluginutil.ResourceLimitsFor(Name(), executers.ResourceLimits{})})
+
+	out.ExitCode = exitCode
+	out.Status = pluginutil.GetStatus(out.ExitCode, cancelFlag)
+	for _, err := range errs {
+		out.Errors = append(out.Errors, err.Error())
+		if out.Status != contracts.ResultStatusCancelled && out.Status != contracts.ResultStatusTimedOut {
+			log.Error("failed to apply state: ", err)
+			out.Status = contracts.ResultStatusFailed
+		}
+	}
+
+	// the json outputter prints the result of every state declaration on stdout, it is summarized one line each
+	rawStdout, err := ioutil.ReadFile(stdoutFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		out.Errors = append(out.Errors, err.Error())
+	}
+	out.Stdout = summarizeStateRun(rawStdout)
+	if len(out.Stdout) > p.MaxStdoutLength {
+		out.Stdout = out.Stdout[:p.MaxStdoutLength] + p.OutputTruncatedSuffix
+	}
+	if out.Stderr, err = pluginutil.ReadPrefix(stderr, p.MaxStderrLength, p.OutputTruncatedSuffix); err != nil {
+		out.Errors = append(out.Errors, err.Error())
+	}
+
+	uploadOutputToS3BucketErrors := p.ExecuteUploadOutputToS3Bucket(log, pluginInput.ID, orchestrationDir, outputS3BucketName, outputS3KeyPrefix, useTempDirectory, tempDir, out.Stdout, out.Stderr)
+	out.Errors = append(out.Errors, uploadOutputToS3BucketErrors...)
+	return
+}
@@ -0,0 +1,66 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package salt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var sampleJSONOutput = `[WARNING ] minion is running masterless
+{
+    "local": {
+        "service_|-nginx_|-nginx_|-running": {"name": "nginx", "result": false, "comment": "Service nginx is not available", "changes": {}, "__run_num__": 1},
+        "pkg_|-nginx_|-nginx_|-installed": {"name": "nginx", "result": true, "comment": "installed", "changes": {"nginx": {"new": "1.12"}}, "__run_num__": 0},
+        "file_|-motd_|-/etc/motd_|-managed": {"name": "/etc/motd", "result": true, "comment": "", "changes": {}, "__run_num__": 2}
+    }
+}`
+
+func TestSummarizeStateRun(t *testing.T) {
+	summary := summarizeStateRun([]byte(sampleJSONOutput))
+
+	assert.Equal(t, "changed: pkg.installed nginx\n"+
+		"failed: service.running nginx (Service nginx is not available)\n"+
+		"succeeded: file.managed /etc/motd\n"+
+		"Summary: succeeded=2 (changed=1) failed=1 total=3\n", summary)
+
+	// states which fail to render are reported as a list of errors, kept as is
+	rendering := `{"local": ["Rendering SLS 'base:ssm' failed"]}`
+	assert.Equal(t, rendering, summarizeStateRun([]byte(rendering)))
+}
+
+func TestBuildScript(t *testing.T) {
+	input := SaltPluginInput{
+		Pillar:              map[string]interface{}{"user": "o'brien"},
+		Test:                true,
+		InstallDependencies: true,
+	}
+	commands := buildScript(input, "/orchestration/states", []string{"ssm"})
+	assert.Equal(t, installSaltCommand, commands[0])
+	assert.Equal(t, checkSaltCommand, commands[1])
+	assert.Equal(t, `salt-call --local --retcode-passthrough --out=json --file-root='/orchestration/states' `+
+		`state.apply 'ssm' test=True pillar='{"user":"o'\''brien"}'`, commands[2])
+
+	// without states the highstate is applied with the file roots of the minion
+	commands = buildScript(SaltPluginInput{}, "", nil)
+	assert.Equal(t, []string{checkSaltCommand, "salt-call --local --retcode-passthrough --out=json state.apply"}, commands)
+}
+
+func TestValidateInput(t *testing.T) {
+	assert.Nil(t, validateInput(SaltPluginInput{}))
+	assert.Nil(t, validateInput(SaltPluginInput{States: []string{"web"}, FileRoot: "/srv/salt"}))
+	assert.NotNil(t, validateInput(SaltPluginInput{State: "nginx:\n  pkg.installed", States: []string{"web"}}))
+	assert.NotNil(t, validateInput(SaltPluginInput{State: "nginx:\n  pkg.installed", FileRoot: "/srv/salt"}))
+}
@@ -0,0 +1,220 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package salt implements the aws:runSaltState plugin.
+// state contains the functions preparing the salt-call run and parsing its results.
+package salt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/jsonutil"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/pluginutil"
+)
+
+// installSaltCommand installs salt with the bootstrap script when salt-call is missing.
+const installSaltCommand = "command -v salt-call >/dev/null 2>&1 || " +
+	"{ curl -fsSL https://bootstrap.saltproject.io -o /tmp/bootstrap-salt.sh && sh /tmp/bootstrap-salt.sh -X; } >&2"
+
+// checkSaltCommand fails the run when salt is not installed.
+const checkSaltCommand = "command -v salt-call >/dev/null 2>&1 || " +
+	"{ echo 'salt-call is not installed, set InstallDependencies to install it' >&2; exit 1; }"
+
+// stateResult is the result of one state declaration, as printed by the json outputter.
+type stateResult struct {
+	Name    string      `json:"name"`
+	Result  *bool       `json:"result"`
+	Comment interface{} `json:"comment"`
+	Changes interface{} `json:"changes"`
+	RunNum  int         `json:"__run_num__"`
+}
+
+// validateInput checks that the state is taken from one place only.
+func validateInput(input SaltPluginInput) error {
+	sources := 0
+	if strings.TrimSpace(input.State) != "" {
+		sources++
+	}
+	if strings.TrimSpace(input.StateSource) != "" {
+		sources++
+	}
+	if len(input.States) > 0 {
+		sources++
+	}
+	if sources > 1 {
+		return errors.New("only one of State, StateSource or States can be specified")
+	}
+	if input.FileRoot != "" && sources == 1 && len(input.States) == 0 {
+		return errors.New("FileRoot can only be specified with States")
+	}
+	return nil
+}
+
+// prepareStates writes the inline state or downloads it from its source into a file root of its own,
+// and returns the file root and the states to apply. An empty list of states applies the highstate.
+func prepareStates(log log.T, input SaltPluginInput, orchestrationDir string) (fileRoot string, states []string, err error) {
+	if input.State == "" && input.StateSource == "" {
+		return input.FileRoot, input.States, nil
+	}
+
+	fileRoot = filepath.Join(orchestrationDir, stateTreeDirName)
+	if err = fileutil.MakeDirs(fileRoot); err != nil {
+		return
+	}
+	content := []byte(input.State)
+	if input.StateSource != "" {
+		downloadOutput, err := pluginutil.DownloadFileFromSource(log, input.StateSource, input.StateSourceHash, input.StateSourceHashType)
+		if err != nil || !downloadOutput.IsHashMatched || downloadOutput.LocalFilePath == "" {
+			return "", nil, fmt.Errorf("failed to download state reliably %v", input.StateSource)
+		}
+		if content, err = ioutil.ReadFile(downloadOutput.LocalFilePath); err != nil {
+			return "", nil, err
+		}
+	}
+	if err = fileutil.HardenedWriteFile(filepath.Join(fileRoot, stateName+".sls"), content); err != nil {
+		return
+	}
+	return fileRoot, []string{stateName}, nil
+}
+
+// buildScript returns the commands applying the states masterless, with the json outputter
+// so that the results of the state declarations can be parsed.
+func buildScript(input SaltPluginInput, fileRoot string, states []string) (commands []string) {
+	if input.InstallDependencies {
+		commands = append(commands, installSaltCommand)
+	}
+	commands = append(commands, checkSaltCommand)
+
+	run := "salt-call --local --retcode-passthrough --out=json"
+	if fileRoot != "" {
+		run += " --file-root=" + pluginutil.ShellQuote(fileRoot)
+	}
+	run += " state.apply"
+	if len(states) > 0 {
+		run += " " + pluginutil.ShellQuote(strings.Join(states, ","))
+	}
+	if input.Test {
+		run += " test=True"
+	}
+	if len(input.Pillar) > 0 {
+		pillar, _ := jsonutil.Marshal(input.Pillar)
+		run += " pillar=" + pluginutil.ShellQuote(pillar)
+	}
+	return append(commands, run)
+}
+
+// summarizeStateRun maps the output of the json outputter to one line per state declaration, in execution
+// order, followed by the totals of the run. The raw output is returned when it cannot be parsed, which is
+// also the case when the states fail to render.
+func summarizeStateRun(rawOutput []byte) string {
+	start := bytes.IndexByte(rawOutput, '{')
+	if start < 0 {
+		return string(rawOutput)
+	}
+	var run map[string]map[string]stateResult
+	if err := json.Unmarshal(rawOutput[start:], &run); err != nil {
+		return string(rawOutput)
+	}
+
+	var summary bytes.Buffer
+	succeeded, failed, changed := 0, 0, 0
+	for _, minion := range sortedMinions(run) {
+		results := run[minion]
+		ids := byRunNum{results: results}
+		for id := range results {
+			ids.ids = append(ids.ids, id)
+		}
+		sort.Sort(ids)
+
+		for _, id := range ids.ids {
+			result := results[id]
+			status := "succeeded"
+			switch {
+			case result.Result == nil:
+				status = "would change"
+			case !*result.Result:
+				status = "failed"
+			case hasChanges(result.Changes):
+				status = "changed"
+			}
+			if result.Result != nil && !*result.Result {
+				failed++
+			} else {
+				succeeded++
+			}
+			if hasChanges(result.Changes) {
+				changed++
+			}
+
+			fmt.Fprintf(&summary, "%v: %v %v", status, stateFunction(id), result.Name)
+			if status == "failed" && result.Comment != nil {
+				fmt.Fprintf(&summary, " (%v)", result.Comment)
+			}
+			summary.WriteString("\n")
+		}
+	}
+	fmt.Fprintf(&summary, "Summary: succeeded=%v (changed=%v) failed=%v total=%v\n", succeeded, changed, failed, succeeded+failed)
+	return summary.String()
+}
+
+// byRunNum sorts the ids of state declarations in execution order.
+type byRunNum struct {
+	ids     []string
+	results map[string]stateResult
+}
+
+func (s byRunNum) Len() int           { return len(s.ids) }
+func (s byRunNum) Swap(i, j int)      { s.ids[i], s.ids[j] = s.ids[j], s.ids[i] }
+func (s byRunNum) Less(i, j int) bool { return s.results[s.ids[i]].RunNum < s.results[s.ids[j]].RunNum }
+
+// stateFunction returns the state function (e.g. pkg.installed) of a state declaration id,
+// which salt formats as <module>_|-<id>_|-<name>_|-<function>.
+func stateFunction(id string) string {
+	parts := strings.Split(id, "_|-")
+	if len(parts) != 4 {
+		return id
+	}
+	return parts[0] + "." + parts[3]
+}
+
+// hasChanges returns true if the changes of a state declaration are not empty.
+func hasChanges(changes interface{}) bool {
+	switch typed := changes.(type) {
+	case map[string]interface{}:
+		return len(typed) > 0
+	case []interface{}:
+		return len(typed) > 0
+	case string:
+		return typed != ""
+	default:
+		return changes != nil
+	}
+}
+
+// sortedMinions returns the minions of a run in alphabetical order.
+func sortedMinions(run map[string]map[string]stateResult) (minions []string) {
+	for minion := range run {
+		minions = append(minions, minion)
+	}
+	sort.Strings(minions)
+	return
+}
@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"regexp"
 	"strings"
 
 	"github.com/aws/amazon-ssm-agent/agent/log"
@@ -51,6 +52,9 @@ type PackageVersion struct {
 
 const minimumVersion = "0"
 
+// versionFormat is the format of the versions of the agent, e.g. 2.0.672.0
+var versionFormat = regexp.MustCompile(`^\d+(\.\d+)*$`)
+
 // ParseManifest parses the public manifest file to provide agent update information.
 func ParseManifest(log log.T,
 	fileName string,
@@ -91,13 +95,31 @@ func (m *Manifest) HasVersion(context *updateutil.InstanceContext, packageName s
 
 // LatestVersion returns latest version for specific package
 func (m *Manifest) LatestVersion(log log.T, context *updateutil.InstanceContext, packageName string) (result string, err error) {
+	return m.LatestVersionInRange(log, context, packageName, "", "")
+}
+
+// LatestVersionInRange returns the latest version for specific package between the minimum and the maximum
+// versions included. An empty bound leaves the range open on its side.
+func (m *Manifest) LatestVersionInRange(
+	log log.T,
+	context *updateutil.InstanceContext,
+	packageName string,
+	minimum string,
+	maximum string) (result string, err error) {
 	var version = minimumVersion
 	var compareResult = 0
+	var inRange = false
 	for _, p := range m.Packages {
 		if p.Name == packageName {
 			for _, f := range p.Files {
 				if f.Name == context.FileName(packageName) {
 					for _, v := range f.AvailableVersions {
+						if inRange, err = isVersionInRange(v.Version, minimum, maximum); err != nil {
+							return version, err
+						}
+						if !inRange {
+							continue
+						}
 						if compareResult, err = updateutil.VersionCompare(v.Version, version); err != nil {
 							return version, err
 						}
@@ -113,12 +135,37 @@ func (m *Manifest) LatestVersion(log log.T, context *updateutil.InstanceContext,
 		log.Debugf("Filename: %v", context.FileName(packageName))
 		log.Debugf("Package Name: %v", packageName)
 		log.Debugf("Manifest: %v", m)
+		if len(minimum) > 0 || len(maximum) > 0 {
+			return version, fmt.Errorf("cannot find a version for package %v between %v and %v", packageName, minimum, maximum)
+		}
 		return version, fmt.Errorf("cannot find the latest version for package %v", packageName)
 	}
 
 	return version, nil
 }
 
+// isVersionInRange returns whether the version is between the minimum and the maximum versions included.
+// An empty bound leaves the range open on its side.
+func isVersionInRange(version string, minimum string, maximum string) (inRange bool, err error) {
+	var compareResult = 0
+	if len(minimum) > 0 {
+		if compareResult, err = updateutil.VersionCompare(version, minimum); err != nil || compareResult < 0 {
+			return false, err
+		}
+	}
+	if len(maximum) > 0 {
+		if compareResult, err = updateutil.VersionCompare(version, maximum); err != nil || compareResult > 0 {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// isValidVersion returns whether the version has the format of the versions of the agent, e.g. 2.0.672.0
+func isValidVersion(version string) bool {
+	return versionFormat.MatchString(version)
+}
+
 // DownloadURLAndHash returns download source url and hash value
 func (m *Manifest) DownloadURLAndHash(
 	context *updateutil.InstanceContext,
@@ -97,6 +97,38 @@ func TestParseManifestWithError(t *testing.T) {
 	}
 }
 
+func TestLatestVersionInRange(t *testing.T) {
+	log := log.NewMockLog()
+	context := mockInstanceContext()
+	manifest := loadManifestFromFile(t, sampleManifests[0])
+
+	latest, err := manifest.LatestVersionInRange(log, context, "amazon-ssm-agent", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "1.1.43.0", latest)
+
+	latest, err = manifest.LatestVersionInRange(log, context, "amazon-ssm-agent", "1.0.0.0", "1.1.42.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "1.1.0.0", latest)
+
+	_, err = manifest.LatestVersionInRange(log, context, "amazon-ssm-agent", "1.2.0.0", "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot find a version for package amazon-ssm-agent between 1.2.0.0 and")
+}
+
+func TestIsVersionInRange(t *testing.T) {
+	inRange, err := isVersionInRange("1.10.0.0", "1.2.0.0", "")
+	assert.NoError(t, err)
+	assert.True(t, inRange, "versions are compared by number, not as strings")
+
+	inRange, err = isVersionInRange("2.0.0.0", "", "1.10.0.0")
+	assert.NoError(t, err)
+	assert.False(t, inRange)
+
+	assert.True(t, isValidVersion("2.0.672.0"))
+	assert.False(t, isValidVersion("latest"))
+	assert.False(t, isValidVersion("2.0.672.0; rm -rf /"))
+}
+
 //Load specified file from file system
 func loadFile(t *testing.T, fileName string) (result []byte) {
 	var err error
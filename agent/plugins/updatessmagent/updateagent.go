@@ -433,15 +433,43 @@ func (m *updateManager) validateUpdate(log log.T,
 	out *UpdatePluginOutput) (noNeedToUpdate bool, err error) {
 	currentVersion := version.Version
 	var allowDowngrade = false
+	var config appconfig.SsmagentConfig
+	var compareResult = 0
+	var inRange = false
+
+	if config, err = getAppConfig(false); err != nil {
+		return true, err
+	}
+	minimum, maximum := config.Updater.MinimumVersion, config.Updater.MaximumVersion
+
 	if len(pluginInput.TargetVersion) == 0 {
-		if pluginInput.TargetVersion, err = manifest.LatestVersion(log, context, pluginInput.AgentName); err != nil {
+		if pluginInput.TargetVersion, err = manifest.LatestVersionInRange(
+			log, context, pluginInput.AgentName, minimum, maximum); err != nil {
 			return true, err
 		}
 	}
+	if !isValidVersion(pluginInput.TargetVersion) {
+		return true, fmt.Errorf("invalid target version %v", pluginInput.TargetVersion)
+	}
 
-	if allowDowngrade, err = strconv.ParseBool(pluginInput.AllowDowngrade); err != nil {
+	if len(pluginInput.AllowDowngrade) > 0 {
+		if allowDowngrade, err = strconv.ParseBool(pluginInput.AllowDowngrade); err != nil {
+			return true, err
+		}
+	}
+
+	if inRange, err = isVersionInRange(pluginInput.TargetVersion, minimum, maximum); err != nil {
 		return true, err
 	}
+	if !inRange {
+		return true,
+			fmt.Errorf(
+				"%v version %v is outside of the versions allowed by the configuration of the agent, %v to %v",
+				pluginInput.AgentName,
+				pluginInput.TargetVersion,
+				minimum,
+				maximum)
+	}
 
 	if pluginInput.TargetVersion == currentVersion {
 		out.AppendInfo(log, "%v %v has already been installed, update skipped",
@@ -450,7 +478,10 @@ func (m *updateManager) validateUpdate(log log.T,
 		out.Succeed()
 		return true, nil
 	}
-	if pluginInput.TargetVersion < currentVersion && !allowDowngrade {
+	if compareResult, err = updateutil.VersionCompare(pluginInput.TargetVersion, currentVersion); err != nil {
+		return true, err
+	}
+	if compareResult < 0 && !allowDowngrade {
 		return true,
 			fmt.Errorf(
 				"updating %v to an older version, please enable allow downgrade to proceed",
@@ -471,7 +502,22 @@ func (m *updateManager) validateUpdate(log log.T,
 				pluginInput.AgentName,
 				currentVersion)
 	}
+	// the updater verifies the downloaded package against the checksum of the manifest
+	if _, hash, _ := manifest.DownloadURLAndHash(context, pluginInput.AgentName, pluginInput.TargetVersion); len(hash) == 0 &&
+		pluginInput.TargetVersion != updateutil.PipelineTestVersion {
+		return true,
+			fmt.Errorf(
+				"%v version %v has no checksum in the manifest",
+				pluginInput.AgentName,
+				pluginInput.TargetVersion)
+	}
 
+	if compareResult < 0 {
+		out.AppendInfo(log, "Downgrading %v from %v to %v",
+			pluginInput.AgentName,
+			currentVersion,
+			pluginInput.TargetVersion)
+	}
 	return false, nil
 }
 
@@ -542,9 +588,10 @@ func GetUpdatePluginConfig(context context.T) UpdatePluginConfig {
 		log.Errorf("Error retrieving agent region in update plugin config. error: %v", err)
 	}
 
+	// the virtual host style url of the manifest only resolves in the aws partition
 	var manifestUrl string
-	if region == "cn-north-1" {
-		manifestUrl = "https://s3.cn-north-1.amazonaws.com.cn/amazon-ssm-cn-north-1/ssm-agent-manifest.json"
+	if partition := platform.PartitionForRegion(region); partition.ID != platform.PartitionAws {
+		manifestUrl = partition.S3BucketURL(region, "amazon-ssm-"+region, "ssm-agent-manifest.json")
 	} else {
 		manifestUrl = "https://amazon-ssm-{Region}.s3.amazonaws.com/ssm-agent-manifest.json"
 	}
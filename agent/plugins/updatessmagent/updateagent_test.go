@@ -19,6 +19,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
 	"github.com/aws/amazon-ssm-agent/agent/context"
 	"github.com/aws/amazon-ssm-agent/agent/contracts"
 	"github.com/aws/amazon-ssm-agent/agent/fileutil/artifact"
@@ -275,6 +276,105 @@ func TestValidateUpdate_UnsupportedCurrentVersion(t *testing.T) {
 	}
 }
 
+func TestValidateUpdate_AllowedDowngrade(t *testing.T) {
+	plugin := createStubPluginInput()
+	plugin.AllowDowngrade = "true"
+	plugin.TargetVersion = "1.1.43.0"
+	context := createStubInstanceContext()
+	manifest := createStubManifest(plugin, context, true, false)
+
+	manager := updateManager{}
+	out := UpdatePluginOutput{}
+
+	noNeedToUpdate, err := manager.validateUpdate(logger, plugin, context, manifest, &out)
+
+	assert.False(t, noNeedToUpdate)
+	assert.NoError(t, err)
+	assert.Contains(t, out.Stdout, "Downgrading amazon-ssm-agent from "+version.Version+" to 1.1.43.0")
+}
+
+func TestValidateUpdate_ComparesVersionsByNumber(t *testing.T) {
+	plugin := createStubPluginInput()
+	plugin.AllowDowngrade = "false"
+	plugin.TargetVersion = "10.0.0.0"
+	context := createStubInstanceContext()
+	manifest := createStubManifest(plugin, context, true, true)
+
+	manager := updateManager{}
+	out := UpdatePluginOutput{}
+
+	noNeedToUpdate, err := manager.validateUpdate(logger, plugin, context, manifest, &out)
+
+	assert.False(t, noNeedToUpdate)
+	assert.NoError(t, err)
+}
+
+func TestValidateUpdate_InvalidTargetVersion(t *testing.T) {
+	plugin := createStubPluginInput()
+	plugin.TargetVersion = "latest"
+	context := createStubInstanceContext()
+	manifest := createStubManifest(plugin, context, true, true)
+
+	manager := updateManager{}
+	out := UpdatePluginOutput{}
+
+	noNeedToUpdate, err := manager.validateUpdate(logger, plugin, context, manifest, &out)
+
+	assert.True(t, noNeedToUpdate)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid target version latest")
+}
+
+func TestValidateUpdate_TargetVersionWithoutChecksum(t *testing.T) {
+	plugin := createStubPluginInput()
+	context := createStubInstanceContext()
+	manifest := createStubManifest(plugin, context, true, false)
+	manifest.Packages[0].Files[0].AvailableVersions = append(manifest.Packages[0].Files[0].AvailableVersions,
+		&PackageVersion{Version: plugin.TargetVersion})
+
+	manager := updateManager{}
+	out := UpdatePluginOutput{}
+
+	noNeedToUpdate, err := manager.validateUpdate(logger, plugin, context, manifest, &out)
+
+	assert.True(t, noNeedToUpdate)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "has no checksum in the manifest")
+}
+
+func TestValidateUpdate_TargetVersionOutsideConfiguredRange(t *testing.T) {
+	defer stubVersionRange("", "2.0.0.0")()
+	plugin := createStubPluginInput()
+	context := createStubInstanceContext()
+	manifest := createStubManifest(plugin, context, true, true)
+
+	manager := updateManager{}
+	out := UpdatePluginOutput{}
+
+	noNeedToUpdate, err := manager.validateUpdate(logger, plugin, context, manifest, &out)
+
+	assert.True(t, noNeedToUpdate)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is outside of the versions allowed by the configuration of the agent")
+}
+
+func TestValidateUpdate_LatestVersionWithinConfiguredRange(t *testing.T) {
+	defer stubVersionRange("1.0.0.0", "1.1.42.0")()
+	plugin := createStubPluginInput()
+	context := createStubInstanceContext()
+	manifest := createStubManifest(plugin, context, true, true)
+	plugin.TargetVersion = ""
+
+	manager := updateManager{}
+	out := UpdatePluginOutput{}
+
+	noNeedToUpdate, err := manager.validateUpdate(logger, plugin, context, manifest, &out)
+
+	assert.False(t, noNeedToUpdate)
+	assert.NoError(t, err)
+	assert.Equal(t, "1.1.0.0", plugin.TargetVersion)
+}
+
 func TestUpdateAgent_InvalidPluginRaw(t *testing.T) {
 	config := contracts.Configuration{}
 	plugin := &Plugin{}
@@ -414,6 +514,20 @@ func TestExecute(t *testing.T) {
 	assert.Contains(t, result.Output, "error")
 }
 
+// stubVersionRange configures the range of versions of the agent, the returned function restores the configuration.
+func stubVersionRange(minimum string, maximum string) func() {
+	originalGetAppConfig := getAppConfig
+	getAppConfig = func(bool) (appconfig.SsmagentConfig, error) {
+		config := appconfig.DefaultConfig()
+		config.Updater.MinimumVersion = minimum
+		config.Updater.MaximumVersion = maximum
+		return config, nil
+	}
+	return func() {
+		getAppConfig = originalGetAppConfig
+	}
+}
+
 func createStubPluginInput() *UpdatePluginInput {
 	input := UpdatePluginInput{}
 
@@ -440,7 +554,7 @@ func createStubManifest(plugin *UpdatePluginInput,
 					}
 					if addTargetVersion {
 						f.AvailableVersions = append(f.AvailableVersions,
-							&PackageVersion{Version: plugin.TargetVersion})
+							&PackageVersion{Version: plugin.TargetVersion, Checksum: "checksum"})
 					}
 
 				}
@@ -470,6 +584,14 @@ func (u *fakeUtility) IsServiceRunning(log log.T, i *updateutil.InstanceContext)
 	return true, nil
 }
 
+func (u *fakeUtility) RestartService(log log.T, i *updateutil.InstanceContext, name string) (err error) {
+	return nil
+}
+
+func (u *fakeUtility) IsNamedServiceRunning(log log.T, i *updateutil.InstanceContext, name string) (result bool, err error) {
+	return true, nil
+}
+
 func (u *fakeUtility) CreateUpdateDownloadFolder() (folder string, err error) {
 	return "", nil
 }
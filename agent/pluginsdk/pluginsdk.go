@@ -0,0 +1,297 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package pluginsdk defines the protocol between the agent and the plugins shipped as separate executables,
+// and helps to write such plugins in go.
+//
+// A plugin is discovered from its manifest, either plugin.json in a subdirectory of the external plugins directory
+// of the agent, or a json file dropped in the manifest directory of the agent (/etc/amazon/ssm/plugins.d on Linux)
+// by the package that installs the plugin. Plugins are discovered when the agent starts.
+//
+// The agent starts the executable of a document plugin for each step that uses it and sends it an execute
+// message on its standard input. The plugin writes output chunks and status reports to its standard output while
+// it runs, then exactly one result message. A cancel message asks the plugin to stop, the agent kills it if it
+// does not return a result in time. Messages are json objects, one per line. The standard error of the plugin
+// goes to the agent log.
+//
+// The agent starts the executable of a long-running plugin with the agent and restarts it if it exits. It sends
+// a cancel message when the agent stops, then closes the standard input. Status messages go to the agent log.
+// A long-running plugin declaring heartbeatSeconds in its manifest sends a heartbeat, or any other message, at
+// least that often; the agent restarts it when it misses three of them.
+//
+// The protocol is versioned, fields are only added within a version and unknown fields must be ignored.
+package pluginsdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// ProtocolVersion is the version of the protocol implemented by this package.
+const ProtocolVersion = 1
+
+// ManifestFileName is the name of the manifest of a plugin.
+const ManifestFileName = "plugin.json"
+
+// Types of the messages.
+const (
+	// MessageExecute is sent by the agent to start the step.
+	MessageExecute = "execute"
+
+	// MessageCancel is sent by the agent to stop the step.
+	MessageCancel = "cancel"
+
+	// MessageOutput is sent by the plugin with a chunk of its output.
+	MessageOutput = "output"
+
+	// MessageStatus is sent by the plugin to report its progress.
+	MessageStatus = "status"
+
+	// MessageResult is sent by the plugin once the step completed.
+	MessageResult = "result"
+
+	// MessageHeartbeat is sent by a long-running plugin to tell the agent it is alive.
+	MessageHeartbeat = "heartbeat"
+)
+
+// Types of the plugins.
+const (
+	// TypeDocument is the type of the plugins running the steps of documents, the default.
+	TypeDocument = "document"
+
+	// TypeLongRunning is the type of the plugins running as long as the agent.
+	TypeLongRunning = "longRunning"
+)
+
+// Streams of the output.
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// Statuses of the result.
+const (
+	StatusSuccess          = "Success"
+	StatusSuccessAndReboot = "SuccessAndReboot"
+	StatusFailed           = "Failed"
+	StatusCancelled        = "Cancelled"
+)
+
+// Manifest describes a plugin.
+type Manifest struct {
+	// Name is the action of the plugin in documents, e.g. acme:deployApp. The aws: prefix is reserved.
+	Name string `json:"name"`
+
+	// Executable is the path of the executable, relative to the directory of the manifest.
+	// A manifest of the manifest directory may also give an absolute path.
+	Executable string `json:"executable"`
+
+	// ProtocolVersion is the version of the protocol the executable implements.
+	ProtocolVersion int `json:"protocolVersion"`
+
+	// Platforms lists the operating systems of the plugin (linux, windows, darwin), all of them when empty.
+	Platforms []string `json:"platforms,omitempty"`
+
+	// Type is document or longRunning, document when empty.
+	Type string `json:"type,omitempty"`
+
+	// HeartbeatSeconds is how often a long-running plugin sends a heartbeat, zero when it does not send any.
+	HeartbeatSeconds int `json:"heartbeatSeconds,omitempty"`
+}
+
+// Message is the envelope of the messages, the field named after its type is set.
+type Message struct {
+	Type    string          `json:"type"`
+	Execute *ExecuteRequest `json:"execute,omitempty"`
+	Cancel  *CancelRequest  `json:"cancel,omitempty"`
+	Output  *Output         `json:"output,omitempty"`
+	Status  *Status         `json:"status,omitempty"`
+	Result  *Result         `json:"result,omitempty"`
+}
+
+// ExecuteRequest starts a step.
+type ExecuteRequest struct {
+	ProtocolVersion        int         `json:"protocolVersion"`
+	PluginName             string      `json:"pluginName"`
+	MessageID              string      `json:"messageId"`
+	Properties             interface{} `json:"properties"`
+	OrchestrationDirectory string      `json:"orchestrationDirectory"`
+	DocumentTempDirectory  string      `json:"documentTempDirectory,omitempty"`
+}
+
+// CancelRequest stops a step.
+type CancelRequest struct {
+	// ShutDown is true when the agent stops, false when the command is canceled.
+	ShutDown bool `json:"shutDown"`
+}
+
+// Output is a chunk of the output of a step.
+type Output struct {
+	Stream string `json:"stream"`
+	Data   string `json:"data"`
+}
+
+// Status reports the progress of a step.
+type Status struct {
+	Message string `json:"message"`
+}
+
+// Result is the outcome of a step.
+type Result struct {
+	Status   string `json:"status"`
+	ExitCode int    `json:"exitCode"`
+}
+
+// Handler runs the steps of a plugin.
+type Handler interface {
+	// Execute runs the step. It writes its output with the session and returns once the step completed
+	// or was canceled.
+	Execute(request ExecuteRequest, session *Session) Result
+}
+
+// HandlerFunc adapts a function to a Handler.
+type HandlerFunc func(request ExecuteRequest, session *Session) Result
+
+// Execute calls f.
+func (f HandlerFunc) Execute(request ExecuteRequest, session *Session) Result {
+	return f(request, session)
+}
+
+// Session sends the messages of a step to the agent and receives its cancel request.
+type Session struct {
+	encoder    *json.Encoder
+	mutex      sync.Mutex
+	canceled   chan struct{}
+	cancelOnce sync.Once
+	shutDown   bool
+}
+
+// newSession returns a session writing to out.
+func newSession(out io.Writer) *Session {
+	return &Session{encoder: json.NewEncoder(out), canceled: make(chan struct{})}
+}
+
+// Stdout sends a chunk of the standard output.
+func (s *Session) Stdout(data string) error {
+	return s.send(Message{Type: MessageOutput, Output: &Output{Stream: StreamStdout, Data: data}})
+}
+
+// Stderr sends a chunk of the standard error.
+func (s *Session) Stderr(data string) error {
+	return s.send(Message{Type: MessageOutput, Output: &Output{Stream: StreamStderr, Data: data}})
+}
+
+// ReportStatus reports the progress of the step.
+func (s *Session) ReportStatus(message string) error {
+	return s.send(Message{Type: MessageStatus, Status: &Status{Message: message}})
+}
+
+// Heartbeat tells the agent a long-running plugin is alive.
+func (s *Session) Heartbeat() error {
+	return s.send(Message{Type: MessageHeartbeat})
+}
+
+// Canceled is closed when the agent asks the step to stop.
+func (s *Session) Canceled() <-chan struct{} {
+	return s.canceled
+}
+
+// ShutDown returns true if the step was canceled because the agent stops.
+func (s *Session) ShutDown() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.shutDown
+}
+
+// cancel closes the Canceled channel once.
+func (s *Session) cancel(shutDown bool) {
+	s.mutex.Lock()
+	s.shutDown = s.shutDown || shutDown
+	s.mutex.Unlock()
+	s.cancelOnce.Do(func() { close(s.canceled) })
+}
+
+// send writes a message, one per line.
+func (s *Session) send(message Message) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.encoder.Encode(message)
+}
+
+// Serve runs one step of the plugin with the standard input and output of the process.
+// The main function of a plugin calls it and exits with a non zero code if it returns an error.
+func Serve(handler Handler) error {
+	return ServeStreams(os.Stdin, os.Stdout, handler)
+}
+
+// ServeStreams runs one step with the messages of the agent read from in, and the messages of the plugin written to out.
+func ServeStreams(in io.Reader, out io.Writer, handler Handler) error {
+	decoder := json.NewDecoder(in)
+	var message Message
+	if err := decoder.Decode(&message); err != nil {
+		return fmt.Errorf("failed to read the execute message: %v", err)
+	}
+	if message.Type != MessageExecute || message.Execute == nil {
+		return fmt.Errorf("expected an execute message, got %v", message.Type)
+	}
+	if message.Execute.ProtocolVersion != ProtocolVersion {
+		return fmt.Errorf("unsupported protocol version %v, expected %v", message.Execute.ProtocolVersion, ProtocolVersion)
+	}
+
+	session := newSession(out)
+	go func() {
+		for {
+			var received Message
+			if err := decoder.Decode(&received); err != nil {
+				// the agent closed the input, the step must stop
+				session.cancel(false)
+				return
+			}
+			if received.Type == MessageCancel {
+				session.cancel(received.Cancel != nil && received.Cancel.ShutDown)
+			}
+		}
+	}()
+
+	result := handler.Execute(*message.Execute, session)
+	return session.send(Message{Type: MessageResult, Result: &result})
+}
+
+// RunLongRunning runs a long-running plugin with the standard input and output of the process until the agent
+// stops it. The main function of a plugin calls it and exits with a non zero code if it returns an error.
+func RunLongRunning(run func(session *Session) error) error {
+	return RunLongRunningStreams(os.Stdin, os.Stdout, run)
+}
+
+// RunLongRunningStreams calls run with a session whose Canceled channel is closed when the agent sends a cancel
+// message or closes in. run must return once the channel is closed.
+func RunLongRunningStreams(in io.Reader, out io.Writer, run func(session *Session) error) error {
+	session := newSession(out)
+	go func() {
+		decoder := json.NewDecoder(in)
+		for {
+			var received Message
+			if err := decoder.Decode(&received); err != nil {
+				session.cancel(true)
+				return
+			}
+			if received.Type == MessageCancel {
+				session.cancel(received.Cancel == nil || received.Cancel.ShutDown)
+			}
+		}
+	}()
+	return run(session)
+}
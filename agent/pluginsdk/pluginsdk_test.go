@@ -0,0 +1,103 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package pluginsdk
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// decodeMessages returns the messages written by the plugin.
+func decodeMessages(t *testing.T, out *bytes.Buffer) (messages []Message) {
+	decoder := json.NewDecoder(out)
+	for {
+		var message Message
+		if err := decoder.Decode(&message); err == io.EOF {
+			return
+		} else if !assert.Nil(t, err) {
+			return
+		}
+		messages = append(messages, message)
+	}
+}
+
+func TestServeStreams(t *testing.T) {
+	in := strings.NewReader(`{"type":"execute","execute":{"protocolVersion":1,"pluginName":"acme:deploy","properties":{"app":"web"}}}` + "\n")
+	var out bytes.Buffer
+	handler := HandlerFunc(func(request ExecuteRequest, session *Session) Result {
+		assert.Equal(t, "acme:deploy", request.PluginName)
+		assert.Equal(t, map[string]interface{}{"app": "web"}, request.Properties)
+		session.ReportStatus("deploying")
+		session.Stdout("deployed\n")
+		session.Stderr("warning\n")
+		return Result{Status: StatusSuccess}
+	})
+
+	assert.Nil(t, ServeStreams(in, &out, handler))
+	assert.Equal(t, []Message{
+		{Type: MessageStatus, Status: &Status{Message: "deploying"}},
+		{Type: MessageOutput, Output: &Output{Stream: StreamStdout, Data: "deployed\n"}},
+		{Type: MessageOutput, Output: &Output{Stream: StreamStderr, Data: "warning\n"}},
+		{Type: MessageResult, Result: &Result{Status: StatusSuccess}},
+	}, decodeMessages(t, &out))
+}
+
+func TestServeStreamsCancel(t *testing.T) {
+	in := strings.NewReader(`{"type":"execute","execute":{"protocolVersion":1}}` + "\n" + `{"type":"cancel","cancel":{"shutDown":true}}` + "\n")
+	var out bytes.Buffer
+	handler := HandlerFunc(func(request ExecuteRequest, session *Session) Result {
+		<-session.Canceled()
+		assert.True(t, session.ShutDown())
+		return Result{Status: StatusCancelled, ExitCode: 1}
+	})
+
+	assert.Nil(t, ServeStreams(in, &out, handler))
+	assert.Equal(t, []Message{{Type: MessageResult, Result: &Result{Status: StatusCancelled, ExitCode: 1}}}, decodeMessages(t, &out))
+}
+
+func TestRunLongRunningStreams(t *testing.T) {
+	in := strings.NewReader(`{"type":"cancel","cancel":{"shutDown":true}}` + "\n")
+	var out bytes.Buffer
+
+	err := RunLongRunningStreams(in, &out, func(session *Session) error {
+		session.ReportStatus("watching")
+		session.Heartbeat()
+		<-session.Canceled()
+		assert.True(t, session.ShutDown())
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []Message{{Type: MessageStatus, Status: &Status{Message: "watching"}}, {Type: MessageHeartbeat}}, decodeMessages(t, &out))
+}
+
+func TestServeStreamsInvalidRequest(t *testing.T) {
+	handler := HandlerFunc(func(request ExecuteRequest, session *Session) Result {
+		t.Fatal("the handler must not run")
+		return Result{}
+	})
+	for _, input := range []string{
+		"",
+		`{"type":"cancel"}`,
+		`{"type":"execute","execute":{"protocolVersion":2}}`,
+	} {
+		var out bytes.Buffer
+		assert.NotNil(t, ServeStreams(strings.NewReader(input), &out, handler), input)
+		assert.Empty(t, out.String())
+	}
+}
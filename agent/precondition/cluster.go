@@ -0,0 +1,94 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package precondition evaluates the preconditions declared by a document before it is executed.
+// cluster contains the provider gating execution on the role of the node in a failover cluster.
+package precondition
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+// ClusterRole is the role of the instance in a failover cluster (WSFC on Windows, pacemaker on Linux).
+type ClusterRole string
+
+const (
+	// ClusterRoleActive is the node owning the cluster resources.
+	ClusterRoleActive ClusterRole = "Active"
+
+	// ClusterRolePassive is a standby node of the cluster.
+	ClusterRolePassive ClusterRole = "Passive"
+
+	// ClusterRoleNotClustered is an instance which is not a member of a cluster.
+	ClusterRoleNotClustered ClusterRole = "NotClustered"
+
+	// ClusterPreconditionName is the name of the cluster precondition in the document.
+	ClusterPreconditionName = "clusterRole"
+
+	// ClusterPolicyActive runs the document only on the active node (or on instances that are not clustered).
+	ClusterPolicyActive = "active"
+
+	// ClusterPolicyPassive runs the document only on passive nodes.
+	ClusterPolicyPassive = "passive"
+
+	// ClusterPolicyAny runs the document on any member of a cluster, but not on instances that are not clustered.
+	ClusterPolicyAny = "any"
+)
+
+// getClusterRole is the platform specific function returning the role of the instance.
+var getClusterRole = clusterRole
+
+// clusterProvider gates execution on the cluster role of the instance.
+// role returns the role to evaluate instead of the role of the instance, when set.
+type clusterProvider struct {
+	role func(log log.T) (ClusterRole, error)
+}
+
+// Name returns the name of the cluster precondition.
+func (clusterProvider) Name() string {
+	return ClusterPreconditionName
+}
+
+// Evaluate checks the cluster role of the instance against the declared policy.
+func (provider clusterProvider) Evaluate(log log.T, value string) (satisfied bool, reason string, err error) {
+	policy := strings.ToLower(strings.TrimSpace(value))
+	if policy != ClusterPolicyActive && policy != ClusterPolicyPassive && policy != ClusterPolicyAny {
+		return false, "", fmt.Errorf("unknown cluster policy %v, expected one of %v, %v, %v", value, ClusterPolicyActive, ClusterPolicyPassive, ClusterPolicyAny)
+	}
+
+	roleOf := getClusterRole
+	if provider.role != nil {
+		roleOf = provider.role
+	}
+	var role ClusterRole
+	if role, err = roleOf(log); err != nil {
+		return
+	}
+	log.Debugf("instance cluster role is %v", role)
+
+	switch policy {
+	case ClusterPolicyActive:
+		satisfied = role == ClusterRoleActive || role == ClusterRoleNotClustered
+	case ClusterPolicyPassive:
+		satisfied = role == ClusterRolePassive
+	case ClusterPolicyAny:
+		satisfied = role == ClusterRoleActive || role == ClusterRolePassive
+	}
+	if !satisfied {
+		reason = fmt.Sprintf("document requires cluster role %v but the instance is %v", policy, role)
+	}
+	return
+}
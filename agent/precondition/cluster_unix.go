@@ -0,0 +1,57 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build darwin freebsd linux netbsd openbsd
+
+// Package precondition evaluates the preconditions declared by a document before it is executed.
+package precondition
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+const (
+	crmNodeCommand  = "crm_node"
+	crmAdminCommand = "crmadmin"
+	dcOutputPrefix  = "Designated Controller is:"
+)
+
+// clusterRole returns the role of the instance in a pacemaker cluster.
+// The node acting as designated controller (DC) is considered the active node.
+func clusterRole(log log.T) (role ClusterRole, err error) {
+	if _, err = exec.LookPath(crmNodeCommand); err != nil {
+		log.Debugf("%v not found, instance is not a member of a pacemaker cluster", crmNodeCommand)
+		return ClusterRoleNotClustered, nil
+	}
+
+	var output []byte
+	if output, err = exec.Command(crmNodeCommand, "-n").Output(); err != nil {
+		return "", fmt.Errorf("failed to get the local pacemaker node name: %v", err)
+	}
+	localNode := strings.TrimSpace(string(output))
+
+	if output, err = exec.Command(crmAdminCommand, "-D", "-q").CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to get the pacemaker designated controller: %v", err)
+	}
+	controller := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(string(output)), dcOutputPrefix))
+	log.Debugf("pacemaker local node %v, designated controller %v", localNode, controller)
+
+	if strings.EqualFold(localNode, controller) {
+		return ClusterRoleActive, nil
+	}
+	return ClusterRolePassive, nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build windows
+
+// Package precondition evaluates the preconditions declared by a document before it is executed.
+package precondition
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+// clusterOwnerScript prints the owner node of the core cluster group, or nothing if the node is not clustered.
+const clusterOwnerScript = "if (Get-Service -Name ClusSvc -ErrorAction SilentlyContinue) { Import-Module FailoverClusters; (Get-ClusterGroup -Name 'Cluster Group').OwnerNode.Name }"
+
+// clusterRole returns the role of the instance in a Windows Server Failover Cluster.
+// The node owning the core cluster group is considered the active node.
+func clusterRole(log log.T) (role ClusterRole, err error) {
+	var output []byte
+	if output, err = exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", clusterOwnerScript).Output(); err != nil {
+		return "", fmt.Errorf("failed to query the failover cluster: %v", err)
+	}
+
+	owner := strings.TrimSpace(string(output))
+	if owner == "" {
+		return ClusterRoleNotClustered, nil
+	}
+
+	localNode, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+	log.Debugf("cluster group owner %v, local node %v", owner, localNode)
+
+	if strings.EqualFold(owner, localNode) {
+		return ClusterRoleActive, nil
+	}
+	return ClusterRolePassive, nil
+}
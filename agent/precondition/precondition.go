@@ -0,0 +1,101 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package precondition evaluates the preconditions declared by a document before it is executed.
+// Each precondition is handled by a provider, indexed by the precondition name.
+package precondition
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+// Provider evaluates one kind of precondition against the instance.
+type Provider interface {
+	// Name returns the name of the precondition handled by the provider.
+	Name() string
+
+	// Evaluate returns true if the instance satisfies the declared value of the precondition.
+	// When the precondition is not satisfied, reason explains why.
+	Evaluate(log log.T, value string) (satisfied bool, reason string, err error)
+}
+
+// ProviderRegistry stores the precondition providers, indexed by precondition name.
+type ProviderRegistry map[string]Provider
+
+// registeredProviders stores the providers known to the agent.
+var registeredProviders = ProviderRegistry{}
+
+// register adds the provider to the registered providers.
+func register(provider Provider) {
+	registeredProviders[provider.Name()] = provider
+}
+
+func init() {
+	register(clusterProvider{})
+}
+
+// Profile describes an instance the preconditions are evaluated against instead of the current instance,
+// to explain how a document would run without running it.
+type Profile struct {
+	// ClusterRole is the role of the instance in a failover cluster, not clustered when empty.
+	ClusterRole ClusterRole `json:"clusterRole,omitempty"`
+}
+
+// ProfileProviders returns the providers evaluating the preconditions against the profile.
+func ProfileProviders(profile Profile) ProviderRegistry {
+	role := profile.ClusterRole
+	if role == "" {
+		role = ClusterRoleNotClustered
+	}
+	return ProviderRegistry{
+		ClusterPreconditionName: clusterProvider{role: func(log.T) (ClusterRole, error) { return role, nil }},
+	}
+}
+
+// Evaluate evaluates all preconditions with the registered providers.
+func Evaluate(log log.T, preconditions map[string]string) (satisfied bool, reason string) {
+	return registeredProviders.Evaluate(log, preconditions)
+}
+
+// Evaluate evaluates all preconditions, in name order, and stops at the first one that is not satisfied.
+// Unknown preconditions, and preconditions that cannot be evaluated, are considered not satisfied.
+func (registry ProviderRegistry) Evaluate(log log.T, preconditions map[string]string) (satisfied bool, reason string) {
+	names := make([]string, 0, len(preconditions))
+	for name := range preconditions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := preconditions[name]
+		provider, ok := registry[name]
+		if !ok {
+			return false, fmt.Sprintf("precondition %v is not supported by this agent", name)
+		}
+
+		ok, reason, err := provider.Evaluate(log, value)
+		if err != nil {
+			log.Errorf("failed to evaluate precondition %v=%v: %v", name, value, err)
+			return false, fmt.Sprintf("precondition %v=%v could not be evaluated: %v", name, value, err)
+		}
+		if !ok {
+			log.Infof("precondition %v=%v is not satisfied: %v", name, value, reason)
+			return false, reason
+		}
+		log.Debugf("precondition %v=%v is satisfied", name, value)
+	}
+	return true, ""
+}
@@ -0,0 +1,81 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package precondition
+
+import (
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/stretchr/testify/assert"
+)
+
+type clusterPolicyTest struct {
+	Role      ClusterRole
+	Policy    string
+	Satisfied bool
+}
+
+var clusterPolicyTests = []clusterPolicyTest{
+	{ClusterRoleActive, "active", true},
+	{ClusterRolePassive, "active", false},
+	{ClusterRoleNotClustered, "active", true},
+	{ClusterRoleActive, "Passive", false},
+	{ClusterRolePassive, "passive", true},
+	{ClusterRoleNotClustered, "passive", false},
+	{ClusterRoleActive, "any", true},
+	{ClusterRolePassive, "any", true},
+	{ClusterRoleNotClustered, "any", false},
+}
+
+func TestClusterPrecondition(t *testing.T) {
+	logger := log.NewMockLog()
+	defer func() { getClusterRole = clusterRole }()
+
+	for _, test := range clusterPolicyTests {
+		role := test.Role
+		getClusterRole = func(log log.T) (ClusterRole, error) { return role, nil }
+
+		satisfied, reason := Evaluate(logger, map[string]string{ClusterPreconditionName: test.Policy})
+		assert.Equal(t, test.Satisfied, satisfied, "role %v policy %v", test.Role, test.Policy)
+		assert.Equal(t, test.Satisfied, reason == "")
+	}
+}
+
+func TestUnknownPreconditions(t *testing.T) {
+	logger := log.NewMockLog()
+
+	satisfied, reason := Evaluate(logger, map[string]string{"unknown": "value"})
+	assert.False(t, satisfied)
+	assert.Contains(t, reason, "unknown")
+
+	satisfied, _ = Evaluate(logger, map[string]string{ClusterPreconditionName: "primary"})
+	assert.False(t, satisfied)
+
+	satisfied, _ = Evaluate(logger, nil)
+	assert.True(t, satisfied)
+}
+
+func TestProfileProviders(t *testing.T) {
+	logger := log.NewMockLog()
+	defer func() { getClusterRole = clusterRole }()
+	getClusterRole = func(log log.T) (ClusterRole, error) { return ClusterRoleActive, nil }
+
+	for _, test := range clusterPolicyTests {
+		satisfied, _ := ProfileProviders(Profile{ClusterRole: test.Role}).Evaluate(logger, map[string]string{ClusterPreconditionName: test.Policy})
+		assert.Equal(t, test.Satisfied, satisfied, "role %v policy %v", test.Role, test.Policy)
+	}
+
+	satisfied, _ := ProfileProviders(Profile{}).Evaluate(logger, map[string]string{ClusterPreconditionName: "passive"})
+	assert.False(t, satisfied)
+}
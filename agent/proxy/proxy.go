@@ -0,0 +1,253 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package proxy connects the agent through an authenticated proxy.
+// Basic authentication is sent by the http transport in the proxy url. NTLM and Negotiate need a handshake
+// on the connection, so their requests are tunneled with CONNECT, which the authenticator of the platform answers.
+package proxy
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+)
+
+const (
+	// AuthTypeBasic sends the username and the password to the proxy.
+	AuthTypeBasic = "basic"
+	// AuthTypeNTLM authenticates with the NTLM challenge-response.
+	AuthTypeNTLM = "ntlm"
+	// AuthTypeNegotiate authenticates with Kerberos, or NTLM when Kerberos is not available.
+	AuthTypeNegotiate = "negotiate"
+
+	// maxLegs bounds the exchanges of a handshake, NTLM takes two and Kerberos one.
+	maxLegs = 3
+
+	// dialTimeout is the timeout of the connection to the proxy when the transport has no dialer.
+	dialTimeout = 30 * time.Second
+)
+
+// authenticator produces the tokens of a NTLM or Negotiate handshake.
+type authenticator interface {
+	// next returns the token answering the challenge of the proxy, the challenge is empty for the first token.
+	next(challenge []byte) ([]byte, error)
+	// close releases the security context.
+	close()
+}
+
+// newAuthenticator returns the authenticator of the platform for the scheme. The identity of the agent is
+// used when the username is empty.
+var newAuthenticator = newPlatformAuthenticator
+
+// Settings is the proxy of the outbound connections.
+type Settings struct {
+	URL      *url.URL
+	AuthType string
+	Username string
+	Password string
+	NoProxy  []string
+}
+
+// NewSettings returns the proxy of the config. The url and the bypass list default to the
+// HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables.
+func NewSettings(config appconfig.ProxyCfg, password string) (settings *Settings, err error) {
+	rawURL := firstNonEmpty(config.Url, getenv("HTTPS_PROXY"), getenv("https_proxy"), getenv("HTTP_PROXY"), getenv("http_proxy"))
+	if rawURL == "" {
+		return nil, fmt.Errorf("no proxy url is configured")
+	}
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil || proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy url %v", rawURL)
+	}
+	if proxyURL.Port() == "" {
+		proxyURL.Host = net.JoinHostPort(proxyURL.Hostname(), "80")
+	}
+	proxyURL.User = nil
+
+	settings = &Settings{
+		URL:      proxyURL,
+		AuthType: strings.ToLower(config.AuthType),
+		Username: config.Username,
+		Password: password,
+	}
+	for _, host := range strings.Split(firstNonEmpty(config.NoProxy, getenv("NO_PROXY"), getenv("no_proxy")), ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			settings.NoProxy = append(settings.NoProxy, strings.ToLower(host))
+		}
+	}
+
+	switch settings.AuthType {
+	case "":
+	case AuthTypeBasic:
+		if settings.Username == "" {
+			return nil, fmt.Errorf("basic proxy authentication needs a username")
+		}
+	case AuthTypeNTLM, AuthTypeNegotiate:
+		if proxyURL.Scheme != "http" {
+			return nil, fmt.Errorf("%v proxy authentication needs an http proxy url, got %v", settings.AuthType, proxyURL.Scheme)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported proxy authentication %v, expected one of %v, %v, %v",
+			config.AuthType, AuthTypeBasic, AuthTypeNTLM, AuthTypeNegotiate)
+	}
+	return settings, nil
+}
+
+// tunnels returns true if the requests are tunneled to authenticate on the connection.
+func (s *Settings) tunnels() bool {
+	return s.AuthType == AuthTypeNTLM || s.AuthType == AuthTypeNegotiate
+}
+
+// proxyFor returns the proxy of the request, with the credentials of basic authentication.
+func (s *Settings) proxyFor(request *http.Request) (*url.URL, error) {
+	if s.bypass(request.URL.Hostname()) {
+		return nil, nil
+	}
+	proxyURL := *s.URL
+	if s.AuthType == AuthTypeBasic {
+		proxyURL.User = url.UserPassword(s.Username, s.Password)
+	}
+	return &proxyURL, nil
+}
+
+// bypass returns true if the host is reached directly, the local hosts always are.
+func (s *Settings) bypass(host string) bool {
+	host = strings.ToLower(host)
+	if isLocal(host) {
+		return true
+	}
+	for _, noProxy := range s.NoProxy {
+		if noProxy == "*" {
+			return true
+		}
+		domain := strings.TrimPrefix(noProxy, ".")
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLocal returns true for the loopback addresses and the link-local addresses, such as the instance metadata
+// service at 169.254.169.254, which are never reached through a proxy.
+func isLocal(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsLinkLocalUnicast())
+}
+
+// scheme returns the authentication scheme of the Proxy-Authorization header.
+func (s *Settings) scheme() string {
+	if s.AuthType == AuthTypeNTLM {
+		return "NTLM"
+	}
+	return "Negotiate"
+}
+
+// tunnel opens a tunnel to addr through the proxy, authenticating on the connection to the proxy.
+func (s *Settings) tunnel(dial func(network, addr string) (net.Conn, error), network string, addr string) (conn net.Conn, err error) {
+	auth, err := newAuthenticator(s.scheme(), s.URL.Hostname(), s.Username, s.Password)
+	if err != nil {
+		return nil, err
+	}
+	defer auth.close()
+
+	proxyConn, err := dial(network, s.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			proxyConn.Close()
+		}
+	}()
+
+	reader := bufio.NewReader(proxyConn)
+	var challenge []byte
+	for leg := 0; leg < maxLegs; leg++ {
+		var token []byte
+		if token, err = auth.next(challenge); err != nil {
+			return nil, fmt.Errorf("%v proxy authentication failed: %v", s.scheme(), err)
+		}
+		connect := &http.Request{
+			Method: "CONNECT",
+			URL:    &url.URL{Opaque: addr},
+			Host:   addr,
+			Header: http.Header{},
+		}
+		connect.Header.Set("Proxy-Authorization", s.scheme()+" "+base64.StdEncoding.EncodeToString(token))
+		if err = connect.Write(proxyConn); err != nil {
+			return nil, err
+		}
+		var response *http.Response
+		if response, err = http.ReadResponse(reader, connect); err != nil {
+			return nil, err
+		}
+		if response.StatusCode == http.StatusOK {
+			// the body of the response to CONNECT is the tunnel
+			return proxyConn, nil
+		}
+		io.Copy(ioutil.Discard, response.Body)
+		response.Body.Close()
+
+		switch response.StatusCode {
+		case http.StatusProxyAuthRequired:
+			if challenge = parseChallenge(response.Header, s.scheme()); challenge == nil {
+				return nil, fmt.Errorf("proxy %v rejected the %v credentials", s.URL.Host, s.scheme())
+			}
+		default:
+			return nil, fmt.Errorf("proxy %v refused the connection to %v: %v", s.URL.Host, addr, response.Status)
+		}
+	}
+	return nil, fmt.Errorf("proxy %v did not complete the %v handshake", s.URL.Host, s.scheme())
+}
+
+// parseChallenge returns the token of the Proxy-Authenticate header of the scheme, nil if there is none.
+func parseChallenge(header http.Header, scheme string) []byte {
+	for _, value := range header["Proxy-Authenticate"] {
+		fields := strings.Fields(value)
+		if len(fields) != 2 || !strings.EqualFold(fields[0], scheme) {
+			continue
+		}
+		if challenge, err := base64.StdEncoding.DecodeString(fields[1]); err == nil {
+			return challenge
+		}
+	}
+	return nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+var getenv = os.Getenv
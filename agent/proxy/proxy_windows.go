@@ -0,0 +1,202 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build windows
+
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Security Support Provider Interface constants.
+// https://msdn.microsoft.com/en-us/library/windows/desktop/aa375506(v=vs.85).aspx
+const (
+	secpkgCredOutbound          = 2
+	secbufferVersion            = 0
+	secbufferToken              = 2
+	securityNativeDrep          = 0x10
+	iscReqAllocateMemory        = 0x100
+	iscReqConnection            = 0x800
+	secWinntAuthIdentityUnicode = 2
+	secEOk                      = 0
+	secIContinueNeeded          = 0x00090312
+)
+
+var (
+	secur32Dll                     = windows.NewLazyDLL(filepath.Join(os.Getenv("SystemRoot"), "System32", "secur32.dll"))
+	procAcquireCredentialsHandleW  = secur32Dll.NewProc("AcquireCredentialsHandleW")
+	procInitializeSecurityContextW = secur32Dll.NewProc("InitializeSecurityContextW")
+	procFreeCredentialsHandle      = secur32Dll.NewProc("FreeCredentialsHandle")
+	procDeleteSecurityContext      = secur32Dll.NewProc("DeleteSecurityContext")
+	procFreeContextBuffer          = secur32Dll.NewProc("FreeContextBuffer")
+)
+
+// secHandle is a SecHandle, the handle of credentials or of a security context.
+type secHandle struct {
+	lower uintptr
+	upper uintptr
+}
+
+// secBuffer is a SecBuffer.
+type secBuffer struct {
+	size       uint32
+	bufferType uint32
+	buffer     *byte
+}
+
+// secBufferDesc is a SecBufferDesc.
+type secBufferDesc struct {
+	version uint32
+	count   uint32
+	buffers *secBuffer
+}
+
+// secWinntAuthIdentity is a SEC_WINNT_AUTH_IDENTITY_W, the explicit credentials of the handshake.
+type secWinntAuthIdentity struct {
+	user           *uint16
+	userLength     uint32
+	domain         *uint16
+	domainLength   uint32
+	password       *uint16
+	passwordLength uint32
+	flags          uint32
+}
+
+// sspiAuthenticator runs the handshake with the Negotiate or the NTLM package of SSPI.
+type sspiAuthenticator struct {
+	target     *uint16
+	credential secHandle
+	context    secHandle
+	hasContext bool
+}
+
+// newPlatformAuthenticator acquires the credentials of the handshake. The logon session of the agent is used
+// when the username is empty, which is the computer account on a domain joined host when running as LocalSystem.
+func newPlatformAuthenticator(scheme string, proxyHost string, username string, password string) (authenticator, error) {
+	if err := secur32Dll.Load(); err != nil {
+		return nil, fmt.Errorf("SSPI is not available: %v", err)
+	}
+	packageName, err := syscall.UTF16PtrFromString(scheme)
+	if err != nil {
+		return nil, err
+	}
+	target, err := syscall.UTF16PtrFromString("HTTP/" + proxyHost)
+	if err != nil {
+		return nil, err
+	}
+
+	var identity *secWinntAuthIdentity
+	if username != "" {
+		if identity, err = newAuthIdentity(username, password); err != nil {
+			return nil, err
+		}
+	}
+
+	auth := &sspiAuthenticator{target: target}
+	var expiry int64
+	if status, _, _ := procAcquireCredentialsHandleW.Call(
+		0,
+		uintptr(unsafe.Pointer(packageName)),
+		secpkgCredOutbound,
+		0,
+		uintptr(unsafe.Pointer(identity)),
+		0,
+		0,
+		uintptr(unsafe.Pointer(&auth.credential)),
+		uintptr(unsafe.Pointer(&expiry))); status != secEOk {
+		return nil, fmt.Errorf("AcquireCredentialsHandle failed with 0x%x", status)
+	}
+	return auth, nil
+}
+
+// newAuthIdentity splits DOMAIN\user, a user@domain name is passed as is.
+func newAuthIdentity(username string, password string) (identity *secWinntAuthIdentity, err error) {
+	domain := ""
+	if i := strings.Index(username, `\`); i >= 0 {
+		domain, username = username[:i], username[i+1:]
+	}
+	identity = &secWinntAuthIdentity{
+		userLength:     uint32(len(syscall.StringToUTF16(username)) - 1),
+		domainLength:   uint32(len(syscall.StringToUTF16(domain)) - 1),
+		passwordLength: uint32(len(syscall.StringToUTF16(password)) - 1),
+		flags:          secWinntAuthIdentityUnicode,
+	}
+	if identity.user, err = syscall.UTF16PtrFromString(username); err != nil {
+		return nil, err
+	}
+	if identity.domain, err = syscall.UTF16PtrFromString(domain); err != nil {
+		return nil, err
+	}
+	if identity.password, err = syscall.UTF16PtrFromString(password); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// next calls InitializeSecurityContext with the challenge of the proxy.
+func (a *sspiAuthenticator) next(challenge []byte) (token []byte, err error) {
+	var context *secHandle
+	if a.hasContext {
+		context = &a.context
+	}
+	var input *secBufferDesc
+	if len(challenge) > 0 {
+		inputBuffer := secBuffer{size: uint32(len(challenge)), bufferType: secbufferToken, buffer: &challenge[0]}
+		input = &secBufferDesc{version: secbufferVersion, count: 1, buffers: &inputBuffer}
+	}
+	outputBuffer := secBuffer{bufferType: secbufferToken}
+	output := secBufferDesc{version: secbufferVersion, count: 1, buffers: &outputBuffer}
+
+	var attributes uint32
+	var expiry int64
+	status, _, _ := procInitializeSecurityContextW.Call(
+		uintptr(unsafe.Pointer(&a.credential)),
+		uintptr(unsafe.Pointer(context)),
+		uintptr(unsafe.Pointer(a.target)),
+		iscReqAllocateMemory|iscReqConnection,
+		0,
+		securityNativeDrep,
+		uintptr(unsafe.Pointer(input)),
+		0,
+		uintptr(unsafe.Pointer(&a.context)),
+		uintptr(unsafe.Pointer(&output)),
+		uintptr(unsafe.Pointer(&attributes)),
+		uintptr(unsafe.Pointer(&expiry)))
+	if status != secEOk && status != secIContinueNeeded {
+		return nil, fmt.Errorf("InitializeSecurityContext failed with 0x%x", status)
+	}
+	a.hasContext = true
+
+	if outputBuffer.buffer != nil {
+		defer procFreeContextBuffer.Call(uintptr(unsafe.Pointer(outputBuffer.buffer)))
+		token = make([]byte, outputBuffer.size)
+		copy(token, (*[1 << 20]byte)(unsafe.Pointer(outputBuffer.buffer))[:outputBuffer.size:outputBuffer.size])
+	}
+	return token, nil
+}
+
+// close releases the security context and the credentials.
+func (a *sspiAuthenticator) close() {
+	if a.hasContext {
+		procDeleteSecurityContext.Call(uintptr(unsafe.Pointer(&a.context)))
+	}
+	procFreeCredentialsHandle.Call(uintptr(unsafe.Pointer(&a.credential)))
+}
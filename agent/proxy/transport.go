@@ -0,0 +1,154 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+var (
+	configuredLock     sync.Mutex
+	configuredLoaded   bool
+	configuredLoading  bool
+	configuredSettings *Settings
+
+	sharedTransportOnce sync.Once
+	sharedTransport     *http.Transport
+)
+
+// readPassword reads the password parameter of the app config.
+var readPassword = func(parameterName string) (string, error) {
+	return "", fmt.Errorf("parameter store is not available to read %v", parameterName)
+}
+
+// SetPasswordReader sets the function reading the password parameter from Parameter Store,
+// which needs the credentials of the agent the proxy package cannot depend on.
+func SetPasswordReader(reader func(parameterName string) (string, error)) {
+	readPassword = reader
+}
+
+// Configured returns the proxy of the app config, nil when it has none and the proxy of the environment
+// variables is used without authentication. The connections opened while the password parameter is read,
+// including the ones reading it, do not use the proxy of the app config.
+func Configured() *Settings {
+	configuredLock.Lock()
+	if configuredLoaded || configuredLoading {
+		defer configuredLock.Unlock()
+		return configuredSettings
+	}
+	configuredLoading = true
+	configuredLock.Unlock()
+
+	settings := loadConfigured()
+
+	configuredLock.Lock()
+	defer configuredLock.Unlock()
+	configuredSettings, configuredLoaded, configuredLoading = settings, true, false
+	return configuredSettings
+}
+
+// loadConfigured reads the proxy of the app config.
+func loadConfigured() *Settings {
+	appConfig, err := appconfig.Config(false)
+	if err != nil {
+		return nil
+	}
+	config := appConfig.Proxy
+	if config.Url == "" && config.AuthType == "" {
+		return nil
+	}
+
+	logger := log.Logger()
+	password := config.Password
+	if config.PasswordParameter != "" {
+		if password, err = readPassword(config.PasswordParameter); err != nil {
+			logger.Errorf("failed to read the password of the proxy, connecting without the proxy settings: %v", err)
+			return nil
+		}
+	}
+	settings, err := NewSettings(config, password)
+	if err != nil {
+		logger.Errorf("invalid proxy settings, connecting without them: %v", err)
+		return nil
+	}
+	logger.Infof("connecting through proxy %v with %v authentication", settings.URL.Host, settings.AuthType)
+	return settings
+}
+
+// ConfigureTransport connects the transport through the proxy of the app config when it has one,
+// through the proxy of the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables otherwise.
+func ConfigureTransport(transport *http.Transport) {
+	configureTransport(transport, Configured)
+}
+
+// Transport returns the transport shared by the sdk clients and the downloads, with the timeouts of the default transport.
+func Transport() *http.Transport {
+	sharedTransportOnce.Do(func() {
+		sharedTransport = &http.Transport{
+			Dial: (&net.Dialer{
+				Timeout:   dialTimeout,
+				KeepAlive: dialTimeout,
+			}).Dial,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		}
+		ConfigureTransport(sharedTransport)
+	})
+	return sharedTransport
+}
+
+// configureTransport sets the proxy and the dialer of the transport, which look up the settings for each connection.
+func configureTransport(transport *http.Transport, settingsOf func() *Settings) {
+	dial := transport.Dial
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: dialTimeout, KeepAlive: dialTimeout}).Dial
+	}
+	transport.DialContext = nil
+	transport.Proxy = func(request *http.Request) (*url.URL, error) {
+		if isLocal(request.URL.Hostname()) {
+			return nil, nil
+		}
+		settings := settingsOf()
+		if settings == nil {
+			return http.ProxyFromEnvironment(request)
+		}
+		if settings.tunnels() {
+			return nil, nil
+		}
+		return settings.proxyFor(request)
+	}
+	transport.Dial = func(network, addr string) (net.Conn, error) {
+		settings := settingsOf()
+		if settings == nil || !settings.tunnels() {
+			return dial(network, addr)
+		}
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if settings.bypass(host) {
+			return dial(network, addr)
+		}
+		return settings.tunnel(dial, network, addr)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package attribution adds the attribution configured for the agent to its AWS API requests,
+// so that centralized teams can attribute the API usage of the instances in CloudTrail.
+package attribution
+
+import (
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// NewSession returns a session for the config whose requests carry the attribution of the agent configuration.
+func NewSession(awsConfig *aws.Config) *session.Session {
+	sess := session.New(awsConfig)
+	if appConfig, err := appconfig.Config(false); err == nil {
+		AddHandlers(&sess.Handlers, appConfig.Agent)
+	}
+	return sess
+}
+
+// AddHandlers adds the user agent suffix and the request tags of the agent configuration to the handlers.
+// The handlers run before the requests are marshaled, after the user agent of the sdk is set.
+func AddHandlers(handlers *request.Handlers, agent appconfig.AgentInfo) {
+	if suffix := strings.TrimSpace(agent.UserAgentSuffix); suffix != "" {
+		handlers.Build.PushBack(request.MakeAddToUserAgentFreeFormHandler(suffix))
+	}
+	if len(agent.RequestTags) > 0 {
+		handlers.Build.PushBack(makeTagRequestHandler(agent.RequestTags))
+	}
+}
+
+// makeTagRequestHandler returns a handler attaching the tags to the parameters of the requests which accept them.
+// Of the APIs called by the agent only the S3 uploads accept caller defined key-values, as object metadata.
+// Metadata set by the caller takes precedence over the tags.
+func makeTagRequestHandler(tags map[string]string) func(*request.Request) {
+	return func(r *request.Request) {
+		switch params := r.Params.(type) {
+		case *s3.PutObjectInput:
+			if params.Metadata == nil {
+				params.Metadata = make(map[string]*string)
+			}
+			for key, value := range tags {
+				if _, ok := params.Metadata[key]; !ok {
+					params.Metadata[key] = aws.String(value)
+				}
+			}
+		}
+	}
+}
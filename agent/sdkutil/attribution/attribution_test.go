@@ -0,0 +1,54 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package attribution
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddHandlers(t *testing.T) {
+	sess := session.New(&aws.Config{Region: aws.String("us-east-1")})
+	AddHandlers(&sess.Handlers, appconfig.AgentInfo{
+		UserAgentSuffix: " finance/cost-center-42 ",
+		RequestTags:     map[string]string{"business-unit": "finance", "owner": "tags"},
+	})
+	client := s3.New(sess)
+
+	req, _ := client.PutObjectRequest(&s3.PutObjectInput{
+		Bucket:   aws.String("bucket"),
+		Key:      aws.String("key"),
+		Metadata: map[string]*string{"owner": aws.String("caller")},
+	})
+	assert.Nil(t, req.Build())
+
+	userAgent := req.HTTPRequest.Header.Get("User-Agent")
+	assert.True(t, strings.HasPrefix(userAgent, "aws-sdk-go/"), userAgent)
+	assert.True(t, strings.HasSuffix(userAgent, " finance/cost-center-42"), userAgent)
+	assert.Equal(t, "finance", req.HTTPRequest.Header.Get("X-Amz-Meta-Business-Unit"))
+	assert.Equal(t, "caller", req.HTTPRequest.Header.Get("X-Amz-Meta-Owner"))
+}
+
+func TestAddHandlersWithoutAttribution(t *testing.T) {
+	handlers := request.Handlers{}
+	AddHandlers(&handlers, appconfig.AgentInfo{UserAgentSuffix: " "})
+	assert.Equal(t, 0, handlers.Build.Len())
+}
@@ -15,17 +15,31 @@
 package sdkutil
 
 import (
+	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/log"
 	"github.com/aws/amazon-ssm-agent/agent/managedInstances/registration"
 	"github.com/aws/amazon-ssm-agent/agent/managedInstances/rolecreds"
 	"github.com/aws/amazon-ssm-agent/agent/platform"
+	"github.com/aws/amazon-ssm-agent/agent/proxy"
+	"github.com/aws/amazon-ssm-agent/agent/sdkutil/credentialsource"
+	"github.com/aws/amazon-ssm-agent/agent/sdkutil/parameterstore"
 	"github.com/aws/amazon-ssm-agent/agent/sdkutil/retryer"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ssm"
 )
 
+func init() {
+	proxy.SetPasswordReader(readProxyPassword)
+}
+
 // AwsConfig returns the default aws.Config object while the appropriate
 // credentials. Callers should override returned config properties with any
 // values they want for service specific overrides.
@@ -34,6 +48,7 @@ func AwsConfig() (awsConfig *aws.Config) {
 	awsConfig = &aws.Config{
 		Retryer:    newRetryer(),
 		SleepDelay: sleepDelay,
+		HTTPClient: &http.Client{Transport: proxy.Transport()},
 	}
 
 	// update region from platform
@@ -42,6 +57,12 @@ func AwsConfig() (awsConfig *aws.Config) {
 		awsConfig.Region = &region
 	}
 
+	// the configured sources take precedence over the default credentials
+	if creds := sourcedCredentials(region); creds != nil {
+		awsConfig.Credentials = creds
+		return
+	}
+
 	// load managed credentials if applicable
 	if isManaged, err := registration.HasManagedInstancesCredentials(); isManaged && err == nil {
 		awsConfig.Credentials =
@@ -61,6 +82,65 @@ func AwsConfig() (awsConfig *aws.Config) {
 	return
 }
 
+var (
+	sourcedCredentialsOnce  sync.Once
+	sourcedCredentialsChain *credentials.Credentials
+)
+
+// sourcedCredentials returns the credentials of the sources of the app config, which are only selected when
+// configured or when the agent runs in a container with ECS or EKS credentials that the sdk does not read.
+// It returns nil otherwise, or if the sources are invalid, and the default credentials are used.
+var sourcedCredentials = func(region string) *credentials.Credentials {
+	sourcedCredentialsOnce.Do(func() {
+		appConfig, err := appconfig.Config(false)
+		if err != nil {
+			return
+		}
+		env := credentialsource.Detect()
+		if len(appConfig.Credentials.SourcePrecedence) == 0 && !env.Containerized() {
+			return
+		}
+
+		agentProviders := map[string]credentials.Provider{
+			credentialsource.SourceProfile: &credentials.SharedCredentialsProvider{
+				Filename: appConfig.Profile.Path,
+				Profile:  appConfig.Profile.Name,
+			},
+		}
+		if isManaged, err := registration.HasManagedInstancesCredentials(); isManaged && err == nil {
+			agentProviders[credentialsource.SourceManaged] = credentialsource.FromCredentials(rolecreds.ManagedInstanceCredentialsInstance())
+		}
+
+		logger := log.Logger()
+		config := credentialsource.Config{
+			Precedence:       appConfig.Credentials.SourcePrecedence,
+			MetadataEndpoint: appConfig.Credentials.MetadataEndpoint,
+			Region:           region,
+		}
+		selection, err := credentialsource.Select(config, env, agentProviders)
+		if err != nil {
+			logger.Errorf("invalid credential sources, using the default credentials: %v", err)
+			return
+		}
+		for _, warning := range selection.Warnings {
+			logger.Warn(warning)
+		}
+		logger.Infof("credential sources in order of precedence: %v", strings.Join(selection.Sources, ", "))
+		sourcedCredentialsChain = selection.Credentials()
+	})
+	return sourcedCredentialsChain
+}
+
+// readProxyPassword reads the password parameter of the proxy of the app config.
+func readProxyPassword(parameterName string) (string, error) {
+	awsConfig := AwsConfig()
+	if appConfig, err := appconfig.Config(false); err == nil && appConfig.Ssm.Endpoint != "" {
+		awsConfig.Endpoint = &appConfig.Ssm.Endpoint
+	}
+	password, _, err := parameterstore.GetParameter(ssm.New(session.New(awsConfig)), parameterName)
+	return password, err
+}
+
 var newRetryer = func() aws.RequestRetryer {
 	r := retryer.SsmRetryer{}
 	r.NumMaxRetries = 3
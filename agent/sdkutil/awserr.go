@@ -18,10 +18,33 @@ import (
 	"runtime"
 	"strings"
 
+	"github.com/aws/amazon-ssm-agent/agent/agenterror"
 	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/metrics"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 )
 
+// unknownErrorCode labels the failed calls which did not return an AWS error in the metrics.
+const unknownErrorCode = "Unknown"
+
+// throttlingErrorCodes are the error codes the AWS services return when they throttle a call.
+var throttlingErrorCodes = map[string]bool{
+	"Throttling":                             true,
+	"ThrottlingException":                    true,
+	"ThrottledException":                     true,
+	"RequestThrottled":                       true,
+	"RequestThrottledException":              true,
+	"TooManyRequestsException":               true,
+	"ProvisionedThroughputExceededException": true,
+	"RequestLimitExceeded":                   true,
+	"SlowDown":                               true,
+}
+
+// isThrottling returns true if the error code means the call was throttled.
+func isThrottling(code string) bool {
+	return throttlingErrorCodes[code]
+}
+
 // HandleAwsError logs an AWS error.
 func HandleAwsError(log log.T, err error, stopPolicy *StopPolicy) {
 	if err != nil {
@@ -43,9 +66,18 @@ func HandleAwsError(log log.T, err error, stopPolicy *StopPolicy) {
 				}
 				return
 			}
+
+			if isThrottling(aErr.Code()) {
+				metrics.APIThrottles.Inc(aErr.Code())
+			} else {
+				metrics.APIErrors.Inc(aErr.Code())
+			}
+		} else {
+			metrics.APIErrors.Inc(unknownErrorCode)
 		}
 
-		log.Errorf("error when calling AWS APIs. error details - %v", err)
+		agenterror.Record(agenterror.ServiceCallFailed)
+		log.Errorf("error when calling AWS APIs (%v). error details - %v", agenterror.ServiceCallFailed, err)
 		if stopPolicy != nil {
 			log.Infof("increasing error count by 1")
 			stopPolicy.AddErrorCount(1)
@@ -18,6 +18,8 @@ import (
 	"testing"
 
 	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/metrics"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -49,3 +51,15 @@ func TestHandleAwsErrorCount(t *testing.T) {
 	}
 
 }
+
+func TestHandleAwsErrorCountsThrottles(t *testing.T) {
+	log := log.NewMockLog()
+	throttles := metrics.APIThrottles.Value("ThrottlingException")
+	failures := metrics.APIErrors.Value("InvalidInstanceId")
+
+	HandleAwsError(log, awserr.New("ThrottlingException", "Rate exceeded", nil), nil)
+	HandleAwsError(log, awserr.New("InvalidInstanceId", "invalid instance", nil), nil)
+
+	assert.Equal(t, throttles+1, metrics.APIThrottles.Value("ThrottlingException"))
+	assert.Equal(t, failures+1, metrics.APIErrors.Value("InvalidInstanceId"))
+}
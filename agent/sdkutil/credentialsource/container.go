@@ -0,0 +1,114 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package credentialsource
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// containerProviderName is the name of the container credentials provider.
+const containerProviderName = "ContainerCredentialsProvider"
+
+// containerRequestTimeout is the timeout of the requests to the container credentials endpoint.
+const containerRequestTimeout = 5 * time.Second
+
+// containerCredentials is the response of the container credentials endpoint.
+type containerCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string
+	Token           string
+	Expiration      time.Time
+}
+
+// containerProvider reads the credentials of the ECS task role, or of any endpoint compatible with it.
+type containerProvider struct {
+	credentials.Expiry
+
+	endpoint      string
+	authorization string
+	client        *http.Client
+}
+
+// newContainerProvider returns the provider of the container credentials endpoint of the environment.
+func newContainerProvider(env Environment) *containerProvider {
+	return &containerProvider{
+		endpoint:      env.ContainerEndpoint,
+		authorization: env.ContainerAuthorization,
+		client:        &http.Client{Timeout: containerRequestTimeout},
+	}
+}
+
+// validateContainerEndpoint checks the credentials are only read from the ECS agent, a loopback address or over https.
+func validateContainerEndpoint(endpoint string) error {
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid container credentials endpoint %v: %v", endpoint, err)
+	}
+	if endpointURL.Scheme == "https" || endpoint == containerHost || endpointURL.Host == "169.254.170.2" {
+		return nil
+	}
+	host := endpointURL.Host
+	if h, _, splitErr := net.SplitHostPort(host); splitErr == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("container credentials endpoint %v must be https, a loopback address or the ECS agent", endpoint)
+}
+
+// Retrieve reads the credentials from the endpoint.
+func (p *containerProvider) Retrieve() (value credentials.Value, err error) {
+	value.ProviderName = containerProviderName
+	request, err := http.NewRequest("GET", p.endpoint, nil)
+	if err != nil {
+		return
+	}
+	if p.authorization != "" {
+		request.Header.Set("Authorization", p.authorization)
+	}
+	response, err := p.client.Do(request)
+	if err != nil {
+		return value, fmt.Errorf("failed to read the container credentials: %v", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return value, fmt.Errorf("failed to read the container credentials: %v", response.Status)
+	}
+
+	var creds containerCredentials
+	if err = json.NewDecoder(response.Body).Decode(&creds); err != nil {
+		return value, fmt.Errorf("invalid container credentials: %v", err)
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return value, fmt.Errorf("invalid container credentials: missing access key")
+	}
+	if !creds.Expiration.IsZero() {
+		p.SetExpiration(creds.Expiration, expiryWindow)
+	}
+	value.AccessKeyID = creds.AccessKeyID
+	value.SecretAccessKey = creds.SecretAccessKey
+	value.SessionToken = creds.Token
+	return value, nil
+}
@@ -0,0 +1,224 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package credentialsource selects the source of the aws credentials of the agent.
+// Containerized agents see credential endpoints that the sdk does not know about (the ECS task role endpoint,
+// the web identity token of EKS service accounts) and instance metadata that may be served by a proxy
+// (kube2iam, kiam) returning the role of the pod instead of the role of the node. The sources are tried
+// in a configurable order of precedence so that the agent gets the intended identity.
+package credentialsource
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+const (
+	// SourceManaged is the role of the managed instance registration.
+	SourceManaged = "managed"
+
+	// SourceProfile is the credential profile of the app config.
+	SourceProfile = "profile"
+
+	// SourceEnvironment is the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables.
+	SourceEnvironment = "environment"
+
+	// SourceWebIdentity is the web identity token of an EKS service account (IRSA), exchanged with sts.
+	SourceWebIdentity = "webIdentity"
+
+	// SourceContainer is the task role endpoint of the ECS agent.
+	SourceContainer = "container"
+
+	// SourceInstanceMetadata is the role of the instance profile, read from the instance metadata.
+	SourceInstanceMetadata = "instanceMetadata"
+
+	// defaultMetadataEndpoint is the endpoint of the instance metadata.
+	defaultMetadataEndpoint = "http://169.254.169.254"
+
+	// containerHost is the host of the ECS agent credentials endpoint.
+	containerHost = "http://169.254.170.2"
+
+	// expiryWindow refreshes the credentials of the containers and the web identities before they expire.
+	expiryWindow = 1 * time.Minute
+)
+
+// DefaultPrecedence is the order the sources are tried when the app config does not give one.
+var DefaultPrecedence = []string{
+	SourceManaged,
+	SourceProfile,
+	SourceEnvironment,
+	SourceWebIdentity,
+	SourceContainer,
+	SourceInstanceMetadata,
+}
+
+// getenv reads the environment variables, replaced by tests.
+var getenv = os.Getenv
+
+// Environment describes the credential endpoints the agent process sees.
+type Environment struct {
+	// ContainerEndpoint is the url of the ECS task credentials.
+	ContainerEndpoint string
+
+	// ContainerAuthorization is the Authorization header of the ContainerEndpoint requests.
+	ContainerAuthorization string
+
+	// WebIdentityTokenFile is the token of the service account.
+	WebIdentityTokenFile string
+
+	// RoleArn is the role the web identity assumes.
+	RoleArn string
+
+	// RoleSessionName names the session of the web identity.
+	RoleSessionName string
+
+	// Kubernetes is true when the agent runs in a Kubernetes pod.
+	Kubernetes bool
+}
+
+// Detect reads the credential endpoints from the environment variables set by ECS and EKS.
+func Detect() Environment {
+	env := Environment{
+		ContainerEndpoint:      getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"),
+		ContainerAuthorization: getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"),
+		WebIdentityTokenFile:   getenv("AWS_WEB_IDENTITY_TOKEN_FILE"),
+		RoleArn:                getenv("AWS_ROLE_ARN"),
+		RoleSessionName:        getenv("AWS_ROLE_SESSION_NAME"),
+		Kubernetes:             getenv("KUBERNETES_SERVICE_HOST") != "",
+	}
+	if relativeURI := getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relativeURI != "" {
+		env.ContainerEndpoint = containerHost + relativeURI
+	}
+	return env
+}
+
+// Containerized returns true if the environment has container credentials the sdk does not read.
+func (env Environment) Containerized() bool {
+	return env.ContainerEndpoint != "" || env.WebIdentityTokenFile != ""
+}
+
+// Config selects the sources.
+type Config struct {
+	// Precedence lists the sources in the order they are tried, DefaultPrecedence if empty.
+	Precedence []string
+
+	// MetadataEndpoint is the endpoint of the instance metadata credentials, e.g. an emulator.
+	MetadataEndpoint string
+
+	// Region is the region of the sts calls of the web identity.
+	Region string
+}
+
+// Selection is the chain of the sources available in the environment.
+type Selection struct {
+	// Sources are the names of the sources in the chain.
+	Sources []string
+
+	// Warnings explain the sources that may not give the intended identity.
+	Warnings []string
+
+	providers []credentials.Provider
+}
+
+// Credentials returns the credentials of the first source of the selection that provides them.
+func (s Selection) Credentials() *credentials.Credentials {
+	return credentials.NewCredentials(&credentials.ChainProvider{Providers: s.providers, VerboseErrors: true})
+}
+
+// Select returns the sources of the precedence that are available in the environment.
+// agentProviders holds the sources the agent reads itself (managed, profile), a nil provider is unavailable.
+func Select(config Config, env Environment, agentProviders map[string]credentials.Provider) (selection Selection, err error) {
+	precedence := config.Precedence
+	if len(precedence) == 0 {
+		precedence = DefaultPrecedence
+	}
+
+	for _, source := range precedence {
+		var provider credentials.Provider
+		switch source {
+		case SourceManaged, SourceProfile:
+			provider = agentProviders[source]
+		case SourceEnvironment:
+			provider = &credentials.EnvProvider{}
+		case SourceWebIdentity:
+			if env.WebIdentityTokenFile != "" {
+				if env.RoleArn == "" {
+					return selection, fmt.Errorf("AWS_WEB_IDENTITY_TOKEN_FILE is set without AWS_ROLE_ARN")
+				}
+				provider = newWebIdentityProvider(env, config.Region)
+			}
+		case SourceContainer:
+			if env.ContainerEndpoint != "" {
+				if err = validateContainerEndpoint(env.ContainerEndpoint); err != nil {
+					return
+				}
+				provider = newContainerProvider(env)
+			}
+		case SourceInstanceMetadata:
+			provider = newInstanceMetadataProvider(config.MetadataEndpoint)
+			if env.Kubernetes && env.WebIdentityTokenFile == "" {
+				selection.Warnings = append(selection.Warnings, "the agent runs in a Kubernetes pod, the instance metadata "+
+					"credentials may be served by a proxy such as kube2iam or kiam and be those of the pod role")
+			}
+		default:
+			return selection, fmt.Errorf("unknown credential source %v, expected one of %v", source, strings.Join(DefaultPrecedence, ", "))
+		}
+		if provider != nil {
+			selection.Sources = append(selection.Sources, source)
+			selection.providers = append(selection.providers, provider)
+		}
+	}
+	if len(selection.providers) == 0 {
+		return selection, fmt.Errorf("none of the credential sources %v is available", strings.Join(precedence, ", "))
+	}
+	return
+}
+
+// newInstanceMetadataProvider returns the provider of the instance profile credentials.
+func newInstanceMetadataProvider(endpoint string) credentials.Provider {
+	if endpoint == "" {
+		endpoint = defaultMetadataEndpoint
+	}
+	client := ec2metadata.New(session.New(), &aws.Config{
+		Endpoint: aws.String(strings.TrimSuffix(endpoint, "/") + "/latest"),
+	})
+	return &ec2rolecreds.EC2RoleProvider{Client: client, ExpiryWindow: expiryWindow}
+}
+
+// credentialsProvider adapts credentials to a provider of a chain.
+type credentialsProvider struct {
+	creds *credentials.Credentials
+}
+
+// FromCredentials returns a provider of the credentials, e.g. the managed instance credentials.
+func FromCredentials(creds *credentials.Credentials) credentials.Provider {
+	return &credentialsProvider{creds: creds}
+}
+
+// Retrieve returns the credentials, refreshed if they expired.
+func (p *credentialsProvider) Retrieve() (credentials.Value, error) {
+	return p.creds.Get()
+}
+
+// IsExpired returns true if the credentials must be refreshed.
+func (p *credentialsProvider) IsExpired() bool {
+	return p.creds.IsExpired()
+}
@@ -0,0 +1,155 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package credentialsource
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubEnv sets the environment variables read by Detect and returns the function restoring them.
+func stubEnv(variables map[string]string) func() {
+	original := getenv
+	getenv = func(key string) string { return variables[key] }
+	return func() { getenv = original }
+}
+
+func TestDetect(t *testing.T) {
+	defer stubEnv(map[string]string{})()
+	assert.False(t, Detect().Containerized())
+
+	defer stubEnv(map[string]string{
+		"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI": "/v2/credentials/task",
+		"KUBERNETES_SERVICE_HOST":                "10.0.0.1",
+	})()
+	env := Detect()
+	assert.True(t, env.Containerized())
+	assert.True(t, env.Kubernetes)
+	assert.Equal(t, "http://169.254.170.2/v2/credentials/task", env.ContainerEndpoint)
+
+	defer stubEnv(map[string]string{
+		"AWS_WEB_IDENTITY_TOKEN_FILE": "/var/run/secrets/token",
+		"AWS_ROLE_ARN":                "arn:aws:iam::123456789012:role/agent",
+	})()
+	env = Detect()
+	assert.True(t, env.Containerized())
+	assert.Equal(t, "arn:aws:iam::123456789012:role/agent", env.RoleArn)
+}
+
+func TestSelect(t *testing.T) {
+	profile := credentials.NewStaticCredentials("profile", "secret", "")
+	agentProviders := map[string]credentials.Provider{SourceProfile: FromCredentials(profile)}
+
+	// unavailable sources are skipped
+	selection, err := Select(Config{}, Environment{}, agentProviders)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{SourceProfile, SourceEnvironment, SourceInstanceMetadata}, selection.Sources)
+	assert.Empty(t, selection.Warnings)
+
+	env := Environment{
+		ContainerEndpoint:    "http://169.254.170.2/v2/credentials/task",
+		WebIdentityTokenFile: "/var/run/secrets/token",
+		RoleArn:              "arn:aws:iam::123456789012:role/agent",
+	}
+	selection, err = Select(Config{}, env, agentProviders)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{SourceProfile, SourceEnvironment, SourceWebIdentity, SourceContainer, SourceInstanceMetadata}, selection.Sources)
+
+	// the configured order is kept and the sources left out are not used
+	selection, err = Select(Config{Precedence: []string{SourceContainer, SourceProfile}}, env, agentProviders)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{SourceContainer, SourceProfile}, selection.Sources)
+
+	// instance metadata in a pod may be served by a proxy
+	selection, err = Select(Config{Precedence: []string{SourceInstanceMetadata}}, Environment{Kubernetes: true}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, selection.Warnings, 1)
+
+	_, err = Select(Config{Precedence: []string{"ec2"}}, env, agentProviders)
+	assert.NotNil(t, err)
+	_, err = Select(Config{Precedence: []string{SourceManaged}}, env, agentProviders)
+	assert.NotNil(t, err)
+	_, err = Select(Config{}, Environment{WebIdentityTokenFile: "/var/run/secrets/token"}, nil)
+	assert.NotNil(t, err)
+	_, err = Select(Config{}, Environment{ContainerEndpoint: "http://credentials.example.com/role"}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestContainerProvider(t *testing.T) {
+	expiration := time.Now().Add(time.Hour).UTC()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprintf(w, `{"AccessKeyId":"AKID","SecretAccessKey":"secret","Token":"session","Expiration":"%v"}`, expiration.Format(time.RFC3339))
+	}))
+	defer server.Close()
+	assert.Nil(t, validateContainerEndpoint(server.URL))
+
+	provider := newContainerProvider(Environment{ContainerEndpoint: server.URL, ContainerAuthorization: "token"})
+	value, err := provider.Retrieve()
+	assert.Nil(t, err)
+	assert.Equal(t, credentials.Value{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "session", ProviderName: containerProviderName}, value)
+	assert.False(t, provider.IsExpired())
+
+	provider = newContainerProvider(Environment{ContainerEndpoint: server.URL})
+	_, err = provider.Retrieve()
+	assert.NotNil(t, err)
+}
+
+func TestWebIdentityProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webidentity")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	assert.Nil(t, ioutil.WriteFile(tokenFile, []byte("jwt\n"), 0600))
+
+	original := assumeRoleWithWebIdentity
+	defer func() { assumeRoleWithWebIdentity = original }()
+	assumeRoleWithWebIdentity = func(region string, input *sts.AssumeRoleWithWebIdentityInput) (*sts.AssumeRoleWithWebIdentityOutput, error) {
+		assert.Equal(t, "us-west-2", region)
+		assert.Equal(t, "jwt", *input.WebIdentityToken)
+		assert.Equal(t, "agent", *input.RoleSessionName)
+		return &sts.AssumeRoleWithWebIdentityOutput{Credentials: &sts.Credentials{
+			AccessKeyId:     aws.String("AKID"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("session"),
+			Expiration:      aws.Time(time.Now().Add(time.Hour)),
+		}}, nil
+	}
+
+	env := Environment{WebIdentityTokenFile: tokenFile, RoleArn: "arn:aws:iam::123456789012:role/agent", RoleSessionName: "agent"}
+	provider := newWebIdentityProvider(env, "us-west-2")
+	value, err := provider.Retrieve()
+	assert.Nil(t, err)
+	assert.Equal(t, "AKID", value.AccessKeyID)
+	assert.Equal(t, "session", value.SessionToken)
+	assert.False(t, provider.IsExpired())
+
+	provider.tokenFile = filepath.Join(dir, "missing")
+	_, err = provider.Retrieve()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,92 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package credentialsource
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// webIdentityProviderName is the name of the web identity credentials provider.
+const webIdentityProviderName = "WebIdentityCredentialsProvider"
+
+// assumeRoleWithWebIdentity calls sts, replaced by tests.
+var assumeRoleWithWebIdentity = func(region string, input *sts.AssumeRoleWithWebIdentityInput) (*sts.AssumeRoleWithWebIdentityOutput, error) {
+	config := &aws.Config{Credentials: credentials.AnonymousCredentials}
+	if region != "" {
+		config.Region = aws.String(region)
+	}
+	return sts.New(session.New(config)).AssumeRoleWithWebIdentity(input)
+}
+
+// webIdentityProvider exchanges the web identity token of a service account for the credentials of its role.
+// The token file is read again on every refresh, the kubelet rotates it.
+type webIdentityProvider struct {
+	credentials.Expiry
+
+	tokenFile   string
+	roleArn     string
+	sessionName string
+	region      string
+}
+
+// newWebIdentityProvider returns the provider of the web identity of the environment.
+func newWebIdentityProvider(env Environment, region string) *webIdentityProvider {
+	sessionName := env.RoleSessionName
+	if sessionName == "" {
+		sessionName = "amazon-ssm-agent-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	return &webIdentityProvider{
+		tokenFile:   env.WebIdentityTokenFile,
+		roleArn:     env.RoleArn,
+		sessionName: sessionName,
+		region:      region,
+	}
+}
+
+// Retrieve assumes the role with the current token.
+func (p *webIdentityProvider) Retrieve() (value credentials.Value, err error) {
+	value.ProviderName = webIdentityProviderName
+	token, err := ioutil.ReadFile(p.tokenFile)
+	if err != nil {
+		return value, fmt.Errorf("failed to read the web identity token: %v", err)
+	}
+	output, err := assumeRoleWithWebIdentity(p.region, &sts.AssumeRoleWithWebIdentityInput{
+		RoleArn:          aws.String(p.roleArn),
+		RoleSessionName:  aws.String(p.sessionName),
+		WebIdentityToken: aws.String(strings.TrimSpace(string(token))),
+	})
+	if err != nil {
+		return value, fmt.Errorf("failed to assume role %v with the web identity: %v", p.roleArn, err)
+	}
+	creds := output.Credentials
+	if creds == nil {
+		return value, fmt.Errorf("failed to assume role %v with the web identity: no credentials", p.roleArn)
+	}
+	if creds.Expiration != nil {
+		p.SetExpiration(*creds.Expiration, expiryWindow)
+	}
+	value.AccessKeyID = aws.StringValue(creds.AccessKeyId)
+	value.SecretAccessKey = aws.StringValue(creds.SecretAccessKey)
+	value.SessionToken = aws.StringValue(creds.SessionToken)
+	return value, nil
+}
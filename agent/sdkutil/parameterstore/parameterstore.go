@@ -0,0 +1,67 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package parameterstore reads parameters of the Systems Manager Parameter Store.
+package parameterstore
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+// getParametersInput is the request of the Parameter Store GetParameters API,
+// which the vendored sdk does not model yet. The json protocol serializes it by field name.
+type getParametersInput struct {
+	Names          []*string
+	WithDecryption *bool
+}
+
+// parameter is a parameter returned by the GetParameters API.
+type parameter struct {
+	Name  *string
+	Type  *string
+	Value *string
+}
+
+// getParametersOutput is the response of the GetParameters API.
+type getParametersOutput struct {
+	Parameters        []*parameter
+	InvalidParameters []*string
+}
+
+// GetParameter returns the value and the type of a parameter, SecureString parameters are decrypted.
+// The credentials of the client need ssm:GetParameters on the parameter and kms:Decrypt on its key.
+func GetParameter(client *ssm.SSM, name string) (value string, parameterType string, err error) {
+	operation := &request.Operation{
+		Name:       "GetParameters",
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}
+	input := &getParametersInput{
+		Names:          []*string{aws.String(name)},
+		WithDecryption: aws.Bool(true),
+	}
+	output := &getParametersOutput{}
+	if err = client.NewRequest(operation, input, output).Send(); err != nil {
+		return "", "", fmt.Errorf("failed to get parameter %v: %v", name, err)
+	}
+	for _, p := range output.Parameters {
+		if aws.StringValue(p.Name) == name {
+			return aws.StringValue(p.Value), aws.StringValue(p.Type), nil
+		}
+	}
+	return "", "", fmt.Errorf("parameter %v not found", name)
+}
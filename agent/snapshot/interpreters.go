@@ -0,0 +1,54 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package snapshot records the context a step has been executed in, so that failures can be reproduced.
+// interpreters contains the functions probing the versions of the interpreters available on the instance.
+package snapshot
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// interpreterProbe is the command printing the version of an interpreter.
+type interpreterProbe struct {
+	name string
+	args []string
+}
+
+// interpreterVersionsOnInstance runs the probes of the platform and returns the first line of their output.
+// Interpreters that are not installed are left out.
+func interpreterVersionsOnInstance() map[string]string {
+	versions := make(map[string]string)
+	for _, probe := range interpreterProbes {
+		if _, err := exec.LookPath(probe.name); err != nil {
+			continue
+		}
+		output, err := exec.Command(probe.name, probe.args...).CombinedOutput()
+		if err != nil {
+			continue
+		}
+		versions[probe.name] = firstLine(string(output))
+	}
+	return versions
+}
+
+// firstLine returns the first non empty line of the text.
+func firstLine(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,25 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build darwin freebsd linux netbsd openbsd
+
+// Package snapshot records the context a step has been executed in, so that failures can be reproduced.
+package snapshot
+
+// interpreterProbes are the interpreters recorded in the snapshots on unix platforms.
+var interpreterProbes = []interpreterProbe{
+	{name: "bash", args: []string{"--version"}},
+	{name: "python", args: []string{"--version"}},
+	{name: "python3", args: []string{"--version"}},
+	{name: "pwsh", args: []string{"-NoProfile", "-Command", "$PSVersionTable.PSVersion.ToString()"}},
+}
@@ -0,0 +1,247 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package snapshot records the context a step has been executed in, so that failures can be reproduced.
+// machinestate captures the state of the machine before a step changes it, for a rollback document to restore it.
+package snapshot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/times"
+)
+
+// MachineStateFileName is the name of the machine state file, written in the orchestration directory of the step.
+const MachineStateFileName = "machinestate.json"
+
+// MachineState is the state of the machine before a step ran.
+type MachineState struct {
+	PluginID       string      `json:"pluginId"`
+	MessageID      string      `json:"messageId"`
+	Time           string      `json:"time"`
+	PackageManager string      `json:"packageManager,omitempty"`
+	Packages       []Package   `json:"packages,omitempty"`
+	Services       []Service   `json:"services,omitempty"`
+	Files          []FileState `json:"files,omitempty"`
+	// Errors are the parts of the state that could not be captured, the step runs anyway
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Package is an installed package.
+type Package struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// Service is a service of the init system.
+type Service struct {
+	Name      string `json:"name"`
+	State     string `json:"state"`
+	StartType string `json:"startType,omitempty"`
+}
+
+// FileState is the content of a file, Exists is false if the path did not exist.
+type FileState struct {
+	Path   string `json:"path"`
+	Exists bool   `json:"exists"`
+	Size   int64  `json:"size,omitempty"`
+	Mode   string `json:"mode,omitempty"`
+	Sha256 string `json:"sha256,omitempty"`
+}
+
+var (
+	lookPath   = exec.LookPath
+	runCommand = func(name string, args ...string) (string, error) {
+		output, err := exec.Command(name, args...).Output()
+		return string(output), err
+	}
+)
+
+// CaptureMachineState returns the state of the machine selected by the capture of the step.
+// The parts that fail are recorded in the errors of the state.
+func CaptureMachineState(pluginID string, config contracts.Configuration) (state MachineState) {
+	state.PluginID = pluginID
+	state.MessageID = config.MessageId
+	state.Time = times.ToIso8601UTC(times.DefaultClock.Now())
+	capture := config.CaptureState
+	if capture == nil {
+		return
+	}
+
+	var err error
+	if capture.Packages {
+		if state.PackageManager, state.Packages, err = installedPackages(); err != nil {
+			state.Errors = append(state.Errors, fmt.Sprintf("failed to list the packages: %v", err))
+		}
+		sort.Sort(packagesByName(state.Packages))
+	}
+	if capture.Services {
+		if state.Services, err = serviceStates(); err != nil {
+			state.Errors = append(state.Errors, fmt.Sprintf("failed to list the services: %v", err))
+		}
+		sort.Sort(servicesByName(state.Services))
+	}
+	for _, pattern := range capture.Files {
+		files, err := fileStates(pattern)
+		if err != nil {
+			state.Errors = append(state.Errors, fmt.Sprintf("failed to hash %v: %v", pattern, err))
+		}
+		state.Files = append(state.Files, files...)
+	}
+	return
+}
+
+// SaveMachineState writes the machine state in the given orchestration directory.
+func SaveMachineState(orchestrationDir string, state MachineState) (err error) {
+	var content []byte
+	if content, err = json.MarshalIndent(state, "", "  "); err != nil {
+		return
+	}
+	if err = fileutil.MakeDirs(orchestrationDir); err != nil {
+		return
+	}
+	return fileutil.HardenedWriteFile(filepath.Join(orchestrationDir, MachineStateFileName), content)
+}
+
+// LoadMachineState reads the machine state saved in the given orchestration directory.
+func LoadMachineState(orchestrationDir string) (state MachineState, err error) {
+	var content []byte
+	if content, err = ioutil.ReadFile(filepath.Join(orchestrationDir, MachineStateFileName)); err != nil {
+		return
+	}
+	err = json.Unmarshal(content, &state)
+	return
+}
+
+// FindMachineStates returns the machine states captured before the steps of a command.
+func FindMachineStates(commandID string) (states []MachineState, err error) {
+	pattern := filepath.Join(appconfig.OrchestrationRootPath("*"), commandID, "*", MachineStateFileName)
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return
+	}
+	sort.Strings(matches)
+	for _, match := range matches {
+		var state MachineState
+		if state, err = LoadMachineState(filepath.Dir(match)); err != nil {
+			return states, fmt.Errorf("unable to read machine state %v: %v", match, err)
+		}
+		states = append(states, state)
+	}
+	if len(states) == 0 {
+		err = fmt.Errorf("no machine state found for command %v", commandID)
+	}
+	return
+}
+
+// fileStates returns the state of the files matching the pattern. A path without match is recorded as missing,
+// so that the rollback deletes the file the step creates.
+func fileStates(pattern string) (files []FileState, err error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return
+	}
+	if len(matches) == 0 {
+		if strings.ContainsAny(pattern, "*?[") {
+			return
+		}
+		return []FileState{{Path: pattern}}, nil
+	}
+	sort.Strings(matches)
+	for _, match := range matches {
+		var file FileState
+		if file, err = fileState(match); err != nil {
+			return
+		}
+		files = append(files, file)
+	}
+	return
+}
+
+// fileState returns the size, the mode and the hash of a file. Directories are recorded without hash.
+func fileState(path string) (file FileState, err error) {
+	file.Path = path
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return file, nil
+	}
+	if err != nil {
+		return
+	}
+	file.Exists = true
+	file.Mode = info.Mode().String()
+	if info.IsDir() {
+		return
+	}
+	file.Size = info.Size()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return
+	}
+	file.Sha256 = hex.EncodeToString(hash.Sum(nil))
+	return
+}
+
+// packagesByName sorts packages by name.
+type packagesByName []Package
+
+func (p packagesByName) Len() int           { return len(p) }
+func (p packagesByName) Less(i, j int) bool { return p[i].Name < p[j].Name }
+func (p packagesByName) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// servicesByName sorts services by name.
+type servicesByName []Service
+
+func (s servicesByName) Len() int           { return len(s) }
+func (s servicesByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s servicesByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// parseFields splits the lines of the output of a command into fields, separated by blanks when the separator is empty.
+// Lines with less than minFields fields are skipped.
+func parseFields(output string, separator string, minFields int) (lines [][]string) {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var fields []string
+		if separator == "" {
+			fields = strings.Fields(line)
+		} else {
+			fields = strings.Split(line, separator)
+		}
+		if len(fields) >= minFields {
+			lines = append(lines, fields)
+		}
+	}
+	return
+}
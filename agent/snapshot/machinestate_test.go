@@ -0,0 +1,83 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package snapshot
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaptureMachineStateFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "machinestate")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "app.conf"), []byte("port=80\n"), 0600))
+	missing := filepath.Join(dir, "created.conf")
+
+	config := contracts.Configuration{
+		MessageId:    "m1",
+		CaptureState: &contracts.StateCapture{Files: []string{filepath.Join(dir, "*.conf"), missing, filepath.Join(dir, "*.ini")}},
+	}
+	state := CaptureMachineState("aws:runShellScript", config)
+
+	assert.Equal(t, "aws:runShellScript", state.PluginID)
+	assert.Equal(t, "m1", state.MessageID)
+	assert.Empty(t, state.Errors)
+	assert.Equal(t, []FileState{
+		{
+			Path:   filepath.Join(dir, "app.conf"),
+			Exists: true,
+			Size:   8,
+			Mode:   "-rw-------",
+			Sha256: "8ac56ba2b165fcd437ca405ef420a36ccbda0f41ce603a07db42752ff00335a2",
+		},
+		{Path: missing},
+	}, state.Files)
+}
+
+func TestCaptureMachineStateWithoutCapture(t *testing.T) {
+	state := CaptureMachineState("aws:runShellScript", contracts.Configuration{MessageId: "m1"})
+	assert.Empty(t, state.Packages)
+	assert.Empty(t, state.Services)
+	assert.Empty(t, state.Files)
+}
+
+func TestSaveAndLoadMachineState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "machinestate")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	state := MachineState{
+		PluginID:       "aws:runShellScript",
+		PackageManager: "rpm",
+		Packages:       []Package{{Name: "httpd", Version: "2.4.6-45.el7.x86_64"}},
+		Services:       []Service{{Name: "httpd", State: "active", StartType: "enabled"}},
+		Errors:         []string{"failed to hash /etc/app: permission denied"},
+	}
+	assert.Nil(t, SaveMachineState(dir, state))
+
+	loaded, err := LoadMachineState(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, state, loaded)
+}
+
+func TestParseFields(t *testing.T) {
+	assert.Equal(t, [][]string{{"bash", "4.2"}, {"zlib"}}, parseFields("bash\t4.2\r\n\nzlib\n", "\t", 1))
+	assert.Equal(t, [][]string{{"sshd.service", "enabled"}}, parseFields("sshd.service  enabled\nbroken\n", "", 2))
+}
@@ -0,0 +1,107 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build darwin freebsd linux netbsd openbsd
+
+package snapshot
+
+import (
+	"fmt"
+	"strings"
+)
+
+// packageManagers are the package managers whose packages are captured, the first one installed is used.
+var packageManagers = []struct {
+	name string
+	args []string
+}{
+	{name: "dpkg-query", args: []string{"-W", "-f=${Package}\t${Version}\n"}},
+	{name: "rpm", args: []string{"-qa", "--queryformat", "%{NAME}\t%{VERSION}-%{RELEASE}.%{ARCH}\n"}},
+	{name: "pkgutil", args: []string{"--pkgs"}},
+}
+
+// installedPackages lists the packages of the first package manager of the instance.
+func installedPackages() (manager string, packages []Package, err error) {
+	for _, candidate := range packageManagers {
+		if _, err = lookPath(candidate.name); err != nil {
+			continue
+		}
+		var output string
+		if output, err = runCommand(candidate.name, candidate.args...); err != nil {
+			return candidate.name, nil, err
+		}
+		for _, fields := range parseFields(output, "\t", 1) {
+			p := Package{Name: fields[0]}
+			if len(fields) > 1 {
+				p.Version = fields[1]
+			}
+			packages = append(packages, p)
+		}
+		return candidate.name, packages, nil
+	}
+	return "", nil, fmt.Errorf("no supported package manager found")
+}
+
+// serviceStates lists the services of systemd, or of launchd on macOS.
+func serviceStates() (services []Service, err error) {
+	if _, err = lookPath("systemctl"); err == nil {
+		return systemdServices()
+	}
+	if _, err = lookPath("launchctl"); err == nil {
+		return launchdServices()
+	}
+	return nil, fmt.Errorf("no supported init system found")
+}
+
+// systemdServices returns the active state of the loaded services and whether they start at boot.
+func systemdServices() (services []Service, err error) {
+	units, err := runCommand("systemctl", "list-units", "--type=service", "--all", "--no-legend", "--no-pager", "--plain")
+	if err != nil {
+		return
+	}
+	unitFiles, err := runCommand("systemctl", "list-unit-files", "--type=service", "--no-legend", "--no-pager")
+	if err != nil {
+		return
+	}
+	startTypes := make(map[string]string)
+	for _, fields := range parseFields(unitFiles, "", 2) {
+		startTypes[fields[0]] = fields[1]
+	}
+	for _, fields := range parseFields(units, "", 4) {
+		services = append(services, Service{
+			Name:      strings.TrimSuffix(fields[0], ".service"),
+			State:     fields[2],
+			StartType: startTypes[fields[0]],
+		})
+	}
+	return
+}
+
+// launchdServices returns whether the jobs of launchd run.
+func launchdServices() (services []Service, err error) {
+	output, err := runCommand("launchctl", "list")
+	if err != nil {
+		return
+	}
+	for _, fields := range parseFields(output, "\t", 3) {
+		if fields[0] == "PID" {
+			continue
+		}
+		state := "running"
+		if fields[0] == "-" {
+			state = "stopped"
+		}
+		services = append(services, Service{Name: fields[2], State: state})
+	}
+	return
+}
@@ -0,0 +1,85 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build darwin freebsd linux netbsd openbsd
+
+package snapshot
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubCommands makes the given commands available with the given output.
+func stubCommands(outputs map[string]string) (restore func()) {
+	originalLookPath, originalRunCommand := lookPath, runCommand
+	lookPath = func(name string) (string, error) {
+		for command := range outputs {
+			if strings.HasPrefix(command, name) {
+				return "/usr/bin/" + name, nil
+			}
+		}
+		return "", fmt.Errorf("%v not found", name)
+	}
+	runCommand = func(name string, args ...string) (string, error) {
+		command := strings.Join(append([]string{name}, args...), " ")
+		for prefix, output := range outputs {
+			if strings.HasPrefix(command, prefix) {
+				return output, nil
+			}
+		}
+		return "", fmt.Errorf("unexpected command %v", command)
+	}
+	return func() {
+		lookPath, runCommand = originalLookPath, originalRunCommand
+	}
+}
+
+func TestCaptureMachineStatePackagesAndServices(t *testing.T) {
+	defer stubCommands(map[string]string{
+		"rpm":                       "openssl\t1.0.2k-8.el7.x86_64\nhttpd\t2.4.6-45.el7.x86_64\n",
+		"systemctl list-units":      "sshd.service loaded active running OpenSSH server daemon\nhttpd.service loaded inactive dead The Apache HTTP Server\n",
+		"systemctl list-unit-files": "httpd.service disabled\nsshd.service enabled\n",
+	})()
+
+	state := CaptureMachineState("aws:runShellScript", contracts.Configuration{CaptureState: &contracts.StateCapture{Packages: true, Services: true}})
+
+	assert.Empty(t, state.Errors)
+	assert.Equal(t, "rpm", state.PackageManager)
+	assert.Equal(t, []Package{{Name: "httpd", Version: "2.4.6-45.el7.x86_64"}, {Name: "openssl", Version: "1.0.2k-8.el7.x86_64"}}, state.Packages)
+	assert.Equal(t, []Service{
+		{Name: "httpd", State: "inactive", StartType: "disabled"},
+		{Name: "sshd", State: "active", StartType: "enabled"},
+	}, state.Services)
+}
+
+func TestCaptureMachineStateWithoutTools(t *testing.T) {
+	defer stubCommands(map[string]string{})()
+
+	state := CaptureMachineState("aws:runShellScript", contracts.Configuration{CaptureState: &contracts.StateCapture{Packages: true, Services: true}})
+
+	assert.Len(t, state.Errors, 2)
+	assert.Empty(t, state.Packages)
+}
+
+func TestLaunchdServices(t *testing.T) {
+	defer stubCommands(map[string]string{"launchctl": "PID\tStatus\tLabel\n312\t0\tcom.apple.sshd\n-\t0\tcom.acme.agent\n"})()
+
+	services, err := serviceStates()
+	assert.Nil(t, err)
+	assert.Equal(t, []Service{{Name: "com.apple.sshd", State: "running"}, {Name: "com.acme.agent", State: "stopped"}}, services)
+}
@@ -0,0 +1,61 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build windows
+
+package snapshot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// installedPackagesScript lists the programs of the uninstall registry keys, 64 and 32 bits.
+	installedPackagesScript = `Get-ItemProperty 'HKLM:\Software\Microsoft\Windows\CurrentVersion\Uninstall\*','HKLM:\Software\Wow6432Node\Microsoft\Windows\CurrentVersion\Uninstall\*' -ErrorAction SilentlyContinue | Where-Object { $_.DisplayName } | ForEach-Object { "{0}` + "`t" + `{1}" -f $_.DisplayName, $_.DisplayVersion }`
+
+	// serviceStatesScript lists the services with their status and start type.
+	serviceStatesScript = `Get-Service | ForEach-Object { "{0}` + "`t" + `{1}` + "`t" + `{2}" -f $_.Name, $_.Status, $_.StartType }`
+)
+
+// powerShell is the path of Windows PowerShell.
+var powerShell = filepath.Join(os.Getenv("SystemRoot"), "System32", "WindowsPowerShell", "v1.0", "powershell.exe")
+
+// installedPackages lists the programs installed with Windows Installer or registered for uninstall.
+func installedPackages() (manager string, packages []Package, err error) {
+	output, err := runCommand(powerShell, "-NoProfile", "-NonInteractive", "-Command", installedPackagesScript)
+	if err != nil {
+		return "windows", nil, fmt.Errorf("failed to list the installed programs: %v", err)
+	}
+	for _, fields := range parseFields(output, "\t", 1) {
+		p := Package{Name: fields[0]}
+		if len(fields) > 1 {
+			p.Version = fields[1]
+		}
+		packages = append(packages, p)
+	}
+	return "windows", packages, nil
+}
+
+// serviceStates lists the services of the service control manager.
+func serviceStates() (services []Service, err error) {
+	output, err := runCommand(powerShell, "-NoProfile", "-NonInteractive", "-Command", serviceStatesScript)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the services: %v", err)
+	}
+	for _, fields := range parseFields(output, "\t", 3) {
+		services = append(services, Service{Name: fields[0], State: fields[1], StartType: fields[2]})
+	}
+	return
+}
@@ -0,0 +1,226 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package snapshot records the context a step has been executed in, so that failures can be reproduced.
+// A snapshot holds the resolved properties of the step, the working directory and the environment the step runs with,
+// and the versions of the interpreters available on the instance. Secret looking values are redacted before being written.
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/audit"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/times"
+	"github.com/aws/amazon-ssm-agent/agent/version"
+)
+
+// FileName is the name of the snapshot file, written in the orchestration directory of the step.
+const FileName = "snapshot.json"
+
+// Snapshot is the execution context of a step.
+type Snapshot struct {
+	PluginID         string            `json:"pluginId"`
+	MessageID        string            `json:"messageId"`
+	Time             string            `json:"time"`
+	AgentVersion     string            `json:"agentVersion"`
+	Platform         string            `json:"platform"`
+	WorkingDirectory string            `json:"workingDirectory"`
+	Properties       interface{}       `json:"properties,omitempty"`
+	Environment      map[string]string `json:"environment,omitempty"`
+	Interpreters     map[string]string `json:"interpreters,omitempty"`
+}
+
+var (
+	interpretersOnce    sync.Once
+	interpreterVersions map[string]string
+	probeInterpreters   = interpreterVersionsOnInstance
+	getWorkingDirectory = os.Getwd
+	getEnvironment      = os.Environ
+)
+
+// Capture returns the sanitized snapshot of the step about to run with the given configuration.
+// The working directory and the environment are the ones of the agent, the plugins starting processes
+// replace them with the ones of their processes, see RecordProcess.
+// The values of the secret looking properties are also masked where they appear in the other properties,
+// such as the commands they were interpolated into.
+func Capture(pluginID string, config contracts.Configuration) Snapshot {
+	secrets := secretValues(config.Properties)
+	workingDirectory, _ := getWorkingDirectory()
+	return Snapshot{
+		PluginID:         pluginID,
+		MessageID:        config.MessageId,
+		Time:             times.ToIso8601UTC(times.DefaultClock.Now()),
+		AgentVersion:     version.Version,
+		Platform:         runtime.GOOS + "/" + runtime.GOARCH,
+		WorkingDirectory: workingDirectory,
+		Properties:       redactValue(config.Properties, secrets),
+		Environment:      redactEnvironment(getEnvironment(), secrets),
+		Interpreters:     interpreters(),
+	}
+}
+
+// RecordProcess replaces the working directory and the environment of the snapshot saved in the orchestration
+// directory with the ones of the process started by the step, the given secrets are masked in the environment.
+// An empty working directory is the one of the agent. Steps without a snapshot are left alone.
+func RecordProcess(orchestrationDir string, workingDirectory string, environment []string, secrets []string) error {
+	snapshot, err := Load(orchestrationDir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if workingDirectory == "" {
+		workingDirectory, _ = getWorkingDirectory()
+	}
+	snapshot.WorkingDirectory = workingDirectory
+	snapshot.Environment = redactEnvironment(environment, secrets)
+	return Save(orchestrationDir, snapshot)
+}
+
+// Save writes the snapshot in the given orchestration directory.
+func Save(orchestrationDir string, snapshot Snapshot) (err error) {
+	var content []byte
+	if content, err = json.MarshalIndent(snapshot, "", "  "); err != nil {
+		return
+	}
+	if err = fileutil.MakeDirs(orchestrationDir); err != nil {
+		return
+	}
+	return fileutil.HardenedWriteFile(filepath.Join(orchestrationDir, FileName), content)
+}
+
+// Load reads the snapshot saved in the given orchestration directory.
+func Load(orchestrationDir string) (snapshot Snapshot, err error) {
+	var content []byte
+	if content, err = ioutil.ReadFile(filepath.Join(orchestrationDir, FileName)); err != nil {
+		return
+	}
+	err = json.Unmarshal(content, &snapshot)
+	return
+}
+
+// Find returns the snapshots of the steps of a command, looking into the orchestration directories
+// of every instance registered on this machine.
+func Find(commandID string) (snapshots []Snapshot, err error) {
+	pattern := filepath.Join(appconfig.OrchestrationRootPath("*"), commandID, "*", FileName)
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return
+	}
+	sort.Strings(matches)
+	for _, match := range matches {
+		var snapshot Snapshot
+		if snapshot, err = Load(filepath.Dir(match)); err != nil {
+			return snapshots, fmt.Errorf("unable to read snapshot %v: %v", match, err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	if len(snapshots) == 0 {
+		err = fmt.Errorf("no snapshot found for command %v", commandID)
+	}
+	return
+}
+
+// interpreters returns the versions of the interpreters, probed once per agent process.
+func interpreters() map[string]string {
+	interpretersOnce.Do(func() {
+		interpreterVersions = probeInterpreters()
+	})
+	return interpreterVersions
+}
+
+// redactEnvironment returns the environment as a map, where the values of secret looking variables are replaced
+// and the secrets are masked in the other values.
+func redactEnvironment(environment []string, secrets []string) map[string]string {
+	variables := make(map[string]string, len(environment))
+	for _, variable := range environment {
+		parts := strings.SplitN(variable, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			continue
+		}
+		if audit.IsSecretName(parts[0]) {
+			variables[parts[0]] = audit.RedactedValue
+		} else {
+			variables[parts[0]] = maskSecrets(parts[1], secrets)
+		}
+	}
+	return variables
+}
+
+// redactValue returns a copy of the properties where the values of secret looking keys are replaced, at any depth,
+// and the secrets are masked in the strings.
+func redactValue(value interface{}, secrets []string) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(typed))
+		for name, item := range typed {
+			if audit.IsSecretName(name) {
+				redacted[name] = audit.RedactedValue
+			} else {
+				redacted[name] = redactValue(item, secrets)
+			}
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(typed))
+		for i, item := range typed {
+			redacted[i] = redactValue(item, secrets)
+		}
+		return redacted
+	case string:
+		return maskSecrets(typed, secrets)
+	default:
+		return value
+	}
+}
+
+// secretValues returns the non empty string values of the secret looking keys of the properties, at any depth.
+// They are the secrets the executer masks in the output of the commands, such as the secret environment variables.
+func secretValues(value interface{}) (secrets []string) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for name, item := range typed {
+			if secret, ok := item.(string); ok && secret != "" && audit.IsSecretName(name) {
+				secrets = append(secrets, secret)
+			} else {
+				secrets = append(secrets, secretValues(item)...)
+			}
+		}
+	case []interface{}:
+		for _, item := range typed {
+			secrets = append(secrets, secretValues(item)...)
+		}
+	}
+	return
+}
+
+// maskSecrets replaces the non empty secrets found in the value.
+func maskSecrets(value string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			value = strings.Replace(value, secret, audit.RedactedValue, -1)
+		}
+	}
+	return value
+}
@@ -0,0 +1,155 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package main represents the entry point of ssm-cli, the command line tools helping developers write documents.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/explain"
+	"github.com/aws/amazon-ssm-agent/agent/jsonutil"
+	logger "github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/external"
+	"github.com/aws/amazon-ssm-agent/agent/snapshot"
+)
+
+const (
+	explainDocumentCommand    = "explain-document"
+	longRunningPluginsCommand = "long-running-plugins"
+	snapshotCommand           = "snapshot"
+)
+
+func main() {
+	log := logger.Logger()
+	defer log.Flush()
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(1)
+	}
+	switch os.Args[1] {
+	case explainDocumentCommand:
+		os.Exit(explainDocument(log, os.Args[2:]))
+	case longRunningPluginsCommand:
+		os.Exit(longRunningPlugins())
+	case snapshotCommand:
+		os.Exit(printSnapshots(os.Args[2:]))
+	default:
+		usage()
+		os.Exit(1)
+	}
+}
+
+// usage displays a command-line friendly usage message
+func usage() {
+	fmt.Fprintln(os.Stderr, "\n\nCommand-line Usage:")
+	fmt.Fprintf(os.Stderr, "\t%v\tprint, per platform, the plugins a document would run, with their properties resolved\n", explainDocumentCommand)
+	fmt.Fprintln(os.Stderr, "\t\t-document\tfile of the document content\t(REQUIRED)")
+	fmt.Fprintln(os.Stderr, "\t\t-parameters\tfile of the parameters, as a json object")
+	fmt.Fprintln(os.Stderr, "\t\t-profile\tfile of the instance profile the preconditions are evaluated against")
+	fmt.Fprintf(os.Stderr, "\t%v\tprint the state and the restart count of the long-running plugins, as last saved by the agent\n", longRunningPluginsCommand)
+	fmt.Fprintf(os.Stderr, "\t%v\tprint the execution snapshots of the steps of a command run on this instance\n", snapshotCommand)
+	fmt.Fprintln(os.Stderr, "\t\t-command\tID of the command\t(REQUIRED)")
+}
+
+// explainDocument prints how the agent of each platform of the profile would run the document.
+func explainDocument(log logger.T, args []string) (exitCode int) {
+	flags := flag.NewFlagSet(explainDocumentCommand, flag.ContinueOnError)
+	flags.Usage = usage
+	documentPath := flags.String("document", "", "")
+	parametersPath := flags.String("parameters", "", "")
+	profilePath := flags.String("profile", "", "")
+	if err := flags.Parse(args); err != nil || *documentPath == "" {
+		usage()
+		return 1
+	}
+
+	var document contracts.DocumentContent
+	if err := jsonutil.UnmarshalFile(*documentPath, &document); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid document %v: %v\n", *documentPath, err)
+		return 1
+	}
+	var params map[string]interface{}
+	if *parametersPath != "" {
+		if err := jsonutil.UnmarshalFile(*parametersPath, &params); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid parameters %v: %v\n", *parametersPath, err)
+			return 1
+		}
+	}
+	var profile explain.Profile
+	if *profilePath != "" {
+		if err := jsonutil.UnmarshalFile(*profilePath, &profile); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid profile %v: %v\n", *profilePath, err)
+			return 1
+		}
+	}
+
+	explanations, err := explain.Explain(log, document, params, profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid profile %v: %v\n", *profilePath, err)
+		return 1
+	}
+	content, err := json.MarshalIndent(explanations, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to format the explanation: %v\n", err)
+		return 1
+	}
+	fmt.Println(string(content))
+	return 0
+}
+
+// longRunningPlugins prints the health of the long-running plugins saved by the agent on this instance.
+func longRunningPlugins() (exitCode int) {
+	report, err := external.LoadLongRunningHealth()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to read the health of the long-running plugins, is the agent running? %v\n", err)
+		return 1
+	}
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to format the health of the long-running plugins: %v\n", err)
+		return 1
+	}
+	fmt.Println(string(content))
+	fmt.Fprintln(os.Stderr, external.HealthSummary(report.Plugins))
+	return 0
+}
+
+// printSnapshots prints the execution snapshots saved by the agent for the steps of a command.
+func printSnapshots(args []string) (exitCode int) {
+	flags := flag.NewFlagSet(snapshotCommand, flag.ContinueOnError)
+	flags.Usage = usage
+	commandID := flags.String("command", "", "")
+	if err := flags.Parse(args); err != nil || *commandID == "" {
+		usage()
+		return 1
+	}
+
+	snapshots, err := snapshot.Find(*commandID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to read the execution snapshots: %v\n", err)
+		return 1
+	}
+	content, err := json.MarshalIndent(snapshots, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to format the execution snapshots: %v\n", err)
+		return 1
+	}
+	fmt.Println(string(content))
+	return 0
+}
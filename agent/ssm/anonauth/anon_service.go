@@ -13,10 +13,10 @@ import (
 	"log"
 
 	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/sdkutil/attribution"
 	"github.com/aws/amazon-ssm-agent/agent/ssm/util"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ssm"
 )
 
@@ -49,7 +49,7 @@ func NewAnonymousService(region string) AnonymousService {
 	}
 
 	// Create a session to share service client config and handlers with
-	ssmSess := session.New(awsConfig)
+	ssmSess := attribution.NewSession(awsConfig)
 
 	ssmService := ssm.New(ssmSess)
 	return &sdkService{sdk: ssmService}
@@ -0,0 +1,31 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ssm
+
+import (
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/sdkutil/parameterstore"
+)
+
+// GetParameter returns the value of a Parameter Store parameter, SecureString parameters are decrypted.
+// The call is made with the credentials of the instance, which need ssm:GetParameters on the parameter
+// and kms:Decrypt on its key.
+func GetParameter(log log.T, name string) (value string, err error) {
+	value, parameterType, err := parameterstore.GetParameter(newSdk(), name)
+	if err != nil {
+		return "", err
+	}
+	log.Debugf("got parameter %v of type %v", name, parameterType)
+	return value, nil
+}
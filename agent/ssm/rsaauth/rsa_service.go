@@ -10,10 +10,10 @@
 package rsaauth
 
 import (
+	"github.com/aws/amazon-ssm-agent/agent/sdkutil/attribution"
 	"github.com/aws/amazon-ssm-agent/agent/ssm/util"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/private/signer/v4"
 	"github.com/aws/aws-sdk-go/service/ssm"
 )
@@ -37,7 +37,7 @@ func NewRsaService(serverId string, region string, encodedPrivateKey string) Rsa
 	awsConfig.Credentials = credentials.NewStaticCredentials(serverId, encodedPrivateKey, "")
 
 	// Create a session to share service client config and handlers with
-	ssmSess := session.New(awsConfig)
+	ssmSess := attribution.NewSession(awsConfig)
 
 	// Clear existing singers
 	ssmSess.Handlers.Sign.Clear()
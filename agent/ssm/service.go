@@ -18,13 +18,16 @@ import (
 	"fmt"
 	"net/http"
 	"runtime"
+	"strings"
 
 	"github.com/aws/amazon-ssm-agent/agent/appconfig"
 	"github.com/aws/amazon-ssm-agent/agent/log"
 	"github.com/aws/amazon-ssm-agent/agent/platform"
+	"github.com/aws/amazon-ssm-agent/agent/proxy"
 	"github.com/aws/amazon-ssm-agent/agent/sdkutil"
+	"github.com/aws/amazon-ssm-agent/agent/sdkutil/attribution"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/ssm"
 )
 
@@ -43,7 +46,8 @@ type Service interface {
 	CancelCommand(log log.T, commandID string, instanceIDs []string) (response *ssm.CancelCommandOutput, err error)
 	CreateDocument(log log.T, docName string, docContent string) (response *ssm.CreateDocumentOutput, err error)
 	DeleteDocument(log log.T, instanceID string) (response *ssm.DeleteDocumentOutput, err error)
-	UpdateInstanceInformation(log log.T, agentVersion string, agentStatus string) (response *ssm.UpdateInstanceInformationOutput, err error)
+	GetDocument(log log.T, docName string) (response *ssm.GetDocumentOutput, err error)
+	UpdateInstanceInformation(log log.T, agentVersion string, agentStatus string, healthDetails ...string) (response *ssm.UpdateInstanceInformationOutput, err error)
 }
 
 var ssmStopPolicy *sdkutil.StopPolicy
@@ -60,6 +64,11 @@ func NewService() Service {
 		ssmStopPolicy = sdkutil.NewStopPolicy("ssmService", 10)
 	}
 
+	return &sdkService{sdk: newSdk()}
+}
+
+// newSdk creates the ssm sdk client with the endpoint overrides of the app config.
+func newSdk() *ssm.SSM {
 	awsConfig := sdkutil.AwsConfig()
 
 	// parse appConfig overrides
@@ -74,12 +83,12 @@ func NewService() Service {
 			tr := &http.Transport{
 				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 			}
+			proxy.ConfigureTransport(tr)
 			awsConfig.HTTPClient = &http.Client{Transport: tr}
 		}
 	}
 
-	ssmService := ssm.New(session.New(awsConfig))
-	return &sdkService{sdk: ssmService}
+	return ssm.New(attribution.NewSession(awsConfig))
 }
 
 func makeAwsStrings(strings []string) []*string {
@@ -111,10 +120,13 @@ func (svc *sdkService) ListAssociations(log log.T, instanceID string) (response
 }
 
 //UpdateInstanceInformation calls the UpdateInstanceInformation SSM API.
+// The API has no field for the health details, e.g. "backlog/3", they are added to the user agent
+// of the call, which CloudTrail records with it.
 func (svc *sdkService) UpdateInstanceInformation(
 	log log.T,
 	agentVersion string,
 	agentStatus string,
+	healthDetails ...string,
 ) (response *ssm.UpdateInstanceInformationOutput, err error) {
 
 	params := ssm.UpdateInstanceInformationInput{
@@ -162,8 +174,11 @@ func (svc *sdkService) UpdateInstanceInformation(
 	}
 
 	log.Debug("Calling UpdateInstanceInformation with params", params)
-	response, err = svc.sdk.UpdateInstanceInformation(&params)
-	if err != nil {
+	req, response := svc.sdk.UpdateInstanceInformationRequest(&params)
+	if len(healthDetails) > 0 {
+		req.Handlers.Build.PushBack(request.MakeAddToUserAgentFreeFormHandler(strings.Join(healthDetails, " ")))
+	}
+	if err = req.Send(); err != nil {
 		sdkutil.HandleAwsError(log, err, ssmStopPolicy)
 		return
 	}
@@ -185,6 +200,19 @@ func (svc *sdkService) CreateDocument(log log.T, docName string, docContent stri
 	return
 }
 
+func (svc *sdkService) GetDocument(log log.T, docName string) (response *ssm.GetDocumentOutput, err error) {
+	params := ssm.GetDocumentInput{
+		Name: aws.String(docName), // Required
+	}
+	response, err = svc.sdk.GetDocument(&params)
+	if err != nil {
+		sdkutil.HandleAwsError(log, err, ssmStopPolicy)
+		return
+	}
+	log.Debug("GetDocument Response", response)
+	return
+}
+
 func (svc *sdkService) DeleteDocument(log log.T, docName string) (response *ssm.DeleteDocumentOutput, err error) {
 	params := ssm.DeleteDocumentInput{
 		Name: aws.String(docName), // Required
@@ -81,8 +81,19 @@ func (m *Mock) DeleteDocument(log log.T, instanceID string) (response *ssm.Delet
 	return args.Get(0).(*ssm.DeleteDocumentOutput), args.Error(1)
 }
 
+// GetDocument mocks the GetDocument function.
+func (m *Mock) GetDocument(log log.T, docName string) (response *ssm.GetDocumentOutput, err error) {
+	args := m.Called(log, docName)
+	return args.Get(0).(*ssm.GetDocumentOutput), args.Error(1)
+}
+
 // UpdateInstanceInformation mocks the UpdateInstanceInformation function.
-func (m *Mock) UpdateInstanceInformation(log log.T, agentVersion string, agentStatus string) (response *ssm.UpdateInstanceInformationOutput, err error) {
+// The health details are expected only when some are given.
+func (m *Mock) UpdateInstanceInformation(log log.T, agentVersion string, agentStatus string, healthDetails ...string) (response *ssm.UpdateInstanceInformationOutput, err error) {
+	if len(healthDetails) > 0 {
+		args := m.Called(log, agentVersion, agentStatus, healthDetails)
+		return args.Get(0).(*ssm.UpdateInstanceInformationOutput), args.Error(1)
+	}
 	args := m.Called(log, agentVersion, agentStatus)
 	return args.Get(0).(*ssm.UpdateInstanceInformationOutput), args.Error(1)
 }
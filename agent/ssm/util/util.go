@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/proxy"
 	"github.com/aws/amazon-ssm-agent/agent/sdkutil/retryer"
 	"github.com/aws/aws-sdk-go/aws"
 )
@@ -29,6 +30,7 @@ func AwsConfig() *aws.Config {
 	awsConfig := &aws.Config{
 		Retryer:    newRetryer(),
 		SleepDelay: sleepDelay,
+		HTTPClient: &http.Client{Transport: proxy.Transport()},
 	}
 
 	// parse appConfig overrides
@@ -48,6 +50,7 @@ func AwsConfig() *aws.Config {
 		tr := &http.Transport{
 			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 		}
+		proxy.ConfigureTransport(tr)
 		awsConfig.HTTPClient = &http.Client{Transport: tr}
 	}
 
@@ -16,6 +16,7 @@ package task
 
 import (
 	"sync"
+	"time"
 )
 
 // State represents the state of a job.
@@ -58,6 +59,10 @@ type CancelFlag interface {
 	// In the go routine, once Wait returns, if the return value indicates that a cancel
 	// request has been received, the go routine wakes up the running job.
 	Wait() (state State)
+
+	// Done returns a channel that is closed once the flag is set to any state.
+	// Unlike Wait, it lets the caller give up waiting without leaving a routine behind.
+	Done() <-chan struct{}
 }
 
 // ChanneledCancelFlag is a default implementation of the task.CancelFlag interface.
@@ -101,6 +106,11 @@ func (t *ChanneledCancelFlag) Wait() (state State) {
 	return t.State()
 }
 
+// Done returns a channel that is closed when the flag is set.
+func (t *ChanneledCancelFlag) Done() <-chan struct{} {
+	return t.ch
+}
+
 // Set sets the state of this flag and wakes up waiting callers.
 func (t *ChanneledCancelFlag) Set(state State) {
 	t.m.Lock()
@@ -114,3 +124,20 @@ func (t *ChanneledCancelFlag) Set(state State) {
 		t.closed = true
 	}
 }
+
+// WaitFor waits for the given delay and returns false if a cancel or ShutDown was requested meanwhile.
+// A flag set to Completed does not end the wait.
+func WaitFor(delay time.Duration, cancelFlag CancelFlag) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-cancelFlag.Done():
+		if cancelFlag.Canceled() {
+			return false
+		}
+		<-timer.C
+	}
+	return !cancelFlag.Canceled()
+}
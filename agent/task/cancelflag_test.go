@@ -15,6 +15,7 @@ package task
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -60,3 +61,16 @@ func testWait(t *testing.T, state State) {
 	assert.Equal(t, state, <-ch)
 	assert.Equal(t, flag.Canceled(), state == Canceled)
 }
+
+// TestWaitFor tests that WaitFor returns early only when a cancel is requested
+func TestWaitFor(t *testing.T) {
+	flag := NewChanneledCancelFlag()
+	assert.True(t, WaitFor(time.Millisecond, flag))
+
+	flag.Set(Completed)
+	assert.True(t, WaitFor(time.Millisecond, flag))
+
+	flag = NewChanneledCancelFlag()
+	go flag.Set(Canceled)
+	assert.False(t, WaitFor(time.Hour, flag))
+}
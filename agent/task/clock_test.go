@@ -11,7 +11,7 @@
 // either express or implied. See the License for the specific language governing
 // permissions and limitations under the License.
 
-package times
+package task
 
 import (
 	"time"
@@ -19,9 +19,6 @@ import (
 	"github.com/stretchr/testify/mock"
 )
 
-// Note: This code is used in the test files. However, this code is not in a _test.go file
-// because then we would have to copy it in every test package that needs the mock.
-
 // MockedClock implements the Now method to return a predictable time and the
 // After method to return a channel that ca be woken up on demand.
 type MockedClock struct {
@@ -28,6 +28,9 @@ type Pool interface {
 	// Returns an error if a job with the same name already exists.
 	Submit(log log.T, jobID string, job Job) error
 
+	// SubmitWithPriority schedules a job like Submit, the queued jobs of a higher priority are started first.
+	SubmitWithPriority(log log.T, jobID string, job Job, priority Priority) error
+
 	// Cancel cancels the given job. Jobs that have not started yet will never be started.
 	// Jobs that are running will have their CancelFlag set to the Canceled state.
 	// It is the responsibility of the job to terminate within a reasonable time.
@@ -46,14 +49,18 @@ type Pool interface {
 
 // pool implements a task pool where all jobs are managed by a root task
 type pool struct {
-	log        log.T
-	jobQueue   chan JobToken
-	nWorkers   int
-	doneWorker chan struct{}
-	isShutdown bool
-	clock      times.Clock
-	mut        sync.Mutex
-	jobStore   *JobStore
+	log         log.T
+	jobQueue    []JobToken
+	queueCond   *sync.Cond
+	maxQueued   int
+	idleWorkers int
+	nWorkers    int
+	doneWorker  chan struct{}
+	isShutdown  bool
+	clock       times.Clock
+	mut         sync.Mutex
+	jobStore    *JobStore
+	processor   func(JobToken)
 }
 
 // JobToken embeds a job and its associated info
@@ -62,30 +69,40 @@ type JobToken struct {
 	job        Job
 	cancelFlag *ChanneledCancelFlag
 	log        log.T
+	priority   Priority
 }
 
 // NewPool creates a new task pool and launches maxParallel workers.
 // The cancelWaitDuration parameter defines how long to wait for a job
 // to complete a cancellation request.
+// Like the workers, at most maxParallel jobs wait in the queue; Submit blocks when the queue is full,
+// except for critical jobs.
 func NewPool(log log.T, maxParallel int, cancelWaitDuration time.Duration, clock times.Clock) Pool {
 	p := &pool{
 		log:        log,
-		jobQueue:   make(chan JobToken),
+		maxQueued:  maxParallel,
 		nWorkers:   maxParallel,
 		doneWorker: make(chan struct{}),
 		clock:      clock,
 	}
 
 	p.jobStore = NewJobStore()
+	p.queueCond = sync.NewCond(&p.mut)
 
 	// defines the job processing function.
-	processor := func(j JobToken) {
+	// background jobs get a cancel flag which lets them run the critical jobs at their safe points.
+	p.processor = func(j JobToken) {
 		defer p.jobStore.DeleteJob(j.id)
-		process(j.log, j.job, j.cancelFlag, cancelWaitDuration, p.clock)
+		job := j.job
+		if j.priority == PriorityBackground {
+			flag := preemptibleCancelFlag{ChanneledCancelFlag: j.cancelFlag, runPreempting: p.runPreempting}
+			job = func(CancelFlag) { j.job(flag) }
+		}
+		process(j.log, job, j.cancelFlag, cancelWaitDuration, p.clock)
 	}
 
 	// start the workers
-	p.start(processor)
+	p.start(p.processor)
 
 	return p
 }
@@ -98,11 +115,11 @@ func (p *pool) Shutdown() {
 	p.mut.Lock()
 	defer p.mut.Unlock()
 	if !p.isShutdown {
-		// close the channel to makes all workers terminate once the pending
+		// wake up the workers, they terminate once the pending
 		// jobs have been consumed (the pending jobs are in the Canceled state
 		// so they will simply be discarded)
-		close(p.jobQueue)
 		p.isShutdown = true
+		p.queueCond.Broadcast()
 	}
 }
 
@@ -138,7 +155,7 @@ func (p *pool) start(jobProcessor func(JobToken)) {
 		workerName := fmt.Sprintf("worker-%d", i)
 		go func() {
 			defer p.workerDone()
-			worker(workerName, p.jobQueue, jobProcessor)
+			worker(workerName, p.nextJob, jobProcessor)
 		}()
 	}
 }
@@ -148,28 +165,98 @@ func (p *pool) workerDone() {
 	p.doneWorker <- struct{}{}
 }
 
-// worker processes jobs from a channel.
-func worker(workerName string, queue chan JobToken, processor func(JobToken)) {
-	for token := range queue {
+// worker processes jobs from the queue until the pool is shut down.
+func worker(workerName string, nextJob func() (JobToken, bool), processor func(JobToken)) {
+	for token, ok := nextJob(); ok; token, ok = nextJob() {
 		if !token.cancelFlag.Canceled() {
 			processor(token)
 		}
 	}
 }
 
-// Submit adds a job to the execution queue of this pool.
+// nextJob waits for a job in the queue and removes it.
+// Returns false once the pool is shut down and the queue is empty.
+func (p *pool) nextJob() (token JobToken, ok bool) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.idleWorkers++
+	for len(p.jobQueue) == 0 && !p.isShutdown {
+		p.queueCond.Wait()
+	}
+	p.idleWorkers--
+	if len(p.jobQueue) == 0 {
+		return
+	}
+	return p.dequeue(), true
+}
+
+// dequeue removes the first job of the queue. The caller must hold the lock.
+func (p *pool) dequeue() (token JobToken) {
+	token = p.jobQueue[0]
+	p.jobQueue = p.jobQueue[1:]
+	// wake up the submitters waiting for room in the queue
+	p.queueCond.Broadcast()
+	return
+}
+
+// runPreempting runs the queued critical jobs on the worker of a background job, when no other worker is idle.
+func (p *pool) runPreempting() {
+	for {
+		p.mut.Lock()
+		if len(p.jobQueue) == 0 || p.jobQueue[0].priority < PriorityCritical || p.idleWorkers > 0 {
+			p.mut.Unlock()
+			return
+		}
+		token := p.dequeue()
+		p.mut.Unlock()
+
+		if !token.cancelFlag.Canceled() {
+			p.log.Debugf("Running job %v ahead of a background job", token.id)
+			p.processor(token)
+		}
+	}
+}
+
+// Submit adds a job with normal priority to the execution queue of this pool.
 func (p *pool) Submit(log log.T, jobID string, job Job) (err error) {
+	return p.SubmitWithPriority(log, jobID, job, PriorityNormal)
+}
+
+// SubmitWithPriority adds a job to the execution queue of this pool, after the queued jobs of the same or a higher priority.
+func (p *pool) SubmitWithPriority(log log.T, jobID string, job Job, priority Priority) (err error) {
 	token := JobToken{
 		id:         jobID,
 		job:        job,
 		cancelFlag: NewChanneledCancelFlag(),
 		log:        log,
+		priority:   priority,
 	}
 	err = p.jobStore.AddJob(jobID, &token)
 	if err != nil {
 		return
 	}
-	p.jobQueue <- token
+
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	for priority < PriorityCritical && len(p.jobQueue) >= p.maxQueued && !p.isShutdown {
+		p.queueCond.Wait()
+	}
+	if p.isShutdown {
+		p.jobStore.DeleteJob(jobID)
+		return fmt.Errorf("Job %v submitted after the pool was shut down", jobID)
+	}
+
+	position := len(p.jobQueue)
+	for i, queued := range p.jobQueue {
+		if queued.priority < priority {
+			position = i
+			break
+		}
+	}
+	p.jobQueue = append(p.jobQueue, JobToken{})
+	copy(p.jobQueue[position+1:], p.jobQueue[position:])
+	p.jobQueue[position] = token
+	p.queueCond.Broadcast()
 	return
 }
 
@@ -20,7 +20,6 @@ import (
 	"time"
 
 	"github.com/aws/amazon-ssm-agent/agent/log"
-	"github.com/aws/amazon-ssm-agent/agent/times"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -49,7 +48,7 @@ func TestPool(t *testing.T) {
 }
 
 func testPool(t *testing.T, nWorkers int, nJobs int, shouldCancel bool) {
-	clock := times.NewMockedClock()
+	clock := NewMockedClock()
 	waitTimeout := 100 * time.Millisecond
 
 	// the "After" method may be called even if shouldCancel is false
@@ -117,3 +116,76 @@ func exercisePool(t *testing.T, pool Pool, jobID string, shouldCancel bool) {
 	// see that job completes
 	assert.True(t, <-jobState)
 }
+
+func TestPoolPriority(t *testing.T) {
+	clock := NewMockedClock()
+	shutdownTimeout := 10000 * time.Millisecond
+	clock.On("After", shutdownTimeout).Return(clock.AfterChannel)
+
+	jobPool := NewPool(logger, 1, 100*time.Millisecond, clock)
+	jobPool.(*pool).maxQueued = 3
+
+	// keep the only worker busy while the other jobs are queued
+	started := make(chan bool)
+	release := make(chan bool)
+	assert.Nil(t, jobPool.Submit(logger, "blocking", func(CancelFlag) {
+		started <- true
+		<-release
+	}))
+	<-started
+
+	order := make(chan string, 3)
+	for _, job := range []struct {
+		ID       string
+		Priority Priority
+	}{
+		{ID: "background", Priority: PriorityBackground},
+		{ID: "normal", Priority: PriorityNormal},
+		{ID: "critical", Priority: PriorityCritical},
+	} {
+		jobID := job.ID
+		assert.Nil(t, jobPool.SubmitWithPriority(logger, jobID, func(CancelFlag) { order <- jobID }, job.Priority))
+	}
+	close(release)
+
+	assert.Equal(t, "critical", <-order)
+	assert.Equal(t, "normal", <-order)
+	assert.Equal(t, "background", <-order)
+	assert.True(t, jobPool.ShutdownAndWait(shutdownTimeout))
+}
+
+func TestPoolPreemptsBackgroundJobsAtSafePoints(t *testing.T) {
+	clock := NewMockedClock()
+	shutdownTimeout := 10000 * time.Millisecond
+	clock.On("After", shutdownTimeout).Return(clock.AfterChannel)
+
+	jobPool := NewPool(logger, 1, 100*time.Millisecond, clock)
+
+	started := make(chan bool)
+	proceed := make(chan bool)
+	order := make(chan string, 2)
+	assert.Nil(t, jobPool.SubmitWithPriority(logger, "background", func(cancelFlag CancelFlag) {
+		started <- true
+		<-proceed
+		SafePoint(cancelFlag)
+		order <- "background"
+	}, PriorityBackground))
+	<-started
+
+	assert.Nil(t, jobPool.SubmitWithPriority(logger, "critical", func(CancelFlag) { order <- "critical" }, PriorityCritical))
+	close(proceed)
+
+	assert.Equal(t, "critical", <-order)
+	assert.Equal(t, "background", <-order)
+	assert.True(t, jobPool.ShutdownAndWait(shutdownTimeout))
+}
+
+func TestParsePriority(t *testing.T) {
+	priority, ok := ParsePriority(" Critical")
+	assert.True(t, ok)
+	assert.Equal(t, PriorityCritical, priority)
+	assert.Equal(t, "background", PriorityBackground.String())
+
+	_, ok = ParsePriority("urgent")
+	assert.False(t, ok)
+}
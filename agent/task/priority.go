@@ -0,0 +1,72 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package task contains a default implementation of the interfaces in the task package.
+// priority contains the scheduling classes of the jobs and the safe points where background jobs yield.
+package task
+
+import (
+	"strings"
+)
+
+// Priority is the scheduling class of a job, jobs of a higher priority are started first.
+type Priority int
+
+const (
+	// PriorityBackground is for jobs which can wait, e.g. associations.
+	PriorityBackground Priority = iota
+
+	// PriorityNormal is the priority of the jobs submitted without a priority.
+	PriorityNormal
+
+	// PriorityCritical is for jobs which must not wait, e.g. security response.
+	// Queued critical jobs preempt background jobs at their safe points.
+	PriorityCritical
+)
+
+// priorityNames are the names of the priorities in documents and in the configuration.
+var priorityNames = map[string]Priority{
+	"background": PriorityBackground,
+	"normal":     PriorityNormal,
+	"critical":   PriorityCritical,
+}
+
+// ParsePriority returns the priority with the given name, the name is case insensitive.
+func ParsePriority(name string) (priority Priority, ok bool) {
+	priority, ok = priorityNames[strings.ToLower(strings.TrimSpace(name))]
+	return
+}
+
+// String returns the name of the priority.
+func (priority Priority) String() string {
+	for name, candidate := range priorityNames {
+		if candidate == priority {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// preemptibleCancelFlag is the cancel flag given to background jobs, it knows how to run the preempting jobs.
+type preemptibleCancelFlag struct {
+	*ChanneledCancelFlag
+	runPreempting func()
+}
+
+// SafePoint is called by a job between two of its steps. If the job runs with background priority,
+// the queued critical jobs are run before the job continues.
+func SafePoint(cancelFlag CancelFlag) {
+	if flag, ok := cancelFlag.(preemptibleCancelFlag); ok && !flag.Canceled() {
+		flag.runPreempting()
+	}
+}
@@ -17,7 +17,6 @@ import (
 	"testing"
 	"time"
 
-	"github.com/aws/amazon-ssm-agent/agent/times"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -27,7 +26,7 @@ type InnerFunc func()
 // The outer function is the function under test and we want to make sure
 // that the inner function is called in the right sequence
 type TestCase struct {
-	Clock               *times.MockedClock
+	Clock               *MockedClock
 	CancelFlag          *ChanneledCancelFlag
 	CancelWaitMillis    time.Duration
 	InnerFunctionPanics bool
@@ -131,7 +130,7 @@ func createTestCase(t *testing.T, innerFunctionPanics bool) TestCase {
 	}
 
 	return TestCase{
-		Clock:               times.NewMockedClock(),
+		Clock:               NewMockedClock(),
 		CancelFlag:          NewChanneledCancelFlag(),
 		CancelWaitMillis:    time.Duration(100 * time.Millisecond),
 		InnerFunctionPanics: innerFunctionPanics,
@@ -29,8 +29,8 @@ import (
 	"github.com/aws/amazon-ssm-agent/agent/plugins/pluginutil"
 	"github.com/aws/amazon-ssm-agent/agent/s3util"
 	"github.com/aws/amazon-ssm-agent/agent/sdkutil"
+	"github.com/aws/amazon-ssm-agent/agent/sdkutil/attribution"
 	"github.com/aws/amazon-ssm-agent/agent/updateutil"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
@@ -223,7 +223,7 @@ func (c *contextManager) uploadOutput(log log.T, context *UpdateContext) (err er
 	}
 	log.Infof("Uploading output files to region: %v", *awsConfig.Region)
 
-	s3 := s3.New(session.New(awsConfig))
+	s3 := s3.New(attribution.NewSession(awsConfig))
 
 	// upload outputs (if any) to s3
 	uploader := s3util.NewManager(s3)
@@ -0,0 +1,88 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package processor contains the methods for update ssm agent.
+// It also provides methods for sendReply and updateInstanceInfo
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/updateutil"
+)
+
+// healthCheckInterval is the delay between two checks of a restarted dependent service
+const healthCheckInterval = 2 * time.Second
+
+var sleep = time.Sleep
+
+// runPostUpdateHooks runs the hooks of the updater once the agent is running again.
+// A failing hook is reported in the output but does not fail the update, the agent itself is healthy.
+func runPostUpdateHooks(mgr *updateManager, log log.T, context *UpdateContext, instanceContext *updateutil.InstanceContext) {
+	for _, hook := range mgr.postHooks {
+		if err := hook(mgr, log, context, instanceContext); err != nil {
+			context.Current.AppendError(log, "%v", err)
+		}
+	}
+}
+
+// restartDependentServices restarts the dependent services declared in the configuration, in order,
+// so that they reconnect to the new agent. It stops at the first service which is not running again
+// within its health check timeout, as the next services may depend on it.
+func restartDependentServices(mgr *updateManager, log log.T, context *UpdateContext, instanceContext *updateutil.InstanceContext) (err error) {
+	var config appconfig.SsmagentConfig
+	if config, err = getAppConfig(false); err != nil {
+		return fmt.Errorf("could not load config file %v", err.Error())
+	}
+
+	services := config.Updater.DependentServices
+	for i, service := range services {
+		context.Current.AppendInfo(log, "Restarting dependent service %v", service.Name)
+		if err = mgr.util.RestartService(log, instanceContext, service.Name); err == nil {
+			err = waitForService(mgr, log, instanceContext, service)
+		}
+		if err != nil {
+			message := updateutil.BuildMessage(err, "failed to restart dependent service %v", service.Name)
+			if remaining := len(services) - i - 1; remaining > 0 {
+				message = fmt.Sprintf("%v, %v remaining dependent services were not restarted", message, remaining)
+			}
+			return errors.New(message)
+		}
+		context.Current.AppendInfo(log, "Dependent service %v is running", service.Name)
+	}
+	return nil
+}
+
+// waitForService waits for a restarted service to be running, until its health check timeout.
+func waitForService(mgr *updateManager, log log.T, instanceContext *updateutil.InstanceContext, service appconfig.DependentServiceCfg) (err error) {
+	timeout := time.Duration(service.HealthCheckTimeoutSeconds) * time.Second
+	for waited := time.Duration(0); ; waited += healthCheckInterval {
+		isRunning := false
+		if isRunning, err = mgr.util.IsNamedServiceRunning(log, instanceContext, service.Name); err == nil && isRunning {
+			return nil
+		}
+		if waited >= timeout {
+			break
+		}
+		sleep(healthCheckInterval)
+	}
+
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%v is not running after %v", service.Name, timeout)
+}
@@ -0,0 +1,83 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package processor contains the methods for update ssm agent.
+// It also provides methods for sendReply and updateInstanceInfo
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/stretchr/testify/assert"
+)
+
+func stubDependentServices(t *testing.T, services ...appconfig.DependentServiceCfg) func() {
+	originalGetAppConfig, originalSleep := getAppConfig, sleep
+	getAppConfig = func(bool) (appconfig.SsmagentConfig, error) {
+		config := appconfig.SsmagentConfig{}
+		config.Updater.DependentServices = services
+		return config, nil
+	}
+	sleep = func(time.Duration) {}
+	return func() {
+		getAppConfig, sleep = originalGetAppConfig, originalSleep
+	}
+}
+
+func TestRestartDependentServices(t *testing.T) {
+	defer stubDependentServices(t,
+		appconfig.DependentServiceCfg{Name: "session-plugin", HealthCheckTimeoutSeconds: 10},
+		appconfig.DependentServiceCfg{Name: "amazon-cloudwatch-agent", HealthCheckTimeoutSeconds: 10})()
+	control := &stubControl{serviceIsRunning: true, namedServiceIsRunning: true}
+	updater := createUpdaterStubs(control)
+	context := createUpdateContext(Installed)
+
+	err := restartDependentServices(updater.mgr, logger, context, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"session-plugin", "amazon-cloudwatch-agent"}, control.restartedServices)
+	assert.Contains(t, context.Current.StandardOut, "Dependent service amazon-cloudwatch-agent is running")
+}
+
+func TestRestartDependentServicesStopsAtUnhealthyService(t *testing.T) {
+	defer stubDependentServices(t,
+		appconfig.DependentServiceCfg{Name: "session-plugin", HealthCheckTimeoutSeconds: 10},
+		appconfig.DependentServiceCfg{Name: "amazon-cloudwatch-agent", HealthCheckTimeoutSeconds: 10})()
+	control := &stubControl{serviceIsRunning: true, namedServiceIsRunning: false}
+	updater := createUpdaterStubs(control)
+	context := createUpdateContext(Installed)
+
+	err := restartDependentServices(updater.mgr, logger, context, nil)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "session-plugin is not running after 10s")
+	assert.Contains(t, err.Error(), "1 remaining dependent services were not restarted")
+	assert.Equal(t, []string{"session-plugin"}, control.restartedServices)
+}
+
+func TestVerifyInstallationWithFailingDependentService(t *testing.T) {
+	defer stubDependentServices(t, appconfig.DependentServiceCfg{Name: "session-plugin", HealthCheckTimeoutSeconds: 10})()
+	control := &stubControl{serviceIsRunning: true, failRestartService: true}
+	updater := createUpdaterStubs(control)
+	context := createUpdateContext(Installed)
+
+	err := verifyInstallation(updater.mgr, logger, context, false)
+
+	// the agent is running, the update succeeds and reports the dependent service
+	assert.NoError(t, err)
+	assert.Equal(t, context.Histories[0].Result, contracts.ResultStatusSuccess)
+	assert.Contains(t, context.Histories[0].StandardError, "failed to restart dependent service session-plugin")
+}
@@ -41,6 +41,9 @@ type uninstall func(mgr *updateManager, log log.T, version string, context *Upda
 type install func(mgr *updateManager, log log.T, version string, context *UpdateContext) (err error)
 type download func(mgr *updateManager, log log.T, downloadInput artifact.DownloadInput, context *UpdateContext, version string) (err error)
 
+// postUpdateHook runs once the agent is running again, after its update or its rollback
+type postUpdateHook func(mgr *updateManager, log log.T, context *UpdateContext, instanceContext *updateutil.InstanceContext) (err error)
+
 type updateManager struct {
 	util      updateutil.T
 	svc       Service
@@ -52,6 +55,7 @@ type updateManager struct {
 	uninstall uninstall
 	install   install
 	download  download
+	postHooks []postUpdateHook
 }
 
 // Updater contains logic for performing agent update
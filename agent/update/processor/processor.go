@@ -47,6 +47,7 @@ func NewUpdater() *Updater {
 			uninstall: uninstallAgent,
 			install:   installAgent,
 			download:  downloadAndUnzipArtifact,
+			postHooks: []postUpdateHook{restartDependentServices},
 		},
 	}
 
@@ -290,6 +291,8 @@ func verifyInstallation(mgr *updateManager, log log.T, context *UpdateContext, i
 	}
 
 	log.Infof("%v is running", context.Current.PackageName)
+	runPostUpdateHooks(mgr, log, context, instanceContext)
+
 	if !isRollback {
 		return mgr.succeeded(context, log)
 	}
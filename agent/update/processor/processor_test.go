@@ -639,6 +639,9 @@ type stubControl struct {
 	failCreateUpdateDownloadFolder bool
 	serviceIsRunning               bool
 	failExeCommand                 bool
+	failRestartService             bool
+	namedServiceIsRunning          bool
+	restartedServices              []string
 }
 
 type utilityStub struct {
@@ -684,3 +687,15 @@ func (u *utilityStub) IsServiceRunning(log log.T, i *updateutil.InstanceContext)
 	}
 	return false, nil
 }
+
+func (u *utilityStub) RestartService(log log.T, i *updateutil.InstanceContext, name string) (err error) {
+	if u.controller.failRestartService {
+		return fmt.Errorf("cannot restart %v", name)
+	}
+	u.controller.restartedServices = append(u.controller.restartedServices, name)
+	return nil
+}
+
+func (u *utilityStub) IsNamedServiceRunning(log log.T, i *updateutil.InstanceContext, name string) (result bool, err error) {
+	return u.controller.namedServiceIsRunning, nil
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
 	"github.com/aws/amazon-ssm-agent/agent/contracts"
 	logger "github.com/aws/amazon-ssm-agent/agent/log"
 	"github.com/aws/amazon-ssm-agent/agent/platform"
@@ -54,7 +55,7 @@ var (
 )
 
 func init() {
-	log = logger.GetUpdaterLogger(logger.DefaultLogDir, defaultLogFileName)
+	log = logger.GetUpdaterLogger(appconfig.LogRootPath(logger.DefaultLogDir), defaultLogFileName)
 
 	// Sleep 2 seconds to allow agent to finishing up it's work
 	time.Sleep(defaultWaitTimeForAgentToFinish * time.Second)
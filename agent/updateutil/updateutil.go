@@ -178,6 +178,8 @@ type T interface {
 	CreateUpdateDownloadFolder() (folder string, err error)
 	ExeCommand(log log.T, cmd string, workingDir string, updaterRoot string, stdOut string, stdErr string, isAsync bool) (err error)
 	IsServiceRunning(log log.T, i *InstanceContext) (result bool, err error)
+	RestartService(log log.T, i *InstanceContext, name string) (err error)
+	IsNamedServiceRunning(log log.T, i *InstanceContext, name string) (result bool, err error)
 	SaveUpdatePluginResult(log log.T, updaterRoot string, updateResult *UpdatePluginResult) (err error)
 	IsDiskSpaceSufficientForUpdate(log log.T) (bool, error)
 	IsPlatformSupportedForUpdate(log log.T) (bool, error)
@@ -244,7 +246,7 @@ func (util *Utility) CreateInstanceContext(log log.T) (context *InstanceContext,
 
 // CreateUpdateDownloadFolder creates folder for storing update downloads
 func (util *Utility) CreateUpdateDownloadFolder() (folder string, err error) {
-	root := filepath.Join(appconfig.DownloadRoot, "update")
+	root := filepath.Join(appconfig.DownloadRootPath(), "update")
 	if err = mkDirAll(root, os.ModePerm|os.ModeDir); err != nil {
 		return "", err
 	}
@@ -348,6 +350,49 @@ func (util *Utility) IsServiceRunning(log log.T, i *InstanceContext) (result boo
 	return false, nil
 }
 
+// RestartService restarts a service of the instance, e.g. a service depending on the agent
+func (util *Utility) RestartService(log log.T, i *InstanceContext, name string) (err error) {
+	var output []byte
+	isSystemD := false
+
+	if isSystemD, err = i.IsPlatformUsingSystemD(log); err != nil {
+		return err
+	}
+
+	if isSystemD {
+		output, err = execCommand("systemctl", "restart", name).CombinedOutput()
+	} else {
+		output, err = restartServiceOutput(name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restart %v, %v %v", name, err, strings.TrimSpace(string(output)))
+	}
+
+	log.Infof("restarted %v", name)
+	return nil
+}
+
+// IsNamedServiceRunning returns whether the service with the given name is running
+func (util *Utility) IsNamedServiceRunning(log log.T, i *InstanceContext, name string) (result bool, err error) {
+	var output []byte
+	isSystemD := false
+
+	if isSystemD, err = i.IsPlatformUsingSystemD(log); err != nil {
+		return false, err
+	}
+
+	if isSystemD {
+		// is-active exits with a non zero code when the service is not active, the output tells the state
+		output, _ = execCommand("systemctl", "is-active", name).Output()
+		return strings.TrimSpace(string(output)) == "active", nil
+	}
+
+	if output, err = serviceStatusOutput(name); err != nil {
+		return false, err
+	}
+	return strings.Contains(string(output), serviceExpectedStatus(name)), nil
+}
+
 // IsDiskSpaceSufficientForUpdate loads disk space info and checks the available bytes
 // Returns true if the system has at least 100 Mb for available disk space or false if it is less than 100 Mb
 func (util *Utility) IsDiskSpaceSufficientForUpdate(log log.T) (bool, error) {
@@ -91,6 +91,20 @@ func agentExpectedStatus() string {
 	return "amazon-ssm-agent start/running"
 }
 
+func serviceStatusOutput(name string) ([]byte, error) {
+	return execCommand("status", name).Output()
+}
+
+func serviceExpectedStatus(name string) string {
+	return name + " start/running"
+}
+
+func restartServiceOutput(name string) ([]byte, error) {
+	// upstart refuses to restart a stopped job, stopping it first covers both cases
+	execCommand("stop", name).Run()
+	return execCommand("start", name).CombinedOutput()
+}
+
 func isUpdateSupported(log log.T) (bool, error) {
 	return true, nil
 }
@@ -102,6 +102,21 @@ func agentExpectedStatus() string {
 	return "RUNNING"
 }
 
+func serviceStatusOutput(name string) ([]byte, error) {
+	return execCommand("sc", "query", name).Output()
+}
+
+func serviceExpectedStatus(name string) string {
+	return "RUNNING"
+}
+
+func restartServiceOutput(name string) ([]byte, error) {
+	// Restart-Service waits for the service to stop before starting it again, unlike sc
+	command := "Restart-Service -Name '" + strings.Replace(name, "'", "''", -1) + "' -Force"
+	powershell := filepath.Join(os.Getenv("SystemRoot"), "System32", "WindowsPowerShell", "v1.0", "powershell.exe")
+	return execCommand(powershell, "-NoProfile", "-NonInteractive", "-Command", command).CombinedOutput()
+}
+
 func isUpdateSupported(log log.T) (bool, error) {
 	var sku string
 	var err error